@@ -3,6 +3,9 @@
 # This script is used to build the project automatically.
 build_objs="$1"
 rval=0
+# The engine is built with cgo only if CROWLER_CGO=1 (needed by the SQLite
+# database driver), otherwise it's built statically
+engine_cgo="${CROWLER_CGO:-0}"
 
 # Utility functions
 function checkError() {
@@ -39,7 +42,7 @@ if  [ "${build_objs}" == "all" ] ||
     [ "${build_objs}" == "cr" ] ||
     [ "${build_objs}" == "" ];
 then
-    CGO_ENABLED=0 go build
+    CGO_ENABLED=${engine_cgo} go build
     rval=$?
     if [ "${rval}" == "0" ]; then
         echo "TheCrowler built successfully!"
@@ -101,6 +104,23 @@ then
     fi
 fi
 
+if  [ "${build_objs}" == "all" ] ||
+    [ "${build_objs}" == "purgeSource" ] ||
+    [ "${build_objs}" == "ps" ] ||
+    [ "${build_objs}" == "" ];
+then
+    cmd_name="purgeSource"
+    CGO_ENABLED=0 go build ./cmd/${cmd_name}
+    rval=$?
+    if [ "${rval}" == "0" ]; then
+        echo "${cmd_name} command line tool built successfully!"
+        moveFile ${cmd_name} ./bin
+    else
+        echo "${cmd_name} command line tool build failed!"
+        exit $rval
+    fi
+fi
+
 if  [ "${build_objs}" == "all" ] ||
     [ "${build_objs}" == "api" ] ||
     [ "${build_objs}" == "" ];
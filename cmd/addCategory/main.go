@@ -77,9 +77,7 @@ func main() {
 	}
 
 	// Database connection setup
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		config.Database.Host, config.Database.Port,
-		config.Database.User, config.Database.Password, config.Database.DBName)
+	psqlInfo := cdb.ConnectionString(config)
 
 	// Connect to the database
 	db, err := sqlx.Connect(cdb.DBPostgresStr, psqlInfo)
@@ -87,6 +85,7 @@ func main() {
 		fmt.Printf("Error connecting to database: %v\n", err)
 		return
 	}
+	cdb.SetConnectionPool(db.DB, config)
 	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
 
 	// Insert categories and subcategories
@@ -63,7 +63,24 @@ func insertWebsite(db *sql.DB, source *cdb.Source) error {
 		`
 
 	// Normalize the URL
-	source.URL = normalizeURL(source.URL)
+	source.URL = cdb.NormalizeSourceURL(normalizeURL(source.URL))
+
+	// Update the equivalent website (if any) rather than adding a duplicate
+	query, args := cdb.EquivalentSourceQuery(source.URL)
+	var existingID uint64
+	err := db.QueryRow(query, args...).Scan(&existingID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if existingID != 0 {
+		_, err = db.Exec(`UPDATE Sources SET url = $1, category_id = $2, usr_id = $3, restricted = $4, flags = $5, config = COALESCE($6, config), last_updated_at = NOW() WHERE source_id = $7`,
+			source.URL, source.CategoryID, source.UsrID, source.Restricted, source.Flags, source.Config, existingID)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Website already present, updated Source ID: ", existingID)
+		return nil
+	}
 
 	// Execute the SQL statement and get the ID of the inserted website
 	results, err := db.Query(stmt, source.URL, source.CategoryID, source.UsrID, source.Restricted, source.Flags, source.Config)
@@ -123,13 +140,12 @@ func main() {
 	}
 
 	// Database connection setup (replace with your actual database configuration)
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		config.Database.Host, config.Database.Port,
-		config.Database.User, config.Database.Password, config.Database.DBName)
+	psqlInfo := cdb.ConnectionString(config)
 	db, err := sql.Open(cdb.DBPostgresStr, psqlInfo)
 	if err != nil {
 		log.Fatal(err)
 	}
+	cdb.SetConnectionPool(db, config)
 	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
 
 	// Check if the URL is provided
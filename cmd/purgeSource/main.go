@@ -0,0 +1,88 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (purgeSource) is a command line that allows to purge the
+// crawled data of a source (all of it, or the data older than a number of
+// days) from TheCROWler DB and its image storage, keeping the source.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	crowler "github.com/pzaino/thecrowler/pkg/crawler"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+var (
+	config cfg.Config
+)
+
+func main() {
+	configFile := flag.String("config", "config.yaml", "Path to the configuration file")
+	sourceID := flag.Uint64("id", 0, "ID of the source to purge")
+	siteURL := flag.String("url", "", "URL of the source to purge (if the ID isn't provided)")
+	olderThan := flag.Int("older-than", 0, "Purge only the data older than this number of days (0 purges all the data)")
+	flag.Parse()
+
+	// Read the configuration file
+	var err error
+	config, err = cfg.LoadConfig(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check if the source is provided
+	if *sourceID == 0 && *siteURL == "" {
+		log.Fatal("Please provide the ID or the URL of the source to purge.")
+	}
+	if *olderThan < 0 {
+		log.Fatal("Please provide a positive number of days.")
+	}
+
+	// Database connection setup
+	db, err := cdb.NewHandler(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = db.Connect(config); err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
+
+	if *sourceID == 0 {
+		*sourceID, err = cdb.FindEquivalentSource(&db, cdb.NormalizeSourceURL(*siteURL))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *sourceID == 0 {
+			log.Fatalf("Source '%s' not found.", *siteURL)
+		}
+	}
+
+	var cutoff time.Time
+	if *olderThan > 0 {
+		cutoff = time.Now().AddDate(0, 0, -*olderThan)
+	}
+
+	// Purge the source data (the crawler removes the files from the image storage)
+	crowler.StartCrawler(config)
+	purged, err := crowler.PurgeSource(db, *sourceID, cutoff)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Source %d purged: %d pages removed, %d shared pages unlinked, %d files removed\n", *sourceID, purged.Pages, purged.Unlinked, len(purged.Files))
+}
@@ -19,7 +19,6 @@ package main
 import (
 	"database/sql"
 	"flag"
-	"fmt"
 	"log"
 
 	cfg "github.com/pzaino/thecrowler/pkg/config"
@@ -123,13 +122,12 @@ func main() {
 	}
 
 	// Database connection setup (replace with your actual database configuration)
-	psqlInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		config.Database.Host, config.Database.Port,
-		config.Database.User, config.Database.Password, config.Database.DBName)
+	psqlInfo := cdb.ConnectionString(config)
 	db, err := sql.Open(cdb.DBPostgresStr, psqlInfo)
 	if err != nil {
 		log.Fatal(err)
 	}
+	cdb.SetConnectionPool(db, config)
 	defer db.Close() //nolint:errcheck // We can't check the error in a defer statement
 
 	// Remove the website
@@ -21,14 +21,17 @@ require (
 require (
 	github.com/Ullaakut/nmap/v3 v3.0.5
 	github.com/evanw/esbuild v0.25.0
+	github.com/go-sql-driver/mysql v1.8.1
 	github.com/jmoiron/sqlx v1.4.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/spaolacci/murmur3 v1.1.0
 	golang.org/x/crypto v0.33.0
 )
 
-require golang.org/x/sync v0.11.0 // indirect
+require golang.org/x/sync v0.11.0
 
 require (
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/antchfx/xpath v1.3.3 // indirect
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
@@ -52,6 +55,7 @@ require (
 require (
 	github.com/antchfx/htmlquery v1.3.4
 	github.com/go-auxiliaries/selenium v0.9.10
+	github.com/ledongthuc/pdf v0.0.0-20240201131950-da5b75280b06
 	github.com/mafredri/cdp v0.35.0
 	github.com/prometheus/client_golang v1.20.5
 	github.com/stretchr/testify v1.10.0
@@ -68,5 +72,5 @@ require (
 	github.com/blang/semver v3.5.1+incompatible // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	golang.org/x/net v0.35.0
-	golang.org/x/text v0.22.0 // indirect
+	golang.org/x/text v0.22.0
 )
@@ -22,7 +22,10 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -51,7 +54,10 @@ import (
 )
 
 const (
-	sleepTime = 30 * time.Second // Time to sleep when no URLs are found
+	sleepTime       = 30 * time.Second // Time to sleep when no URLs are found
+	shutdownTimeout = 2 * time.Minute  // Maximum time to wait for the running crawls to stop on shutdown
+
+	maxSourceRequestSize = 1 << 20 // Maximum size of the body of a request adding a Source
 )
 
 var (
@@ -92,6 +98,7 @@ var (
 // crawling job on the pipeline. It's used to pass the information to the goroutines
 // that will perform the actual crawling.
 type WorkBlock struct {
+	ctx            context.Context // The root context (cancelled on shutdown)
 	db             cdb.Handler
 	sel            *chan vdi.SeleniumInstance
 	sources        *[]cdb.Source
@@ -105,6 +112,38 @@ type HealthCheck struct {
 	Status string `json:"status"`
 }
 
+// SourceRequest is the body of a request adding a Source to crawl
+type SourceRequest struct {
+	URL        string          `json:"url"`
+	Restricted *int            `json:"restricted,omitempty"` // The restriction level (0-4), default_restricted if not set
+	Config     json.RawMessage `json:"config,omitempty"`     // The Source configuration
+}
+
+// SourceResponse is the response of the Sources endpoints: the ID of the
+// added Source, or the crawl status of a Source
+type SourceResponse struct {
+	SourceID      uint64 `json:"source_id"`
+	Message       string `json:"message,omitempty"`
+	URL           string `json:"url,omitempty"`
+	Status        string `json:"status,omitempty"`
+	LastCrawledAt string `json:"last_crawled_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	LastErrorAt   string `json:"last_error_at,omitempty"`
+}
+
+// PurgeResponse represents the response of the purge of a Source data
+type PurgeResponse struct {
+	SourceID uint64 `json:"source_id"`
+	Pages    int64  `json:"pages"`    // Pages removed
+	Unlinked int64  `json:"unlinked"` // Pages shared with other Sources, unlinked from it
+	Files    int    `json:"files"`    // Stored files (screenshots) removed
+}
+
+var (
+	errInvalidSource = errors.New("invalid source")
+	errSourceExists  = errors.New("source already present")
+)
+
 // This function is responsible for performing database maintenance
 // to keep it lean and fast. Note: it's specific for PostgreSQL.
 func performDBMaintenance(db cdb.Handler) error {
@@ -148,104 +187,77 @@ func performDBMaintenance(db cdb.Handler) error {
 }
 
 // This function simply query the database for URLs that need to be crawled
-func retrieveAvailableSources(db cdb.Handler) ([]cdb.Source, error) {
+// (at most limit Sources)
+func retrieveAvailableSources(db cdb.Handler, limit int) ([]cdb.Source, error) {
 	// Check DB connection:
 	if err := db.CheckConnection(config); err != nil {
 		return nil, fmt.Errorf("error pinging the database: %w", err)
 	}
 
-	// Start a transaction
-	tx, err := db.Begin()
-	if err != nil {
-		return nil, err
-	}
-	// Update the SQL query to fetch all necessary fields
-	query := `
-	SELECT
-		l.source_id,
-		l.url,
-		l.restricted,
-		l.flags,
-		l.config
-	FROM
-		update_sources($1,$2,$3,$4,$5,$6) AS l
-	ORDER BY l.last_updated_at ASC;`
-
-	// Execute the query within the transaction
-	// TODO: Add the intervals to the query to allow a user to decide how often to crawl a source etc.
-	//       replace the empty strings here with: last_ok_update, last_error, regular_crawling, processing_timeout
-	rows, err := tx.Query(query, config.Crawler.MaxSources, cmn.GetEngineID(), config.Crawler.CrawlingIfOk, config.Crawler.CrawlingIfError, config.Crawler.CrawlingInterval, config.Crawler.ProcessingTimeout)
-	if err != nil {
-		err2 := tx.Rollback()
-		if err2 != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "rolling back transaction: %v", err2)
-		}
-		return nil, err
-	}
-
-	// Iterate over the results and store them in a slice
-	var sourcesToCrawl []cdb.Source
-	for rows.Next() {
-		var src cdb.Source
-		if err := rows.Scan(&src.ID, &src.URL, &src.Restricted, &src.Flags, &src.Config); err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "scanning rows: %v", err)
-			err2 := rows.Close()
-			if err2 != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "closing rows iterator: %v", err2)
-			}
-			err2 = tx.Rollback()
-			if err2 != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "rolling back transaction: %v", err2)
-			}
-			return nil, err
-		}
-
-		// Check if Config is nil and assign a default configuration if so
-		if src.Config == nil {
-			src.Config = new(json.RawMessage)
-			*src.Config = cdb.DefaultSourceCfgJSON
-		}
-
-		// Append the source to the slice
-		sourcesToCrawl = append(sourcesToCrawl, src)
-		src = cdb.Source{} // Reset the source
-	}
-	err = rows.Close() // Close the rows iterator
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "closing rows iterator: %v", err)
-	}
-
-	// Commit the transaction if everything is successful
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
-
-	return sourcesToCrawl, nil
+	// Select the sources to crawl (and mark them as processing by this engine)
+	return cdb.SourcesToCrawl(&db, limit, cmn.GetEngineID(), config.Crawler)
 }
 
 // This function is responsible for checking the database for URLs that need to be crawled
-// and kickstart the crawling process for each of them
-func checkSources(db *cdb.Handler, sel *chan vdi.SeleniumInstance, RulesEngine *rules.RuleEngine) {
+// and kickstart the crawling process for each of them. It returns when ctx is
+// cancelled (and the running crawls have stopped).
+func checkSources(ctx context.Context, db *cdb.Handler, vdiPool **vdi.Pool, RulesEngine *rules.RuleEngine) {
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Checking sources...")
-	// Initialize the pipeline status
-	PipelineStatus := make([]crowler.Status, config.Crawler.MaxSources)
+	// Initialize the pipelines (the concurrent crawlers) and their status report
+	pl := newPipelines(config.Crawler.MaxConcurrentSources)
+	go reportStatus(ctx, &pl.status, time.Duration(config.Crawler.ReportInterval)*time.Minute)
 	// Set the maintenance time
 	maintenanceTime := time.Now().Add(time.Duration(config.Crawler.Maintenance) * time.Minute)
 	// Set the resource release time
 	resourceReleaseTime := time.Now().Add(time.Duration(5) * time.Minute)
+	// Set the start time of the new sources intake (for its ramp-up)
+	intakeStartTime := time.Now()
+
+	// Pick up the sources left with an unfinished crawl queue by a previous run of this engine
+	if config.Crawler.PersistQueue {
+		host := strings.SplitN(cmn.GetEngineID(), ":", 2)[0]
+		if resumed, err := cdb.ResumeQueuedSources(db, host); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "resuming queued sources: %v", err)
+		} else if resumed > 0 {
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Sources with an unfinished crawl queue resumed: %d", resumed)
+		}
+	}
 
 	// Start the main loop
-	defer configMutex.RUnlock()
 	for {
 		configMutex.RLock()
 
-		// Retrieve the sources to crawl
-		sourcesToCrawl, err := retrieveAvailableSources(*db)
+		// Stop checking sources on shutdown
+		if ctx.Err() != nil {
+			configMutex.RUnlock()
+			pl.running.Wait()
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Stopped checking sources.")
+			return
+		}
+
+		// Wait for a free pipeline
+		free := pl.available()
+		if free == 0 {
+			configMutex.RUnlock()
+			pl.waitFree(ctx)
+			continue
+		}
+
+		// Retrieve the sources to crawl (throttling the new sources intake)
+		intakeLimit := crowler.SourceIntakeLimit(config.Crawler, intakeStartTime, time.Now())
+		throttled := intakeLimit < config.Crawler.MaxSources
+		if throttled {
+			cmn.DebugMsg(cmn.DbgLvlDebug2, "Sources intake limited to %d this cycle", intakeLimit)
+		}
+		if intakeLimit > free {
+			intakeLimit = free
+		}
+		sourcesToCrawl, err := retrieveAvailableSources(*db, intakeLimit)
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "retrieving sources: %v", err)
 			// We are about to go to sleep, so we can handle signals for reloading the configuration
 			configMutex.RUnlock()
-			time.Sleep(sleepTime)
+			sleepOrDone(ctx, sleepTime)
 			continue
 		}
 		cmn.DebugMsg(cmn.DbgLvlDebug2, "Sources to crawl: %d", len(sourcesToCrawl))
@@ -254,8 +266,9 @@ func checkSources(db *cdb.Handler, sel *chan vdi.SeleniumInstance, RulesEngine *
 		if len(sourcesToCrawl) == 0 {
 			cmn.DebugMsg(cmn.DbgLvlDebug, "No sources to crawl, sleeping...")
 
-			// Perform database maintenance if it's time
-			if time.Now().After(maintenanceTime) {
+			// Perform database maintenance if it's time (and no crawl is
+			// running, the maintenance would slow them down)
+			if time.Now().After(maintenanceTime) && pl.idle() {
 				performDatabaseMaintenance(*db)
 				maintenanceTime = time.Now().Add(time.Duration(config.Crawler.Maintenance) * time.Minute)
 				cmn.DebugMsg(cmn.DbgLvlDebug2, "Database maintenance every: %d", config.Crawler.Maintenance)
@@ -268,39 +281,76 @@ func checkSources(db *cdb.Handler, sel *chan vdi.SeleniumInstance, RulesEngine *
 				debug.FreeOSMemory() // Force release of unused memory to the OS
 				resourceReleaseTime = time.Now().Add(time.Duration(5) * time.Minute)
 			}
-			time.Sleep(sleepTime)
+			sleepOrDone(ctx, sleepTime)
 			continue
 		}
 
-		// Crawl each source
-		workBlock := WorkBlock{
-			db:             *db,
-			sel:            sel,
-			sources:        &sourcesToCrawl,
-			RulesEngine:    RulesEngine,
-			PipelineStatus: &PipelineStatus,
-			Config:         &config,
-		}
-		crawlSources(&workBlock)
+		// Crawl each source on a free pipeline (without waiting for the
+		// crawls to complete, so a slow source doesn't block the others)
+		crawlSources(ctx, db, vdiPool, RulesEngine, pl, sourcesToCrawl)
 
-		// We have completed all jobs, so we can handle signals for reloading the configuration
 		configMutex.RUnlock()
+		if throttled {
+			// The intake is throttled per cycle, so wait for the next one
+			sleepOrDone(ctx, sleepTime)
+		}
+	}
+}
 
-		sourcesToCrawl = []cdb.Source{} // Reset the sources
-		// Return all instances to sel *chan crowler.SeleniumInstance
-		/*
-			for i := 0; i < len(config.Selenium); i++ {
-				*sel <- crowler.SeleniumInstance{
-					Service: nil,
-					Config:  config.Selenium[i],
-				}
-			}
-		*/
+// pipelines is the bounded set of the concurrent crawlers of the engine:
+// each source to crawl is dispatched to a free pipeline, which pulls a VDI
+// instance from the VDI pool to crawl it
+type pipelines struct {
+	free    chan uint64      // The indexes of the free pipelines
+	status  []crowler.Status // The status of each pipeline
+	running sync.WaitGroup   // The running crawls
+}
+
+// newPipelines returns n free pipelines
+func newPipelines(n int) *pipelines {
+	if n < 1 {
+		n = 1
+	}
+	pl := &pipelines{
+		free:   make(chan uint64, n),
+		status: make([]crowler.Status, n),
+	}
+	for idx := 0; idx < n; idx++ {
+		pl.free <- uint64(idx) //nolint:gosec // Disable G115 (idx is never negative)
+	}
+	return pl
+}
+
+// available returns the number of free pipelines
+func (pl *pipelines) available() int {
+	return len(pl.free)
+}
+
+// idle returns true if all the pipelines are free (no crawl is running)
+func (pl *pipelines) idle() bool {
+	return pl.available() == cap(pl.free)
+}
+
+// waitFree waits until a pipeline is free (or ctx is cancelled)
+func (pl *pipelines) waitFree(ctx context.Context) {
+	select {
+	case idx := <-pl.free:
+		pl.free <- idx
+	case <-ctx.Done():
+	}
+}
+
+// sleepOrDone sleeps for d, or until ctx is cancelled
+func sleepOrDone(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
 	}
 }
 
 func performDatabaseMaintenance(db cdb.Handler) {
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Performing database maintenance...")
+	purgeExpiredData(db)
 	if err := performDBMaintenance(db); err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "performing database maintenance: %v", err)
 	} else {
@@ -308,92 +358,127 @@ func performDatabaseMaintenance(db cdb.Handler) {
 	}
 }
 
-func crawlSources(wb *WorkBlock) {
-	// Start a goroutine to log the status periodically
-	go func(plStatus *[]crowler.Status) {
-		ticker := time.NewTicker(time.Duration(wb.Config.Crawler.ReportInterval) * time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			// Check if all the pipelines have completed
-			pipelinesRunning := false
-			for _, status := range *plStatus {
-				if status.PipelineRunning == 1 {
-					pipelinesRunning = true
-					break
-				}
-			}
-			logStatus(plStatus)
-			if !pipelinesRunning {
-				// All pipelines have completed
-				// Stop the ticker
-				break
+// purgeExpiredData purges the crawled data of the sources older than their
+// data retention period (the crawler data_retention, which a source can
+// override in its custom configuration)
+func purgeExpiredData(db cdb.Handler) {
+	sources, err := cdb.ListSources(&db, nil, nil)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "listing the sources to purge: %v", err)
+		return
+	}
+	for _, source := range sources {
+		retention := config.Crawler.DataRetention
+		if source.Config != nil && len(*source.Config) > 0 {
+			srcConfig, err := cfg.CombineConfig(*cfg.DeepCopyConfig(&config), *source.Config)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "combining the configuration of source %d: %v", source.ID, err)
+			} else {
+				retention = srcConfig.Crawler.DataRetention
 			}
 		}
-	}(wb.PipelineStatus)
-
-	// Start the crawling process for each source
-	var wg sync.WaitGroup                                    // WaitGroup to wait for all goroutines to finish
-	selIdx := 0                                              // Selenium instance index
-	sourceIdx := 0                                           // Source index
-	var maxSrc uint64 = uint64(wb.Config.Crawler.MaxSources) //nolint:gosec // DIsable G115 (integer overflow, given the MaxSources value is fully tested)
-	for idx := uint64(0); idx < maxSrc; idx++ {
-		// Check if the pipeline is already running
-		if (*wb.PipelineStatus)[idx].PipelineRunning == 1 {
+		if retention <= 0 {
 			continue
 		}
-
-		// Get the source to crawl
-		source := (*wb.sources)[sourceIdx]
-		wg.Add(1)
-
-		// Initialize the status
-		(*wb.PipelineStatus)[idx] = crowler.Status{
-			PipelineID:      idx,
-			Source:          source.URL,
-			SourceID:        source.ID,
-			PipelineRunning: 0,
-			CrawlingRunning: 0,
-			NetInfoRunning:  0,
-			HTTPInfoRunning: 0,
-			TotalPages:      0,
-			TotalErrors:     0,
-			TotalLinks:      0,
-			TotalSkipped:    0,
-			TotalDuplicates: 0,
-			TotalScraped:    0,
-			TotalActions:    0,
-			LastWait:        0,
-			LastDelay:       0,
+		if _, err := crowler.PurgeSource(db, source.ID, time.Now().AddDate(0, 0, -retention)); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "purging the expired data of source %d: %v", source.ID, err)
 		}
+	}
+}
 
-		// Start a goroutine to crawl the website
-		startCrawling(wb, &wg, selIdx, source, idx)
-
-		// Increment the Source index to get the next source
-		sourceIdx++
-		if sourceIdx >= len(*wb.sources) {
-			break // We have reached the end of the sources
+// reportStatus logs the status of the pipelines every interval, until ctx is
+// cancelled
+func reportStatus(ctx context.Context, plStatus *[]crowler.Status, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logStatus(plStatus)
 		}
 	}
+}
 
-	wg.Wait() // Block until all goroutines have decremented the counter
+// crawlSources dispatches each source to a free pipeline (there is one for
+// each source, see checkSources) and returns without waiting for the crawls
+// to complete. Each pipeline is freed when its crawl completes.
+// It's called with the configuration read-locked: the crawls use the
+// configuration, the database and the VDI pool picked here, so they don't
+// hold the lock (and a configuration reload doesn't wait for them).
+func crawlSources(ctx context.Context, db *cdb.Handler, vdiPool **vdi.Pool, RulesEngine *rules.RuleEngine, pl *pipelines, sources []cdb.Source) {
+	crawlDB := *db
+	sel := (*vdiPool).Channel()
+	crawlConfig := cfg.DeepCopyConfig(&config)
+
+	pl.dispatch(sources, func(source cdb.Source, idx uint64) {
+		workBlock := WorkBlock{
+			ctx:            ctx,
+			db:             crawlDB,
+			sel:            sel,
+			sources:        &sources,
+			RulesEngine:    RulesEngine,
+			PipelineStatus: &pl.status,
+			Config:         crawlConfig,
+		}
 
-	cmn.DebugMsg(cmn.DbgLvlInfo, "All sources in this batch have been crawled.")
+		// Crawl the website and wait for its completion
+		var wg sync.WaitGroup
+		wg.Add(1)
+		startCrawling(&workBlock, &wg, source, idx)
+		wg.Wait()
+	})
+}
 
-	// Reset all Pipelines status
-	for idx := uint64(0); idx < maxSrc; idx++ {
-		(*wb.PipelineStatus)[idx].PipelineRunning = 0
+// dispatch runs crawl for each source on a free pipeline (waiting for one,
+// if none is free) and returns without waiting for the crawls to complete.
+// Each pipeline is freed when its crawl returns.
+func (pl *pipelines) dispatch(sources []cdb.Source, crawl func(source cdb.Source, idx uint64)) {
+	for _, source := range sources {
+		idx := <-pl.free
+		pl.running.Add(1)
+		go func(source cdb.Source, idx uint64) {
+			defer pl.running.Done()
+
+			// Initialize the status
+			pl.status[idx] = crowler.Status{
+				PipelineID:      idx,
+				Source:          source.URL,
+				SourceID:        source.ID,
+				PipelineRunning: 0,
+				CrawlingRunning: 0,
+				NetInfoRunning:  0,
+				HTTPInfoRunning: 0,
+				TotalPages:      0,
+				TotalErrors:     0,
+				TotalLinks:      0,
+				TotalSkipped:    0,
+				TotalDuplicates: 0,
+				TotalScraped:    0,
+				TotalActions:    0,
+				LastWait:        0,
+				LastDelay:       0,
+			}
+
+			crawl(source, idx)
+
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Pipeline %d completed, crawled source: %d", idx, source.ID)
+			pl.free <- idx
+		}(source, idx)
 	}
 }
 
-func startCrawling(wb *WorkBlock, wg *sync.WaitGroup, selIdx int, source cdb.Source, idx uint64) {
+func startCrawling(wb *WorkBlock, wg *sync.WaitGroup, source cdb.Source, idx uint64) {
 	// Prepare the go routine parameters
 	args := crowler.Pars{
 		WG:      wg,
 		DB:      wb.db,
 		Src:     source,
 		Sel:     wb.sel,
-		SelIdx:  selIdx,
 		RE:      wb.RulesEngine,
 		Sources: wb.sources,
 		Index:   idx,
@@ -427,13 +512,14 @@ func startCrawling(wb *WorkBlock, wg *sync.WaitGroup, selIdx int, source cdb.Sou
 
 		// Fetch the next available Selenium instance (VDI)
 		vdiInstance := <-*args.Sel
+		args.SelIdx = vdiInstance.Index
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Acquired VDI instance: %v", vdiInstance.Config.Host)
 
 		// Create a channel that will signal when the VDI is no longer needed
 		releaseVDI := make(chan vdi.SeleniumInstance, 1) // Make it buffered
 
 		go func() {
-			crowler.CrawlWebsite(args, vdiInstance, releaseVDI)
+			crowler.CrawlWebsite(wb.ctx, args, vdiInstance, releaseVDI)
 		}()
 
 		// Wait for `CrawlWebsite()` to release the VDI
@@ -557,7 +643,7 @@ func StatusStr(condition int) string {
 }
 
 func initAll(configFile *string, config *cfg.Config,
-	db *cdb.Handler, vdiInstances *chan vdi.SeleniumInstance,
+	db *cdb.Handler, vdiPool **vdi.Pool,
 	RulesEngine *rules.RuleEngine, lmt **rate.Limiter) error {
 	var err error
 
@@ -604,17 +690,15 @@ func initAll(configFile *string, config *cfg.Config,
 	*lmt = rate.NewLimiter(rate.Limit(rl), bl)
 
 	// Reinitialize the VDI instances available to this engine
-	*vdiInstances = make(chan vdi.SeleniumInstance, len(config.Selenium))
-	for _, seleniumConfig := range config.Selenium {
-		selService, err := vdi.NewVDIService(seleniumConfig)
-		if err != nil {
-			return fmt.Errorf("creating Selenium Instances: %s", err)
-		}
-		*vdiInstances <- vdi.SeleniumInstance{
-			Service: selService,
-			Config:  seleniumConfig,
-		}
+	if *vdiPool != nil {
+		(*vdiPool).Close()
 	}
+	*vdiPool, err = vdi.NewPool(config.Selenium)
+	if err != nil {
+		return fmt.Errorf("creating Selenium Instances: %s", err)
+	}
+	(*vdiPool).StartHealthChecks(context.Background(), time.Duration(config.Crawler.VDIHealthCheck)*time.Second)
+	cmn.DebugMsg(cmn.DbgLvlInfo, "VDI instances available: %d", (*vdiPool).Size())
 
 	// Initialize the rules engine
 	*RulesEngine = rules.NewEmptyRuleEngine(config.RulesetsSchemaPath)
@@ -639,6 +723,12 @@ func initAll(configFile *string, config *cfg.Config,
 		prometheus.MustRegister(totalErrors)
 	}
 
+	// Make sure we are crawling from the expected network (if required)
+	err = crowler.CheckEgress(config.Crawler)
+	if err != nil {
+		return fmt.Errorf("checking egress network: %s", err)
+	}
+
 	// Start the crawler
 	crowler.StartCrawler(*config)
 
@@ -657,8 +747,25 @@ func main() {
 	// Define db before we set signal handlers
 	var db cdb.Handler
 
-	// Define sel before we set signal handlers
-	var vdiInstances chan vdi.SeleniumInstance
+	// Define the VDI pool before we set signal handlers
+	var vdiPool *vdi.Pool
+
+	// The root context of the crawls, cancelled on shutdown
+	rootCtx, cancelCrawls := context.WithCancel(context.Background())
+	defer cancelCrawls()
+	crawlsDone := make(chan struct{}) // Closed when the crawls have stopped
+
+	// shutdown stops the running crawls (gracefully, the first time it's
+	// called, immediately the second one)
+	shutdown := func(sigName string) {
+		if rootCtx.Err() != nil {
+			cmn.DebugMsg(cmn.DbgLvlInfo, "%s received again, shutting down immediately...", sigName)
+			closeResources(db, vdiPool) // Release resources
+			os.Exit(1)
+		}
+		cmn.DebugMsg(cmn.DbgLvlInfo, "%s received, shutting down (waiting for the running crawls to stop)...", sigName)
+		cancelCrawls()
+	}
 
 	// Setting up a channel to listen for termination signals
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Setting up termination signals listener...")
@@ -672,27 +779,21 @@ func main() {
 			switch sig {
 			case syscall.SIGINT:
 				// Handle SIGINT (Ctrl+C)
-				cmn.DebugMsg(cmn.DbgLvlInfo, "SIGINT received, shutting down...")
-				closeResources(db, vdiInstances) // Release resources
-				os.Exit(0)
+				shutdown("SIGINT")
 
 			case syscall.SIGTERM:
 				// Handle SIGTERM
-				cmn.DebugMsg(cmn.DbgLvlInfo, "SIGTERM received, shutting down...")
-				closeResources(db, vdiInstances) // Release resources
-				os.Exit(0)
+				shutdown("SIGTERM")
 
 			case syscall.SIGQUIT:
 				// Handle SIGQUIT
-				cmn.DebugMsg(cmn.DbgLvlInfo, "SIGQUIT received, shutting down...")
-				closeResources(db, vdiInstances) // Release resources
-				os.Exit(0)
+				shutdown("SIGQUIT")
 
 			case syscall.SIGHUP:
 				// Handle SIGHUP
 				cmn.DebugMsg(cmn.DbgLvlInfo, "SIGHUP received, will reload configuration as soon as all pending jobs are completed...")
 				configMutex.Lock()
-				err := initAll(configFile, &config, &db, &vdiInstances, &GRulesEngine, &limiter)
+				err := initAll(configFile, &config, &db, &vdiPool, &GRulesEngine, &limiter)
 				if err != nil {
 					configMutex.Unlock()
 					cmn.DebugMsg(cmn.DbgLvlFatal, "initializing the crawler: %v", err)
@@ -701,19 +802,19 @@ func main() {
 				err = db.Connect(config)
 				if err != nil {
 					configMutex.Unlock()
-					closeResources(db, vdiInstances) // Release resources
+					closeResources(db, vdiPool) // Release resources
 					cmn.DebugMsg(cmn.DbgLvlFatal, "connecting to the database: %v", err)
 				}
 				cmn.DebugMsg(cmn.DbgLvlInfo, "Database connection re-established.")
 				configMutex.Unlock()
 				cmn.DebugMsg(cmn.DbgLvlInfo, "Configuration reloaded.")
-				//go checkSources(&db, vdiInstances)
+				//go checkSources(&db, &vdiPool)
 			}
 		}
 	}()
 
 	// Initialize the crawler
-	err := initAll(configFile, &config, &db, &vdiInstances, &GRulesEngine, &limiter)
+	err := initAll(configFile, &config, &db, &vdiPool, &GRulesEngine, &limiter)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlFatal, "initializing the crawler: %v", err)
 	}
@@ -721,18 +822,23 @@ func main() {
 	// Connect to the database
 	err = db.Connect(config)
 	if err != nil {
-		closeResources(db, vdiInstances) // Release resources
+		closeResources(db, vdiPool) // Release resources
 		cmn.DebugMsg(cmn.DbgLvlFatal, "connecting to the database: %v", err)
 	}
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Database connection established.")
-	defer closeResources(db, vdiInstances)
+	defer func() {
+		closeResources(db, vdiPool)
+	}()
 
 	// Start events listener
 	go cdb.ListenForEvents(&db, handleNotification)
 
 	// Start the checkSources function in a goroutine
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Starting processing data (if any)...")
-	go checkSources(&db, &vdiInstances, &GRulesEngine)
+	go func() {
+		checkSources(rootCtx, &db, &vdiPool, &GRulesEngine)
+		close(crawlsDone)
+	}()
 
 	// Start the internal/control API server
 	srv := &http.Server{
@@ -770,8 +876,24 @@ func main() {
 		IdleTimeout: time.Duration(config.Crawler.Control.Timeout) * time.Second,
 	}
 
+	// Stop the server on shutdown, once the crawls have stopped
+	go func() {
+		<-rootCtx.Done()
+		select {
+		case <-crawlsDone:
+			cmn.DebugMsg(cmn.DbgLvlInfo, "All crawls stopped.")
+		case <-time.After(shutdownTimeout):
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Timed out waiting for the running crawls to stop after %v", shutdownTimeout)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "stopping the server: %v", err)
+		}
+	}()
+
 	// Set the handlers
-	initAPIv1()
+	initAPIv1(db)
 
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Starting server on %s:%d", config.Crawler.Control.Host, config.Crawler.Control.Port)
 	var rStatus error
@@ -780,6 +902,10 @@ func main() {
 	} else {
 		rStatus = srv.ListenAndServe()
 	}
+	if errors.Is(rStatus, http.ErrServerClosed) {
+		cmn.DebugMsg(cmn.DbgLvlInfo, "Server stopped, The CROWler has shut down.")
+		return
+	}
 	statusMsg := "Server stopped."
 	if rStatus != nil {
 		statusMsg = fmt.Sprintf("Server stopped with error: %v", rStatus)
@@ -872,7 +998,7 @@ func updateDebugLevel(newLevel string) {
 }
 
 // initAPIv1 initializes the API v1 handlers
-func initAPIv1() {
+func initAPIv1(db cdb.Handler) {
 	// Health check
 	healthCheckWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(healthCheckHandler)))
 
@@ -882,6 +1008,12 @@ func initAPIv1() {
 	configCheckWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(configCheckHandler)))
 
 	http.Handle("/v1/config", configCheckWithMiddlewares)
+
+	// Sources (so other services can submit new Sources to crawl)
+	if config.API.EnableConsole {
+		http.Handle("/v1/sources", SecurityHeadersMiddleware(RateLimitMiddleware(addSourceHandler(db))))
+		http.Handle("/v1/sources/", SecurityHeadersMiddleware(RateLimitMiddleware(sourceHandler(db))))
+	}
 }
 
 // RateLimitMiddleware is a middleware for rate limiting
@@ -943,7 +1075,180 @@ func configCheckHandler(w http.ResponseWriter, _ *http.Request) {
 	handleErrorAndRespond(w, nil, configCopy, "Error in configuration Check: ", http.StatusInternalServerError, http.StatusOK)
 }
 
-func closeResources(db cdb.Handler, sel chan vdi.SeleniumInstance) {
+// addSourceHandler adds a new Source to crawl (POST /v1/sources), responding
+// with its ID
+func addSourceHandler(db cdb.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req SourceRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSourceRequestSize)).Decode(&req); err != nil {
+			handleErrorAndRespond(w, fmt.Errorf("invalid request: %v", err), nil, "Error in add source: %v", http.StatusBadRequest, http.StatusCreated)
+			return
+		}
+
+		sourceID, err := addSource(db, req)
+		switch {
+		case errors.Is(err, errSourceExists):
+			// Not an error for the caller, it gets the ID of the existing Source
+			handleErrorAndRespond(w, nil, SourceResponse{SourceID: sourceID, Message: err.Error()}, "", http.StatusConflict, http.StatusConflict)
+		case errors.Is(err, errInvalidSource):
+			handleErrorAndRespond(w, err, nil, "Error in add source: %v", http.StatusBadRequest, http.StatusCreated)
+		case err != nil:
+			cmn.DebugMsg(cmn.DbgLvlError, "adding source '%s': %v", req.URL, err)
+			handleErrorAndRespond(w, errors.New("failed to add the source"), nil, "Error in add source: %v", http.StatusInternalServerError, http.StatusCreated)
+		default:
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Source %d added: %s", sourceID, req.URL)
+			handleErrorAndRespond(w, nil, SourceResponse{SourceID: sourceID, Message: "Source added"}, "", http.StatusInternalServerError, http.StatusCreated)
+		}
+	}
+}
+
+// sourceHandler dispatches the requests on a Source: its crawl status
+// (/v1/sources/{id}) and the purge of its data (/v1/sources/{id}/purge)
+func sourceHandler(db cdb.Handler) http.HandlerFunc {
+	statusHandler := sourceStatusHandler(db)
+	purgeHandler := purgeSourceHandler(db)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/purge") {
+			purgeHandler(w, r)
+			return
+		}
+		statusHandler(w, r)
+	}
+}
+
+// sourceStatusHandler reports the crawl status of a Source (GET /v1/sources/{id})
+func sourceStatusHandler(db cdb.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sourceID, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/v1/sources/"), 10, 64)
+		if err != nil {
+			handleErrorAndRespond(w, errors.New("invalid source ID"), nil, "Error in source status: %v", http.StatusBadRequest, http.StatusOK)
+			return
+		}
+
+		status, err := getSourceStatus(db, sourceID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			handleErrorAndRespond(w, errors.New("source not found"), nil, "Error in source status: %v", http.StatusNotFound, http.StatusOK)
+		case err != nil:
+			cmn.DebugMsg(cmn.DbgLvlError, "getting the status of source %d: %v", sourceID, err)
+			handleErrorAndRespond(w, errors.New("failed to get the source status"), nil, "Error in source status: %v", http.StatusInternalServerError, http.StatusOK)
+		default:
+			handleErrorAndRespond(w, nil, status, "", http.StatusInternalServerError, http.StatusOK)
+		}
+	}
+}
+
+// purgeSourceHandler purges the crawled data of a Source (POST
+// /v1/sources/{id}/purge): all of it, or the data older than the older_than
+// number of days
+func purgeSourceHandler(db cdb.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sourceID, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/sources/"), "/purge"), 10, 64)
+		if err != nil {
+			handleErrorAndRespond(w, errors.New("invalid source ID"), nil, "Error in purge source: %v", http.StatusBadRequest, http.StatusOK)
+			return
+		}
+		var olderThan time.Time
+		if days := r.URL.Query().Get("older_than"); days != "" {
+			n, err := strconv.Atoi(days)
+			if err != nil || n < 0 {
+				handleErrorAndRespond(w, errors.New("invalid older_than number of days"), nil, "Error in purge source: %v", http.StatusBadRequest, http.StatusOK)
+				return
+			}
+			olderThan = time.Now().AddDate(0, 0, -n)
+		}
+
+		if _, err := getSourceStatus(db, sourceID); errors.Is(err, sql.ErrNoRows) {
+			handleErrorAndRespond(w, errors.New("source not found"), nil, "Error in purge source: %v", http.StatusNotFound, http.StatusOK)
+			return
+		}
+		purged, err := crowler.PurgeSource(db, sourceID, olderThan)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "purging source %d: %v", sourceID, err)
+			handleErrorAndRespond(w, errors.New("failed to purge the source"), nil, "Error in purge source: %v", http.StatusInternalServerError, http.StatusOK)
+			return
+		}
+		handleErrorAndRespond(w, nil, PurgeResponse{SourceID: sourceID, Pages: purged.Pages, Unlinked: purged.Unlinked, Files: len(purged.Files)}, "", http.StatusInternalServerError, http.StatusOK)
+	}
+}
+
+// addSource adds a Source to crawl (with status new, validating its
+// configuration, if any) and returns its ID.
+// If an equivalent Source already exists, its ID is returned together with
+// errSourceExists.
+func addSource(db cdb.Handler, req SourceRequest) (uint64, error) {
+	if !crowler.IsValidURL(req.URL) {
+		return 0, fmt.Errorf("%w: invalid URL '%s'", errInvalidSource, req.URL)
+	}
+	sourceURL := cdb.NormalizeSourceURL(req.URL)
+
+	restricted := config.Crawler.DefaultRestricted
+	if req.Restricted != nil {
+		if *req.Restricted < 0 || *req.Restricted > 4 {
+			return 0, fmt.Errorf("%w: invalid restricted level %d (must be between 0 and 4)", errInvalidSource, *req.Restricted)
+		}
+		restricted = *req.Restricted
+	}
+
+	// The Sources added without a configuration get the minimal one
+	sourceCfg := cfg.SourceConfig{
+		Version:        "1.0",
+		FormatVersion:  "1.0",
+		SourceName:     sourceURL,
+		CrawlingConfig: cfg.CrawlingConfig{Site: sourceURL},
+	}
+	if len(req.Config) > 0 && string(req.Config) != "null" {
+		sourceCfg = cfg.SourceConfig{}
+		if err := json.Unmarshal(req.Config, &sourceCfg); err != nil {
+			return 0, fmt.Errorf("%w: invalid config: %v", errInvalidSource, err)
+		}
+	}
+
+	// Don't add a duplicate of an equivalent Source (e.g., http vs https or a trailing slash)
+	sourceID, err := cdb.FindEquivalentSource(&db, sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	if sourceID != 0 {
+		return sourceID, errSourceExists
+	}
+
+	source := cdb.Source{URL: sourceURL, Name: sourceCfg.SourceName, Restricted: uint(restricted)} //nolint:gosec // restricted is validated above
+	sourceID, err = cdb.CreateSource(&db, &source, sourceCfg)
+	if errors.Is(err, cdb.ErrInvalidSourceConfig) {
+		return 0, fmt.Errorf("%w: %v", errInvalidSource, err)
+	}
+	return sourceID, err
+}
+
+// getSourceStatus returns the crawl status of a Source
+func getSourceStatus(db cdb.Handler, sourceID uint64) (SourceResponse, error) {
+	status := SourceResponse{SourceID: sourceID}
+	var lastCrawledAt, lastError, lastErrorAt sql.NullString
+	err := db.QueryRow(`SELECT url, status, last_crawled_at, last_error, last_error_at
+                        FROM Sources WHERE source_id = $1`, sourceID).Scan(&status.URL, &status.Status, &lastCrawledAt, &lastError, &lastErrorAt)
+	status.LastCrawledAt = lastCrawledAt.String
+	status.LastError = lastError.String
+	status.LastErrorAt = lastErrorAt.String
+	return status, err
+}
+
+func closeResources(db cdb.Handler, vdiPool *vdi.Pool) {
 	// Close the database connection
 	if db != nil {
 		err := db.Close()
@@ -954,16 +1259,8 @@ func closeResources(db cdb.Handler, sel chan vdi.SeleniumInstance) {
 		}
 	}
 	// Stop the Selenium services
-	if sel != nil {
-		close(sel)
-	}
-	for seleniumInstance := range sel {
-		if seleniumInstance.Service != nil {
-			err := seleniumInstance.Service.Stop()
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "stopping Selenium instance: %v", err)
-			}
-		}
+	if vdiPool != nil {
+		vdiPool.Close()
 	}
 	cmn.DebugMsg(cmn.DbgLvlInfo, "All services stopped.")
 }
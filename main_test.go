@@ -0,0 +1,154 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+func TestPipelinesDispatch(t *testing.T) {
+	pl := newPipelines(2)
+	if pl.available() != 2 || !pl.idle() {
+		t.Fatalf("expected 2 free pipelines, got %d", pl.available())
+	}
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	crawled := make(map[uint64]bool)
+	crawl := func(source cdb.Source, idx uint64) {
+		mu.Lock()
+		if crawled[idx] {
+			t.Errorf("pipeline %d crawls two sources at the same time", idx)
+		}
+		crawled[idx] = true
+		mu.Unlock()
+		if pl.status[idx].SourceID != source.ID || pl.status[idx].PipelineID != idx {
+			t.Errorf("pipeline %d status not initialized: %+v", idx, pl.status[idx])
+		}
+		<-release
+		mu.Lock()
+		crawled[idx] = false
+		mu.Unlock()
+	}
+
+	// Each source takes a pipeline until its crawl returns
+	pl.dispatch([]cdb.Source{{ID: 1, URL: "https://example.com/1"}, {ID: 2, URL: "https://example.com/2"}}, crawl)
+	if pl.available() != 0 || pl.idle() {
+		t.Errorf("expected no free pipelines while crawling, got %d", pl.available())
+	}
+
+	// A source dispatched with no free pipeline waits for one
+	dispatched := make(chan struct{})
+	go func() {
+		pl.dispatch([]cdb.Source{{ID: 3, URL: "https://example.com/3"}}, crawl)
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+		t.Fatalf("source dispatched with no free pipeline")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatalf("source not dispatched after a pipeline was freed")
+	}
+	pl.running.Wait()
+	if pl.available() != 2 || !pl.idle() {
+		t.Errorf("expected 2 free pipelines after the crawls, got %d", pl.available())
+	}
+}
+
+func TestAddSourceHandler(t *testing.T) {
+	conf := cfg.NewConfig()
+	conf.Database.Driver = cfg.DBDriverSQLite
+	conf.Database.DBName = filepath.Join(t.TempDir(), "crowler.db")
+	db, err := cdb.NewHandler(*conf)
+	if err != nil {
+		t.Skipf("SQLite isn't available: %v", err) // Built without cgo
+	}
+	if err := db.Connect(*conf); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer db.Close() //nolint:errcheck // We can't check the error in a defer
+
+	handler := addSourceHandler(db)
+	post := func(body string) (int, SourceResponse) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/v1/sources", strings.NewReader(body)))
+		var resp SourceResponse
+		if w.Code == http.StatusCreated || w.Code == http.StatusConflict {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decoding the response of %s: %v", body, err)
+			}
+		}
+		return w.Code, resp
+	}
+
+	// A Source without configuration gets the minimal one
+	code, added := post(`{"url": "https://example.com", "restricted": 2}`)
+	if code != http.StatusCreated || added.SourceID == 0 {
+		t.Fatalf("POST /v1/sources = %d, %+v, want 201 with the Source ID", code, added)
+	}
+	var restricted int
+	var details string
+	if err := db.QueryRow(`SELECT restricted, config FROM Sources WHERE source_id = $1`, added.SourceID).Scan(&restricted, &details); err != nil {
+		t.Fatalf("reading the added Source: %v", err)
+	}
+	var sourceCfg cfg.SourceConfig
+	if err := json.Unmarshal([]byte(details), &sourceCfg); err != nil || restricted != 2 || sourceCfg.CrawlingConfig.Site != "https://example.com" {
+		t.Errorf("added Source restricted = %d, config = %s (%v)", restricted, details, err)
+	}
+
+	// An equivalent Source isn't added twice
+	if code, existing := post(`{"url": "http://example.com/"}`); code != http.StatusConflict || existing.SourceID != added.SourceID {
+		t.Errorf("POST /v1/sources of an equivalent Source = %d, %+v, want 409 with ID %d", code, existing, added.SourceID)
+	}
+
+	// The configurations are validated
+	valid := `{"url": "https://example.org", "config": {"version": "1.0", "format_version": "1.0", "source_name": "Example", "crawling_config": {"site": "https://example.org"}}}`
+	if code, _ := post(valid); code != http.StatusCreated {
+		t.Errorf("POST /v1/sources with a valid config = %d, want 201", code)
+	}
+	for _, body := range []string{
+		`{"url": "https://example.net", "config": {"version": "1.0", "format_version": "1.0", "crawling_config": {"site": "https://example.net"}}}`,
+		`{"url": "https://example.net", "config": {"version": "1.0", "format_version": "1.0", "source_name": "Example", "crawling_config": {"site": "example.net"}}}`,
+		`{"url": "https://example.net", "config": "not an object"}`,
+		`{"url": "not a URL"}`,
+		`{"url": "https://example.net", "restricted": 5}`,
+	} {
+		if code, _ := post(body); code != http.StatusBadRequest {
+			t.Errorf("POST /v1/sources %s = %d, want 400", body, code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/v1/sources", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /v1/sources = %d, want 405", w.Code)
+	}
+}
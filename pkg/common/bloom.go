@@ -0,0 +1,187 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package common package is used to store common functions and variables
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sync"
+)
+
+const (
+	bloomMagic      = "CRWBLOOM" // Header of the serialized bloom filter
+	bloomHeaderSize = 8 + 8 + 8 + 8
+)
+
+// BloomFilter is a thread-safe bloom filter, used to keep track of
+// very large sets (e.g., visited URLs) in a bounded amount of memory,
+// at the cost of a small false-positive rate.
+type BloomFilter struct {
+	bits  []uint64 // Bit array
+	m     uint64   // Number of bits
+	k     uint64   // Number of hash functions
+	n     uint64   // Number of items added
+	mutex sync.RWMutex
+}
+
+// NewBloomFilter creates a bloom filter sized to hold capacity items
+// with the given false-positive rate (e.g., 0.01 for 1%).
+func NewBloomFilter(capacity uint64, fpRate float64) *BloomFilter {
+	if capacity == 0 {
+		capacity = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	// Optimal number of bits and hash functions
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// hashes returns the two base hashes used to derive the k positions
+// (Kirsch-Mitzenmacher double hashing)
+func (bf *BloomFilter) hashes(item string) (uint64, uint64) {
+	h1 := fnv.New64a()
+	_, _ = h1.Write([]byte(item))
+	h2 := fnv.New64()
+	_, _ = h2.Write([]byte(item))
+	return h1.Sum64(), h2.Sum64() | 1
+}
+
+// Add adds an item to the filter.
+func (bf *BloomFilter) Add(item string) {
+	h1, h2 := bf.hashes(item)
+
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+	for i := uint64(0); i < bf.k; i++ {
+		pos := (h1 + i*h2) % bf.m
+		bf.bits[pos/64] |= 1 << (pos % 64)
+	}
+	bf.n++
+}
+
+// Test returns true if the item may be in the filter, false if it
+// is definitely not in the filter.
+func (bf *BloomFilter) Test(item string) bool {
+	h1, h2 := bf.hashes(item)
+
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+	for i := uint64(0); i < bf.k; i++ {
+		pos := (h1 + i*h2) % bf.m
+		if bf.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of items added to the filter.
+func (bf *BloomFilter) Count() uint64 {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+	return bf.n
+}
+
+// SizeInBytes returns the memory used by the filter's bit array.
+func (bf *BloomFilter) SizeInBytes() uint64 {
+	return uint64(len(bf.bits)) * 8
+}
+
+// MarshalBinary serializes the filter.
+func (bf *BloomFilter) MarshalBinary() ([]byte, error) {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	data := make([]byte, bloomHeaderSize+len(bf.bits)*8)
+	copy(data[0:8], bloomMagic)
+	binary.BigEndian.PutUint64(data[8:16], bf.m)
+	binary.BigEndian.PutUint64(data[16:24], bf.k)
+	binary.BigEndian.PutUint64(data[24:32], bf.n)
+	for i, w := range bf.bits {
+		binary.BigEndian.PutUint64(data[bloomHeaderSize+i*8:], w)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores a filter serialized with MarshalBinary.
+func (bf *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < bloomHeaderSize || string(data[0:8]) != bloomMagic {
+		return errors.New("invalid bloom filter data")
+	}
+	m := binary.BigEndian.Uint64(data[8:16])
+	k := binary.BigEndian.Uint64(data[16:24])
+	n := binary.BigEndian.Uint64(data[24:32])
+	words := (m + 63) / 64
+	if m == 0 || k == 0 || uint64(len(data)-bloomHeaderSize) != words*8 {
+		return errors.New("corrupted bloom filter data")
+	}
+
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[bloomHeaderSize+i*8:])
+	}
+
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+	bf.bits = bits
+	bf.m = m
+	bf.k = k
+	bf.n = n
+	return nil
+}
+
+// SaveToFile writes the filter to the given file.
+func (bf *BloomFilter) SaveToFile(path string) error {
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("saving bloom filter to '%s': %v", path, err)
+	}
+	return nil
+}
+
+// LoadBloomFilterFromFile reads a filter previously saved with SaveToFile.
+func LoadBloomFilterFromFile(path string) (*BloomFilter, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // This path is configured by the service owner
+	if err != nil {
+		return nil, fmt.Errorf("loading bloom filter from '%s': %v", path, err)
+	}
+	bf := &BloomFilter{}
+	err = bf.UnmarshalBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading bloom filter from '%s': %v", path, err)
+	}
+	return bf, nil
+}
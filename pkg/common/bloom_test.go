@@ -0,0 +1,90 @@
+// Package common package is used to store common functions and variables
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	bf := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		bf.Add(fmt.Sprintf("https://www.example.com/page/%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		url := fmt.Sprintf("https://www.example.com/page/%d", i)
+		if !bf.Test(url) {
+			t.Fatalf("Expected %s to be in the filter", url)
+		}
+	}
+	if bf.Count() != 10000 {
+		t.Errorf("Expected count 10000, got %d", bf.Count())
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	const capacity = 100000
+	const fpRate = 0.01
+
+	bf := NewBloomFilter(capacity, fpRate)
+	for i := 0; i < capacity; i++ {
+		bf.Add(fmt.Sprintf("https://www.example.com/page/%d", i))
+	}
+
+	falsePositives := 0
+	const probes = 100000
+	for i := 0; i < probes; i++ {
+		if bf.Test(fmt.Sprintf("https://www.example.org/other/%d", i)) {
+			falsePositives++
+		}
+	}
+	rate := float64(falsePositives) / probes
+	// Allow some slack over the configured rate
+	if rate > fpRate*2 {
+		t.Errorf("False-positive rate too high at capacity: got %f, expected about %f", rate, fpRate)
+	}
+}
+
+func TestBloomFilterMemory(t *testing.T) {
+	// At 1% false-positives a bloom filter needs ~9.6 bits per item
+	bf := NewBloomFilter(1000000, 0.01)
+	size := bf.SizeInBytes()
+	if size < 1000000 || size > 1300000 {
+		t.Errorf("Unexpected filter size for 1M items at 1%%: %d bytes", size)
+	}
+
+	// Memory does not grow with the number of items added
+	for i := 0; i < 100000; i++ {
+		bf.Add(fmt.Sprintf("https://www.example.com/page/%d", i))
+	}
+	if bf.SizeInBytes() != size {
+		t.Errorf("Expected filter size to stay at %d bytes, got %d", size, bf.SizeInBytes())
+	}
+}
+
+func TestBloomFilterSaveAndLoad(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01)
+	bf.Add("https://www.example.com/a")
+	bf.Add("https://www.example.com/b")
+
+	path := filepath.Join(t.TempDir(), "visited.bloom")
+	if err := bf.SaveToFile(path); err != nil {
+		t.Fatalf("SaveToFile returned an error: %v", err)
+	}
+
+	restored, err := LoadBloomFilterFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadBloomFilterFromFile returned an error: %v", err)
+	}
+	if !restored.Test("https://www.example.com/a") || !restored.Test("https://www.example.com/b") {
+		t.Errorf("Expected restored filter to contain the saved items")
+	}
+	if restored.Count() != 2 {
+		t.Errorf("Expected count 2, got %d", restored.Count())
+	}
+
+	if err := restored.UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Errorf("Expected an error for invalid data")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 	"sync"
 )
@@ -356,6 +357,69 @@ func (kv *KeyValueStore) Keys(ctxID string) []string {
 	return keys
 }
 
+// kvVarPattern matches ${name} references to KV store variables.
+var kvVarPattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Interpolate replaces every ${name} reference in the input string with the
+// value stored for the same name in the given context. References to keys
+// that do not exist in the context are left untouched, so they can still be
+// resolved later on (for example as environment variables).
+func (kv *KeyValueStore) Interpolate(input string, ctxID string) string {
+	if kv == nil || !strings.Contains(input, "${") {
+		return input
+	}
+
+	return kvVarPattern.ReplaceAllStringFunc(input, func(ref string) string {
+		name := strings.TrimSuffix(strings.TrimPrefix(ref, "${"), "}")
+		value, err := kv.GetString(name, ctxID)
+		if err != nil {
+			return ref
+		}
+		return value
+	})
+}
+
+// GetString retrieves the value for a given key and context as a string.
+// Slices of strings are joined using "|" as separator.
+func (kv *KeyValueStore) GetString(key string, ctxID string) (string, error) {
+	value, _, err := kv.Get(key, ctxID)
+	if err != nil {
+		return "", err
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []string:
+		return strings.Join(v, "|"), nil
+	default:
+		return fmt.Sprintf("%v", v), nil
+	}
+}
+
+// Snapshot returns a copy of all the key-value pairs (keys without the CID) of a
+// given context, so they can be inspected after the context has been cleaned up.
+func (kv *KeyValueStore) Snapshot(ctxID string) map[string]Entry {
+	snapshot := make(map[string]Entry)
+	if kv == nil {
+		return snapshot
+	}
+
+	kv.mutex.RLock()
+	defer kv.mutex.RUnlock()
+	ctxID = strings.TrimSpace(ctxID)
+	for key, entry := range kv.store {
+		if !strings.HasSuffix(key, ":"+ctxID) {
+			continue
+		}
+		// Copy slices, so the snapshot is not affected by later changes
+		if v, ok := entry.Value.([]string); ok {
+			entry.Value = append([]string(nil), v...)
+		}
+		snapshot[strings.TrimSuffix(key, ":"+ctxID)] = entry
+	}
+	return snapshot
+}
+
 // ToJSON converts the key-value store to a JSON string.
 // It uses json.Marshal to convert the value to the correct JSON format.
 func (kv *KeyValueStore) ToJSON() string {
@@ -707,6 +707,37 @@ func TestKeyValueStore_DeleteNonPersistentByCID(t *testing.T) {
 	}
 }
 
+func TestKeyValueStore_Snapshot(t *testing.T) {
+	kvStore := NewKeyValueStore()
+
+	tags := []string{"a", "b"}
+	_ = kvStore.Set("username", "admin", Properties{Persistent: true, Source: "test", CtxID: "123"})
+	_ = kvStore.Set("tags", tags, Properties{Source: "test", CtxID: "123"})
+	_ = kvStore.Set("session", "xyz", Properties{Source: "test", CtxID: "456"})
+
+	snapshot := kvStore.Snapshot("123")
+	if len(snapshot) != 2 {
+		t.Fatalf("Expected 2 entries in the snapshot, got %v", snapshot)
+	}
+	if snapshot["username"].Value != "admin" || !snapshot["username"].Properties.Persistent {
+		t.Errorf("Unexpected username entry: %+v", snapshot["username"])
+	}
+
+	// The snapshot survives the context clean up and later changes
+	tags[0] = "changed"
+	kvStore.DeleteNonPersistentByCID("123")
+	if !reflect.DeepEqual(snapshot["tags"].Value, []string{"a", "b"}) {
+		t.Errorf("Expected the tags to be [a b], got %v", snapshot["tags"].Value)
+	}
+	if _, exists := kvStore.Snapshot("123")["tags"]; exists {
+		t.Errorf("Expected the non persistent entry to be removed from the store")
+	}
+
+	if len(kvStore.Snapshot("789")) != 0 {
+		t.Errorf("Expected an empty snapshot for an unknown context")
+	}
+}
+
 func TestKeyValueStore_AllKeys(t *testing.T) {
 	kvStore := NewKeyValueStore()
 
@@ -781,3 +812,35 @@ func TestKeyValueStore_ToJSON(t *testing.T) {
 		t.Errorf("Expected JSON %s, got %s", expectedJSON, jsonResult)
 	}
 }
+
+func TestKeyValueStore_Interpolate(t *testing.T) {
+	kvStore := NewKeyValueStore()
+
+	err := kvStore.Set("product_id", "42", Properties{CtxID: "ctx1"})
+	if err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	err = kvStore.Set("tags", []string{"a", "b"}, Properties{CtxID: "ctx1"})
+	if err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		ctxID    string
+		expected string
+	}{
+		{"/product/${product_id}/reviews", "ctx1", "/product/42/reviews"},
+		{"${tags}", "ctx1", "a|b"},
+		{"/product/${product_id}", "ctx2", "/product/${product_id}"},
+		{"${unknown}-${product_id}", "ctx1", "${unknown}-42"},
+		{"no variables here", "ctx1", "no variables here"},
+	}
+
+	for _, tt := range tests {
+		result := kvStore.Interpolate(tt.input, tt.ctxID)
+		if result != tt.expected {
+			t.Errorf("Interpolate(%q, %q) = %q, expected %q", tt.input, tt.ctxID, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package common package is used to store common functions and variables
+package common
+
+import (
+	crand "crypto/rand"
+	"math/big"
+	"math/rand"
+	"sync"
+)
+
+// lockedSource is a random numbers source safe for concurrent use
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// NewRand returns a random numbers generator (safe for concurrent use) seeded
+// with seed, so the same seed reproduces the same random choices. If seed is
+// 0 it returns nil: the random choices are then made with crypto/rand (and
+// can't be reproduced).
+func NewRand(seed int64) *rand.Rand {
+	if seed == 0 {
+		return nil
+	}
+	//nolint:gosec // Reproducible choices need a seedable (non cryptographic) generator
+	return rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+}
+
+// RandomIndex returns a random index in [0, n) picked by rng (or by
+// crypto/rand if rng is nil). It returns 0 if n isn't positive.
+func RandomIndex(rng *rand.Rand, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if rng != nil {
+		return rng.Intn(n)
+	}
+	idx, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(idx.Int64())
+}
@@ -18,11 +18,9 @@ package common
 import (
 	"encoding/json"
 	"fmt"
-	"math/big"
+	"math/rand"
 	"os"
 	"strings"
-
-	"crypto/rand"
 )
 
 // UserAgent represents a user agent with its string and percentage.
@@ -120,23 +118,15 @@ func (uaDB *UserAgentsDB) IsEmpty() bool {
 	return len(uaDB.UserAgentsGroups) == 0
 }
 
-// GetAnyUserAgent returns a random user agent string from the database.
-func (uaDB *UserAgentsDB) GetAnyUserAgent() string {
+// GetAnyUserAgent returns a random user agent string from the database
+// (picked by rng, see NewRand).
+func (uaDB *UserAgentsDB) GetAnyUserAgent(rng *rand.Rand) string {
 	if uaDB.IsEmpty() {
 		return ""
 	}
 
-	// Generate a random index between 0 and the number of user agent groups
-	idxRaw, err := rand.Int(rand.Reader, big.NewInt(int64(len(uaDB.UserAgentsGroups))))
-	if err != nil {
-		return ""
-	}
-
-	// convert idxRaw to int
-	idx := int(idxRaw.Int64())
-
 	// Pick a random user agent group
-	group := uaDB.UserAgentsGroups[idx]
+	group := uaDB.UserAgentsGroups[RandomIndex(rng, len(uaDB.UserAgentsGroups))]
 
 	// Pick a random user agent string
 	if len(group.UserAgents) == 0 {
@@ -144,19 +134,12 @@ func (uaDB *UserAgentsDB) GetAnyUserAgent() string {
 	}
 
 	// Pick a random user agent string from the group UA slice
-	idxRaw, err = rand.Int(rand.Reader, big.NewInt(int64(len(group.UserAgents))))
-	if err != nil {
-		return ""
-	}
-
-	// convert idxRaw to int
-	idx = int(idxRaw.Int64())
-
-	return group.UserAgents[idx].UA
+	return group.UserAgents[RandomIndex(rng, len(group.UserAgents))].UA
 }
 
-// GetAgentByTypeAndOS returns a random user agent string from the database based on the type and OS.
-func (uaDB *UserAgentsDB) GetAgentByTypeAndOS(uaType, os string) string {
+// GetAgentByTypeAndOS returns a random user agent string from the database based on the type and OS
+// (picked by rng, see NewRand).
+func (uaDB *UserAgentsDB) GetAgentByTypeAndOS(rng *rand.Rand, uaType, os string) string {
 	if uaDB.IsEmpty() {
 		return ""
 	}
@@ -176,19 +159,12 @@ func (uaDB *UserAgentsDB) GetAgentByTypeAndOS(uaType, os string) string {
 	}
 
 	// Pick a random user agent string from the group UA slice
-	idxRaw, err := rand.Int(rand.Reader, big.NewInt(int64(len(group.UserAgents))))
-	if err != nil {
-		return ""
-	}
-
-	// convert idxRaw to int
-	idx := int(idxRaw.Int64())
-
-	return group.UserAgents[idx].UA
+	return group.UserAgents[RandomIndex(rng, len(group.UserAgents))].UA
 }
 
-// GetAgentByTypeAndOSAndBRG returns a random user agent string from the database based on the type, OS, and BRG.
-func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRG(uaType, os, brg string) string {
+// GetAgentByTypeAndOSAndBRG returns a random user agent string from the database based on the type, OS, and BRG
+// (picked by rng, see NewRand).
+func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRG(rng *rand.Rand, uaType, os, brg string) string {
 	if uaDB.IsEmpty() {
 		return ""
 	}
@@ -196,15 +172,8 @@ func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRG(uaType, os, brg string) stri
 	// Check if brg is set to "random"
 	brg_selected := ""
 	if brg == "random" || strings.TrimSpace(brg) == "" {
-		// Generate a random index between 0 and the number of user agent groups
-		idxRaw, err := rand.Int(rand.Reader, big.NewInt(int64(len(uaDB.UserAgentsGroups))))
-		if err != nil {
-			brg_selected = "linux"
-		} else {
-			// convert idxRaw to int
-			idx := int(idxRaw.Int64())
-			brg_selected = uaDB.UserAgentsGroups[idx].BRG
-		}
+		// Pick a random user agent group browser
+		brg_selected = uaDB.UserAgentsGroups[RandomIndex(rng, len(uaDB.UserAgentsGroups))].BRG
 	} else {
 		brg_selected = strings.ToLower(strings.TrimSpace(brg))
 	}
@@ -224,19 +193,12 @@ func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRG(uaType, os, brg string) stri
 	}
 
 	// Pick a random user agent string from the group UA slice
-	idxRaw, err := rand.Int(rand.Reader, big.NewInt(int64(len(group.UserAgents))))
-	if err != nil {
-		return ""
-	}
-
-	// convert idxRaw to int
-	idx := int(idxRaw.Int64())
-
-	return group.UserAgents[idx].UA
+	return group.UserAgents[RandomIndex(rng, len(group.UserAgents))].UA
 }
 
-// GetAgentByTypeAndOSAndBRGAndPCT returns a random user agent string from the database based on the type, OS, BRG, and PCT.
-func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRGAndPCT(uaType, os, brg string, pct float64) string {
+// GetAgentByTypeAndOSAndBRGAndPCT returns a random user agent string from the database based on the type, OS, BRG, and PCT
+// (picked by rng, see NewRand).
+func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRGAndPCT(rng *rand.Rand, uaType, os, brg string, pct float64) string {
 	if uaDB.IsEmpty() {
 		return ""
 	}
@@ -268,15 +230,7 @@ func (uaDB *UserAgentsDB) GetAgentByTypeAndOSAndBRGAndPCT(uaType, os, brg string
 		return ""
 	}
 
-	idxRaw, err := rand.Int(rand.Reader, big.NewInt(int64(len(uaList))))
-	if err != nil {
-		return ""
-	}
-
-	// convert idxRaw to int
-	idx := int(idxRaw.Int64())
-
-	return uaList[idx].UA
+	return uaList[RandomIndex(rng, len(uaList))].UA
 }
 
 // loadUserAgentsDB loads the user agents database from a JSON file.
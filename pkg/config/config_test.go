@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
@@ -567,6 +568,69 @@ func TestValidateCrawler(t *testing.T) {
 	if config.Crawler.Maintenance != 60 {
 		t.Errorf("Expected Maintenance to be 60, got %v", config.Crawler.Maintenance)
 	}
+
+	// Check if a valid DefaultRestricted level is kept
+	config.Crawler.DefaultRestricted = 3
+	config.validateCrawler()
+	if config.Crawler.DefaultRestricted != 3 {
+		t.Errorf("Expected DefaultRestricted to be 3, got %v", config.Crawler.DefaultRestricted)
+	}
+
+	// Check if out of range DefaultRestricted levels are rejected
+	for _, level := range []int{-1, 5} {
+		config.Crawler.DefaultRestricted = level
+		config.validateCrawler()
+		if config.Crawler.DefaultRestricted != 0 {
+			t.Errorf("Expected DefaultRestricted %d to be rejected, got %v", level, config.Crawler.DefaultRestricted)
+		}
+	}
+
+	// Check if a stop condition with an invalid expression is disabled
+	config.Crawler.StopCondition = StopCondition{Key: " price ", Matches: `^\d+$`}
+	config.validateCrawler()
+	if config.Crawler.StopCondition.Key != "price" {
+		t.Errorf("Expected the stop condition key to be 'price', got %q", config.Crawler.StopCondition.Key)
+	}
+	config.Crawler.StopCondition.Matches = "("
+	config.validateCrawler()
+	if config.Crawler.StopCondition != (StopCondition{}) {
+		t.Errorf("Expected the invalid stop condition to be disabled, got %+v", config.Crawler.StopCondition)
+	}
+
+	// Check if screenshot path templates escaping the storage path are rejected
+	config.Crawler.ScreenshotPathTemplate = " {sourceID}/{yyyy}/{urlhash}.{ext} "
+	config.validateCrawler()
+	if config.Crawler.ScreenshotPathTemplate != "{sourceID}/{yyyy}/{urlhash}.{ext}" {
+		t.Errorf("Expected the screenshot path template to be kept, got %q", config.Crawler.ScreenshotPathTemplate)
+	}
+	for _, tmpl := range []string{"", "/tmp/{name}.{ext}", "../{name}.{ext}", "{sourceID}/../../{name}.{ext}"} {
+		config.Crawler.ScreenshotPathTemplate = tmpl
+		config.validateCrawler()
+		if config.Crawler.ScreenshotPathTemplate != DefaultScreenshotPathTemplate {
+			t.Errorf("Expected screenshot path template %q to be replaced, got %q", tmpl, config.Crawler.ScreenshotPathTemplate)
+		}
+	}
+
+	// Check that negative source intake settings are disabled
+	config.Crawler.SourceIntake = SourceIntake{MaxPerCycle: -1, RampUp: -5}
+	config.validateCrawler()
+	if config.Crawler.SourceIntake != (SourceIntake{}) {
+		t.Errorf("Expected the negative source intake settings to be disabled, got %+v", config.Crawler.SourceIntake)
+	}
+
+	// Check that duplicate titles need at least 2 pages to be flagged
+	config.Crawler.DuplicateTitlesMin = 1
+	config.validateCrawler()
+	if config.Crawler.DuplicateTitlesMin != DefaultDuplicateTitlesMin {
+		t.Errorf("Expected duplicate_titles_min %d, got %d", DefaultDuplicateTitlesMin, config.Crawler.DuplicateTitlesMin)
+	}
+
+	// Check that certificate errors can't be ignored globally
+	config.Crawler.IgnoreCertErrors = true
+	config.validateCrawler()
+	if config.Crawler.IgnoreCertErrors {
+		t.Errorf("Expected ignore_cert_errors to be disabled in the global configuration")
+	}
 }
 
 // Test validateDatabase
@@ -1082,6 +1146,13 @@ func TestValidateHTTPHeaders(t *testing.T) {
 	if config.HTTPHeaders.Timeout != 60 {
 		t.Errorf("Expected HTTPHeaders.Timeout to be 60, got %v", config.HTTPHeaders.Timeout)
 	}
+
+	// The methods are uppercased, without the unsupported and duplicate ones
+	config.HTTPHeaders.Methods = []string{" head", "DELETE", "get", "HEAD"}
+	config.validateHTTPHeaders()
+	if !reflect.DeepEqual(config.HTTPHeaders.Methods, []string{"HEAD", "GET"}) {
+		t.Errorf("Expected HTTPHeaders.Methods to be [HEAD GET], got %v", config.HTTPHeaders.Methods)
+	}
 }
 
 // Test validateOS
@@ -1206,7 +1277,7 @@ func TestConfigString(t *testing.T) {
 	}
 
 	// Define the expected string representation of the config
-	expected := "Config{Remote: {https://example.com /api 8080 us-west-1 mytoken  0  }, Database: {  0 testuser testpassword  0 0   0 0}, Crawler: {0     0 0 false false 0 0 0 0 0   0 0 0  false     false false false false false false false false false false false false false false false 0 false false { 0 0     0 0 0}}, API: { 0 0 false false     false 0 0 0 false}, Selenium: [{    chrome  4444  false false     {0 0     0 0 0}}], RulesetsSchemaPath: path/to/schema, Rulesets: [], ImageStorageAPI: {  0    0  }, FileStorageAPI: {  0    0  }, HTTPHeaders: {false 0 false {false false false false false false false false false false false false false false false false} []}, NetworkInfo: {{false 0 } {false 0 } {false 0 } {false 0 { 0} false false false false false false  false false [] [] []    0 0 0   false 0  false  false 0 [] []} {false    0 } {  }}, OS: linux, DebugLevel: 1}"
+	expected := "Config{Remote: {https://example.com /api 8080 us-west-1 mytoken  0  }, Database: {   0 testuser testpassword  0 0    0 0 0}, Crawler: {0  0   []   0 0 0 false false 0   0  0 false 0 0 0 0 0 [] [] [] [] [] [] 0 0   0   0 0 0 0 0 0 0  false false     0 0 false false false false false false false false false false false false false false false false false 0 false 0 false false false  0 false 0 false 0 false false false false false false 0    { 0 0     0 0 0} { 0 0 } {  } false 0 {0 0} [] [] [] { false} false false false false 0 0 0 { } [] [] 0 map[] {false 0 []} {false false} {  map[] 0} { map[] [] 0}}, API: { 0 0 false false     false 0 0 0 false false 0 0 0 0}, Selenium: [{    chrome  4444  false 0 false   {  0  }   {0 0     0 0 0}}], RulesetsSchemaPath: path/to/schema, Rulesets: [], ImageStorageAPI: {  0    0  }, FileStorageAPI: {  0    0  }, HTTPHeaders: {false 0 false [] {false false false false false false false false false false false false false false false false} []}, NetworkInfo: {{false 0 } {false 0 } {false 0 } {false 0 { 0} false false false false false false  false false [] [] []    0 0 0 0 0 0  0   false 0  false  false 0 [] []} {false    0 } {  }}, OS: linux, DebugLevel: 1}"
 
 	// Call the String method on the config
 	result := config.String()
@@ -1865,3 +1936,168 @@ func TestGeoLookupConfigIsEmpty(t *testing.T) {
 		t.Errorf("Expected IsEmpty to return true for an empty GeoLookupConfig")
 	}
 }
+
+func TestPolitenessPresets(t *testing.T) {
+	tests := []struct {
+		name         string
+		yaml         string
+		wantWorkers  int
+		wantDelay    string
+		wantInterval string
+	}{
+		{"gentle", "crawler:\n  politeness: gentle\n", 1, "random(5, 10)", "3"},
+		{"normal", "crawler:\n  politeness: normal\n", 3, "random(1, 5)", "2"},
+		{"aggressive", "crawler:\n  politeness: Aggressive\n", 10, "0", "1"},
+		{"explicit values override the preset", "crawler:\n  politeness: gentle\n  workers: 4\n  delay: \"2\"\n", 4, "2", "3"},
+		{"unknown preset", "crawler:\n  politeness: reckless\n  workers: 2\n", 2, "random(1, 5)", "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+			got := config.Crawler
+			if got.Workers != tt.wantWorkers || got.Delay != tt.wantDelay || got.Interval != tt.wantInterval {
+				t.Errorf("workers, delay, interval = %d, %q, %q, want %d, %q, %q",
+					got.Workers, got.Delay, got.Interval, tt.wantWorkers, tt.wantDelay, tt.wantInterval)
+			}
+		})
+	}
+
+	// Per Source, the preset applies on top of the global configuration
+	config, err := CombineConfig(*NewConfig(), []byte(`{"custom":{"crawler":{"politeness":"aggressive","delay":"1"}}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	if config.Crawler.Workers != 10 || config.Crawler.Delay != "1" || config.Crawler.Interval != "1" {
+		t.Errorf("Source workers, delay, interval = %d, %q, %q, want 10, \"1\", \"1\"",
+			config.Crawler.Workers, config.Crawler.Delay, config.Crawler.Interval)
+	}
+}
+
+func TestValidateDatabaseTLS(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("-----BEGIN CERTIFICATE-----\n"), 0o600); err != nil {
+		t.Fatalf("writing the CA certificate: %v", err)
+	}
+	tests := []struct {
+		sslmode     string
+		sslRootCert string
+		wantErr     bool
+	}{
+		{"disable", "", false},
+		{"require", "", false},
+		{"verify-full", "", true},
+		{"verify-ca", "", true},
+		{"verify-full", filepath.Join(t.TempDir(), "missing.pem"), true},
+		{"verify-full", caFile, false},
+	}
+	for _, tt := range tests {
+		c := &Config{Database: Database{SSLMode: tt.sslmode, SSLRootCert: tt.sslRootCert}}
+		if err := c.validateDatabaseTLS(); (err != nil) != tt.wantErr {
+			t.Errorf("validateDatabaseTLS(%s, %q) error = %v, want error %t", tt.sslmode, tt.sslRootCert, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCombineKeywordRules(t *testing.T) {
+	global := *NewConfig()
+	global.Crawler.KeywordRules = []KeywordRule{{Name: "isbn", Pattern: `ISBN[- ]?(\d{13})`}}
+	config, err := CombineConfig(global, []byte(`{"custom":{"crawler":{"keyword_rules":[
+		{"name":"sku","pattern":"\\b[A-Z]{3}-\\d{4}\\b"},{"pattern":" [0-9]+ "},{"name":"broken","pattern":"("}]}}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	want := []KeywordRule{
+		{Name: "isbn", Pattern: `ISBN[- ]?(\d{13})`},
+		{Name: "sku", Pattern: `\b[A-Z]{3}-\d{4}\b`},
+		{Name: "custom", Pattern: `[0-9]+`},
+	}
+	if !reflect.DeepEqual(config.Crawler.KeywordRules, want) {
+		t.Errorf("KeywordRules = %v, want %v", config.Crawler.KeywordRules, want)
+	}
+	// The global rules aren't changed
+	if len(global.Crawler.KeywordRules) != 1 {
+		t.Errorf("Expected the global keyword rules to be unchanged, got %v", global.Crawler.KeywordRules)
+	}
+}
+
+func TestCombineStopWords(t *testing.T) {
+	global := *NewConfig()
+	global.Crawler.StopWords = StopWordLists{"en": {"acme"}}
+	config, err := CombineConfig(global, []byte(`{"custom":{"crawler":{"keyword_min_length":4,"stop_words":{
+		"en-GB":[" Widget "],"it":["prodotto",""],"*":["SKU"]}}}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	want := StopWordLists{"en": {"acme", "widget"}, "it": {"prodotto"}, "*": {"sku"}}
+	if !reflect.DeepEqual(config.Crawler.StopWords, want) {
+		t.Errorf("StopWords = %v, want %v", config.Crawler.StopWords, want)
+	}
+	if config.Crawler.KeywordMinLength != 4 {
+		t.Errorf("KeywordMinLength = %d, want 4", config.Crawler.KeywordMinLength)
+	}
+	// The global stop words aren't changed
+	if !reflect.DeepEqual(global.Crawler.StopWords, StopWordLists{"en": {"acme"}}) {
+		t.Errorf("Expected the global stop words to be unchanged, got %v", global.Crawler.StopWords)
+	}
+}
+
+func TestCombineAPIPagination(t *testing.T) {
+	global := *NewConfig()
+	global.Crawler.APIPagination.Endpoints = []APIEndpoint{{URLPattern: "https://api.example.com/*"}}
+	config, err := CombineConfig(global, []byte(`{"custom":{"crawler":{"api_pagination":{"enabled":true,"max_pages":5,"endpoints":[
+		{"url_pattern":" https://shop.example.com/api/products* ","mode":"Cursor","param":"after","records_path":"data.items"},
+		{"url_pattern":"https://shop.example.com/*","mode":"scroll"},{"mode":"page"}]}}}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	want := APIPagination{Enabled: true, MaxPages: 5, Endpoints: []APIEndpoint{
+		{URLPattern: "https://api.example.com/*"},
+		{URLPattern: "https://shop.example.com/api/products*", Mode: APIPaginationCursor, Param: "after", RecordsPath: "data.items"},
+	}}
+	if !reflect.DeepEqual(config.Crawler.APIPagination, want) {
+		t.Errorf("APIPagination = %+v, want %+v", config.Crawler.APIPagination, want)
+	}
+	// The global endpoint rules aren't changed
+	if len(global.Crawler.APIPagination.Endpoints) != 1 {
+		t.Errorf("Expected the global endpoint rules to be unchanged, got %v", global.Crawler.APIPagination.Endpoints)
+	}
+}
+
+func TestCombineFacets(t *testing.T) {
+	config, err := CombineConfig(*NewConfig(), []byte(`{"custom":{"crawler":{"facets":{"url":" /catalog ","max_urls":50,
+		"params":{"color":["red","blue"],"size":["s",42]},"combinations":[{"color":"red"},"invalid"]}}}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	want := Facets{
+		URL:          "/catalog",
+		Params:       map[string][]string{"color": {"red", "blue"}, "size": {"s"}},
+		Combinations: []map[string]string{{"color": "red"}},
+		MaxURLs:      50,
+	}
+	if !reflect.DeepEqual(config.Crawler.Facets, want) {
+		t.Errorf("Facets = %+v, want %+v", config.Crawler.Facets, want)
+	}
+}
+
+func TestCombineCrawlScope(t *testing.T) {
+	config, err := CombineConfig(*NewConfig(), []byte(`{"custom":{"crawler":{"include_patterns":["/blog/"],"exclude_patterns":["\\.pdf$"]}}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Crawler.IncludePatterns, []string{"/blog/"}) || !reflect.DeepEqual(config.Crawler.ExcludePatterns, []string{`\.pdf$`}) {
+		t.Errorf("include, exclude = %v, %v, want [/blog/], [\\.pdf$]", config.Crawler.IncludePatterns, config.Crawler.ExcludePatterns)
+	}
+
+	// The crawling configuration patterns win over the custom crawler ones
+	config, err = CombineConfig(config, []byte(`{"crawling_config":{"site":"https://example.com","include_patterns":["/products/.*"]}}`))
+	if err != nil {
+		t.Fatalf("CombineConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(config.Crawler.IncludePatterns, []string{"/products/.*"}) || len(config.Crawler.ExcludePatterns) != 1 {
+		t.Errorf("include, exclude = %v, %v, want [/products/.*], [\\.pdf$]", config.Crawler.IncludePatterns, config.Crawler.ExcludePatterns)
+	}
+}
@@ -32,66 +32,272 @@ type FileStorageAPI struct {
 
 // Database represents the database configuration
 type Database struct {
-	Type         string `json:"type" yaml:"type"`                     // Type of database (e.g., "postgres", "mysql", "sqlite")
-	Host         string `json:"host" yaml:"host"`                     // Hostname of the database server
-	Port         int    `json:"port" yaml:"port"`                     // Port number of the database server
-	User         string `json:"user" yaml:"user"`                     // Username for database authentication
-	Password     string `json:"password" yaml:"password"`             // Password for database authentication
-	DBName       string `json:"dbname" yaml:"dbname"`                 // Name of the database
-	RetryTime    int    `json:"retry_time" yaml:"retry_time"`         // Time to wait before retrying to connect to the database (in seconds)
-	PingTime     int    `json:"ping_time" yaml:"ping_time"`           // Time to wait before retrying to ping the database (in seconds)
-	SSLMode      string `json:"sslmode" yaml:"sslmode"`               // SSL mode for database connection (e.g., "disable")
-	OptimizeFor  string `json:"optimize_for" yaml:"optimize_for"`     // Optimize for the database connection (e.g., "read", "write")
-	MaxConns     int    `json:"max_conns" yaml:"max_conns"`           // Maximum number of connections to the database
-	MaxIdleConns int    `json:"max_idle_conns" yaml:"max_idle_conns"` // Maximum number of idle connections to the database
+	Driver          string `json:"driver" yaml:"driver"`                       // Database backend: postgres (default), mysql or sqlite3 (it defaults to the type)
+	Type            string `json:"type" yaml:"type"`                           // Type of database (e.g., "postgres", "mysql", "sqlite")
+	Host            string `json:"host" yaml:"host"`                           // Hostname of the database server
+	Port            int    `json:"port" yaml:"port"`                           // Port number of the database server
+	User            string `json:"user" yaml:"user"`                           // Username for database authentication
+	Password        string `json:"password" yaml:"password"`                   // Password for database authentication
+	DBName          string `json:"dbname" yaml:"dbname"`                       // Name of the database
+	RetryTime       int    `json:"retry_time" yaml:"retry_time"`               // Time to wait before retrying to connect to the database (in seconds)
+	PingTime        int    `json:"ping_time" yaml:"ping_time"`                 // Time to wait before retrying to ping the database (in seconds)
+	SSLMode         string `json:"sslmode" yaml:"sslmode"`                     // SSL mode for database connection (e.g., "disable")
+	SSLRootCert     string `json:"sslrootcert" yaml:"sslrootcert"`             // Path of the CA certificate(s) the database server certificate is verified against (verify-ca and verify-full SSL modes)
+	OptimizeFor     string `json:"optimize_for" yaml:"optimize_for"`           // Optimize for the database connection (e.g., "read", "write")
+	MaxConns        int    `json:"max_conns" yaml:"max_conns"`                 // Maximum number of connections to the database
+	MaxIdleConns    int    `json:"max_idle_conns" yaml:"max_idle_conns"`       // Maximum number of idle connections to the database
+	ConnMaxLifetime int    `json:"conn_max_lifetime" yaml:"conn_max_lifetime"` // Maximum amount of time a connection to the database may be reused (in seconds)
 }
 
 // Crawler represents the crawler configuration
 type Crawler struct {
-	Workers               int           `json:"workers" yaml:"workers"`                                 // Number of crawler workers
-	VDIName               string        `json:"vdi_name" yaml:"vdi_name"`                               // Name of the VDI to use (this is useful when using custom configurations per each source)
-	Platform              string        `json:"platform" yaml:"platform"`                               // Platform to use (e.g., "desktop", "mobile")
-	BrowserPlatform       string        `json:"browser_platform" yaml:"browser_platform"`               // Browser platform to use (e.g., "desktop", "mobile")
-	Interval              string        `json:"interval" yaml:"interval"`                               // Interval between crawler requests (in seconds)
-	Timeout               int           `json:"timeout" yaml:"timeout"`                                 // Timeout for crawler requests (in seconds)
-	Maintenance           int           `json:"maintenance" yaml:"maintenance"`                         // Interval between crawler maintenance tasks (in seconds)
-	SourceScreenshot      bool          `json:"source_screenshot" yaml:"source_screenshot"`             // Whether to take a screenshot of the source page or not
-	FullSiteScreenshot    bool          `json:"full_site_screenshot" yaml:"full_site_screenshot"`       // Whether to take a screenshot of the full site or not
-	ScreenshotMaxHeight   int           `json:"screenshot_max_height" yaml:"screenshot_max_height"`     // Maximum height of the screenshot
-	ScreenshotSectionWait int           `json:"screenshot_section_wait" yaml:"screenshot_section_wait"` // Time to wait before taking a screenshot of a section in seconds
-	MaxDepth              int           `json:"max_depth" yaml:"max_depth"`                             // Maximum depth to crawl
-	MaxLinks              int           `json:"max_links" yaml:"max_links"`                             // Maximum number of links to crawl per Source
-	MaxSources            int           `json:"max_sources" yaml:"max_sources"`                         // Maximum number of sources to crawl
-	Delay                 string        `json:"delay" yaml:"delay"`                                     // Delay between requests (in seconds)
-	BrowsingMode          string        `json:"browsing_mode" yaml:"browsing_mode"`                     // Browsing type (e.g., "recursive", "human", "fuzzing")
-	MaxRetries            int           `json:"max_retries" yaml:"max_retries"`                         // Maximum number of retries
-	MaxRedirects          int           `json:"max_redirects" yaml:"max_redirects"`                     // Maximum number of redirects
-	MaxRequests           int           `json:"max_requests" yaml:"max_requests"`                       // Maximum number of requests
-	ResetCookiesPolicy    string        `json:"reset_cookies_policy" yaml:"reset_cookies_policy"`       // Cookies policy (e.g., "none", "on-request", "on-start", "when-done", "always")
-	NoThirdPartyCookies   bool          `json:"no_third_party_cookies" yaml:"no_third_party_cookies"`   // Whether to accept third-party cookies or not
-	CrawlingInterval      string        `json:"crawling_interval" yaml:"crawling_interval"`             // Time to wait before re-crawling a source
-	CrawlingIfError       string        `json:"crawling_if_error" yaml:"crawling_if_error"`             // Whether to re-crawl a source if an error occurs
-	CrawlingIfOk          string        `json:"crawling_if_ok" yaml:"crawling_if_ok"`                   // Whether to re-crawl a source if the crawling is successful
-	ProcessingTimeout     string        `json:"processing_timeout" yaml:"processing_timeout"`           // Timeout for processing the source
-	RequestImages         bool          `json:"request_images" yaml:"request_images"`                   // Whether to request the images or not
-	RequestCSS            bool          `json:"request_css" yaml:"request_css"`                         // Whether to request the CSS or not
-	RequestScripts        bool          `json:"request_scripts" yaml:"request_scripts"`                 // Whether to request the scripts or not
-	RequestPlugins        bool          `json:"request_plugins" yaml:"request_plugins"`                 // Whether to request the plugins or not
-	RequestFrames         bool          `json:"request_frames" yaml:"request_frames"`                   // Whether to request the frames or not
-	CollectHTML           bool          `json:"collect_html" yaml:"collect_html"`                       // Whether to collect the HTML content or not
-	CollectImages         bool          `json:"collect_images" yaml:"collect_images"`                   // Whether to collect the images or not
-	CollectFiles          bool          `json:"collect_files" yaml:"collect_files"`                     // Whether to collect the files or not
-	CollectContent        bool          `json:"collect_content" yaml:"collect_content"`                 // Whether to collect the content or not
-	CollectKeywords       bool          `json:"collect_keywords" yaml:"collect_keywords"`               // Whether to collect the keywords or not
-	CollectMetaTags       bool          `json:"collect_metatags" yaml:"collect_metatags"`               // Whether to collect the metatags or not
-	CollectPerfMetrics    bool          `json:"collect_performance" yaml:"collect_performance"`         // Whether to collect the performance metrics or not
-	CollectPageEvents     bool          `json:"collect_events" yaml:"collect_events"`                   // Whether to collect the page events or not
-	CollectXHR            bool          `json:"collect_xhr" yaml:"collect_xhr"`                         // Whether to collect the XHR requests or not
-	CollectLinks          bool          `json:"collect_links" yaml:"collect_links"`                     // Whether to collect the links or not
-	ReportInterval        int           `json:"report_time" yaml:"report_time"`                         // Time to wait before sending the report (in minutes)
-	CheckForRobots        bool          `json:"check_for_robots" yaml:"check_for_robots"`               // Whether to check for robots.txt or not
-	CreateEventWhenDone   bool          `json:"create_event_when_done" yaml:"create_event_when_done"`   // Whether to create an event when the crawling is done or not
-	Control               ControlConfig `json:"control" yaml:"control"`                                 // Control/COnsole internal API
+	Workers                  int           `json:"workers" yaml:"workers"`                                       // Number of crawler workers
+	VDIName                  string        `json:"vdi_name" yaml:"vdi_name"`                                     // Name of the VDI to use (this is useful when using custom configurations per each source)
+	VDIHealthCheck           int           `json:"vdi_health_check" yaml:"vdi_health_check"`                     // Interval (in seconds) of the health checks of the idle VDIs of the pool (0 disables them)
+	Platform                 string        `json:"platform" yaml:"platform"`                                     // Platform to use (e.g., "desktop", "mobile")
+	BrowserPlatform          string        `json:"browser_platform" yaml:"browser_platform"`                     // Browser platform to use (e.g., "desktop", "mobile")
+	UserAgents               []string      `json:"user_agents" yaml:"user_agents"`                               // Pool of User-Agents of the VDI sessions (the User-Agents database is used if empty)
+	UserAgentMode            string        `json:"user_agent_mode" yaml:"user_agent_mode"`                       // How the User-Agent of each session is picked from the pool: fixed (default), random or round-robin
+	Interval                 string        `json:"interval" yaml:"interval"`                                     // Interval between crawler requests (in seconds)
+	Timeout                  int           `json:"timeout" yaml:"timeout"`                                       // Timeout for crawler requests (in seconds)
+	Maintenance              int           `json:"maintenance" yaml:"maintenance"`                               // Interval between crawler maintenance tasks (in seconds)
+	DataRetention            int           `json:"data_retention" yaml:"data_retention"`                         // Number of days the crawled data of a source is kept (0 keeps it forever)
+	SourceScreenshot         bool          `json:"source_screenshot" yaml:"source_screenshot"`                   // Whether to take a screenshot of the source page or not
+	FullSiteScreenshot       bool          `json:"full_site_screenshot" yaml:"full_site_screenshot"`             // Whether to take a screenshot of the full site or not
+	ScreenshotMaxHeight      int           `json:"screenshot_max_height" yaml:"screenshot_max_height"`           // Maximum height of the screenshots (0 means no limit)
+	ScreenshotMode           string        `json:"screenshot_mode" yaml:"screenshot_mode"`                       // Screenshot mode: fullpage (default) or viewport (above-the-fold only)
+	ScreenshotFormat         string        `json:"screenshot_format" yaml:"screenshot_format"`                   // Image format of the screenshots: png (default), jpeg or webp
+	ScreenshotQuality        int           `json:"screenshot_quality" yaml:"screenshot_quality"`                 // Quality (1-100) of the screenshots in a lossy format (jpeg and webp)
+	ScreenshotPathTemplate   string        `json:"screenshot_path_template" yaml:"screenshot_path_template"`     // Template of the screenshots storage path (e.g., "{sourceID}/{yyyy}/{mm}/{dd}/{urlhash}.{ext}")
+	ScreenshotSectionWait    int           `json:"screenshot_section_wait" yaml:"screenshot_section_wait"`       // Maximum time to wait for fonts and images to load before taking a screenshot of a section in seconds
+	ScreenshotOnChange       bool          `json:"screenshot_on_change" yaml:"screenshot_on_change"`             // Whether to take the screenshots only of the pages whose content changed since they were last indexed (the unchanged pages keep their previous screenshot)
+	MaxConcurrentScreenshots int           `json:"max_concurrent_screenshots" yaml:"max_concurrent_screenshots"` // Maximum number of screenshots taken at the same time (0 means no limit)
+	MaxConcurrentIndexing    int           `json:"max_concurrent_indexing" yaml:"max_concurrent_indexing"`       // Maximum number of pages indexed at the same time (0 means no limit)
+	MaxDepth                 int           `json:"max_depth" yaml:"max_depth"`                                   // Maximum depth to crawl
+	DefaultRestricted        int           `json:"default_restricted" yaml:"default_restricted"`                 // Restriction level (0-4) of the Sources that don't have one
+	MaxLinks                 int           `json:"max_links" yaml:"max_links"`                                   // Maximum number of links to crawl per Source
+	IncludePatterns          []string      `json:"include_patterns" yaml:"include_patterns"`                     // Regexes limiting the crawl to the matching URLs (all the URLs if empty)
+	ExcludePatterns          []string      `json:"exclude_patterns" yaml:"exclude_patterns"`                     // Regexes of the URLs not to crawl (they win over the include patterns)
+	FollowAnchorPatterns     []string      `json:"follow_anchor_patterns" yaml:"follow_anchor_patterns"`         // Regexes limiting the links followed to the ones with a matching anchor text (all if empty)
+	SkipAnchorPatterns       []string      `json:"skip_anchor_patterns" yaml:"skip_anchor_patterns"`             // Regexes of the anchor text of the links not to follow (they win over the follow patterns)
+	FollowExtensions         []string      `json:"follow_extensions" yaml:"follow_extensions"`                   // File extensions of the links followed (all but the skipped ones if empty)
+	SkipExtensions           []string      `json:"skip_extensions" yaml:"skip_extensions"`                       // File extensions of the links not followed (they win over the follow extensions)
+	MaxSources               int           `json:"max_sources" yaml:"max_sources"`                               // Maximum number of sources to crawl
+	MaxConcurrentSources     int           `json:"max_concurrent_sources" yaml:"max_concurrent_sources"`         // Maximum number of sources crawled at the same time (0 means max_sources)
+	Delay                    string        `json:"delay" yaml:"delay"`                                           // Delay between requests (in seconds)
+	Politeness               string        `json:"politeness" yaml:"politeness"`                                 // Politeness preset (gentle, normal or aggressive) setting workers, delay and interval (explicit values override it)
+	RandomSeed               int64         `json:"random_seed" yaml:"random_seed"`                               // Seed of the random choices (User-Agent, proxy and delays jitter) of each crawl, so they can be reproduced (0 means not reproducible)
+	BrowsingMode             string        `json:"browsing_mode" yaml:"browsing_mode"`                           // Browsing type (e.g., "recursive", "human", "fuzzing")
+	RulesOrder               string        `json:"rules_order" yaml:"rules_order"`                               // Order of the rules on each page: actions_first (default) or scraping_first
+	MaxRetries               int           `json:"max_retries" yaml:"max_retries"`                               // Maximum number of retries
+	PageRetries              int           `json:"page_retries" yaml:"page_retries"`                             // Number of retries of the failed page loads (0 means no retries)
+	PageRetryDelay           int           `json:"page_retry_delay" yaml:"page_retry_delay"`                     // Delay (in seconds) before the first retry of a failed page load, doubled at each retry
+	MaxRedirects             int           `json:"max_redirects" yaml:"max_redirects"`                           // Maximum number of redirects
+	MaxRequests              int           `json:"max_requests" yaml:"max_requests"`                             // Maximum number of requests
+	MaxConsecutiveErrors     int           `json:"max_consecutive_errors" yaml:"max_consecutive_errors"`         // Maximum number of consecutive page errors before aborting a Source (0 means no limit)
+	MaxErrorRate             float64       `json:"max_error_rate" yaml:"max_error_rate"`                         // Maximum ratio of failed pages (0-1) before aborting a Source (0 means no limit)
+	ResetCookiesPolicy       string        `json:"reset_cookies_policy" yaml:"reset_cookies_policy"`             // Cookies policy (e.g., "none", "on-request", "on-start", "when-done", "always")
+	NoThirdPartyCookies      bool          `json:"no_third_party_cookies" yaml:"no_third_party_cookies"`         // Whether to accept third-party cookies or not
+	IgnoreCertErrors         bool          `json:"ignore_cert_errors" yaml:"ignore_cert_errors"`                 // Whether to ignore TLS certificate errors (e.g., self-signed certs), per Source only
+	CrawlingInterval         string        `json:"crawling_interval" yaml:"crawling_interval"`                   // Time to wait before re-crawling a source
+	CrawlingIfError          string        `json:"crawling_if_error" yaml:"crawling_if_error"`                   // Whether to re-crawl a source if an error occurs
+	CrawlingIfOk             string        `json:"crawling_if_ok" yaml:"crawling_if_ok"`                         // Whether to re-crawl a source if the crawling is successful
+	ProcessingTimeout        string        `json:"processing_timeout" yaml:"processing_timeout"`                 // Timeout for processing the source
+	ActionPlanTimeout        int           `json:"action_plan_timeout" yaml:"action_plan_timeout"`               // Timeout for the whole action plan (action rules) of a page in seconds (0 means no limit)
+	SourceTimeout            int           `json:"source_timeout" yaml:"source_timeout"`                         // Timeout for the whole crawl of a Source in seconds (0 means no limit)
+	RequestImages            bool          `json:"request_images" yaml:"request_images"`                         // Whether to request the images or not
+	RequestCSS               bool          `json:"request_css" yaml:"request_css"`                               // Whether to request the CSS or not
+	RequestScripts           bool          `json:"request_scripts" yaml:"request_scripts"`                       // Whether to request the scripts or not
+	RequestPlugins           bool          `json:"request_plugins" yaml:"request_plugins"`                       // Whether to request the plugins or not
+	RequestFrames            bool          `json:"request_frames" yaml:"request_frames"`                         // Whether to request the frames or not
+	CollectHTML              bool          `json:"collect_html" yaml:"collect_html"`                             // Whether to collect the HTML content or not
+	StoreRawHTML             bool          `json:"store_raw_html" yaml:"store_raw_html"`                         // Whether to store the raw HTML of the pages (gzip compressed, in PageHTML) or not
+	CollectImages            bool          `json:"collect_images" yaml:"collect_images"`                         // Whether to collect the images or not
+	CollectFiles             bool          `json:"collect_files" yaml:"collect_files"`                           // Whether to collect the files or not
+	CollectContent           bool          `json:"collect_content" yaml:"collect_content"`                       // Whether to collect the content or not
+	CollectKeywords          bool          `json:"collect_keywords" yaml:"collect_keywords"`                     // Whether to collect the keywords or not
+	CollectMetaTags          bool          `json:"collect_metatags" yaml:"collect_metatags"`                     // Whether to collect the metatags or not
+	CollectPerfMetrics       bool          `json:"collect_performance" yaml:"collect_performance"`               // Whether to collect the performance metrics or not
+	CollectPageEvents        bool          `json:"collect_events" yaml:"collect_events"`                         // Whether to collect the page events or not
+	CollectXHR               bool          `json:"collect_xhr" yaml:"collect_xhr"`                               // Whether to collect the XHR requests or not
+	CollectLinks             bool          `json:"collect_links" yaml:"collect_links"`                           // Whether to collect the links or not
+	ScrollBeforeExtract      bool          `json:"scroll_before_extract" yaml:"scroll_before_extract"`           // Whether to scroll the pages to the bottom (loading their lazy-loaded content) before extracting their links or not
+	MaxScrolls               int           `json:"max_scrolls" yaml:"max_scrolls"`                               // Maximum number of scrolls to the bottom of a page loading new content (when scroll_before_extract is set)
+	HumanLike                bool          `json:"human_like" yaml:"human_like"`                                 // Whether to interact with the pages like a human (random small scrolls, mouse moves and dwell times) before extracting them or not
+	HumanLikeIntensity       int           `json:"human_like_intensity" yaml:"human_like_intensity"`             // Number of random interactions with each page (when human_like is set)
+	CollectForms             bool          `json:"collect_forms" yaml:"collect_forms"`                           // Whether to collect the forms structure or not
+	CollectBreadcrumbs       bool          `json:"collect_breadcrumbs" yaml:"collect_breadcrumbs"`               // Whether to collect the breadcrumb trail of the pages or not
+	CollectMedia             bool          `json:"collect_media" yaml:"collect_media"`                           // Whether to collect the video and audio media of the pages or not
+	SummarySources           string        `json:"summary_sources" yaml:"summary_sources"`                       // Comma separated preference order of the sources of the page summary
+	ReportInterval           int           `json:"report_time" yaml:"report_time"`                               // Time to wait before sending the report (in minutes)
+	CheckForRobots           bool          `json:"check_for_robots" yaml:"check_for_robots"`                     // Whether to respect the robots.txt rules (and Crawl-delay) of the crawled sites or not
+	RobotsCacheTTL           int           `json:"robots_cache_ttl" yaml:"robots_cache_ttl"`                     // Minutes a fetched robots.txt is cached for, before fetching it again
+	UseSitemaps              bool          `json:"use_sitemaps" yaml:"use_sitemaps"`                             // Whether to seed the crawl of a Source with the URLs of its sitemap.xml or not
+	SitemapMaxURLs           int           `json:"sitemap_max_urls" yaml:"sitemap_max_urls"`                     // Maximum number of URLs collected from the sitemaps of a Source
+	PersistQueue             bool          `json:"persist_queue" yaml:"persist_queue"`                           // Whether to persist the crawl queue of the Sources in the database (so interrupted crawls resume) or not
+	CreateEventWhenDone      bool          `json:"create_event_when_done" yaml:"create_event_when_done"`         // Whether to create an event when the crawling is done or not
+	SkipInsecurePages        bool          `json:"skip_insecure_pages" yaml:"skip_insecure_pages"`               // Whether to skip indexing pages served over an insecure connection or with mixed content
+	SkipErrorPages           bool          `json:"skip_error_pages" yaml:"skip_error_pages"`                     // Whether to skip indexing pages served with an HTTP error status (4xx or 5xx)
+	TraceRules               bool          `json:"trace_rules" yaml:"trace_rules"`                               // Whether to record a trace of the action and scraping rules execution or not
+	ExportKVEnvironment      bool          `json:"export_kv_environment" yaml:"export_kv_environment"`           // Whether to save snapshots of the KV store environment of each ruleset execution or not
+	MaxKVSnapshots           int           `json:"max_kv_snapshots" yaml:"max_kv_snapshots"`                     // Maximum number of KV environment snapshots kept per Source (the oldest ones are dropped)
+	TracePath                string        `json:"trace_path" yaml:"trace_path"`                                 // Directory where the rules execution traces (and KV environment snapshots) are saved (one file per Source)
+	RequiredEgressCIDR       string        `json:"required_egress_cidr" yaml:"required_egress_cidr"`             // Comma separated CIDRs the engine public IP must belong to (empty means no check)
+	EgressCheckURL           string        `json:"egress_check_url" yaml:"egress_check_url"`                     // IP-echo service used to discover the engine public IP
+	Control                  ControlConfig `json:"control" yaml:"control"`                                       // Control/COnsole internal API
+	VisitedLinks             VisitedLinks  `json:"visited_links" yaml:"visited_links"`                           // How to keep track of the visited links
+	StopCondition            StopCondition `json:"stop_condition" yaml:"stop_condition"`                         // Scraped data that, once found, stops the crawl of a Source
+	FlagDuplicateTitles      bool          `json:"flag_duplicate_titles" yaml:"flag_duplicate_titles"`           // Whether to flag the pages of a Source sharing the same title and summary as low-distinctiveness
+	DuplicateTitlesMin       int           `json:"duplicate_titles_min" yaml:"duplicate_titles_min"`             // Minimum number of pages sharing a title and summary to flag them
+	SourceIntake             SourceIntake  `json:"source_intake" yaml:"source_intake"`                           // How many new Sources can start crawling per scheduler cycle
+	PostCrawlHooks           []CrawlHook   `json:"post_crawl_hooks" yaml:"post_crawl_hooks"`                     // Hooks run with the crawl summary after the crawl of a Source (HTTP calls or commands)
+	HooksAllowedHosts        []string      `json:"hooks_allowed_hosts" yaml:"hooks_allowed_hosts"`               // Hosts the HTTP hooks can call even if they aren't public (the others must resolve to public IPs)
+	HooksAllowedCommands     []string      `json:"hooks_allowed_commands" yaml:"hooks_allowed_commands"`         // Executables the command hooks can run (no command hooks if empty)
+	Whitespace               Whitespace    `json:"whitespace" yaml:"whitespace"`                                 // How the whitespace of the extracted text (body text and summary) is normalized
+	NormalizeEncoding        bool          `json:"normalize_encoding" yaml:"normalize_encoding"`                 // Whether to transcode the pages in legacy encodings (e.g., Shift_JIS, ISO-8859-1) to UTF-8 before extracting their content
+	CrossSourceDedup         bool          `json:"cross_source_dedup" yaml:"cross_source_dedup"`                 // Whether to skip storing the content of the pages already indexed (by any source) with the same content, linking them to the new source only
+	IndexCanonicalURL        bool          `json:"index_canonical_url" yaml:"index_canonical_url"`               // Whether to index the pages under their canonical URL (the crawled URL is still recorded for the source)
+	SendReferer              bool          `json:"send_referer" yaml:"send_referer"`                             // Whether to send the page linking to the crawled page as its Referer
+	MaxScrapedPageSize       int           `json:"max_scraped_page_size" yaml:"max_scraped_page_size"`           // Maximum size (in bytes) of the data scraped from a page (0 means unlimited)
+	MaxScrapedSourceSize     int           `json:"max_scraped_source_size" yaml:"max_scraped_source_size"`       // Maximum size (in bytes) of the data scraped from all the pages of a Source (0 means unlimited)
+	MaxBodyTextBytes         int           `json:"max_body_text_bytes" yaml:"max_body_text_bytes"`               // Maximum size (in bytes) of the body text of a page, longer ones are truncated (0 means unlimited)
+	OperatorContact          Contact       `json:"operator_contact" yaml:"operator_contact"`                     // Contact of the crawler operator advertised to the crawled sites (From header and User-Agent contact URL)
+	Intercepts               []Intercept   `json:"interceptions" yaml:"interceptions"`                           // Requests of the VDI sessions served with canned responses (fixture files), e.g. to test the rules
+	KeywordRules             []KeywordRule `json:"keyword_rules" yaml:"keyword_rules"`                           // Rules capturing domain-specific terms (e.g. product codes) as keywords, tagged with the rule name
+	KeywordMinLength         int           `json:"keyword_min_length" yaml:"keyword_min_length"`                 // Minimum length (in characters) of the keywords extracted from the pages text and meta tags
+	StopWords                StopWordLists `json:"stop_words" yaml:"stop_words"`                                 // Additional (e.g. domain-specific) stop words filtered out of the keywords
+	APIPagination            APIPagination `json:"api_pagination" yaml:"api_pagination"`                         // Collection of the records of the paginated JSON APIs found in the captured network traffic (collect_xhr)
+	AMP                      AMP           `json:"amp" yaml:"amp"`                                               // Handling of the AMP versions of the pages (declared with <link rel="amphtml">)
+	Enrichment               Enrichment    `json:"enrichment" yaml:"enrichment"`                                 // NLP enrichment (sentiment, entities and topics) of the body text of the pages
+	Facets                   Facets        `json:"facets" yaml:"facets"`                                         // Faceted URLs of a Source (e.g. product filters) crawled deliberately, enumerating their parameters values
+}
+
+// Enrichment represents the NLP enrichment (sentiment, entities and topics)
+// of the body text of the pages, by a pluggable backend: an HTTP service or
+// a backend registered by the embedding application (e.g. a local model)
+type Enrichment struct {
+	Backend  string            `json:"backend" yaml:"backend"`                     // none (default), http or the name of a registered backend
+	Endpoint string            `json:"endpoint" yaml:"endpoint"`                   // URL the body text is POSTed to (http backend)
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // Headers of the HTTP call, e.g. an Authorization token (http backend)
+	Timeout  int               `json:"timeout" yaml:"timeout"`                     // Timeout of the enrichment of a page in seconds
+}
+
+// Facets represents the faceted URLs of a Source (e.g. the product filters
+// of a catalog) crawled deliberately: the values of the facet parameters are
+// enumerated and added to the URL, instead of relying on the links found
+type Facets struct {
+	URL          string              `json:"url" yaml:"url"`                                       // URL the facet parameters are added to (the Source URL if empty)
+	Params       map[string][]string `json:"params,omitempty" yaml:"params,omitempty"`             // Facet parameters and their values (all their combinations are crawled)
+	Combinations []map[string]string `json:"combinations,omitempty" yaml:"combinations,omitempty"` // Combinations of the facet parameters values crawled (instead of all the combinations of params)
+	MaxURLs      int                 `json:"max_urls" yaml:"max_urls"`                             // Maximum number of facet URLs crawled
+}
+
+// AMP represents the handling of the AMP versions of the pages (declared by
+// the pages with <link rel="amphtml">)
+type AMP struct {
+	Crawl  bool `json:"crawl" yaml:"crawl"`   // Whether to crawl (and index) the AMP versions of the pages too
+	Prefer bool `json:"prefer" yaml:"prefer"` // Whether to extract the body text of the pages from their AMP version (often cleaner)
+}
+
+// APIPagination represents the configuration of the collection of the
+// records of the paginated JSON APIs called by the pages (found in the
+// captured network traffic): their pagination is followed directly against
+// the API, which is faster than rendering the pages of a listing
+type APIPagination struct {
+	Enabled   bool          `json:"enabled" yaml:"enabled"`     // Whether to follow the pagination of the captured JSON APIs or not
+	MaxPages  int           `json:"max_pages" yaml:"max_pages"` // Maximum number of pages requested per API endpoint (default 50)
+	Endpoints []APIEndpoint `json:"endpoints" yaml:"endpoints"` // Rules confirming or configuring the pagination of the API endpoints (it's detected if no rule matches)
+}
+
+// APIEndpoint represents the pagination of the API endpoints matching a URL
+// pattern (the empty fields are detected)
+type APIEndpoint struct {
+	URLPattern  string `json:"url_pattern" yaml:"url_pattern"`   // URL pattern of the endpoint ('*' matches zero or more characters, '?' exactly one, '\' escapes them)
+	Mode        string `json:"mode" yaml:"mode"`                 // Pagination mode: cursor, next_url, offset, page or none (the endpoint isn't followed)
+	Param       string `json:"param" yaml:"param"`               // Query parameter of the cursor, offset or page number
+	LimitParam  string `json:"limit_param" yaml:"limit_param"`   // Query parameter of the page size (offset mode)
+	CursorPath  string `json:"cursor_path" yaml:"cursor_path"`   // Path (dot notation) of the next cursor, or next URL, in the responses
+	RecordsPath string `json:"records_path" yaml:"records_path"` // Path (dot notation) of the records array in the responses
+}
+
+// StopWordLists represents lists of stop words by language code (e.g. "en",
+// "*" for the stop words of all the languages)
+type StopWordLists map[string][]string
+
+// KeywordRule represents a keyword extraction rule: the terms of the pages
+// matching its pattern (e.g. product codes or ticker symbols, which the
+// generic keywords extraction misses) are captured as keywords
+type KeywordRule struct {
+	Name    string `json:"name" yaml:"name"`       // Name of the rule, the tag of the keywords it captures (so they can be weighted)
+	Pattern string `json:"pattern" yaml:"pattern"` // Regular expression of the terms (if it has a capture group, the first one is the term)
+}
+
+// Intercept represents the interception of the requests of the VDI sessions
+// matching a URL pattern, served with a canned response read from a fixture
+// file (so the rules can be tested without depending on live sites)
+type Intercept struct {
+	URLPattern  string            `json:"url_pattern" yaml:"url_pattern"`             // URL pattern of the requests ('*' matches zero or more characters, '?' exactly one, '\' escapes them)
+	File        string            `json:"file" yaml:"file"`                           // Fixture file served as the body of the response
+	Status      int               `json:"status" yaml:"status"`                       // Status code of the response (default 200)
+	ContentType string            `json:"content_type" yaml:"content_type"`           // Content-Type of the response (by default it depends on the file extension)
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // Other headers of the response
+}
+
+// Contact represents the contact of the crawler operator, advertised to the
+// crawled sites so their owners can reach out instead of blocking the crawler
+type Contact struct {
+	Email string `json:"email" yaml:"email"` // Email address sent in the From header of all the requests
+	URL   string `json:"url" yaml:"url"`     // URL appended to the User-Agent of all the requests, e.g. "(+https://example.com/crawler)"
+}
+
+// Whitespace represents the normalization of the whitespace of the text
+// extracted from the pages
+type Whitespace struct {
+	Mode           string `json:"mode" yaml:"mode"`                         // collapse (default, runs of whitespace become a single space), lines (like collapse, but keeping the line breaks) or none
+	StripZeroWidth bool   `json:"strip_zero_width" yaml:"strip_zero_width"` // Whether to strip the zero-width characters (e.g., U+200B) or not
+}
+
+// CrawlHook represents a hook run after the crawl of a Source, with the
+// crawl summary: an HTTP call (the summary is POSTed as JSON) or a command
+// (the summary is given on its standard input).
+type CrawlHook struct {
+	Type    string            `json:"type" yaml:"type"`                           // http (default) or command
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`         // URL the crawl summary is POSTed to (http hooks)
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // Headers of the HTTP call, e.g. an Authorization token (http hooks)
+	Command string            `json:"command,omitempty" yaml:"command,omitempty"` // Command template, e.g. "/usr/local/bin/reindex --source {{.SourceID}}" (command hooks, not run through a shell)
+	Timeout int               `json:"timeout" yaml:"timeout"`                     // Timeout of the hook in seconds
+}
+
+// SourceIntake represents the throttle of the new Sources that start crawling
+// on each scheduler cycle, to smooth the load after a restart or a big import.
+type SourceIntake struct {
+	MaxPerCycle int `json:"max_per_cycle" yaml:"max_per_cycle"` // Maximum number of new Sources per cycle (0 means max_sources)
+	RampUp      int `json:"ramp_up" yaml:"ramp_up"`             // Minutes to linearly ramp up the intake after the engine starts (0 means no ramp-up)
+}
+
+// PolitenessPreset is a named bundle of the crawler settings controlling how
+// hard a site is crawled
+type PolitenessPreset struct {
+	Workers  int    // Number of crawler workers
+	Delay    string // Delay between requests (in seconds, random() adds jitter)
+	Interval string // Interval between crawler requests (in seconds)
+}
+
+// StopCondition represents a predicate on the data scraped from a page. When a
+// page scraped data matches it, the crawl of the Source is stopped early (the
+// target has been found).
+type StopCondition struct {
+	Key     string `json:"key" yaml:"key"`         // The scraped data key to check, nested keys are separated by dots, e.g. "product.price" (empty means no stop condition)
+	Equals  string `json:"equals" yaml:"equals"`   // The value the key must be equal to (optional)
+	Matches string `json:"matches" yaml:"matches"` // A regular expression the key value must match (optional)
+}
+
+// VisitedLinks represents the configuration of the visited links set
+type VisitedLinks struct {
+	Type              string  `json:"type" yaml:"type"`                               // "map" (exact, default) or "bloom" (bounded memory, for very large crawls)
+	Capacity          uint64  `json:"capacity" yaml:"capacity"`                       // Expected number of URLs per Source (bloom only)
+	FalsePositiveRate float64 `json:"false_positive_rate" yaml:"false_positive_rate"` // Acceptable false-positive rate, e.g. 0.001 (bloom only)
+	StatePath         string  `json:"state_path" yaml:"state_path"`                   // Directory where to persist the filter of interrupted crawls, to resume them (bloom only)
 }
 
 // ControlConfig represents the internal control API configuration
@@ -144,6 +350,7 @@ type HTTPConfig struct {
 	Enabled         bool           `json:"enabled" yaml:"enabled"`
 	Timeout         int            `json:"timeout" yaml:"timeout"`
 	FollowRedirects bool           `json:"follow_redirects" yaml:"follow_redirects"`
+	Methods         []string       `json:"methods" yaml:"methods"` // The HTTP methods the headers are requested with, in order (the next one if a method is rejected)
 	SSLDiscovery    SSLScoutConfig `json:"ssl_discovery" yaml:"ssl_discovery"`
 	Proxies         []SOCKSProxy   `json:"proxies" yaml:"proxies"`
 }
@@ -200,11 +407,18 @@ type ServiceScoutConfig struct {
 	ExcludeHosts []string `yaml:"excluded_hosts,omitempty"` // --exclude (Hosts to exclude)
 
 	// Timing and performance
-	TimingTemplate string `yaml:"timing_template"` // -T<0-5> (Timing template)
-	HostTimeout    string `yaml:"host_timeout"`    // --host-timeout (Give up on target after this long)
-	MinRate        string `yaml:"min_rate"`        // --min-rate (Send packets no slower than this)
-	MaxRetries     int    `yaml:"max_retries"`     // --max-retries (Caps the number of port scan probe retransmissions)
-	MaxPortNumber  int    `yaml:"max_port_number"` // allows to specify the maximum port number to scan (default is 9000)
+	TimingTemplate     string `yaml:"timing_template"`      // -T<0-5> (Timing template)
+	HostTimeout        string `yaml:"host_timeout"`         // --host-timeout (Give up on target after this long)
+	MinRate            string `yaml:"min_rate"`             // --min-rate (Send packets no slower than this)
+	MaxRetries         int    `yaml:"max_retries"`          // --max-retries (Caps the number of port scan probe retransmissions)
+	MaxPortNumber      int    `yaml:"max_port_number"`      // allows to specify the maximum port number to scan (default is 9000)
+	MaxParallelHosts   int    `yaml:"max_parallel_hosts"`   // Maximum number of hosts scanned at the same time (each host scan is an Nmap process)
+	MaxRangeHosts      int    `yaml:"max_range_hosts"`      // Maximum number of hosts a CIDR block or IP range target can expand to (larger ranges are skipped)
+	GlobalMaxProcesses int    `yaml:"global_max_processes"` // Maximum number of Nmap processes running at the same time in the whole engine (across all the sources)
+
+	// Results cache
+	CacheTTL  int    `yaml:"cache_ttl"`  // Minutes the scan results of a host are reused for, instead of scanning it again (0 means no cache)
+	CachePath string `yaml:"cache_path"` // File where the cached scan results are saved, so an interrupted scan can be resumed after a restart (empty means in memory only)
 
 	// Output (TBD)
 	/*
@@ -255,20 +469,25 @@ type PlatformInfo struct {
 
 // API represents the API configuration
 type API struct {
-	Host              string `yaml:"host"`               // Hostname of the API server
-	Port              int    `yaml:"port"`               // Port number of the API server
-	Timeout           int    `yaml:"timeout"`            // Timeout for API requests (in seconds)
-	ContentSearch     bool   `yaml:"content_search"`     // Whether to search in the content too or not
-	ReturnContent     bool   `yaml:"return_content"`     // Whether to return the content or not
-	SSLMode           string `yaml:"sslmode"`            // SSL mode for API connection (e.g., "disable")
-	CertFile          string `yaml:"cert_file"`          // Path to the SSL certificate file
-	KeyFile           string `yaml:"key_file"`           // Path to the SSL key file
-	RateLimit         string `yaml:"rate_limit"`         // Rate limit values are tuples (for ex. "1,3") where 1 means allows 1 request per second with a burst of 3 requests
-	EnableConsole     bool   `yaml:"enable_console"`     // Whether to enable the console or not
-	ReadHeaderTimeout int    `yaml:"readheader_timeout"` // ReadHeaderTimeout is the amount of time allowed to read request headers.
-	ReadTimeout       int    `yaml:"read_timeout"`       // ReadTimeout is the maximum duration for reading the entire request
-	WriteTimeout      int    `yaml:"write_timeout"`      // WriteTimeout
-	Return404         bool   `yaml:"return_404"`         // Whether to return 404 for not found or not
+	Host              string  `yaml:"host"`                // Hostname of the API server
+	Port              int     `yaml:"port"`                // Port number of the API server
+	Timeout           int     `yaml:"timeout"`             // Timeout for API requests (in seconds)
+	ContentSearch     bool    `yaml:"content_search"`      // Whether to search in the content too or not
+	ReturnContent     bool    `yaml:"return_content"`      // Whether to return the content or not
+	SSLMode           string  `yaml:"sslmode"`             // SSL mode for API connection (e.g., "disable")
+	CertFile          string  `yaml:"cert_file"`           // Path to the SSL certificate file
+	KeyFile           string  `yaml:"key_file"`            // Path to the SSL key file
+	RateLimit         string  `yaml:"rate_limit"`          // Rate limit values are tuples (for ex. "1,3") where 1 means allows 1 request per second with a burst of 3 requests
+	EnableConsole     bool    `yaml:"enable_console"`      // Whether to enable the console or not
+	ReadHeaderTimeout int     `yaml:"readheader_timeout"`  // ReadHeaderTimeout is the amount of time allowed to read request headers.
+	ReadTimeout       int     `yaml:"read_timeout"`        // ReadTimeout is the maximum duration for reading the entire request
+	WriteTimeout      int     `yaml:"write_timeout"`       // WriteTimeout
+	Return404         bool    `yaml:"return_404"`          // Whether to return 404 for not found or not
+	ExcludeDuplicates bool    `yaml:"exclude_duplicates"`  // Whether to exclude the low-distinctiveness pages (duplicate title and summary) from the search results or not
+	KeywordWeight     float64 `yaml:"keyword_weight"`      // Weight of each matched keyword in the score of the keywords search results
+	FreshnessWeight   float64 `yaml:"freshness_weight"`    // Weight of the pages freshness in the score of the keywords search results (0 disables it)
+	FreshnessHalfLife int     `yaml:"freshness_half_life"` // Age (in days) at which the freshness of a page is halved
+	RankingCandidates int     `yaml:"ranking_candidates"`  // Maximum number of (best matching) pages ranked by score
 }
 
 // Selenium represents the CROWler VDI configuration
@@ -282,9 +501,11 @@ type Selenium struct {
 	Port        int    `yaml:"port"`         // Port number for Selenium server
 	Host        string `yaml:"host"`         // Hostname of the Selenium server
 	Headless    bool   `yaml:"headless"`     // Whether to run Selenium in headless mode
+	Instances   int    `yaml:"instances"`    // Number of concurrent sessions (crawls) the VDI can run
 	UseService  bool   `yaml:"use_service"`  // Whether to use Selenium service as well or not
 	SSLMode     string `yaml:"sslmode"`      // SSL mode for Selenium connection (e.g., "disable")
 	ProxyURL    string `yaml:"proxy_url"`    // Proxy URL for Selenium connection
+	Proxy       Proxy  `yaml:"proxy"`        // Proxy the browser connects through (it wins over proxy_url)
 	/*
 		ProxyUser   string       `yaml:"proxy_user"`   // Proxy username for Selenium connection
 		ProxyPass   string       `yaml:"proxy_pass"`   // Proxy password for Selenium connection
@@ -295,6 +516,15 @@ type Selenium struct {
 	SysMng      SysMngConfig `yaml:"sys_manager"`  // System management configuration
 }
 
+// Proxy represents an HTTP(S) or SOCKS proxy a VDI browser connects through
+type Proxy struct {
+	Scheme   string `json:"scheme" yaml:"scheme"`     // Proxy protocol: http (default), https, socks5 or socks4
+	Host     string `json:"host" yaml:"host"`         // Hostname or IP of the proxy
+	Port     int    `json:"port" yaml:"port"`         // Port number of the proxy
+	Username string `json:"username" yaml:"username"` // Username to authenticate with the proxy (optional)
+	Password string `json:"password" yaml:"password"` // Password to authenticate with the proxy (optional)
+}
+
 // SysMngConfig represents the system management configuration
 type SysMngConfig struct {
 	Port              int    `yaml:"port"`               // Port number of the system management server
@@ -506,7 +736,10 @@ type SourceConfig struct {
 
 // CrawlingConfig represents the crawling configuration for a source
 type CrawlingConfig struct {
-	Site string `json:"site" yaml:"site" validate:"required,url"`
+	Site            string   `json:"site" yaml:"site" validate:"required,url"`
+	IncludePatterns []string `json:"include_patterns,omitempty" yaml:"include_patterns,omitempty"` // Regexes limiting the crawl of the source to the matching URLs
+	ExcludePatterns []string `json:"exclude_patterns,omitempty" yaml:"exclude_patterns,omitempty"` // Regexes of the source URLs not to crawl
+	Proxy           *Proxy   `json:"proxy,omitempty" yaml:"proxy,omitempty"`                       // Proxy the VDI browsers connect through to crawl the source (so sources can use different exit IPs)
 }
 
 // ExecutionPlanItem represents the execution plan item for a source
@@ -534,7 +767,12 @@ func (s *SysMngConfig) IsEmpty() bool {
 	return s.Port == 0 && s.Timeout == 0 && s.SSLMode == "" && s.CertFile == "" && s.KeyFile == "" && s.RateLimit == "" && s.ReadHeaderTimeout == 0 && s.ReadTimeout == 0 && s.WriteTimeout == 0
 }
 
+// IsEmpty returns true if no proxy is configured
+func (p *Proxy) IsEmpty() bool {
+	return p.Host == ""
+}
+
 // IsEmpty returns true is the Selenium configuration is empty
 func (s *Selenium) IsEmpty() bool {
-	return s.Name == "" && s.Location == "" && s.Path == "" && s.DriverPath == "" && s.Type == "" && s.ServiceType == "" && s.Port == 0 && s.Host == "" && !s.Headless && !s.UseService && s.SSLMode == "" && s.ProxyURL == "" && s.DownloadDir == "" && s.Language == "" && s.SysMng.IsEmpty()
+	return s.Name == "" && s.Location == "" && s.Path == "" && s.DriverPath == "" && s.Type == "" && s.ServiceType == "" && s.Port == 0 && s.Host == "" && !s.Headless && !s.UseService && s.SSLMode == "" && s.ProxyURL == "" && s.Proxy.IsEmpty() && s.DownloadDir == "" && s.Language == "" && s.SysMng.IsEmpty()
 }
@@ -0,0 +1,128 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+// runActionPlan runs an action plan (a sequence of action rules, e.g. a login
+// and the navigation that follows it), aborting it if it takes longer than
+// timeout (0 means no limit). When the plan times out, the action rule it was
+// on is recorded in the Status and returned in the error.
+//
+// A WebDriver call can't be interrupted, so a timed out plan fails the crawl
+// of the Source: its VDI session is quit (which makes the stuck step return)
+// and the action plans that follow are not executed (they would wait for the
+// stuck step, which keeps the page until it returns).
+func (ctx *ProcessContext) runActionPlan(timeout time.Duration, plan func()) error {
+	if ctx.isCrawlAborted() {
+		return fmt.Errorf("crawl aborted, action plan not executed")
+	}
+	ctx.actionPlanRunning.Lock()
+	if timeout <= 0 {
+		defer ctx.actionPlanRunning.Unlock()
+		ctx.actionPlanMutex.Lock()
+		ctx.actionPlanCtx = nil
+		ctx.actionPlanStep = ""
+		ctx.actionPlanMutex.Unlock()
+		plan()
+		return nil
+	}
+
+	planCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ctx.actionPlanMutex.Lock()
+	ctx.actionPlanCtx = planCtx
+	ctx.actionPlanStep = ""
+	ctx.actionPlanMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		// The plan (even when abandoned) keeps the page until it returns, so
+		// the action plan state is its own until then
+		defer ctx.actionPlanRunning.Unlock()
+		defer close(done)
+		if planCtx.Err() != nil {
+			return
+		}
+		plan()
+	}()
+
+	select {
+	case <-done:
+		ctx.actionPlanMutex.Lock()
+		if ctx.actionPlanCtx == planCtx {
+			ctx.actionPlanCtx = nil
+		}
+		ctx.actionPlanMutex.Unlock()
+		return nil
+	case <-planCtx.Done():
+		ctx.actionPlanMutex.Lock()
+		step := ctx.actionPlanStep
+		ctx.actionPlanMutex.Unlock()
+		err := fmt.Errorf("action plan timed out after %v on action rule '%s'", timeout, step)
+		ctx.errorsMutex.Lock()
+		if ctx.Status != nil {
+			ctx.Status.ActionPlanStep = step
+			ctx.Status.LastError = err.Error()
+		}
+		ctx.crawlAborted = true
+		ctx.errorsMutex.Unlock()
+		ctx.quitStuckSession()
+		return err
+	}
+}
+
+// quitStuckSession quits the VDI session of a timed out action plan, so its
+// stuck step returns (and the page lock is released) and the session isn't
+// reused: the VDI instance is returned to the pool when the crawl ends.
+func (ctx *ProcessContext) quitStuckSession() {
+	ctx.VDIOperationMutex.Lock()
+	wd := ctx.wd
+	quit := wd != nil && !ctx.SelClosed
+	ctx.SelClosed = true
+	ctx.VDIOperationMutex.Unlock()
+	if !quit {
+		return
+	}
+
+	// Quit may wait for the stuck step too, so it doesn't block the crawl
+	go func() {
+		if err := wd.Quit(); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "Source %d: quitting the VDI session of the timed out action plan: %v", ctx.source.ID, err)
+		}
+	}()
+}
+
+// beginActionPlanStep records the action rule the action plan is executing.
+// It returns an error if the action plan has been aborted (timed out), in
+// which case the action rule must not be executed.
+func (ctx *ProcessContext) beginActionPlanStep(ruleName string) error {
+	ctx.actionPlanMutex.Lock()
+	defer ctx.actionPlanMutex.Unlock()
+	if ctx.actionPlanCtx != nil && ctx.actionPlanCtx.Err() != nil {
+		return fmt.Errorf("action plan aborted, action rule '%s' not executed", ruleName)
+	}
+	ctx.actionPlanStep = ruleName
+	return nil
+}
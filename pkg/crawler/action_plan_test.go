@@ -0,0 +1,151 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestRunActionPlan(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	wd := &mockWebDriver{}
+	re := &rules.RuleEngine{
+		Rulesets: []rules.Ruleset{
+			{
+				Name: "https://www.example.com",
+				RuleGroups: []rules.RuleGroup{
+					{
+						GroupName: "Actions",
+						IsEnabled: true,
+						ActionRules: []rules.ActionRule{
+							{RuleName: "Refresh", ActionType: "refresh"},
+							{RuleName: "Submit", ActionType: "navigate_to_url", Value: "https://www.example.com/submit"},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := &ProcessContext{
+		source: &cdb.Source{ID: 1, URL: "https://www.example.com"},
+		re:     re,
+		wd:     wd,
+		Status: &Status{},
+	}
+
+	scraped, err := ctx.RunActionPlan()
+	if err != nil {
+		t.Fatalf("RunActionPlan returned an error: %v", err)
+	}
+	if len(scraped) != 0 {
+		t.Errorf("Expected no scraped data, got %v", scraped)
+	}
+
+	expected := []string{"get:https://www.example.com", "refresh", "get:https://www.example.com/submit"}
+	if !reflect.DeepEqual(wd.calls, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, wd.calls)
+	}
+	if ctx.Status.TotalActions != 2 {
+		t.Errorf("Expected 2 actions, got %d", ctx.Status.TotalActions)
+	}
+}
+
+func TestActionPlanTimeout(t *testing.T) {
+	ctx := &ProcessContext{source: &cdb.Source{ID: 42, URL: testFQDN}, Status: &Status{}}
+	stuck := &stuckWebDriver{release: make(chan struct{})}
+	defer close(stuck.release)
+	var wd vdi.WebDriver = stuck
+
+	actions := []rules.ActionRule{
+		{RuleName: "Accept cookies", ActionType: "refresh"},
+		{RuleName: "Open login", ActionType: "navigate_to_url", Value: testFQDN + "login"},
+		{RuleName: "Submit login", ActionType: "refresh"},
+	}
+
+	start := time.Now()
+	err := ctx.runActionPlan(50*time.Millisecond, func() { executeActionRules(ctx, actions, &wd) })
+	if err == nil || !strings.Contains(err.Error(), "'Open login'") {
+		t.Fatalf("Expected the action plan to time out on 'Open login', got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the action plan to be aborted after its timeout, it took %v", elapsed)
+	}
+	if ctx.Status.ActionPlanStep != "Open login" || ctx.Status.LastError != err.Error() {
+		t.Errorf("Expected the failing step to be recorded, got %q (%q)", ctx.Status.ActionPlanStep, ctx.Status.LastError)
+	}
+
+	// The steps that follow the stuck one are not executed
+	if err := ctx.beginActionPlanStep("Submit login"); err == nil {
+		t.Errorf("Expected the steps of an aborted action plan to be skipped")
+	}
+
+	// A plan completed in time doesn't record anything
+	ctx = &ProcessContext{source: &cdb.Source{ID: 42, URL: testFQDN}, Status: &Status{}}
+	if err := ctx.runActionPlan(5*time.Second, func() { executeActionRules(ctx, actions[:1], &wd) }); err != nil {
+		t.Errorf("Unexpected action plan error: %v", err)
+	}
+	if ctx.Status.ActionPlanStep != "" || ctx.beginActionPlanStep("Submit login") != nil {
+		t.Errorf("Expected no aborted action plan, got step %q", ctx.Status.ActionPlanStep)
+	}
+}
+
+func TestActionPlanTimeoutFailsTheCrawl(t *testing.T) {
+	stuck := &stuckWebDriver{release: make(chan struct{})}
+	var wd vdi.WebDriver = stuck
+	ctx := &ProcessContext{source: &cdb.Source{ID: 42, URL: testFQDN}, Status: &Status{}, wd: wd}
+
+	actions := []rules.ActionRule{
+		{RuleName: "Open login", ActionType: "navigate_to_url", Value: testFQDN + "login"},
+		{RuleName: "Submit login", ActionType: "refresh"},
+	}
+	if err := ctx.runActionPlan(50*time.Millisecond, func() { executeActionRules(ctx, actions, &wd) }); err == nil {
+		t.Fatalf("Expected the action plan to time out")
+	}
+
+	// The crawl fails and the stuck VDI session is quit
+	if !ctx.isCrawlAborted() || !ctx.SelClosed {
+		t.Errorf("Expected the timed out action plan to fail the crawl and close the VDI session")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for stuck.quits.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := stuck.quits.Load(); n != 1 {
+		t.Errorf("Expected the VDI session to be quit once, got %d", n)
+	}
+
+	// The next plan doesn't wait for the stuck step (nor runs)
+	start := time.Now()
+	err := ctx.runActionPlan(5*time.Second, func() { t.Errorf("Expected the next action plan not to run") })
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("Expected the next action plan to fail at once, got %v after %v", err, time.Since(start))
+	}
+
+	close(stuck.release)
+	time.Sleep(50 * time.Millisecond)
+
+	// The abandoned plan doesn't resume after its stuck step
+	if n := stuck.refreshes.Load(); n != 0 {
+		t.Errorf("Expected the steps of the abandoned plan to be skipped, %d executed", n)
+	}
+}
@@ -18,6 +18,7 @@ package crawler
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -32,7 +33,20 @@ const (
 	errFailedToGetLoc = "failed to get element location: %v"
 )
 
+// processActionRules runs the action plan of the current page: the default
+// action rules (if the Source uses the default configuration) and the action
+// rules matching the URL. The plan is aborted if it takes longer than the
+// crawler action_plan_timeout.
 func processActionRules(wd *vdi.WebDriver, ctx *ProcessContext, url string) {
+	timeout := time.Duration(ctx.config.Crawler.ActionPlanTimeout) * time.Second
+	err := ctx.runActionPlan(timeout, func() { runPageActionPlan(wd, ctx, url) })
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Source %d, page '%s': %v", ctx.source.ID, url, err)
+	}
+}
+
+// runPageActionPlan executes the action rules of the current page
+func runPageActionPlan(wd *vdi.WebDriver, ctx *ProcessContext, url string) {
 	cmn.DebugMsg(cmn.DbgLvlDebug2, "Starting to search and process CROWler Action rules...")
 	// Run Action Rules if any
 	if ctx.source.Config != nil {
@@ -135,7 +149,15 @@ func executeActionPostProcessingStep(ctx *ProcessContext, pp rules.PostProcessin
 }
 
 // executeActionRule executes a single ActionRule
-func executeActionRule(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriver) error {
+func executeActionRule(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriver) (err error) {
+	if err := ctx.beginActionPlanStep(r.RuleName); err != nil {
+		return err
+	}
+
+	step := ctx.trace.begin(traceActionRule, r.RuleName, r.ActionType, r.Selectors, wd)
+	result := traceResultOK
+	defer func() { ctx.trace.end(step, result, "", err) }()
+
 	// Execute Wait condition first
 	if len(r.WaitConditions) != 0 {
 		for _, wc := range r.WaitConditions {
@@ -162,7 +184,7 @@ func executeActionRule(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriv
 		case "custom":
 			return executeActionJS(ctx, r, wd)
 		case "take_screenshot":
-			return executeActionScreenshot(r, wd)
+			return executeActionScreenshot(ctx, r, wd)
 		case "key_down":
 			return executeActionKeyDown(r, wd)
 		case "key_up":
@@ -183,6 +205,8 @@ func executeActionRule(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriv
 			return executeActionScrollToElement(ctx, r, wd)
 		case "scroll_by_amount":
 			return executeActionScrollByAmount(r, wd)
+		case "auto_scroll":
+			return executeActionAutoScroll(ctx, r, wd)
 		case "click_and_hold":
 			return executeActionClickAndHold(ctx, r, wd)
 		case "release":
@@ -192,6 +216,7 @@ func executeActionRule(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriv
 		}
 		return fmt.Errorf("action type not supported: %s", r.ActionType)
 	}
+	result = traceResultSkipped
 	return nil
 }
 
@@ -290,24 +315,44 @@ func executeActionClear(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDri
 
 // executeActionScreenshot is responsible for executing a "take_screenshot" action
 // It takes a screenshot of the current page and saves it to the configured location
-// r.Value contains the filename of the screenshot and the max height of the screenshot
-// (optional, if not provided the screenshot will be taken of the entire page)
-// rValue syntax is: "maxHeight,fileName"
-func executeActionScreenshot(r *rules.ActionRule, wd *vdi.WebDriver) error {
-	// Check if the rule contains also a max height
+// r.Value contains the filename of the screenshot, the max height of the screenshot
+// (optional, if not provided the screenshot will be taken of the entire page) and
+// the screenshot mode (optional, if not provided the configured screenshot_mode is used)
+// rValue syntax is: "maxHeight,fileName,mode"
+// where mode is one of "fullpage", "viewport" or "element" (uses the rule's selectors)
+func executeActionScreenshot(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriver) error {
+	// Check if the rule contains also a max height and a mode
 	val := r.GetValue()
-	hVal := ""
-	fVal := ""
+	hVal := "0"
+	fVal := val
+	mode := ctx.config.Crawler.ScreenshotMode
 	if strings.Contains(val, ",") {
-		hVal = strings.Split(val, ",")[0]
-		fVal = strings.Split(val, ",")[1]
-	} else {
-		hVal = "0"
-		fVal = val
+		parts := strings.Split(val, ",")
+		hVal = parts[0]
+		fVal = parts[1]
+		if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+			mode = strings.ToLower(strings.TrimSpace(parts[2]))
+		}
 	}
 	hInt := cmn.StringToInt(hVal)
 
-	_, err := TakeScreenshot(wd, fVal, hInt)
+	// Store the screenshot following the configured path template
+	pageURL, _ := (*wd).CurrentURL()
+	fVal = ctx.screenshotFileName(pageURL, strings.TrimSpace(fVal))
+
+	if mode == optScreenshotElement {
+		wdf, _, err := findElementBySelectorType(ctx, wd, r.Selectors)
+		if err != nil {
+			return err
+		}
+		if wdf == nil {
+			return fmt.Errorf("no element found for the screenshot")
+		}
+		_, err = TakeElementScreenshot(wdf, fVal)
+		return err
+	}
+
+	_, err := TakeScreenshot(wd, fVal, hInt, mode)
 	return err
 }
 
@@ -347,92 +392,31 @@ func executeActionSwitchWindow(r *rules.ActionRule, wd *vdi.WebDriver) error {
 	return (*wd).SwitchWindow(r.Value)
 }
 
-// executeActionScrollToElement is responsible for executing a "scroll to element" action
+// scrollIntoViewScript scrolls the element passed as its argument to the
+// center of the viewport
+const scrollIntoViewScript = "arguments[0].scrollIntoView({behavior: 'instant', block: 'center', inline: 'nearest'});"
+
+// executeActionScrollToElement is responsible for executing a "scroll to element" action:
+// it scrolls the page until the element is centered in the viewport
 func executeActionScrollToElement(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriver) error {
 	// Find the element
-	wdf, selector, err := findElementBySelectorType(ctx, wd, r.Selectors)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlDebug3, errNoElementFound, err)
-		err = nil
-	}
-
-	// If the element is found, attempt to scroll to it using Rbee
-	if wdf != nil {
-		loc, err := wdf.Location()
-		if err != nil {
-			return fmt.Errorf(errFailedToGetLoc, err)
-		}
-
-		// JavaScript to send a POST request to Rbee for scrolling to the element
-		jsScript := fmt.Sprintf(`
-            (function() {
-                var xhr = new XMLHttpRequest();
-                xhr.open("POST", "http://localhost:3000/v1/rb", true);
-                xhr.setRequestHeader("Content-Type", "application/json;charset=UTF-8");
-                var data = JSON.stringify({
-                    "Action": "moveMouse",
-                    "X": %d,
-                    "Y": %d
-                });
-                xhr.onreadystatechange = function () {
-                    if (xhr.readyState === 4 && xhr.status === 200) {
-                        var scrollXhr = new XMLHttpRequest();
-                        scrollXhr.open("POST", "http://localhost:3000/v1/rb", true);
-                        scrollXhr.setRequestHeader("Content-Type", "application/json;charset=UTF-8");
-                        var scrollData = JSON.stringify({
-                            "Action": "scroll"
-                        });
-                        scrollXhr.onreadystatechange = function () {
-                            if (scrollXhr.readyState === 4 && scrollXhr.status === 200) {
-                                console.log("done.");
-                                return true;
-                            } else if (scrollXhr.readyState === 4) {
-                                console.error("Failed: " + scrollXhr.responseText);
-                                return false;
-                            }
-                        };
-                        scrollXhr.send(scrollData);
-                    } else if (xhr.readyState === 4) {
-                        console.error("Failed: " + xhr.responseText);
-                        return false;
-                    }
-                };
-                xhr.send(data);
-            })();
-        `, loc.X, loc.Y)
-
-		// Execute the JavaScript in the browser context
-		success, err := (*wd).ExecuteScript(jsScript, nil)
-		if err == nil && success == true {
-			cmn.DebugMsg(cmn.DbgLvlDebug3, "Scroll to element action executed successfully using Rbee")
-			return nil
-		}
-		cmn.DebugMsg(cmn.DbgLvlDebug3, "Failed to execute scroll to element using Rbee, falling back to Selenium")
-
-		// Fall back to using Selenium's ExecuteScript method
-		scrollScript := fmt.Sprintf(`
-            (function() {
-                var element = document.querySelector("%s");
-                if (element) {
-                    element.scrollIntoView({ behavior: 'smooth', block: 'center' });
-                    return true;
-                } else {
-                    return false;
-                }
-            })();
-        `, selector.Value)
-
-		success, err = (*wd).ExecuteScript(scrollScript, nil)
-		if err != nil {
-			return fmt.Errorf("failed to scroll to element using Selenium: %v", err)
+	wdf, _, err := findElementBySelectorType(ctx, wd, r.Selectors)
+	if err != nil || wdf == nil {
+		// Not found (yet), the rule's error handling may retry it later
+		selectors := make([]string, 0, len(r.Selectors))
+		for _, selector := range r.Selectors {
+			selectors = append(selectors, selector.Selector)
 		}
-
-		if success != true {
-			return fmt.Errorf("element not found for scrolling")
+		if err == nil {
+			err = fmt.Errorf("no selectors")
 		}
+		return fmt.Errorf("no element to scroll to found with %v: %v", selectors, err)
 	}
 
-	return err
+	if _, err := (*wd).ExecuteScript(scrollIntoViewScript, []interface{}{wdf}); err != nil {
+		return fmt.Errorf("failed to scroll to the element: %v", err)
+	}
+	return nil
 }
 
 func executeActionScrollByAmount(r *rules.ActionRule, wd *vdi.WebDriver) error {
@@ -442,6 +426,39 @@ func executeActionScrollByAmount(r *rules.ActionRule, wd *vdi.WebDriver) error {
 	return err
 }
 
+// executeActionAutoScroll is responsible for executing an "auto_scroll"
+// action: it scrolls an infinite-scroll page to its bottom until it stops
+// growing, so the whole feed is rendered before the extraction and the
+// screenshots.
+// rValue syntax is: "maxScrolls,waitInterval"
+// where waitInterval is how long (in seconds) to wait for new content after
+// each scroll (both are optional, the crawler max_scrolls and a 2 seconds
+// interval are used if omitted)
+func executeActionAutoScroll(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriver) error {
+	maxScrolls := ctx.config.Crawler.MaxScrolls
+	wait := scrollLoadTimeout
+	parts := strings.Split(r.GetValue(), ",")
+	if v := strings.TrimSpace(parts[0]); v != "" {
+		maxScrolls = cmn.StringToInt(v)
+	}
+	if len(parts) > 1 {
+		if v := strings.TrimSpace(parts[1]); v != "" {
+			secs, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid auto_scroll wait interval '%s': %v", v, err)
+			}
+			wait = time.Duration(secs * float64(time.Second))
+		}
+	}
+	if maxScrolls <= 0 {
+		return fmt.Errorf("invalid auto_scroll max scrolls '%s'", r.GetValue())
+	}
+
+	loads := scrollToBottom(wd, maxScrolls, wait)
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Auto-scrolled the page, %d scroll(s) loaded new content", loads)
+	return nil
+}
+
 // executeActionClick is responsible for executing a "click" action
 func executeActionClick(ctx *ProcessContext, r *rules.ActionRule, wd *vdi.WebDriver, button int) error {
 	var err error
@@ -0,0 +1,129 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestAutoScrollAction(t *testing.T) {
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.source = &cdb.Source{URL: "https://example.com"}
+	ctx.config.Crawler.MaxScrolls = 10
+
+	tests := []struct {
+		name    string
+		value   string
+		scrolls int // the scrolls that loaded new content
+		wantErr bool
+	}{
+		{"until the page stops growing", "", 2, false},
+		{"max scrolls", "1", 1, false},
+		{"max scrolls and wait interval", "1,0.05", 1, false},
+		{"wait interval only", ",0.05", 2, false},
+		{"invalid wait interval", "5,soon", 0, true},
+		{"invalid max scrolls", "0", 0, true},
+	}
+	for _, tt := range tests {
+		mock := newMockLazyWebDriver(t, "./test_data/lazy_links/catalog.html")
+		batches := len(mock.batches)
+		var wd vdi.WebDriver = mock
+		r := &rules.ActionRule{RuleName: "feed", ActionType: "auto_scroll", Value: tt.value}
+		err := executeActionRule(ctx, r, &wd)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if loaded := batches - len(mock.batches); loaded != tt.scrolls {
+			t.Errorf("%s: expected %d scroll(s) loading new content, got %d", tt.name, tt.scrolls, loaded)
+		}
+	}
+}
+
+// mockTallPageWebDriver simulates a tall page scrolled by scrollIntoView
+type mockTallPageWebDriver struct {
+	mockWebDriver
+	pageHeight int
+	viewport   int
+	scrollY    int
+}
+
+// mockPositionedElement is an element of a mockTallPageWebDriver page
+type mockPositionedElement struct {
+	mockWebElement
+	y, height int
+}
+
+func (m *mockTallPageWebDriver) ExecuteScript(script string, args []interface{}) (interface{}, error) {
+	if script == scrollIntoViewScript {
+		elem, ok := args[0].(*mockPositionedElement)
+		if !ok {
+			return nil, fmt.Errorf("scrollIntoView on an unknown element")
+		}
+		// block: 'center'
+		m.scrollY = elem.y + elem.height/2 - m.viewport/2
+		m.scrollY = max(0, min(m.scrollY, m.pageHeight-m.viewport))
+	}
+	return nil, nil
+}
+
+func TestScrollToElementAction(t *testing.T) {
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.source = &cdb.Source{URL: "https://example.com"}
+
+	footer := &mockPositionedElement{mockWebElement: mockWebElement{tag: "footer"}, y: 18000, height: 200}
+	mock := &mockTallPageWebDriver{
+		mockWebDriver: mockWebDriver{elements: map[string][]vdi.WebElement{"#comments": {footer}}},
+		pageHeight:    20000,
+		viewport:      800,
+	}
+	var wd vdi.WebDriver = mock
+
+	// The off-screen element is centered in the viewport
+	r := &rules.ActionRule{
+		RuleName:   "comments",
+		ActionType: "scroll_to_element",
+		Selectors:  []rules.Selector{{SelectorType: "css", Selector: "#comments"}},
+	}
+	if err := executeActionRule(ctx, r, &wd); err != nil {
+		t.Fatalf("executeActionRule returned an error: %v", err)
+	}
+	if top, bottom := footer.y-mock.scrollY, footer.y+footer.height-mock.scrollY; top != 300 || bottom != 500 {
+		t.Errorf("Expected the element centered in the viewport (300-500), got %d-%d (scrollY %d)", top, bottom, mock.scrollY)
+	}
+
+	// A missing element is an error, retried by the rule's error handling
+	mock.calls = nil
+	r = &rules.ActionRule{
+		RuleName:      "missing",
+		ActionType:    "scroll_to_element",
+		Selectors:     []rules.Selector{{SelectorType: "css", Selector: "#missing"}},
+		ErrorHandling: rules.ErrorHandling{RetryCount: 2},
+	}
+	err := executeActionRule(ctx, r, &wd)
+	if err == nil || !strings.Contains(err.Error(), "#missing") {
+		t.Errorf("Expected an error naming the missing element, got %v", err)
+	}
+	mock.calls = nil
+	executeRule(ctx, r, &wd)
+	if len(mock.calls) != 3 {
+		t.Errorf("Expected the missing element to be searched 3 times (2 retries), got %v", mock.calls)
+	}
+}
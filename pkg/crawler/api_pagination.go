@@ -0,0 +1,495 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	apiPageFetchTimeout = 30              // Timeout (in seconds) of the requests of the API pages
+	apiPageMaxSize      = 5 * 1024 * 1024 // API pages are read up to 5 MiB
+)
+
+// Known names of the pagination query parameters and response fields (in
+// preference order), used to detect the pagination of the captured APIs
+var (
+	apiCursorParams = []string{"cursor", "after", "page_token", "pageToken", "next_cursor", "starting_after", "continuation"}
+	apiCursorPaths  = []string{"next_cursor", "nextCursor", "cursor.next", "pagination.next_cursor", "pagination.nextCursor",
+		"meta.next_cursor", "meta.nextCursor", "paging.cursors.after", "next_page_token", "nextPageToken", "page_info.end_cursor", "pageInfo.endCursor"}
+	apiNextURLPaths = []string{"next", "links.next", "_links.next.href", "paging.next", "pagination.next", "meta.next"}
+	apiOffsetParams = []string{"offset", "skip", "start"}
+	apiLimitParams  = []string{"limit", "per_page", "page_size", "pageSize", "size", "count"}
+	apiPageParams   = []string{"page", "page_number", "pageNumber", "p"}
+	apiRecordsPaths = []string{"data", "results", "items", "records", "entries", "hits", "data.items", "data.results", "hits.hits"}
+)
+
+// apiPaginator is the (detected or configured) pagination of an API endpoint
+type apiPaginator struct {
+	mode        string // The pagination mode (cfg.APIPaginationCursor etc.)
+	param       string // The query parameter of the cursor, offset or page number
+	limitParam  string // The query parameter of the page size (offset mode)
+	cursorPath  string // The path of the next cursor (or next URL) in the responses
+	recordsPath string // The path of the records in the responses
+}
+
+// apiRecordsData returns the records of the paginated APIs called by a page
+// (see followAPIPagination) as scraped data, within the scraped data size
+// limits (empty if there are none or they exceed the limits)
+func (ctx *ProcessContext) apiRecordsData(pageURL string, requests []map[string]interface{}) map[string]interface{} {
+	records := ctx.followAPIPagination(requests)
+	if len(records) == 0 {
+		return nil
+	}
+	data := map[string]interface{}{"api_records": records}
+	ctx.limitScrapedData(pageURL, data)
+	return data
+}
+
+// followAPIPagination follows the pagination of the paginated JSON APIs
+// found in the captured requests (the GET requests with a JSON response),
+// each endpoint once per Source. It returns the records collected from every
+// endpoint (endpoint, pagination mode, number of pages and records).
+func (ctx *ProcessContext) followAPIPagination(requests []map[string]interface{}) []map[string]interface{} {
+	conf := ctx.config.Crawler.APIPagination
+	var collected []map[string]interface{}
+	for _, request := range requests {
+		method, _ := request["method"].(string)
+		body, ok := request["response_body"].(map[string]interface{})
+		if !ok || (method != "" && !strings.EqualFold(method, http.MethodGet)) {
+			continue
+		}
+		reqURL, _ := request["url"].(string)
+		pageURL, err := url.Parse(reqURL)
+		if err != nil || !pageURL.IsAbs() {
+			continue
+		}
+
+		paginator, ok := detectAPIPagination(pageURL, body, apiEndpointRule(conf.Endpoints, reqURL))
+		if !ok || !ctx.markAPIEndpoint(pageURL, paginator) {
+			continue
+		}
+		headers := apiRequestHeaders(request)
+		ctx.addSessionCookies(headers, pageURL)
+		records, pages := ctx.collectAPIRecords(pageURL, body, paginator, headers, conf.MaxPages)
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Collected %d records from %d pages of the API %s (%s pagination)", len(records), pages, reqURL, paginator.mode)
+		collected = append(collected, map[string]interface{}{
+			"endpoint": reqURL,
+			"mode":     paginator.mode,
+			"pages":    pages,
+			"records":  records,
+		})
+	}
+	return collected
+}
+
+// markAPIEndpoint records that the pagination of an API endpoint (its URL
+// without the pagination parameters) is followed. It returns false if it has
+// already been followed during the crawl of the Source.
+func (ctx *ProcessContext) markAPIEndpoint(pageURL *url.URL, paginator apiPaginator) bool {
+	endpoint := *pageURL
+	query := endpoint.Query()
+	query.Del(paginator.param)
+	endpoint.RawQuery = query.Encode()
+	endpoint.Fragment = ""
+	key := endpoint.String()
+
+	ctx.apiEndpointsMutex.Lock()
+	defer ctx.apiEndpointsMutex.Unlock()
+	if ctx.apiEndpoints[key] {
+		return false
+	}
+	if ctx.apiEndpoints == nil {
+		ctx.apiEndpoints = make(map[string]bool)
+	}
+	ctx.apiEndpoints[key] = true
+	return true
+}
+
+// collectAPIRecords collects the records of a paginated API, from its first
+// (captured) page to its last one, up to maxPages pages. The pages are
+// requested like the crawled pages: only if robots.txt allows them, waiting
+// the crawl delay between them. It returns the records and the number of
+// pages they have been collected from.
+func (ctx *ProcessContext) collectAPIRecords(pageURL *url.URL, body map[string]interface{}, paginator apiPaginator, headers map[string]string, maxPages int) ([]interface{}, int) {
+	records := apiRecords(body, paginator.recordsPath)
+	pages := 1
+	seen := map[string]bool{pageURL.String(): true}
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(apiPageFetchTimeout, "ignore"),
+		Timeout:   time.Duration(apiPageFetchTimeout) * time.Second,
+	}
+
+	for pages < maxPages {
+		if ctx.crawlCtx != nil && ctx.crawlCtx.Err() != nil {
+			break
+		}
+		nextURL, ok := paginator.nextPage(pageURL, body, len(apiRecords(body, paginator.recordsPath)))
+		if !ok || seen[nextURL.String()] {
+			break
+		}
+		seen[nextURL.String()] = true
+		if !ctx.robotsAllowed(nextURL.String()) {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "API pagination: the next page '%s' is disallowed by robots.txt", nextURL.Redacted())
+			break
+		}
+		if delay := getDelay(ctx); delay > 0 {
+			ctx.Status.LastDelay = delay
+			if !sleepWithContext(ctx.crawlCtx, time.Duration(delay*float64(time.Second))) {
+				break
+			}
+		}
+
+		next, err := fetchAPIPage(httpClient, nextURL.String(), headers)
+		if err != nil {
+			ctx.recordWarning("following the pagination of the API %s: %v", nextURL, err)
+			break
+		}
+		pageRecords := apiRecords(next, paginator.recordsPath)
+		if len(pageRecords) == 0 {
+			break
+		}
+		records = append(records, pageRecords...)
+		pages++
+		pageURL, body = nextURL, next
+	}
+	return records, pages
+}
+
+// fetchAPIPage requests a page of a JSON API (with the given request headers)
+func fetchAPIPage(httpClient *http.Client, pageURL string, headers map[string]string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, apiPageMaxSize))
+	if err != nil {
+		return nil, err
+	}
+	var page map[string]interface{}
+	if err := json.Unmarshal(content, &page); err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %v", err)
+	}
+	return page, nil
+}
+
+// apiRequestHeaders returns the headers of a captured request replayed with
+// the requests of the next pages (the ones describing its body aren't)
+func apiRequestHeaders(request map[string]interface{}) map[string]string {
+	captured, _ := request["headers"].(map[string]interface{})
+	headers := make(map[string]string, len(captured))
+	for name, value := range captured {
+		str, ok := value.(string)
+		if !ok || strings.HasPrefix(name, ":") {
+			continue // e.g. HTTP/2 pseudo-headers
+		}
+		switch strings.ToLower(name) {
+		case "host", "content-length", "content-type", "accept-encoding", "connection":
+			continue
+		}
+		headers[name] = str
+	}
+	return headers
+}
+
+// addSessionCookies adds the cookies of the VDI session matching an API URL to
+// the headers replayed with the requests of its next pages: the captured
+// request headers don't include them, and the authenticated APIs need them.
+// The headers already carrying cookies are left as they are.
+func (ctx *ProcessContext) addSessionCookies(headers map[string]string, apiURL *url.URL) {
+	for name := range headers {
+		if strings.EqualFold(name, "Cookie") {
+			return
+		}
+	}
+	if ctx.wd == nil {
+		return
+	}
+	cookies, err := ctx.wd.GetCookies()
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "API pagination: retrieving the VDI session cookies: %v", err)
+		return
+	}
+
+	host := strings.ToLower(apiURL.Hostname())
+	path := apiURL.EscapedPath()
+	var pairs []string
+	for _, cookie := range cookies {
+		domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+		if domain != "" && host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		if cookie.Path != "" && !strings.HasPrefix(path, cookie.Path) {
+			continue
+		}
+		if cookie.Secure && apiURL.Scheme != "https" {
+			continue
+		}
+		pairs = append(pairs, cookie.Name+"="+cookie.Value)
+	}
+	if len(pairs) > 0 {
+		headers["Cookie"] = strings.Join(pairs, "; ")
+	}
+}
+
+// apiEndpointRule returns the first API endpoint rule matching the URL (nil
+// if none does)
+func apiEndpointRule(endpoints []cfg.APIEndpoint, reqURL string) *cfg.APIEndpoint {
+	for i := range endpoints {
+		re, err := wildcardRegexp(endpoints[i].URLPattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Invalid API endpoint url_pattern '%s': %v", endpoints[i].URLPattern, err)
+			continue
+		}
+		if re.MatchString(reqURL) {
+			return &endpoints[i]
+		}
+	}
+	return nil
+}
+
+// detectAPIPagination returns the pagination of an API page (its URL and its
+// JSON response): the one configured by its endpoint rule (if any), with the
+// missing settings detected from the known pagination parameters and fields.
+// It returns false if the page isn't a page of a paginated list of records.
+func detectAPIPagination(pageURL *url.URL, body map[string]interface{}, rule *cfg.APIEndpoint) (apiPaginator, bool) {
+	var p apiPaginator
+	if rule != nil {
+		if rule.Mode == cfg.APIPaginationNone {
+			return p, false
+		}
+		p = apiPaginator{mode: rule.Mode, param: rule.Param, limitParam: rule.LimitParam, cursorPath: rule.CursorPath, recordsPath: rule.RecordsPath}
+	}
+	if p.recordsPath == "" {
+		p.recordsPath = detectRecordsPath(body)
+	}
+	if p.recordsPath == "" || apiRecords(body, p.recordsPath) == nil {
+		return p, false
+	}
+
+	query := pageURL.Query()
+	if p.mode == "" || p.mode == cfg.APIPaginationCursor {
+		if p.cursorPath == "" {
+			p.cursorPath = firstJSONPath(body, apiCursorPaths, isCursorValue)
+		}
+		if p.cursorPath != "" {
+			p.mode = cfg.APIPaginationCursor
+			if p.param == "" {
+				p.param = firstQueryParam(query, apiCursorParams, "cursor")
+			}
+			return p, true
+		}
+	}
+	if p.mode == "" || p.mode == cfg.APIPaginationNextURL {
+		if p.cursorPath == "" {
+			p.cursorPath = firstJSONPath(body, apiNextURLPaths, isNextURLValue)
+		}
+		if p.cursorPath != "" {
+			p.mode = cfg.APIPaginationNextURL
+			return p, true
+		}
+	}
+	if p.mode == "" || p.mode == cfg.APIPaginationOffset {
+		if p.param == "" {
+			p.param = firstQueryParam(query, apiOffsetParams, "")
+		}
+		if p.param != "" && p.limitParam == "" {
+			p.limitParam = firstQueryParam(query, apiLimitParams, "")
+		}
+		if p.param != "" {
+			p.mode = cfg.APIPaginationOffset
+			return p, true
+		}
+	}
+	if p.mode == "" || p.mode == cfg.APIPaginationPage {
+		if p.param == "" {
+			p.param = firstQueryParam(query, apiPageParams, "")
+		}
+		if p.param != "" {
+			p.mode = cfg.APIPaginationPage
+			return p, true
+		}
+	}
+	return p, false
+}
+
+// nextPage returns the URL of the page following an API page (with count
+// records), false if it's the last page. The next page URLs of other origins
+// aren't followed (the requests carry the headers of the page requests, with
+// their credentials).
+func (p apiPaginator) nextPage(pageURL *url.URL, body map[string]interface{}, count int) (*url.URL, bool) {
+	if count == 0 {
+		return nil, false
+	}
+	query := pageURL.Query()
+	switch p.mode {
+	case cfg.APIPaginationCursor:
+		cursor, ok := jsonScalar(jsonPathValue(body, p.cursorPath))
+		if !ok || cursor == "" {
+			return nil, false
+		}
+		query.Set(p.param, cursor)
+	case cfg.APIPaginationNextURL:
+		next, ok := jsonPathValue(body, p.cursorPath).(string)
+		if !ok || strings.TrimSpace(next) == "" {
+			return nil, false
+		}
+		ref, err := url.Parse(strings.TrimSpace(next))
+		if err != nil {
+			return nil, false
+		}
+		nextURL := pageURL.ResolveReference(ref)
+		if !strings.EqualFold(nextURL.Scheme, pageURL.Scheme) || !strings.EqualFold(nextURL.Host, pageURL.Host) {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "API pagination: not following the next page '%s' of another origin than '%s'", nextURL.Redacted(), pageURL.Redacted())
+			return nil, false
+		}
+		return nextURL, true
+	case cfg.APIPaginationOffset:
+		offset, _ := strconv.Atoi(query.Get(p.param))
+		step := count
+		if limit, err := strconv.Atoi(query.Get(p.limitParam)); err == nil && limit > 0 {
+			if count < limit {
+				return nil, false // A partial page is the last one
+			}
+			step = limit
+		}
+		query.Set(p.param, strconv.Itoa(offset+step))
+	case cfg.APIPaginationPage:
+		page, err := strconv.Atoi(query.Get(p.param))
+		if err != nil {
+			page = 1 // The first page doesn't always have a page number
+		}
+		query.Set(p.param, strconv.Itoa(page+1))
+	default:
+		return nil, false
+	}
+	next := *pageURL
+	next.RawQuery = query.Encode()
+	return &next, true
+}
+
+// detectRecordsPath returns the path of the records of an API page: the
+// first known records field that is an array, or the only array field of the
+// response (empty if it has no records)
+func detectRecordsPath(body map[string]interface{}) string {
+	for _, path := range apiRecordsPaths {
+		if _, ok := jsonPathValue(body, path).([]interface{}); ok {
+			return path
+		}
+	}
+	path := ""
+	for key, value := range body {
+		if _, ok := value.([]interface{}); ok {
+			if path != "" {
+				return "" // Ambiguous
+			}
+			path = key
+		}
+	}
+	return path
+}
+
+// apiRecords returns the records of an API page (nil if it has none)
+func apiRecords(body map[string]interface{}, path string) []interface{} {
+	records, _ := jsonPathValue(body, path).([]interface{})
+	return records
+}
+
+// jsonPathValue returns the value of a path (dot notation) of a JSON object
+// (nil if it doesn't have it)
+func jsonPathValue(data map[string]interface{}, path string) interface{} {
+	var value interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if value, ok = obj[key]; !ok {
+			return nil
+		}
+	}
+	return value
+}
+
+// firstJSONPath returns the first of the paths whose value is valid (empty
+// if none is)
+func firstJSONPath(data map[string]interface{}, paths []string, valid func(interface{}) bool) string {
+	for _, path := range paths {
+		if valid(jsonPathValue(data, path)) {
+			return path
+		}
+	}
+	return ""
+}
+
+// firstQueryParam returns the first of the query parameters the query has
+// (def if it has none of them)
+func firstQueryParam(query url.Values, params []string, def string) string {
+	for _, param := range params {
+		if query.Has(param) {
+			return param
+		}
+	}
+	return def
+}
+
+// isCursorValue returns true if the value is a (non empty) cursor
+func isCursorValue(value interface{}) bool {
+	cursor, ok := jsonScalar(value)
+	return ok && cursor != "" && !strings.Contains(cursor, "://")
+}
+
+// isNextURLValue returns true if the value is the URL of a page
+func isNextURLValue(value interface{}) bool {
+	next, ok := value.(string)
+	next = strings.TrimSpace(next)
+	return ok && (strings.HasPrefix(next, "http://") || strings.HasPrefix(next, "https://") || strings.HasPrefix(next, "/") || strings.HasPrefix(next, "?"))
+}
+
+// jsonScalar returns a JSON string or number as a string (the captured
+// responses have their numeric strings converted to numbers)
+func jsonScalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestFollowAPIPagination(t *testing.T) {
+	pages := map[string]string{"": "page1.json", "b2Zmc2V0PTI": "page2.json", "b2Zmc2V0PTQ": "page3.json"}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			_, _ = w.Write([]byte("User-agent: *\nDisallow: /api/orders\n"))
+			return
+		}
+		requests = append(requests, r.URL.RawQuery)
+		page, ok := pages[r.URL.Query().Get("cursor")]
+		if r.URL.Path != "/api/products" || !ok || r.Header.Get("Authorization") != "Bearer token" || r.Header.Get("Cookie") != "session=abc" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "./test_data/api_pagination/"+page)
+	}))
+	defer server.Close()
+
+	// The first page, as captured by collect_xhr
+	first, err := os.ReadFile("./test_data/api_pagination/page1.json")
+	if err != nil {
+		t.Fatalf("Failed to read the test fixture: %v", err)
+	}
+	body, _ := decodeBodyContent(string(first), false)
+	captured := []map[string]interface{}{{
+		"url":           server.URL + "/api/products?limit=2",
+		"method":        "GET",
+		"headers":       map[string]interface{}{"Authorization": "Bearer token", "Host": "ignored"},
+		"response_body": body,
+	}}
+
+	// The session cookies of the API host are sent with the next pages
+	var wd vdi.WebDriver = &cookiesWebDriver{cookies: []vdi.Cookie{
+		{Name: "session", Value: "abc", Domain: "127.0.0.1", Path: "/"},
+		{Name: "tracker", Value: "xyz", Domain: ".example.org", Path: "/"},
+		{Name: "secure", Value: "123", Domain: "127.0.0.1", Path: "/", Secure: true},
+	}}
+	source := &cdb.Source{ID: 1, URL: server.URL}
+	ctx := &ProcessContext{config: *cfg.NewConfig(), Status: &Status{}, source: source, wd: wd}
+	ctx.config.Crawler.APIPagination.MaxPages = 10
+	ctx.config.Crawler.CheckForRobots = true
+	ctx.config.Crawler.Delay = "0.1"
+	start := time.Now()
+	collected := ctx.followAPIPagination(captured)
+	if len(collected) != 1 {
+		t.Fatalf("Expected the records of 1 API, got %v", collected)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected the crawl delay between the API pages, it took %v", elapsed)
+	}
+	records, _ := collected[0]["records"].([]interface{})
+	if len(records) != 5 || collected[0]["pages"] != 3 || collected[0]["mode"] != cfg.APIPaginationCursor {
+		t.Errorf("Expected 5 records from 3 pages (cursor pagination), got %d from %v (%v)", len(records), collected[0]["pages"], collected[0]["mode"])
+	}
+	for i, record := range records {
+		if id, _ := record.(map[string]interface{})["id"].(float64); int(id) != i+1 {
+			t.Errorf("Expected record %d to have id %d, got %v", i, i+1, record)
+		}
+	}
+	if !reflect.DeepEqual(requests, []string{"cursor=b2Zmc2V0PTI&limit=2", "cursor=b2Zmc2V0PTQ&limit=2"}) {
+		t.Errorf("Unexpected API requests: %v", requests)
+	}
+
+	// An endpoint is followed once per Source
+	if collected := ctx.followAPIPagination(captured); len(collected) != 0 {
+		t.Errorf("Expected the API to be followed once, got %v", collected)
+	}
+
+	// The pages disallowed by robots.txt aren't requested
+	requests = nil
+	orders := []map[string]interface{}{{
+		"url":           server.URL + "/api/orders?limit=2",
+		"method":        "GET",
+		"response_body": body,
+	}}
+	collected = ctx.followAPIPagination(orders)
+	if len(collected) != 1 || collected[0]["pages"] != 1 || len(requests) != 0 {
+		t.Errorf("Expected only the captured page of the disallowed API, got %v (requests %v)", collected, requests)
+	}
+
+	// The endpoint rules can disable the endpoints
+	ctx = &ProcessContext{config: *cfg.NewConfig(), Status: &Status{}, source: source}
+	ctx.config.Crawler.APIPagination.Endpoints = []cfg.APIEndpoint{{URLPattern: server.URL + "/api/*", Mode: cfg.APIPaginationNone}}
+	if collected := ctx.followAPIPagination(captured); len(collected) != 0 {
+		t.Errorf("Expected the disabled API not to be followed, got %v", collected)
+	}
+
+	// The API records are within the scraped data size limits
+	ctx = &ProcessContext{config: *cfg.NewConfig(), Status: &Status{}, source: source, wd: wd}
+	ctx.config.Crawler.MaxScrapedSourceSize = 64
+	if data := ctx.apiRecordsData(server.URL+"/products", captured); len(data) != 0 {
+		t.Errorf("Expected the API records exceeding max_scraped_source_size to be dropped, got %v", data)
+	}
+	if !strings.Contains(ctx.Status.LastWarning, "max_scraped_source_size") {
+		t.Errorf("Expected the dropped API records to be recorded, got %q", ctx.Status.LastWarning)
+	}
+}
+
+// cookiesWebDriver is a WebDriver whose session has the given cookies
+type cookiesWebDriver struct {
+	vdi.WebDriver
+	cookies []vdi.Cookie
+}
+
+func (d *cookiesWebDriver) GetCookies() ([]vdi.Cookie, error) {
+	return d.cookies, nil
+}
+
+func TestDetectAPIPagination(t *testing.T) {
+	tests := []struct {
+		url      string
+		body     string
+		rule     *cfg.APIEndpoint
+		mode     string
+		expected string // The URL of the next page
+	}{
+		{"https://api.example.com/items", `{"items":[1,2],"nextPageToken":"abc"}`, nil, cfg.APIPaginationCursor, "https://api.example.com/items?cursor=abc"},
+		{"https://api.example.com/items?after=x", `{"results":[1],"paging":{"cursors":{"after":"y"}}}`, nil, cfg.APIPaginationCursor, "https://api.example.com/items?after=y"},
+		{"https://api.example.com/items", `{"results":[1],"next":"/items?page=2"}`, nil, cfg.APIPaginationNextURL, "https://api.example.com/items?page=2"},
+		// The next pages of other origins aren't followed
+		{"https://api.example.com/items", `{"results":[1],"next":"https://tracker.example.org/items?page=2"}`, nil, cfg.APIPaginationNextURL, ""},
+		{"https://api.example.com/items", `{"results":[1],"next":"http://api.example.com/items?page=2"}`, nil, cfg.APIPaginationNextURL, ""},
+		{"https://api.example.com/items?offset=0&limit=2", `{"records":[1,2]}`, nil, cfg.APIPaginationOffset, "https://api.example.com/items?limit=2&offset=2"},
+		{"https://api.example.com/items?page=3", `{"data":[1]}`, nil, cfg.APIPaginationPage, "https://api.example.com/items?page=4"},
+		{"https://api.example.com/items", `{"list":[1],"more":"tok"}`, &cfg.APIEndpoint{Mode: cfg.APIPaginationCursor, Param: "token", CursorPath: "more"}, cfg.APIPaginationCursor, "https://api.example.com/items?token=tok"},
+		// Not paginated
+		{"https://api.example.com/user", `{"name":"John","roles":[1]}`, nil, "", ""},
+		{"https://api.example.com/items?offset=0&limit=2", `{"records":[1]}`, nil, cfg.APIPaginationOffset, ""},
+	}
+	for _, test := range tests {
+		pageURL, _ := url.Parse(test.url)
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(test.body), &body); err != nil {
+			t.Fatalf("Invalid test body %s: %v", test.body, err)
+		}
+		paginator, ok := detectAPIPagination(pageURL, body, test.rule)
+		if paginator.mode != test.mode && ok {
+			t.Errorf("detectAPIPagination(%s, %s) mode = %q, want %q", test.url, test.body, paginator.mode, test.mode)
+		}
+		if !ok {
+			if test.mode != "" {
+				t.Errorf("detectAPIPagination(%s, %s) = not paginated, want %q", test.url, test.body, test.mode)
+			}
+			continue
+		}
+		next, ok := paginator.nextPage(pageURL, body, len(apiRecords(body, paginator.recordsPath)))
+		got := ""
+		if ok {
+			got = next.String()
+		}
+		if got != test.expected {
+			t.Errorf("nextPage(%s, %s) = %q, want %q", test.url, test.body, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const breadcrumbMaxLength = 255 // Maximum length of a breadcrumb (longer ones aren't breadcrumbs)
+
+// Breadcrumb trails markup, in preference order
+var breadcrumbSelectors = []string{
+	"[itemtype$='schema.org/BreadcrumbList']",
+	"nav[aria-label*='breadcrumb' i]",
+	"[role='navigation'][aria-label*='breadcrumb' i]",
+	"ol.breadcrumb, ul.breadcrumb, .breadcrumbs, .breadcrumb",
+}
+
+// breadcrumbSeparators are the separators found between the breadcrumbs
+// (when they are part of the trail text)
+const breadcrumbSeparators = " >/»›→|·•"
+
+// extractBreadcrumbs returns the breadcrumb trail of a page (from the site
+// root to the page), nil if the page has none. The schema.org BreadcrumbList
+// in JSON-LD is preferred to the breadcrumb navigation markup.
+func extractBreadcrumbs(doc *goquery.Document) []string {
+	if trail := jsonLDBreadcrumbs(doc); len(trail) > 0 {
+		return trail
+	}
+	for _, selector := range breadcrumbSelectors {
+		if trail := markupBreadcrumbs(doc.Find(selector).First()); len(trail) > 0 {
+			return trail
+		}
+	}
+	return nil
+}
+
+// jsonLDBreadcrumbs returns the breadcrumb trail of the first JSON-LD
+// BreadcrumbList (including the @graph ones), ordered by position
+func jsonLDBreadcrumbs(doc *goquery.Document) []string {
+	var trail []string
+	doc.Find("script[type='application/ld+json']").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &data); err != nil {
+			return true
+		}
+		walkJSONLD(data, func(obj map[string]interface{}) {
+			if len(trail) == 0 && jsonLDHasType(obj, "BreadcrumbList") {
+				trail = breadcrumbListItems(obj)
+			}
+		})
+		return len(trail) == 0
+	})
+	return trail
+}
+
+// jsonLDHasType returns true if the JSON-LD object has the given @type
+func jsonLDHasType(obj map[string]interface{}, typ string) bool {
+	switch t := obj["@type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// breadcrumbListItems returns the names of the items of a JSON-LD
+// BreadcrumbList, ordered by position
+func breadcrumbListItems(list map[string]interface{}) []string {
+	elements, ok := list["itemListElement"].([]interface{})
+	if !ok {
+		return nil
+	}
+	type item struct {
+		position float64
+		name     string
+	}
+	var items []item
+	for i, element := range elements {
+		obj, ok := element.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := obj["name"].(string)
+		if nested, ok := obj["item"].(map[string]interface{}); ok && name == "" {
+			name, _ = nested["name"].(string)
+		}
+		position, ok := obj["position"].(float64)
+		if !ok {
+			position = float64(i + 1)
+		}
+		if name = cleanBreadcrumb(name); name != "" {
+			items = append(items, item{position, name})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].position < items[j].position })
+
+	trail := make([]string, 0, len(items))
+	for _, it := range items {
+		trail = append(trail, it.name)
+	}
+	return trail
+}
+
+// markupBreadcrumbs returns the breadcrumb trail of a breadcrumb navigation
+// element: the text of its list items (or of its links, if it has no list)
+func markupBreadcrumbs(nav *goquery.Selection) []string {
+	if nav.Length() == 0 {
+		return nil
+	}
+	items := nav.Find("[itemprop='itemListElement']")
+	if items.Length() == 0 {
+		items = nav.Find("li")
+	}
+	if items.Length() == 0 {
+		items = nav.Find("a, [aria-current='page']")
+	}
+
+	var trail []string
+	items.Each(func(_ int, s *goquery.Selection) {
+		name := s.Find("[itemprop='name']").First().Text()
+		if name == "" {
+			name = s.Text()
+		}
+		if name = cleanBreadcrumb(name); name != "" {
+			trail = append(trail, name)
+		}
+	})
+	return trail
+}
+
+// cleanBreadcrumb returns the breadcrumb text without extra whitespace and
+// separators, empty if it isn't a breadcrumb
+func cleanBreadcrumb(name string) string {
+	name = strings.Trim(strings.Join(strings.Fields(name), " "), breadcrumbSeparators)
+	if len(name) > breadcrumbMaxLength {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractBreadcrumbs(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		expected []string
+	}{
+		{"jsonld.html", []string{"Home", "Shoes", "Running shoes"}}, // JSON-LD first (ordered by position)
+		{"nav.html", []string{"Docs", "Guides", "Installation"}},    // <nav aria-label="Breadcrumb"> list
+		{"microdata.html", []string{"News", "Politics"}},            // schema.org microdata
+		{"links.html", []string{"Home", "Company", "Contact"}},      // Links with separators
+		{"none.html", nil},
+	}
+	for _, tt := range tests {
+		html, err := os.ReadFile("./test_data/breadcrumbs/" + tt.fixture)
+		if err != nil {
+			t.Fatalf("Failed to read the %s fixture: %v", tt.fixture, err)
+		}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(html)))
+		if err != nil {
+			t.Fatalf("%s: parsing HTML: %v", tt.fixture, err)
+		}
+		if got := extractBreadcrumbs(doc); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: expected breadcrumbs %q, got %q", tt.fixture, tt.expected, got)
+		}
+	}
+}
@@ -112,6 +112,9 @@ func FindElementByType(ctx *ProcessContext, wd *vdi.WebDriver, selector rules.Se
 	if element == nil {
 		return element, fmt.Errorf("element '%s' Not found", selector.Selector)
 	}
+	if ctx != nil {
+		ctx.trace.element(selector, element)
+	}
 
 	return element, nil
 }
@@ -278,23 +281,136 @@ func matchValue(ctx *ProcessContext, item interface{}, selector rules.Selector)
 func WaitForCondition(ctx *ProcessContext, wd *vdi.WebDriver, r rs.WaitCondition) error {
 	// Execute the wait condition
 	switch strings.ToLower(strings.TrimSpace(r.ConditionType)) {
-	case "element":
-		return nil
+	case "element", "element_presence":
+		return waitForElement(ctx, wd, r, false)
+	case "element_visible":
+		return waitForElement(ctx, wd, r, true)
 	case "delay":
-		delay := exi.GetFloat(r.Value)
-		if delay > 0 {
-			time.Sleep(time.Duration(delay) * time.Second)
+		delay := exi.GetFloatWithRand(r.Value, ctx.rng)
+		if delay > 0 && !sleepWithContext(ctx.crawlCtx, time.Duration(delay*float64(time.Second))) {
+			return fmt.Errorf("waiting for a %vs delay: crawl cancelled", delay)
 		}
 		return nil
 	case strPluginCall:
-		plugin, exists := ctx.re.JSPlugins.GetPlugin(r.Value)
-		if !exists {
-			return fmt.Errorf("plugin not found: %s", r.Value)
-		}
-		pluginCode := plugin.String()
-		_, err := (*wd).ExecuteScript(pluginCode, nil)
-		return err
+		return waitForPlugin(ctx, wd, r)
 	default:
 		return fmt.Errorf("wait condition not supported: %s", r.ConditionType)
 	}
 }
+
+// Polling of the element wait conditions
+var (
+	elementWaitPollInterval = 250 * time.Millisecond
+	elementWaitTimeout      = 10 * time.Second // Used when the wait condition has no timeout
+)
+
+// waitForElement polls the page until the element of an element wait
+// condition is present (and displayed, if visible is true), or the condition
+// timeout expires. The selector is a CSS one if it has no selector_type.
+// The wait stops if the crawl is cancelled.
+func waitForElement(ctx *ProcessContext, wd *vdi.WebDriver, r rs.WaitCondition, visible bool) error {
+	selector := r.Selector
+	if strings.TrimSpace(selector.Selector) == "" {
+		return fmt.Errorf("wait condition %s without a selector", r.ConditionType)
+	}
+	if strings.TrimSpace(selector.SelectorType) == "" {
+		selector.SelectorType = strCSS
+	}
+
+	timeout := elementWaitTimeout
+	if r.Timeout > 0 {
+		timeout = time.Duration(r.Timeout) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		element, err := FindElementByType(ctx, wd, selector)
+		if err == nil && element != nil {
+			if !visible {
+				return nil
+			}
+			if displayed, err := element.IsDisplayed(); err == nil && displayed {
+				return nil
+			}
+		}
+		if time.Now().Add(elementWaitPollInterval).After(deadline) {
+			if visible {
+				return fmt.Errorf("element '%s' not visible after %v", selector.Selector, timeout)
+			}
+			return fmt.Errorf("element '%s' not found after %v", selector.Selector, timeout)
+		}
+		if !sleepWithContext(ctx.crawlCtx, elementWaitPollInterval) {
+			return fmt.Errorf("waiting for element '%s': crawl cancelled", selector.Selector)
+		}
+	}
+}
+
+// Polling of the plugin_call wait conditions
+var (
+	pluginWaitPollInterval = 250 * time.Millisecond
+	pluginWaitTimeout      = 10 * time.Second // Used when the wait condition has no timeout
+)
+
+// waitForPlugin runs the plugin of a plugin_call wait condition until it
+// reports that the page is ready, or the condition timeout expires. The
+// plugin reports its readiness returning true (or false), or a status object
+// with a "ready" field (and an optional "status" describing it). A plugin
+// returning anything else is run once (it's waited for as a side effect).
+// The wait stops if the crawl is cancelled.
+func waitForPlugin(ctx *ProcessContext, wd *vdi.WebDriver, r rs.WaitCondition) error {
+	name := strings.TrimSpace(r.Value)
+	if name == "" {
+		name = strings.TrimSpace(r.Selector.Selector)
+	}
+	plugin, exists := ctx.re.JSPlugins.GetPlugin(name)
+	if !exists {
+		return fmt.Errorf("plugin not found: %s", name)
+	}
+	pluginCode := plugin.String()
+
+	timeout := pluginWaitTimeout
+	if r.Timeout > 0 {
+		timeout = time.Duration(r.Timeout) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := (*wd).ExecuteScript(pluginCode, nil)
+		if err != nil {
+			return err
+		}
+		ready, status := pluginWaitStatus(result)
+		if ready {
+			return nil
+		}
+		if time.Now().Add(pluginWaitPollInterval).After(deadline) {
+			if status != "" {
+				return fmt.Errorf("plugin %s not ready after %v: %s", name, timeout, status)
+			}
+			return fmt.Errorf("plugin %s not ready after %v", name, timeout)
+		}
+		cmn.DebugMsg(cmn.DbgLvlDebug5, "Waiting for plugin %s to be ready: %s", name, status)
+		if !sleepWithContext(ctx.crawlCtx, pluginWaitPollInterval) {
+			return fmt.Errorf("waiting for plugin %s: crawl cancelled", name)
+		}
+	}
+}
+
+// pluginWaitStatus returns the readiness (and its status description, if
+// any) reported by a plugin_call wait condition plugin. Only a false result
+// (or a status object with a false "ready") isn't ready: the plugins
+// returning anything else (e.g. a string, a number, an object without
+// "ready") are waited for as a side effect.
+func pluginWaitStatus(result interface{}) (bool, string) {
+	switch v := result.(type) {
+	case bool:
+		return v, ""
+	case map[string]interface{}:
+		status, _ := v["status"].(string)
+		ready, ok := v["ready"].(bool)
+		if !ok {
+			return true, status
+		}
+		return ready, status
+	default:
+		return true, ""
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	plg "github.com/pzaino/thecrowler/pkg/plugin"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// readinessWebDriver is a WebDriver whose scripts report the page as ready
+// (with a status object) after a delay
+type readinessWebDriver struct {
+	vdi.WebDriver
+	readyAt time.Time
+	calls   int
+}
+
+func (d *readinessWebDriver) ExecuteScript(string, []interface{}) (interface{}, error) {
+	d.calls++
+	ready := !time.Now().Before(d.readyAt)
+	return map[string]interface{}{"ready": ready, "status": fmt.Sprintf("ready: %t", ready)}, nil
+}
+
+func TestWaitForPluginCondition(t *testing.T) {
+	savedInterval := pluginWaitPollInterval
+	pluginWaitPollInterval = 10 * time.Millisecond
+	defer func() { pluginWaitPollInterval = savedInterval }()
+
+	re := &rules.RuleEngine{}
+	re.JSPlugins.Register("page_ready", *plg.NewJSPlugin("return {ready: window.appReady === true};"))
+	ctx := &ProcessContext{re: re, Status: &Status{}}
+	condition := rules.WaitCondition{ConditionType: strPluginCall, Value: "page_ready", Timeout: 5}
+
+	// The wait resolves once the plugin reports the page as ready (in both
+	// the action and the scraping paths)
+	for _, wait := range []func(*vdi.WebDriver) error{
+		func(wd *vdi.WebDriver) error { return WaitForCondition(ctx, wd, condition) },
+		func(wd *vdi.WebDriver) error { return executeWaitConditions(ctx, []rules.WaitCondition{condition}, wd) },
+	} {
+		start := time.Now()
+		driver := &readinessWebDriver{readyAt: start.Add(100 * time.Millisecond)}
+		var wd vdi.WebDriver = driver
+		if err := wait(&wd); err != nil {
+			t.Fatalf("Expected the wait to resolve, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 2*time.Second {
+			t.Errorf("Expected the wait to resolve when the plugin is ready, it took %v", elapsed)
+		}
+		if driver.calls < 2 {
+			t.Errorf("Expected the plugin to be polled, it ran %d times", driver.calls)
+		}
+	}
+
+	// The wait times out if the plugin never reports the page as ready
+	condition.Timeout = 1
+	var wd vdi.WebDriver = &readinessWebDriver{readyAt: time.Now().Add(time.Hour)}
+	err := WaitForCondition(ctx, &wd, condition)
+	if err == nil || !strings.Contains(err.Error(), "not ready") || !strings.Contains(err.Error(), "ready: false") {
+		t.Errorf("Expected a timeout error with the plugin status, got %v", err)
+	}
+
+	// The wait stops when the crawl is cancelled
+	crawlCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx.crawlCtx = crawlCtx
+	condition.Timeout = 60
+	start := time.Now()
+	if err := WaitForCondition(ctx, &wd, condition); err == nil || time.Since(start) > 2*time.Second {
+		t.Errorf("Expected the wait to stop on the crawl cancellation, got %v after %v", err, time.Since(start))
+	}
+
+	// The plugins returning a boolean, a status object, or anything else
+	for _, tt := range []struct {
+		result interface{}
+		ready  bool
+	}{
+		{true, true}, {false, false}, {nil, true},
+		{"yes", true}, {float64(42), true},
+		{map[string]interface{}{"status": "done"}, true},
+		{map[string]interface{}{"ready": false, "status": "loading"}, false},
+	} {
+		if ready, _ := pluginWaitStatus(tt.result); ready != tt.ready {
+			t.Errorf("pluginWaitStatus(%v) = %t, want %t", tt.result, ready, tt.ready)
+		}
+	}
+}
+
+// lateElementWebDriver is a mockWebDriver whose element is rendered (and
+// displayed) after a delay
+type lateElementWebDriver struct {
+	mockWebDriver
+	element     *mockDisplayedElement
+	renderedAt  time.Time
+	displayedAt time.Time
+	finds       int
+}
+
+// mockDisplayedElement is a mockWebElement that may be hidden
+type mockDisplayedElement struct {
+	mockWebElement
+	driver *lateElementWebDriver
+}
+
+func (e *mockDisplayedElement) IsDisplayed() (bool, error) {
+	return !time.Now().Before(e.driver.displayedAt), nil
+}
+
+func (d *lateElementWebDriver) FindElements(_, value string) ([]vdi.WebElement, error) {
+	d.finds++
+	if value != "#results" || time.Now().Before(d.renderedAt) {
+		return nil, nil
+	}
+	return []vdi.WebElement{d.element}, nil
+}
+
+func TestWaitForElementCondition(t *testing.T) {
+	savedInterval := elementWaitPollInterval
+	elementWaitPollInterval = 10 * time.Millisecond
+	defer func() { elementWaitPollInterval = savedInterval }()
+
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	newDriver := func(rendered, displayed time.Duration) *lateElementWebDriver {
+		now := time.Now()
+		d := &lateElementWebDriver{renderedAt: now.Add(rendered), displayedAt: now.Add(displayed)}
+		d.element = &mockDisplayedElement{mockWebElement: mockWebElement{tag: "div"}, driver: d}
+		return d
+	}
+	results := rules.Selector{Selector: "#results"} // a CSS selector by default
+
+	tests := []struct {
+		name      string
+		condition rules.WaitCondition
+		displayed time.Duration
+		wantErr   string
+	}{
+		{"element", rules.WaitCondition{ConditionType: "element", Selector: results, Timeout: 5}, 0, ""},
+		{"element presence", rules.WaitCondition{ConditionType: "element_presence", Selector: results, Timeout: 5}, time.Hour, ""},
+		{"element visible", rules.WaitCondition{ConditionType: "element_visible", Selector: results, Timeout: 5}, 200 * time.Millisecond, ""},
+		{"element never visible", rules.WaitCondition{ConditionType: "element_visible", Selector: results, Timeout: 1}, time.Hour, "not visible"},
+		{"element never rendered", rules.WaitCondition{ConditionType: "element", Selector: rules.Selector{Selector: "#missing"}, Timeout: 1}, 0, "not found"},
+		{"no selector", rules.WaitCondition{ConditionType: "element"}, 0, "without a selector"},
+	}
+	for _, tt := range tests {
+		// The element is rendered after 100ms
+		start := time.Now()
+		driver := newDriver(100*time.Millisecond, tt.displayed)
+		var wd vdi.WebDriver = driver
+		err := WaitForCondition(ctx, &wd, tt.condition)
+		elapsed := time.Since(start)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: expected the wait to resolve, got %v", tt.name, err)
+		}
+		if elapsed < 100*time.Millisecond || elapsed > 2*time.Second || driver.finds < 2 {
+			t.Errorf("%s: expected the page to be polled until the element is ready, it took %v (%d finds)", tt.name, elapsed, driver.finds)
+		}
+	}
+
+	// The delay condition waits for the (fractional) seconds of its value
+	start := time.Now()
+	var wd vdi.WebDriver = newDriver(0, 0)
+	if err := WaitForCondition(ctx, &wd, rules.WaitCondition{ConditionType: "delay", Value: "0.2"}); err != nil {
+		t.Fatalf("delay: unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("delay: expected a 200ms wait, it took %v", elapsed)
+	}
+
+	// The waits stop when the crawl is cancelled
+	crawlCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx.crawlCtx = crawlCtx
+	for _, condition := range []rules.WaitCondition{
+		{ConditionType: "element", Selector: rules.Selector{Selector: "#missing"}, Timeout: 60},
+		{ConditionType: "delay", Value: "60"},
+	} {
+		start := time.Now()
+		if err := WaitForCondition(ctx, &wd, condition); err == nil || time.Since(start) > 2*time.Second {
+			t.Errorf("%s: expected the wait to stop on the crawl cancellation, got %v after %v", condition.ConditionType, err, time.Since(start))
+		}
+	}
+}
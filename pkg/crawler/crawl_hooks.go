@@ -0,0 +1,240 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	// crawlHookMaxOutput is the maximum size of the output of a hook logged
+	// when it fails
+	crawlHookMaxOutput = 1024
+)
+
+// CrawlSummary is the summary of the crawl of a Source given to its
+// post-crawl hooks
+type CrawlSummary struct {
+	SourceID uint64 `json:"source_id"`
+	URL      string `json:"url"`
+	State    string `json:"state"`           // The state of the Source after the crawl (completed, error or completed-with-found)
+	Error    string `json:"error,omitempty"` // The error of the crawl (if any)
+	Status   Status `json:"status"`          // The crawl statistics
+}
+
+// newCrawlSummary returns the summary of the crawl of the Source, given the
+// error its state was updated with
+func (ctx *ProcessContext) newCrawlSummary(crawlErr error) CrawlSummary {
+	summary := CrawlSummary{
+		SourceID: ctx.source.ID,
+		URL:      ctx.source.URL,
+		State:    "completed",
+		Status:   *ctx.Status,
+	}
+	switch {
+	case crawlErr != nil:
+		summary.State = "error"
+		summary.Error = crawlErr.Error()
+	case ctx.Status.TargetFound:
+		summary.State = sourceStatusTargetFound
+	}
+	return summary
+}
+
+// runPostCrawlHooks runs the post-crawl hooks of the Source with the crawl
+// summary. A hook failing doesn't affect the crawl (or the other hooks), it's
+// only logged.
+func (ctx *ProcessContext) runPostCrawlHooks(crawlErr error) {
+	hooks := ctx.config.Crawler.PostCrawlHooks
+	if len(hooks) == 0 {
+		return
+	}
+	summary := ctx.newCrawlSummary(crawlErr)
+	for i, hook := range hooks {
+		var err error
+		switch hook.Type {
+		case cfg.CrawlHookCommand:
+			err = runCommandHook(hook, summary, ctx.config.Crawler.HooksAllowedCommands)
+		default:
+			err = runHTTPHook(hook, summary, ctx.config.Crawler.HooksAllowedHosts)
+		}
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "Source %d: post-crawl hook %d (%s): %v", summary.SourceID, i+1, hook.Type, err)
+			continue
+		}
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Source %d: post-crawl hook %d (%s) completed", summary.SourceID, i+1, hook.Type)
+	}
+}
+
+// runHTTPHook POSTs the crawl summary (as JSON) to the URL of the hook. The
+// URL host must resolve to public IPs, unless it's one of the allowed hosts
+// (the IPs actually connected to are checked too).
+func runHTTPHook(hook cfg.CrawlHook, summary CrawlSummary, allowedHosts []string) error {
+	hookURL, err := url.Parse(hook.URL)
+	if err != nil || (hookURL.Scheme != cmn.HTTPStr && hookURL.Scheme != cmn.HTTPSStr) || hookURL.Hostname() == "" {
+		return fmt.Errorf("invalid hook URL '%s'", hook.URL)
+	}
+	if err := checkHookHost(hookURL.Hostname(), allowedHosts); err != nil {
+		return err
+	}
+	allowed := cmn.SliceContains(allowedHosts, strings.ToLower(hookURL.Hostname()))
+
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("marshalling the crawl summary: %v", err)
+	}
+	hookCtx, cancel := context.WithTimeout(context.Background(), time.Duration(hook.Timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(hookCtx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	// The hook host is dialed directly (not through a proxy), with the IP
+	// check on the address dialed
+	transport := cmn.SafeTransport(hook.Timeout, "ignore")
+	transport.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout: time.Duration(hook.Timeout) * time.Second,
+		Control: hookDialControl(allowed),
+	}
+	transport.DialContext = dialer.DialContext
+	httpClient := &http.Client{
+		Transport: transport,
+		// Don't follow redirects (they could bypass the host checks)
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling '%s': %v", hook.URL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("calling '%s': unexpected status code %d", hook.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// checkHookHost returns an error if an HTTP hook can't call the host: the
+// allowed hosts can always be called, the others only if they resolve to
+// public IPs (so the Sources configs can't reach the internal services)
+func checkHookHost(host string, allowedHosts []string) error {
+	host = strings.ToLower(host)
+	if cmn.SliceContains(allowedHosts, host) {
+		return nil
+	}
+	ips := []string{host}
+	if cmn.CheckIPVersion(host) == -1 {
+		ips = cmn.HostToIP(host)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("hook host '%s' can't be resolved", host)
+	}
+	for _, ip := range ips {
+		if cmn.IsDisallowedIP(ip, 0) {
+			return fmt.Errorf("hook host '%s' is not allowed (it isn't public and not in hooks_allowed_hosts)", host)
+		}
+	}
+	return nil
+}
+
+// hookDialControl returns the dialer Control of the HTTP hooks: it refuses
+// to connect to the IPs that aren't public, unless the hook host is allowed.
+// The IP checked is the one actually dialed, so a host resolving to a public
+// IP when it's checked and to a private one when it's called (DNS rebinding)
+// can't reach the internal services.
+func hookDialControl(allowed bool) func(network, address string, c syscall.RawConn) error {
+	return func(_, address string, _ syscall.RawConn) error {
+		if allowed {
+			return nil
+		}
+		ip, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if cmn.IsDisallowedIP(ip, 0) {
+			return fmt.Errorf("hook address '%s' is not allowed (it isn't public and not in hooks_allowed_hosts)", ip)
+		}
+		return nil
+	}
+}
+
+// runCommandHook runs the command of the hook with the crawl summary (as
+// JSON) on its standard input. The command is a template of the summary
+// fields (e.g. "{{.SourceID}}"), it isn't run through a shell and its
+// executable must be one of the allowed commands.
+func runCommandHook(hook cfg.CrawlHook, summary CrawlSummary, allowedCommands []string) error {
+	args := strings.Fields(hook.Command)
+	if !cmn.SliceContains(allowedCommands, args[0]) {
+		return fmt.Errorf("command '%s' is not allowed (it isn't in hooks_allowed_commands)", args[0])
+	}
+	// Expand the template of each argument (so the summary values can't add arguments)
+	for i := 1; i < len(args); i++ {
+		tmpl, err := template.New("hook").Option("missingkey=error").Parse(args[i])
+		if err != nil {
+			return fmt.Errorf("parsing the command template '%s': %v", hook.Command, err)
+		}
+		var arg strings.Builder
+		if err := tmpl.Execute(&arg, summary); err != nil {
+			return fmt.Errorf("expanding the command template '%s': %v", hook.Command, err)
+		}
+		args[i] = arg.String()
+	}
+
+	payload, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("marshalling the crawl summary: %v", err)
+	}
+	hookCtx, cancel := context.WithTimeout(context.Background(), time.Duration(hook.Timeout)*time.Second)
+	defer cancel()
+	//nolint:gosec // The executable is one of the allowed commands
+	cmd := exec.CommandContext(hookCtx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if hookCtx.Err() != nil {
+			return fmt.Errorf("running '%s': timed out after %d seconds", args[0], hook.Timeout)
+		}
+		out, _ := io.ReadAll(io.LimitReader(&output, crawlHookMaxOutput))
+		return fmt.Errorf("running '%s': %v (%s)", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
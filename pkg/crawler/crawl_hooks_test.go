@@ -0,0 +1,94 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+func TestHookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+		wantErr bool
+	}{
+		{"93.184.216.34:443", false, false},
+		{"127.0.0.1:8080", false, true},
+		{"10.0.0.5:80", false, true},
+		{"[::1]:80", false, true},
+		{"127.0.0.1:8080", true, false}, // An allowed host
+	}
+	for _, tt := range tests {
+		err := hookDialControl(tt.allowed)("tcp", tt.address, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("hookDialControl(%t)(%s) = %v, want error: %t", tt.allowed, tt.address, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPostCrawlHooks(t *testing.T) {
+	var calls []CrawlSummary
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary CrawlSummary
+		if err := json.NewDecoder(r.Body).Decode(&summary); err != nil {
+			t.Errorf("Expected the crawl summary as JSON, got error %v", err)
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Expected the hook headers, got %v", r.Header)
+		}
+		calls = append(calls, summary)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	conf := cfg.NewConfig()
+	conf.Crawler.PostCrawlHooks = cfg.NormalizeCrawlHooks([]cfg.CrawlHook{
+		{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}},
+		{Type: cfg.CrawlHookCommand, Command: "touch " + dir + "/hook-{{.SourceID}}-{{.State}}"},
+		{Type: cfg.CrawlHookCommand, Command: "rm -rf " + dir},
+	})
+	conf.Crawler.HooksAllowedCommands = []string{"touch"}
+	status := &Status{TotalPages: 12, TotalErrors: 1}
+	ctx := &ProcessContext{Status: status, config: *conf, source: &cdb.Source{ID: 7, URL: testFQDN}}
+
+	// The HTTP hook can't call a private host unless it's allowed
+	ctx.runPostCrawlHooks(nil)
+	if len(calls) != 0 {
+		t.Fatalf("Expected the HTTP hook to be refused, got %d calls", len(calls))
+	}
+
+	ctx.config.Crawler.HooksAllowedHosts = []string{"127.0.0.1"}
+	ctx.runPostCrawlHooks(errors.New("too many errors"))
+	if len(calls) != 1 {
+		t.Fatalf("Expected the HTTP hook to be called once, got %d calls", len(calls))
+	}
+	want := CrawlSummary{SourceID: 7, URL: testFQDN, State: "error", Error: "too many errors", Status: *status}
+	if !reflect.DeepEqual(calls[0], want) {
+		t.Errorf("Expected the crawl summary %+v, got %+v", want, calls[0])
+	}
+	// The command hook expands its template, the command not allowed isn't run
+	if _, err := os.Stat(dir + "/hook-7-error"); err != nil {
+		t.Errorf("Expected the command hook to run, got %v", err)
+	}
+}
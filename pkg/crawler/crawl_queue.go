@@ -0,0 +1,130 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// queuePersisted returns true if the crawl queue of the Source is persisted
+// in the database (so an interrupted crawl can resume)
+func (ctx *ProcessContext) queuePersisted() bool {
+	return ctx.config.Crawler.PersistQueue && ctx.db != nil && ctx.source != nil
+}
+
+// enqueueLinks persists the links found at depth in the crawl queue
+func (ctx *ProcessContext) enqueueLinks(links []LinkItem, depth int) {
+	if !ctx.queuePersisted() || len(links) == 0 {
+		return
+	}
+	items := make([]cdb.CrawlQueueItem, 0, len(links))
+	for _, link := range links {
+		items = append(items, cdb.CrawlQueueItem{URL: link.Link, PageURL: link.PageURL, AnchorText: link.AnchorText, ElementID: link.ElementID, Depth: depth})
+	}
+	if err := cdb.EnqueueCrawlURLs(ctx.db, ctx.source.ID, items); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "persisting the crawl queue: %v", err)
+	}
+}
+
+// addNewLinks adds the links found on a page to the links to crawl at the
+// next depth (persisting them in the crawl queue)
+func (ctx *ProcessContext) addNewLinks(links []LinkItem) {
+	if len(links) == 0 {
+		return
+	}
+	ctx.linksMutex.Lock()
+	ctx.newLinks = append(ctx.newLinks, links...)
+	ctx.linksMutex.Unlock()
+	ctx.enqueueLinks(links, ctx.Status.CurrentDepth+1)
+}
+
+// queuedLinks returns the links of the crawl queue pending at depth (nil if
+// the queue isn't persisted or can't be read)
+func (ctx *ProcessContext) queuedLinks(depth int) []LinkItem {
+	if !ctx.queuePersisted() {
+		return nil
+	}
+	items, err := cdb.DequeueCrawlURLs(ctx.db, ctx.source.ID, depth)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "reading the crawl queue: %v", err)
+		return nil
+	}
+	links := make([]LinkItem, 0, len(items))
+	for _, item := range items {
+		links = append(links, LinkItem{PageURL: item.PageURL, PageLevel: item.Depth, Link: item.URL, ElementID: item.ElementID, AnchorText: item.AnchorText})
+	}
+	return links
+}
+
+// resumeQueue returns the links left pending by an interrupted crawl of the
+// Source and their depth (false if there is nothing to resume). The URLs
+// already crawled are marked as visited, so they aren't crawled again.
+func (ctx *ProcessContext) resumeQueue() ([]LinkItem, int, bool) {
+	if !ctx.queuePersisted() {
+		return nil, 0, false
+	}
+	depth, pending, err := cdb.ResumeCrawlQueue(ctx.db, ctx.source.ID)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "resuming the crawl queue: %v", err)
+		return nil, 0, false
+	}
+	if !pending {
+		return nil, 0, false
+	}
+
+	crawled, err := cdb.GetCrawledURLs(ctx.db, ctx.source.ID)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "resuming the crawl queue: %v", err)
+		return nil, 0, false
+	}
+	for _, link := range crawled {
+		if strings.HasPrefix(link, "/") {
+			link, _ = combineURLs(ctx.source.URL, link)
+		}
+		ctx.visitedLinks.Add(cmn.NormalizeURL(link))
+	}
+
+	links := ctx.queuedLinks(depth)
+	if len(links) == 0 {
+		return nil, 0, false
+	}
+	cmn.DebugMsg(cmn.DbgLvlInfo, "Source %d: resuming the crawl at depth %d (%d links pending, %d already crawled)", ctx.source.ID, depth, len(links), len(crawled))
+	return links, depth, true
+}
+
+// setQueueStatus sets the status (done or error) of a link of the crawl queue
+func (ctx *ProcessContext) setQueueStatus(link string, status string) {
+	if !ctx.queuePersisted() {
+		return
+	}
+	if err := cdb.SetCrawlURLStatus(ctx.db, ctx.source.ID, link, status); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "updating the crawl queue: %v", err)
+	}
+}
+
+// clearQueue removes the crawl queue of a Source crawled completely
+func (ctx *ProcessContext) clearQueue() {
+	if !ctx.queuePersisted() {
+		return
+	}
+	if err := cdb.ClearCrawlQueue(ctx.db, ctx.source.ID); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "clearing the crawl queue: %v", err)
+	}
+}
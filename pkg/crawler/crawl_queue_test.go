@@ -0,0 +1,88 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"reflect"
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+func TestCrawlQueueKeepsTheLinks(t *testing.T) {
+	db := newSQLiteIndexDB(t, 1)
+	ctx := &ProcessContext{
+		config: cfg.Config{Crawler: cfg.Crawler{PersistQueue: true}},
+		db:     &db,
+		source: &cdb.Source{ID: 1, URL: "https://www1.example.com"},
+		Status: &Status{},
+	}
+
+	links := []LinkItem{
+		{PageURL: "https://www1.example.com", PageLevel: 1, Link: "https://www1.example.com/products", ElementID: "nav-products", AnchorText: "Products"},
+		{PageURL: "https://www1.example.com", PageLevel: 1, Link: "https://www1.example.com/about"},
+	}
+	ctx.enqueueLinks(links, 1)
+
+	// The resumed links keep their anchor text and element ID (used by the
+	// anchor text scope and the links context)
+	if queued := ctx.queuedLinks(1); !reflect.DeepEqual(queued, links) {
+		t.Errorf("queuedLinks() = %+v, expected %+v", queued, links)
+	}
+}
+
+func TestCrawlQueueResume(t *testing.T) {
+	db := newSQLiteIndexDB(t, 1)
+	newCtx := func() *ProcessContext {
+		return &ProcessContext{
+			config:       cfg.Config{Crawler: cfg.Crawler{PersistQueue: true}},
+			db:           &db,
+			source:       &cdb.Source{ID: 1, URL: "https://www1.example.com"},
+			visitedLinks: newVisitedLinks(cfg.VisitedLinks{}, 1),
+			Status:       &Status{CurrentDepth: 1},
+		}
+	}
+
+	// The first crawl is interrupted after crawling one of the depth 1 links
+	ctx := newCtx()
+	ctx.enqueueLinks([]LinkItem{
+		{PageURL: "https://www1.example.com", PageLevel: 1, Link: "https://www1.example.com/products"},
+		{PageURL: "https://www1.example.com", PageLevel: 1, Link: "https://www1.example.com/about"},
+	}, 1)
+	ctx.setQueueStatus("https://www1.example.com/products", cdb.CrawlQueueDone)
+	ctx.addNewLinks([]LinkItem{{PageURL: "https://www1.example.com/products", PageLevel: 2, Link: "https://www1.example.com/products/1"}})
+
+	// The restarted crawl resumes the pending links of the lowest depth,
+	// without crawling the done ones again
+	ctx = newCtx()
+	links, depth, ok := ctx.resumeQueue()
+	if !ok {
+		t.Fatal("resumeQueue() = false, expected the crawl to be resumed")
+	}
+	if depth != 1 || len(links) != 1 || links[0].Link != "https://www1.example.com/about" {
+		t.Errorf("resumeQueue() = %+v (depth %d), expected the about page at depth 1", links, depth)
+	}
+	if !ctx.visitedLinks.Has(cmn.NormalizeURL("https://www1.example.com/products")) {
+		t.Error("resumeQueue() didn't mark the crawled page as visited")
+	}
+
+	// A completed crawl leaves nothing to resume
+	ctx.clearQueue()
+	if _, _, ok := newCtx().resumeQueue(); ok {
+		t.Error("resumeQueue() = true after clearQueue(), expected nothing to resume")
+	}
+}
@@ -18,6 +18,7 @@ package crawler
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"database/sql"
@@ -27,13 +28,19 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/jpeg"
 	"image/png"
+	"io"
 	"math"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -72,6 +79,17 @@ const (
 	errWExtractingPageInfo     = "Worker %d: Error extracting page info: %v\n"
 	errWorkerLog               = "Worker %d: Error indexing page %s: %v\n"
 
+	minPagesForErrorRate = 10  // Minimum number of processed pages before checking max_error_rate
+	maxIndexTxAttempts   = 3   // Maximum attempts of an indexing transaction (on deadlocks and serialization failures)
+	keywordsBatch        = 500 // Number of keywords stored per statement
+
+	summaryMaxLength = 200 // Maximum length of the summaries taken from the page content
+	leadMinWords     = 8   // Minimum number of words of a paragraph to be used as the page lead
+
+	maxInsecureResources = 50 // Maximum number of insecure resources recorded per page
+
+	sourceStatusTargetFound = "completed-with-found" // Source status when the crawl stopped because the stop condition matched
+
 	optDNSLookup = "dns_lookup"
 	optTCPConn   = "tcp_connection"
 	optTTFB      = "time_to_first_byte"
@@ -83,7 +101,12 @@ const (
 	optBrowsingRecu   = "recursive"
 	optBrowsingRCRecu = "right_click_recursive"
 	optBrowsingMobile = "mobile"
+	optBrowsingAction = "actions_only"
 	optCookiesOnReq   = "on_request"
+
+	optScreenshotFullPage = "fullpage" // Scroll the whole page and stitch the slices
+	optScreenshotViewport = "viewport" // Only the current viewport (above-the-fold)
+	optScreenshotElement  = "element"  // Only a specific element (take_screenshot action)
 )
 
 var (
@@ -91,7 +114,11 @@ var (
 	allowedProtocols = strings.Split("http://,https://,ftp://,ftps://", ",")
 )
 
-var indexPageMutex sync.Mutex // Mutex to ensure that only one goroutine is indexing a page at a time
+var indexingSem semaphore // Limits the number of pages indexed at the same time (nil means no limit)
+
+var screenshotsSem semaphore // Limits the number of screenshots taken at the same time (nil means no limit)
+
+var vdiMinSleep = 3.0 // Minimum wait (in seconds) of vdiSleep, to let the pages load
 
 // ProcessContext is a struct that holds the context of the crawling process
 // It's used to pass data between functions and goroutines and holds the
@@ -101,6 +128,7 @@ type ProcessContext struct {
 	SelInstance       vdi.SeleniumInstance       // The Selenium instance
 	WG                *sync.WaitGroup            // The Caller's WaitGroup
 	fpIdx             uint64                     // The index of the source page after it's indexed
+	fpUnchanged       bool                       // The source page content is unchanged since it was last indexed
 	config            cfg.Config                 // The configuration object (from the config package)
 	db                *cdb.Handler               // The database handler
 	wd                vdi.WebDriver              // The Selenium WebDriver
@@ -114,13 +142,46 @@ type ProcessContext struct {
 	hi                *httpi.HTTPDetails         // The HTTP header information of the web page
 	re                *rules.RuleEngine          // The rule engine
 	getURLMutex       sync.Mutex                 // Mutex to protect the getURLContent function
-	visitedLinks      map[string]bool            // Map to keep track of visited links
+	visitedLinks      VisitedLinks               // Set to keep track of visited links
 	userURLPatterns   []string                   // User-defined URL patterns
+	scope             *patternScope              // Compiled include/exclude patterns of the URLs to crawl
+	anchorScope       *patternScope              // Compiled follow/skip patterns of the links anchor text
+	keywordRules      []keywordRule              // Compiled keyword extraction rules
 	Status            *Status                    // Status of the crawling process
 	CollectedCookies  map[string]interface{}     // Collected cookies
 	VDIReturned       bool                       // Flag to indicate if the VDI instance was returned
 	SelClosed         bool                       // Flag to indicate if the Selenium instance was closed
 	VDIOperationMutex sync.Mutex                 // Mutex to protect the VDI operations
+	errorsMutex       sync.Mutex                 // Mutex to protect the pages/errors counters
+	crawlAborted      bool                       // Flag to indicate the crawl has been aborted (too many errors)
+	targetFound       bool                       // Flag to indicate the stop condition matched (the crawl target has been found)
+	workers           int                        // Number of page workers requested by the source (0 means use the global setting)
+	trace             *RulesTrace                // Rules execution trace (nil if tracing is disabled)
+	kvEnv             *KVEnvironment             // KV store environment snapshots (nil if the export is disabled)
+	preScraped        *preScrapedPage            // Data scraped from the current page before its action rules (rules_order: scraping_first)
+	detailDepth       int                        // Nesting level of the detail pages being scraped (list-detail rules)
+	paginationMutex   sync.Mutex                 // Mutex to protect the pagination state
+	pagination        map[string]paginationState // What has been collected of the paginated listings (by rule name)
+	actionPlanMutex   sync.Mutex                 // Mutex to protect the action plan state
+	actionPlanRunning sync.Mutex                 // Held by the action plan running (until it returns, even if it timed out and the crawl failed)
+	actionPlanCtx     context.Context            // The context of the action plan being executed (nil if it has no timeout)
+	crawlCtx          context.Context            // The context of the crawl (cancelled to stop it, e.g. on shutdown)
+	actionPlanStep    string                     // The action rule the action plan is executing
+	rng               *rand.Rand                 // Random choices generator (nil if the crawl random choices aren't reproducible)
+	interception      io.Closer                  // The CDP connection intercepting the requests of the VDI session (nil if none)
+	referer           string                     // The Referer of the navigation to the page being crawled (the page linking to it)
+	scrapedSizeMutex  sync.Mutex                 // Mutex to protect the scraped data size
+	scrapedSize       int                        // Size (in bytes) of the data scraped from the Source pages
+	apiEndpointsMutex sync.Mutex                 // Mutex to protect the followed API endpoints
+	apiEndpoints      map[string]bool            // The API endpoints whose pagination has been followed (api_pagination)
+	facets            map[string]bool            // The facet URLs of the Source (crawled deliberately, set before the workers start)
+}
+
+// preScrapedPage holds the result of the scraping rules executed on a page
+// before its action rules
+type preScrapedPage struct {
+	data string
+	err  error
 }
 
 // GetContextID returns a unique context ID for the ProcessContext
@@ -137,6 +198,7 @@ func (ctx *ProcessContext) GetContextID() string {
 	GetVDIReturnedFlag() *bool
 	SetVDIReturnedFlag(bool)
 	GetVDIInstance() *SeleniumInstance
+	GetRand() *rand.Rand
 */
 
 // GetWebDriver returns the WebDriver object from the ProcessContext
@@ -179,9 +241,17 @@ func (ctx *ProcessContext) GetVDIInstance() *vdi.SeleniumInstance {
 	return &ctx.SelInstance
 }
 
+// GetRand returns the random choices generator from the ProcessContext
+func (ctx *ProcessContext) GetRand() *rand.Rand {
+	return ctx.rng
+}
+
 // CrawlWebsite is responsible for crawling a website, it's the main entry point
 // and it's called from the main.go when there is a Source to crawl.
-func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.SeleniumInstance) {
+// Cancelling crawlCtx stops the crawl: the workers drain and exit, and the
+// in-flight navigations are abandoned (the crawl queue is kept, so the crawl
+// can be resumed).
+func CrawlWebsite(crawlCtx context.Context, args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.SeleniumInstance) {
 	// Initialize the process context
 	processCtx := NewProcessContext(args)
 
@@ -202,6 +272,32 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 		} else {
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Source configuration combined successfully.")
 		}
+		processCtx.workers = sourceWorkers(processCtx.source.Config)
+	}
+
+	// Seed the random choices of the crawl (so a seed reproduces them). The
+	// workers share the generator and pick the pages in no fixed order, so
+	// the per-page choices are reproducible only with a single worker.
+	processCtx.rng = cmn.NewRand(processCtx.config.Crawler.RandomSeed)
+	if processCtx.rng != nil && processCtx.crawlingWorkers() > 1 {
+		cmn.DebugMsg(cmn.DbgLvlWarn, "Source %d: random_seed is set with %d workers, the random choices made per page can't be reproduced (set crawler.workers to 1 for that)", processCtx.source.ID, processCtx.crawlingWorkers())
+	}
+
+	// Limit the whole crawl of the Source (source_timeout), returning its VDI
+	// even if the crawl gets stuck past the timeout
+	crawlCtx, cancelCrawl := processCtx.withSourceTimeout(crawlCtx)
+	defer cancelCrawl()
+	processCtx.crawlCtx = crawlCtx
+	crawlDone := make(chan struct{})
+	defer close(crawlDone)
+	go processCtx.watchSourceTimeout(args, &sel, releaseVDI, crawlDone)
+
+	// Record the rules execution (if requested)
+	if processCtx.config.Crawler.TraceRules {
+		processCtx.trace = newRulesTrace(processCtx.source)
+	}
+	if processCtx.config.Crawler.ExportKVEnvironment {
+		processCtx.kvEnv = newKVEnvironment(processCtx.source, processCtx.config.Crawler.MaxKVSnapshots)
 	}
 
 	// Log the crawling process
@@ -238,6 +334,7 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 	}
 	processCtx.Status.CrawlingRunning = 1
 	defer closeSession(processCtx, args, &sel, releaseVDI, err)
+	defer processCtx.recordSourceTimeout()
 
 	// Extract custom configuration from the source
 	sourceConfig := make(map[string]interface{})
@@ -277,6 +374,17 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 		}
 	}
 
+	// Compile the crawl scope patterns once for the whole crawl
+	processCtx.scope = newPatternScope(processCtx.config.Crawler.IncludePatterns, processCtx.config.Crawler.ExcludePatterns)
+	processCtx.anchorScope = newPatternScope(processCtx.config.Crawler.FollowAnchorPatterns, processCtx.config.Crawler.SkipAnchorPatterns)
+	processCtx.keywordRules = compileKeywordRules(processCtx.config.Crawler.KeywordRules)
+
+	// In actions only mode we just run the action plan on the Source URL
+	if strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingAction {
+		processCtx.runActionsOnly()
+		return
+	}
+
 	// Crawl the initial URL and get the HTML content
 	var pageSource vdi.WebDriver
 	pageSource, err = processCtx.CrawlInitialURL(sel)
@@ -291,7 +399,7 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 	}
 
 	// Get screenshot of the page
-	processCtx.TakeScreenshot(pageSource, args.Src.URL, processCtx.fpIdx)
+	processCtx.TakeScreenshot(pageSource, args.Src.URL, processCtx.fpIdx, processCtx.fpUnchanged)
 
 	// Extract the HTML content and extract links
 	var htmlContent string
@@ -307,7 +415,8 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 		processCtx.Status.LastError = err.Error()
 		return
 	}
-	initialLinks := extractLinks(processCtx, htmlContent, args.Src.URL)
+	currentURL, _ := pageSource.CurrentURL()
+	initialLinks := extractLinks(processCtx, htmlContent, linksPageURL(currentURL, args.Src.URL))
 
 	// Refresh the page
 	err = processCtx.RefreshVDIConnection(sel)
@@ -348,31 +457,38 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 	}
 
 	// Crawl the website
-	allLinks := initialLinks // links extracted from the initial page
+	allLinks := initialLinks // links extracted from the initial page (and the sitemaps)
+	if processCtx.source.Restricted != 0 {
+		allLinks = append(allLinks, processCtx.sitemapLinks(initialLinks)...)
+		allLinks = append(allLinks, processCtx.facetLinks(allLinks)...)
+	}
 	var currentDepth int
 	maxDepth := checkMaxDepth(processCtx.config.Crawler.MaxDepth) // set a maximum depth for crawling
-	newLinksFound := len(initialLinks)
+	if processCtx.source.Restricted != 0 {
+		// Resume an interrupted crawl of the Source (if any) or start its crawl queue
+		if links, depth, ok := processCtx.resumeQueue(); ok {
+			allLinks, currentDepth = links, depth
+		} else {
+			processCtx.enqueueLinks(allLinks, 0)
+		}
+		processCtx.Status.CurrentDepth = currentDepth
+		if currentDepth > 0 && processCtx.config.Crawler.MaxDepth == 0 {
+			maxDepth = currentDepth + 1
+		}
+	}
+	newLinksFound := len(allLinks)
 	processCtx.Status.TotalLinks = newLinksFound
 	if processCtx.source.Restricted != 0 {
 		// Restriction level is higher than 0, so we need to crawl the website
-		for (currentDepth < maxDepth) && (newLinksFound > 0) {
+		for (currentDepth < maxDepth) && (newLinksFound > 0) && !processCtx.isTargetFound() && crawlCtx.Err() == nil {
 			// Create a channel to enqueue jobs
 			jobs := make(chan LinkItem, len(allLinks))
 			// Create a channel to collect errors
-			errChan := make(chan error, config.Crawler.Workers-2)
+			workers := processCtx.crawlingWorkers()
+			errChan := make(chan error, workers)
 
 			// Launch worker goroutines
-			for w := 1; w <= config.Crawler.Workers-2; w++ {
-				processCtx.wg.Add(1)
-
-				go func(w int) {
-					defer processCtx.wg.Done()
-					if err := worker(processCtx, w, jobs); err != nil {
-						// Send any error from the worker to the error channel
-						errChan <- err
-					}
-				}(w)
-			}
+			processCtx.startWorkers(crawlCtx, workers, jobs, errChan)
 
 			// Enqueue jobs (allLinks)
 			for _, link := range allLinks {
@@ -411,6 +527,11 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 
 			// Prepare for the next iteration
 			processCtx.linksMutex.Lock()
+			if queued := processCtx.queuedLinks(currentDepth + 1); len(queued) > 0 {
+				// The crawl queue has the new links without duplicates (and the
+				// ones left pending by an interrupted crawl)
+				processCtx.newLinks = queued
+			}
 			if len(processCtx.newLinks) > 0 {
 				// If MaxLinks is set, limit the number of new links
 				if processCtx.config.Crawler.MaxLinks > 0 && ((processCtx.Status.TotalPages + len(processCtx.newLinks)) > processCtx.config.Crawler.MaxLinks) {
@@ -438,9 +559,18 @@ func CrawlWebsite(args *Pars, sel vdi.SeleniumInstance, releaseVDI chan<- vdi.Se
 				maxDepth = currentDepth + 1
 			}
 		}
+
+		// The crawl queue of an aborted or cancelled crawl is kept, so the next
+		// crawl resumes it
+		if crawlCtx.Err() != nil {
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Crawl of source %d cancelled at depth %d: %v", processCtx.source.ID, currentDepth, crawlCtx.Err())
+		}
+		if !processCtx.isCrawlAborted() && crawlCtx.Err() == nil {
+			processCtx.clearQueue()
+		}
 	}
 
-	if processCtx.config.Crawler.ResetCookiesPolicy == cmn.AlwaysStr {
+	if processCtx.config.Crawler.ResetCookiesPolicy == cmn.AlwaysStr && crawlCtx.Err() == nil {
 		// Reset cookies after crawling
 		_ = ResetSiteSession(processCtx)
 	}
@@ -463,6 +593,7 @@ func closeSession(ctx *ProcessContext,
 	err error) {
 	// Release VDI connection
 	// (this allows the next source to be processed, if any, in this batch job)
+	ctx.stopInterception()
 	vdi.ReturnVDIInstance(args.WG, ctx, sel, releaseVDI)
 
 	// Allow a new sources batch job to be processed (if any)
@@ -473,9 +604,20 @@ func closeSession(ctx *ProcessContext,
 	if ctx.Status.PipelineRunning == 1 || err != nil {
 		ctx.Status.PipelineRunning = 3
 	}
+	if err == nil && ctx.Status.PipelineRunning == 3 && ctx.Status.LastError != "" {
+		// Mark the source as errored with the last error summary
+		err = errors.New(ctx.Status.LastError)
+	}
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Pipeline completed for source: %v", ctx.source.ID)
 	ctx.Status.EndTime = time.Now()
-	UpdateSourceState(args.DB, args.Src.URL, err)
+	if err == nil && ctx.Status.TargetFound {
+		updateSourceTargetFound(args.DB, args.Src.URL)
+	} else {
+		UpdateSourceState(args.DB, args.Src.URL, err)
+	}
+
+	// Run the post-crawl hooks (if any) with the crawl summary
+	ctx.runPostCrawlHooks(err)
 
 	// Create a database event to indicate the crawl has completed
 	if ctx.config.Crawler.CreateEventWhenDone {
@@ -488,10 +630,37 @@ func closeSession(ctx *ProcessContext,
 	// Optionally clean up session-specific data
 	cmn.KVStore.CleanSession(ctx.GetContextID())
 
+	// Save the visited links of interrupted crawls (so they can be resumed)
+	completed := ctx.Status.PipelineRunning == 2
+	if err := persistVisitedLinks(ctx.config.Crawler.VisitedLinks, ctx.source.ID, ctx.visitedLinks, completed); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "persisting visited links: %v", err)
+	}
+
+	// Save the rules execution trace (if any)
+	if err := ctx.trace.save(ctx.config.Crawler.TracePath); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "saving rules trace: %v", err)
+	}
+	if err := ctx.kvEnv.save(ctx.config.Crawler.TracePath); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "saving KV environment: %v", err)
+	}
+
+	// Report the paginated listings that haven't been collected completely
+	ctx.reportPagination()
+
+	// Flag the pages of the source sharing the same title and summary
+	if ctx.config.Crawler.FlagDuplicateTitles && ctx.Status.TotalPages > 0 {
+		flagged, err := flagLowDistinctiveness(args.DB, ctx.source.ID, ctx.config.Crawler.DuplicateTitlesMin)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "flagging duplicate titles of source %d: %v", ctx.source.ID, err)
+		} else {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Flagged %d pages with duplicate titles for source %d", flagged, ctx.source.ID)
+		}
+	}
+
 	// Release other resources in ctx
 	ctx.linksMutex.Lock()
 	ctx.newLinks = nil         // Clear the slice to release memory
-	ctx.visitedLinks = nil     // Clear the map to release memory
+	ctx.visitedLinks = nil     // Clear the set to release memory
 	ctx.CollectedCookies = nil // Clear cookies
 	ctx.linksMutex.Unlock()
 
@@ -546,8 +715,9 @@ func NewProcessContext(args *Pars) *ProcessContext {
 		Status: args.Status,
 		WG:     args.WG,
 	}
+	newPCtx.crawlCtx = context.Background()
 	newPCtx.config = *cfg.DeepCopyConfig(&config)
-	newPCtx.visitedLinks = make(map[string]bool)
+	newPCtx.visitedLinks = newVisitedLinks(newPCtx.config.Crawler.VisitedLinks, args.Src.ID)
 	return &newPCtx
 }
 
@@ -566,9 +736,24 @@ func resetPageInfo(p *PageInfo) {
 	p.Summary = ""
 	p.DetectedLang = ""
 	p.DetectedType = ""
+	p.PublishedAt = nil
+	p.ModifiedAt = nil
 	p.PerfInfo = PerformanceLog{}
 	p.MetaTags = []MetaTag{}
+	p.Forms = []PageForm{}
+	p.Media = nil
+	p.Enrichment = nil
+	p.Breadcrumbs = nil
+	p.CanonicalURL = ""
+	p.AMPURL = ""
+	p.AMPContent = false
+	p.Truncated = false
+	p.contentUnchanged = false
+	p.KeywordTags = nil
+	p.Security = PageSecurity{}
+	p.Errors = []string{}
 	p.ScrapedData = []ScrapedItem{}
+	p.Extracted = nil
 	p.Links = p.Links[:0] // Reset slice without reallocating
 }
 
@@ -586,6 +771,7 @@ func (ctx *ProcessContext) ConnectToVDI(sel vdi.SeleniumInstance) error {
 		return err
 	}
 	cmn.DebugMsg(cmn.DbgLvlDebug1, "Connected to Selenium WebDriver successfully.")
+	ctx.startInterception(sel)
 	return nil
 }
 
@@ -605,6 +791,7 @@ func (ctx *ProcessContext) RefreshVDIConnection(sel vdi.SeleniumInstance) error
 			cmn.DebugMsg(cmn.DbgLvlError, "re-"+vdi.VDIConnError, err)
 			return err
 		}
+		ctx.startInterception(sel)
 	}
 	return nil
 }
@@ -625,8 +812,15 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 		_ = ResetSiteSession(ctx)
 	}
 
+	// Check if robots.txt allows crawling the Source
+	if !ctx.robotsAllowed(ctx.source.URL) {
+		err := fmt.Errorf("crawling '%s' is disallowed by robots.txt", ctx.source.URL)
+		UpdateSourceState(*ctx.db, ctx.source.URL, err)
+		return ctx.wd, err
+	}
+
 	// Get the initial URL
-	pageSource, docType, err := getURLContent(ctx.source.URL, ctx.wd, 0, ctx)
+	pageSource, docType, err := getURLContent(ctx.crawlCtx, ctx.source.URL, ctx.wd, 0, ctx)
 	if err != nil {
 		UpdateSourceState(*ctx.db, ctx.source.URL, err)
 		return pageSource, err
@@ -663,26 +857,34 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 	pageInfo.DetectedType = docType
 	pageInfo.HTTPInfo = ctx.hi
 	pageInfo.NetInfo = ctx.ni
-	pageInfo.Links = extractLinks(ctx, pageInfo.HTML, ctx.source.URL)
+	currentURL, _ := pageSource.CurrentURL()
+	pageInfo.Links = extractLinks(ctx, pageInfo.HTML, linksPageURL(currentURL, ctx.source.URL))
 	// Generate Keywords from the page content
 	pageInfo.Keywords = extractKeywords(pageInfo)
+	applyKeywordRules(&pageInfo, ctx.keywordRules)
 
 	// Collect Navigation Timing metrics
 	if ctx.config.Crawler.CollectPerfMetrics {
 		collectNavigationMetrics(&ctx.wd, &pageInfo)
 	}
 
-	// Collect Page logs
+	// Collect Page logs (their network responses give the status code and the
+	// security of the page, even if the page events aren't collected)
+	pageLogs := readPageLogs(&pageSource)
 	if ctx.config.Crawler.CollectPageEvents {
-		collectPageLogs(&pageSource, &pageInfo)
+		pageInfo.PerfInfo.LogEntries = append(pageInfo.PerfInfo.LogEntries, pageLogs...)
 	}
+	pageInfo.StatusCode = pageStatusCode(currentURL, pageLogs)
+
+	// Check for insecure connections and mixed content
+	pageInfo.Security = checkPageSecurity(currentURL, pageLogs)
 
 	// Collect XHR
 	if ctx.config.Crawler.CollectXHR {
 		collectXHR(ctx, &pageInfo)
 	}
 
-	if !ctx.config.Crawler.CollectHTML {
+	if !ctx.config.Crawler.CollectHTML && !ctx.config.Crawler.StoreRawHTML {
 		// If we don't need to collect HTML content, clear it
 		pageInfo.HTML = ""
 	}
@@ -693,19 +895,24 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 	}
 
 	// Index the page
-	ctx.fpIdx, err = ctx.IndexPage(&pageInfo)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "indexing page: %v", err)
-		UpdateSourceState(*ctx.db, ctx.source.URL, err)
+	if skipInsecurePage(ctx.config.Crawler, ctx.source.URL, pageInfo.Security) ||
+		skipErrorPage(ctx.config.Crawler, ctx.source.URL, pageInfo.StatusCode) {
+		ctx.fpIdx = 0
+	} else {
+		ctx.fpIdx, err = ctx.IndexPage(&pageInfo)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "indexing page: %v", err)
+			UpdateSourceState(*ctx.db, ctx.source.URL, err)
+		}
 	}
+	ctx.fpUnchanged = pageInfo.contentUnchanged
 	resetPageInfo(&pageInfo) // Reset the PageInfo struct
 	fURL := cmn.NormalizeURL(ctx.source.URL)
-	ctx.visitedLinks[fURL] = true
+	ctx.visitedLinks.Add(fURL)
 	ctx.Status.TotalPages = 1
 
 	// Delay before processing the next job
-	if ctx.config.Crawler.Delay != "0" {
-		delay := exi.GetFloat(ctx.config.Crawler.Delay)
+	if delay := getDelay(ctx); delay > 0 {
 		ctx.Status.LastDelay = delay
 		_ = vdiSleep(ctx, delay)
 	}
@@ -713,6 +920,102 @@ func (ctx *ProcessContext) CrawlInitialURL(_ vdi.SeleniumInstance) (vdi.WebDrive
 	return pageSource, nil
 }
 
+// RunActionPlan is responsible for running the action rules (and the scraping
+// rules, if any) on the Source URL, without indexing the page or following
+// its links. It returns the scraped data (if any).
+func (ctx *ProcessContext) RunActionPlan() (map[string]interface{}, error) {
+	url := strings.TrimSpace(ctx.source.URL)
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Running action plan on URL: %s", url)
+
+	if ctx.wd == nil {
+		return nil, errors.New("WebDriver is nil")
+	}
+
+	// Load the page
+	if err := ctx.wd.Get(url); err != nil {
+		return nil, fmt.Errorf("failed to navigate to %s: %v", url, err)
+	}
+
+	// Run the action and scraping rules (if any) in the configured order
+	ctx.runPageActionRules(&ctx.wd, url)
+	scrapedData := make(map[string]interface{})
+	data, err := ctx.pageScrapedData(&ctx.wd, url)
+	if data = strings.TrimSpace(data); data != "" && data != "{}" {
+		if err2 := json.Unmarshal([]byte(data), &scrapedData); err2 != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "unmarshalling scraped data: %v, full data: %v", err2, data)
+		}
+	}
+	if len(scrapedData) > 0 {
+		ctx.Status.TotalScraped++
+	}
+
+	return scrapedData, err
+}
+
+// runPageActionRules runs the action rules on the current page. When the
+// scraping rules must run first (rules_order), for flows where the actions
+// change the page content, the scraping rules are run before the actions and
+// their result is kept for the page info extraction (see pageScrapedData).
+func (ctx *ProcessContext) runPageActionRules(wd *vdi.WebDriver, url string) {
+	ctx.preScraped = nil
+	if strings.ToLower(strings.TrimSpace(ctx.config.Crawler.RulesOrder)) == cfg.RulesOrderScrapingFirst {
+		data, err := processScrapingRules(wd, ctx, url)
+		ctx.preScraped = &preScrapedPage{data: data, err: err}
+	}
+	processActionRules(wd, ctx, url)
+}
+
+// pageScrapedData returns the data scraped from the current page: the data
+// scraped before the action rules (if the scraping rules ran first), otherwise
+// the scraping rules are run now (after the action rules).
+func (ctx *ProcessContext) pageScrapedData(wd *vdi.WebDriver, url string) (string, error) {
+	if pre := ctx.preScraped; pre != nil {
+		ctx.preScraped = nil
+		return pre.data, pre.err
+	}
+	return processScrapingRules(wd, ctx, url)
+}
+
+// runActionsOnly runs the action plan on the Source URL, updates the status
+// accordingly and reports the result as a database event.
+func (ctx *ProcessContext) runActionsOnly() {
+	scrapedData, err := ctx.RunActionPlan()
+
+	severity := cdb.EventSeverityInfo
+	ctx.Status.EndTime = time.Now()
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "running action plan: %v", err)
+		severity = cdb.EventSeverityError
+		ctx.Status.CrawlingRunning = 3
+		ctx.Status.PipelineRunning = 3
+		ctx.Status.TotalErrors++
+		ctx.Status.LastError = err.Error()
+	} else {
+		ctx.Status.CrawlingRunning = 2
+		ctx.Status.PipelineRunning = 2
+	}
+
+	// Report the result of the action plan
+	details := map[string]interface{}{
+		"url":           ctx.source.URL,
+		"total_actions": ctx.Status.TotalActions,
+		"scraped_data":  scrapedData,
+		"cookies":       ctx.CollectedCookies,
+	}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	event := cdb.Event{
+		SourceID: ctx.source.ID,
+		Type:     "actions_completed",
+		Severity: severity,
+		Details:  details,
+	}
+	if _, err := cdb.CreateEvent(ctx.db, event); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "creating actions completed event: %v", err)
+	}
+}
+
 // Collects the performance metrics logs from the browser
 func collectNavigationMetrics(wd *vdi.WebDriver, pageInfo *PageInfo) {
 	// Retrieve Navigation Timing metrics
@@ -773,19 +1076,27 @@ func collectXHR(ctx *ProcessContext, pageInfo *PageInfo) {
 	xhr := map[string]interface{}{"xhr": xhrData}
 	pageInfo.ScrapedData = append(pageInfo.ScrapedData, xhr)
 
+	// Collect the records of the paginated APIs called by the page
+	if ctx.config.Crawler.APIPagination.Enabled {
+		if apiData := ctx.apiRecordsData(pageInfo.URL, xhrData); len(apiData) > 0 {
+			pageInfo.ScrapedData = append(pageInfo.ScrapedData, apiData)
+		}
+	}
+
 	// Debug output
 	jsonData, _ := json.MarshalIndent(xhr, "", "  ")
 	cmn.DebugMsg(cmn.DbgLvlDebug5, "XHR Data Captured: %s", jsonData)
 }
 
-// Collects the page logs from the browser
-func collectPageLogs(pageSource *vdi.WebDriver, pageInfo *PageInfo) {
+// readPageLogs returns the page logs (the network responses) from the browser
+func readPageLogs(pageSource *vdi.WebDriver) []PerformanceLogEntry {
 	logs, err := (*pageSource).Log("performance")
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Failed to retrieve performance logs: %v", err)
-		return
+		return nil
 	}
 
+	var entries []PerformanceLogEntry
 	for _, entry := range logs {
 		var log PerformanceLogEntry
 		err := json.Unmarshal([]byte(entry.Message), &log)
@@ -794,9 +1105,101 @@ func collectPageLogs(pageSource *vdi.WebDriver, pageInfo *PageInfo) {
 			continue
 		}
 		if len(log.Message.Params.ResponseInfo.URL) > 0 {
-			pageInfo.PerfInfo.LogEntries = append(pageInfo.PerfInfo.LogEntries, log)
+			entries = append(entries, log)
+		}
+	}
+	return entries
+}
+
+// pageStatusCode returns the HTTP status code of a page from the network
+// responses captured for it: the last response of its document (or, if the
+// document type isn't reported, the last response for its URL). It returns 0
+// if no response for the page has been captured.
+func pageStatusCode(pageURL string, entries []PerformanceLogEntry) int {
+	pageKey := cmn.NormalizeURL(pageURL)
+	docStatus, urlStatus := 0, 0
+	for _, entry := range entries {
+		resp := entry.Message.Params.ResponseInfo
+		if entry.Message.Method != "Network.responseReceived" || resp.StatusCode == 0 ||
+			cmn.NormalizeURL(resp.URL) != pageKey {
+			continue
+		}
+		if entry.Message.Params.Type == "Document" {
+			docStatus = resp.StatusCode
+		}
+		urlStatus = resp.StatusCode
+	}
+	if docStatus != 0 {
+		return docStatus
+	}
+	return urlStatus
+}
+
+// skipErrorPage returns true if the page must not be indexed because it was
+// served with an HTTP error status (and we are configured to skip such pages).
+func skipErrorPage(conf cfg.Crawler, pageURL string, statusCode int) bool {
+	if statusCode < 400 {
+		return false
+	}
+	if !conf.SkipErrorPages {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Page %s served with HTTP status %d", pageURL, statusCode)
+		return false
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Skipping indexing of error page %s (HTTP status %d)", pageURL, statusCode)
+	return true
+}
+
+// checkPageSecurity detects if a page was served over an insecure connection
+// and if an HTTPS page loaded resources over HTTP (mixed content), using the
+// network responses captured for the page.
+func checkPageSecurity(pageURL string, entries []PerformanceLogEntry) PageSecurity {
+	var sec PageSecurity
+	page, err := url.Parse(strings.TrimSpace(pageURL))
+	if err != nil {
+		return sec
+	}
+	sec.Insecure = strings.EqualFold(page.Scheme, "http")
+	isHTTPS := strings.EqualFold(page.Scheme, "https")
+
+	pageKey := cmn.NormalizeURL(pageURL)
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		resp := entry.Message.Params.ResponseInfo
+		if resp.URL == "" {
+			continue
+		}
+		if cmn.NormalizeURL(resp.URL) == pageKey {
+			// The page itself (e.g., HTTPS with an invalid certificate)
+			if strings.HasPrefix(strings.ToLower(resp.SecurityState), "insecure") {
+				sec.Insecure = true
+			}
+			continue
+		}
+		if !isHTTPS || seen[resp.URL] {
+			continue
+		}
+		res, err := url.Parse(resp.URL)
+		if err != nil || !strings.EqualFold(res.Scheme, "http") {
+			continue
+		}
+		seen[resp.URL] = true
+		sec.MixedContent = true
+		if len(sec.InsecureResources) < maxInsecureResources {
+			sec.InsecureResources = append(sec.InsecureResources, resp.URL)
 		}
 	}
+	return sec
+}
+
+// skipInsecurePage returns true if the page must not be indexed because it was
+// served over an insecure connection or with mixed content (and we are configured
+// to skip such pages).
+func skipInsecurePage(conf cfg.Crawler, pageURL string, sec PageSecurity) bool {
+	if !conf.SkipInsecurePages || (!sec.Insecure && !sec.MixedContent) {
+		return false
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Skipping indexing of insecure page %s (insecure: %t, mixed content: %t)", pageURL, sec.Insecure, sec.MixedContent)
+	return true
 }
 
 // Collects the performance metrics logs from the browser
@@ -831,8 +1234,10 @@ func retrieveNavigationMetrics(wd *vdi.WebDriver) (map[string]interface{}, error
 	return metrics, nil
 }
 
-// TakeScreenshot takes a screenshot of the current page and saves it to the filesystem
-func (ctx *ProcessContext) TakeScreenshot(wd vdi.WebDriver, url string, indexID uint64) {
+// TakeScreenshot takes a screenshot of the current page and saves it to the filesystem.
+// With screenshot_on_change, the page whose content is unchanged since it was last
+// indexed (unchanged) keeps its previous screenshot (if it has one) instead.
+func (ctx *ProcessContext) TakeScreenshot(wd vdi.WebDriver, url string, indexID uint64, unchanged bool) {
 	// Take screenshot if enabled
 	takeScreenshot := false
 
@@ -845,13 +1250,27 @@ func (ctx *ProcessContext) TakeScreenshot(wd vdi.WebDriver, url string, indexID
 		takeScreenshot = ctx.config.Crawler.FullSiteScreenshot
 	}
 
+	if takeScreenshot && unchanged && ctx.config.Crawler.ScreenshotOnChange {
+		if indexID == 0 {
+			indexID = ctx.fpIdx
+		}
+		exists, err := hasScreenshot(*ctx.db, indexID)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "checking the screenshots of %s: %v", url, err)
+		}
+		if exists {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Page %s unchanged, keeping its previous screenshot", url)
+			takeScreenshot = false
+		}
+	}
+
 	if takeScreenshot {
 		// Create imageName using the hash. Adding a suffix like '.png' is optional depending on your use case.
 		sid := strconv.FormatUint(ctx.source.ID, 10)
-		imageName := "s" + sid + "-" + generateUniqueName(url, "-desktop")
+		imageName := ctx.screenshotFileName(url, "s"+sid+"-"+generateUniqueName(url, "-desktop"))
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Taking screenshot: %s", imageName)
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Taking screenshot of %s...", url)
-		ss, err := TakeScreenshot(&wd, imageName, ctx.config.Crawler.ScreenshotMaxHeight)
+		ss, err := TakeScreenshot(&wd, imageName, ctx.config.Crawler.ScreenshotMaxHeight, ctx.config.Crawler.ScreenshotMode)
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "taking screenshot: %v", err)
 		}
@@ -885,6 +1304,53 @@ func generateUniqueName(url string, imageType string) string {
 	return imageName
 }
 
+// screenshotFileName returns the storage path (relative to the configured storage)
+// of a screenshot of the given URL, rendering the configured path template
+func (ctx *ProcessContext) screenshotFileName(url, name string) string {
+	var sourceID uint64
+	if ctx.source != nil {
+		sourceID = ctx.source.ID
+	}
+	return renderScreenshotPath(ctx.config.Crawler.ScreenshotPathTemplate, sourceID, url, name, time.Now())
+}
+
+// renderScreenshotPath renders a screenshot path template. Supported variables:
+// {sourceID}, {yyyy}, {mm}, {dd}, {hh}, {timestamp} (Unix time), {host} (of the
+// URL), {urlhash} (SHA-256 of the URL), {name} and {ext} (the screenshot name and
+// its extension, "png" if it has none). Unknown variables are left as they are.
+// The rendered path is always relative to the storage path (it can't escape it).
+func renderScreenshotPath(tmpl string, sourceID uint64, pageURL, name string, t time.Time) string {
+	if strings.TrimSpace(tmpl) == "" {
+		tmpl = cfg.DefaultScreenshotPathTemplate
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	if ext == "" {
+		ext = "png"
+	}
+
+	host := ""
+	if u, err := url.Parse(strings.TrimSpace(pageURL)); err == nil {
+		host = u.Hostname()
+	}
+	hash := sha256.Sum256([]byte(pageURL))
+
+	r := strings.NewReplacer(
+		"{sourceID}", strconv.FormatUint(sourceID, 10),
+		"{yyyy}", t.Format("2006"),
+		"{mm}", t.Format("01"),
+		"{dd}", t.Format("02"),
+		"{hh}", t.Format("15"),
+		"{timestamp}", strconv.FormatInt(t.Unix(), 10),
+		"{host}", host,
+		"{urlhash}", hex.EncodeToString(hash[:]),
+		"{name}", name,
+		"{ext}", ext,
+	)
+	return strings.TrimLeft(path.Clean("/"+r.Replace(tmpl)), "/")
+}
+
 // insertScreenshot inserts a screenshot into the database
 func insertScreenshot(db cdb.Handler, screenshot Screenshot) error {
 	if screenshot.IndexID == 0 {
@@ -922,6 +1388,13 @@ func insertScreenshot(db cdb.Handler, screenshot Screenshot) error {
 	return err
 }
 
+// hasScreenshot returns true if the indexed page indexID has a screenshot
+func hasScreenshot(db cdb.Handler, indexID uint64) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM Screenshots WHERE index_id = $1`, indexID).Scan(&n)
+	return n > 0, err
+}
+
 // GetNetInfo is responsible for gathering network information for a Source
 func (ctx *ProcessContext) GetNetInfo(_ string) {
 	ctx.Status.NetInfoRunning = 1
@@ -944,6 +1417,18 @@ func (ctx *ProcessContext) GetNetInfo(_ string) {
 	}
 }
 
+// rotateProxies returns the proxies starting from one picked at random by
+// rng (so the HTTP information isn't always collected through the same proxy)
+func rotateProxies(proxies []cfg.SOCKSProxy, rng *rand.Rand) []cfg.SOCKSProxy {
+	if len(proxies) < 2 {
+		return proxies
+	}
+	start := cmn.RandomIndex(rng, len(proxies))
+	rotated := make([]cfg.SOCKSProxy, 0, len(proxies))
+	rotated = append(rotated, proxies[start:]...)
+	return append(rotated, proxies[:start]...)
+}
+
 // GetHTTPInfo is responsible for gathering HTTP header information for a Source
 func (ctx *ProcessContext) GetHTTPInfo(url string, htmlContent string) {
 	ctx.Status.HTTPInfoRunning = 1
@@ -953,13 +1438,14 @@ func (ctx *ProcessContext) GetHTTPInfo(url string, htmlContent string) {
 	var err error
 	c := httpi.Config{
 		URL:             url,
-		CustomHeader:    map[string]string{"User-Agent": cmn.UsrAgentStrMap[browser+"-desktop01"]},
+		CustomHeader:    requestHeaders(&ctx.config.Crawler, cmn.UsrAgentStrMap[browser+"-desktop01"]),
 		FollowRedirects: ctx.config.HTTPHeaders.FollowRedirects,
 		Timeout:         ctx.config.HTTPHeaders.Timeout,
 		SSLDiscovery:    ctx.config.HTTPHeaders.SSLDiscovery,
+		Methods:         ctx.config.HTTPHeaders.Methods,
 	}
 	if len(ctx.config.HTTPHeaders.Proxies) > 0 {
-		c.Proxies = ctx.config.HTTPHeaders.Proxies
+		c.Proxies = rotateProxies(ctx.config.HTTPHeaders.Proxies, ctx.rng)
 	}
 
 	// Call GetHTTPInfo to retrieve HTTP header information
@@ -978,6 +1464,8 @@ func (ctx *ProcessContext) GetHTTPInfo(url string, htmlContent string) {
 // IndexPage is responsible for indexing a crawled page in the database
 func (ctx *ProcessContext) IndexPage(pageInfo *PageInfo) (uint64, error) {
 	(*pageInfo).sourceID = ctx.source.ID
+	(*pageInfo).sourceURL = ctx.source.URL
+	(*pageInfo).restricted = ctx.source.Restricted
 	(*pageInfo).Config = &ctx.config
 	return indexPage(*ctx.db, ctx.source.URL, pageInfo)
 }
@@ -1019,19 +1507,33 @@ func UpdateSourceState(db cdb.Handler, sourceURL string, crawlError error) {
 	}
 }
 
-// indexPage is responsible for indexing a crawled page in the database
-// I had to write this function quickly, so it's not very efficient.
-// In an ideal world, I would have used multiple transactions to index the page
-// and avoid deadlocks when inserting keywords. However, using a mutex to enter
-// this function (and so treat it as a critical section) should be enough for now.
-// Another thought is, the mutex also helps slow down the crawling process, which
-// is a good thing. You don't want to overwhelm the Source site with requests.
+// updateSourceTargetFound marks a Source as completed with its crawl target found
+// (the crawl was stopped early because the stop condition matched)
+func updateSourceTargetFound(db cdb.Handler, sourceURL string) {
+	err := db.CheckConnection(config)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, dbConnCheckErr, err)
+		return
+	}
+
+	_, err = db.Exec(`UPDATE Sources SET last_crawled_at = NOW(), status = $1
+                      WHERE url = $2`, sourceStatusTargetFound, sourceURL)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "updating source state for URL %s: %v", sourceURL, err)
+	}
+}
+
+// indexPage is responsible for indexing a crawled page in the database.
+// Pages are indexed concurrently (up to max_concurrent_indexing), each one in its
+// own short transaction, which is retried if it fails because of a deadlock or a
+// serialization failure with another page being indexed at the same time.
 func indexPage(db cdb.Handler, url string, pageInfo *PageInfo) (uint64, error) {
-	// Acquire a lock to ensure that only one goroutine is accessing the database
-	indexPageMutex.Lock()
-	defer indexPageMutex.Unlock()
+	sem := indexingSem
+	sem.acquire()
+	defer sem.release()
 
 	pageInfo.URL = url
+	indexURL := pageIndexURL(pageInfo)
 
 	// Before updating the source state, check if the database connection is still alive
 	err := db.CheckConnection(config)
@@ -1040,54 +1542,96 @@ func indexPage(db cdb.Handler, url string, pageInfo *PageInfo) (uint64, error) {
 		return 0, err
 	}
 
-	// Start a transaction
-	tx, err := db.Begin()
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "starting transaction: %v", err)
-		return 0, err
-	}
+	contentHash := pageContentHash(pageInfo)
 
-	// Insert or update the page in SearchIndex
-	indexID, err := insertOrUpdateSearchIndex(tx, url, pageInfo)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "inserting or updating SearchIndex: %v", err)
-		rollbackTransaction(tx)
-		return 0, err
-	}
+	var indexID uint64
+	err = runIndexTx(db, func(tx *sql.Tx) error {
+		var err error
 
-	// Insert or update the page in WebObjects
-	err = insertOrUpdateWebObjects(tx, indexID, pageInfo)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "inserting or updating WebObjects: %v", err)
-		rollbackTransaction(tx)
-		return 0, err
-	}
+		// Has the content of the page changed since it was last indexed?
+		unchanged, err := pageContentUnchanged(tx, indexURL, contentHash)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "checking the indexed content of %s: %v", indexURL, err)
+			return err
+		}
+		pageInfo.contentUnchanged = unchanged
 
-	// Insert MetaTags
-	if pageInfo.Config.Crawler.CollectMetaTags {
-		err = insertMetaTags(tx, indexID, pageInfo.MetaTags)
+		// Insert or update the page in SearchIndex
+		indexID, err = insertOrUpdateSearchIndex(tx, indexURL, pageInfo)
 		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "inserting meta tags: %v", err)
-			rollbackTransaction(tx)
-			return 0, err
+			cmn.DebugMsg(cmn.DbgLvlError, "inserting or updating SearchIndex: %v", err)
+			return err
+		}
+		// With the cross-source deduplication, the content of a page already
+		// indexed (by any source) with the same content isn't stored again
+		if unchanged && pageInfo.Config.Crawler.CrossSourceDedup {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Page %s already indexed with the same content, linked to source %d", indexURL, pageInfo.sourceID)
+			return nil
 		}
-	}
 
-	// Insert into KeywordIndex
-	if pageInfo.Config.Crawler.CollectKeywords {
-		err = insertKeywords(tx, db, indexID, pageInfo)
+		// Insert or update the page in WebObjects
+		err = insertOrUpdateWebObjects(tx, indexID, pageInfo)
 		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "inserting keywords: %v", err)
-			rollbackTransaction(tx)
-			return 0, err
+			cmn.DebugMsg(cmn.DbgLvlError, "inserting or updating WebObjects: %v", err)
+			return err
+		}
+
+		// Insert the raw HTML
+		if pageInfo.Config.Crawler.StoreRawHTML {
+			err = insertPageHTML(tx, indexID, pageInfo.HTML)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting raw HTML: %v", err)
+				return err
+			}
+		}
+
+		// Insert MetaTags
+		if pageInfo.Config.Crawler.CollectMetaTags {
+			err = insertMetaTags(tx, indexID, pageInfo.MetaTags)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting meta tags: %v", err)
+				return err
+			}
+		}
+
+		// Insert Forms
+		if pageInfo.Config.Crawler.CollectForms {
+			err = insertForms(tx, indexID, pageInfo.Forms)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting forms: %v", err)
+				return err
+			}
+		}
+
+		// Insert Media
+		if pageInfo.Config.Crawler.CollectMedia {
+			err = insertMedia(tx, indexID, pageInfo.Media)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting media: %v", err)
+				return err
+			}
+		}
+
+		// Insert the NLP enrichment
+		if pageInfo.Config.Crawler.Enrichment.Backend != cfg.EnrichmentNone {
+			err = insertEnrichment(tx, indexID, pageInfo.Enrichment)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting enrichment: %v", err)
+				return err
+			}
 		}
-	}
 
-	// Commit the transaction
-	err = commitTransaction(tx)
+		// Insert into KeywordIndex
+		if pageInfo.Config.Crawler.CollectKeywords {
+			err = insertKeywords(tx, db, indexID, pageInfo)
+			if err != nil {
+				cmn.DebugMsg(cmn.DbgLvlError, "inserting keywords: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, dbConnTransErr, err)
-		rollbackTransaction(tx)
 		return 0, err
 	}
 
@@ -1097,9 +1641,9 @@ func indexPage(db cdb.Handler, url string, pageInfo *PageInfo) (uint64, error) {
 
 // indexNetInfo indexes the network information of a source in the database
 func indexNetInfo(db cdb.Handler, url string, pageInfo *PageInfo, flags int) (uint64, error) {
-	// Acquire a lock to ensure that only one goroutine is accessing the database
-	indexPageMutex.Lock()
-	defer indexPageMutex.Unlock()
+	sem := indexingSem
+	sem.acquire()
+	defer sem.release()
 
 	pageInfo.URL = url
 
@@ -1110,52 +1654,52 @@ func indexNetInfo(db cdb.Handler, url string, pageInfo *PageInfo, flags int) (ui
 		return 0, err
 	}
 
-	// Start a transaction
-	tx, err := db.Begin()
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "starting transaction: %v", err)
-		return 0, err
-	}
+	var indexID uint64
+	err = runIndexTx(db, func(tx *sql.Tx) error {
+		var err error
 
-	// Insert or update the page in SearchIndex
-	indexID, err := insertOrUpdateSearchIndex(tx, url, pageInfo)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "inserting or updating SearchIndex: %v", err)
-		rollbackTransaction(tx)
-		return 0, err
-	}
+		// Insert or update the page in SearchIndex
+		indexID, err = insertOrUpdateSearchIndex(tx, url, pageInfo)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "inserting or updating SearchIndex: %v", err)
+			return err
+		}
 
-	// If flags first bit is set to 1 or if flags is 0, try to insert NetInfo
-	if flags == 1 || flags == 0 {
-		// Insert NetInfo into the database (if available)
-		if pageInfo.NetInfo != nil {
-			err = insertNetInfo(tx, indexID, pageInfo.NetInfo)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "inserting NetInfo: %v", err)
-				rollbackTransaction(tx)
-				return 0, err
+		// If flags first bit is set to 1 or if flags is 0, try to insert NetInfo
+		if flags == 1 || flags == 0 {
+			// Insert NetInfo into the database (if available)
+			if pageInfo.NetInfo != nil {
+				err = insertNetInfo(tx, indexID, pageInfo.NetInfo)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "inserting NetInfo: %v", err)
+					return err
+				}
+
+				// Insert the ServiceScout results (if any), as a new scan
+				if len(pageInfo.NetInfo.ServiceScout.Hosts) > 0 {
+					err = insertServiceScoutScan(tx, pageInfo.sourceID, &pageInfo.NetInfo.ServiceScout, time.Now())
+					if err != nil {
+						cmn.DebugMsg(cmn.DbgLvlError, "inserting ServiceScout results: %v", err)
+						return err
+					}
+				}
 			}
 		}
-	}
 
-	// If flags second bit is set to 1 or if flags is 0, try to insert HTTPInfo
-	if flags == 2 || flags == 0 {
-		// Insert HTTPInfo into the database (if available)
-		if pageInfo.HTTPInfo != nil {
-			err = insertHTTPInfo(tx, indexID, pageInfo.HTTPInfo)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, "inserting HTTPInfo: %v", err)
-				rollbackTransaction(tx)
-				return 0, err
+		// If flags second bit is set to 1 or if flags is 0, try to insert HTTPInfo
+		if flags == 2 || flags == 0 {
+			// Insert HTTPInfo into the database (if available)
+			if pageInfo.HTTPInfo != nil {
+				err = insertHTTPInfo(tx, indexID, pageInfo.HTTPInfo)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlError, "inserting HTTPInfo: %v", err)
+					return err
+				}
 			}
 		}
-	}
-
-	// Commit the transaction
-	err = commitTransaction(tx)
+		return nil
+	})
 	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, dbConnTransErr, err)
-		rollbackTransaction(tx)
 		return 0, err
 	}
 
@@ -1163,47 +1707,153 @@ func indexNetInfo(db cdb.Handler, url string, pageInfo *PageInfo, flags int) (ui
 	return indexID, nil
 }
 
-// insertOrUpdateSearchIndex inserts or updates a search index entry in the database.
-// It takes a transaction object (tx), the URL of the page (url), and the page information (pageInfo).
-// It returns the index ID of the inserted or updated entry and an error, if any.
-func insertOrUpdateSearchIndex(tx *sql.Tx, url string, pageInfo *PageInfo) (uint64, error) {
-	var indexID uint64 // The index ID of the page (supports very large numbers)
-
-	// Check if detectedLang and detectedType are not empty and are valid UTF8 strings
-	if !utf8.ValidString((*pageInfo).DetectedLang) {
-		(*pageInfo).DetectedLang = ""
+// pageIndexURL returns the URL a page is indexed under: its canonical URL (if
+// it declares one, the pages are indexed under their canonical URL and the
+// canonical URL is on the same host as the crawled one or inside the crawl
+// scope of the source) or the crawled one
+func pageIndexURL(pageInfo *PageInfo) string {
+	if pageInfo.Config == nil || !pageInfo.Config.Crawler.IndexCanonicalURL || pageInfo.CanonicalURL == "" {
+		return pageInfo.URL
 	}
-	if !utf8.ValidString((*pageInfo).DetectedType) {
-		(*pageInfo).DetectedType = ""
+	if pageInfo.CanonicalURL == pageInfo.URL {
+		return pageInfo.URL
 	}
-
-	// Check if title and summary are not empty and are valid UTF8 strings
-	if !utf8.ValidString((*pageInfo).Title) {
-		(*pageInfo).Title = "No Title"
+	if !canonicalInScope(pageInfo) {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Ignoring the canonical URL %s of %s, it's out of the crawl scope", pageInfo.CanonicalURL, pageInfo.URL)
+		return pageInfo.URL
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Indexing %s under its canonical URL %s", pageInfo.URL, pageInfo.CanonicalURL)
+	return pageInfo.CanonicalURL
+}
+
+// canonicalInScope returns true if the canonical URL of the page is on the same
+// host as the crawled URL or inside the crawl scope of its source (so a page
+// can't overwrite the index entry of a page of another site)
+func canonicalInScope(pageInfo *PageInfo) bool {
+	canonical, err := url.Parse(pageInfo.CanonicalURL)
+	if err != nil || canonical.Hostname() == "" {
+		return false
+	}
+	crawled, err := url.Parse(pageInfo.URL)
+	if err == nil && strings.EqualFold(canonical.Hostname(), crawled.Hostname()) {
+		return true
+	}
+	if pageInfo.sourceURL == "" || pageInfo.restricted == 4 {
+		return false // No crawl scope to check against, only the same host is trusted
+	}
+	return !isExternalLink(pageInfo.sourceURL, pageInfo.CanonicalURL, pageInfo.restricted)
+}
+
+// runIndexTx runs fn in a transaction and commits it. If the transaction fails
+// because of a deadlock or a serialization failure (with other pages being indexed
+// at the same time), it's retried in a new transaction (up to maxIndexTxAttempts).
+func runIndexTx(db cdb.Handler, fn func(tx *sql.Tx) error) error {
+	var err error
+	for i := 0; i < maxIndexTxAttempts; i++ {
+		if i > 0 {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Retrying indexing transaction (attempt %d): %v", i+1, err)
+			time.Sleep(time.Duration(i) * 100 * time.Millisecond) // Backoff
+		}
+
+		// Start a transaction
+		var tx *sql.Tx
+		tx, err = db.Begin()
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "starting transaction: %v", err)
+			return err
+		}
+
+		err = fn(tx)
+		if err != nil {
+			rollbackTransaction(tx)
+		} else {
+			// Commit the transaction
+			err = commitTransaction(tx)
+		}
+		if err == nil || !isRetryableTxError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// isRetryableTxError returns true if the error is a deadlock or a serialization
+// failure (or, on SQLite, a busy database), after which the whole transaction
+// can be safely retried
+func isRetryableTxError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "deadlock detected") ||
+		strings.Contains(msg, "could not serialize access") ||
+		strings.Contains(msg, "Deadlock found") ||
+		strings.Contains(msg, "database is locked")
+}
+
+// insertOrUpdateSearchIndex inserts or updates a search index entry in the database.
+// It takes a transaction object (tx), the URL the page is indexed under (url), and the
+// page information (pageInfo, its URL is the crawled one, recorded for the source).
+// It returns the index ID of the inserted or updated entry and an error, if any.
+func insertOrUpdateSearchIndex(tx *sql.Tx, url string, pageInfo *PageInfo) (uint64, error) {
+	var indexID uint64 // The index ID of the page (supports very large numbers)
+
+	// Check if detectedLang and detectedType are not empty and are valid UTF8 strings
+	if !utf8.ValidString((*pageInfo).DetectedLang) {
+		(*pageInfo).DetectedLang = ""
+	}
+	if !utf8.ValidString((*pageInfo).DetectedType) {
+		(*pageInfo).DetectedType = ""
+	}
+
+	// Check if title and summary are not empty and are valid UTF8 strings
+	if !utf8.ValidString((*pageInfo).Title) {
+		(*pageInfo).Title = "No Title"
 	}
 	if !utf8.ValidString((*pageInfo).Summary) {
 		(*pageInfo).Summary = ""
 	}
 
-	// Step 1: Insert into SearchIndex
+	// The breadcrumb trail is stored as a JSON array (NULL if the page has none)
+	var breadcrumbs sql.NullString
+	if len((*pageInfo).Breadcrumbs) > 0 {
+		breadcrumbsJSON, err := json.Marshal((*pageInfo).Breadcrumbs)
+		if err != nil {
+			return 0, err
+		}
+		breadcrumbs = sql.NullString{String: string(breadcrumbsJSON), Valid: true}
+	}
+
+	// Step 1: Insert into SearchIndex (the content hash is kept if the page
+	// has no content, e.g. when only its network information is indexed)
+	contentHash := pageContentHash(pageInfo)
 	err := tx.QueryRow(`
 		INSERT INTO SearchIndex
-			(page_url, title, summary, detected_lang, detected_type, last_updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
+			(page_url, title, summary, detected_lang, detected_type, published_at, modified_at, status_code, content_hash, breadcrumbs, body_text_truncated, last_updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb, $11, NOW())
 		ON CONFLICT (page_url) DO UPDATE
-		SET title = EXCLUDED.title, summary = EXCLUDED.summary, detected_lang = EXCLUDED.detected_lang, detected_type = EXCLUDED.detected_type, last_updated_at = NOW()
+		SET title = EXCLUDED.title, summary = EXCLUDED.summary, detected_lang = EXCLUDED.detected_lang, detected_type = EXCLUDED.detected_type,
+			published_at = EXCLUDED.published_at, modified_at = EXCLUDED.modified_at, status_code = EXCLUDED.status_code,
+			body_text_truncated = CASE WHEN EXCLUDED.content_hash IS NULL THEN SearchIndex.body_text_truncated ELSE EXCLUDED.body_text_truncated END,
+			content_hash = COALESCE(EXCLUDED.content_hash, SearchIndex.content_hash), breadcrumbs = EXCLUDED.breadcrumbs, last_updated_at = NOW()
 		RETURNING index_id`,
 		url, (*pageInfo).Title, (*pageInfo).Summary,
-		strLeft((*pageInfo).DetectedLang, 8), strLeft((*pageInfo).DetectedType, 8)).Scan(&indexID)
+		strLeft((*pageInfo).DetectedLang, 8), strLeft((*pageInfo).DetectedType, 8),
+		(*pageInfo).PublishedAt, (*pageInfo).ModifiedAt,
+		sql.NullInt32{Int32: int32((*pageInfo).StatusCode), Valid: (*pageInfo).StatusCode > 0},
+		sql.NullString{String: contentHash, Valid: contentHash != ""}, breadcrumbs, (*pageInfo).Truncated).Scan(&indexID)
 	if err != nil {
 		return 0, err // Handle error appropriately
 	}
 
-	// Step 2: Insert into SourceSearchIndex for the associated sourceID
+	// Step 2: Insert into SourceSearchIndex for the associated sourceID, with
+	// the URL the source crawled (it differs from the indexed one for the pages
+	// indexed under their canonical URL)
+	crawledURL := (*pageInfo).URL
+	if crawledURL == "" {
+		crawledURL = url
+	}
 	_, err = tx.Exec(`
-		INSERT INTO SourceSearchIndex (source_id, index_id)
-		VALUES ($1, $2)
-		ON CONFLICT (source_id, index_id) DO NOTHING`, (*pageInfo).sourceID, indexID)
+		INSERT INTO SourceSearchIndex (source_id, index_id, crawled_url)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (source_id, index_id) DO UPDATE SET crawled_url = EXCLUDED.crawled_url`, (*pageInfo).sourceID, indexID, crawledURL)
 	if err != nil {
 		return 0, err // Handle error appropriately
 	}
@@ -1211,6 +1861,47 @@ func insertOrUpdateSearchIndex(tx *sql.Tx, url string, pageInfo *PageInfo) (uint
 	return indexID, nil
 }
 
+// pageContentHash returns the SHA256 of the content of a page (its body text,
+// or its HTML if it has no text, with its scraped data and detected
+// technologies), empty if the page has no content
+func pageContentHash(pageInfo *PageInfo) string {
+	content := (*pageInfo).BodyText
+	if content == "" {
+		content = (*pageInfo).HTML
+	}
+	if content == "" {
+		return ""
+	}
+	hasher := sha256.New()
+	hasher.Write([]byte(content))
+	if len((*pageInfo).ScrapedData) > 0 {
+		scrapedDataJSON, _ := json.Marshal((*pageInfo).ScrapedData)
+		hasher.Write(scrapedDataJSON)
+	}
+	if (*pageInfo).DetectedTech != nil {
+		detectedTechJSON, _ := json.Marshal((*pageInfo).DetectedTech)
+		hasher.Write(detectedTechJSON)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// pageContentUnchanged returns true if the page at url is already indexed
+// (by any source) with the content hash contentHash
+func pageContentUnchanged(tx *sql.Tx, url, contentHash string) (bool, error) {
+	if contentHash == "" {
+		return false, nil
+	}
+	var indexedHash sql.NullString
+	err := tx.QueryRow(`SELECT content_hash FROM SearchIndex WHERE page_url = $1`, url).Scan(&indexedHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return indexedHash.Valid && indexedHash.String == contentHash, nil
+}
+
 func strLeft(s string, x int) string {
 	runes := []rune(s)
 	if x < 0 || x > len(runes) {
@@ -1232,6 +1923,16 @@ func insertOrUpdateWebObjects(tx *sql.Tx, indexID uint64, pageInfo *PageInfo) er
 	}
 	details["links"] = links
 	details["detected_tech"] = (*pageInfo).DetectedTech
+	details["security"] = (*pageInfo).Security
+	if len((*pageInfo).Extracted) > 0 {
+		details["extracted"] = (*pageInfo).Extracted
+	}
+	if (*pageInfo).AMPURL != "" {
+		details["amp"] = map[string]interface{}{
+			"url":     (*pageInfo).AMPURL,
+			"content": (*pageInfo).AMPContent,
+		}
+	}
 
 	// Create a JSON out of the details
 	detailsJSON, err := json.Marshal(details)
@@ -1317,13 +2018,21 @@ func insertOrUpdateWebObjects(tx *sql.Tx, indexID uint64, pageInfo *PageInfo) er
 
 	// Extract Scraped Data and Detected Tech from detailsJSON
 
+	// Get HTML and text Content (the HTML may be kept only for the raw HTML
+	// storage, see insertPageHTML)
+	htmlContent := ""
+	if pageInfo.Config.Crawler.CollectHTML {
+		htmlContent = (*pageInfo).HTML
+	}
+	textContent := (*pageInfo).BodyText
+
 	// Calculate the SHA256 hash of the body text
 	hasher := sha256.New()
 	bytesToHash := []byte{}
-	if len((*pageInfo).BodyText) > 0 {
-		bytesToHash = []byte((*pageInfo).BodyText)
-	} else if len((*pageInfo).HTML) > 0 {
-		bytesToHash = []byte((*pageInfo).HTML)
+	if len(textContent) > 0 {
+		bytesToHash = []byte(textContent)
+	} else if len(htmlContent) > 0 {
+		bytesToHash = []byte(htmlContent)
 	} else {
 		hasher.Write([]byte(detailsJSON))
 	}
@@ -1332,10 +2041,6 @@ func insertOrUpdateWebObjects(tx *sql.Tx, indexID uint64, pageInfo *PageInfo) er
 	hasher.Write(bytesToHash)
 	hash := hex.EncodeToString(hasher.Sum(nil))
 
-	// Get HTML and text Content
-	htmlContent := (*pageInfo).HTML
-	textContent := (*pageInfo).BodyText
-
 	var objID int64
 
 	// Step 1: Insert into WebObjects
@@ -1419,6 +2124,150 @@ func insertNetInfo(tx *sql.Tx, indexID uint64, netInfo *neti.NetInfo) error {
 	return nil
 }
 
+// insertServiceScoutScan inserts the ServiceScout (Nmap) results of a source
+// into the database, as a new scan of the source completed at scannedAt, so
+// the open ports and the vulnerabilities of its hosts can be tracked over time.
+// It returns an error if there was a problem executing the SQL statements.
+func insertServiceScoutScan(tx *sql.Tx, sourceID uint64, results *neti.ServiceScoutInfo, scannedAt time.Time) error {
+	var hosts []*neti.HostInfo
+	for i := range results.Hosts {
+		// The hosts that couldn't be scanned have no addresses
+		if len(results.Hosts[i].IP) > 0 || len(results.Hosts[i].Hostname) > 0 {
+			hosts = append(hosts, &results.Hosts[i])
+		}
+	}
+
+	var scanID int64
+	err := tx.QueryRow(`
+		INSERT INTO ServiceScoutScans (source_id, scanned_at, hosts_count)
+		VALUES ($1, $2, $3)
+		RETURNING scan_id`, sourceID, scannedAt, len(hosts)).Scan(&scanID)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		err = insertServiceScoutHost(tx, scanID, host)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertServiceScoutHost inserts a host of a ServiceScout scan, with its
+// ports, services, operating systems and vulnerabilities
+func insertServiceScoutHost(tx *sql.Tx, scanID int64, host *neti.HostInfo) error {
+	ip, hostname := "", ""
+	if len(host.IP) > 0 {
+		ip = host.IP[0].Address
+	}
+	if len(host.Hostname) > 0 {
+		hostname = host.Hostname[0].Name
+	}
+	details, err := json.Marshal(map[string]interface{}{"ip": host.IP, "hostname": host.Hostname})
+	if err != nil {
+		return err
+	}
+
+	var hostID int64
+	err = tx.QueryRow(`
+		INSERT INTO ServiceScoutHosts (scan_id, ip, hostname, details)
+		VALUES ($1, $2, $3, $4::jsonb)
+		RETURNING host_id`, scanID, strLeft(ip, 45), strLeft(hostname, 255), details).Scan(&hostID)
+	if err != nil {
+		return err
+	}
+
+	for _, port := range host.Ports {
+		_, err = tx.Exec(`
+			INSERT INTO ServiceScoutPorts (host_id, port, protocol, state, service)
+			VALUES ($1, $2, $3, $4, $5)`,
+			hostID, port.Port, strLeft(port.Protocol, 8), strLeft(port.State, 32), strLeft(port.Service, 255))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, service := range host.Services {
+		details, err := json.Marshal(service)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO ServiceScoutServices (host_id, name, product, version, details)
+			VALUES ($1, $2, $3, $4, $5::jsonb)`,
+			hostID, strLeft(service.Name, 255), strLeft(service.Product, 255), strLeft(service.Version, 255), details)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, osInfo := range host.OS {
+		details, err := json.Marshal(osInfo.Classes)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO ServiceScoutOS (host_id, name, accuracy, details)
+			VALUES ($1, $2, $3, $4::jsonb)`,
+			hostID, strLeft(osInfo.Name, 255), osInfo.Accuracy, details)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, vuln := range host.Vulnerabilities {
+		details, err := json.Marshal(map[string]interface{}{
+			"description": vuln.Description, "output": vuln.Output, "elements": vuln.Elements, "tables": vuln.Tables,
+		})
+		if err != nil {
+			return err
+		}
+		severity, level := vulnerabilitySeverity(vuln.Severity)
+		_, err = tx.Exec(`
+			INSERT INTO ServiceScoutVulnerabilities (host_id, vuln_id, name, severity, severity_level, state, reference, details)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb)`,
+			hostID, strLeft(vuln.ID, 255), strLeft(vuln.Name, 255), severity, level,
+			strLeft(vuln.State, 64), vuln.Reference, details)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vulnerabilitySeverity returns the severity of a vulnerability (unknown,
+// low, medium, high or critical) and its level (from 0, unknown, to 4,
+// critical), so the vulnerabilities can be queried by severity. The CVSS
+// scores are mapped to their severity.
+func vulnerabilitySeverity(severity string) (string, int) {
+	severity = strings.ToLower(strings.TrimSpace(severity))
+	if score, err := strconv.ParseFloat(severity, 64); err == nil {
+		switch {
+		case score >= 9:
+			severity = "critical"
+		case score >= 7:
+			severity = "high"
+		case score >= 4:
+			severity = "medium"
+		case score > 0:
+			severity = "low"
+		}
+	}
+	switch severity {
+	case "critical":
+		return severity, 4
+	case "high":
+		return severity, 3
+	case "medium", "moderate":
+		return "medium", 2
+	case "low":
+		return severity, 1
+	}
+	return "unknown", 0
+}
+
 // insertHTTPInfo inserts HTTP header information into the database for a given index ID.
 // It takes a transaction, index ID, and an HTTPDetails object as parameters.
 // It returns an error if there was a problem executing the SQL statement.
@@ -1466,6 +2315,16 @@ func insertHTTPInfo(tx *sql.Tx, indexID uint64, httpInfo *httpi.HTTPDetails) err
 // Each meta tag is inserted into the MetaTags table with the corresponding index ID, name, and content.
 // Returns an error if there was a problem executing the SQL statement.
 func insertMetaTags(tx *sql.Tx, indexID uint64, metaTags []MetaTag) error {
+	// Always lock the (shared) meta tags in the same order, to avoid deadlocks
+	// with other pages being indexed at the same time
+	metaTags = append([]MetaTag(nil), metaTags...)
+	sort.Slice(metaTags, func(i, j int) bool {
+		if metaTags[i].Name != metaTags[j].Name {
+			return metaTags[i].Name < metaTags[j].Name
+		}
+		return metaTags[i].Content < metaTags[j].Content
+	})
+
 	for _, metatag := range metaTags {
 		var name string
 		if len(metatag.Name) > 256 {
@@ -1510,29 +2369,187 @@ func insertMetaTags(tx *sql.Tx, indexID uint64, metaTags []MetaTag) error {
 	return nil
 }
 
+// insertForms stores the structure of the forms found in a web page
+// (one row per index_id, replaced every time the page is indexed)
+func insertForms(tx *sql.Tx, indexID uint64, forms []PageForm) error {
+	if len(forms) == 0 {
+		_, err := tx.Exec(`DELETE FROM PageForms WHERE index_id = $1;`, indexID)
+		return err
+	}
+
+	details, err := json.Marshal(forms)
+	if err != nil {
+		return fmt.Errorf("marshalling forms: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO PageForms (index_id, forms_count, details)
+		VALUES ($1, $2, $3::jsonb)
+		ON CONFLICT (index_id) DO UPDATE
+		SET forms_count = EXCLUDED.forms_count, details = EXCLUDED.details;`,
+		indexID, len(forms), string(details))
+	return err
+}
+
+// insertMedia stores the video and audio media found in a web page (one row
+// per index_id, replaced every time the page is indexed)
+func insertMedia(tx *sql.Tx, indexID uint64, media []MediaInfo) error {
+	if len(media) == 0 {
+		_, err := tx.Exec(`DELETE FROM PageMedia WHERE index_id = $1;`, indexID)
+		return err
+	}
+
+	details, err := json.Marshal(media)
+	if err != nil {
+		return fmt.Errorf("marshalling media: %v", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO PageMedia (index_id, media_count, details)
+		VALUES ($1, $2, $3::jsonb)
+		ON CONFLICT (index_id) DO UPDATE
+		SET media_count = EXCLUDED.media_count, details = EXCLUDED.details;`,
+		indexID, len(media), string(details))
+	return err
+}
+
+// insertEnrichment stores the NLP enrichment of a web page (one row per
+// index_id, replaced every time the page is enriched). A page without an
+// enrichment (e.g. the enrichment service failed) keeps the stored one.
+func insertEnrichment(tx *sql.Tx, indexID uint64, enrichment *PageEnrichment) error {
+	if enrichment == nil {
+		return nil
+	}
+
+	details, err := json.Marshal(enrichment)
+	if err != nil {
+		return fmt.Errorf("marshalling enrichment: %v", err)
+	}
+	sentiment := sql.NullFloat64{}
+	if enrichment.Sentiment != nil {
+		sentiment = sql.NullFloat64{Float64: enrichment.Sentiment.Score, Valid: true}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO PageEnrichment (index_id, sentiment, details)
+		VALUES ($1, $2, $3::jsonb)
+		ON CONFLICT (index_id) DO UPDATE
+		SET sentiment = EXCLUDED.sentiment, details = EXCLUDED.details;`,
+		indexID, sentiment, string(details))
+	return err
+}
+
+// insertPageHTML stores the raw HTML of a web page gzip compressed, so it can
+// be processed again later (one row per index_id, replaced every time the page
+// is indexed)
+func insertPageHTML(tx *sql.Tx, indexID uint64, html string) error {
+	if html == "" {
+		_, err := tx.Exec(`DELETE FROM PageHTML WHERE index_id = $1;`, indexID)
+		return err
+	}
+
+	compressed, err := compressHTML(html)
+	if err != nil {
+		return fmt.Errorf("compressing HTML: %v", err)
+	}
+	hash := sha256.Sum256([]byte(html))
+	_, err = tx.Exec(`
+		INSERT INTO PageHTML (index_id, html_hash, html_size, html_gzip)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (index_id) DO UPDATE
+		SET html_hash = EXCLUDED.html_hash, html_size = EXCLUDED.html_size, html_gzip = EXCLUDED.html_gzip;`,
+		indexID, hex.EncodeToString(hash[:]), len(html), compressed)
+	return err
+}
+
+// compressHTML returns the HTML gzip compressed
+func compressHTML(html string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(html)); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // insertKeywords inserts keywords extracted from a web page into the database.
 // It takes a transaction `tx` and a database connection `db` as parameters.
 // The `indexID` parameter represents the ID of the index associated with the keywords.
 // The `pageInfo` parameter contains information about the web page.
+// The keywords are stored in batches (a single statement stores the new
+// keywords of a batch, a single query returns their IDs and a single statement
+// links them to the page), instead of a round trip per keyword.
 // It returns an error if there is any issue with inserting the keywords into the database.
 func insertKeywords(tx *sql.Tx, db cdb.Handler, indexID uint64, pageInfo *PageInfo) error {
-	for _, keyword := range pageInfo.Keywords {
-		keywordID, err := insertKeywordWithRetries(db, keyword)
+	keywords := uniqueKeywords(pageInfo.Keywords)
+	for start := 0; start < len(keywords); start += keywordsBatch {
+		batch := keywords[start:min(start+keywordsBatch, len(keywords))]
+
+		var keywordIDs map[string]int64
+		var err error
+		if db.DBMS() == cdb.DBSQLiteStr {
+			// SQLite has a single writer (the page transaction), so the
+			// keywords are stored in the page transaction
+			keywordIDs, err = storeKeywords(tx.Exec, tx.Query, batch)
+		} else {
+			keywordIDs, err = storeKeywordsWithRetries(db, batch)
+		}
 		if err != nil {
 			return err
 		}
-		// Use ON CONFLICT DO NOTHING to ignore the insert if the keyword_id and index_id combination already exists
-		_, err = tx.Exec(`
-            INSERT INTO KeywordIndex (keyword_id, index_id)
-            VALUES ($1, $2)
-            ON CONFLICT (keyword_id, index_id) DO NOTHING;`, keywordID, indexID)
-		if err != nil {
+		if err := insertKeywordIndex(tx, indexID, batch, keywordIDs, pageInfo.KeywordTags); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// uniqueKeywords returns the keywords of a page as they are stored: truncated
+// to the size of the keyword column, deduplicated and sorted (always storing
+// the keywords in the same order avoids deadlocks with other pages being
+// indexed at the same time)
+func uniqueKeywords(keywords []string) []string {
+	seen := make(map[string]bool, len(keywords))
+	unique := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strLeft(keyword, 256)
+		if !seen[keyword] {
+			seen[keyword] = true
+			unique = append(unique, keyword)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// insertKeywordIndex links the keywords (with the given IDs) to the page
+// index entry, with a single statement. The keywords captured by a keyword
+// rule are tagged with the rule name (tags).
+func insertKeywordIndex(tx *sql.Tx, indexID uint64, keywords []string, keywordIDs map[string]int64, tags map[string]string) error {
+	values := make([]string, 0, len(keywords))
+	args := make([]interface{}, 0, 3*len(keywords))
+	for _, keyword := range keywords {
+		keywordID, ok := keywordIDs[keyword]
+		if !ok {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "keyword '%s' not found after storing it", keyword)
+			continue
+		}
+		var ruleName interface{}
+		if tag, ok := tags[keyword]; ok {
+			ruleName = tag
+		}
+		args = append(args, keywordID, indexID, ruleName)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d)", len(args)-2, len(args)-1, len(args)))
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	// The keyword_id and index_id combinations that already exist only get their tag updated
+	_, err := tx.Exec(`INSERT INTO KeywordIndex (keyword_id, index_id, rule_name) VALUES `+
+		strings.Join(values, ", ")+` ON CONFLICT (keyword_id, index_id) DO UPDATE SET rule_name = EXCLUDED.rule_name`, args...)
+	return err
+}
+
 // rollbackTransaction rolls back a transaction.
 // It takes a pointer to a sql.Tx as input and rolls back the transaction.
 // If an error occurs during the rollback, it logs the error.
@@ -1554,44 +2571,74 @@ func commitTransaction(tx *sql.Tx) error {
 	return nil
 }
 
-// insertKeywordWithRetries is responsible for storing the extracted keywords in the database
-// It's written to be efficient and avoid deadlocks, but this right now is not required
-// because indexPage uses a mutex to ensure that only one goroutine is indexing a page
-// at a time. However, when implementing multiple transactions in indexPage, this function
-// will be way more useful than it is now.
-func insertKeywordWithRetries(db cdb.Handler, keyword string) (int, error) {
+// storeKeywords stores the keywords (the new ones) with a single statement and
+// returns the IDs of all of them (by keyword) with a single query. The exec
+// and query functions are the ones of the transaction or database connection
+// the keywords are stored with. The IDs are mapped by the exact keyword (the
+// MySQL keyword column has a binary collation for this, as its default one
+// is accent and case insensitive and would return "café" for "cafe").
+func storeKeywords(exec func(string, ...interface{}) (sql.Result, error),
+	query func(string, ...interface{}) (*sql.Rows, error), keywords []string) (map[string]int64, error) {
+	placeholders := make([]string, len(keywords))
+	args := make([]interface{}, len(keywords))
+	for i, keyword := range keywords {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = keyword
+	}
+
+	_, err := exec(`INSERT INTO Keywords (keyword) VALUES (`+
+		strings.Join(placeholders, "), (")+`) ON CONFLICT (keyword) DO NOTHING`, args...)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := query(`SELECT keyword_id, keyword FROM Keywords WHERE keyword IN (`+
+		strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // We can't check the error in a defer
+
+	keywordIDs := make(map[string]int64, len(keywords))
+	for rows.Next() {
+		var keywordID int64
+		var keyword string
+		if err := rows.Scan(&keywordID, &keyword); err != nil {
+			return nil, err
+		}
+		keywordIDs[keyword] = keywordID
+	}
+	return keywordIDs, rows.Err()
+}
+
+// storeKeywordsWithRetries is responsible for storing the extracted keywords in the database
+// It's written to be efficient and avoid deadlocks with other pages being indexed at the
+// same time (keywords are shared between pages, so they are stored outside of the page
+// transaction).
+func storeKeywordsWithRetries(db cdb.Handler, keywords []string) (map[string]int64, error) {
 	const maxRetries = 3
-	var keywordID int
 
 	// Before updating the source state, check if the database connection is still alive
 	err := db.CheckConnection(config)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, dbConnCheckErr, err)
-		return 0, err
-	}
-
-	if len(keyword) > 256 {
-		keyword = keyword[:256]
+		return nil, err
 	}
 
 	for i := 0; i < maxRetries; i++ {
-		err := db.QueryRow(`INSERT INTO Keywords (keyword)
-                            VALUES ($1) ON CONFLICT (keyword) DO UPDATE
-                            SET keyword = EXCLUDED.keyword RETURNING keyword_id`, keyword).
-			Scan(&keywordID)
+		keywordIDs, err := storeKeywords(db.Exec, db.ExecuteQuery, keywords)
 		if err != nil {
 			if strings.Contains(err.Error(), "deadlock detected") {
 				if i == maxRetries-1 {
-					return 0, err
+					return nil, err
 				}
 				time.Sleep(time.Duration(i) * 100 * time.Millisecond) // Exponential backoff
 				continue
 			}
-			return 0, err
+			return nil, err
 		}
-		return keywordID, nil
+		return keywordIDs, nil
 	}
-	return 0, fmt.Errorf("failed to insert keyword after retries: %s", keyword)
+	return nil, fmt.Errorf("failed to insert %d keywords after retries", len(keywords))
 }
 
 func addXHRHook(wd vdi.WebDriver) error {
@@ -2264,35 +3311,142 @@ func deepConvertJSON(value interface{}) interface{} {
 	}
 }
 
-// getURLContent is responsible for retrieving the HTML content of a page
-// from Selenium and returning it as a vdi.WebDriver object
-func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext) (vdi.WebDriver, string, error) {
-	// Check if the vdi.WebDriver is still alive
-	if wd == nil {
-		return nil, "", errors.New("WebDriver is nil")
+// navigateTo loads url in the VDI session (with the referer, if any, as the
+// Referer of the navigation), giving up if crawlCtx is cancelled first. A
+// WebDriver call can't be interrupted, so an abandoned navigation completes
+// in the background (the session is closed with the crawl).
+func navigateTo(crawlCtx context.Context, wd vdi.WebDriver, url, referer string) error {
+	if crawlCtx == nil {
+		return loadPage(wd, url, referer)
+	}
+	if err := crawlCtx.Err(); err != nil {
+		return fmt.Errorf("navigation to %s cancelled: %w", url, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- loadPage(wd, url, referer)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-crawlCtx.Done():
+		return fmt.Errorf("navigation to %s cancelled: %w", url, crawlCtx.Err())
 	}
+}
 
-	if ctx.VDIReturned {
-		// If the VDI session is returned, return the WebDriver
-		return wd, "", nil
+// loadPage loads url in the VDI session. A referer is sent as the Referer of
+// this navigation only (not of the requests of the page, nor of the following
+// navigations): it's passed to the CDP Page.navigate command, so only the
+// Chrome/Chromium sessions send it, the others load the page without it.
+func loadPage(wd vdi.WebDriver, url, referer string) error {
+	if referer == "" {
+		return wd.Get(url)
+	}
+	result, err := wd.ExecuteChromeDPCommand("Page.navigate", map[string]interface{}{
+		"url":      url,
+		"referrer": referer,
+	})
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "navigating to %s with the Referer %s: %v", url, referer, err)
+		return wd.Get(url)
+	}
+	if navigation, ok := result.(map[string]interface{}); ok {
+		if errorText, _ := navigation["errorText"].(string); errorText != "" {
+			return fmt.Errorf("navigation to %s failed: %s", url, errorText)
+		}
 	}
+	return nil
+}
 
-	// check if webdriver session is still good, if not open a new one
-	_, err := wd.CurrentURL()
-	if err != nil {
-		if strings.Contains(strings.ToLower(strings.TrimSpace(err.Error())), "invalid Session id") {
-			// If the session is not found, create a new one
-			err = ctx.ConnectToVDI((*ctx).SelInstance)
-			wd = ctx.wd
+// navigateWithRetries navigates to url (with the referer, if any, as the
+// Referer of the navigation), retrying the failed navigations up to
+// retries times with an exponential backoff (starting from delay). Before
+// each retry the VDI session is checked and, if it's no longer valid, a new
+// one is created with reconnect. A lost session is always reconnected (and
+// the navigation retried) once, even without retries. It returns the
+// WebDriver of the session used by the successful navigation.
+func navigateWithRetries(crawlCtx context.Context, wd vdi.WebDriver, url, referer string, retries int, delay time.Duration, reconnect func() (vdi.WebDriver, error)) (vdi.WebDriver, error) {
+	err := navigateTo(crawlCtx, wd, url, referer)
+	for attempt := 1; err != nil; attempt++ {
+		lost := isSessionLost(err)
+		if (attempt > retries && !(attempt == 1 && lost)) || (crawlCtx != nil && crawlCtx.Err() != nil) {
+			return nil, fmt.Errorf("failed to navigate to %s: %v", url, err)
+		}
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Retrying navigation to %s (attempt %d) in %v: %v", url, attempt, delay, err)
+		if !lost {
+			if !sleepWithContext(crawlCtx, delay) {
+				return nil, fmt.Errorf("failed to navigate to %s: %v", url, err)
+			}
+			delay *= 2
+			_, cerr := wd.CurrentURL()
+			lost = cerr != nil && isSessionLost(cerr)
+		}
+		if lost {
+			// The session is no longer valid, create a new one
+			wd, err = reconnect()
 			if err != nil {
-				return nil, "", fmt.Errorf("failed to create a new WebDriver session: %v", err)
+				return nil, fmt.Errorf("failed to create a new WebDriver session: %v", err)
 			}
 		}
+		err = navigateTo(crawlCtx, wd, url, referer)
 	}
+	return wd, nil
+}
 
-	// Check if the URL is empty
-	url = strings.TrimSpace(url)
-	if url == "" {
+// isSessionLost returns true if a WebDriver error means that the VDI session
+// is no longer valid
+func isSessionLost(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "invalid session id") || strings.Contains(msg, "unable to find session with id")
+}
+
+// sleepWithContext waits for delay, returning false if crawlCtx is cancelled
+// first
+func sleepWithContext(crawlCtx context.Context, delay time.Duration) bool {
+	if crawlCtx == nil {
+		time.Sleep(delay)
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-crawlCtx.Done():
+		return false
+	}
+}
+
+// getURLContent is responsible for retrieving the HTML content of a page
+// from Selenium and returning it as a vdi.WebDriver object. The navigation is
+// abandoned if crawlCtx is cancelled.
+func getURLContent(crawlCtx context.Context, url string, wd vdi.WebDriver, level int, ctx *ProcessContext) (vdi.WebDriver, string, error) {
+	// Check if the vdi.WebDriver is still alive
+	if wd == nil {
+		return nil, "", errors.New("WebDriver is nil")
+	}
+
+	if ctx.VDIReturned {
+		// If the VDI session is returned, return the WebDriver
+		return wd, "", nil
+	}
+
+	// check if webdriver session is still good, if not open a new one
+	_, err := wd.CurrentURL()
+	if err != nil {
+		if isSessionLost(err) {
+			// If the session is not found, create a new one
+			err = ctx.ConnectToVDI((*ctx).SelInstance)
+			wd = ctx.wd
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to create a new WebDriver session: %v", err)
+			}
+		}
+	}
+
+	// Check if the URL is empty
+	url = strings.TrimSpace(url)
+	if url == "" {
 		return nil, "", errors.New("URL is empty")
 	}
 
@@ -2324,22 +3478,13 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 	}
 
 	// Navigate to a page and interact with elements.
-	if err := wd.Get(url); err != nil {
-		if strings.Contains(strings.ToLower(strings.TrimSpace(err.Error())), "unable to find session with id") {
-			// If the session is not found, create a new one
-			err = ctx.ConnectToVDI((*ctx).SelInstance)
-			wd = ctx.wd
-			if err != nil {
-				return nil, "", fmt.Errorf("failed to create a new WebDriver session: %v", err)
-			}
-			// Retry navigating to the page
-			err := wd.Get(url)
-			if err != nil {
-				return nil, "", fmt.Errorf("failed to navigate to %s: %v", url, err)
-			}
-		} else {
-			return nil, "", fmt.Errorf("failed to navigate to %s: %v", url, err)
-		}
+	retryDelay := time.Duration(ctx.config.Crawler.PageRetryDelay) * time.Second
+	wd, err = navigateWithRetries(crawlCtx, wd, url, ctx.referer, ctx.config.Crawler.PageRetries, retryDelay, func() (vdi.WebDriver, error) {
+		err := ctx.ConnectToVDI((*ctx).SelInstance)
+		return ctx.wd, err
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
 	// Add XHR Hook (before any request is made, but after the page is loaded)
@@ -2351,7 +3496,7 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 	}
 
 	// Wait for Page to Load
-	delay := exi.GetFloat(ctx.config.Crawler.Interval)
+	delay := exi.GetFloatWithRand(ctx.config.Crawler.Interval, ctx.rng)
 	if delay <= 0 {
 		delay = 3
 	}
@@ -2379,8 +3524,8 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 			return wd, docType, fmt.Errorf("failed to get current URL after navigation: %v", err)
 		}
 
-		// Run Action Rules if any
-		processActionRules(&wd, ctx, url)
+		// Run Action Rules if any (and Scraping Rules first, if requested)
+		ctx.runPageActionRules(&wd, url)
 	}
 
 	// Get Post-Actions Cookies (if any)
@@ -2404,18 +3549,21 @@ func getURLContent(url string, wd vdi.WebDriver, level int, ctx *ProcessContext)
 func changeUserAgent(wd *vdi.WebDriver, ctx *ProcessContext) error {
 	var err error
 
-	// Get the User Agent
-	userAgent := cmn.UADB.GetAgentByTypeAndOSAndBRG(ctx.config.Crawler.Platform, ctx.config.Crawler.BrowserPlatform, ctx.config.Selenium[ctx.SelID].Type)
-	if userAgent == "" {
-		if ctx.config.Crawler.Platform == "desktop" {
-			userAgent = cmn.UsrAgentStrMap[ctx.config.Selenium[ctx.SelID].Type+"-desktop01"]
-		} else {
-			userAgent = cmn.UsrAgentStrMap[ctx.config.Selenium[ctx.SelID].Type+"-mobile01"]
-		}
+	// Get the User Agent (picked as for a new VDI session)
+	browser := strings.ToLower(strings.TrimSpace(ctx.config.Selenium[ctx.SelID].Type))
+	if browser == "" {
+		browser = vdi.BrowserChrome
+	}
+	var browseType int
+	if ctx.config.Crawler.Platform == optBrowsingMobile {
+		browseType = 1
 	}
+	userAgent := vdi.PickUserAgent(&ctx.config.Crawler, ctx.rng, browser, browseType)
+
+	userAgent = ctx.config.Crawler.ContactUserAgent(userAgent)
 
 	// Check if the browser is Chrome and CDP is available
-	if ctx.config.Selenium[ctx.SelID].Type == "chrome" {
+	if browser == vdi.BrowserChrome {
 		_, err = (*wd).ExecuteChromeDPCommand("Network.setUserAgentOverride", map[string]interface{}{
 			"userAgent": userAgent,
 			"platform":  ctx.config.Crawler.Platform,
@@ -2552,11 +3700,58 @@ func changeUserAgentCDP(pctx *ProcessContext, userAgent string) error {
 	return nil
 }
 
+// requestHeaders returns the headers of the requests the crawler makes outside
+// of the VDI sessions: the User-Agent (with the operator contact URL) and the
+// crawler identity headers
+func requestHeaders(crawler *cfg.Crawler, userAgent string) map[string]string {
+	headers := crawler.IdentityHeaders()
+	headers["User-Agent"] = crawler.ContactUserAgent(userAgent)
+	return headers
+}
+
+// getDelay returns the delay (in seconds) between the requests of a crawl:
+// the configured delay, raised to the Source robots.txt Crawl-delay (if any)
+func getDelay(ctx *ProcessContext) float64 {
+	delay := 0.0
+	if ctx.config.Crawler.Delay != "0" {
+		delay = exi.GetFloatWithRand(ctx.config.Crawler.Delay, ctx.rng)
+	}
+	if ctx.source == nil {
+		return delay
+	}
+	if rules := ctx.robotsRules(ctx.source.URL); rules != nil && rules.CrawlDelay() > delay {
+		delay = rules.CrawlDelay()
+	}
+	return delay
+}
+
+// setReferer sets the Referer of the next navigations of the VDI session (and
+// of the documents they download) to the page linking to the page being
+// crawled (if the Referer is sent): some sites serve different content or
+// block the requests without a plausible one. An empty referer removes it.
+func (ctx *ProcessContext) setReferer(referer string) {
+	if !ctx.config.Crawler.SendReferer {
+		ctx.referer = ""
+		return
+	}
+	ctx.referer = strings.TrimSpace(referer)
+}
+
+// documentHeaders returns the headers of the requests downloading the
+// documents (with the Referer of the VDI session, if any)
+func (ctx *ProcessContext) documentHeaders() map[string]string {
+	headers := requestHeaders(&ctx.config.Crawler, robotsFetchAgent)
+	if ctx.referer != "" {
+		headers["Referer"] = ctx.referer
+	}
+	return headers
+}
+
 func vdiSleep(ctx *ProcessContext, delay float64) error {
 	driver := ctx.wd
 
-	if delay < 3 {
-		delay = 3
+	if delay < vdiMinSleep {
+		delay = vdiMinSleep
 	}
 
 	divider := math.Log10(delay+1) * 10 // Adjust multiplier as needed
@@ -2619,11 +3814,17 @@ func extractPageInfo(webPage *vdi.WebDriver, ctx *ProcessContext, docType string
 
 	// Detect Object Type
 	objType := docType
-	title := currentURL
-	summary := ""
 	bodyText := ""
 	htmlContent := ""
-	metaTags := []MetaTag{}
+	var doc *goquery.Document
+	var published, modified time.Time
+	forms := []PageForm{}
+	var media []MediaInfo
+	var breadcrumbs []string
+	canonicalURL := ""
+	ampURL := ""
+	ampContent := false
+	var document *PageInfo // The content of the documents extracted by a document extractor
 	scrapedList := []ScrapedItem{}
 
 	// Copy the current webPage object
@@ -2631,11 +3832,22 @@ func extractPageInfo(webPage *vdi.WebDriver, ctx *ProcessContext, docType string
 
 	// Get the HTML content of the page
 	if docTypeIsHTML(objType) {
+		ctx.interactLikeHuman(webPage, currentURL)
+		ctx.scrollBeforeExtract(webPage, currentURL)
+
+		var err error
 		htmlContent, _ = (*webPage).PageSource()
-		doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+		if ctx.config.Crawler.NormalizeEncoding {
+			// Pages in legacy encodings (e.g., Shift_JIS) are extracted as UTF-8
+			htmlContent = normalizeEncoding(htmlContent, ctx.pageContentType(currentURL))
+		}
+		doc, err = parseHTMLDocument(htmlContent)
 		if err != nil {
-			cmn.DebugMsg(cmn.DbgLvlError, "loading HTML content, during Page Info Extraction: %v", err)
-			return err
+			// Not fatal, we still index the page (without its content)
+			ctx.recordWarning("loading HTML content of %s, during Page Info Extraction: %v", currentURL, err)
+			(*PageCache).Title = currentURL
+			(*PageCache).Errors = append((*PageCache).Errors, err.Error())
+			return nil
 		}
 
 		// Run scraping rules if any
@@ -2643,7 +3855,7 @@ func extractPageInfo(webPage *vdi.WebDriver, ctx *ProcessContext, docType string
 		var url string
 		url, err = (*webPage).CurrentURL()
 		if err == nil {
-			scrapedData, err = processScrapingRules(&webPageCopy, ctx, url)
+			scrapedData, err = ctx.pageScrapedData(&webPageCopy, url)
 			if err != nil {
 				if strings.Contains(err.Error(), errCriticalError) {
 					return err
@@ -2668,24 +3880,11 @@ func extractPageInfo(webPage *vdi.WebDriver, ctx *ProcessContext, docType string
 			// append the map to the list
 			scrapedList = append(scrapedList, scrapedMap)
 			ctx.Status.TotalScraped++
-		}
-		cmn.DebugMsg(cmn.DbgLvlDebug3, "Scraped Data (JSON): %v", scrapedList)
 
-		title, _ = (*webPage).Title()
-		// To get the summary, we extract the content of the "description" meta tag
-		// if description tag is not found, we extract the content of og:description tag
-		// if og:description tag is not found, we extract the content of twitter:description tag
-		// if none of the above tags are found, we extract the first 200 characters of the body text
-		tmp := doc.Find("meta[name=description]").AttrOr("content", "")
-		if strings.TrimSpace(tmp) == "" {
-			tmp = doc.Find("meta[property=og:description]").AttrOr("content", "")
-		}
-		if strings.TrimSpace(tmp) == "" {
-			tmp = doc.Find("meta[name=twitter:description]").AttrOr("content", "")
-		}
-		if strings.TrimSpace(tmp) != "" {
-			summary = tmp
+			// Stop the crawl if we found what we were looking for
+			ctx.checkStopCondition(url, scrapedList)
 		}
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "Scraped Data (JSON): %v", scrapedList)
 
 		// copy doc to avoid modifying the original
 		docCopy := doc.Clone()
@@ -2693,24 +3892,53 @@ func extractPageInfo(webPage *vdi.WebDriver, ctx *ProcessContext, docType string
 		docCopy.Find("script").Each(func(_ int, s *goquery.Selection) {
 			s.Remove()
 		})
-		bodyText = docCopy.Find("body").Text()
-		// transform tabs into spaces
-		bodyText = strings.ReplaceAll(bodyText, "\t", " ")
-		// remove excessive spaces in bodyText
-		bodyText = strings.Join(strings.Fields(bodyText), " ")
-		if strings.TrimSpace(summary) == "" {
-			// If we don't have a summary, extract the first 200 characters of the body text
-			summary = bodyText
-			if len(summary) > 200 {
-				summary = summary[:200]
-			}
-		}
+		bodyText = normalizeWhitespace(docCopy.Find("body").Text(), ctx.config.Crawler.Whitespace)
 		// Clear docCopy
 		docCopy = nil
 
-		if ctx.config.Crawler.CollectMetaTags {
-			// Extract meta tags from the document
-			metaTags = extractMetaTags(doc)
+		// Get the publish and modified dates (news, blogs etc.)
+		published, modified = extractPageDates(doc)
+
+		if ctx.config.Crawler.CollectForms {
+			// Extract the forms structure from the document
+			forms = extractForms(doc, currentURL)
+		}
+
+		if ctx.config.Crawler.CollectMedia {
+			// Extract the video and audio media (and the embedded players)
+			media = extractMedia(doc, ctx.linksBaseURL(doc, currentURL))
+		}
+
+		if ctx.config.Crawler.CollectBreadcrumbs {
+			// Extract the breadcrumb trail (the page place in the site hierarchy)
+			breadcrumbs = extractBreadcrumbs(doc)
+		}
+
+		// Get the canonical URL of the page (if it declares one)
+		canonicalURL = extractCanonicalURL(doc, ctx.linksBaseURL(doc, currentURL))
+
+		// Get the AMP version of the page (if it declares one), its content is
+		// often cleaner to extract
+		ampURL = extractAMPURL(doc, ctx.linksBaseURL(doc, currentURL))
+		if ampURL != "" && ctx.config.Crawler.AMP.Prefer {
+			info, err := extractDocument(ampURL, "text/html", ctx.documentHeaders(), rotateProxies(ctx.config.HTTPHeaders.Proxies, ctx.rng))
+			if err != nil {
+				ctx.recordWarning("extracting the AMP version of %s: %v", currentURL, err)
+			} else if text := normalizeWhitespace(info.BodyText, ctx.config.Crawler.Whitespace); text != "" {
+				cmn.DebugMsg(cmn.DbgLvlDebug3, "Extracting the content of %s from its AMP version %s", currentURL, ampURL)
+				bodyText = text
+				ampContent = true
+			}
+		}
+	} else if documentExtractor(objType) != nil {
+		// Extract the content of the document (e.g. the text of a PDF)
+		info, err := extractDocument(currentURL, objType, ctx.documentHeaders(), rotateProxies(ctx.config.HTTPHeaders.Proxies, ctx.rng))
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "%v", err)
+			PageCache.Errors = append(PageCache.Errors, err.Error())
+		} else {
+			document = &info
+			bodyText = normalizeWhitespace(info.BodyText, ctx.config.Crawler.Whitespace)
 		}
 	} else {
 		// Download the web object and store it in the database
@@ -2719,19 +3947,109 @@ func extractPageInfo(webPage *vdi.WebDriver, ctx *ProcessContext, docType string
 		}
 	}
 
+	// Truncate the (multi-megabyte) body texts, e.g. of the infinite-scroll feeds
+	bodyText, truncated := truncateBodyText(bodyText, ctx.config.Crawler.MaxBodyTextBytes)
+	if truncated {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Body text of %s truncated to %d bytes", currentURL, ctx.config.Crawler.MaxBodyTextBytes)
+	}
+
 	// Update the PageInfo object
-	(*PageCache).Title = title
-	(*PageCache).Summary = summary
+	(*PageCache).Title = currentURL
+	(*PageCache).Summary = ""
 	(*PageCache).BodyText = bodyText
+	(*PageCache).Truncated = truncated
 	(*PageCache).HTML = htmlContent
-	(*PageCache).MetaTags = metaTags
-	(*PageCache).DetectedLang = detectLang((*webPage))
+	(*PageCache).MetaTags = []MetaTag{}
+	(*PageCache).Forms = forms
+	(*PageCache).Media = media
+	(*PageCache).Breadcrumbs = breadcrumbs
+	(*PageCache).CanonicalURL = canonicalURL
+	(*PageCache).AMPURL = ampURL
+	(*PageCache).AMPContent = ampContent
 	(*PageCache).DetectedType = objType
+	(*PageCache).Extracted = nil
+	if document != nil {
+		if document.Title != "" {
+			(*PageCache).Title = document.Title
+		}
+		(*PageCache).Summary = document.Summary
+		if len(document.MetaTags) > 0 {
+			(*PageCache).MetaTags = document.MetaTags
+		}
+		(*PageCache).DetectedLang = document.DetectedLang
+	}
+
+	// Run the content extractors (title, summary, meta tags, language and the
+	// custom ones)
+	runContentExtractors(&ExtractorPage{
+		URL:       currentURL,
+		DocType:   objType,
+		Doc:       doc,
+		BodyText:  bodyText,
+		WebDriver: *webPage,
+		Config:    &ctx.config,
+	}, PageCache)
+	(*PageCache).Summary = normalizeWhitespace((*PageCache).Summary, ctx.config.Crawler.Whitespace)
+	(*PageCache).PublishedAt = pageDatePtr(published)
+	(*PageCache).ModifiedAt = pageDatePtr(modified)
 	(*PageCache).ScrapedData = scrapedList
 
+	// Enrich the body text (sentiment, entities and topics), if configured
+	(*PageCache).Enrichment = ctx.enrichPage(currentURL, bodyText, (*PageCache).DetectedLang)
+
 	return nil
 }
 
+// bodyTextTruncatedMarker ends the truncated body texts
+const bodyTextTruncatedMarker = " [truncated]"
+
+// truncateBodyText returns the body text truncated to maxBytes bytes (marker
+// included), without splitting its multibyte characters, and whether it has
+// been truncated. 0 means unlimited.
+func truncateBodyText(text string, maxBytes int) (string, bool) {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return text, false
+	}
+	marker := bodyTextTruncatedMarker
+	if maxBytes <= len(marker) {
+		marker = ""
+	}
+	cut := maxBytes - len(marker)
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + marker, true
+}
+
+// zeroWidthChars strips the zero-width characters (spaces, joiners and BOM)
+var zeroWidthChars = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "")
+
+// normalizeWhitespace normalizes the whitespace of the text extracted from a
+// page (as configured): runs of whitespace become a single space (or a single
+// line break, keeping the lines) and the text is trimmed
+func normalizeWhitespace(text string, ws cfg.Whitespace) string {
+	if ws.StripZeroWidth {
+		text = zeroWidthChars.Replace(text)
+	}
+	switch ws.Mode {
+	case cfg.WhitespaceNone:
+		return text
+	case cfg.WhitespaceLines:
+		lines := strings.FieldsFunc(text, func(r rune) bool {
+			return r == '\n' || r == '\r' || r == '\v' || r == '\f' || r == '\u2028' || r == '\u2029'
+		})
+		normalized := make([]string, 0, len(lines))
+		for _, line := range lines {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				normalized = append(normalized, line)
+			}
+		}
+		return strings.Join(normalized, "\n")
+	default:
+		return strings.Join(strings.Fields(text), " ")
+	}
+}
+
 // removeImpurities removes invalid JSON characters from a string, avoiding sequences like ",," or ",false,"
 func removeImpurities(s string) string {
 	var result strings.Builder
@@ -2841,6 +4159,82 @@ func extractMetaTags(doc *goquery.Document) []MetaTag {
 	return metaTags
 }
 
+// extractForms extracts the structure of the forms in a web page (action, method
+// and fields), resolving the form's action against the page URL.
+func extractForms(doc *goquery.Document, pageURL string) []PageForm {
+	forms := []PageForm{}
+	baseURL, _ := url.Parse(pageURL)
+
+	doc.Find("form").Each(func(_ int, f *goquery.Selection) {
+		form := PageForm{
+			ID:     strings.TrimSpace(f.AttrOr("id", "")),
+			Name:   strings.TrimSpace(f.AttrOr("name", "")),
+			Action: strings.TrimSpace(f.AttrOr("action", "")),
+			Method: strings.ToUpper(strings.TrimSpace(f.AttrOr("method", ""))),
+			Fields: []FormField{},
+		}
+		if form.Method == "" {
+			form.Method = http.MethodGet
+		}
+		// An empty action means the form is submitted to the page itself
+		if baseURL != nil {
+			if action, err := url.Parse(form.Action); err == nil {
+				form.Action = baseURL.ResolveReference(action).String()
+			}
+		}
+
+		f.Find("input, select, textarea").Each(func(_ int, field *goquery.Selection) {
+			fieldType := goquery.NodeName(field)
+			if fieldType == "input" {
+				fieldType = strings.ToLower(strings.TrimSpace(field.AttrOr("type", "text")))
+				if fieldType == "" {
+					fieldType = "text"
+				}
+				// Skip buttons, they don't collect any data
+				if fieldType == "submit" || fieldType == "reset" || fieldType == "button" || fieldType == "image" {
+					return
+				}
+			}
+			_, required := field.Attr("required")
+			form.Fields = append(form.Fields, FormField{
+				Name:     strings.TrimSpace(field.AttrOr("name", "")),
+				ID:       strings.TrimSpace(field.AttrOr("id", "")),
+				Type:     fieldType,
+				Label:    formFieldLabel(doc, field),
+				Required: required,
+			})
+		})
+		forms = append(forms, form)
+	})
+
+	return forms
+}
+
+// formFieldLabel returns the label of a form field, looking for (in order)
+// a label element referencing the field, a label element wrapping the field,
+// the aria-label attribute and the placeholder attribute.
+func formFieldLabel(doc *goquery.Document, field *goquery.Selection) string {
+	if id := strings.TrimSpace(field.AttrOr("id", "")); id != "" {
+		label := doc.Find("label").FilterFunction(func(_ int, l *goquery.Selection) bool {
+			return l.AttrOr("for", "") == id
+		})
+		if text := strings.Join(strings.Fields(label.First().Text()), " "); text != "" {
+			return text
+		}
+	}
+	if parent := field.Closest("label"); parent.Length() > 0 {
+		label := parent.Clone()
+		label.Find("input, select, textarea").Remove()
+		if text := strings.Join(strings.Fields(label.Text()), " "); text != "" {
+			return text
+		}
+	}
+	if text := strings.TrimSpace(field.AttrOr("aria-label", "")); text != "" {
+		return text
+	}
+	return strings.TrimSpace(field.AttrOr("placeholder", ""))
+}
+
 // IsValidURL checks if the string is a valid URL.
 func IsValidURL(u string) bool {
 	// Check the obvious
@@ -2884,13 +4278,103 @@ func IsValidURIProtocol(u string) bool {
 	return found
 }
 
+// extractSummary returns the summary of a page, taken from the first non-empty
+// source in the given (comma separated) preference order. Supported sources are:
+// meta_description, og_description, twitter_description, first_paragraph, lead
+// (the first paragraph of the page's main content) and body_text.
+func extractSummary(doc *goquery.Document, bodyText string, sources string) string {
+	for _, source := range strings.Split(sources, ",") {
+		var summary string
+		switch strings.ToLower(strings.TrimSpace(source)) {
+		case "meta_description":
+			summary = doc.Find("meta[name='description']").AttrOr("content", "")
+		case "og_description":
+			summary = doc.Find("meta[property='og:description']").AttrOr("content", "")
+		case "twitter_description":
+			summary = doc.Find("meta[name='twitter:description']").AttrOr("content", "")
+		case "first_paragraph":
+			doc.Find("body p").EachWithBreak(func(_ int, p *goquery.Selection) bool {
+				summary = strings.Join(strings.Fields(p.Text()), " ")
+				return summary == ""
+			})
+			summary = strLeft(summary, summaryMaxLength)
+		case "lead":
+			summary = strLeft(leadParagraph(doc), summaryMaxLength)
+		case "body_text":
+			summary = strLeft(bodyText, summaryMaxLength)
+		default:
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "Unknown summary source: '%s'", source)
+		}
+		summary = strings.TrimSpace(summary)
+		if summary != "" {
+			return summary
+		}
+	}
+	return ""
+}
+
+// leadParagraph returns the lead of the page's main content (a simple readability
+// heuristic): the first paragraph of the main content that reads like prose,
+// skipping navigation, headers, footers and asides.
+func leadParagraph(doc *goquery.Document) string {
+	content := doc.Find("article, main, [role='main']").First()
+	if content.Length() == 0 {
+		content = doc.Find("body")
+	}
+
+	lead := ""
+	content.Find("p").EachWithBreak(func(_ int, p *goquery.Selection) bool {
+		if p.Closest("nav, header, footer, aside").Length() > 0 {
+			return true
+		}
+		words := strings.Fields(p.Text())
+		if len(words) < leadMinWords {
+			return true
+		}
+		lead = strings.Join(words, " ")
+		return false
+	})
+	return lead
+}
+
+// parseHTMLDocument parses the given HTML content, malformed HTML is parsed as browsers
+// do, while binary content (not HTML) and parser panics are reported as errors.
+func parseHTMLDocument(htmlContent string) (doc *goquery.Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			doc = nil
+			err = fmt.Errorf("parsing HTML: %v", r)
+		}
+	}()
+
+	if strings.ContainsRune(htmlContent, 0) {
+		return nil, errors.New("content is not valid HTML (binary data)")
+	}
+	return goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+}
+
+// recordWarning records a non-fatal problem found while processing a page
+func (ctx *ProcessContext) recordWarning(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	cmn.DebugMsg(cmn.DbgLvlWarn, "%s", msg)
+	if ctx.Status == nil {
+		return
+	}
+	ctx.errorsMutex.Lock()
+	ctx.Status.TotalWarnings++
+	ctx.Status.LastWarning = msg
+	ctx.errorsMutex.Unlock()
+}
+
 // extractLinks extracts all the links from the given HTML content.
 // It uses the goquery library to parse the HTML and find all the <a> tags.
-// Each link is then added to a slice and returned.
-func extractLinks(ctx *ProcessContext, htmlContent string, url string) []LinkItem {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
+// Each link is resolved against the page URL (pageURL), so the relative and
+// protocol-relative links are absolute, and then added to a slice and returned.
+func extractLinks(ctx *ProcessContext, htmlContent string, pageURL string) []LinkItem {
+	doc, err := parseHTMLDocument(htmlContent)
 	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, "loading HTML content: %v", err)
+		ctx.recordWarning("loading HTML content of %s, during links extraction: %v", pageURL, err)
+		return nil
 	}
 
 	// Find all the links in the document
@@ -2898,26 +4382,137 @@ func extractLinks(ctx *ProcessContext, htmlContent string, url string) []LinkIte
 	if ctx.config.Crawler.BrowsingMode == optBrowsingHuman ||
 		ctx.config.Crawler.BrowsingMode == optBrowsingRecu ||
 		ctx.config.Crawler.BrowsingMode == optBrowsingRCRecu {
+		base := ctx.linksBaseURL(doc, pageURL)
 		doc.Find("a").Each(func(_ int, item *goquery.Selection) {
 			linkTag := item
 			link, _ := linkTag.Attr("href")
-			link = normalizeURL(link, 0)
+			link = resolveLink(base, link)
 			linkItem := LinkItem{
-				PageURL:   url,  // URL of the page where the link was found (CurrentURL)
-				Link:      link, // Link to crawl
-				ElementID: item.AttrOr("id", ""),
+				PageURL:    pageURL, // URL of the page where the link was found (CurrentURL)
+				Link:       link,    // Link to crawl
+				ElementID:  item.AttrOr("id", ""),
+				AnchorText: anchorText(item),
 			}
 			if link != "" && IsValidURL(link) {
 				links = append(links, linkItem)
 			}
 		})
+		if ctx.config.Crawler.AMP.Crawl {
+			// Crawl the AMP version of the page too
+			if ampURL := extractAMPURL(doc, base); ampURL != "" {
+				links = append(links, LinkItem{PageURL: pageURL, Link: ampURL})
+			}
+		}
 	} else {
 		// Generate the link using fuzzing rules (crawling rules)
-		links = generateLinks(ctx, url)
+		links = generateLinks(ctx, pageURL)
 	}
 	return links
 }
 
+// linksPageURL returns the URL the links of a page are resolved against: its
+// current URL (where the redirects, if any, landed, with its trailing slash)
+// or, if it isn't known, the URL the page was requested with
+func linksPageURL(currentURL, pageURL string) string {
+	currentURL = strings.TrimSpace(currentURL)
+	if currentURL == "" || currentURL == "about:blank" {
+		return pageURL
+	}
+	return currentURL
+}
+
+// droppedLinkSchemes are the schemes of the links that aren't pages to crawl
+var droppedLinkSchemes = []string{"mailto:", "tel:", "javascript:"}
+
+// linksBaseURL returns the URL the links of a page are resolved against: the
+// page URL (resolved against the Source URL, if it's relative) or the page
+// <base href>, if it has one
+func (ctx *ProcessContext) linksBaseURL(doc *goquery.Document, pageURL string) *url.URL {
+	base, err := url.Parse(strings.TrimSpace(pageURL))
+	if err != nil {
+		base = &url.URL{}
+	}
+	if !base.IsAbs() && ctx.source != nil {
+		if source, err := url.Parse(strings.TrimSpace(ctx.source.URL)); err == nil {
+			base = source.ResolveReference(base)
+		}
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+	return base
+}
+
+// resolveLink returns the absolute URL of a link (resolved against the base
+// URL of its page, without the fragment), empty if it isn't a link to crawl:
+// the anchor-only links (to the page itself) and the mailto:, tel: and
+// javascript: links
+func resolveLink(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	lowerHref := strings.ToLower(href)
+	for _, scheme := range droppedLinkSchemes {
+		if strings.HasPrefix(lowerHref, scheme) {
+			return ""
+		}
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	link := base.ResolveReference(ref)
+	link.Fragment, link.RawFragment = "", ""
+	// The trailing slash is kept: relative links are resolved against it
+	return link.String()
+}
+
+// extractCanonicalURL returns the canonical URL of a page (its
+// <link rel="canonical">, resolved against the page base URL), empty if the
+// page doesn't declare an http(s) one
+func extractCanonicalURL(doc *goquery.Document, base *url.URL) string {
+	return extractRelLink(doc, base, "canonical")
+}
+
+// extractAMPURL returns the URL of the AMP version of a page (its
+// <link rel="amphtml">, resolved against the page base URL), empty if the
+// page doesn't declare an http(s) one
+func extractAMPURL(doc *goquery.Document, base *url.URL) string {
+	return extractRelLink(doc, base, "amphtml")
+}
+
+// extractRelLink returns the http(s) URL of the first <link> of a page with
+// the given rel, resolved against the page base URL
+func extractRelLink(doc *goquery.Document, base *url.URL, rel string) string {
+	href, ok := doc.Find("link[rel~='" + rel + "' i][href]").First().Attr("href")
+	if !ok {
+		return ""
+	}
+	link := resolveLink(base, href)
+	if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+		return ""
+	}
+	return link
+}
+
+// anchorText returns the text of a link: its content or, for links without
+// text (e.g. image links), its aria-label, title or image alt text
+func anchorText(item *goquery.Selection) string {
+	text := strings.Join(strings.Fields(item.Text()), " ")
+	if text != "" {
+		return text
+	}
+	for _, alt := range []string{item.AttrOr("aria-label", ""), item.AttrOr("title", ""), item.Find("img").AttrOr("alt", "")} {
+		if alt = strings.TrimSpace(alt); alt != "" {
+			return alt
+		}
+	}
+	return ""
+}
+
 // generateLinks generates links based on the crawling rules
 // TODO: This function needs improvements
 func generateLinks(ctx *ProcessContext, url string) []LinkItem {
@@ -3024,12 +4619,81 @@ func getDomainParts(parts []string, level uint) string {
 	}
 }
 
-// worker is the worker function that is responsible for crawling a page
-func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
+// sourceWorkers returns the number of page workers requested by a Source in its
+// custom crawler configuration ("workers"), or 0 if the Source doesn't override it
+func sourceWorkers(srcConfig *json.RawMessage) int {
+	if srcConfig == nil {
+		return 0
+	}
+	var sc struct {
+		Custom struct {
+			Crawler struct {
+				Workers *float64 `json:"workers"`
+			} `json:"crawler"`
+		} `json:"custom"`
+	}
+	if err := json.Unmarshal(*srcConfig, &sc); err != nil || sc.Custom.Crawler.Workers == nil {
+		return 0
+	}
+	workers := int(*sc.Custom.Crawler.Workers)
+	if workers < 1 {
+		cmn.DebugMsg(cmn.DbgLvlWarn, "Invalid source workers (%d), it must be at least 1, using the global workers setting", workers)
+		return 0
+	}
+	return workers
+}
+
+// crawlingWorkers returns the number of page workers to use for the Source: the
+// Source's own workers (if set) or the global workers minus the 2 reserved for
+// the network and HTTP information collection (at least 1)
+func (ctx *ProcessContext) crawlingWorkers() int {
+	if ctx.workers > 0 {
+		return ctx.workers
+	}
+	workers := config.Crawler.Workers - 2
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// startWorkers launches the page workers (that exit when crawlCtx is
+// cancelled), errors are sent to errChan. It returns the number of workers
+// launched.
+func (ctx *ProcessContext) startWorkers(crawlCtx context.Context, workers int, jobs chan LinkItem, errChan chan error) int {
+	for w := 1; w <= workers; w++ {
+		ctx.wg.Add(1)
+
+		go func(w int) {
+			defer ctx.wg.Done()
+			if err := worker(crawlCtx, ctx, w, jobs); err != nil {
+				// Send any error from the worker to the error channel
+				errChan <- err
+			}
+		}(w)
+	}
+	return workers
+}
+
+// worker is the worker function that is responsible for crawling a page. It
+// stops (leaving the remaining jobs pending) when crawlCtx is cancelled.
+func worker(crawlCtx context.Context, processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 	var skippedURLs []LinkItem
 
 	// Loop over the jobs channel and process each job
 	for url := range jobs {
+		if crawlCtx.Err() != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Stopping due to the crawl being cancelled\n", id)
+			break
+		}
+		if processCtx.isCrawlAborted() {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Stopping due to the crawl being aborted\n", id)
+			break
+		}
+		if processCtx.isTargetFound() {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Stopping due to the stop condition being matched\n", id)
+			break
+		}
 		if processCtx.config.Crawler.MaxLinks > 0 && (processCtx.Status.TotalPages >= processCtx.config.Crawler.MaxLinks) {
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Stopping due reached max_links limit: %d\n", id, processCtx.Status.TotalPages)
 			break
@@ -3042,15 +4706,17 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 		}
 
 		// Check if the URL should be skipped
-		skip := skipURL(processCtx, id, urlLink)
+		skip := skipURL(processCtx, id, urlLink, url.AnchorText)
 		if skip {
 			processCtx.Status.TotalSkipped++
 			skippedURLs = append(skippedURLs, url)
+			processCtx.setQueueStatus(url.Link, cdb.CrawlQueueDone)
 			continue
 		}
-		if processCtx.visitedLinks[cmn.NormalizeURL(urlLink)] {
+		if processCtx.visitedLinks.Has(cmn.NormalizeURL(urlLink)) {
 			// URL already visited
 			processCtx.Status.TotalDuplicates++
+			processCtx.setQueueStatus(url.Link, cdb.CrawlQueueDone)
 			cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: URL %s already visited\n", id, url.Link)
 			continue
 		}
@@ -3064,38 +4730,47 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Processing job %s\n", id, url.Link)
 		var err error
 		if strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingRecu {
-			err = processJob(processCtx, id, urlLink, skippedURLs)
+			err = processJob(crawlCtx, processCtx, id, urlLink, url.PageURL, skippedURLs)
 		} else if strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingRCRecu {
 			// Right Click Recursive Mode
-			err = rightClick(processCtx, id, url)
+			err = rightClick(crawlCtx, processCtx, id, url)
 		} else if strings.ToLower(strings.TrimSpace(processCtx.config.Crawler.BrowsingMode)) == optBrowsingHuman {
 			// Human Mode
 			// Find the <a> element that contains the URL and click it
-			err = clickLink(processCtx, id, url)
+			err = clickLink(crawlCtx, processCtx, id, url)
 		} else {
 			// Fuzzing Mode
 			// Fuzzy works like recursive, however instead of extracting links from the page, it generates links based on the crawling rules
-			err = processJob(processCtx, id, urlLink, skippedURLs)
+			err = processJob(crawlCtx, processCtx, id, urlLink, url.PageURL, skippedURLs)
+		}
+		if crawlCtx.Err() != nil {
+			// The job has been interrupted, leave it pending (to resume the crawl)
+			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Job %s interrupted, stopping due to the crawl being cancelled\n", id, url.Link)
+			break
 		}
-		processCtx.visitedLinks[cmn.NormalizeURL(urlLink)] = true
+		processCtx.visitedLinks.Add(cmn.NormalizeURL(urlLink))
 
 		if err == nil {
-			processCtx.Status.TotalPages++
+			processCtx.setQueueStatus(url.Link, cdb.CrawlQueueDone)
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Finished job %s\n", id, url.Link)
 		} else {
-			processCtx.Status.TotalErrors++
+			processCtx.setQueueStatus(url.Link, cdb.CrawlQueueError)
 			cmn.DebugMsg(cmn.DbgLvlDebug, "Worker %d: Finished job %s with an error: %v\n", id, url.Link, err)
 			if strings.Contains(err.Error(), errCriticalError) {
+				_ = processCtx.recordJobResult(err)
 				return err
 			}
 		}
+		if abortErr := processCtx.recordJobResult(err); abortErr != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: %v\n", id, abortErr)
+			return abortErr
+		}
 
 		// Clear the skipped URLs
 		skippedURLs = nil
 
 		// Delay before processing the next job
-		if processCtx.config.Crawler.Delay != "0" {
-			delay := exi.GetFloat(processCtx.config.Crawler.Delay)
+		if delay := getDelay(processCtx); delay > 0 {
 			processCtx.Status.LastDelay = delay
 			_ = vdiSleep(processCtx, delay)
 		}
@@ -3108,7 +4783,122 @@ func worker(processCtx *ProcessContext, id int, jobs chan LinkItem) error {
 	return nil
 }
 
-func skipURL(processCtx *ProcessContext, id int, url string) bool {
+// recordJobResult updates the pages and errors counters with the result of a job.
+// It returns an error (and aborts the crawl) when the Source exceeds the configured
+// max_consecutive_errors or max_error_rate, so we don't keep erroring through
+// thousands of URLs when a site goes down mid-crawl.
+func (ctx *ProcessContext) recordJobResult(jobErr error) error {
+	ctx.errorsMutex.Lock()
+	defer ctx.errorsMutex.Unlock()
+
+	if jobErr == nil {
+		ctx.Status.TotalPages++
+		ctx.Status.ConsecutiveErrors = 0
+		return nil
+	}
+	ctx.Status.TotalErrors++
+	ctx.Status.ConsecutiveErrors++
+	ctx.Status.LastError = jobErr.Error()
+
+	if ctx.crawlAborted {
+		return nil
+	}
+
+	reason := ""
+	maxConsec := ctx.config.Crawler.MaxConsecutiveErrors
+	if maxConsec > 0 && ctx.Status.ConsecutiveErrors >= maxConsec {
+		reason = fmt.Sprintf("%d consecutive errors", ctx.Status.ConsecutiveErrors)
+	}
+	processed := ctx.Status.TotalPages + ctx.Status.TotalErrors
+	maxRate := ctx.config.Crawler.MaxErrorRate
+	if reason == "" && maxRate > 0 && processed >= minPagesForErrorRate {
+		rate := float64(ctx.Status.TotalErrors) / float64(processed)
+		if rate > maxRate {
+			reason = fmt.Sprintf("error rate %.2f exceeds %.2f", rate, maxRate)
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+
+	ctx.crawlAborted = true
+	return fmt.Errorf("%s too many errors, aborting crawl: %s (%d errors over %d pages, last error: %v)",
+		errCriticalError, reason, ctx.Status.TotalErrors, processed, jobErr)
+}
+
+// isCrawlAborted returns true if the crawl has been aborted
+func (ctx *ProcessContext) isCrawlAborted() bool {
+	ctx.errorsMutex.Lock()
+	defer ctx.errorsMutex.Unlock()
+	return ctx.crawlAborted
+}
+
+// checkStopCondition checks the data scraped from a page against the configured
+// stop condition and, when it matches, stops the crawl of the Source early (for
+// targeted scrapes, there is no point in crawling the rest of a site once the
+// target has been found). It returns true if the stop condition matched.
+func (ctx *ProcessContext) checkStopCondition(url string, scraped []ScrapedItem) bool {
+	cond := ctx.config.Crawler.StopCondition
+	if cond.Key == "" {
+		return false
+	}
+
+	for _, item := range scraped {
+		if !matchStopCondition(cond, item) {
+			continue
+		}
+		ctx.errorsMutex.Lock()
+		if !ctx.targetFound {
+			ctx.targetFound = true
+			ctx.Status.TargetFound = true
+			ctx.Status.TargetURL = url
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Stop condition '%s' matched on '%s', stopping the crawl of source %d", cond.Key, url, ctx.source.ID)
+		}
+		ctx.errorsMutex.Unlock()
+		return true
+	}
+	return false
+}
+
+// isTargetFound returns true if the stop condition has matched
+func (ctx *ProcessContext) isTargetFound() bool {
+	ctx.errorsMutex.Lock()
+	defer ctx.errorsMutex.Unlock()
+	return ctx.targetFound
+}
+
+// matchStopCondition returns true if the scraped data contains the stop condition
+// key (nested keys are separated by dots) with a value that satisfies the condition
+func matchStopCondition(cond cfg.StopCondition, data map[string]interface{}) bool {
+	var value interface{} = data
+	for _, key := range strings.Split(cond.Key, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = obj[key]; !ok || value == nil {
+			return false
+		}
+	}
+
+	valueStr := fmt.Sprintf("%v", value)
+	if cond.Equals != "" && valueStr != cond.Equals {
+		return false
+	}
+	if cond.Matches != "" {
+		re, err := regexp.Compile(cond.Matches)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "compiling stop condition expression '%s': %v", cond.Matches, err)
+			return false
+		}
+		if !re.MatchString(valueStr) {
+			return false
+		}
+	}
+	return true
+}
+
+func skipURL(processCtx *ProcessContext, id int, url string, anchorText string) bool {
 	// Check if the URL is empty
 	url = strings.TrimSpace(url)
 	if url == "" {
@@ -3132,8 +4922,37 @@ func skipURL(processCtx *ProcessContext, id int, url string) bool {
 		return true
 	}
 
+	// Check if robots.txt allows crawling the URL
+	if !processCtx.robotsAllowed(url) {
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: Skipping URL '%s' as it is disallowed by robots.txt\n", id, url)
+		return true
+	}
+
+	// The facet URLs of the Source are crawled deliberately, so the patterns
+	// keeping the crawl out of the faceted navigation don't apply to them
+	facet := processCtx.isFacetURL(url)
+
+	// Check if the URL is within the crawl scope (include/exclude patterns)
+	if !facet && !processCtx.scope.Contains(url) {
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: Skipping URL '%s' as it is out of the crawl scope\n", id, url)
+		return true
+	}
+
+	// Check if the link anchor text is to be followed (links without anchor
+	// text, like the sitemaps ones, are not filtered)
+	if anchorText != "" && !processCtx.anchorScope.Contains(anchorText) {
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: Skipping URL '%s' due to its anchor text '%s'\n", id, url, anchorText)
+		return true
+	}
+
+	// Check if the URL file extension is to be followed (e.g. not a binary)
+	if !followExtension(&processCtx.config.Crawler, url) {
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Worker %d: Skipping URL '%s' due to its file extension\n", id, url)
+		return true
+	}
+
 	// Check if the URL matches user defined patterns (negative or positive)
-	if len(processCtx.userURLPatterns) > 0 {
+	if !facet && len(processCtx.userURLPatterns) > 0 {
 		// Flag to track whether the URL should be skipped
 		shouldSkip := false
 		matches := 0
@@ -3179,8 +4998,93 @@ func isNegativePattern(pattern string) bool {
 	return strings.HasPrefix(pattern, "!")
 }
 
+// patternScope holds the compiled include and exclude patterns limiting the
+// URLs (or the links anchor text) crawled for a Source
+type patternScope struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newPatternScope compiles the include and exclude patterns (invalid patterns
+// are logged and ignored). It returns nil if there are no patterns.
+func newPatternScope(include, exclude []string) *patternScope {
+	scope := &patternScope{
+		include: compilePatterns(include),
+		exclude: compilePatterns(exclude),
+	}
+	if len(scope.include) == 0 && len(scope.exclude) == 0 {
+		return nil
+	}
+	return scope
+}
+
+// linkExtension returns the file extension of the link path (lowercase and
+// without the leading dot), or "" if it has none
+func linkExtension(link string) string {
+	linkPath := link
+	if u, err := url.Parse(link); err == nil {
+		linkPath = u.Path
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(linkPath), "."))
+}
+
+// followExtension returns true if the link is to be followed according to
+// its file extension: links without one are always followed, the others only
+// if they aren't in the skip extensions and are in the follow extensions (if
+// any).
+func followExtension(crawler *cfg.Crawler, link string) bool {
+	ext := linkExtension(link)
+	if ext == "" {
+		return true
+	}
+	if cmn.SliceContains(crawler.SkipExtensions, ext) {
+		return false
+	}
+	return len(crawler.FollowExtensions) == 0 || cmn.SliceContains(crawler.FollowExtensions, ext)
+}
+
+// compilePatterns compiles a list of patterns skipping the invalid ones
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "ignoring invalid pattern '%s': %v", pattern, err)
+			continue
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// Contains returns true if value is within the scope: it matches one of the
+// include patterns (if any) and none of the exclude patterns. A nil scope
+// contains every value.
+func (s *patternScope) Contains(value string) bool {
+	if s == nil {
+		return true
+	}
+	for _, re := range s.exclude {
+		if re.MatchString(value) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, re := range s.include {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
 // rightClick simulates right-clicking on a link and opening it in the current tab using custom JavaScript
-func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
+func rightClick(crawlCtx context.Context, processCtx *ProcessContext, id int, url LinkItem) error {
 	// Lock the mutex to ensure only one goroutine accesses the vdi.WebDriver at a time
 	processCtx.getURLMutex.Lock()
 	defer processCtx.getURLMutex.Unlock()
@@ -3201,7 +5105,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 	// If we are not already on the right page that should contain url.Link, navigate to it
 	if (url.PageURL != pageURL) && (url.PageURL+"/" != pageURL) {
 		// Navigate to the page if not already there
-		_, _, err := getURLContent(url.PageURL, processCtx.wd, 0, processCtx)
+		_, _, err := getURLContent(crawlCtx, url.PageURL, processCtx.wd, 0, processCtx)
 		if err != nil {
 			return err
 		}
@@ -3237,7 +5141,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 	}
 
 	// Wait for the page to load (adjustable delay based on configuration)
-	delay := exi.GetFloat(processCtx.config.Crawler.Interval)
+	delay := exi.GetFloatWithRand(processCtx.config.Crawler.Interval, processCtx.rng)
 	_ = vdiSleep(processCtx, delay)
 
 	// Check current URL (because some Action Rules may change the URL)
@@ -3246,7 +5150,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 	cmn.DebugMsg(cmn.DbgLvlDebug5, "Worker %d: Had to open '%s' link in the same tab were we had: %s\n", id, url.Link, currentURL)
 
 	// Execute any action rules after the link is opened
-	processActionRules(&processCtx.wd, processCtx, currentURL)
+	processCtx.runPageActionRules(&processCtx.wd, currentURL)
 
 	// Re-Check current URL (because some Action Rules may change the URL)
 	currentURL, _ = processCtx.wd.CurrentURL()
@@ -3280,8 +5184,10 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 		cmn.DebugMsg(cmn.DbgLvlError, errWExtractingPageInfo, id, err)
 	}
 	pageCache.sourceID = processCtx.source.ID
+	pageCache.sourceURL = processCtx.source.URL
+	pageCache.restricted = processCtx.source.Restricted
 	// Extract links from the Current Page
-	pageCache.Links = append(pageCache.Links, extractLinks(processCtx, pageCache.HTML, url.Link)...)
+	pageCache.Links = append(pageCache.Links, extractLinks(processCtx, pageCache.HTML, linksPageURL(currentURL, url.Link))...)
 	/*
 		urlItem := LinkItem{
 			PageURL:   url.Link,
@@ -3329,6 +5235,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 			pageCache.PerfInfo.LogEntries = append(pageCache.PerfInfo.LogEntries, log)
 		}
 	}
+	pageCache.StatusCode = pageStatusCode(currentURL, pageCache.PerfInfo.LogEntries)
 
 	// Collect XHR
 	if processCtx.config.Crawler.CollectXHR {
@@ -3336,7 +5243,7 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 	}
 
 	// Clear HTML and content if not required
-	if !processCtx.config.Crawler.CollectHTML {
+	if !processCtx.config.Crawler.CollectHTML && !processCtx.config.Crawler.StoreRawHTML {
 		pageCache.HTML = ""
 	}
 	if !processCtx.config.Crawler.CollectContent {
@@ -3345,21 +5252,19 @@ func rightClick(processCtx *ProcessContext, id int, url LinkItem) error {
 
 	// Index the page after collecting data
 	pageCache.Config = &processCtx.config
-	_, err = indexPage(*processCtx.db, url.Link, &pageCache)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, errWorkerLog, id, url.Link, err)
+	if !skipErrorPage(processCtx.config.Crawler, currentURL, pageCache.StatusCode) {
+		_, err = indexPage(*processCtx.db, url.Link, &pageCache)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, errWorkerLog, id, url.Link, err)
+		}
 	}
 
 	// Mark the link as visited and add new links to the process context
-	processCtx.visitedLinks[cmn.NormalizeURL(url.Link)] = true
-	processCtx.visitedLinks[cmn.NormalizeURL(currentURL)] = true
+	processCtx.visitedLinks.Add(cmn.NormalizeURL(url.Link))
+	processCtx.visitedLinks.Add(cmn.NormalizeURL(currentURL))
 
 	// Add new links to the process context
-	if len(pageCache.Links) > 0 {
-		processCtx.linksMutex.Lock()
-		processCtx.newLinks = append(processCtx.newLinks, pageCache.Links...)
-		processCtx.linksMutex.Unlock()
-	}
+	processCtx.addNewLinks(pageCache.Links)
 
 	// Before we return, we need to call goBack to go back to the previous page
 	err = goBack(processCtx)
@@ -3377,12 +5282,12 @@ func goBack(processCtx *ProcessContext) error {
 		return fmt.Errorf("Failed to navigate back: %v", err)
 	}
 	// Wait for the page to load after going back
-	delay := exi.GetFloat(processCtx.config.Crawler.Interval)
+	delay := exi.GetFloatWithRand(processCtx.config.Crawler.Interval, processCtx.rng)
 	_ = vdiSleep(processCtx, delay)
 	return nil
 }
 
-func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
+func clickLink(crawlCtx context.Context, processCtx *ProcessContext, id int, url LinkItem) error {
 	// Set getURLMutex to ensure only one goroutine is accessing the vdi.WebDriver at a time
 	processCtx.getURLMutex.Lock()
 	defer processCtx.getURLMutex.Unlock()
@@ -3399,7 +5304,7 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 	}
 	if (url.PageURL != pageURL) && (url.PageURL+"/" != pageURL) {
 		// Navigate to the page if not already there
-		_, _, err := getURLContent(url.PageURL, processCtx.wd, 0, processCtx)
+		_, _, err := getURLContent(crawlCtx, url.PageURL, processCtx.wd, 0, processCtx)
 		if err != nil {
 			return err
 		}
@@ -3417,7 +5322,7 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 	}
 
 	// Wait for Page to Load
-	delay := exi.GetFloat(processCtx.config.Crawler.Interval)
+	delay := exi.GetFloatWithRand(processCtx.config.Crawler.Interval, processCtx.rng)
 	_ = vdiSleep(processCtx, delay) // Pause to let page load
 
 	// Check current URL
@@ -3428,7 +5333,7 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 	}
 
 	// Execute Action Rules
-	processActionRules(&processCtx.wd, processCtx, url.Link)
+	processCtx.runPageActionRules(&processCtx.wd, url.Link)
 
 	// Re-Get current URL (because some Action Rules may change the URL)
 	currentURL, _ = processCtx.wd.CurrentURL()
@@ -3464,7 +5369,9 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 		cmn.DebugMsg(cmn.DbgLvlError, errWExtractingPageInfo, id, err)
 	}
 	pageCache.sourceID = processCtx.source.ID
-	pageCache.Links = append(pageCache.Links, extractLinks(processCtx, pageCache.HTML, url.Link)...)
+	pageCache.sourceURL = processCtx.source.URL
+	pageCache.restricted = processCtx.source.Restricted
+	pageCache.Links = append(pageCache.Links, extractLinks(processCtx, pageCache.HTML, linksPageURL(currentURL, url.Link))...)
 	urlItem := LinkItem{
 		PageURL:   url.Link,
 		Link:      currentURL,
@@ -3509,13 +5416,14 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 			pageCache.PerfInfo.LogEntries = append(pageCache.PerfInfo.LogEntries, log)
 		}
 	}
+	pageCache.StatusCode = pageStatusCode(currentURL, pageCache.PerfInfo.LogEntries)
 
 	// Collect XHR
 	if processCtx.config.Crawler.CollectXHR {
 		collectXHR(processCtx, &pageCache)
 	}
 
-	if !processCtx.config.Crawler.CollectHTML {
+	if !processCtx.config.Crawler.CollectHTML && !processCtx.config.Crawler.StoreRawHTML {
 		// If we don't need to collect HTML content, clear it
 		pageCache.HTML = ""
 	}
@@ -3527,18 +5435,16 @@ func clickLink(processCtx *ProcessContext, id int, url LinkItem) error {
 
 	// Index the page
 	pageCache.Config = &processCtx.config
-	_, err = indexPage(*processCtx.db, url.Link, &pageCache)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, errWorkerLog, id, url.Link, err)
+	if !skipErrorPage(processCtx.config.Crawler, currentURL, pageCache.StatusCode) {
+		_, err = indexPage(*processCtx.db, url.Link, &pageCache)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, errWorkerLog, id, url.Link, err)
+		}
 	}
-	processCtx.visitedLinks[cmn.NormalizeURL(url.Link)] = true
+	processCtx.visitedLinks.Add(cmn.NormalizeURL(url.Link))
 
 	// Add the new links to the process context
-	if len(pageCache.Links) > 0 {
-		processCtx.linksMutex.Lock()
-		processCtx.newLinks = append(processCtx.newLinks, pageCache.Links...)
-		processCtx.linksMutex.Unlock()
-	}
+	processCtx.addNewLinks(pageCache.Links)
 
 	return err
 }
@@ -3570,7 +5476,7 @@ func ResetSiteSession(ctx *ProcessContext) error {
 	return nil
 }
 
-func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []LinkItem) error {
+func processJob(crawlCtx context.Context, processCtx *ProcessContext, id int, url, referer string, skippedURLs []LinkItem) error {
 	// Set getURLMutex to ensure only one goroutine is accessing the vdi.WebDriver at a time
 	processCtx.getURLMutex.Lock()
 	defer processCtx.getURLMutex.Unlock()
@@ -3580,8 +5486,12 @@ func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []Li
 		return nil
 	}
 
+	// Navigate to the page as if coming from the page linking to it
+	processCtx.setReferer(referer)
+	defer processCtx.setReferer("")
+
 	// Get the HTML content of the page
-	htmlContent, docType, err := getURLContent(url, processCtx.wd, 1, processCtx)
+	htmlContent, docType, err := getURLContent(crawlCtx, url, processCtx.wd, 1, processCtx)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "Worker %d: Error getting HTML content for %s: %v\n", id, url, err)
 		return err
@@ -3618,27 +5528,36 @@ func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []Li
 		cmn.DebugMsg(cmn.DbgLvlError, errWExtractingPageInfo, id, err)
 	}
 	pageCache.sourceID = processCtx.source.ID
-	pageCache.Links = append(pageCache.Links, extractLinks(processCtx, pageCache.HTML, currentURL)...)
+	pageCache.sourceURL = processCtx.source.URL
+	pageCache.restricted = processCtx.source.Restricted
+	pageCache.Links = append(pageCache.Links, extractLinks(processCtx, pageCache.HTML, linksPageURL(currentURL, url))...)
 	pageCache.Links = append(pageCache.Links, skippedURLs...)
 	// Generate Keywords
 	pageCache.Keywords = extractKeywords(pageCache)
+	applyKeywordRules(&pageCache, processCtx.keywordRules)
 
 	// Collect Navigation Timing metrics
 	if processCtx.config.Crawler.CollectPerfMetrics {
 		collectNavigationMetrics(&processCtx.wd, &pageCache)
 	}
 
-	// Collect Page logs
+	// Collect Page logs (their network responses give the status code and the
+	// security of the page, even if the page events aren't collected)
+	pageLogs := readPageLogs(&htmlContent)
 	if processCtx.config.Crawler.CollectPageEvents {
-		collectPageLogs(&htmlContent, &pageCache)
+		pageCache.PerfInfo.LogEntries = append(pageCache.PerfInfo.LogEntries, pageLogs...)
 	}
+	pageCache.StatusCode = pageStatusCode(currentURL, pageLogs)
+
+	// Check for insecure connections and mixed content
+	pageCache.Security = checkPageSecurity(currentURL, pageLogs)
 
 	// Collect XHR
 	if processCtx.config.Crawler.CollectXHR {
 		collectXHR(processCtx, &pageCache)
 	}
 
-	if !processCtx.config.Crawler.CollectHTML {
+	if !processCtx.config.Crawler.CollectHTML && !processCtx.config.Crawler.StoreRawHTML {
 		// If we don't need to collect HTML content, clear it
 		pageCache.HTML = ""
 	}
@@ -3649,18 +5568,17 @@ func processJob(processCtx *ProcessContext, id int, url string, skippedURLs []Li
 	}
 
 	pageCache.Config = &processCtx.config
-	_, err = indexPage(*processCtx.db, currentURL, &pageCache)
-	if err != nil {
-		cmn.DebugMsg(cmn.DbgLvlError, errWorkerLog, id, url, err)
+	if !skipInsecurePage(processCtx.config.Crawler, currentURL, pageCache.Security) &&
+		!skipErrorPage(processCtx.config.Crawler, currentURL, pageCache.StatusCode) {
+		_, err = indexPage(*processCtx.db, currentURL, &pageCache)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, errWorkerLog, id, url, err)
+		}
 	}
-	processCtx.visitedLinks[cmn.NormalizeURL(url)] = true
+	processCtx.visitedLinks.Add(cmn.NormalizeURL(url))
 
 	// Add the new links to the process context
-	if len(pageCache.Links) > 0 {
-		processCtx.linksMutex.Lock()
-		processCtx.newLinks = append(processCtx.newLinks, pageCache.Links...)
-		processCtx.linksMutex.Unlock()
-	}
+	processCtx.addNewLinks(pageCache.Links)
 	resetPageInfo(&pageCache) // Reset the PageInfo object
 
 	return err
@@ -3686,6 +5604,8 @@ func combineURLs(baseURL, relativeURL string) (string, error) {
 // StartCrawler is responsible for initializing the crawler
 func StartCrawler(cf cfg.Config) {
 	config = cf
+	screenshotsSem = newSemaphore(cf.Crawler.MaxConcurrentScreenshots)
+	indexingSem = newSemaphore(cf.Crawler.MaxConcurrentIndexing)
 }
 
 /*
@@ -3712,8 +5632,134 @@ func getLocalNetworks() []string {
 }
 */
 
-// TakeScreenshot is responsible for taking a screenshot of the current page
-func TakeScreenshot(wd *vdi.WebDriver, filename string, maxHeight int) (Screenshot, error) {
+// semaphore limits the number of concurrent (memory or database heavy) operations
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore with n slots (nil, no limit, if n <= 0)
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// TakeScreenshot is responsible for taking a screenshot of the current page.
+// mode can be "viewport" (only the current viewport is captured) or "fullpage"
+// (default, the whole page is captured, up to maxHeight).
+func TakeScreenshot(wd *vdi.WebDriver, filename string, maxHeight int, mode string) (Screenshot, error) {
+	// Screenshots are memory heavy, so we limit how many we take at the same time
+	sem := screenshotsSem
+	sem.acquire()
+	defer sem.release()
+
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	format, quality := screenshotFormat()
+	if format == cfg.ScreenshotFormatWebP {
+		ss, err := takeWebPScreenshot(wd, filename, maxHeight, mode, quality)
+		if err == nil {
+			return ss, nil
+		}
+		cmn.DebugMsg(cmn.DbgLvlWarn, "taking a WebP screenshot (it requires a Chrome/Chromium VDI), storing it as PNG: %v", err)
+		format = cfg.ScreenshotFormatPNG
+	}
+
+	if mode == optScreenshotViewport {
+		waitForScreenshotReady(wd, time.Duration(config.Crawler.ScreenshotSectionWait)*time.Second)
+		screenshot, err := takeViewportScreenshot(wd)
+		if err != nil {
+			return Screenshot{}, err
+		}
+		return storeScreenshot(filename, screenshot, format, quality)
+	}
+	return takeFullPageScreenshot(wd, filename, maxHeight, format, quality)
+}
+
+// screenshotFormat returns the configured format and quality of the screenshots
+func screenshotFormat() (string, int) {
+	format := config.Crawler.ScreenshotFormat
+	if format == "" {
+		format = cfg.ScreenshotFormatPNG
+	}
+	quality := config.Crawler.ScreenshotQuality
+	if quality < 1 || quality > 100 {
+		quality = cfg.DefaultScreenshotQuality
+	}
+	return format, quality
+}
+
+// screenshotName returns the screenshot filename with the extension of its format
+func screenshotName(filename, format string) string {
+	ext := format
+	if format == cfg.ScreenshotFormatJPEG {
+		ext = "jpg"
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + "." + ext
+}
+
+// TakeElementScreenshot is responsible for taking a screenshot of a single element
+func TakeElementScreenshot(elem vdi.WebElement, filename string) (Screenshot, error) {
+	sem := screenshotsSem
+	sem.acquire()
+	defer sem.release()
+
+	screenshot, err := elem.Screenshot(true)
+	if err != nil {
+		return Screenshot{}, err
+	}
+	// The elements screenshots can't be encoded by the browser, so no WebP
+	format, quality := screenshotFormat()
+	if format == cfg.ScreenshotFormatWebP {
+		format = cfg.ScreenshotFormatPNG
+	}
+	return storeScreenshot(filename, screenshot, format, quality)
+}
+
+// storeScreenshot saves a single (PNG) screenshot in the given format (png or
+// jpeg) and returns its metadata
+func storeScreenshot(filename string, screenshot []byte, format string, quality int) (Screenshot, error) {
+	imgCfg, _, err := image.DecodeConfig(bytes.NewReader(screenshot))
+	if err != nil {
+		return Screenshot{}, err
+	}
+	if format != cfg.ScreenshotFormatPNG {
+		img, _, err := image.Decode(bytes.NewReader(screenshot))
+		if err != nil {
+			return Screenshot{}, err
+		}
+		if screenshot, err = encodeImage(img, format, quality); err != nil {
+			return Screenshot{}, err
+		}
+	}
+
+	location, err := saveScreenshot(screenshotName(filename, format), screenshot)
+	if err != nil {
+		return Screenshot{}, err
+	}
+
+	return Screenshot{
+		ScreenshotLink: location,
+		Format:         format,
+		Width:          imgCfg.Width,
+		Height:         imgCfg.Height,
+		ByteSize:       len(screenshot),
+	}, nil
+}
+
+// takeFullPageScreenshot scrolls through the page and stitches the slices
+// into a single screenshot
+func takeFullPageScreenshot(wd *vdi.WebDriver, filename string, maxHeight int, format string, quality int) (Screenshot, error) {
 	ss := Screenshot{}
 
 	// Execute JavaScript to get the viewport height and width
@@ -3722,13 +5768,10 @@ func TakeScreenshot(wd *vdi.WebDriver, filename string, maxHeight int) (Screensh
 		return Screenshot{}, err
 	}
 
-	totalHeight, err := getTotalHeight(wd)
+	totalHeight, err := getTotalHeight(wd, maxHeight)
 	if err != nil {
 		return Screenshot{}, err
 	}
-	if maxHeight > 0 && totalHeight > maxHeight {
-		totalHeight = maxHeight
-	}
 
 	screenshots, err := captureScreenshots(wd, totalHeight, windowHeight)
 	if err != nil {
@@ -3740,18 +5783,18 @@ func TakeScreenshot(wd *vdi.WebDriver, filename string, maxHeight int) (Screensh
 		return Screenshot{}, err
 	}
 
-	screenshot, err := encodeImage(finalImg)
+	screenshot, err := encodeImage(finalImg, format, quality)
 	if err != nil {
 		return Screenshot{}, err
 	}
 
-	location, err := saveScreenshot(filename, screenshot)
+	location, err := saveScreenshot(screenshotName(filename, format), screenshot)
 	if err != nil {
 		return Screenshot{}, err
 	}
 
 	ss.ScreenshotLink = location
-	ss.Format = "png"
+	ss.Format = format
 	ss.Width = windowWidth
 	ss.Height = totalHeight
 	ss.ByteSize = len(screenshot)
@@ -3759,6 +5802,63 @@ func TakeScreenshot(wd *vdi.WebDriver, filename string, maxHeight int) (Screensh
 	return ss, nil
 }
 
+// takeWebPScreenshot takes a screenshot encoded as WebP by the browser (Go has
+// no WebP encoder). The full page is captured in a single shot, beyond the
+// viewport, through CDP, so it requires a Chrome/Chromium VDI.
+func takeWebPScreenshot(wd *vdi.WebDriver, filename string, maxHeight int, mode string, quality int) (Screenshot, error) {
+	windowHeight, windowWidth, err := getWindowSize(wd)
+	if err != nil {
+		return Screenshot{}, err
+	}
+	args := map[string]interface{}{
+		"format":  cfg.ScreenshotFormatWebP,
+		"quality": quality,
+	}
+	height := windowHeight
+	if mode != optScreenshotViewport {
+		if height, err = getTotalHeight(wd, maxHeight); err != nil {
+			return Screenshot{}, err
+		}
+		args["captureBeyondViewport"] = true
+		args["clip"] = map[string]interface{}{
+			"x":      0,
+			"y":      0,
+			"width":  windowWidth,
+			"height": height,
+			"scale":  1,
+		}
+	}
+	waitForScreenshotReady(wd, time.Duration(config.Crawler.ScreenshotSectionWait)*time.Second)
+
+	res, err := (*wd).ExecuteChromeDPCommand("Page.captureScreenshot", args)
+	if err != nil {
+		return Screenshot{}, err
+	}
+	data := ""
+	if m, ok := res.(map[string]interface{}); ok {
+		data, _ = m["data"].(string)
+	}
+	if data == "" {
+		return Screenshot{}, fmt.Errorf("unexpected result format for the screenshot")
+	}
+	screenshot, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return Screenshot{}, err
+	}
+
+	location, err := saveScreenshot(screenshotName(filename, cfg.ScreenshotFormatWebP), screenshot)
+	if err != nil {
+		return Screenshot{}, err
+	}
+	return Screenshot{
+		ScreenshotLink: location,
+		Format:         cfg.ScreenshotFormatWebP,
+		Width:          windowWidth,
+		Height:         height,
+		ByteSize:       len(screenshot),
+	}, nil
+}
+
 func getWindowSize(wd *vdi.WebDriver) (int, int, error) {
 	// Execute JavaScript to get the viewport height and width
 	viewportSizeScript := "return [window.innerHeight, window.innerWidth]"
@@ -3781,18 +5881,94 @@ func getWindowSize(wd *vdi.WebDriver) (int, int, error) {
 	return windowHeight, windowWidth, nil
 }
 
-func getTotalHeight(wd *vdi.WebDriver) (int, error) {
+// getTotalHeight returns the height of the page to capture, capped to maxHeight
+// and to the global screenshot_max_height (0 means no limit), so that pages
+// like "infinite scroll" ones don't produce enormous screenshots.
+func getTotalHeight(wd *vdi.WebDriver, maxHeight int) (int, error) {
+	totalHeight, err := pageScrollHeight(wd)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := config.Crawler.ScreenshotMaxHeight
+	if maxHeight > 0 && (limit <= 0 || maxHeight < limit) {
+		limit = maxHeight
+	}
+	if limit > 0 && totalHeight > limit {
+		cmn.DebugMsg(cmn.DbgLvlWarn, "Page height (%d) exceeds the screenshot max height (%d), the screenshot will be truncated", totalHeight, limit)
+		totalHeight = limit
+	}
+	return totalHeight, nil
+}
+
+// pageScrollHeight returns the total height of the page
+func pageScrollHeight(wd *vdi.WebDriver) (int, error) {
 	// Execute JavaScript to get the total height of the page
 	totalHeightScript := "return document.body.parentNode.scrollHeight"
 	totalHeightRes, err := (*wd).ExecuteScript(totalHeightScript, nil)
 	if err != nil {
 		return 0, err
 	}
-	totalHeight, err := strconv.Atoi(fmt.Sprint(totalHeightRes))
+	// Very tall pages may be returned in exponent notation (e.g., 1e+06)
+	height, err := strconv.ParseFloat(fmt.Sprint(totalHeightRes), 64)
 	if err != nil {
 		return 0, err
 	}
-	return totalHeight, nil
+	return int(height), nil
+}
+
+// scrollLoadTimeout is how long scrollToBottom waits for a page to load new
+// content after each scroll
+const scrollLoadTimeout = 2 * time.Second
+
+// scrollBeforeExtract scrolls the page to its bottom (if configured), so the
+// links added on scroll by lazy-loaded pages are extracted too
+func (ctx *ProcessContext) scrollBeforeExtract(wd *vdi.WebDriver, pageURL string) {
+	if !ctx.config.Crawler.ScrollBeforeExtract {
+		return
+	}
+	loads := scrollToBottom(wd, ctx.config.Crawler.MaxScrolls, scrollLoadTimeout)
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Scrolled %s to its bottom, %d scroll(s) loaded new content", pageURL, loads)
+}
+
+// scrollToBottom scrolls the page to its bottom as long as it grows (the
+// lazy-loaded pages add content on scroll), up to maxScrolls times, waiting
+// up to timeout for new content after each scroll. It returns the number of
+// scrolls that loaded new content.
+func scrollToBottom(wd *vdi.WebDriver, maxScrolls int, timeout time.Duration) int {
+	height, err := pageScrollHeight(wd)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "getting the page height before scrolling: %v", err)
+		return 0
+	}
+	loads := 0
+	for loads < maxScrolls {
+		if _, err := (*wd).ExecuteScript("window.scrollTo(0, document.body.parentNode.scrollHeight);", nil); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "scrolling to the bottom of the page: %v", err)
+			break
+		}
+		grown := false
+		deadline := time.Now().Add(timeout)
+		for !grown && time.Now().Before(deadline) {
+			time.Sleep(screenshotReadyPollInterval)
+			newHeight, err := pageScrollHeight(wd)
+			if err != nil {
+				break
+			}
+			grown = newHeight > height
+			height = newHeight
+		}
+		if !grown {
+			break
+		}
+		loads++
+	}
+	if loads == maxScrolls {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Reached the max scrolls (%d), the page may have more content to load", maxScrolls)
+	}
+	// Back to the top, where the rules expect the page to be
+	_, _ = (*wd).ExecuteScript("window.scrollTo(0, 0);", nil)
+	return loads
 }
 
 func captureScreenshots(wd *vdi.WebDriver, totalHeight, windowHeight int) ([][]byte, error) {
@@ -3804,25 +5980,12 @@ func captureScreenshots(wd *vdi.WebDriver, totalHeight, windowHeight int) ([][]b
 		if err != nil {
 			return nil, err
 		}
-		time.Sleep(time.Duration(config.Crawler.ScreenshotSectionWait) * time.Second) // Pause to let page load
+		waitForScreenshotReady(wd, time.Duration(config.Crawler.ScreenshotSectionWait)*time.Second) // Let the section load
 
 		// Take screenshot of the current view
-		screenshot, err := (*wd).Screenshot()
+		screenshot, err := takeViewportScreenshot(wd)
 		if err != nil {
-			// Check if the error is due to an alert
-			if strings.Contains(err.Error(), "unexpected alert open") {
-				// Accept the alert and retry
-				err2 := (*wd).AcceptAlert()
-				if err2 != nil {
-					return nil, err
-				}
-				screenshot, err = (*wd).Screenshot()
-				if err != nil {
-					return nil, err
-				}
-			} else {
-				return nil, err
-			}
+			return nil, err
 		}
 
 		screenshots = append(screenshots, screenshot)
@@ -3830,63 +5993,211 @@ func captureScreenshots(wd *vdi.WebDriver, totalHeight, windowHeight int) ([][]b
 	return screenshots, nil
 }
 
-func stitchScreenshots(screenshots [][]byte, windowWidth, totalHeight int) (*image.RGBA, error) {
-	finalImg := image.NewRGBA(image.Rect(0, 0, windowWidth, totalHeight))
-	currentY := 0
-	for i, screenshot := range screenshots {
-		img, _, err := image.Decode(bytes.NewReader(screenshot))
+// screenshotReadyScript returns true when the fonts and the images in the viewport
+// have finished loading
+const screenshotReadyScript = `
+if (document.fonts && document.fonts.status !== 'loaded') {
+	return false;
+}
+var imgs = document.images;
+for (var i = 0; i < imgs.length; i++) {
+	var r = imgs[i].getBoundingClientRect();
+	if (r.bottom > 0 && r.top < window.innerHeight && r.right > 0 && r.left < window.innerWidth && !imgs[i].complete) {
+		return false;
+	}
+}
+return true;
+`
+
+// screenshotReadyPollInterval is how often waitForScreenshotReady checks the page
+const screenshotReadyPollInterval = 100 * time.Millisecond
+
+// waitForScreenshotReady waits (up to timeout) for the fonts and the images in the
+// viewport to be loaded, so we don't capture half-loaded sections.
+// It returns true if the page is ready, false if the timeout expired.
+func waitForScreenshotReady(wd *vdi.WebDriver, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		res, err := (*wd).ExecuteScript(screenshotReadyScript, nil)
 		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "checking if the page is ready for a screenshot: %v", err)
+		} else if ready, ok := res.(bool); ok && ready {
+			return true
+		}
+		if time.Now().Add(screenshotReadyPollInterval).After(deadline) {
+			cmn.DebugMsg(cmn.DbgLvlDebug2, "Timed out waiting for fonts and images to load before the screenshot")
+			return false
+		}
+		time.Sleep(screenshotReadyPollInterval)
+	}
+}
+
+// takeViewportScreenshot takes a screenshot of the current view
+func takeViewportScreenshot(wd *vdi.WebDriver) ([]byte, error) {
+	screenshot, err := (*wd).Screenshot()
+	if err != nil {
+		// Check if the error is due to an alert
+		if !strings.Contains(err.Error(), "unexpected alert open") {
+			return nil, err
+		}
+		// Accept the alert and retry
+		err2 := (*wd).AcceptAlert()
+		if err2 != nil {
 			return nil, err
 		}
+		return (*wd).Screenshot()
+	}
+	return screenshot, nil
+}
 
-		// If this is the last screenshot, we may need to adjust the y offset to avoid duplication
-		if i == len(screenshots)-1 {
-			// Calculate the remaining height to capture
-			remainingHeight := totalHeight - currentY
-			bounds := img.Bounds()
-			imgHeight := bounds.Dy()
-
-			// If the remaining height is less than the image height, adjust the bounds
-			if remainingHeight < imgHeight {
-				bounds = image.Rect(bounds.Min.X, bounds.Max.Y-remainingHeight, bounds.Max.X, bounds.Max.Y)
-			}
+// stitchedImage is a full page screenshot made of multiple (still encoded)
+// screenshot slices. The slices are decoded when their rows are read (the PNG
+// encoder reads rows top to bottom, the JPEG one blocks of up to 16 rows, so
+// at most two slices are decoded at the same time), so encoding a very tall
+// page never requires the whole page to be decoded in memory.
+type stitchedImage struct {
+	width   int
+	height  int
+	slices  []screenshotSlice
+	current int         // Index of the currently decoded slice (-1 if none)
+	img     image.Image // Currently decoded slice
+	prev    int         // Index of the previously decoded slice (-1 if none)
+	prevImg image.Image // Previously decoded slice (the blocks of an encoder may span two slices)
+	err     error       // First decoding error (if any)
+}
 
-			// Draw the remaining part of the image onto the final image
-			currentY = drawRemainingImage(finalImg, img, bounds, currentY)
-		} else {
-			currentY = drawImage(finalImg, img, currentY)
+// screenshotSlice represents a single slice of a stitched screenshot
+type screenshotSlice struct {
+	data   []byte // The encoded screenshot
+	width  int    // The screenshot width
+	srcY   int    // First row of the screenshot to draw
+	dstY   int    // Row of the final image where the slice starts
+	height int    // Number of rows to draw
+}
+
+func (s *stitchedImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (s *stitchedImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.width, s.height)
+}
+
+// Opaque returns true if the slices cover the whole image
+func (s *stitchedImage) Opaque() bool {
+	covered := 0
+	for _, sl := range s.slices {
+		covered += sl.height
+	}
+	return covered >= s.height
+}
+
+func (s *stitchedImage) At(x, y int) color.Color {
+	idx := s.sliceAt(y)
+	if idx < 0 || x < 0 || x >= s.slices[idx].width {
+		return color.RGBA{}
+	}
+	if idx != s.current && idx == s.prev {
+		s.current, s.prev = s.prev, s.current
+		s.img, s.prevImg = s.prevImg, s.img
+	} else if idx != s.current {
+		// Decode the next slice, releasing the one before the current
+		s.prev, s.prevImg = s.current, s.img
+		s.img = nil
+		s.current = idx
+		img, _, err := image.Decode(bytes.NewReader(s.slices[idx].data))
+		if err != nil {
+			if s.err == nil {
+				s.err = err
+			}
+			return color.RGBA{}
 		}
+		s.img = img
 	}
-	return finalImg, nil
+	if s.img == nil {
+		return color.RGBA{}
+	}
+	sl := s.slices[idx]
+	b := s.img.Bounds()
+	return s.img.At(b.Min.X+x, b.Min.Y+sl.srcY+(y-sl.dstY))
 }
 
-func drawRemainingImage(finalImg *image.RGBA, img image.Image, bounds image.Rectangle, currentY int) int {
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			finalImg.Set(x, currentY, img.At(x, y))
+// sliceAt returns the index of the slice containing row y (-1 if none)
+func (s *stitchedImage) sliceAt(y int) int {
+	if s.current >= 0 {
+		// Rows are usually read in order, so check the current and next slice first
+		for i := s.current; i < len(s.slices) && i <= s.current+1; i++ {
+			if y >= s.slices[i].dstY && y < s.slices[i].dstY+s.slices[i].height {
+				return i
+			}
+		}
+	}
+	for i, sl := range s.slices {
+		if y >= sl.dstY && y < sl.dstY+sl.height {
+			return i
 		}
-		currentY++
 	}
-	return currentY
+	return -1
 }
 
-func drawImage(finalImg *image.RGBA, img image.Image, currentY int) int {
-	bounds := img.Bounds()
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			finalImg.Set(x, currentY, img.At(x, y))
+// stitchScreenshots stitches the screenshot slices into a single (lazily decoded) image
+func stitchScreenshots(screenshots [][]byte, windowWidth, totalHeight int) (image.Image, error) {
+	finalImg := &stitchedImage{
+		width:   windowWidth,
+		height:  totalHeight,
+		current: -1,
+		prev:    -1,
+	}
+	currentY := 0
+	for i, screenshot := range screenshots {
+		if currentY >= totalHeight {
+			break
+		}
+		imgCfg, _, err := image.DecodeConfig(bytes.NewReader(screenshot))
+		if err != nil {
+			return nil, err
+		}
+
+		sl := screenshotSlice{
+			data:   screenshot,
+			width:  imgCfg.Width,
+			dstY:   currentY,
+			height: imgCfg.Height,
+		}
+		// If this is the last screenshot, we may need to adjust the y offset to avoid duplication
+		remainingHeight := totalHeight - currentY
+		if i == len(screenshots)-1 && remainingHeight < imgCfg.Height {
+			// Draw only the remaining part of the image
+			sl.srcY = imgCfg.Height - remainingHeight
+			sl.height = remainingHeight
+		} else if sl.height > remainingHeight {
+			sl.height = remainingHeight
 		}
-		currentY++
+		finalImg.slices = append(finalImg.slices, sl)
+		currentY += sl.height
 	}
-	return currentY
+	return finalImg, nil
 }
 
-func encodeImage(img *image.RGBA) ([]byte, error) {
+// encodeImage encodes a screenshot in the given format (png or jpeg, the
+// quality is used by the latter)
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
 	buffer := new(bytes.Buffer)
-	err := png.Encode(buffer, img)
+	var err error
+	switch format {
+	case cfg.ScreenshotFormatPNG, "":
+		err = png.Encode(buffer, img)
+	case cfg.ScreenshotFormatJPEG:
+		err = jpeg.Encode(buffer, img, &jpeg.Options{Quality: quality})
+	default:
+		return nil, fmt.Errorf("unsupported screenshot format '%s'", format)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if si, ok := img.(*stitchedImage); ok && si.err != nil {
+		return nil, si.err
+	}
 	return buffer.Bytes(), nil
 }
 
@@ -3912,8 +6223,12 @@ func saveScreenshot(filename string, screenshot []byte) (string, error) {
 			return "", errors.New("unsupported storage type")
 		}
 	} else {
-		// Fallback to local file saving
-		return writeToFile(config.ImageStorageAPI.Path+"/"+filename, screenshot)
+		// Fallback to local file saving (the path template may use subdirectories)
+		filename = config.ImageStorageAPI.Path + "/" + filename
+		if err := os.MkdirAll(filepath.Dir(filename), 0750); err != nil {
+			return "", err
+		}
+		return writeToFile(filename, screenshot)
 	}
 }
 
@@ -15,14 +15,160 @@
 package crawler
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	exi "github.com/pzaino/thecrowler/pkg/exprterpreter"
+	neti "github.com/pzaino/thecrowler/pkg/netinfo"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
 )
 
 const (
 	testFQDN string = "https://www.google.com"
 )
 
+// mockWebDriver is a WebDriver that records the calls it receives.
+// Only the methods used by the tests are implemented.
+type mockWebDriver struct {
+	vdi.WebDriver
+	calls    []string
+	pages    []string                    // page sources returned by successive PageSource calls
+	elements map[string][]vdi.WebElement // elements returned by FindElements (by selector)
+	site     map[string]string           // page sources by URL (if set, pages is ignored and Get navigates the site)
+	url      string                      // current URL (when navigating a site)
+}
+
+func (m *mockWebDriver) Get(url string) error {
+	m.calls = append(m.calls, "get:"+url)
+	m.url = url
+	return nil
+}
+
+func (m *mockWebDriver) Refresh() error {
+	m.calls = append(m.calls, "refresh")
+	return nil
+}
+
+func (m *mockWebDriver) PageSource() (string, error) {
+	m.calls = append(m.calls, "page_source")
+	if m.site != nil {
+		return m.site[m.url], nil
+	}
+	if len(m.pages) == 0 {
+		return "", nil
+	}
+	page := m.pages[0]
+	if len(m.pages) > 1 {
+		m.pages = m.pages[1:]
+	}
+	return page, nil
+}
+
+func (m *mockWebDriver) CurrentURL() (string, error) {
+	if m.site != nil {
+		return m.url, nil
+	}
+	return testFQDN, nil
+}
+
+func (m *mockWebDriver) Title() (string, error) {
+	return "", nil
+}
+
+func (m *mockWebDriver) FindElement(_, value string) (vdi.WebElement, error) {
+	return nil, fmt.Errorf("no such element: %s", value)
+}
+
+func (m *mockWebDriver) FindElements(_, value string) ([]vdi.WebElement, error) {
+	m.calls = append(m.calls, "find:"+value)
+	return m.elements[value], nil
+}
+
+// mockWebElement is a WebElement with a tag name that records the calls it receives.
+type mockWebElement struct {
+	vdi.WebElement
+	tag   string
+	calls []string
+}
+
+func (e *mockWebElement) TagName() (string, error) {
+	return e.tag, nil
+}
+
+func (e *mockWebElement) Clear() error {
+	e.calls = append(e.calls, "clear")
+	return nil
+}
+
+func TestParseErrorsAreWarnings(t *testing.T) {
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.config.Crawler.BrowsingMode = optBrowsingRecu
+	binary := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	// Malformed HTML is parsed as browsers do
+	malformed := "<html><body><a href=\"https://www.google.com\">Google<div><p></span><a href="
+	links := extractLinks(ctx, malformed, testFQDN)
+	if len(links) == 0 || links[0].Link != testFQDN {
+		t.Errorf("Expected the links of malformed HTML to be extracted, got %v", links)
+	}
+	if ctx.Status.TotalWarnings != 0 {
+		t.Errorf("Expected no warnings for malformed HTML, got %d (%s)", ctx.Status.TotalWarnings, ctx.Status.LastWarning)
+	}
+
+	// Content that can't be parsed is recorded as a warning
+	links = extractLinks(ctx, binary, testFQDN)
+	if links != nil {
+		t.Errorf("Expected no links for unparsable content, got %v", links)
+	}
+	if ctx.Status.TotalWarnings != 1 || !strings.Contains(ctx.Status.LastWarning, "links extraction") {
+		t.Errorf("Expected a recorded warning, got %d (%s)", ctx.Status.TotalWarnings, ctx.Status.LastWarning)
+	}
+
+	var wd vdi.WebDriver = &mockWebDriver{pages: []string{binary}}
+	pageInfo := PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Errorf("Expected unparsable content not to be an error, got %v", err)
+	}
+	if ctx.Status.TotalWarnings != 2 || ctx.Status.TotalErrors != 0 {
+		t.Errorf("Expected a second recorded warning and no errors, got %+v", ctx.Status)
+	}
+	if len(pageInfo.Errors) != 1 || pageInfo.Title != testFQDN || pageInfo.HTML != "" {
+		t.Errorf("Expected the parse error to be recorded on the page, got %+v", pageInfo)
+	}
+}
+
 func TestExtractLinks(t *testing.T) {
 	testArgs := Pars{
 		WG:     nil,
@@ -33,9 +179,10 @@ func TestExtractLinks(t *testing.T) {
 	type args struct {
 		htmlContent string
 	}
-	test1 := []LinkItem{{Link: testFQDN}}
-	test2 := []LinkItem{{Link: testFQDN}, {Link: testFQDN}}
-	test3 := []LinkItem{{Link: testFQDN}, {Link: testFQDN}, {Link: testFQDN}}
+	google := LinkItem{Link: testFQDN, AnchorText: "Google"}
+	test1 := []LinkItem{google}
+	test2 := []LinkItem{google, google}
+	test3 := []LinkItem{google, google, google}
 	tests := []struct {
 		name string
 		args args
@@ -150,6 +297,9 @@ func TestResetPageInfo(t *testing.T) {
 				DetectedType: "text/html",
 				PerfInfo:     PerformanceLog{},
 				MetaTags:     []MetaTag{{Name: "description", Content: "Example description"}},
+				Forms:        []PageForm{{Action: "https://example.com/login", Method: "POST"}},
+				Security:     PageSecurity{Insecure: true, MixedContent: true},
+				Errors:       []string{"content is not valid HTML (binary data)"},
 				ScrapedData:  []ScrapedItem{},
 				Links:        []LinkItem{{Link: "https://example.com/link"}},
 			},
@@ -163,6 +313,8 @@ func TestResetPageInfo(t *testing.T) {
 				DetectedType: "",
 				PerfInfo:     PerformanceLog{},
 				MetaTags:     []MetaTag{},
+				Forms:        []PageForm{},
+				Errors:       []string{},
 				ScrapedData:  []ScrapedItem{},
 				Links:        []LinkItem{},
 			},
@@ -298,3 +450,2581 @@ func TestIsValidURIProtocol(t *testing.T) {
 		})
 	}
 }
+
+func TestRecordJobResultAbortsOnErrors(t *testing.T) {
+	// Fixture: a site that errors on most pages (only 1 page in 5 works)
+	pages := make([]error, 100)
+	for i := range pages {
+		if i%5 != 0 {
+			pages[i] = errors.New("page not reachable")
+		}
+	}
+
+	tests := []struct {
+		name      string
+		crawler   cfg.Crawler
+		abortedAt int // index of the page after which the crawl is expected to abort
+	}{
+		{"no limits", cfg.Crawler{}, -1},
+		{"max consecutive errors", cfg.Crawler{MaxConsecutiveErrors: 4}, 4},
+		{"max error rate", cfg.Crawler{MaxErrorRate: 0.5}, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &ProcessContext{Status: &Status{}}
+			ctx.config.Crawler = tt.crawler
+
+			abortedAt := -1
+			for i, pageErr := range pages {
+				if err := ctx.recordJobResult(pageErr); err != nil {
+					if !strings.Contains(err.Error(), errCriticalError) {
+						t.Errorf("Expected a critical error, got %v", err)
+					}
+					abortedAt = i
+					break
+				}
+			}
+			if abortedAt != tt.abortedAt {
+				t.Errorf("Expected abort after page %d, got %d", tt.abortedAt, abortedAt)
+			}
+			if (abortedAt >= 0) != ctx.isCrawlAborted() {
+				t.Errorf("Unexpected aborted flag: %v", ctx.isCrawlAborted())
+			}
+		})
+	}
+}
+
+func TestWorkerStopsWhenCrawlAborted(t *testing.T) {
+	ctx := &ProcessContext{Status: &Status{}, crawlAborted: true}
+	jobs := make(chan LinkItem, 2)
+	jobs <- LinkItem{Link: "https://www.example.com/a"}
+	jobs <- LinkItem{Link: "https://www.example.com/b"}
+	close(jobs)
+
+	if err := worker(context.Background(), ctx, 1, jobs); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if ctx.Status.TotalPages != 0 || ctx.Status.TotalErrors != 0 {
+		t.Errorf("Expected no job to be processed, got %+v", ctx.Status)
+	}
+}
+
+func TestCrawlCancellation(t *testing.T) {
+	// The in-flight navigation is abandoned when the crawl is cancelled
+	stuck := &stuckWebDriver{release: make(chan struct{})}
+	defer close(stuck.release)
+	crawlCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	err := navigateTo(crawlCtx, stuck, testFQDN, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("navigateTo() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("navigateTo() returned after %v, the navigation wasn't abandoned", elapsed)
+	}
+
+	// The workers of a cancelled crawl exit leaving the jobs pending
+	ctx := &ProcessContext{Status: &Status{}}
+	jobs := make(chan LinkItem, 2)
+	jobs <- LinkItem{Link: "https://www.example.com/a"}
+	jobs <- LinkItem{Link: "https://www.example.com/b"}
+	close(jobs)
+	if err := worker(crawlCtx, ctx, 1, jobs); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if ctx.Status.TotalPages != 0 || ctx.Status.TotalErrors != 0 || len(jobs) != 1 {
+		t.Errorf("Expected no job to be processed, got %+v (%d jobs left)", ctx.Status, len(jobs))
+	}
+}
+
+func TestNavigateWithRetries(t *testing.T) {
+	// The failed navigations are retried (with the same session while it's
+	// valid) until one succeeds
+	flaky := &flakyWebDriver{failures: []error{errors.New("timeout"), errors.New("timeout")}}
+	reconnects := 0
+	reconnect := func() (vdi.WebDriver, error) {
+		reconnects++
+		return &flakyWebDriver{}, nil
+	}
+	start := time.Now()
+	wd, err := navigateWithRetries(context.Background(), flaky, testFQDN, "", 2, 10*time.Millisecond, reconnect)
+	if err != nil || wd != flaky || flaky.gets != 3 || reconnects != 0 {
+		t.Errorf("navigateWithRetries() = %v, %v after %d navigations and %d reconnections, want the same session after 3 navigations", wd, err, flaky.gets, reconnects)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("navigateWithRetries() returned after %v, want an exponential backoff of at least 30ms", elapsed)
+	}
+
+	// The navigation fails after the retries are exhausted
+	flaky = &flakyWebDriver{failures: []error{errors.New("timeout"), errors.New("timeout"), errors.New("timeout")}}
+	if _, err := navigateWithRetries(context.Background(), flaky, testFQDN, "", 2, time.Millisecond, reconnect); err == nil || flaky.gets != 3 {
+		t.Errorf("navigateWithRetries() error = %v after %d navigations, want an error after 3 navigations", err, flaky.gets)
+	}
+
+	// A lost session is reconnected (even without retries)
+	flaky = &flakyWebDriver{failures: []error{errors.New("invalid session id")}}
+	wd, err = navigateWithRetries(context.Background(), flaky, testFQDN, "", 0, time.Millisecond, reconnect)
+	if err != nil || wd == flaky || reconnects != 1 {
+		t.Errorf("navigateWithRetries() = %v, %v after %d reconnections, want a new session", wd, err, reconnects)
+	}
+
+	// A session found invalid before a retry is reconnected
+	flaky = &flakyWebDriver{failures: []error{errors.New("timeout")}, urlErr: errors.New("unable to find session with id 42")}
+	wd, err = navigateWithRetries(context.Background(), flaky, testFQDN, "", 1, time.Millisecond, reconnect)
+	if err != nil || wd == flaky || reconnects != 2 {
+		t.Errorf("navigateWithRetries() = %v, %v after %d reconnections, want a new session", wd, err, reconnects)
+	}
+
+	// The retries stop when the crawl is cancelled
+	crawlCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	flaky = &flakyWebDriver{failures: []error{errors.New("timeout")}}
+	if _, err := navigateWithRetries(crawlCtx, flaky, testFQDN, "", 3, time.Hour, reconnect); err == nil {
+		t.Errorf("navigateWithRetries() error = nil, want an error for the cancelled crawl")
+	}
+}
+
+func TestSourceWorkersOverride(t *testing.T) {
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config.Crawler.Workers = 10
+
+	tests := []struct {
+		name     string
+		source   string
+		expected int
+	}{
+		{"no override", `{"source_name":"test"}`, 8},
+		{"override", `{"source_name":"test","custom":{"crawler":{"workers":3}}}`, 3},
+		{"single worker", `{"source_name":"test","custom":{"crawler":{"workers":1}}}`, 1},
+		{"invalid override", `{"source_name":"test","custom":{"crawler":{"workers":0}}}`, 8},
+	}
+	for _, tt := range tests {
+		srcConfig := json.RawMessage(tt.source)
+		ctx := &ProcessContext{Status: &Status{}, crawlAborted: true}
+		ctx.workers = sourceWorkers(&srcConfig)
+
+		workers := ctx.crawlingWorkers()
+		if workers != tt.expected {
+			t.Errorf("%s: expected %d workers, got %d", tt.name, tt.expected, workers)
+		}
+
+		// Every (aborted) worker consumes exactly one job before stopping,
+		// so the jobs left tell how many workers were actually launched
+		const extraJobs = 5
+		jobs := make(chan LinkItem, workers+extraJobs)
+		for i := 0; i < workers+extraJobs; i++ {
+			jobs <- LinkItem{Link: "https://www.example.com/"}
+		}
+		close(jobs)
+		errChan := make(chan error, workers)
+		launched := ctx.startWorkers(context.Background(), workers, jobs, errChan)
+		ctx.wg.Wait()
+		if launched != tt.expected || len(jobs) != extraJobs {
+			t.Errorf("%s: expected %d workers to be launched, got %d (%d jobs consumed)", tt.name, tt.expected, launched, workers+extraJobs-len(jobs))
+		}
+	}
+
+	// The global setting always leaves at least one worker
+	config.Crawler.Workers = 1
+	ctx := &ProcessContext{}
+	if workers := ctx.crawlingWorkers(); workers != 1 {
+		t.Errorf("Expected at least 1 worker, got %d", workers)
+	}
+}
+
+func TestExtractForms(t *testing.T) {
+	html, err := os.ReadFile("./test_data/forms.html")
+	if err != nil {
+		t.Fatalf("Failed to read the test fixture: %v", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse the test fixture: %v", err)
+	}
+
+	expected := []PageForm{
+		{
+			ID:     "login",
+			Action: "https://www.example.com/login",
+			Method: "POST",
+			Fields: []FormField{
+				{Name: "username", ID: "user", Type: "text", Label: "Username", Required: true},
+				{Name: "password", Type: "password", Label: "Password"},
+				{Name: "remember", Type: "checkbox", Label: "Remember me"},
+			},
+		},
+		{
+			Name:   "newsletter",
+			Action: "https://www.example.com/account/profile?tab=1",
+			Method: "GET",
+			Fields: []FormField{
+				{Type: "email", Label: "Your email"},
+				{Name: "topic", Type: "select"},
+				{ID: "notes", Type: "textarea"},
+			},
+		},
+	}
+
+	forms := extractForms(doc, "https://www.example.com/account/profile?tab=1")
+	if !reflect.DeepEqual(forms, expected) {
+		t.Errorf("Expected forms:\n%+v\ngot:\n%+v", expected, forms)
+	}
+}
+
+func TestAMPVersion(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("test_data", "amp", "article.html"))
+	if err != nil {
+		t.Fatalf("Failed to read the test fixture: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/amp/article" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeFile(w, r, filepath.Join("test_data", "amp", "article.amp.html"))
+	}))
+	defer server.Close()
+	pageURL, ampURL := server.URL+"/article", server.URL+"/amp/article"
+
+	// The AMP version is discovered, but not crawled nor preferred by default
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.config.Crawler.BrowsingMode = optBrowsingRecu
+	var wd vdi.WebDriver = &mockWebDriver{site: map[string]string{pageURL: string(page)}, url: pageURL}
+	pageInfo := PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if pageInfo.AMPURL != ampURL || pageInfo.AMPContent || !strings.Contains(pageInfo.BodyText, "cookies") {
+		t.Errorf("extractPageInfo() = %q (AMP content %v), %q, want the AMP URL %q and the page content", pageInfo.AMPURL, pageInfo.AMPContent, pageInfo.BodyText, ampURL)
+	}
+	for _, link := range extractLinks(ctx, string(page), pageURL) {
+		if link.Link == ampURL {
+			t.Errorf("Expected the AMP version not to be crawled")
+		}
+	}
+
+	// The AMP version is crawled
+	ctx.config.Crawler.AMP.Crawl = true
+	found := false
+	for _, link := range extractLinks(ctx, string(page), pageURL) {
+		found = found || link.Link == ampURL
+	}
+	if !found {
+		t.Errorf("Expected the AMP version %s to be crawled", ampURL)
+	}
+
+	// The AMP version content is preferred
+	ctx.config.Crawler.AMP.Prefer = true
+	wd = &mockWebDriver{site: map[string]string{pageURL: string(page)}, url: pageURL}
+	pageInfo = PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if !pageInfo.AMPContent || pageInfo.BodyText != "Spring recipes Asparagus risotto with lemon zest." {
+		t.Errorf("extractPageInfo() body text = %q (AMP content %v), want the AMP version text", pageInfo.BodyText, pageInfo.AMPContent)
+	}
+}
+
+func TestScreenshotSemaphoreLimit(t *testing.T) {
+	const limit = 2
+	sem := newSemaphore(limit)
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem.acquire()
+			defer sem.release()
+
+			// Simulate a screenshot capture
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning > limit {
+		t.Errorf("Expected at most %d concurrent screenshots, got %d", limit, maxRunning)
+	}
+	if maxRunning < limit {
+		t.Errorf("Expected the limit (%d) to be reached, got %d", limit, maxRunning)
+	}
+
+	// No limit
+	if newSemaphore(0) != nil {
+		t.Errorf("Expected a nil semaphore when no limit is set")
+	}
+	var unlimited semaphore
+	unlimited.acquire()
+	unlimited.release()
+}
+
+// makeScreenshotSlice returns a PNG encoded slice, with the top and bottom halves
+// filled with the given colors
+func makeScreenshotSlice(t *testing.T, width, height int, top, bottom color.RGBA) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		c := top
+		if y >= height/2 {
+			c = bottom
+		}
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("encoding fixture: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStitchScreenshotsBoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping tall screenshot test in short mode")
+	}
+
+	const (
+		width       = 1000
+		sliceHeight = 400
+		slices      = 40
+		lastHeight  = 150 // The last slice is only partially drawn
+		totalHeight = (slices-1)*sliceHeight + lastHeight
+	)
+	sliceColor := func(i int) color.RGBA {
+		return color.RGBA{R: uint8(i * 5), G: uint8(255 - i*5), B: 128, A: 255}
+	}
+	lastColor := color.RGBA{R: 10, G: 20, B: 30, A: 255}
+
+	screenshots := make([][]byte, 0, slices)
+	for i := 0; i < slices-1; i++ {
+		screenshots = append(screenshots, makeScreenshotSlice(t, width, sliceHeight, sliceColor(i), sliceColor(i)))
+	}
+	// Only the bottom of the last slice should end up in the final image
+	screenshots = append(screenshots, makeScreenshotSlice(t, width, sliceHeight, color.RGBA{A: 255}, lastColor))
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	// Sample the heap while stitching and encoding
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var ms runtime.MemStats
+		for {
+			runtime.ReadMemStats(&ms)
+			if ms.HeapAlloc > peak {
+				peak = ms.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+
+	finalImg, err := stitchScreenshots(screenshots, width, totalHeight)
+	if err == nil {
+		var data []byte
+		data, err = encodeImage(finalImg, cfg.ScreenshotFormatPNG, 0)
+		screenshots = [][]byte{data}
+	}
+	close(done)
+	<-sampled
+	if err != nil {
+		t.Fatalf("stitching screenshots returned an error: %v", err)
+	}
+
+	fullSize := uint64(width * totalHeight * 4)
+	if peak > before.HeapAlloc && peak-before.HeapAlloc > fullSize/2 {
+		t.Errorf("Expected memory to stay bounded, heap grew by %d bytes (full image is %d bytes)", peak-before.HeapAlloc, fullSize)
+	}
+
+	img, err := png.Decode(bytes.NewReader(screenshots[0]))
+	if err != nil {
+		t.Fatalf("decoding stitched screenshot: %v", err)
+	}
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != totalHeight {
+		t.Fatalf("Expected a %dx%d image, got %v", width, totalHeight, img.Bounds())
+	}
+	for i := 0; i < slices-1; i++ {
+		for _, y := range []int{i * sliceHeight, (i+1)*sliceHeight - 1} {
+			got := color.RGBAModel.Convert(img.At(width/2, y)).(color.RGBA)
+			if got != sliceColor(i) {
+				t.Fatalf("Expected slice %d color %v at row %d, got %v", i, sliceColor(i), y, got)
+			}
+		}
+	}
+	for _, y := range []int{(slices - 1) * sliceHeight, totalHeight - 1} {
+		got := color.RGBAModel.Convert(img.At(0, y)).(color.RGBA)
+		if got != lastColor {
+			t.Errorf("Expected last slice color %v at row %d, got %v", lastColor, y, got)
+		}
+	}
+}
+
+func TestEncodeImageFormats(t *testing.T) {
+	const width, sliceHeight = 64, 40
+	top := color.RGBA{R: 200, G: 30, B: 30, A: 255}
+	bottom := color.RGBA{R: 30, G: 30, B: 200, A: 255}
+	screenshots := [][]byte{
+		makeScreenshotSlice(t, width, sliceHeight, top, top),
+		makeScreenshotSlice(t, width, sliceHeight, bottom, bottom),
+	}
+	finalImg, err := stitchScreenshots(screenshots, width, 2*sliceHeight)
+	if err != nil {
+		t.Fatalf("stitching screenshots returned an error: %v", err)
+	}
+
+	// The JPEG blocks span both slices (40 isn't a multiple of 16)
+	data, err := encodeImage(finalImg, cfg.ScreenshotFormatJPEG, 90)
+	if err != nil {
+		t.Fatalf("encoding a JPEG screenshot returned an error: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding the JPEG screenshot: %v", err)
+	}
+	if img.Bounds().Dx() != width || img.Bounds().Dy() != 2*sliceHeight {
+		t.Fatalf("Expected a %dx%d image, got %v", width, 2*sliceHeight, img.Bounds())
+	}
+	near := func(c color.Color, expected color.RGBA) bool {
+		got := color.RGBAModel.Convert(c).(color.RGBA)
+		diff := func(a, b uint8) bool { return a > b+12 || b > a+12 }
+		return !diff(got.R, expected.R) && !diff(got.G, expected.G) && !diff(got.B, expected.B)
+	}
+	if !near(img.At(width/2, 4), top) || !near(img.At(width/2, 2*sliceHeight-4), bottom) {
+		t.Errorf("Expected the JPEG screenshot to keep the slices colors, got %v and %v", img.At(width/2, 4), img.At(width/2, 2*sliceHeight-4))
+	}
+
+	// WebP is encoded by the browser only
+	if _, err := encodeImage(finalImg, cfg.ScreenshotFormatWebP, 90); err == nil {
+		t.Errorf("Expected an error encoding a WebP screenshot")
+	}
+
+	names := map[string]string{
+		cfg.ScreenshotFormatPNG:  "1/shot.png",
+		cfg.ScreenshotFormatJPEG: "1/shot.jpg",
+		cfg.ScreenshotFormatWebP: "1/shot.webp",
+	}
+	for format, expected := range names {
+		if got := screenshotName("1/shot.png", format); got != expected {
+			t.Errorf("screenshotName(%s) = %s, expected %s", format, got, expected)
+		}
+	}
+	if got := screenshotName("1/shot", cfg.ScreenshotFormatJPEG); got != "1/shot.jpg" {
+		t.Errorf("Expected the extension to be added, got %s", got)
+	}
+}
+
+// mockLazyWebDriver simulates a lazy-loaded page: each scroll to its bottom
+// adds the next batch of its content (the templates of the fixture)
+type mockLazyWebDriver struct {
+	vdi.WebDriver
+	html    string
+	batches []string
+	scrolls int
+}
+
+func newMockLazyWebDriver(t *testing.T, fixture string) *mockLazyWebDriver {
+	page, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("Failed to read the fixture: %v", err)
+	}
+	m := &mockLazyWebDriver{}
+	re := regexp.MustCompile(`(?s)<template class="batch">(.*?)</template>`)
+	for _, batch := range re.FindAllStringSubmatch(string(page), -1) {
+		m.batches = append(m.batches, batch[1])
+	}
+	m.html = re.ReplaceAllString(string(page), "")
+	return m
+}
+
+func (m *mockLazyWebDriver) ExecuteScript(script string, _ []interface{}) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(script, "window.scrollTo(0, document"):
+		m.scrolls++
+		if len(m.batches) > 0 {
+			m.html = strings.Replace(m.html, "</ul>", m.batches[0]+"</ul>", 1)
+			m.batches = m.batches[1:]
+		}
+	case strings.Contains(script, "scrollHeight"):
+		return float64(len(m.html)), nil
+	}
+	return nil, nil
+}
+
+func TestExtractLinksResolvesURLs(t *testing.T) {
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.source = &cdb.Source{URL: "https://example.com"}
+	ctx.config.Crawler.BrowsingMode = optBrowsingRecu
+
+	page := `<html><body>
+		<a href="https://www.google.com/search?q=crowler">Absolute</a>
+		<a href="/about">Root relative</a>
+		<a href="team/">Relative</a>
+		<a href="../index.html#top">Parent relative</a>
+		<a href="//cdn.example.com/app.js">Protocol relative</a>
+		<a href="?page=2">Query only</a>
+		<a href="#comments">Anchor only</a>
+		<a href="/">Home</a>
+		<a href="mailto:info@example.com">Mail</a>
+		<a href="tel:+441234567890">Phone</a>
+		<a href="JavaScript:void(0)">Script</a>
+	</body></html>`
+	expected := []string{
+		"https://www.google.com/search?q=crowler",
+		"https://example.com/about",
+		"https://example.com/company/team/",
+		"https://example.com/index.html",
+		"https://cdn.example.com/app.js",
+		"https://example.com/company/page?page=2",
+		"https://example.com/",
+	}
+	var got []string
+	for _, link := range extractLinks(ctx, page, "https://example.com/company/page") {
+		got = append(got, link.Link)
+		if link.PageURL != "https://example.com/company/page" {
+			t.Errorf("Expected the link %s to be found on the page, got %s", link.Link, link.PageURL)
+		}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("extractLinks() = %v, want %v", got, expected)
+	}
+
+	// The relative page URLs are resolved against the Source URL and the
+	// links against the page <base href> (if any)
+	got = nil
+	for _, link := range extractLinks(ctx, `<html><head><base href="/docs/v2/"></head><body><a href="intro">Intro</a></body></html>`, "/docs/v1/index.html") {
+		got = append(got, link.Link)
+	}
+	if !reflect.DeepEqual(got, []string{"https://example.com/docs/v2/intro"}) {
+		t.Errorf("extractLinks() with a base URL = %v", got)
+	}
+
+	// The links are resolved against the page current URL (where the
+	// redirects landed, with its trailing slash), not the requested one
+	got = nil
+	pageURL := linksPageURL("https://example.com/docs/", "https://example.com/docs")
+	for _, link := range extractLinks(ctx, `<html><body><a href="intro">Intro</a></body></html>`, pageURL) {
+		got = append(got, link.Link)
+	}
+	if !reflect.DeepEqual(got, []string{"https://example.com/docs/intro"}) {
+		t.Errorf("extractLinks() on a redirected page = %v", got)
+	}
+	if pageURL := linksPageURL("", "https://example.com/docs"); pageURL != "https://example.com/docs" {
+		t.Errorf("linksPageURL() = %s, expected the requested URL when the current one isn't known", pageURL)
+	}
+}
+
+func (m *mockLazyWebDriver) PageSource() (string, error) {
+	return m.html, nil
+}
+
+func TestScrollBeforeExtract(t *testing.T) {
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.source = &cdb.Source{URL: "https://example.com"}
+	ctx.config.Crawler.BrowsingMode = optBrowsingRecu
+	ctx.config.Crawler.MaxScrolls = 10
+
+	links := func(wd vdi.WebDriver) []string {
+		ctx.scrollBeforeExtract(&wd, "https://example.com/catalog")
+		html, _ := wd.PageSource()
+		var found []string
+		for _, link := range extractLinks(ctx, html, "https://example.com/catalog") {
+			found = append(found, link.Link)
+		}
+		return found
+	}
+
+	// Without scrolling only the links of the initial page are found
+	mock := newMockLazyWebDriver(t, "./test_data/lazy_links/catalog.html")
+	if got := links(mock); len(got) != 2 || mock.scrolls != 0 {
+		t.Errorf("Expected 2 links and no scrolls, got %v (%d scrolls)", got, mock.scrolls)
+	}
+
+	// Scrolling discovers the links added on scroll
+	ctx.config.Crawler.ScrollBeforeExtract = true
+	mock = newMockLazyWebDriver(t, "./test_data/lazy_links/catalog.html")
+	expected := []string{"https://example.com/products/1", "https://example.com/products/2", "https://example.com/products/3", "https://example.com/products/4", "https://example.com/products/5"}
+	if got := links(mock); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the lazy-loaded links %v, got %v", expected, got)
+	}
+
+	// The scrolls are capped
+	mock = newMockLazyWebDriver(t, "./test_data/lazy_links/catalog.html")
+	var wd vdi.WebDriver = mock
+	if loads := scrollToBottom(&wd, 1, 50*time.Millisecond); loads != 1 || len(mock.batches) != 1 {
+		t.Errorf("Expected a single scroll loading new content, got %d (%d batches left)", loads, len(mock.batches))
+	}
+}
+
+func TestStitchScreenshotsInvalidData(t *testing.T) {
+	_, err := stitchScreenshots([][]byte{[]byte("not an image")}, 100, 100)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid screenshot")
+	}
+}
+
+// mockScrollingWebDriver simulates a (very tall) page for full page screenshots
+type mockScrollingWebDriver struct {
+	vdi.WebDriver
+	pageHeight  int
+	shot        []byte // returned by Screenshot
+	screenshots int
+	loading     int // number of readiness checks before the page is ready
+	readyChecks int
+	notReadyAt  int // screenshots taken while the page was still loading
+}
+
+func (m *mockScrollingWebDriver) ExecuteScript(script string, _ []interface{}) (interface{}, error) {
+	if strings.Contains(script, "scrollHeight") {
+		return float64(m.pageHeight), nil
+	}
+	if script == screenshotReadyScript {
+		m.readyChecks++
+		if m.loading > 0 {
+			m.loading--
+			return false, nil
+		}
+		return true, nil
+	}
+	return nil, nil
+}
+
+func (m *mockScrollingWebDriver) Screenshot() ([]byte, error) {
+	m.screenshots++
+	if m.loading > 0 {
+		m.notReadyAt++
+	}
+	return m.shot, nil
+}
+
+func TestScreenshotMaxHeight(t *testing.T) {
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config.Crawler.ScreenshotSectionWait = 0
+	config.Crawler.ScreenshotMaxHeight = 2000
+
+	mock := &mockScrollingWebDriver{pageHeight: 1000000} // an "infinite scroll" page
+	var wd vdi.WebDriver = mock
+
+	tests := []struct {
+		name      string
+		maxHeight int
+		global    int
+		expected  int
+	}{
+		{"global cap", 0, 2000, 2000},
+		{"action cap below global cap", 1200, 2000, 1200},
+		{"action cap above global cap", 5000, 2000, 2000},
+		{"no global cap", 1200, 0, 1200},
+		{"no cap", 0, 0, 1000000},
+	}
+	for _, tt := range tests {
+		config.Crawler.ScreenshotMaxHeight = tt.global
+		height, err := getTotalHeight(&wd, tt.maxHeight)
+		if err != nil {
+			t.Fatalf("%s: getTotalHeight returned an error: %v", tt.name, err)
+		}
+		if height != tt.expected {
+			t.Errorf("%s: expected height %d, got %d", tt.name, tt.expected, height)
+		}
+	}
+
+	// Capture must stop at the cap
+	config.Crawler.ScreenshotMaxHeight = 2000
+	height, err := getTotalHeight(&wd, 0)
+	if err != nil {
+		t.Fatalf("getTotalHeight returned an error: %v", err)
+	}
+	screenshots, err := captureScreenshots(&wd, height, 500)
+	if err != nil {
+		t.Fatalf("captureScreenshots returned an error: %v", err)
+	}
+	if len(screenshots) != 4 || mock.screenshots != 4 {
+		t.Errorf("Expected 4 screenshots for a 2000px cap, got %d (%d taken)", len(screenshots), mock.screenshots)
+	}
+}
+
+func TestScreenshotOnChange(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 1)
+	url, page := fakeIndexPage(1)
+	indexID, err := indexPage(db, url, &page)
+	if err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	if page.contentUnchanged {
+		t.Errorf("Expected a new page to be changed")
+	}
+	if err := insertScreenshot(db, Screenshot{IndexID: indexID, ScreenshotLink: "s1-page1.png"}); err != nil {
+		t.Fatalf("insertScreenshot() error = %v", err)
+	}
+
+	// The page is recrawled with the same content
+	_, page = fakeIndexPage(1)
+	if _, err := indexPage(db, url, &page); err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	if !page.contentUnchanged {
+		t.Fatalf("Expected the recrawled page to be unchanged")
+	}
+
+	conf := cfg.NewConfig()
+	conf.Crawler.SourceScreenshot = true
+	conf.Crawler.ScreenshotOnChange = true
+	ctx := &ProcessContext{config: *conf, db: &db, source: &cdb.Source{ID: 1, URL: url}}
+	wd := &mockWebDriver{}
+	ctx.TakeScreenshot(wd, url, indexID, page.contentUnchanged)
+	if len(wd.calls) != 0 {
+		t.Errorf("Expected no screenshot of the unchanged page, got calls %v", wd.calls)
+	}
+	var link string
+	if err := db.QueryRow(`SELECT screenshot_link FROM Screenshots WHERE index_id = $1`, indexID).Scan(&link); err != nil || link != "s1-page1.png" {
+		t.Errorf("Expected the previous screenshot to be kept, got %q (%v)", link, err)
+	}
+}
+
+func TestRenderScreenshotPath(t *testing.T) {
+	ts := time.Date(2024, time.March, 7, 9, 30, 0, 0, time.UTC)
+	pageURL := "https://www.example.com/products?id=1"
+	hash := sha256.Sum256([]byte(pageURL))
+	urlHash := hex.EncodeToString(hash[:])
+
+	tests := []struct {
+		tmpl     string
+		name     string
+		expected string
+	}{
+		{"", "s42-abc.png", "s42-abc.png"},
+		{"{name}.{ext}", "s42-abc.png", "s42-abc.png"},
+		{"{name}.{ext}", "login", "login.png"},
+		{"{sourceID}/{yyyy}/{mm}/{dd}/{urlhash}.{ext}", "s42-abc.png", "42/2024/03/07/" + urlHash + ".png"},
+		{"{host}/{hh}/{timestamp}_{name}.{ext}", "shot.jpg", "www.example.com/09/1709803800_shot.jpg"},
+		{"{sourceID}/{unknown}/{name}.{ext}", "shot.png", "42/{unknown}/shot.png"},
+		{"/{sourceID}/../../{name}.{ext}", "../../etc/shot.png", "etc/shot.png"},
+	}
+	for _, test := range tests {
+		got := renderScreenshotPath(test.tmpl, 42, pageURL, test.name, ts)
+		if got != test.expected {
+			t.Errorf("renderScreenshotPath(%q, %q) = %q, want %q", test.tmpl, test.name, got, test.expected)
+		}
+	}
+}
+
+func TestTakeScreenshotViewportMode(t *testing.T) {
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config.ImageStorageAPI.Host = ""
+	config.ImageStorageAPI.Path = t.TempDir()
+
+	viewport := color.RGBA{R: 200, G: 100, B: 50, A: 255}
+	mock := &mockScrollingWebDriver{
+		pageHeight: 20000,
+		shot:       makeScreenshotSlice(t, 800, 600, viewport, viewport),
+	}
+	var wd vdi.WebDriver = mock
+
+	ss, err := TakeScreenshot(&wd, "42/2024/03/07/viewport.png", 0, "viewport")
+	if err != nil {
+		t.Fatalf("TakeScreenshot returned an error: %v", err)
+	}
+	if mock.screenshots != 1 {
+		t.Errorf("Expected a single screenshot in viewport mode, got %d", mock.screenshots)
+	}
+	if ss.Width != 800 || ss.Height != 600 || ss.Format != "png" {
+		t.Errorf("Expected a 800x600 png screenshot, got %dx%d %s", ss.Width, ss.Height, ss.Format)
+	}
+
+	data, err := os.ReadFile(ss.ScreenshotLink)
+	if err != nil {
+		t.Fatalf("reading saved screenshot: %v", err)
+	}
+	if len(data) != ss.ByteSize {
+		t.Errorf("Expected %d bytes, got %d", ss.ByteSize, len(data))
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding saved screenshot: %v", err)
+	}
+	if img.Bounds().Dx() != 800 || img.Bounds().Dy() != 600 {
+		t.Errorf("Expected a single viewport sized image, got %v", img.Bounds())
+	}
+}
+
+func TestWaitForScreenshotReady(t *testing.T) {
+	savedConfig := config
+	defer func() { config = savedConfig }()
+	config.Crawler.ScreenshotSectionWait = 5
+	config.Crawler.ScreenshotMaxHeight = 0
+
+	// An image that takes 3 checks (~300ms) to load
+	mock := &mockScrollingWebDriver{pageHeight: 500, loading: 3}
+	var wd vdi.WebDriver = mock
+
+	start := time.Now()
+	screenshots, err := captureScreenshots(&wd, 500, 500)
+	if err != nil {
+		t.Fatalf("captureScreenshots returned an error: %v", err)
+	}
+	if len(screenshots) != 1 || mock.notReadyAt != 0 {
+		t.Errorf("Expected the screenshot to wait for the image, got %d screenshots (%d while loading)", len(screenshots), mock.notReadyAt)
+	}
+	if mock.readyChecks != 4 {
+		t.Errorf("Expected 4 readiness checks, got %d", mock.readyChecks)
+	}
+	if time.Since(start) >= time.Duration(config.Crawler.ScreenshotSectionWait)*time.Second {
+		t.Errorf("Expected the screenshot to be taken as soon as the page was ready")
+	}
+
+	// The wait is bounded by the timeout
+	mock = &mockScrollingWebDriver{pageHeight: 500, loading: 1000}
+	wd = mock
+	start = time.Now()
+	if waitForScreenshotReady(&wd, 300*time.Millisecond) {
+		t.Errorf("Expected waitForScreenshotReady to time out")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the wait to be bounded by the timeout, took %v", elapsed)
+	}
+}
+
+// fakeIndexStore is an in-memory stand-in for the indexing tables (exposed through
+// a minimal database/sql driver), used to test indexPage under concurrent load
+type fakeIndexStore struct {
+	mutex     sync.Mutex
+	latency   time.Duration    // Simulated duration of every statement
+	deadlocks int              // Number of deadlocks to inject (on WebObjects inserts)
+	ids       map[string]int64 // Row IDs by table and key
+	rows      map[string]bool  // Committed rows
+	active    int              // Transactions in progress
+	maxActive int              // Maximum number of transactions in progress at the same time
+}
+
+func newFakeIndexStore(latency time.Duration, deadlocks int) *fakeIndexStore {
+	return &fakeIndexStore{
+		latency:   latency,
+		deadlocks: deadlocks,
+		ids:       make(map[string]int64),
+		rows:      make(map[string]bool),
+	}
+}
+
+// rowKey returns the key of a row, tables with a unique key use only the first values
+func rowKey(table string, values ...interface{}) string {
+	switch table {
+	case "SearchIndex", "WebObjects", "Keywords", "PageHTML":
+		values = values[:1]
+	case "MetaTags", "KeywordIndex", "SourceSearchIndex":
+		values = values[:2]
+	}
+	return table + ":" + fmt.Sprint(values...)
+}
+
+func (s *fakeIndexStore) has(table string, values ...interface{}) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rows[rowKey(table, values...)]
+}
+
+func (s *fakeIndexStore) id(table string, values ...interface{}) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ids[rowKey(table, values...)]
+}
+
+type fakeIndexConnector struct{ store *fakeIndexStore }
+
+func (c *fakeIndexConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeIndexConn{store: c.store}, nil
+}
+
+func (c *fakeIndexConnector) Driver() driver.Driver { return fakeIndexDriver{} }
+
+type fakeIndexDriver struct{}
+
+func (fakeIndexDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("use the connector")
+}
+
+type fakeIndexConn struct {
+	store   *fakeIndexStore
+	inTx    bool
+	pending []string // Rows written by the transaction in progress
+}
+
+func (c *fakeIndexConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeIndexConn) Close() error { return nil }
+
+func (c *fakeIndexConn) Begin() (driver.Tx, error) {
+	c.store.mutex.Lock()
+	c.store.active++
+	if c.store.active > c.store.maxActive {
+		c.store.maxActive = c.store.active
+	}
+	c.store.mutex.Unlock()
+	c.inTx = true
+	c.pending = nil
+	return c, nil
+}
+
+func (c *fakeIndexConn) end(commit bool) error {
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	c.store.active--
+	if commit {
+		for _, key := range c.pending {
+			c.store.rows[key] = true
+		}
+	}
+	c.inTx = false
+	c.pending = nil
+	return nil
+}
+
+func (c *fakeIndexConn) Commit() error   { return c.end(true) }
+func (c *fakeIndexConn) Rollback() error { return c.end(false) }
+
+func (c *fakeIndexConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, err := c.run(query, args)
+	return driver.RowsAffected(1), err
+}
+
+func (c *fakeIndexConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.HasPrefix(query, "SELECT keyword_id, keyword FROM Keywords") {
+		return c.keywords(args), nil
+	}
+	id, err := c.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	rows := &fakeIndexRows{columns: []string{"id"}}
+	if id != 0 {
+		rows.values = [][]driver.Value{{id}}
+	}
+	return rows, nil
+}
+
+// keywords simulates the query of the IDs of the keywords (stored or
+// written by the transaction in progress)
+func (c *fakeIndexConn) keywords(args []driver.NamedValue) driver.Rows {
+	time.Sleep(c.store.latency)
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	rows := &fakeIndexRows{columns: []string{"keyword_id", "keyword"}}
+	for _, arg := range args {
+		key := rowKey("Keywords", arg.Value)
+		if id, ok := c.store.ids[key]; ok && (c.store.rows[key] || slices.Contains(c.pending, key)) {
+			rows.values = append(rows.values, []driver.Value{id, arg.Value})
+		}
+	}
+	return rows
+}
+
+// run simulates a statement, it returns the ID of the (last) row written (0 if none)
+func (c *fakeIndexConn) run(query string, args []driver.NamedValue) (int64, error) {
+	time.Sleep(c.store.latency)
+
+	fields := strings.Fields(query)
+	if len(fields) < 3 || fields[0] != "INSERT" {
+		return 0, nil // SELECTs find nothing, DELETEs have nothing to delete
+	}
+	table := fields[2]
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	// Multi-row inserts have the same number of values per row
+	rows := strings.Count(query, "), (") + 1
+	width := len(values) / rows
+
+	c.store.mutex.Lock()
+	defer c.store.mutex.Unlock()
+	if table == "WebObjects" && c.store.deadlocks > 0 {
+		c.store.deadlocks--
+		return 0, errors.New("pq: deadlock detected")
+	}
+	var id int64
+	for row := 0; row < rows; row++ {
+		key := rowKey(table, values[row*width:(row+1)*width]...)
+		var ok bool
+		id, ok = c.store.ids[key]
+		if !ok {
+			id = int64(len(c.store.ids) + 1)
+			c.store.ids[key] = id
+		}
+		if c.inTx {
+			c.pending = append(c.pending, key)
+		} else {
+			c.store.rows[key] = true
+		}
+	}
+	return id, nil
+}
+
+type fakeIndexRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeIndexRows) Columns() []string { return r.columns }
+func (r *fakeIndexRows) Close() error      { return nil }
+
+func (r *fakeIndexRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeIndexHandler is a database handler backed by a fakeIndexStore
+type fakeIndexHandler struct {
+	cdb.Handler
+	db *sql.DB
+}
+
+func newFakeIndexHandler(store *fakeIndexStore) *fakeIndexHandler {
+	return &fakeIndexHandler{db: sql.OpenDB(&fakeIndexConnector{store: store})}
+}
+
+func (h *fakeIndexHandler) CheckConnection(cfg.Config) error { return nil }
+func (h *fakeIndexHandler) Begin() (*sql.Tx, error)          { return h.db.Begin() }
+func (h *fakeIndexHandler) DBMS() string                     { return cdb.DBPostgresStr }
+
+func (h *fakeIndexHandler) QueryRow(query string, args ...interface{}) *sql.Row {
+	return h.db.QueryRow(query, args...)
+}
+
+func (h *fakeIndexHandler) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return h.db.Exec(query, args...)
+}
+
+func (h *fakeIndexHandler) ExecuteQuery(query string, args ...interface{}) (*sql.Rows, error) {
+	return h.db.Query(query, args...)
+}
+
+// fakeIndexPage returns the n-th page of the indexing tests
+func fakeIndexPage(n int) (string, PageInfo) {
+	conf := cfg.NewConfig()
+	conf.Crawler.CollectMetaTags = true
+	conf.Crawler.CollectKeywords = true
+	return fmt.Sprintf("https://www.example.com/page/%d", n), PageInfo{
+		sourceID: 1,
+		Title:    fmt.Sprintf("Page %d", n),
+		BodyText: fmt.Sprintf("The body of page %d", n),
+		Keywords: []string{fmt.Sprintf("keyword%d", n), "index", "crowler"},
+		MetaTags: []MetaTag{{Name: "description", Content: "shared"}, {Name: "author", Content: fmt.Sprint(n)}},
+		Config:   conf,
+	}
+}
+
+// indexPagesConcurrently indexes pages (each one multiple times) from multiple
+// goroutines, it returns the index ID of every page
+func indexPagesConcurrently(t *testing.T, db cdb.Handler, pages, workers int) map[string]uint64 {
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	ids := make(map[string]uint64)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < pages; i++ {
+				url, pageInfo := fakeIndexPage((w + i) % pages)
+				id, err := indexPage(db, url, &pageInfo)
+				if err != nil {
+					t.Errorf("indexing %s: %v", url, err)
+					return
+				}
+				mutex.Lock()
+				if prev, ok := ids[url]; ok && prev != id {
+					t.Errorf("Expected %s to always get index ID %d, got %d", url, prev, id)
+				}
+				ids[url] = id
+				mutex.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	return ids
+}
+
+func TestIndexPageConcurrent(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	const pages = 20
+	store := newFakeIndexStore(200*time.Microsecond, 5)
+	db := newFakeIndexHandler(store)
+	ids := indexPagesConcurrently(t, db, pages, 8)
+
+	if store.maxActive < 2 {
+		t.Errorf("Expected pages to be indexed concurrently, got at most %d transactions at the same time", store.maxActive)
+	}
+	if store.deadlocks != 0 {
+		t.Errorf("Expected all the injected deadlocks to be hit, %d left", store.deadlocks)
+	}
+	if store.active != 0 {
+		t.Errorf("Expected no transactions left open, got %d", store.active)
+	}
+	if len(ids) != pages {
+		t.Fatalf("Expected %d pages to be indexed, got %d", pages, len(ids))
+	}
+
+	// Every page must be completely indexed (transactions hit by a deadlock are retried)
+	for n := 0; n < pages; n++ {
+		url, pageInfo := fakeIndexPage(n)
+		indexID := int64(ids[url])
+		if !store.has("SearchIndex", url) || !store.has("SourceSearchIndex", int64(1), indexID) {
+			t.Errorf("Expected %s to be in the search index", url)
+		}
+		objects := 0
+		for key := range store.rows {
+			if strings.HasPrefix(key, "WebObjectsIndex:"+fmt.Sprint(indexID)+" ") {
+				objects++
+			}
+		}
+		if objects != 1 {
+			t.Errorf("Expected 1 web object for %s, got %d", url, objects)
+		}
+		for _, mt := range pageInfo.MetaTags {
+			metatagID := store.id("MetaTags", mt.Name, mt.Content)
+			if !store.has("MetaTagsIndex", indexID, metatagID) {
+				t.Errorf("Expected meta tag %v to be indexed for %s", mt, url)
+			}
+		}
+		for _, kw := range pageInfo.Keywords {
+			keywordID := store.id("Keywords", kw)
+			if !store.has("Keywords", kw) || !store.has("KeywordIndex", keywordID, indexID) {
+				t.Errorf("Expected keyword %s to be indexed for %s", kw, url)
+			}
+		}
+	}
+}
+
+func TestIndexPageMaxConcurrentIndexing(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = newSemaphore(1)
+
+	store := newFakeIndexStore(100*time.Microsecond, 0)
+	indexPagesConcurrently(t, newFakeIndexHandler(store), 10, 4)
+	if store.maxActive != 1 {
+		t.Errorf("Expected indexing to be serialized, got %d transactions at the same time", store.maxActive)
+	}
+}
+
+func TestIndexPageRetriesAreBounded(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	store := newFakeIndexStore(0, 100)
+	url, pageInfo := fakeIndexPage(1)
+	_, err := indexPage(newFakeIndexHandler(store), url, &pageInfo)
+	if err == nil || !strings.Contains(err.Error(), "deadlock detected") {
+		t.Fatalf("Expected a deadlock error, got %v", err)
+	}
+	if attempts := 100 - store.deadlocks; attempts != maxIndexTxAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxIndexTxAttempts, attempts)
+	}
+	if store.has("SearchIndex", url) || store.active != 0 {
+		t.Errorf("Expected the failed transactions to be rolled back")
+	}
+}
+
+func TestIndexPageRawHTML(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	html := "<html><body><p>" + strings.Repeat("The raw HTML of the page. ", 100) + "</p></body></html>"
+	compressed, err := compressHTML(html)
+	if err != nil {
+		t.Fatalf("compressHTML() error = %v", err)
+	}
+	if len(compressed) >= len(html) {
+		t.Errorf("compressHTML() returned %d bytes for %d bytes of HTML", len(compressed), len(html))
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	if data, err := io.ReadAll(gz); err != nil || string(data) != html {
+		t.Errorf("decompressed HTML = %q, %v, want the original HTML", data, err)
+	}
+
+	for _, store := range []bool{false, true} {
+		db := newFakeIndexStore(0, 0)
+		url, pageInfo := fakeIndexPage(1)
+		pageInfo.HTML = html
+		pageInfo.Config.Crawler.StoreRawHTML = store
+		indexID, err := indexPage(newFakeIndexHandler(db), url, &pageInfo)
+		if err != nil {
+			t.Fatalf("indexPage() error = %v", err)
+		}
+		if got := db.has("PageHTML", indexID); got != store {
+			t.Errorf("raw HTML stored = %v with store_raw_html = %v", got, store)
+		}
+	}
+}
+
+// newSQLiteIndexDB returns a SQLite database (in a temporary directory) with
+// the given number of sources
+func newSQLiteIndexDB(t testing.TB, sources int) cdb.Handler {
+	conf := cfg.NewConfig()
+	conf.Database.Driver = cfg.DBDriverSQLite
+	conf.Database.DBName = filepath.Join(t.TempDir(), "crowler.db")
+	db, err := cdb.NewHandler(*conf)
+	if err != nil {
+		t.Skipf("SQLite isn't available: %v", err) // Built without cgo
+	}
+	if err := db.Connect(*conf); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() }) //nolint:errcheck // We can't check the error in a cleanup
+	for id := 1; id <= sources; id++ {
+		if _, err := db.Exec(`INSERT INTO Sources (source_id, url) VALUES ($1, $2)`, id, fmt.Sprintf("https://www%d.example.com", id)); err != nil {
+			t.Fatalf("inserting the source: %v", err)
+		}
+	}
+	return db
+}
+
+func TestIndexPageSQLite(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 1)
+
+	// Concurrent indexing (each page multiple times) keeps the index IDs
+	const pages = 10
+	ids := indexPagesConcurrently(t, db, pages, 4)
+	if len(ids) != pages {
+		t.Fatalf("Expected %d pages to be indexed, got %d", pages, len(ids))
+	}
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+	if n := count(`SELECT COUNT(*) FROM SearchIndex`); n != pages {
+		t.Errorf("Expected %d pages in SearchIndex, got %d", pages, n)
+	}
+	if n := count(`SELECT COUNT(*) FROM Keywords`); n != pages+2 {
+		t.Errorf("Expected %d keywords, got %d", pages+2, n)
+	}
+	if n := count(`SELECT COUNT(*) FROM MetaTags WHERE name = $1`, "description"); n != 1 {
+		t.Errorf("Expected the shared meta tag to be stored once, got %d", n)
+	}
+	for n := 0; n < pages; n++ {
+		url, pageInfo := fakeIndexPage(n)
+		indexID := ids[url]
+		if got := count(`SELECT COUNT(*) FROM SourceSearchIndex WHERE source_id = $1 AND index_id = $2`, 1, indexID); got != 1 {
+			t.Errorf("Expected %s to be linked to its source", url)
+		}
+		if got := count(`SELECT COUNT(*) FROM KeywordIndex WHERE index_id = $1`, indexID); got != len(pageInfo.Keywords) {
+			t.Errorf("Expected %d keywords indexed for %s, got %d", len(pageInfo.Keywords), url, got)
+		}
+		if got := count(`SELECT COUNT(*) FROM MetaTagsIndex WHERE index_id = $1`, indexID); got != len(pageInfo.MetaTags) {
+			t.Errorf("Expected %d meta tags indexed for %s, got %d", len(pageInfo.MetaTags), url, got)
+		}
+		if got := count(`SELECT COUNT(*) FROM WebObjectsIndex WHERE index_id = $1`, indexID); got != 1 {
+			t.Errorf("Expected 1 web object for %s, got %d", url, got)
+		}
+	}
+
+	// Indexing a page again updates it
+	url, pageInfo := fakeIndexPage(1)
+	pageInfo.Title = "Page 1 (updated)"
+	pageInfo.StatusCode = 200
+	pageInfo.Breadcrumbs = []string{"Home", "Pages", "Page 1"}
+	pageInfo.HTML = "<html><body><form action='/search'></form></body></html>"
+	pageInfo.Forms = []PageForm{{Action: "/search", Method: "GET", Fields: []FormField{{Name: "q", Type: "text"}}}}
+	pageInfo.Config.Crawler.StoreRawHTML = true
+	pageInfo.Config.Crawler.CollectForms = true
+	pageInfo.Media = []MediaInfo{{Type: "video", Src: "https://www.youtube.com/embed/abc", Provider: "youtube"}}
+	pageInfo.Config.Crawler.CollectMedia = true
+	indexID, err := indexPage(db, url, &pageInfo)
+	if err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	if indexID != ids[url] {
+		t.Errorf("Expected %s to keep index ID %d, got %d", url, ids[url], indexID)
+	}
+	var title string
+	var statusCode int
+	if err := db.QueryRow(`SELECT title, status_code FROM SearchIndex WHERE index_id = $1`, indexID).Scan(&title, &statusCode); err != nil || title != pageInfo.Title || statusCode != 200 {
+		t.Errorf("SearchIndex entry = %q, %d (%v), expected the updated page", title, statusCode, err)
+	}
+	var breadcrumbs string
+	if err := db.QueryRow(`SELECT breadcrumbs FROM SearchIndex WHERE index_id = $1`, indexID).Scan(&breadcrumbs); err != nil || breadcrumbs != `["Home","Pages","Page 1"]` {
+		t.Errorf("SearchIndex breadcrumbs = %q (%v), expected the page breadcrumb trail", breadcrumbs, err)
+	}
+	var forms string
+	if err := db.QueryRow(`SELECT details FROM PageForms WHERE index_id = $1`, indexID).Scan(&forms); err != nil || !strings.Contains(forms, `"action":"/search"`) {
+		t.Errorf("PageForms details = %q (%v), expected the page form", forms, err)
+	}
+	var media string
+	if err := db.QueryRow(`SELECT details FROM PageMedia WHERE index_id = $1`, indexID).Scan(&media); err != nil || !strings.Contains(media, `"provider":"youtube"`) {
+		t.Errorf("PageMedia details = %q (%v), expected the page media", media, err)
+	}
+	if n := count(`SELECT COUNT(*) FROM PageHTML WHERE index_id = $1 AND html_size = $2`, indexID, len(pageInfo.HTML)); n != 1 {
+		t.Errorf("Expected the raw HTML of %s to be stored", url)
+	}
+}
+
+func TestIndexPageConcurrentSources(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 2)
+	const pages = 10
+	const sharedURL = "https://www.example.com/shared"
+
+	// sourcePage returns the n-th page of a source (the last one is shared
+	// by the sources)
+	sourcePage := func(source, n int) (string, PageInfo) {
+		_, pageInfo := fakeIndexPage(n)
+		pageInfo.sourceID = uint64(source)
+		pageInfo.Title = fmt.Sprintf("Source %d page %d", source, n)
+		pageInfo.Keywords = append(pageInfo.Keywords, fmt.Sprintf("source%d", source))
+		if n == pages {
+			return sharedURL, pageInfo
+		}
+		return fmt.Sprintf("https://www%d.example.com/page/%d", source, n), pageInfo
+	}
+
+	// Both sources index their pages (each one multiple times) at the same time
+	var wg sync.WaitGroup
+	for source := 1; source <= 2; source++ {
+		for w := 0; w < 2; w++ {
+			wg.Add(1)
+			go func(source int) {
+				defer wg.Done()
+				for n := 0; n <= pages; n++ {
+					url, pageInfo := sourcePage(source, n)
+					if _, err := indexPage(db, url, &pageInfo); err != nil {
+						t.Errorf("indexing %s: %v", url, err)
+						return
+					}
+				}
+			}(source)
+		}
+	}
+	wg.Wait()
+
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+	if n := count(`SELECT COUNT(*) FROM SearchIndex`); n != 2*pages+1 {
+		t.Errorf("Expected %d pages in SearchIndex, got %d", 2*pages+1, n)
+	}
+	for source := 1; source <= 2; source++ {
+		for n := 0; n <= pages; n++ {
+			url, pageInfo := sourcePage(source, n)
+			var indexID uint64
+			var title string
+			if err := db.QueryRow(`SELECT index_id, title FROM SearchIndex WHERE page_url = $1`, url).Scan(&indexID, &title); err != nil {
+				t.Fatalf("Expected %s to be indexed: %v", url, err)
+			}
+			if url != sharedURL && title != pageInfo.Title {
+				t.Errorf("Expected %s to have title %q, got %q", url, pageInfo.Title, title)
+			}
+			if got := count(`SELECT COUNT(*) FROM SourceSearchIndex WHERE source_id = $1 AND index_id = $2`, source, indexID); got != 1 {
+				t.Errorf("Expected %s to be linked to source %d", url, source)
+			}
+			linked := 1
+			if url == sharedURL {
+				linked = 2
+			}
+			if got := count(`SELECT COUNT(*) FROM SourceSearchIndex WHERE index_id = $1`, indexID); got != linked {
+				t.Errorf("Expected %s to be linked to %d sources, got %d", url, linked, got)
+			}
+			if got := count(`SELECT COUNT(*) FROM WebObjectsIndex WHERE index_id = $1`, indexID); got != 1 {
+				t.Errorf("Expected 1 web object for %s, got %d", url, got)
+			}
+			if url == sharedURL {
+				continue
+			}
+			if got := count(`SELECT COUNT(*) FROM KeywordIndex ki JOIN Keywords k ON ki.keyword_id = k.keyword_id
+				WHERE ki.index_id = $1 AND k.keyword = $2`, indexID, fmt.Sprintf("source%d", 3-source)); got != 0 {
+				t.Errorf("Expected %s not to have the keywords of the other source", url)
+			}
+			if got := count(`SELECT COUNT(*) FROM KeywordIndex WHERE index_id = $1`, indexID); got != len(pageInfo.Keywords) {
+				t.Errorf("Expected %d keywords indexed for %s, got %d", len(pageInfo.Keywords), url, got)
+			}
+		}
+	}
+}
+
+func TestIndexPageCrossSourceDedup(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 2)
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	url, page1 := fakeIndexPage(1)
+	page1.Config.Crawler.CrossSourceDedup = true
+	indexID, err := indexPage(db, url, &page1)
+	if err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+
+	// The second source reaches the same page, with the same content (its
+	// extra keyword isn't stored, the content isn't stored again)
+	_, page2 := fakeIndexPage(1)
+	page2.sourceID = 2
+	page2.Config.Crawler.CrossSourceDedup = true
+	page2.Keywords = append(page2.Keywords, "source2")
+	if id, err := indexPage(db, url, &page2); err != nil || id != indexID {
+		t.Fatalf("indexPage() = %d, %v, want index ID %d", id, err, indexID)
+	}
+	if n := count(`SELECT COUNT(*) FROM SearchIndex`); n != 1 {
+		t.Errorf("Expected the page to be indexed once, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM SourceSearchIndex WHERE index_id = $1`, indexID); n != 2 {
+		t.Errorf("Expected the page to be linked to 2 sources, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM WebObjects`); n != 1 {
+		t.Errorf("Expected the page content to be stored once, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM KeywordIndex WHERE index_id = $1`, indexID); n != len(page1.Keywords) {
+		t.Errorf("Expected %d keywords indexed, got %d", len(page1.Keywords), n)
+	}
+
+	// Changed content is stored
+	page2.BodyText = "The updated body of page 1"
+	if _, err := indexPage(db, url, &page2); err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	if n := count(`SELECT COUNT(*) FROM WebObjectsIndex WHERE index_id = $1`, indexID); n != 2 {
+		t.Errorf("Expected the updated content to be stored, got %d web objects", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM KeywordIndex WHERE index_id = $1`, indexID); n != len(page2.Keywords) {
+		t.Errorf("Expected %d keywords indexed, got %d", len(page2.Keywords), n)
+	}
+}
+
+func TestIndexPageCanonicalURL(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 2)
+	const canonical = "https://www.example.com/page/1"
+	const crawled = "https://www.example.com/page/1?utm_source=newsletter"
+
+	// The first source crawls the canonical URL, the second a non-canonical one
+	_, page1 := fakeIndexPage(1)
+	page1.Config.Crawler.IndexCanonicalURL = true
+	page1.CanonicalURL = canonical
+	indexID, err := indexPage(db, canonical, &page1)
+	if err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	_, page2 := fakeIndexPage(1)
+	page2.sourceID = 2
+	page2.Config.Crawler.IndexCanonicalURL = true
+	page2.CanonicalURL = canonical
+	if id, err := indexPage(db, crawled, &page2); err != nil || id != indexID {
+		t.Fatalf("indexPage() = %d, %v, want index ID %d", id, err, indexID)
+	}
+
+	// The page is indexed once, under its canonical URL
+	var pageURL string
+	var pages int
+	if err := db.QueryRow(`SELECT COUNT(*), MAX(page_url) FROM SearchIndex`).Scan(&pages, &pageURL); err != nil {
+		t.Fatalf("querying SearchIndex: %v", err)
+	}
+	if pages != 1 || pageURL != canonical {
+		t.Errorf("Expected the page to be indexed once as %s, got %d page(s) (%s)", canonical, pages, pageURL)
+	}
+	// Each source records the URL it crawled
+	for source, want := range map[int]string{1: canonical, 2: crawled} {
+		var crawledURL string
+		err := db.QueryRow(`SELECT crawled_url FROM SourceSearchIndex WHERE source_id = $1 AND index_id = $2`, source, indexID).Scan(&crawledURL)
+		if err != nil || crawledURL != want {
+			t.Errorf("Expected source %d to have crawled %s, got %q (%v)", source, want, crawledURL, err)
+		}
+	}
+
+	// Without the option the page is indexed under the crawled URL
+	page2.Config.Crawler.IndexCanonicalURL = false
+	id, err := indexPage(db, crawled, &page2)
+	if err != nil || id == indexID {
+		t.Errorf("indexPage() = %d, %v, want a new index entry", id, err)
+	}
+}
+
+func TestPageIndexURL(t *testing.T) {
+	const crawled = "https://www.example.com/page/1?utm_source=newsletter"
+	tests := []struct {
+		name       string
+		canonical  string
+		sourceURL  string
+		restricted uint
+		want       string
+	}{
+		{"same host", "https://www.example.com/page/1", "", 0, "https://www.example.com/page/1"},
+		{"no canonical", "", "https://www.example.com", 2, crawled},
+		{"other site", "https://www.other.com/page/1", "https://www.example.com", 1, crawled},
+		{"other site, no scope", "https://www.other.com/page/1", "", 0, crawled},
+		{"other site, unrestricted", "https://www.other.com/page/1", "https://www.example.com", 4, crawled},
+		{"subdomain in scope", "https://shop.example.com/page/1", "https://www.example.com", 3, "https://shop.example.com/page/1"},
+		{"subdomain out of scope", "https://shop.example.com/page/1", "https://www.example.com/", 1, crawled},
+		{"invalid canonical", "https://%zz/page", "https://www.example.com", 3, crawled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := PageInfo{URL: crawled, CanonicalURL: tt.canonical, sourceURL: tt.sourceURL, restricted: tt.restricted}
+			page.Config = &cfg.Config{}
+			page.Config.Crawler.IndexCanonicalURL = true
+			if got := pageIndexURL(&page); got != tt.want {
+				t.Errorf("pageIndexURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateBodyText(t *testing.T) {
+	tests := []struct {
+		text      string
+		maxBytes  int
+		expected  string
+		truncated bool
+	}{
+		{"Short text", 0, "Short text", false},
+		{"Short text", 10, "Short text", false},
+		{"A longer body text here", 20, "A longer" + bodyTextTruncatedMarker, true},
+		// The multibyte characters aren't split
+		{"Ça coûte très cher", 19, "Ça co" + bodyTextTruncatedMarker, true},
+		{"日本語のテキスト", 8, "日本", true},
+	}
+	for _, test := range tests {
+		result, truncated := truncateBodyText(test.text, test.maxBytes)
+		if result != test.expected || truncated != test.truncated {
+			t.Errorf("truncateBodyText(%q, %d) = %q, %v, want %q, %v", test.text, test.maxBytes, result, truncated, test.expected, test.truncated)
+		}
+		if !utf8.ValidString(result) || (test.maxBytes > 0 && len(result) > test.maxBytes) {
+			t.Errorf("truncateBodyText(%q, %d) = %q, not valid UTF-8 within the limit", test.text, test.maxBytes, result)
+		}
+	}
+}
+
+func TestIndexPageBodyTextTruncated(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 1)
+	pageURL, page := fakeIndexPage(1)
+	page.Truncated = true
+	indexID, err := indexPage(db, pageURL, &page)
+	if err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+
+	var truncated bool
+	if err := db.QueryRow(`SELECT body_text_truncated FROM SearchIndex WHERE index_id = $1`, indexID).Scan(&truncated); err != nil {
+		t.Fatalf("querying SearchIndex: %v", err)
+	}
+	if !truncated {
+		t.Errorf("Expected the page body text to be flagged as truncated")
+	}
+}
+
+func TestExtractCanonicalURL(t *testing.T) {
+	const pageURL = "https://www.example.com/products/widget?utm_source=newsletter"
+	tests := []struct {
+		html     string
+		expected string
+	}{
+		{`<link rel="canonical" href="https://www.example.com/products/widget">`, "https://www.example.com/products/widget"},
+		{`<link rel="Canonical" href="/products/widget#top">`, "https://www.example.com/products/widget"},
+		{`<link rel="alternate" href="/fr/products/widget">`, ""},
+		{`<link rel="canonical" href="javascript:void(0)">`, ""},
+		{`<link rel="canonical" href="ftp://www.example.com/widget">`, ""},
+		{`<title>No canonical</title>`, ""},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.html + "</head><body></body></html>"))
+		if err != nil {
+			t.Fatalf("parsing %s: %v", tt.html, err)
+		}
+		if got := extractCanonicalURL(doc, (&ProcessContext{}).linksBaseURL(doc, pageURL)); got != tt.expected {
+			t.Errorf("extractCanonicalURL(%s) = %q, want %q", tt.html, got, tt.expected)
+		}
+	}
+}
+
+// refererSite is a VDI session on a site serving its pages only to the
+// navigations with the Referer of the page linking to them
+type refererSite struct {
+	*mockWebDriver
+	linkedFrom map[string]string // The page linking to each page (by URL)
+}
+
+func (s *refererSite) ExecuteChromeDPCommand(cmd string, params map[string]interface{}) (interface{}, error) {
+	s.calls = append(s.calls, "cdp:"+cmd)
+	if cmd != "Page.navigate" {
+		return nil, nil
+	}
+	url, _ := params["url"].(string)
+	referer, _ := params["referrer"].(string)
+	if s.linkedFrom[url] != "" && referer != s.linkedFrom[url] {
+		return map[string]interface{}{"frameId": "1", "errorText": "net::ERR_BLOCKED_BY_RESPONSE"}, nil
+	}
+	s.url = url
+	return map[string]interface{}{"frameId": "1"}, nil
+}
+
+func (s *refererSite) Get(url string) error {
+	if s.linkedFrom[url] != "" {
+		s.calls = append(s.calls, "get:"+url)
+		return fmt.Errorf("403 Forbidden: %s requires the Referer %s", url, s.linkedFrom[url])
+	}
+	return s.mockWebDriver.Get(url)
+}
+
+func TestSetReferer(t *testing.T) {
+	const home = "https://shop.example.com/"
+	const product = "https://shop.example.com/product/42"
+	site := &refererSite{mockWebDriver: &mockWebDriver{}, linkedFrom: map[string]string{product: home}}
+	ctx := &ProcessContext{wd: site}
+
+	// Without the Referer the navigation is blocked
+	ctx.setReferer(home)
+	if err := navigateTo(context.Background(), ctx.wd, product, ctx.referer); err == nil {
+		t.Fatalf("Expected the navigation without Referer to be blocked")
+	}
+	if len(site.calls) != 1 || site.calls[0] != "get:"+product {
+		t.Errorf("Expected a plain navigation with the Referer disabled, got %v", site.calls)
+	}
+
+	ctx.config.Crawler.SendReferer = true
+	ctx.config.Crawler.OperatorContact.Email = "crawler@example.com"
+	ctx.setReferer(home)
+	if err := navigateTo(context.Background(), ctx.wd, product, ctx.referer); err != nil || site.url != product {
+		t.Fatalf("navigateTo() error = %v, at %s", err, site.url)
+	}
+	if err := navigateTo(context.Background(), ctx.wd, product, "https://shop.example.com/other"); err == nil {
+		t.Errorf("Expected the navigation with the wrong Referer to fail")
+	}
+
+	// The documents are downloaded with the Referer (and the identity headers)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != home || r.Header.Get("From") != "crawler@example.com" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("Terms of sale"))
+	}))
+	defer server.Close()
+	if info, err := extractDocument(server.URL+"/terms.txt", "application/txt", ctx.documentHeaders(), nil); err != nil || info.BodyText != "Terms of sale" {
+		t.Errorf("extractDocument() = %q, %v", info.BodyText, err)
+	}
+
+	// The Referer isn't kept for the following navigations (e.g. the start
+	// page), nor set on the VDI session
+	ctx.setReferer("")
+	calls := len(site.calls)
+	if err := navigateTo(context.Background(), ctx.wd, home, ctx.referer); err != nil || len(site.calls) != calls+1 || site.calls[calls] != "get:"+home {
+		t.Errorf("Expected a plain navigation without Referer, got %v, %v", site.calls[calls:], err)
+	}
+	for _, call := range site.calls {
+		if call == "cdp:Network.setExtraHTTPHeaders" {
+			t.Errorf("Expected the Referer not to be set on the VDI session, got %v", site.calls)
+		}
+	}
+	if _, err := extractDocument(server.URL+"/terms.txt", "application/txt", ctx.documentHeaders(), nil); err == nil {
+		t.Errorf("Expected the document download without Referer to be blocked")
+	}
+}
+
+func TestIndexServiceScoutResults(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	db := newSQLiteIndexDB(t, 1)
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	ni := &neti.NetInfo{ServiceScout: neti.ServiceScoutInfo{Hosts: []neti.HostInfo{
+		{
+			IP:       []neti.IPInfoDetails{{Address: "192.0.2.10", Type: "ipv4"}},
+			Hostname: []neti.HostNameDetails{{Name: "www.example.com", Type: "user"}},
+			Ports: []neti.PortInfo{
+				{Port: 22, Protocol: "tcp", State: "open", Service: "ssh"},
+				{Port: 443, Protocol: "tcp", State: "open", Service: "https"},
+			},
+			Services: []neti.ServiceInfo{{Name: "ssh", Product: "OpenSSH", Version: "8.9p1", CPEs: []string{"cpe:/a:openbsd:openssh:8.9p1"}}},
+			OS:       []neti.OSInfo{{Name: "Linux 5.X", Accuracy: 95, Classes: []neti.OSCLass{{Vendor: "Linux", OSFamily: "Linux"}}}},
+			Vulnerabilities: []neti.VulnerabilityInfo{
+				{ID: "CVE-2023-38408", Name: "ssh-agent RCE", Severity: "9.8", State: "VULNERABLE"},
+				{ID: "CVE-2023-48795", Name: "Terrapin", Severity: "Medium", State: "VULNERABLE"},
+				{ID: "ssl-ccs-injection", Severity: "unknown"},
+			},
+		},
+		{}, // A host that couldn't be scanned
+	}}}
+	pageInfo := PageInfo{sourceID: 1, NetInfo: ni}
+
+	// Every scan of the source is stored
+	for scan := 0; scan < 2; scan++ {
+		if _, err := indexNetInfo(db, "https://www.example.com", &pageInfo, 1); err != nil {
+			t.Fatalf("indexNetInfo() error = %v", err)
+		}
+	}
+	if n := count(`SELECT COUNT(*) FROM ServiceScoutScans WHERE source_id = $1 AND hosts_count = $2`, 1, 1); n != 2 {
+		t.Errorf("Expected 2 scans of the source, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM ServiceScoutHosts WHERE ip = $1 AND hostname = $2`, "192.0.2.10", "www.example.com"); n != 2 {
+		t.Errorf("Expected the host to be stored with each scan, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM ServiceScoutPorts WHERE state = $1`, "open"); n != 4 {
+		t.Errorf("Expected 4 open ports (2 per scan), got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM ServiceScoutServices WHERE product = $1`, "OpenSSH"); n != 2 {
+		t.Errorf("Expected the service to be stored with each scan, got %d", n)
+	}
+	if n := count(`SELECT COUNT(*) FROM ServiceScoutOS WHERE accuracy = $1`, 95); n != 2 {
+		t.Errorf("Expected the OS to be stored with each scan, got %d", n)
+	}
+
+	// The vulnerabilities can be queried by severity
+	if n := count(`SELECT COUNT(*) FROM ServiceScoutVulnerabilities WHERE severity_level >= $1`, 2); n != 4 {
+		t.Errorf("Expected 4 vulnerabilities with medium severity or higher, got %d", n)
+	}
+	var severity string
+	if err := db.QueryRow(`SELECT severity FROM ServiceScoutVulnerabilities WHERE vuln_id = $1`, "CVE-2023-38408").Scan(&severity); err != nil || severity != "critical" {
+		t.Errorf("CVE-2023-38408 severity = %q (%v), want critical", severity, err)
+	}
+}
+
+// BenchmarkIndexPage compares the indexing throughput when serialized (as it was
+// with the global indexing mutex) and when pages are indexed concurrently
+func BenchmarkIndexPage(b *testing.B) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+
+	for _, bc := range []struct {
+		name  string
+		limit int
+	}{
+		{"serialized", 1},
+		{"concurrent", 0},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			indexingSem = newSemaphore(bc.limit)
+			db := newFakeIndexHandler(newFakeIndexStore(50*time.Microsecond, 0))
+			var n int64
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					url, pageInfo := fakeIndexPage(int(atomic.AddInt64(&n, 1)))
+					if _, err := indexPage(db, url, &pageInfo); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// newSearchIndexEntry stores an (empty) search index entry for the n-th page
+// and returns its index ID
+func newSearchIndexEntry(t testing.TB, db cdb.Handler, n int) uint64 {
+	var indexID uint64
+	err := db.QueryRow(`INSERT INTO SearchIndex (page_url, summary) VALUES ($1, '') RETURNING index_id`,
+		fmt.Sprintf("https://www.example.com/page/%d", n)).Scan(&indexID)
+	if err != nil {
+		t.Fatalf("inserting the search index entry: %v", err)
+	}
+	return indexID
+}
+
+func TestInsertKeywords(t *testing.T) {
+	db := newSQLiteIndexDB(t, 0)
+	count := func(query string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+
+	// More keywords than a batch, with duplicates and a keyword longer than the column
+	var keywords []string
+	for i := 0; i < keywordsBatch+100; i++ {
+		keywords = append(keywords, fmt.Sprintf("keyword%d", i), fmt.Sprintf("keyword%d", i/2))
+	}
+	keywords = append(keywords, strings.Repeat("k", 300), strings.Repeat("k", 256))
+	unique := len(uniqueKeywords(keywords))
+	if unique != keywordsBatch+101 {
+		t.Fatalf("Expected %d unique keywords, got %d", keywordsBatch+101, unique)
+	}
+
+	for n := 1; n <= 2; n++ {
+		indexID := newSearchIndexEntry(t, db, n)
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("Begin() error = %v", err)
+		}
+		if err := insertKeywords(tx, db, indexID, &PageInfo{Keywords: keywords}); err != nil {
+			t.Fatalf("insertKeywords() error = %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+		if n := count(`SELECT COUNT(*) FROM KeywordIndex WHERE index_id = $1`, indexID); n != unique {
+			t.Errorf("Expected %d keywords indexed for index %d, got %d", unique, indexID, n)
+		}
+	}
+	// The keywords shared by the pages are stored once
+	if n := count(`SELECT COUNT(*) FROM Keywords`); n != unique {
+		t.Errorf("Expected %d keywords, got %d", unique, n)
+	}
+}
+
+func TestInsertKeywordsRuleTags(t *testing.T) {
+	db := newSQLiteIndexDB(t, 0)
+	pageInfo := PageInfo{Title: "Widget", BodyText: "The widget ABC-1234 replaces XYZ-0042 (and ABC-1234)"}
+	pageInfo.Keywords = extractKeywords(pageInfo)
+	applyKeywordRules(&pageInfo, compileKeywordRules([]cfg.KeywordRule{{Name: "sku", Pattern: `\b[A-Z]{3}-\d{4}\b`}}))
+
+	indexID := newSearchIndexEntry(t, db, 1)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if err := insertKeywords(tx, db, indexID, &pageInfo); err != nil {
+		t.Fatalf("insertKeywords() error = %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// The SKU codes are indexed (tagged with the rule), the generic keywords aren't tagged
+	for _, sku := range []string{"abc-1234", "xyz-0042"} {
+		var n int
+		err := db.QueryRow(`SELECT COUNT(*) FROM KeywordIndex ki JOIN Keywords k ON ki.keyword_id = k.keyword_id
+			WHERE k.keyword = $1 AND ki.index_id = $2 AND ki.rule_name = 'sku'`, sku, indexID).Scan(&n)
+		if err != nil || n != 1 {
+			t.Errorf("Expected SKU %s to be indexed with the sku tag, got %d (%v)", sku, n, err)
+		}
+	}
+	var untagged int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM KeywordIndex WHERE index_id = $1 AND rule_name IS NULL`, indexID).Scan(&untagged); err != nil {
+		t.Fatalf("counting the untagged keywords: %v", err)
+	}
+	if untagged != len(pageInfo.Keywords)-2 {
+		t.Errorf("Expected %d untagged keywords, got %d", len(pageInfo.Keywords)-2, untagged)
+	}
+}
+
+// insertKeywordsOneByOne stores the keywords of a page with a round trip per
+// keyword (as they were stored before being batched), to benchmark the batches
+func insertKeywordsOneByOne(tx *sql.Tx, indexID uint64, keywords []string) error {
+	for _, keyword := range uniqueKeywords(keywords) {
+		var keywordID int64
+		err := tx.QueryRow(`INSERT INTO Keywords (keyword) VALUES ($1)
+			ON CONFLICT (keyword) DO UPDATE SET keyword = EXCLUDED.keyword
+			RETURNING keyword_id`, keyword).Scan(&keywordID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO KeywordIndex (keyword_id, index_id) VALUES ($1, $2)
+			ON CONFLICT (keyword_id, index_id) DO NOTHING`, keywordID, indexID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func BenchmarkInsertKeywords(b *testing.B) {
+	// Pages with 100 keywords, half of them shared with the other pages
+	pageKeywords := func(n int) []string {
+		keywords := make([]string, 0, 100)
+		for i := 0; i < 50; i++ {
+			keywords = append(keywords, fmt.Sprintf("page%d-keyword%d", n, i), fmt.Sprintf("shared%d", i))
+		}
+		return keywords
+	}
+
+	for _, dbms := range []string{"sqlite", "postgres"} {
+		for _, batched := range []bool{false, true} {
+			name := dbms + "/one-by-one"
+			if batched {
+				name = dbms + "/batched"
+			}
+			b.Run(name, func(b *testing.B) {
+				var db cdb.Handler
+				if dbms == "sqlite" {
+					db = newSQLiteIndexDB(b, 0)
+				} else {
+					db = newFakeIndexHandler(newFakeIndexStore(50*time.Microsecond, 0))
+				}
+				indexIDs := make([]uint64, b.N)
+				for i := range indexIDs {
+					indexIDs[i] = newSearchIndexEntry(b, db, i)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					tx, err := db.Begin()
+					if err != nil {
+						b.Fatal(err)
+					}
+					if batched {
+						err = insertKeywords(tx, db, indexIDs[i], &PageInfo{Keywords: pageKeywords(i)})
+					} else {
+						err = insertKeywordsOneByOne(tx, indexIDs[i], pageKeywords(i))
+					}
+					if err != nil {
+						b.Fatal(err)
+					}
+					if err := tx.Commit(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	messy := "\n\t  Breaking\u00a0 news \u200b\r\n\n\n   The  CROWler\tcrawls\u200b  the\u00a0web.  \n\t\n"
+	tests := []struct {
+		ws       cfg.Whitespace
+		expected string
+	}{
+		{cfg.Whitespace{Mode: cfg.WhitespaceCollapse}, "Breaking news \u200b The CROWler crawls\u200b the web."},
+		{cfg.Whitespace{Mode: cfg.WhitespaceCollapse, StripZeroWidth: true}, "Breaking news The CROWler crawls the web."},
+		{cfg.Whitespace{Mode: cfg.WhitespaceLines, StripZeroWidth: true}, "Breaking news\nThe CROWler crawls the web."},
+		{cfg.Whitespace{Mode: cfg.WhitespaceNone}, messy},
+	}
+	for _, tt := range tests {
+		if got := normalizeWhitespace(messy, tt.ws); got != tt.expected {
+			t.Errorf("normalizeWhitespace(%+v) = %q, want %q", tt.ws, got, tt.expected)
+		}
+	}
+}
+
+func TestExtractSummary(t *testing.T) {
+	const allSources = "meta_description,og_description,twitter_description,first_paragraph,lead,body_text"
+	longText := "This paragraph of the article is long enough to be considered the lead of the page."
+	tests := []struct {
+		name     string
+		html     string
+		sources  string
+		expected string
+	}{
+		{
+			"meta description",
+			`<html><head><meta name="description" content="Meta"><meta property="og:description" content="OG"></head><body><p>Para</p></body></html>`,
+			allSources, "Meta",
+		},
+		{
+			"falls through to og description",
+			`<html><head><meta name="description" content=" "><meta property="og:description" content="OG"><meta name="twitter:description" content="Twitter"></head><body><p>Para</p></body></html>`,
+			allSources, "OG",
+		},
+		{
+			"falls through to twitter description",
+			`<html><head><meta name="twitter:description" content="Twitter"></head><body><p>Para</p></body></html>`,
+			allSources, "Twitter",
+		},
+		{
+			"falls through to first paragraph",
+			`<html><body><p>  </p><p>First   paragraph</p><p>Second paragraph</p></body></html>`,
+			allSources, "First paragraph",
+		},
+		{
+			"falls through to lead",
+			`<html><body><nav><p>Home About Contact Blog Shop Careers Press Investors Legal Help</p></nav><article><p>Short intro</p><p>` + longText + `</p></article></body></html>`,
+			"meta_description,lead,body_text", longText,
+		},
+		{
+			"falls through to body text",
+			`<html><body><div>Only body text</div></body></html>`,
+			allSources, "Only body text",
+		},
+		{
+			"preference order",
+			`<html><head><meta name="description" content="Meta"></head><body><p>First paragraph</p></body></html>`,
+			"first_paragraph,meta_description", "First paragraph",
+		},
+		{
+			"unknown sources are ignored",
+			`<html><head><meta name="description" content="Meta"></head><body></body></html>`,
+			"unknown, meta_description", "Meta",
+		},
+		{
+			"no summary",
+			`<html><head><meta name="description" content="Meta"></head><body></body></html>`,
+			"first_paragraph,lead", "",
+		},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatalf("%s: parsing HTML: %v", tt.name, err)
+		}
+		bodyText := strings.Join(strings.Fields(doc.Find("body").Text()), " ")
+		if got := extractSummary(doc, bodyText, tt.sources); got != tt.expected {
+			t.Errorf("%s: expected summary %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+
+	// Summaries taken from the page content are truncated
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader("<p>" + strings.Repeat("a", 300) + "</p>"))
+	if got := extractSummary(doc, "", "first_paragraph"); len(got) != summaryMaxLength {
+		t.Errorf("Expected the summary to be truncated to %d characters, got %d", summaryMaxLength, len(got))
+	}
+}
+
+func TestCheckPageSecurity(t *testing.T) {
+	data, err := os.ReadFile("./test_data/mixed_content.json")
+	if err != nil {
+		t.Fatalf("Failed to read mixed content fixture: %v", err)
+	}
+	var perfInfo PerformanceLog
+	if err := json.Unmarshal(data, &perfInfo); err != nil {
+		t.Fatalf("Failed to parse mixed content fixture: %v", err)
+	}
+
+	// HTTPS page loading HTTP resources
+	sec := checkPageSecurity("https://www.example.com/shop/", perfInfo.LogEntries)
+	if !sec.MixedContent {
+		t.Errorf("Expected mixed content to be detected")
+	}
+	if sec.Insecure {
+		t.Errorf("Expected the page connection to be secure")
+	}
+	expected := []string{"http://cdn.example.net/images/banner.png", "http://cdn.example.net/js/tracker.js"}
+	if !reflect.DeepEqual(sec.InsecureResources, expected) {
+		t.Errorf("Expected insecure resources %v, got %v", expected, sec.InsecureResources)
+	}
+
+	// HTTPS page loading only HTTPS resources
+	sec = checkPageSecurity("https://www.example.com/shop/", perfInfo.LogEntries[:2])
+	if sec.MixedContent || sec.Insecure {
+		t.Errorf("Expected no security flags, got %+v", sec)
+	}
+
+	// HTTP page (HTTP resources are not mixed content on an insecure page)
+	sec = checkPageSecurity("http://www.example.com/", perfInfo.LogEntries)
+	if !sec.Insecure || sec.MixedContent {
+		t.Errorf("Expected an insecure page without mixed content, got %+v", sec)
+	}
+
+	// HTTPS page with an insecure connection (e.g., invalid certificate)
+	entries := []PerformanceLogEntry{perfInfo.LogEntries[0]}
+	entries[0].Message.Params.ResponseInfo.SecurityState = "insecure-broken"
+	sec = checkPageSecurity("https://www.example.com/shop/", entries)
+	if !sec.Insecure {
+		t.Errorf("Expected an insecure page connection to be detected")
+	}
+
+	// Skipping indexing is optional
+	conf := cfg.Crawler{}
+	if skipInsecurePage(conf, "http://www.example.com/", PageSecurity{Insecure: true}) {
+		t.Errorf("Expected insecure pages to be indexed by default")
+	}
+	conf.SkipInsecurePages = true
+	if !skipInsecurePage(conf, "https://www.example.com/shop/", PageSecurity{MixedContent: true}) {
+		t.Errorf("Expected mixed content pages to be skipped")
+	}
+	if skipInsecurePage(conf, "https://www.example.com/", PageSecurity{}) {
+		t.Errorf("Expected secure pages to be indexed")
+	}
+}
+
+func TestPageStatusCode(t *testing.T) {
+	logs := []string{
+		`{"message":{"method":"Network.responseReceived","params":{"type":"Document","response":{"url":"https://www.example.com/old","status":301}}}}`,
+		`{"message":{"method":"Network.responseReceived","params":{"type":"Document","response":{"url":"https://www.example.com/missing","status":404}}}}`,
+		`{"message":{"method":"Network.responseReceived","params":{"type":"Image","response":{"url":"https://www.example.com/logo.png","status":200}}}}`,
+		`{"message":{"method":"Network.responseReceived","params":{"type":"XHR","response":{"url":"https://www.example.com/missing","status":200}}}}`,
+	}
+	var entries []PerformanceLogEntry
+	for _, l := range logs {
+		var entry PerformanceLogEntry
+		if err := json.Unmarshal([]byte(l), &entry); err != nil {
+			t.Fatalf("Failed to parse log entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	tests := []struct {
+		url      string
+		expected int
+	}{
+		{"https://www.example.com/missing", 404}, // The document response wins over the XHR one
+		{"https://www.example.com/old", 301},
+		{"https://www.example.com/logo.png", 200},
+		{"https://www.example.com/unknown", 0},
+	}
+	for _, tt := range tests {
+		if got := pageStatusCode(tt.url, entries); got != tt.expected {
+			t.Errorf("pageStatusCode(%s) = %d, expected %d", tt.url, got, tt.expected)
+		}
+	}
+
+	// Skipping indexing is optional
+	conf := cfg.Crawler{}
+	if skipErrorPage(conf, "https://www.example.com/missing", 404) {
+		t.Errorf("Expected error pages to be indexed by default")
+	}
+	conf.SkipErrorPages = true
+	if !skipErrorPage(conf, "https://www.example.com/missing", 404) || !skipErrorPage(conf, "https://www.example.com/", 503) {
+		t.Errorf("Expected error pages to be skipped")
+	}
+	if skipErrorPage(conf, "https://www.example.com/", 200) || skipErrorPage(conf, "https://www.example.com/", 0) {
+		t.Errorf("Expected successful and unknown status pages to be indexed")
+	}
+}
+
+func TestMatchStopCondition(t *testing.T) {
+	data := map[string]interface{}{
+		"title":   "Widget",
+		"price":   float64(42),
+		"product": map[string]interface{}{"sku": "AB-123", "stock": nil},
+	}
+	tests := []struct {
+		cond     cfg.StopCondition
+		expected bool
+	}{
+		{cfg.StopCondition{Key: "title"}, true},
+		{cfg.StopCondition{Key: "missing"}, false},
+		{cfg.StopCondition{Key: "price", Equals: "42"}, true},
+		{cfg.StopCondition{Key: "price", Equals: "43"}, false},
+		{cfg.StopCondition{Key: "product.sku", Matches: `^AB-\d+$`}, true},
+		{cfg.StopCondition{Key: "product.sku", Matches: `^CD-`}, false},
+		{cfg.StopCondition{Key: "product.stock"}, false},
+		{cfg.StopCondition{Key: "title.sku"}, false},
+		{cfg.StopCondition{Key: "title", Matches: `(`}, false},
+	}
+	for _, tt := range tests {
+		if got := matchStopCondition(tt.cond, data); got != tt.expected {
+			t.Errorf("Condition %+v: expected %v, got %v", tt.cond, tt.expected, got)
+		}
+	}
+}
+
+func TestWorkerStopsWhenTargetFound(t *testing.T) {
+	ctx := &ProcessContext{Status: &Status{}, source: &cdb.Source{ID: 3}}
+	ctx.config.Crawler.StopCondition = cfg.StopCondition{Key: "price", Matches: `^\d+$`}
+
+	// Pages without the target don't stop the crawl
+	page := []ScrapedItem{{"title": "Home"}}
+	if ctx.checkStopCondition("https://www.example.com/", page) || ctx.isTargetFound() {
+		t.Fatalf("Expected the crawl to continue when the stop condition doesn't match")
+	}
+
+	page = []ScrapedItem{{"title": "Widget", "price": float64(42)}}
+	if !ctx.checkStopCondition("https://www.example.com/widget", page) {
+		t.Fatalf("Expected the stop condition to match")
+	}
+	if !ctx.Status.TargetFound || ctx.Status.TargetURL != "https://www.example.com/widget" {
+		t.Errorf("Expected the target to be recorded in the status, got %+v", ctx.Status)
+	}
+
+	// The workers don't process any further page
+	jobs := make(chan LinkItem, 2)
+	jobs <- LinkItem{Link: "https://www.example.com/a"}
+	jobs <- LinkItem{Link: "https://www.example.com/b"}
+	close(jobs)
+	if err := worker(context.Background(), ctx, 1, jobs); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if ctx.Status.TotalPages != 0 || ctx.Status.TotalErrors != 0 {
+		t.Errorf("Expected no job to be processed, got %+v", ctx.Status)
+	}
+}
+
+func TestRulesOrder(t *testing.T) {
+	re := &rules.RuleEngine{
+		Rulesets: []rules.Ruleset{
+			{
+				Name: "https://www.example.com",
+				RuleGroups: []rules.RuleGroup{
+					{
+						GroupName:   "Actions",
+						IsEnabled:   true,
+						ActionRules: []rules.ActionRule{{RuleName: "Dismiss overlay", ActionType: "refresh"}},
+					},
+					{
+						GroupName: "Scraping",
+						IsEnabled: true,
+						ScrapingRules: []rules.ScrapingRule{
+							{
+								RuleName: "Price",
+								Elements: []rules.Element{
+									{Key: "price", Selectors: []rules.Selector{{SelectorType: "regex", Selector: `price: (\d+)`}}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		order         string
+		scrapingFirst bool
+	}{
+		{"", false},
+		{cfg.RulesOrderActionsFirst, false},
+		{cfg.RulesOrderScrapingFirst, true},
+	}
+	for _, tt := range tests {
+		cmn.KVStore = cmn.NewKeyValueStore()
+		wd := &mockWebDriver{pages: []string{"<div>price: 42</div>"}}
+		ctx := &ProcessContext{
+			source: &cdb.Source{ID: 1, URL: "https://www.example.com"},
+			re:     re,
+			wd:     wd,
+			Status: &Status{},
+		}
+		ctx.config.Crawler.RulesOrder = tt.order
+
+		scraped, err := ctx.RunActionPlan()
+		if err != nil {
+			t.Fatalf("%q: RunActionPlan returned an error: %v", tt.order, err)
+		}
+		if scraped["price"] != float64(42) {
+			t.Errorf("%q: expected the price to be scraped, got %v", tt.order, scraped)
+		}
+
+		refresh, scrape := -1, -1
+		for i, call := range wd.calls {
+			if call == "refresh" && refresh < 0 {
+				refresh = i
+			}
+			if call == "page_source" && scrape < 0 {
+				scrape = i
+			}
+		}
+		if refresh < 0 || scrape < 0 || (scrape < refresh) != tt.scrapingFirst {
+			t.Errorf("%q: expected scraping first to be %v, got calls %v", tt.order, tt.scrapingFirst, wd.calls)
+		}
+		if ctx.preScraped != nil {
+			t.Errorf("%q: expected the pre-scraped data to be consumed", tt.order)
+		}
+	}
+}
+
+// stuckWebDriver is a WebDriver whose navigation never completes (until it's
+// released)
+type stuckWebDriver struct {
+	vdi.WebDriver
+	release   chan struct{}
+	refreshes atomic.Int32
+	quits     atomic.Int32
+}
+
+func (d *stuckWebDriver) Get(string) error {
+	<-d.release
+	return nil
+}
+
+func (d *stuckWebDriver) Refresh() error {
+	d.refreshes.Add(1)
+	return nil
+}
+
+func (d *stuckWebDriver) Quit() error {
+	d.quits.Add(1)
+	return nil
+}
+
+// flakyWebDriver is a WebDriver whose navigations fail with the given errors
+// (one per navigation) before succeeding
+type flakyWebDriver struct {
+	vdi.WebDriver
+	failures []error
+	urlErr   error // error returned by CurrentURL
+	gets     int
+}
+
+func (d *flakyWebDriver) Get(string) error {
+	d.gets++
+	if len(d.failures) > 0 {
+		err := d.failures[0]
+		d.failures = d.failures[1:]
+		return err
+	}
+	return nil
+}
+
+func (d *flakyWebDriver) CurrentURL() (string, error) {
+	return testFQDN, d.urlErr
+}
+
+// userAgentSession is a VDI session recording the User-Agents it's given
+type userAgentSession struct {
+	*mockWebDriver
+	agents []string
+}
+
+func (s *userAgentSession) ExecuteChromeDPCommand(cmd string, params map[string]interface{}) (interface{}, error) {
+	if cmd == "Network.setUserAgentOverride" {
+		ua, _ := params["userAgent"].(string)
+		s.agents = append(s.agents, ua)
+	}
+	return nil, nil
+}
+
+func TestChangeUserAgent(t *testing.T) {
+	pool := []string{"UA-1", "UA-2", "UA-3"}
+	session := &userAgentSession{mockWebDriver: &mockWebDriver{}}
+	var wd vdi.WebDriver = session
+	ctx := &ProcessContext{rng: cmn.NewRand(7)}
+	ctx.config.Selenium = []cfg.Selenium{{Type: "chrome"}}
+	ctx.config.Crawler = cfg.Crawler{
+		UserAgents:      pool,
+		UserAgentMode:   cfg.UserAgentModeRandom,
+		OperatorContact: cfg.Contact{URL: "https://example.com/crawler"},
+	}
+
+	// The User-Agents are picked from the pool (with the session RNG), as for
+	// a new VDI session
+	rng := cmn.NewRand(7)
+	for i := 0; i < 5; i++ {
+		if err := changeUserAgent(&wd, ctx); err != nil {
+			t.Fatalf("changeUserAgent() error = %v", err)
+		}
+		want := vdi.PickUserAgent(&ctx.config.Crawler, rng, vdi.BrowserChrome, 0) + " (+https://example.com/crawler)"
+		if got := session.agents[len(session.agents)-1]; got != want {
+			t.Errorf("changeUserAgent() set %q, want %q", got, want)
+		}
+	}
+
+	ctx.config.Crawler.UserAgentMode = cfg.UserAgentModeFixed
+	if err := changeUserAgent(&wd, ctx); err != nil || session.agents[len(session.agents)-1] != "UA-1 (+https://example.com/crawler)" {
+		t.Errorf("changeUserAgent() in fixed mode set %q, %v", session.agents[len(session.agents)-1], err)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	crawler := cfg.Crawler{OperatorContact: cfg.Contact{Email: "crawler@example.com", URL: "https://example.com/crawler"}}
+	want := map[string]string{
+		"From":       "crawler@example.com",
+		"User-Agent": robotsFetchAgent + " (+https://example.com/crawler)",
+	}
+	headers := requestHeaders(&crawler, robotsFetchAgent)
+	if !reflect.DeepEqual(headers, want) {
+		t.Errorf("requestHeaders() = %v, want %v", headers, want)
+	}
+
+	// The contact URL isn't appended twice
+	if ua := crawler.ContactUserAgent(want["User-Agent"]); ua != want["User-Agent"] {
+		t.Errorf("ContactUserAgent() = %q, want %q", ua, want["User-Agent"])
+	}
+
+	// The probes send the identity headers
+	cache := NewRobotsCache()
+	cache.fetch = func(_ string, _ int, got map[string]string) (int, []byte, error) {
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("robots.txt fetched with headers %v, want %v", got, want)
+		}
+		return http.StatusNotFound, nil, nil
+	}
+	if _, err := cache.Get("https://example.com/", time.Hour, 5, headers); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	// Without an operator contact only the User-Agent is sent
+	crawler.OperatorContact = cfg.Contact{}
+	if headers := requestHeaders(&crawler, robotsFetchAgent); !reflect.DeepEqual(headers, map[string]string{"User-Agent": robotsFetchAgent}) {
+		t.Errorf("requestHeaders() without contact = %v", headers)
+	}
+}
+
+func TestURLScope(t *testing.T) {
+	scope := newPatternScope([]string{"/products/.*", "(invalid"}, []string{"/products/.*/reviews"})
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/products/widget", true},
+		{"https://example.com/products/widget/reviews", false},
+		{"https://example.com/blog/post", false},
+	}
+	for _, tt := range tests {
+		if got := scope.Contains(tt.url); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	// Without patterns (or with invalid ones only) every URL is in scope
+	if scope := newPatternScope(nil, []string{"[invalid"}); scope != nil || !scope.Contains("https://example.com/blog/post") {
+		t.Errorf("newPatternScope() = %v, want an empty scope containing every URL", scope)
+	}
+
+	ctx := &ProcessContext{
+		source: &cdb.Source{URL: "https://example.com", Restricted: 1},
+		scope:  newPatternScope(nil, []string{`\.pdf$`}),
+	}
+	if !skipURL(ctx, 1, "https://example.com/docs/manual.pdf", "") || skipURL(ctx, 1, "https://example.com/docs/manual.html", "") {
+		t.Errorf("skipURL() doesn't skip only the excluded URL")
+	}
+}
+
+func TestFollowExtensions(t *testing.T) {
+	ctx := &ProcessContext{
+		source: &cdb.Source{URL: "https://example.com", Restricted: 1},
+		config: *cfg.NewConfig(),
+	}
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://example.com/downloads/release.zip", false},
+		{"https://example.com/downloads/setup.EXE?version=2", false},
+		{"https://example.com/docs/manual.html", true},
+		{"https://example.com/docs/", true},
+		{"https://example.com/docs/manual", true},
+	}
+	for _, tt := range tests {
+		if got := !skipURL(ctx, 1, tt.url, ""); got != tt.want {
+			t.Errorf("followed %q = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+
+	// With follow extensions only them (and the links without one) are followed
+	ctx.config.Crawler.FollowExtensions = cfg.NormalizeExtensions([]string{".HTML", "php"})
+	if skipURL(ctx, 1, "https://example.com/index.php", "") || !skipURL(ctx, 1, "https://example.com/manual.pdf", "") {
+		t.Errorf("skipURL() doesn't follow only the links with the follow extensions")
+	}
+}
+
+func TestFollowAnchorPatterns(t *testing.T) {
+	page, err := os.ReadFile("./test_data/anchors.html")
+	if err != nil {
+		t.Fatalf("Failed to read the fixture: %v", err)
+	}
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.source = &cdb.Source{URL: "https://example.com", Restricted: 1}
+	ctx.config.Crawler.BrowsingMode = optBrowsingRecu
+	ctx.anchorScope = newPatternScope([]string{`(?i)^next\b`, `(?i)read more`, `(?i)widget`}, []string{`(?i)discontinued`})
+
+	var followed []string
+	for _, link := range extractLinks(ctx, string(page), "https://example.com/catalog") {
+		if !skipURL(ctx, 1, link.Link, link.AnchorText) {
+			followed = append(followed, link.Link)
+		}
+	}
+	expected := []string{
+		"https://example.com/blog/launch",
+		"https://example.com/products/blue-widget",
+		"https://example.com/products/red-widget",
+		"https://example.com/products/green-widget",
+		"https://example.com/catalog?page=2",
+	}
+	if !reflect.DeepEqual(followed, expected) {
+		t.Errorf("Expected the followed links to be %v, got %v", expected, followed)
+	}
+}
+
+func TestRandomSeedReproducesChoices(t *testing.T) {
+	uaDB := cmn.UserAgentsDB{}
+	for _, brg := range []string{"chrome", "firefox"} {
+		group := cmn.UserAgentGroup{OS: "linux", BRG: brg, Type: "desktop"}
+		for i := 0; i < 10; i++ {
+			group.UserAgents = append(group.UserAgents, cmn.UserAgent{BR: brg, UA: fmt.Sprintf("%s-%d", brg, i)})
+		}
+		uaDB.UserAgentsGroups = append(uaDB.UserAgentsGroups, group)
+	}
+	proxies := []cfg.SOCKSProxy{{Address: "socks5://192.0.2.1:1080"}, {Address: "socks5://192.0.2.2:1080"}, {Address: "socks5://192.0.2.3:1080"}}
+
+	// choices returns the User-Agents, first proxies and delays picked by a
+	// crawl seeded with seed
+	choices := func(seed int64) []string {
+		ctx := &ProcessContext{config: cfg.Config{Crawler: cfg.Crawler{RandomSeed: seed, Delay: "random(1, 100)"}}}
+		ctx.rng = cmn.NewRand(ctx.config.Crawler.RandomSeed)
+		var picked []string
+		for i := 0; i < 20; i++ {
+			picked = append(picked,
+				uaDB.GetAgentByTypeAndOSAndBRG(ctx.GetRand(), "desktop", "linux", "random"),
+				rotateProxies(proxies, ctx.rng)[0].Address,
+				fmt.Sprint(exi.GetFloatWithRand(ctx.config.Crawler.Delay, ctx.rng)))
+		}
+		return picked
+	}
+
+	first := choices(42)
+	if !reflect.DeepEqual(first, choices(42)) {
+		t.Errorf("The same seed picked different User-Agents, proxies or delays")
+	}
+	if reflect.DeepEqual(first, choices(43)) {
+		t.Errorf("Different seeds picked the same User-Agents, proxies and delays")
+	}
+	if cmn.NewRand(0) != nil {
+		t.Errorf("NewRand(0) should return nil (random choices not reproducible)")
+	}
+}
+
+func (priceExtractor) Name() string { return "price" }
+
+func (priceExtractor) Extract(page *ExtractorPage) (map[string]interface{}, error) {
+	price := strings.TrimSpace(page.Doc.Find(".price").Text())
+	return map[string]interface{}{"price": price, FieldTitle: "Product: " + page.Doc.Find("h1").Text()}, nil
+}
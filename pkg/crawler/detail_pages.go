@@ -0,0 +1,214 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	rs "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+const (
+	detailPagesDefaultKey = "items" // Default key of the list items scraped by a list-detail rule
+	detailPagesMaxDepth   = 2       // Maximum nesting of list-detail rules (a detail rule can be a listing too)
+)
+
+// detailPagesKey returns the key where the list items of a list-detail rule are stored
+func detailPagesKey(rule *rs.ScrapingRule) string {
+	key := strings.TrimSpace(rule.DetailPages.Key)
+	if key == "" {
+		return detailPagesDefaultKey
+	}
+	return key
+}
+
+// scrapeDetailPages follows the item links found on the current (listing) page,
+// scrapes each detail page with the rule's detail rule and returns the list
+// items, each one with its URL and the data scraped from its detail page.
+// Links outside the Source domain (or its restricted boundaries, when wider),
+// out of the crawl scope or disallowed by robots.txt are skipped. The detail
+// pages are loaded as the crawled pages (see getURLContent), the crawl delay
+// is respected between them, the ones served with an error status are
+// skipped and the browser is brought back to the listing page when done.
+func scrapeDetailPages(ctx *ProcessContext, rule *rs.ScrapingRule, wd *vdi.WebDriver) ([]interface{}, error) {
+	if ctx.detailDepth >= detailPagesMaxDepth {
+		return nil, fmt.Errorf("detail pages nested too deep (max %d levels)", detailPagesMaxDepth)
+	}
+	if ctx.re == nil {
+		return nil, errors.New("no rules engine available to find the detail rule")
+	}
+	detailRule, err := ctx.re.GetScrapingRuleByName(rule.DetailPages.Rule)
+	if err != nil {
+		return nil, fmt.Errorf("finding detail rule '%s': %v", rule.DetailPages.Rule, err)
+	}
+
+	listingURL, err := (*wd).CurrentURL()
+	if err != nil {
+		return nil, fmt.Errorf("getting the listing page URL: %v", err)
+	}
+
+	links := detailPageLinks(ctx, rule, wd, listingURL)
+	if len(links) == 0 {
+		return []interface{}{}, nil
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug2, "Scraping %d detail pages of '%s' with rule '%s'", len(links), listingURL, detailRule.RuleName)
+
+	ctx.detailDepth++
+	defer func() { ctx.detailDepth-- }()
+
+	items := make([]interface{}, 0, len(links))
+	var errList []string
+	for i, link := range links {
+		if i > 0 {
+			detailPagesDelay(ctx)
+		}
+
+		item := map[string]interface{}{"url": link}
+		if err := openDetailPage(ctx, wd, link); err != nil {
+			errList = append(errList, fmt.Sprintf("navigating to '%s': %v", link, err))
+			continue
+		}
+		data, err := executeScrapingRule(ctx, detailRule, wd)
+		if err != nil {
+			errList = append(errList, fmt.Sprintf("scraping '%s': %v", link, err))
+		}
+		detail := make(map[string]interface{})
+		if strings.TrimSpace(data) != "" {
+			if err := json.Unmarshal([]byte("{"+data+"}"), &detail); err != nil {
+				errList = append(errList, fmt.Sprintf("parsing data scraped from '%s': %v", link, err))
+			}
+		}
+		item["detail"] = detail
+		items = append(items, item)
+	}
+
+	// Return to the listing page, so the rules that follow can still use it
+	if err := openDetailPage(ctx, wd, listingURL); err != nil {
+		errList = append(errList, fmt.Sprintf("returning to listing page '%s': %v", listingURL, err))
+	}
+
+	if len(errList) > 0 {
+		return items, errors.New(strings.Join(errList, "; "))
+	}
+	return items, nil
+}
+
+// detailPageLinks returns the (absolute and unique) item links found on the
+// listing page, within the Source boundaries and the rule's max_items limit
+func detailPageLinks(ctx *ProcessContext, rule *rs.ScrapingRule, wd *vdi.WebDriver, listingURL string) []string {
+	base, err := neturl.Parse(listingURL)
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	for _, selector := range rule.DetailPages.Links {
+		selector = resolveSelectorVars(ctx, selector)
+		if strings.TrimSpace(selector.Extract.Type) == "" {
+			// Links are in the href attribute unless specified otherwise
+			selector.Extract = rs.ItemToExtract{Type: "attribute", Pattern: "href"}
+		}
+
+		for _, extracted := range extractContent(ctx, wd, selector, true) {
+			href, ok := extracted.(string)
+			if !ok {
+				continue
+			}
+			ref, err := neturl.Parse(strings.TrimSpace(href))
+			if err != nil || href == "" {
+				continue
+			}
+			link := base.ResolveReference(ref).String()
+			if seen[link] || !detailPageAllowed(ctx, link) {
+				cmn.DebugMsg(cmn.DbgLvlDebug3, "Skipping detail page '%s'", link)
+				continue
+			}
+			seen[link] = true
+			links = append(links, link)
+			if rule.DetailPages.MaxItems > 0 && len(links) >= rule.DetailPages.MaxItems {
+				return links
+			}
+		}
+	}
+	return links
+}
+
+// detailPageAllowed checks if a detail page is within the Source boundaries,
+// the crawl scope and robots.txt. Detail pages are requested explicitly by the
+// ruleset, so the Source domain is always allowed, even for Sources restricted
+// to their URL only.
+func detailPageAllowed(ctx *ProcessContext, link string) bool {
+	if !ctx.scope.Contains(link) || !ctx.robotsAllowed(link) {
+		return false
+	}
+	if ctx.source == nil {
+		return true
+	}
+	level := ctx.source.Restricted
+	if level < 2 {
+		level = 2
+	}
+	return level == 4 || !isExternalLink(ctx.source.URL, link, level)
+}
+
+// openDetailPage loads a page of a list-detail rule as the crawled pages are
+// (with the navigation retries and the page load wait), failing if the page
+// is served with an error status
+func openDetailPage(ctx *ProcessContext, wd *vdi.WebDriver, link string) error {
+	page, _, err := getURLContent(ctx.crawlCtx, link, *wd, 1, ctx)
+	if err != nil {
+		return err
+	}
+	*wd = page
+	if status := navigationStatusCode(wd); status >= 400 {
+		return fmt.Errorf("served with HTTP status %d", status)
+	}
+	return nil
+}
+
+// navigationStatusCode returns the HTTP status code of the current page, as
+// reported by the Navigation Timing API (0 if the browser doesn't report it).
+// Unlike the page logs, it doesn't consume the network responses of the
+// crawled (listing) page.
+func navigationStatusCode(wd *vdi.WebDriver) int {
+	status, err := (*wd).ExecuteScript(`const nav = performance.getEntriesByType('navigation')[0];
+		return nav && nav.responseStatus ? nav.responseStatus : 0;`, nil)
+	if err != nil {
+		return 0
+	}
+	code, _ := status.(float64)
+	return int(code)
+}
+
+// detailPagesDelay waits the crawl delay (raised to the robots.txt
+// Crawl-delay, if any) between two detail pages
+func detailPagesDelay(ctx *ProcessContext) {
+	delay := getDelay(ctx)
+	if delay <= 0 {
+		return
+	}
+	ctx.Status.LastDelay = delay
+	sleepWithContext(ctx.crawlCtx, time.Duration(delay*float64(time.Second)))
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+const lowDistinctivenessBatch = 500 // Number of pages flagged per UPDATE statement
+
+// indexedTitle is the title and summary of an indexed page
+type indexedTitle struct {
+	indexID uint64
+	title   string
+	summary string
+}
+
+// lowDistinctivenessPages returns the index IDs of the pages sharing the same
+// title and summary (compared ignoring case and extra spaces) with at least
+// minPages-1 other pages. Pages without a title and a summary are ignored.
+func lowDistinctivenessPages(pages []indexedTitle, minPages int) map[uint64]bool {
+	groups := make(map[string][]uint64)
+	for _, page := range pages {
+		title := normalizeTitleText(page.title)
+		summary := normalizeTitleText(page.summary)
+		if title == "" && summary == "" {
+			continue
+		}
+		key := title + "\x00" + summary
+		groups[key] = append(groups[key], page.indexID)
+	}
+
+	flagged := make(map[uint64]bool)
+	for _, ids := range groups {
+		if len(ids) < minPages {
+			continue
+		}
+		for _, id := range ids {
+			flagged[id] = true
+		}
+	}
+	return flagged
+}
+
+// normalizeTitleText lowercases a title (or summary) and collapses its spaces
+func normalizeTitleText(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// flagLowDistinctiveness flags the indexed pages of a Source that share the
+// same title and summary with other pages of the Source (usually templated
+// pages), so they can be excluded from the search results. The pages are
+// flagged for the Source only (in SourceSearchIndex), the pages shared with
+// other Sources keep their flags for them. The flags of the pages that are
+// distinct again are cleared. It returns the number of pages flagged.
+func flagLowDistinctiveness(db cdb.Handler, sourceID uint64, minPages int) (int, error) {
+	rows, err := db.ExecuteQuery(`
+		SELECT si.index_id, COALESCE(si.title, ''), COALESCE(si.summary, '')
+		FROM SearchIndex si
+		JOIN SourceSearchIndex ssi ON si.index_id = ssi.index_id
+		WHERE ssi.source_id = $1`, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	var pages []indexedTitle
+	for rows.Next() {
+		var page indexedTitle
+		if err := rows.Scan(&page.indexID, &page.title, &page.summary); err != nil {
+			rows.Close() //nolint:errcheck // We are already returning an error
+			return 0, err
+		}
+		pages = append(pages, page)
+	}
+	if err := rows.Close(); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "closing rows iterator: %v", err)
+	}
+
+	flagged := lowDistinctivenessPages(pages, minPages)
+	ids := make([]interface{}, 0, len(flagged))
+	for _, page := range pages {
+		if flagged[page.indexID] {
+			ids = append(ids, page.indexID)
+		}
+	}
+
+	err = runIndexTx(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE SourceSearchIndex SET low_distinctiveness = FALSE
+			WHERE source_id = $1 AND low_distinctiveness`, sourceID)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(ids); start += lowDistinctivenessBatch {
+			end := start + lowDistinctivenessBatch
+			if end > len(ids) {
+				end = len(ids)
+			}
+			placeholders := make([]string, end-start)
+			for i := range placeholders {
+				placeholders[i] = "$" + strconv.Itoa(i+2)
+			}
+			args := append([]interface{}{sourceID}, ids[start:end]...)
+			_, err := tx.Exec(`UPDATE SourceSearchIndex SET low_distinctiveness = TRUE WHERE source_id = $1 AND index_id IN (`+
+				strings.Join(placeholders, ",")+`)`, args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLowDistinctivenessPages(t *testing.T) {
+	pages := []indexedTitle{
+		{1, "Product | Shop", "Buy the best products"},
+		{2, "Product | Shop", "Buy the best products"},
+		{3, "product |  shop ", "Buy the best  products"},
+		{4, "Product | Shop", "A unique summary"},
+		{5, "About us", "Who we are"},
+		{6, "", ""},
+		{7, "", ""},
+	}
+
+	flagged := lowDistinctivenessPages(pages, 2)
+	for _, id := range []uint64{1, 2, 3} {
+		if !flagged[id] {
+			t.Errorf("Expected page %d (shared title and summary) to be flagged", id)
+		}
+	}
+	for _, id := range []uint64{4, 5, 6, 7} {
+		if flagged[id] {
+			t.Errorf("Expected page %d not to be flagged", id)
+		}
+	}
+
+	// With a higher threshold, 3 pages sharing the title and summary are still flagged
+	if flagged := lowDistinctivenessPages(pages, 3); len(flagged) != 3 {
+		t.Errorf("Expected 3 pages flagged, got %v", flagged)
+	}
+	if flagged := lowDistinctivenessPages(pages, 4); len(flagged) != 0 {
+		t.Errorf("Expected no pages flagged, got %v", flagged)
+	}
+}
+
+func TestFlagLowDistinctiveness(t *testing.T) {
+	db := newSQLiteIndexDB(t, 2)
+	pages := []struct {
+		url, title string
+		sources    []int
+	}{
+		{"https://www1.example.com/a", "Product", []int{1, 2}},
+		{"https://www1.example.com/b", "Product", []int{1}},
+		{"https://www1.example.com/c", "About us", []int{1}},
+		{"https://www2.example.com/d", "Contact", []int{2}},
+	}
+	for i, page := range pages {
+		if _, err := db.Exec(`INSERT INTO SearchIndex (index_id, page_url, title, summary) VALUES ($1, $2, $3, '')`, i+1, page.url, page.title); err != nil {
+			t.Fatalf("inserting the page: %v", err)
+		}
+		for _, source := range page.sources {
+			if _, err := db.Exec(`INSERT INTO SourceSearchIndex (source_id, index_id) VALUES ($1, $2)`, source, i+1); err != nil {
+				t.Fatalf("linking the page: %v", err)
+			}
+		}
+	}
+	flags := func() map[string]bool {
+		rows, err := db.ExecuteQuery(`SELECT source_id, index_id FROM SourceSearchIndex WHERE low_distinctiveness`)
+		if err != nil {
+			t.Fatalf("reading the flags: %v", err)
+		}
+		defer rows.Close() //nolint:errcheck // We can't check the error in a defer
+		flagged := make(map[string]bool)
+		for rows.Next() {
+			var sourceID, indexID int
+			if err := rows.Scan(&sourceID, &indexID); err != nil {
+				t.Fatalf("reading the flags: %v", err)
+			}
+			flagged[fmt.Sprintf("%d/%d", sourceID, indexID)] = true
+		}
+		return flagged
+	}
+
+	// The pages are flagged for the Source sharing their title only
+	for source := uint64(1); source <= 2; source++ {
+		if _, err := flagLowDistinctiveness(db, source, 2); err != nil {
+			t.Fatalf("flagLowDistinctiveness(%d) error = %v", source, err)
+		}
+	}
+	if flagged := flags(); !reflect.DeepEqual(flagged, map[string]bool{"1/1": true, "1/2": true}) {
+		t.Errorf("flagged pages = %v, want 1/1 and 1/2", flagged)
+	}
+
+	// The flags of the pages that are distinct again are cleared
+	if _, err := db.Exec(`UPDATE SearchIndex SET title = 'Product B' WHERE index_id = 2`); err != nil {
+		t.Fatalf("updating the page: %v", err)
+	}
+	if n, err := flagLowDistinctiveness(db, 1, 2); err != nil || n != 0 || len(flags()) != 0 {
+		t.Errorf("flagLowDistinctiveness() = %d, %v, flags %v, want none", n, err, flags())
+	}
+}
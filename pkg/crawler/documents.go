@@ -0,0 +1,219 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	documentFetchTimeout = 30               // Timeout (in seconds) of the download of the documents
+	documentMaxSize      = 20 * 1024 * 1024 // Documents are extracted up to 20 MiB
+)
+
+// Extractor extracts the content (title, summary, body text etc.) of a
+// document that isn't rendered by the VDI (e.g. a PDF), from its raw content
+// and its Content-Type.
+type Extractor interface {
+	Extract(content []byte, contentType string) (PageInfo, error)
+}
+
+// documentExtractorsRegistry holds the document extractors by document type
+type documentExtractorsRegistry struct {
+	mutex      sync.RWMutex
+	extractors map[string]Extractor
+}
+
+var documentExtractors = &documentExtractorsRegistry{extractors: make(map[string]Extractor)}
+
+func init() {
+	RegisterExtractor(htmlExtractor{}, "text/html", "text/htm", "application/xhtml+xml")
+	RegisterExtractor(textExtractor{}, "text/plain", "application/txt")
+	RegisterExtractor(pdfExtractor{}, "application/pdf")
+}
+
+// RegisterExtractor registers a document extractor for the given document
+// types (the detected ones, e.g. application/pdf, or the Content-Type of the
+// documents). An extractor replaces the one registered for the same type.
+func RegisterExtractor(extractor Extractor, docTypes ...string) {
+	documentExtractors.mutex.Lock()
+	defer documentExtractors.mutex.Unlock()
+	for _, docType := range docTypes {
+		documentExtractors.extractors[mediaType(docType)] = extractor
+	}
+}
+
+// UnregisterExtractor removes the document extractor of the given document
+// types (if registered)
+func UnregisterExtractor(docTypes ...string) {
+	documentExtractors.mutex.Lock()
+	defer documentExtractors.mutex.Unlock()
+	for _, docType := range docTypes {
+		delete(documentExtractors.extractors, mediaType(docType))
+	}
+}
+
+// documentExtractor returns the document extractor of a document type (nil
+// if none is registered for it)
+func documentExtractor(docType string) Extractor {
+	documentExtractors.mutex.RLock()
+	defer documentExtractors.mutex.RUnlock()
+	return documentExtractors.extractors[mediaType(docType)]
+}
+
+// mediaType returns the media type of a document type or Content-Type
+// (lowercase, without parameters)
+func mediaType(contentType string) string {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mt
+	}
+	return contentType
+}
+
+// extractDocument downloads a document (with the given request headers,
+// through the first of the proxies, if any) and extracts its content with the
+// extractor of its Content-Type (or of its detected type, docType, if no
+// extractor is registered for the Content-Type)
+func extractDocument(docURL, docType string, headers map[string]string, proxies []cfg.SOCKSProxy) (PageInfo, error) {
+	content, contentType, err := fetchDocument(docURL, headers, proxies)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	extractor := documentExtractor(contentType)
+	if extractor == nil {
+		extractor = documentExtractor(docType)
+		contentType = docType
+	}
+	if extractor == nil {
+		return PageInfo{}, fmt.Errorf("no extractor for the document type '%s'", docType)
+	}
+	info, err := extractor.Extract(content, contentType)
+	if err != nil {
+		return PageInfo{}, fmt.Errorf("extracting document '%s': %v", docURL, err)
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Extracted %d characters of text from %s (%s)", len(info.BodyText), docURL, contentType)
+	return info, nil
+}
+
+// fetchDocument retrieves a document (with the given request headers, through
+// the first of the proxies, if any), up to documentMaxSize bytes. It returns
+// its content and its Content-Type.
+func fetchDocument(docURL string, headers map[string]string, proxies []cfg.SOCKSProxy) ([]byte, string, error) {
+	transport := cmn.SafeTransport(documentFetchTimeout, "ignore")
+	if len(proxies) > 0 {
+		proxy, err := proxyURL(proxies[0])
+		if err != nil {
+			return nil, "", fmt.Errorf("retrieving document '%s': invalid proxy: %v", docURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	httpClient := &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(documentFetchTimeout) * time.Second,
+	}
+	req, err := http.NewRequest("GET", docURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("retrieving document '%s': %v", docURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("retrieving document '%s': unexpected status code %d", docURL, resp.StatusCode)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, documentMaxSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("retrieving document '%s': %v", docURL, err)
+	}
+	return content, resp.Header.Get("Content-Type"), nil
+}
+
+// proxyURL returns the URL of a proxy (http_headers proxies): its host is a
+// URL or a host name (a SOCKS5 proxy), its port and credentials are added to
+// it if they are set
+func proxyURL(proxy cfg.SOCKSProxy) (*url.URL, error) {
+	address := strings.TrimSpace(proxy.Address)
+	if !strings.Contains(address, "://") {
+		address = "socks5://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("no host in '%s'", proxy.Address)
+	}
+	if u.Port() == "" && proxy.Port > 0 {
+		u.Host = fmt.Sprintf("%s:%d", u.Host, proxy.Port)
+	}
+	if proxy.Username != "" {
+		u.User = url.UserPassword(proxy.Username, proxy.Password)
+	}
+	return u, nil
+}
+
+// htmlExtractor extracts the content of the HTML documents that aren't
+// rendered (e.g. a linked document served as HTML): title, description,
+// meta tags, language and text (without scripts and styles)
+type htmlExtractor struct{}
+
+func (htmlExtractor) Extract(content []byte, _ string) (PageInfo, error) {
+	doc, err := parseHTMLDocument(normalizeEncoding(string(content), ""))
+	if err != nil {
+		return PageInfo{}, err
+	}
+	doc.Find("script, style, noscript").Remove()
+
+	info := PageInfo{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		BodyText: doc.Find("body").Text(),
+		MetaTags: extractMetaTags(doc),
+	}
+	info.DetectedLang, _ = doc.Find("html").Attr("lang")
+	doc.Find("meta[name='description' i]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		info.Summary = strings.TrimSpace(s.AttrOr("content", ""))
+		return info.Summary == ""
+	})
+	return info, nil
+}
+
+// textExtractor extracts the content of the plain text documents
+type textExtractor struct{}
+
+func (textExtractor) Extract(content []byte, contentType string) (PageInfo, error) {
+	return PageInfo{BodyText: normalizeEncoding(string(content), contentType)}, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+func TestExtractDocument(t *testing.T) {
+	pdf := testPDF(t, `(Price list)`, "BT (Widget ABC-1234 costs 10 EUR) Tj ET")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prices.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write(pdf)
+		case "/moved.pdf":
+			// An HTML page where a PDF was expected
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html lang="en"><head><title>Moved</title><meta name="description" content="The price list moved"></head>
+				<body><script>var x = 1;</script><p>The price list has moved</p></body></html>`))
+		case "/notes.txt":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte("Plain text notes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	info, err := extractDocument(server.URL+"/prices.pdf", "application/pdf", nil, nil)
+	if err != nil || info.Title != "Price list" || info.BodyText != "Widget ABC-1234 costs 10 EUR" {
+		t.Errorf("extractDocument(prices.pdf) = %q, %q, %v", info.Title, info.BodyText, err)
+	}
+
+	info, err = extractDocument(server.URL+"/moved.pdf", "application/pdf", nil, nil)
+	if err != nil || info.Title != "Moved" || info.Summary != "The price list moved" ||
+		strings.TrimSpace(info.BodyText) != "The price list has moved" || info.DetectedLang != "en" {
+		t.Errorf("extractDocument(moved.pdf) = %+v, %v", info, err)
+	}
+
+	// The detected type is used when there is no extractor for the Content-Type
+	info, err = extractDocument(server.URL+"/notes.txt", "application/txt", nil, nil)
+	if err != nil || info.BodyText != "Plain text notes" {
+		t.Errorf("extractDocument(notes.txt) = %q, %v", info.BodyText, err)
+	}
+
+	if _, err := extractDocument(server.URL+"/missing.pdf", "application/pdf", nil, nil); err == nil {
+		t.Errorf("Expected an error extracting a missing document")
+	}
+
+	// Custom extractors replace the registered ones
+	RegisterExtractor(textExtractor{}, "application/pdf")
+	defer RegisterExtractor(pdfExtractor{}, "application/pdf")
+	if _, ok := documentExtractor("Application/PDF; version=1.7").(textExtractor); !ok {
+		t.Errorf("Expected the custom extractor to be registered for application/pdf")
+	}
+	UnregisterExtractor("application/pdf")
+	if documentExtractor("application/pdf") != nil {
+		t.Errorf("Expected no extractor for application/pdf after unregistering it")
+	}
+}
+
+func TestExtractDocumentThroughProxy(t *testing.T) {
+	// An HTTP proxy serving the documents it is asked for
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		if r.Header.Get("Proxy-Authorization") == "" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("Proxied notes"))
+	}))
+	defer proxy.Close()
+
+	proxies := []cfg.SOCKSProxy{{Address: proxy.URL, Username: "crowler", Password: "secret"}}
+	info, err := extractDocument("http://docs.example.com/notes.txt", "text/plain", nil, proxies)
+	if err != nil || info.BodyText != "Proxied notes" || proxied != "http://docs.example.com/notes.txt" {
+		t.Errorf("extractDocument() through the proxy = %q, %v (proxied %q)", info.BodyText, err, proxied)
+	}
+
+	u, err := proxyURL(cfg.SOCKSProxy{Address: "proxy.example.com", Port: 1080})
+	if err != nil || u.String() != "socks5://proxy.example.com:1080" {
+		t.Errorf("proxyURL() = %v, %v, expected socks5://proxy.example.com:1080", u, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	egressCheckTimeout = 15  // Default timeout of the IP-echo request (in seconds)
+	egressMaxBodySize  = 256 // An IP-echo response is just an IP address
+)
+
+// CheckEgress verifies that the engine public IP (as reported by the configured
+// IP-echo service) belongs to one of the required egress CIDRs, so crawls don't
+// accidentally originate from the wrong network (e.g., when a VPN is down).
+// It's a no-op when no required egress CIDR is configured.
+func CheckEgress(conf cfg.Crawler) error {
+	if strings.TrimSpace(conf.RequiredEgressCIDR) == "" {
+		return nil
+	}
+
+	networks, err := parseEgressCIDRs(conf.RequiredEgressCIDR)
+	if err != nil {
+		return err
+	}
+
+	ip, err := egressIP(conf.EgressCheckURL, conf.Timeout)
+	if err != nil {
+		return err
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			cmn.DebugMsg(cmn.DbgLvlInfo, "Egress IP %s is within the required egress network %s", ip, network)
+			return nil
+		}
+	}
+	return fmt.Errorf("egress IP %s is not within the required egress CIDR '%s'", ip, conf.RequiredEgressCIDR)
+}
+
+// parseEgressCIDRs parses a comma separated list of CIDRs
+func parseEgressCIDRs(cidrs string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(cidrs, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid required egress CIDR '%s': %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// egressIP returns the engine public IP as reported by the given IP-echo service.
+// The request uses the safe transport, so the IP-echo service itself must not
+// resolve to a disallowed IP.
+func egressIP(echoURL string, timeout int) (net.IP, error) {
+	if timeout <= 0 {
+		timeout = egressCheckTimeout
+	}
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(timeout, "ignore"),
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+
+	resp, err := httpClient.Get(echoURL)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving egress IP from '%s': %v", echoURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("retrieving egress IP from '%s': unexpected status code %d", echoURL, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, egressMaxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("reading egress IP from '%s': %v", echoURL, err)
+	}
+
+	ipStr := strings.TrimSpace(string(body))
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid egress IP '%s' returned by '%s'", ipStr, echoURL)
+	}
+	if cmn.IsDisallowedIP(ipStr, 0) {
+		return nil, fmt.Errorf("egress IP '%s' returned by '%s' is not a public IP", ipStr, echoURL)
+	}
+	return ip, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+func TestCheckEgress(t *testing.T) {
+	const echoIP = "203.0.113.7"
+	var reported atomic.Value
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, reported.Load())
+	}))
+	defer echo.Close()
+
+	tests := []struct {
+		name    string
+		cidr    string
+		echoIP  string
+		wantErr bool
+	}{
+		{"No required egress", "", echoIP, false},
+		{"Egress within CIDR", "203.0.113.0/24", echoIP, false},
+		{"Egress within one of the CIDRs", "198.51.100.0/24, 203.0.113.0/28", echoIP, false},
+		{"Egress outside CIDR", "198.51.100.0/24", echoIP, true},
+		{"Invalid CIDR", "203.0.113.0/99", echoIP, true},
+		{"Non public egress IP", "10.0.0.0/8", "10.0.0.1", true},
+		{"Invalid echo response", "203.0.113.0/24", "not-an-ip", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reported.Store(tt.echoIP)
+			conf := cfg.Crawler{
+				RequiredEgressCIDR: tt.cidr,
+				EgressCheckURL:     echo.URL,
+				Timeout:            5,
+			}
+			err := CheckEgress(conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckEgress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// The IP-echo service must be reachable for the check to pass
+	conf := cfg.Crawler{
+		RequiredEgressCIDR: "203.0.113.0/24",
+		EgressCheckURL:     "http://0.0.0.0:1/",
+		Timeout:            1,
+	}
+	if err := CheckEgress(conf); err == nil {
+		t.Errorf("Expected an error for an unreachable IP-echo service")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+// normalizeEncoding returns the content of a page transcoded to UTF-8. The
+// charset of the content is detected from its BOM, the Content-Type header
+// of the page (contentType, if known) or its meta tags (windows-1252 if none
+// of them declares it, as browsers do). The content that is already valid
+// UTF-8 (e.g., the pages decoded by the VDI) and the binary content are
+// returned as they are.
+func normalizeEncoding(content, contentType string) string {
+	if utf8.ValidString(content) {
+		return content
+	}
+
+	enc, name, _ := charset.DetermineEncoding([]byte(content), contentType)
+	if enc == nil || enc == encoding.Nop || name == "utf-8" {
+		return content
+	}
+	if strings.ContainsRune(content, 0) && !strings.HasPrefix(name, "utf-16") {
+		// Binary content (not a page in a legacy encoding)
+		return content
+	}
+
+	decoded, err := enc.NewDecoder().String(content)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "transcoding the page content from %s to UTF-8: %v", name, err)
+		return content
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Page content transcoded from %s to UTF-8", name)
+	return decoded
+}
+
+// pageContentType returns the Content-Type header of the page at pageURL, if
+// it's the page the HTTP headers have been collected for (empty otherwise)
+func (ctx *ProcessContext) pageContentType(pageURL string) string {
+	if ctx.hi == nil || ctx.hi.ResponseHeaders == nil ||
+		cmn.NormalizeURL(ctx.hi.URL) != cmn.NormalizeURL(pageURL) {
+		return ""
+	}
+	return ctx.hi.ResponseHeaders.Get("Content-Type")
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestNormalizeEncoding(t *testing.T) {
+	tests := []struct {
+		file        string
+		contentType string
+		want        string
+	}{
+		{"shift_jis.html", "", "日本語のページです。"},
+		{"iso-8859-1.html", "", "Crème brûlée à Genève"},
+		{"koi8-r.html", "text/html; charset=KOI8-R", "Привет, мир"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("test_data", "encoding", tt.file))
+			if err != nil {
+				t.Fatalf("reading fixture: %v", err)
+			}
+			if utf8.Valid(data) {
+				t.Fatalf("fixture %s is valid UTF-8", tt.file)
+			}
+			got := normalizeEncoding(string(data), tt.contentType)
+			if !utf8.ValidString(got) || !strings.Contains(got, tt.want) {
+				t.Errorf("normalizeEncoding() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+
+	// UTF-8 and binary content are left as they are
+	for _, content := range []string{"<p>Crème brûlée</p>", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\xff"} {
+		if got := normalizeEncoding(content, "text/html; charset=ISO-8859-1"); got != content {
+			t.Errorf("normalizeEncoding(%q) = %q, want it unchanged", content, got)
+		}
+	}
+
+	// The extracted text of the pages is UTF-8
+	data, err := os.ReadFile(filepath.Join("test_data", "encoding", "shift_jis.html"))
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	var wd vdi.WebDriver = &mockWebDriver{pages: []string{string(data)}}
+	pageInfo := PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if !strings.Contains(pageInfo.BodyText, "日本語のページです。") {
+		t.Errorf("extractPageInfo() body text = %q, want the page text in UTF-8", pageInfo.BodyText)
+	}
+
+	// Unless the normalization is disabled
+	ctx.config.Crawler.NormalizeEncoding = false
+	wd = &mockWebDriver{pages: []string{string(data)}}
+	pageInfo = PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if strings.Contains(pageInfo.BodyText, "日本語") {
+		t.Errorf("extractPageInfo() transcoded the page with normalize_encoding disabled: %q", pageInfo.BodyText)
+	}
+}
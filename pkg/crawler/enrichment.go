@@ -0,0 +1,187 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	// enrichmentMaxRequest is the maximum size of the body text POSTed to an
+	// HTTP enrichment service (the longer texts are truncated)
+	enrichmentMaxRequest = 256 * 1024
+	// enrichmentMaxResponse is the maximum size of the response of an HTTP
+	// enrichment service
+	enrichmentMaxResponse = 1024 * 1024
+)
+
+// Enricher enriches the body text of a page (in the given language, empty if
+// unknown) with NLP results: its sentiment, entities and topics. It returns
+// nil if it has nothing to add.
+type Enricher interface {
+	Enrich(ctx context.Context, text, lang string) (*PageEnrichment, error)
+}
+
+// EnrichmentRequest is the body POSTed to the HTTP enrichment services (they
+// reply with a PageEnrichment)
+type EnrichmentRequest struct {
+	URL      string `json:"url"`
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+}
+
+// enrichersRegistry holds the enrichers registered by name (the backends
+// other than the built-in none and http ones)
+type enrichersRegistry struct {
+	mutex     sync.RWMutex
+	enrichers map[string]Enricher
+}
+
+var enrichers = &enrichersRegistry{enrichers: make(map[string]Enricher)}
+
+// RegisterEnricher registers an enricher (e.g. a local model) as the backend
+// with the given name, so it can be selected with the enrichment backend
+// option. An enricher replaces the one registered with the same name.
+func RegisterEnricher(name string, enricher Enricher) {
+	enrichers.mutex.Lock()
+	defer enrichers.mutex.Unlock()
+	enrichers.enrichers[strings.ToLower(strings.TrimSpace(name))] = enricher
+}
+
+// UnregisterEnricher removes the enricher registered with the given name (if
+// any)
+func UnregisterEnricher(name string) {
+	enrichers.mutex.Lock()
+	defer enrichers.mutex.Unlock()
+	delete(enrichers.enrichers, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// noopEnricher is the default enricher: it doesn't enrich the pages
+type noopEnricher struct{}
+
+func (noopEnricher) Enrich(context.Context, string, string) (*PageEnrichment, error) {
+	return nil, nil
+}
+
+// httpEnricher enriches the pages by POSTing their body text (as an
+// EnrichmentRequest) to an HTTP service
+type httpEnricher struct {
+	endpoint string
+	headers  map[string]string
+	pageURL  string
+	timeout  int // in seconds
+}
+
+func (e httpEnricher) Enrich(ctx context.Context, text, lang string) (*PageEnrichment, error) {
+	text, _ = truncateBodyText(text, enrichmentMaxRequest)
+	payload, err := json.Marshal(EnrichmentRequest{URL: e.pageURL, Language: lang, Text: text})
+	if err != nil {
+		return nil, fmt.Errorf("marshalling the enrichment request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(e.timeout, "ignore"),
+		Timeout:   time.Duration(e.timeout) * time.Second,
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling '%s': %v", e.endpoint, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("calling '%s': unexpected status code %d", e.endpoint, resp.StatusCode)
+	}
+	var enrichment PageEnrichment
+	if err := json.NewDecoder(io.LimitReader(resp.Body, enrichmentMaxResponse)).Decode(&enrichment); err != nil {
+		return nil, fmt.Errorf("decoding the response of '%s': %v", e.endpoint, err)
+	}
+	return &enrichment, nil
+}
+
+// newEnricher returns the enricher of the configured backend (the no-op one
+// if the backend is none, unknown or misconfigured)
+func newEnricher(conf cfg.Enrichment, pageURL string) Enricher {
+	backend := strings.ToLower(strings.TrimSpace(conf.Backend))
+	switch backend {
+	case "", cfg.EnrichmentNone:
+		return noopEnricher{}
+	case cfg.EnrichmentHTTP:
+		if conf.Endpoint == "" {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "NLP enrichment backend 'http' without an endpoint, skipping the enrichment")
+			return noopEnricher{}
+		}
+		return httpEnricher{endpoint: conf.Endpoint, headers: conf.Headers, pageURL: pageURL, timeout: enrichmentTimeout(conf)}
+	}
+	enrichers.mutex.RLock()
+	defer enrichers.mutex.RUnlock()
+	if enricher, ok := enrichers.enrichers[backend]; ok {
+		return enricher
+	}
+	cmn.DebugMsg(cmn.DbgLvlWarn, "Unknown NLP enrichment backend '%s', skipping the enrichment", backend)
+	return noopEnricher{}
+}
+
+// enrichmentTimeout returns the configured timeout (in seconds) of the
+// enrichment of a page
+func enrichmentTimeout(conf cfg.Enrichment) int {
+	if conf.Timeout <= 0 {
+		return cfg.DefaultEnrichmentTimeout
+	}
+	return conf.Timeout
+}
+
+// enrichPage returns the NLP enrichment of the body text of a page (nil if
+// the enrichment is disabled). Failing to enrich a page isn't fatal, it's
+// only recorded as a warning.
+func (ctx *ProcessContext) enrichPage(pageURL, bodyText, lang string) *PageEnrichment {
+	conf := ctx.config.Crawler.Enrichment
+	if strings.TrimSpace(bodyText) == "" {
+		return nil
+	}
+	enricher := newEnricher(conf, pageURL)
+	if _, ok := enricher.(noopEnricher); ok {
+		return nil
+	}
+
+	enrichCtx, cancel := context.WithTimeout(ctx.crawlCtx, time.Duration(enrichmentTimeout(conf))*time.Second)
+	defer cancel()
+	enrichment, err := enricher.Enrich(enrichCtx, bodyText, lang)
+	if err != nil {
+		ctx.recordWarning("enriching %s: %v", pageURL, err)
+		return nil
+	}
+	return enrichment
+}
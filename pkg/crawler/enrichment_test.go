@@ -0,0 +1,157 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// stubEnricher is an Enricher returning a fixed enrichment (or error)
+type stubEnricher struct {
+	texts []string
+	err   error
+}
+
+func (e *stubEnricher) Enrich(_ context.Context, text, _ string) (*PageEnrichment, error) {
+	e.texts = append(e.texts, text)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &PageEnrichment{
+		Sentiment: &Sentiment{Label: "positive", Score: 0.8},
+		Entities:  []Entity{{Text: "CROWler", Type: "product"}},
+		Topics:    []string{"web crawling"},
+	}, nil
+}
+
+func TestPageEnrichment(t *testing.T) {
+	savedSem := indexingSem
+	defer func() { indexingSem = savedSem }()
+	indexingSem = nil
+
+	stub := &stubEnricher{}
+	RegisterEnricher("stub", stub)
+	defer UnregisterEnricher("stub")
+
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	page := "<html><body><p>The CROWler is a great crawler</p></body></html>"
+
+	// Disabled by default
+	var wd vdi.WebDriver = &mockWebDriver{pages: []string{page}}
+	pageInfo := PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if pageInfo.Enrichment != nil || len(stub.texts) != 0 {
+		t.Errorf("Expected no enrichment by default, got %+v", pageInfo.Enrichment)
+	}
+
+	// The body text is enriched by the configured backend
+	ctx.config.Crawler.Enrichment.Backend = "stub"
+	wd = &mockWebDriver{pages: []string{page}}
+	pageInfo = PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if len(stub.texts) != 1 || !strings.Contains(stub.texts[0], "great crawler") || pageInfo.Enrichment == nil {
+		t.Fatalf("Expected the body text to be enriched, got %v (%+v)", stub.texts, pageInfo.Enrichment)
+	}
+
+	// And the enrichment is stored
+	db := newSQLiteIndexDB(t, 1)
+	url, indexed := fakeIndexPage(1)
+	indexed.Config.Crawler.Enrichment.Backend = "stub"
+	indexed.Enrichment = pageInfo.Enrichment
+	indexID, err := indexPage(db, url, &indexed)
+	if err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	var sentiment float64
+	var details string
+	if err := db.QueryRow(`SELECT sentiment, details FROM PageEnrichment WHERE index_id = $1`, indexID).Scan(&sentiment, &details); err != nil ||
+		sentiment != 0.8 || !strings.Contains(details, `"topics":["web crawling"]`) {
+		t.Errorf("PageEnrichment = %v, %q (%v), expected the page enrichment", sentiment, details, err)
+	}
+
+	// Failing to enrich a page isn't fatal
+	stub.err = errors.New("model unavailable")
+	wd = &mockWebDriver{pages: []string{page}}
+	pageInfo = PageInfo{}
+	if err := extractPageInfo(&wd, ctx, "text/html", &pageInfo); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if pageInfo.Enrichment != nil || pageInfo.BodyText == "" || !strings.Contains(ctx.Status.LastWarning, "model unavailable") {
+		t.Errorf("Expected the page without enrichment and a warning, got %+v (%s)", pageInfo.Enrichment, ctx.Status.LastWarning)
+	}
+
+	// And the page keeps its stored enrichment
+	indexed.Enrichment = pageInfo.Enrichment
+	if _, err := indexPage(db, url, &indexed); err != nil {
+		t.Fatalf("indexPage() error = %v", err)
+	}
+	if err := db.QueryRow(`SELECT sentiment FROM PageEnrichment WHERE index_id = $1`, indexID).Scan(&sentiment); err != nil || sentiment != 0.8 {
+		t.Errorf("PageEnrichment sentiment = %v (%v), expected the previous enrichment to be kept", sentiment, err)
+	}
+}
+
+func TestHTTPEnricher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req EnrichmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(req.Text) > enrichmentMaxRequest {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		fmt.Fprintf(w, `{"sentiment": {"label": "neutral", "score": 0}, "topics": [%q, %q]}`, req.URL, req.Language)
+	}))
+	defer server.Close()
+
+	conf := cfg.Enrichment{Backend: cfg.EnrichmentHTTP, Endpoint: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	enrichment, err := newEnricher(conf, "https://example.com").Enrich(context.Background(), "Some text", "en")
+	if err != nil || enrichment.Sentiment == nil || enrichment.Sentiment.Label != "neutral" || !reflect.DeepEqual(enrichment.Topics, []string{"https://example.com", "en"}) {
+		t.Errorf("Enrich() = %+v, %v, expected the service enrichment", enrichment, err)
+	}
+
+	// The long texts are truncated
+	if _, err := newEnricher(conf, "https://example.com").Enrich(context.Background(), strings.Repeat("é", enrichmentMaxRequest), "en"); err != nil {
+		t.Errorf("Enrich() error = %v, expected the long text to be truncated", err)
+	}
+
+	// The service errors are returned
+	conf.Headers = nil
+	if _, err := newEnricher(conf, "https://example.com").Enrich(context.Background(), "Some text", "en"); err == nil {
+		t.Errorf("Expected an error for a failing service")
+	}
+
+	// Without an endpoint the pages aren't enriched
+	conf.Endpoint = ""
+	if _, ok := newEnricher(conf, "https://example.com").(noopEnricher); !ok {
+		t.Errorf("Expected the no-op enricher without an endpoint")
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/abadojack/whatlanggo"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+const (
+	// FieldTitle is the field of the page title (a string)
+	FieldTitle = "title"
+	// FieldSummary is the field of the page summary (a string)
+	FieldSummary = "summary"
+	// FieldMetaTags is the field of the page meta tags (a []MetaTag)
+	FieldMetaTags = "meta_tags"
+	// FieldDetectedLang is the field of the page language (a string)
+	FieldDetectedLang = "detected_lang"
+)
+
+// ExtractorPage is the rendered page given to the content extractors.
+type ExtractorPage struct {
+	URL       string            // The URL of the page.
+	DocType   string            // The detected document type of the page.
+	Doc       *goquery.Document // The parsed HTML of the page (nil if it isn't an HTML document).
+	BodyText  string            // The body text of the page (without scripts and extra spaces).
+	WebDriver vdi.WebDriver     // The VDI session rendering the page (it may be nil).
+	Config    *cfg.Config       // The configuration of the crawl.
+}
+
+// ContentExtractor extracts named fields from a rendered page. The fields are
+// merged into the PageInfo of the page: the title, summary, meta_tags and
+// detected_lang fields set the corresponding PageInfo fields, the others are
+// added to its Extracted fields.
+type ContentExtractor interface {
+	Name() string                                                // The name of the extractor.
+	Extract(page *ExtractorPage) (map[string]interface{}, error) // The fields extracted from the page.
+}
+
+// extractorsRegistry holds the content extractors in their registration order
+type extractorsRegistry struct {
+	mutex      sync.RWMutex
+	extractors []ContentExtractor
+}
+
+var contentExtractors = &extractorsRegistry{}
+
+func init() {
+	RegisterContentExtractor(titleExtractor{})
+	RegisterContentExtractor(summaryExtractor{})
+	RegisterContentExtractor(metaExtractor{})
+	RegisterContentExtractor(langExtractor{})
+}
+
+// RegisterContentExtractor registers a content extractor. The extractors run
+// in their registration order, so an extractor overrides the fields of the
+// ones registered before it. An extractor with the name of a registered one
+// replaces it (in its position).
+func RegisterContentExtractor(extractor ContentExtractor) {
+	contentExtractors.mutex.Lock()
+	defer contentExtractors.mutex.Unlock()
+	for i, e := range contentExtractors.extractors {
+		if e.Name() == extractor.Name() {
+			contentExtractors.extractors[i] = extractor
+			return
+		}
+	}
+	contentExtractors.extractors = append(contentExtractors.extractors, extractor)
+}
+
+// UnregisterContentExtractor removes the content extractor with the given
+// name (if registered)
+func UnregisterContentExtractor(name string) {
+	contentExtractors.mutex.Lock()
+	defer contentExtractors.mutex.Unlock()
+	for i, e := range contentExtractors.extractors {
+		if e.Name() == name {
+			contentExtractors.extractors = append(contentExtractors.extractors[:i], contentExtractors.extractors[i+1:]...)
+			return
+		}
+	}
+}
+
+// runContentExtractors runs the registered content extractors on the page and
+// merges their fields into pageInfo. An extractor failing is a non-fatal
+// error of the page (its fields are ignored).
+func runContentExtractors(page *ExtractorPage, pageInfo *PageInfo) {
+	contentExtractors.mutex.RLock()
+	extractors := append([]ContentExtractor{}, contentExtractors.extractors...)
+	contentExtractors.mutex.RUnlock()
+
+	for _, extractor := range extractors {
+		fields, err := extractor.Extract(page)
+		if err != nil {
+			msg := fmt.Sprintf("content extractor '%s' on %s: %v", extractor.Name(), page.URL, err)
+			cmn.DebugMsg(cmn.DbgLvlError, "%s", msg)
+			pageInfo.Errors = append(pageInfo.Errors, msg)
+			continue
+		}
+		pageInfo.mergeFields(extractor.Name(), fields)
+	}
+}
+
+// mergeFields merges the fields of a content extractor into the page info.
+// Empty values don't override the fields, and values of the wrong type for
+// the PageInfo fields are ignored.
+func (p *PageInfo) mergeFields(extractor string, fields map[string]interface{}) {
+	for name, value := range fields {
+		ok := true
+		switch name {
+		case FieldTitle, FieldSummary, FieldDetectedLang:
+			var str string
+			if str, ok = value.(string); ok && str != "" {
+				switch name {
+				case FieldTitle:
+					p.Title = str
+				case FieldSummary:
+					p.Summary = str
+				default:
+					p.DetectedLang = str
+				}
+			}
+		case FieldMetaTags:
+			var metaTags []MetaTag
+			if metaTags, ok = value.([]MetaTag); ok && len(metaTags) > 0 {
+				p.MetaTags = metaTags
+			}
+		default:
+			if value == nil {
+				continue
+			}
+			if p.Extracted == nil {
+				p.Extracted = make(map[string]interface{})
+			}
+			p.Extracted[name] = value
+		}
+		if !ok {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "content extractor '%s': ignoring field '%s' of type %T", extractor, name, value)
+		}
+	}
+}
+
+// titleExtractor extracts the page title
+type titleExtractor struct{}
+
+func (titleExtractor) Name() string { return "title" }
+
+func (titleExtractor) Extract(page *ExtractorPage) (map[string]interface{}, error) {
+	if page.Doc == nil {
+		return nil, nil
+	}
+	var title string
+	if page.WebDriver != nil {
+		title, _ = page.WebDriver.Title()
+	} else {
+		title = strings.TrimSpace(page.Doc.Find("title").First().Text())
+	}
+	return map[string]interface{}{FieldTitle: title}, nil
+}
+
+// summaryExtractor extracts the page summary (from the first available
+// source, in the configured order)
+type summaryExtractor struct{}
+
+func (summaryExtractor) Name() string { return "summary" }
+
+func (summaryExtractor) Extract(page *ExtractorPage) (map[string]interface{}, error) {
+	if page.Doc == nil {
+		return nil, nil
+	}
+	return map[string]interface{}{FieldSummary: extractSummary(page.Doc, page.BodyText, page.Config.Crawler.SummarySources)}, nil
+}
+
+// metaExtractor extracts the page meta tags (if they are collected)
+type metaExtractor struct{}
+
+func (metaExtractor) Name() string { return "meta" }
+
+func (metaExtractor) Extract(page *ExtractorPage) (map[string]interface{}, error) {
+	if page.Doc == nil || !page.Config.Crawler.CollectMetaTags {
+		return nil, nil
+	}
+	return map[string]interface{}{FieldMetaTags: extractMetaTags(page.Doc)}, nil
+}
+
+// langExtractor detects the page language
+type langExtractor struct{}
+
+func (langExtractor) Name() string { return "lang" }
+
+func (langExtractor) Extract(page *ExtractorPage) (map[string]interface{}, error) {
+	if page.Doc == nil && page.BodyText != "" {
+		// A document extracted without the VDI (e.g. a PDF)
+		return map[string]interface{}{FieldDetectedLang: convertLangStrToLangCode(whatlanggo.LangToString(whatlanggo.Detect(page.BodyText).Lang))}, nil
+	}
+	if page.WebDriver != nil {
+		return map[string]interface{}{FieldDetectedLang: detectLang(page.WebDriver)}, nil
+	}
+	if page.Doc == nil {
+		return nil, nil
+	}
+	lang, _ := page.Doc.Find("html").Attr("lang")
+	if lang == "" {
+		lang = convertLangStrToLangCode(whatlanggo.LangToString(whatlanggo.Detect(page.BodyText).Lang))
+	}
+	return map[string]interface{}{FieldDetectedLang: lang}, nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+// priceExtractor is a custom content extractor contributing the product price
+type priceExtractor struct{}
+
+func TestContentExtractors(t *testing.T) {
+	doc, err := parseHTMLDocument(`<html lang="en"><head><title>Widget</title><meta name="description" content="The best widget"></head>` +
+		`<body><h1>Widget</h1><span class="price">9.99</span></body></html>`)
+	if err != nil {
+		t.Fatalf("parseHTMLDocument() error = %v", err)
+	}
+	config := cfg.NewConfig()
+	config.Crawler.CollectMetaTags = true
+	page := &ExtractorPage{URL: "https://example.com/widget", DocType: "text/html", Doc: doc, BodyText: "Widget 9.99", Config: config}
+
+	// The built-in extractors
+	pageInfo := PageInfo{}
+	runContentExtractors(page, &pageInfo)
+	if pageInfo.Title != "Widget" || pageInfo.Summary != "The best widget" || pageInfo.DetectedLang != "en" || len(pageInfo.MetaTags) == 0 {
+		t.Errorf("built-in extractors = %q, %q, %q, %v", pageInfo.Title, pageInfo.Summary, pageInfo.DetectedLang, pageInfo.MetaTags)
+	}
+	if pageInfo.Extracted != nil {
+		t.Errorf("Extracted = %v, want nil", pageInfo.Extracted)
+	}
+
+	// A custom extractor contributes its fields (and overrides the built-in ones)
+	RegisterContentExtractor(priceExtractor{})
+	defer UnregisterContentExtractor("price")
+	pageInfo = PageInfo{}
+	runContentExtractors(page, &pageInfo)
+	if pageInfo.Extracted["price"] != "9.99" {
+		t.Errorf("Extracted[price] = %v, want 9.99", pageInfo.Extracted["price"])
+	}
+	if pageInfo.Title != "Product: Widget" || pageInfo.Summary != "The best widget" {
+		t.Errorf("Title, Summary = %q, %q, want the custom title and the built-in summary", pageInfo.Title, pageInfo.Summary)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+// facetCombinations calls yield with each combination of facet values to
+// crawl (until yield returns false): the provided ones or, if none, all the
+// combinations (cartesian product) of the params values. The combinations
+// of the params are generated one at a time, so a stop after the first ones
+// doesn't cost the whole product.
+func facetCombinations(facets cfg.Facets, yield func(combo map[string]string) bool) {
+	if len(facets.Combinations) > 0 {
+		for _, combo := range facets.Combinations {
+			if !yield(combo) {
+				return
+			}
+		}
+		return
+	}
+	names := make([]string, 0, len(facets.Params))
+	for name, values := range facets.Params {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names) // The same facets always produce the same (ordered) URLs
+
+	// An odometer over the values of the params (the last one turns fastest)
+	digits := make([]int, len(names))
+	for {
+		combo := make(map[string]string, len(names))
+		for i, name := range names {
+			combo[name] = facets.Params[name][digits[i]]
+		}
+		if !yield(combo) {
+			return
+		}
+		i := len(names) - 1
+		for ; i >= 0; i-- {
+			digits[i]++
+			if digits[i] < len(facets.Params[names[i]]) {
+				break
+			}
+			digits[i] = 0
+		}
+		if i < 0 {
+			return
+		}
+	}
+}
+
+// facetURLs returns the URLs of the facet combinations: base with the facet
+// parameters of each combination (replacing the ones base may already
+// have), up to maxURLs URLs
+func facetURLs(base string, facets cfg.Facets, maxURLs int) ([]string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, fmt.Errorf("invalid facets URL '%s': %v", base, err)
+	}
+	seen := make(map[string]bool)
+	var urls []string
+	facetCombinations(facets, func(combo map[string]string) bool {
+		if len(combo) == 0 {
+			return true
+		}
+		u := *baseURL
+		query := u.Query()
+		for name, value := range combo {
+			query.Set(name, value)
+		}
+		u.RawQuery = query.Encode()
+		link := u.String()
+		if seen[link] {
+			return true
+		}
+		if maxURLs > 0 && len(urls) >= maxURLs {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Reached the max facet URLs (%d) of '%s', the remaining combinations are not crawled", maxURLs, base)
+			return false
+		}
+		seen[link] = true
+		urls = append(urls, link)
+		return true
+	})
+	return urls, nil
+}
+
+// facetLinks returns the links of the facet URLs of the Source (that aren't
+// already in links) and records them as facets, so they are crawled even if
+// they match the patterns keeping the crawl out of the faceted navigation
+// (the exclude and the user-defined URL patterns)
+func (ctx *ProcessContext) facetLinks(links []LinkItem) []LinkItem {
+	facets := ctx.config.Crawler.Facets
+	if len(facets.Params) == 0 && len(facets.Combinations) == 0 {
+		return nil
+	}
+	base := strings.TrimSpace(facets.URL)
+	if base == "" {
+		base = ctx.source.URL
+	} else if strings.HasPrefix(base, "/") {
+		base, _ = combineURLs(ctx.source.URL, base)
+	}
+	urls, err := facetURLs(base, facets, facets.MaxURLs)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Source %d: no facets crawled: %v", ctx.source.ID, err)
+		return nil
+	}
+
+	known := make(map[string]bool, len(links))
+	for _, link := range links {
+		known[normalizeURL(link.Link, 0)] = true
+	}
+	ctx.facets = make(map[string]bool, len(urls))
+	var facetLinks []LinkItem
+	for _, u := range urls {
+		ctx.facets[cmn.NormalizeURL(u)] = true
+		link := normalizeURL(u, 0)
+		if known[link] {
+			continue
+		}
+		known[link] = true
+		facetLinks = append(facetLinks, LinkItem{PageURL: ctx.source.URL, Link: link})
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Source %d: %d links seeded from the facets", ctx.source.ID, len(facetLinks))
+	return facetLinks
+}
+
+// isFacetURL returns true if the URL is one of the facet URLs of the Source
+func (ctx *ProcessContext) isFacetURL(pageURL string) bool {
+	return ctx.facets[cmn.NormalizeURL(pageURL)]
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"reflect"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+func TestFacets(t *testing.T) {
+	facets := cfg.Facets{Params: map[string][]string{"size": {"s", "m"}, "color": {"red", "blue"}, "brand": {}}}
+
+	// All the combinations of the params values (ordered), keeping the query
+	// the URL already has
+	urls, err := facetURLs("https://shop.example.com/catalog?sort=price", facets, 0)
+	if err != nil {
+		t.Fatalf("facetURLs returned an error: %v", err)
+	}
+	expected := []string{
+		"https://shop.example.com/catalog?color=red&size=s&sort=price",
+		"https://shop.example.com/catalog?color=red&size=m&sort=price",
+		"https://shop.example.com/catalog?color=blue&size=s&sort=price",
+		"https://shop.example.com/catalog?color=blue&size=m&sort=price",
+	}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected the facet matrix %v, got %v", expected, urls)
+	}
+
+	// The URLs are capped
+	if urls, _ := facetURLs("https://shop.example.com/catalog", facets, 3); len(urls) != 3 {
+		t.Errorf("Expected 3 facet URLs, got %v", urls)
+	}
+
+	// The combinations are generated up to the cap (not the whole product)
+	huge := cfg.Facets{Params: map[string][]string{}}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		huge.Params[name] = []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+	}
+	generated := 0
+	facetCombinations(huge, func(map[string]string) bool {
+		generated++
+		return generated < 5
+	})
+	if generated != 5 {
+		t.Errorf("Expected the combinations to stop at 5, %d generated", generated)
+	}
+	if urls, _ := facetURLs("https://shop.example.com/catalog", huge, 4); len(urls) != 4 || urls[1] != "https://shop.example.com/catalog?a=0&b=0&c=0&d=0&e=0&f=0&g=0&h=0&i=0&j=1" {
+		t.Errorf("Expected the first 4 facet URLs of the product, got %v", urls)
+	}
+
+	// The provided combinations replace the cartesian product
+	facets.Combinations = []map[string]string{{"color": "red"}, {"color": "blue", "size": "m"}, {"color": "red"}}
+	urls, _ = facetURLs("https://shop.example.com/catalog", facets, 0)
+	expected = []string{"https://shop.example.com/catalog?color=red", "https://shop.example.com/catalog?color=blue&size=m"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("Expected the facet combinations %v, got %v", expected, urls)
+	}
+
+	// The facet URLs are seeded (once) and crawled even if the faceted
+	// navigation is excluded from the crawl, the other facet links aren't
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.source = &cdb.Source{ID: 7, URL: "https://shop.example.com", Restricted: 2}
+	ctx.config.Crawler.Facets = cfg.Facets{URL: "/catalog", Params: map[string][]string{"color": {"red", "blue"}, "size": {"s", "m"}}, MaxURLs: 10}
+	ctx.scope = newPatternScope(nil, []string{`[?&](color|size)=`})
+	found := []LinkItem{{PageURL: ctx.source.URL, Link: "https://shop.example.com/catalog?color=red&size=s"}}
+	links := ctx.facetLinks(found)
+	if len(links) != 3 {
+		t.Fatalf("Expected 3 facet links (1 already found), got %v", links)
+	}
+	crawled := 0
+	for _, link := range append(found, links...) {
+		if !skipURL(ctx, 1, link.Link, link.AnchorText) {
+			crawled++
+		}
+	}
+	if crawled != 4 {
+		t.Errorf("Expected the 4 facet URLs to be crawled, %d are", crawled)
+	}
+	if !skipURL(ctx, 1, "https://shop.example.com/catalog?color=green&size=xl", "Green") {
+		t.Errorf("Expected the facet links found in the pages to be excluded")
+	}
+}
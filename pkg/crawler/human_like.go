@@ -0,0 +1,121 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+const (
+	humanScroll    = "scroll"
+	humanMouseMove = "mouse_move"
+	humanDwell     = "dwell"
+
+	// humanMinScroll and humanMaxScroll bound the pixels of a human-like scroll
+	humanMinScroll = 50
+	humanMaxScroll = 400
+
+	// humanMaxMouseTargets bounds the elements a human-like mouse move can
+	// target (the first ones of the page)
+	humanMaxMouseTargets = 20
+
+	// humanMouseTargetXPath selects the n-th element of the page the mouse
+	// can move to (the elements with an id, that the mouse hover action
+	// needs, but the scripts and styles)
+	humanMouseTargetXPath = "(//body//*[@id][not(self::script or self::style or self::noscript)])[%d]"
+)
+
+// humanMaxDwell is the longest pause of a human-like dwell
+var humanMaxDwell = 1500 * time.Millisecond
+
+// humanInteraction is a single human-like interaction with a page
+type humanInteraction struct {
+	Kind   string        // humanScroll, humanMouseMove or humanDwell
+	Pixels int           // The pixels to scroll down (humanScroll)
+	Target int           // The element the mouse moves to, see humanMouseTargetXPath (humanMouseMove)
+	Dwell  time.Duration // The pause (humanDwell)
+}
+
+// humanInteractions picks a random sequence of n human-like interactions
+// with rng (so the sequence is reproducible when the crawl is seeded)
+func humanInteractions(rng *rand.Rand, n int) []humanInteraction {
+	kinds := []string{humanScroll, humanMouseMove, humanDwell}
+	seq := make([]humanInteraction, 0, n)
+	for i := 0; i < n; i++ {
+		hi := humanInteraction{Kind: kinds[cmn.RandomIndex(rng, len(kinds))]}
+		switch hi.Kind {
+		case humanScroll:
+			hi.Pixels = humanMinScroll + cmn.RandomIndex(rng, humanMaxScroll-humanMinScroll+1)
+		case humanMouseMove:
+			hi.Target = 1 + cmn.RandomIndex(rng, humanMaxMouseTargets)
+		case humanDwell:
+			hi.Dwell = time.Duration(cmn.RandomIndex(rng, int(humanMaxDwell/time.Millisecond)+1)) * time.Millisecond
+		}
+		seq = append(seq, hi)
+	}
+	return seq
+}
+
+// interactLikeHuman performs (if configured) a random sequence of human-like
+// interactions (small scrolls, mouse moves and dwell times) with the page, so
+// the content revealed on user engagement is rendered before the extraction.
+// The interactions stop if the crawl is cancelled.
+func (ctx *ProcessContext) interactLikeHuman(wd *vdi.WebDriver, pageURL string) {
+	if !ctx.config.Crawler.HumanLike {
+		return
+	}
+	y := 0
+	for _, hi := range humanInteractions(ctx.rng, ctx.config.Crawler.HumanLikeIntensity) {
+		var err error
+		switch hi.Kind {
+		case humanScroll:
+			y += hi.Pixels
+			err = executeActionScrollByAmount(&rules.ActionRule{Value: strconv.Itoa(y)}, wd)
+		case humanMouseMove:
+			r := &rules.ActionRule{
+				ActionType: "mouse_hover",
+				Selectors:  []rules.Selector{{SelectorType: strXPath, Selector: fmt.Sprintf(humanMouseTargetXPath, hi.Target)}},
+			}
+			if hoverErr := executeActionMouseHover(ctx, r, wd); hoverErr != nil {
+				// The page may have fewer elements to move to, move on
+				cmn.DebugMsg(cmn.DbgLvlDebug3, "human-like %s on %s: %v", hi.Kind, pageURL, hoverErr)
+			}
+		case humanDwell:
+			if !sleepWithContext(ctx.crawlCtx, hi.Dwell) {
+				cmn.DebugMsg(cmn.DbgLvlDebug3, "Crawl cancelled, stopping the human-like interactions with %s", pageURL)
+				return
+			}
+		}
+		if err != nil {
+			// Not fatal, the page is extracted anyway
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "human-like %s on %s: %v", hi.Kind, pageURL, err)
+			break
+		}
+	}
+	// Back to the top, where the rules expect the page to be
+	if y > 0 {
+		_, _ = (*wd).ExecuteScript("window.scrollTo(0, 0);", nil)
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Interacted like a human with %s", pageURL)
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	selenium "github.com/go-auxiliaries/selenium"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// mockHumanWebDriver is a mockWebDriver that records the scripts it executes
+// (its pages have 5 elements the mouse can move to)
+type mockHumanWebDriver struct {
+	mockWebDriver
+}
+
+func (m *mockHumanWebDriver) FindElements(by, value string) ([]vdi.WebElement, error) {
+	var n int
+	if _, err := fmt.Sscanf(value, humanMouseTargetXPath, &n); err == nil {
+		m.calls = append(m.calls, "find_target")
+		if n > 5 {
+			return nil, nil
+		}
+		return []vdi.WebElement{&mockHoverElement{id: fmt.Sprintf("target-%d", n)}}, nil
+	}
+	return m.mockWebDriver.FindElements(by, value)
+}
+
+// mockHoverElement is an element the mouse can move to
+type mockHoverElement struct {
+	vdi.WebElement
+	id string
+}
+
+func (e *mockHoverElement) GetAttribute(name string) (string, error) {
+	if name == "id" {
+		return e.id, nil
+	}
+	return "", fmt.Errorf("no attribute %s", name)
+}
+
+func (e *mockHoverElement) Location() (*selenium.Point, error) {
+	return &selenium.Point{X: 10, Y: 20}, nil
+}
+
+func (e *mockHoverElement) Size() (*selenium.Size, error) {
+	return &selenium.Size{Width: 100, Height: 20}, nil
+}
+
+func (m *mockHumanWebDriver) ExecuteScript(script string, _ []interface{}) (interface{}, error) {
+	switch {
+	case strings.Contains(script, `"moveMouse"`):
+		m.calls = append(m.calls, "mouse_move")
+	case strings.HasPrefix(script, "window.scrollTo("):
+		m.calls = append(m.calls, "scroll:"+strings.TrimSuffix(strings.TrimPrefix(script, "window.scrollTo(0, "), ");"))
+	}
+	return nil, nil
+}
+
+func TestInteractLikeHuman(t *testing.T) {
+	humanMaxDwell = 10 * time.Millisecond
+	defer func() { humanMaxDwell = 1500 * time.Millisecond }()
+
+	ctx := NewProcessContext(&Pars{Status: &Status{}})
+	ctx.config.Crawler.HumanLikeIntensity = 20
+	page := "<html><body><p>Hello</p></body></html>"
+
+	// Disabled by default
+	mock := &mockHumanWebDriver{mockWebDriver{pages: []string{page}}}
+	var wd vdi.WebDriver = mock
+	if err := extractPageInfo(&wd, ctx, "text/html", &PageInfo{}); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	if mock.calls[0] != "page_source" {
+		t.Errorf("Expected no interactions with human_like disabled, got %v", mock.calls)
+	}
+
+	// The interactions run before the extraction
+	ctx.config.Crawler.HumanLike = true
+	ctx.config.Crawler.RandomSeed = 42
+	ctx.rng = cmn.NewRand(ctx.config.Crawler.RandomSeed)
+	mock = &mockHumanWebDriver{mockWebDriver{pages: []string{page}}}
+	wd = mock
+	if err := extractPageInfo(&wd, ctx, "text/html", &PageInfo{}); err != nil {
+		t.Fatalf("extractPageInfo() error = %v", err)
+	}
+	first := -1
+	for i, call := range mock.calls {
+		if call == "page_source" {
+			first = i
+			break
+		}
+	}
+	if first <= 0 || mock.calls[first-1] != "scroll:0" {
+		t.Fatalf("Expected the interactions (ending back at the top) before the extraction, got %v", mock.calls)
+	}
+	moves, scrolls := 0, 0
+	for _, call := range mock.calls[:first-1] {
+		if call == "mouse_move" {
+			moves++
+		} else if strings.HasPrefix(call, "scroll:") {
+			scrolls++
+		}
+	}
+	if moves == 0 || scrolls == 0 {
+		t.Errorf("Expected mouse moves and scrolls, got %v", mock.calls[:first])
+	}
+
+	// The interactions are reproducible with the same seed
+	seq := humanInteractions(cmn.NewRand(42), 20)
+	if !reflect.DeepEqual(seq, humanInteractions(cmn.NewRand(42), 20)) {
+		t.Errorf("Expected the same interactions with the same seed")
+	}
+	if reflect.DeepEqual(seq, humanInteractions(cmn.NewRand(7), 20)) {
+		t.Errorf("Expected different interactions with a different seed")
+	}
+
+	// The dwell times stop when the crawl is cancelled
+	humanMaxDwell = time.Hour
+	crawlCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx.crawlCtx = crawlCtx
+	done := make(chan struct{})
+	go func() {
+		ctx.interactLikeHuman(&wd, testFQDN)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the human-like interactions to stop when the crawl is cancelled")
+	}
+}
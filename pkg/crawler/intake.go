@@ -0,0 +1,53 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+// SourceIntakeLimit returns how many new Sources can start crawling in a
+// scheduler cycle. It's max_sources, capped by the source intake max_per_cycle
+// (if set) and, during the ramp-up after the engine started, linearly increased
+// from 1 to that cap, so a big backlog (after a restart or a big import) doesn't
+// start crawling all at once.
+func SourceIntakeLimit(conf cfg.Crawler, started, now time.Time) int {
+	limit := conf.MaxSources
+	if conf.SourceIntake.MaxPerCycle > 0 && conf.SourceIntake.MaxPerCycle < limit {
+		limit = conf.SourceIntake.MaxPerCycle
+	}
+	if limit < 1 {
+		return 1
+	}
+
+	rampUp := time.Duration(conf.SourceIntake.RampUp) * time.Minute
+	elapsed := now.Sub(started)
+	if rampUp <= 0 || elapsed >= rampUp {
+		return limit
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+
+	ramped := 1 + int(int64(limit-1)*int64(elapsed)/int64(rampUp))
+	if ramped > limit {
+		return limit
+	}
+	return ramped
+}
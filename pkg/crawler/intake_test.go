@@ -0,0 +1,59 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+func TestSourceIntakeLimit(t *testing.T) {
+	started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	conf := cfg.Crawler{MaxSources: 50, SourceIntake: cfg.SourceIntake{MaxPerCycle: 10, RampUp: 10}}
+
+	// Simulate a scheduler cycle per minute with a large backlog of sources
+	backlog := 1000
+	prev := 0
+	for cycle := 0; backlog > 0; cycle++ {
+		limit := SourceIntakeLimit(conf, started, started.Add(time.Duration(cycle)*time.Minute))
+		if limit < 1 || limit > conf.SourceIntake.MaxPerCycle {
+			t.Fatalf("cycle %d: intake limit %d out of range (1-%d)", cycle, limit, conf.SourceIntake.MaxPerCycle)
+		}
+		if limit < prev {
+			t.Errorf("cycle %d: intake limit decreased during the ramp-up (%d -> %d)", cycle, prev, limit)
+		}
+		if cycle == 0 && limit != 1 {
+			t.Errorf("expected the intake to start from 1 source, got %d", limit)
+		}
+		if cycle >= conf.SourceIntake.RampUp && limit != conf.SourceIntake.MaxPerCycle {
+			t.Errorf("cycle %d: expected the full intake (%d) after the ramp-up, got %d", cycle, conf.SourceIntake.MaxPerCycle, limit)
+		}
+		backlog -= limit
+		prev = limit
+	}
+
+	// Without a cap and ramp-up the whole max_sources is taken
+	conf.SourceIntake = cfg.SourceIntake{}
+	if limit := SourceIntakeLimit(conf, started, started); limit != conf.MaxSources {
+		t.Errorf("expected intake limit %d, got %d", conf.MaxSources, limit)
+	}
+	// A cap above max_sources has no effect
+	conf.SourceIntake.MaxPerCycle = 100
+	if limit := SourceIntakeLimit(conf, started, started); limit != conf.MaxSources {
+		t.Errorf("expected intake limit %d, got %d", conf.MaxSources, limit)
+	}
+}
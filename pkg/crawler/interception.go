@@ -0,0 +1,241 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	cdp "github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/devtool"
+	"github.com/mafredri/cdp/protocol/fetch"
+	"github.com/mafredri/cdp/rpcc"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+const (
+	// interceptionSetupTimeout is the timeout (in seconds) of the setup of
+	// the request interception of a VDI session
+	interceptionSetupTimeout = 10
+	// interceptionDefaultType is the Content-Type of the canned responses of
+	// the fixture files with an unknown extension
+	interceptionDefaultType = "text/html; charset=utf-8"
+)
+
+// interceptor holds the canned responses served to the requests intercepted
+// in the VDI sessions, so the rules can be tested against fixture files
+// instead of live sites.
+type interceptor struct {
+	mocks []mockResponse
+}
+
+// mockResponse is the canned response of the requests matching a pattern
+type mockResponse struct {
+	pattern string         // The URL pattern (as configured)
+	re      *regexp.Regexp // The URL pattern compiled
+	status  int
+	headers []fetch.HeaderEntry
+	body    []byte
+}
+
+// newInterceptor returns the interceptor of the configured interceptions
+// (nil if there are none). The fixture files are read once, the ones that
+// can't be read are skipped.
+func newInterceptor(intercepts []cfg.Intercept) *interceptor {
+	ic := &interceptor{}
+	for _, intercept := range intercepts {
+		re, err := wildcardRegexp(intercept.URLPattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "invalid interception pattern '%s': %v", intercept.URLPattern, err)
+			continue
+		}
+		body, err := os.ReadFile(intercept.File) //nolint:gosec // The fixture files are set in the engine configuration
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "reading interception fixture: %v", err)
+			continue
+		}
+
+		contentType := intercept.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(intercept.File))
+		}
+		if contentType == "" {
+			contentType = interceptionDefaultType
+		}
+		headers := []fetch.HeaderEntry{{Name: "Content-Type", Value: contentType}}
+		for name, value := range intercept.Headers {
+			if !strings.EqualFold(name, "Content-Type") {
+				headers = append(headers, fetch.HeaderEntry{Name: name, Value: value})
+			}
+		}
+		ic.mocks = append(ic.mocks, mockResponse{
+			pattern: intercept.URLPattern,
+			re:      re,
+			status:  intercept.Status,
+			headers: headers,
+			body:    body,
+		})
+	}
+	if len(ic.mocks) == 0 {
+		return nil
+	}
+	return ic
+}
+
+// wildcardRegexp compiles a CDP URL pattern: '*' matches zero or more
+// characters, '?' exactly one and '\' escapes the next character.
+func wildcardRegexp(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '*':
+			expr.WriteString(".*")
+		case r == '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing escape character")
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// match returns the canned response of the first interception matching the
+// URL (nil if none does)
+func (ic *interceptor) match(url string) *mockResponse {
+	for i := range ic.mocks {
+		if ic.mocks[i].re.MatchString(url) {
+			return &ic.mocks[i]
+		}
+	}
+	return nil
+}
+
+// patterns returns the URL patterns of the requests to intercept
+func (ic *interceptor) patterns() []fetch.RequestPattern {
+	patterns := make([]fetch.RequestPattern, 0, len(ic.mocks))
+	for _, mock := range ic.mocks {
+		pattern := mock.pattern
+		patterns = append(patterns, fetch.RequestPattern{URLPattern: &pattern})
+	}
+	return patterns
+}
+
+// startInterception intercepts the requests of the VDI session matching the
+// configured interceptions (if any) and serves them their canned responses.
+// The interception needs CDP, so only Chrome/Chromium sessions support it.
+func (ctx *ProcessContext) startInterception(sel vdi.SeleniumInstance) {
+	ctx.stopInterception()
+	ic := newInterceptor(ctx.config.Crawler.Intercepts)
+	if ic == nil {
+		return
+	}
+	browser := strings.ToLower(strings.TrimSpace(sel.Config.Type))
+	if browser != vdi.BrowserChrome && browser != vdi.BrowserChromium {
+		cmn.DebugMsg(cmn.DbgLvlWarn, "The %s VDI sessions don't support request interception, the interceptions won't be applied", browser)
+		return
+	}
+	host := strings.TrimSpace(sel.Config.Host)
+	if host == "" {
+		host = "crowler-vdi-1"
+	}
+
+	setupCtx, cancel := context.WithTimeout(context.Background(), interceptionSetupTimeout*time.Second)
+	defer cancel()
+	target, err := devtool.New("http://"+host+":9222").Get(setupCtx, devtool.Page)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "request interception: finding the VDI session page: %v", err)
+		return
+	}
+	conn, err := rpcc.DialContext(setupCtx, target.WebSocketDebuggerURL)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "request interception: connecting to CDP: %v", err)
+		return
+	}
+	client := cdp.NewClient(conn)
+	paused, err := client.Fetch.RequestPaused(context.Background())
+	if err == nil {
+		err = client.Fetch.Enable(setupCtx, fetch.NewEnableArgs().SetPatterns(ic.patterns()))
+	}
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "request interception: enabling the Fetch domain: %v", err)
+		_ = conn.Close()
+		return
+	}
+	ctx.interception = conn
+
+	go func() {
+		defer paused.Close() //nolint:errcheck // We can't check the error in a defer
+		for {
+			ev, err := paused.Recv()
+			if err != nil {
+				// The connection has been closed (the session is over)
+				return
+			}
+			ic.serve(client, ev)
+		}
+	}()
+	cmn.DebugMsg(cmn.DbgLvlInfo, "Source %d: intercepting the requests matching %d pattern(s)", ctx.source.ID, len(ic.mocks))
+}
+
+// serve serves the canned response of a paused request (or lets it continue
+// if no interception matches it)
+func (ic *interceptor) serve(client *cdp.Client, ev *fetch.RequestPausedReply) {
+	reqCtx, cancel := context.WithTimeout(context.Background(), interceptionSetupTimeout*time.Second)
+	defer cancel()
+	var err error
+	if mock := ic.match(ev.Request.URL); mock != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug2, "Serving the canned response of '%s' to %s", mock.pattern, ev.Request.URL)
+		args := fetch.NewFulfillRequestArgs(ev.RequestID, mock.status).SetResponseHeaders(mock.headers).SetBody(mock.body)
+		err = client.Fetch.FulfillRequest(reqCtx, args)
+	} else {
+		err = client.Fetch.ContinueRequest(reqCtx, fetch.NewContinueRequestArgs(ev.RequestID))
+	}
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "request interception of %s: %v", ev.Request.URL, err)
+	}
+}
+
+// stopInterception stops the request interception of the VDI session (if any)
+func (ctx *ProcessContext) stopInterception() {
+	if ctx.interception == nil {
+		return
+	}
+	if err := ctx.interception.Close(); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "closing the request interception connection: %v", err)
+	}
+	ctx.interception = nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestInterception(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	ic := newInterceptor([]cfg.Intercept{
+		{URLPattern: "https://shop.example.com/product/*", File: "./test_data/interception/product.html", Status: 200},
+		{URLPattern: "https://shop.example.com/missing", File: "./test_data/interception/missing.html", Status: 200},
+	})
+	if ic == nil || len(ic.patterns()) != 1 {
+		t.Fatalf("newInterceptor() didn't skip the missing fixture: %+v", ic)
+	}
+	if mock := ic.match("https://shop.example.com/about"); mock != nil {
+		t.Errorf("match() intercepted a URL not matching any pattern")
+	}
+
+	pageURL := "https://shop.example.com/product/42"
+	mock := ic.match(pageURL)
+	if mock == nil {
+		t.Fatalf("match(%q) = nil, want the product fixture", pageURL)
+	}
+	if mock.status != 200 || mock.headers[0].Value != "text/html; charset=utf-8" {
+		t.Errorf("canned response status = %d, headers = %v", mock.status, mock.headers)
+	}
+
+	// The rules scrape the canned response as they would the live page
+	var wd vdi.WebDriver = &mockWebDriver{site: map[string]string{pageURL: string(mock.body)}, url: pageURL}
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 7, URL: pageURL}}
+	rule := rules.ScrapingRule{
+		RuleName: "Product",
+		Elements: []rules.Element{
+			{Key: "name", Selectors: []rules.Selector{{SelectorType: "css", Selector: "h1.name", Extract: rules.ItemToExtract{Type: "text"}}}},
+			{Key: "price", Selectors: []rules.Selector{{SelectorType: "css", Selector: "span.price", Extract: rules.ItemToExtract{Type: "text"}}}},
+		},
+	}
+	data, err := executeScrapingRule(ctx, &rule, &wd)
+	if err != nil {
+		t.Fatalf("executeScrapingRule() error = %v", err)
+	}
+	if want := `"name":"Widget","price":20`; data != want {
+		t.Errorf("scraped %s, want %s", data, want)
+	}
+}
+
+func TestWildcardRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		url     string
+		want    bool
+	}{
+		{"https://example.com/*", "https://example.com/a/b?c=1", true},
+		{"https://example.com/*", "https://example.org/", false},
+		{"https://example.com/page?", "https://example.com/page1", true},
+		{"https://example.com/page?", "https://example.com/page", false},
+		{`https://example.com/a\*b`, "https://example.com/a*b", true},
+		{`https://example.com/a\*b`, "https://example.com/axb", false},
+		{"*.js", "https://example.com/app.js", true},
+	}
+	for _, test := range tests {
+		re, err := wildcardRegexp(test.pattern)
+		if err != nil {
+			t.Fatalf("wildcardRegexp(%q) error = %v", test.pattern, err)
+		}
+		if got := re.MatchString(test.url); got != test.want {
+			t.Errorf("wildcardRegexp(%q) match %q = %v, want %v", test.pattern, test.url, got, test.want)
+		}
+	}
+	if _, err := wildcardRegexp(`https://example.com/\`); err == nil {
+		t.Errorf("wildcardRegexp() accepted a trailing escape character")
+	}
+}
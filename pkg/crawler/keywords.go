@@ -25,14 +25,18 @@ import (
 	"strings"
 	"sync"
 	"unicode"
+	"unicode/utf8"
 
 	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 const (
 	p string = ".,?!:;\"'()[]{}<>"
+
+	maxRuleKeywords = 100 // Maximum number of keywords a keyword rule captures on a page
 )
 
 var (
@@ -128,32 +132,84 @@ func normalizeKeyword(word string) string {
 	return word
 }
 
+// keywordFilter filters the words that aren't keywords out of a page text:
+// the stop words of the page language (and the configured ones) and the
+// words shorter than the minimum keyword length
+type keywordFilter struct {
+	lang      string              // The language code of the page (e.g. "en")
+	minLength int                 // The minimum length of the keywords (in characters)
+	stopWords map[string]struct{} // The configured stop words (of the page language and of all the languages)
+}
+
+// newKeywordFilter returns the keyword filter of a page (its language and
+// the keywords configuration of its Source)
+func newKeywordFilter(pageInfo PageInfo) keywordFilter {
+	filter := keywordFilter{lang: keywordLang(pageInfo.DetectedLang), minLength: cfg.DefaultKeywordMinLength}
+	if pageInfo.Config == nil {
+		return filter
+	}
+	if pageInfo.Config.Crawler.KeywordMinLength > 0 {
+		filter.minLength = pageInfo.Config.Crawler.KeywordMinLength
+	}
+	for _, lang := range []string{filter.lang, cfg.StopWordsAllLanguages} {
+		for _, word := range pageInfo.Config.Crawler.StopWords[lang] {
+			if filter.stopWords == nil {
+				filter.stopWords = make(map[string]struct{})
+			}
+			filter.stopWords[word] = struct{}{}
+		}
+	}
+	return filter
+}
+
+// keywordLang returns the language code of the stop words of a page language
+// (e.g. "en" for "en-US"), English if the language is unknown
+func keywordLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	if lang == "" || lang == "unknown" {
+		return "en" // Default to English
+	}
+	return lang
+}
+
 // Function that returns false if the keyword is
-// an English language stop word, article, or preposition
-// and true otherwise
+// a stop word, article, or preposition of the given
+// language (English by default) and true otherwise
 func isKeyword(word, lang string) bool {
+	return keywordFilter{lang: keywordLang(lang), minLength: cfg.DefaultKeywordMinLength}.isKeyword(word)
+}
+
+// isKeyword returns false if the word is a stop word (of the filter language
+// or a configured one) or shorter than the minimum keyword length, and true
+// otherwise
+func (f keywordFilter) isKeyword(word string) bool {
 	// Ensure stopWords is initialized
 	initStopWords.Do(loadStopWords)
 
-	if strings.TrimSpace(lang) == "" {
-		lang = "en" // Default to English
-	}
-
 	// Normalize the word: lowercase and trim spaces
 	word = strings.ToLower(strings.TrimSpace(word))
 
 	// Check basic conditions:
-	// 1. Word length should be at least 3
+	// 1. Word length should be at least the minimum length (the words of the
+	//    CJK languages are written with one or two characters)
 	// 2. Word should not be a string of only symbols
 	// 3. Word should not contain comment markers
-	if len(word) < 3 ||
+	if (utf8.RuneCountInString(word) < f.minLength && !isCJKWord(word)) ||
 		strings.Trim(word, ".,?!:;'\"()[]{}<>-=+/*\\_") == "" ||
 		word == "/*" || word == "*/" || word == "<!--" || word == "-->" {
 		return false
 	}
 
+	// Check if the word is a configured stop word
+	if _, isStopWord := f.stopWords[word]; isStopWord {
+		return false
+	}
+
 	// Check if the language is supported
-	langWords, exists := stopWords[lang]
+	langWords, exists := stopWords[f.lang]
 	if !exists {
 		// If the language is not supported, treat all words as keywords
 		return true
@@ -164,7 +220,18 @@ func isKeyword(word, lang string) bool {
 	return !isStopWord
 }
 
-func extractFromMetaTag(metaTags []MetaTag, tagName string) []string {
+// isCJKWord returns true if the word is written in a CJK script (Han, Kana
+// or Hangul)
+func isCJKWord(word string) bool {
+	for _, r := range word {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+func extractFromMetaTag(metaTags []MetaTag, tagName string, filter keywordFilter) []string {
 	var keywords []string
 	tagName = strings.ToLower(strings.TrimSpace(tagName))
 	for _, metaTag := range metaTags {
@@ -188,7 +255,7 @@ func extractFromMetaTag(metaTags []MetaTag, tagName string) []string {
 				// Always store if the keyword starts with # or @
 				if strings.HasPrefix(trimmedKeyword, "#") || strings.HasPrefix(trimmedKeyword, "@") {
 					keywords = append(keywords, trimmedKeyword)
-				} else if isKeyword(trimmedKeyword, "") {
+				} else if filter.isKeyword(trimmedKeyword) {
 					// Check if it is a valid keyword
 					keywords = append(keywords, trimmedKeyword)
 				}
@@ -198,7 +265,7 @@ func extractFromMetaTag(metaTags []MetaTag, tagName string) []string {
 	return keywords
 }
 
-func extractContentKeywords(content string) []string {
+func extractContentKeywords(content string, filter keywordFilter) []string {
 	// Split the content by spaces, commas, and other punctuation
 	// to extract individual keywords
 	words := []string{}
@@ -222,7 +289,7 @@ func extractContentKeywords(content string) []string {
 
 		if strings.HasPrefix(trimmedWord, "#") || strings.HasPrefix(trimmedWord, "@") {
 			keywords = append(keywords, trimmedWord)
-		} else if isKeyword(trimmedWord, "") {
+		} else if filter.isKeyword(trimmedWord) {
 			keywords = append(keywords, trimmedWord)
 		}
 	}
@@ -292,17 +359,76 @@ func extractKeywords(pageInfo PageInfo) []string {
 	// Normalize content
 	content := normalizeText(contentBuilder.String())
 
+	// Filter the stop words of the page language out
+	filter := newKeywordFilter(pageInfo)
+
 	// Extract from main content
-	contentKeywords := extractContentKeywords(content)
+	contentKeywords := extractContentKeywords(content, filter)
 	keywords = append(keywords, contentKeywords...)
 
 	// Extract from meta tags (keywords and description)
-	keywords = append(keywords, extractFromMetaTag(pageInfo.MetaTags, "keywords")...)
-	keywords = append(keywords, extractFromMetaTag(pageInfo.MetaTags, "description")...)
+	keywords = append(keywords, extractFromMetaTag(pageInfo.MetaTags, "keywords", filter)...)
+	keywords = append(keywords, extractFromMetaTag(pageInfo.MetaTags, "description", filter)...)
 
 	return unique(keywords) // Remove duplicates and return
 }
 
+// keywordRule is a compiled keyword extraction rule
+type keywordRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// compileKeywordRules compiles the keyword extraction rules (invalid patterns
+// are logged and ignored)
+func compileKeywordRules(rules []cfg.KeywordRule) []keywordRule {
+	var compiled []keywordRule
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "ignoring invalid keyword rule '%s' pattern '%s': %v", rule.Name, rule.Pattern, err)
+			continue
+		}
+		compiled = append(compiled, keywordRule{name: rule.Name, re: re})
+	}
+	return compiled
+}
+
+// applyKeywordRules captures the terms of a page (title and text) matching
+// the keyword rules: they are added to the page keywords (lowercase, like the
+// generic ones) and tagged with the name of the first rule capturing them
+func applyKeywordRules(pageInfo *PageInfo, rules []keywordRule) {
+	pageInfo.KeywordTags = nil
+	if len(rules) == 0 {
+		return
+	}
+	text := pageInfo.Title + "\n" + pageInfo.BodyText
+	tags := make(map[string]string)
+	for _, rule := range rules {
+		for _, match := range rule.re.FindAllStringSubmatch(text, maxRuleKeywords) {
+			term := match[0]
+			if len(match) > 1 {
+				term = match[1]
+			}
+			keyword := strings.ToLower(strings.TrimSpace(term))
+			if keyword == "" {
+				continue
+			}
+			if _, ok := tags[keyword]; !ok {
+				tags[keyword] = rule.name
+			}
+		}
+	}
+	if len(tags) == 0 {
+		return
+	}
+	for keyword := range tags {
+		pageInfo.Keywords = append(pageInfo.Keywords, keyword)
+	}
+	pageInfo.Keywords = unique(pageInfo.Keywords)
+	pageInfo.KeywordTags = tags
+}
+
 func normalizeText(text string) string {
 	// Remove all HTML tags
 	re := regexp.MustCompile("<[^>]*>")
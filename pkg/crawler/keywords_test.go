@@ -16,7 +16,10 @@ package crawler
 
 import (
 	"reflect"
+	"sort"
 	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
 )
 
 const (
@@ -91,7 +94,7 @@ func TestExtractContentKeywords(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := extractContentKeywords(tt.args.content); !reflect.DeepEqual(got, tt.want) {
+			if got := extractContentKeywords(tt.args.content, newKeywordFilter(PageInfo{})); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("extractContentKeywords() = %v, want %v", got, tt.want)
 			}
 		})
@@ -224,6 +227,36 @@ func TestExtractKeywords(t *testing.T) {
 	}
 }
 
+func TestExtractKeywordsStopWords(t *testing.T) {
+	conf := cfg.NewConfig()
+	tests := []struct {
+		name     string
+		lang     string
+		body     string
+		minLen   int
+		extra    cfg.StopWordLists
+		expected []string
+	}{
+		{"english", "en-US", "The cheese and the wine with bread", 0, nil, []string{"cheese", "wine", "bread"}},
+		{"french", "fr", "Le fromage avec les vins dans la cave pour vous", 0, nil, []string{"fromage", "vins", "cave"}},
+		// The stop words of the other languages are keywords
+		{"french words in english", "en", "Le fromage avec les vins", 0, nil, []string{"fromage", "avec", "les", "vins"}},
+		{"min length", "en", "Big cheese wheel", 5, nil, []string{"cheese", "wheel"}},
+		{"configured", "fr", "Le fromage ACME avec cave", 0, cfg.StopWordLists{"fr": {"cave"}, "*": {"acme"}}, []string{"fromage"}},
+		{"cjk", "ja", "東京 タワー", 0, nil, []string{"東京", "タワー"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf.Crawler.KeywordMinLength = tt.minLen
+			conf.Crawler.StopWords = tt.extra
+			pageInfo := PageInfo{BodyText: tt.body, DetectedLang: tt.lang, Config: conf}
+			if got := extractKeywords(pageInfo); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("extractKeywords() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestExtractFromMetaTag(t *testing.T) {
 	type args struct {
 		metaTags []MetaTag
@@ -267,10 +300,45 @@ func TestExtractFromMetaTag(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := extractFromMetaTag(tt.args.metaTags, tt.args.tagName)
+			got := extractFromMetaTag(tt.args.metaTags, tt.args.tagName, newKeywordFilter(PageInfo{}))
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("extractFromMetaTag() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestApplyKeywordRules(t *testing.T) {
+	rules := compileKeywordRules([]cfg.KeywordRule{
+		{Name: "sku", Pattern: `\b[A-Z]{3}-\d{4}\b`},
+		{Name: "model", Pattern: `Model: (\w+)`},
+		{Name: "invalid", Pattern: `(`},
+	})
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 compiled rules, got %d", len(rules))
+	}
+
+	pageInfo := PageInfo{
+		Title:    "ABC-1234 widget",
+		BodyText: "Model: W100, compatible with XYZ-0042 and ABC-1234",
+		Keywords: []string{"widget"},
+	}
+	applyKeywordRules(&pageInfo, rules)
+
+	wantTags := map[string]string{"abc-1234": "sku", "xyz-0042": "sku", "w100": "model"}
+	if !reflect.DeepEqual(pageInfo.KeywordTags, wantTags) {
+		t.Errorf("KeywordTags = %v, want %v", pageInfo.KeywordTags, wantTags)
+	}
+	wantKeywords := []string{"abc-1234", "w100", "widget", "xyz-0042"}
+	keywords := append([]string(nil), pageInfo.Keywords...)
+	sort.Strings(keywords)
+	if !reflect.DeepEqual(keywords, wantKeywords) {
+		t.Errorf("Keywords = %v, want %v", keywords, wantKeywords)
+	}
+
+	// Without rules the keywords aren't tagged
+	applyKeywordRules(&pageInfo, nil)
+	if pageInfo.KeywordTags != nil {
+		t.Errorf("Expected no keyword tags without rules, got %v", pageInfo.KeywordTags)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// KVEntry represents a KV store entry in a KV environment snapshot
+type KVEntry struct {
+	Value        interface{} `json:"value"`
+	Type         string      `json:"type,omitempty"`
+	Source       string      `json:"source,omitempty"`
+	Persistent   bool        `json:"persistent"`
+	Static       bool        `json:"static"`
+	SessionValid bool        `json:"session_valid"`
+}
+
+// KVSnapshot represents the KV store environment of a crawl right after a
+// ruleset has been executed (before its non-persistent entries are removed).
+type KVSnapshot struct {
+	Seq     int                `json:"seq"`           // The position of the snapshot in the crawl.
+	Time    time.Time          `json:"time"`          // When the snapshot was taken.
+	URL     string             `json:"url,omitempty"` // The page the ruleset was executed on.
+	Ruleset string             `json:"ruleset"`       // The ruleset that has just been executed.
+	Entries map[string]KVEntry `json:"entries"`       // The KV store entries (by key).
+}
+
+// KVEnvironment records the KV store environment snapshots of a Source crawl,
+// to audit why variable-driven rules behaved a certain way. Only the latest
+// maxSnapshots snapshots are kept (the dropped ones are counted). All its
+// methods are no-ops on a nil *KVEnvironment (export disabled).
+type KVEnvironment struct {
+	SourceID  uint64       `json:"source_id"`
+	SourceURL string       `json:"source_url"`
+	StartTime time.Time    `json:"start_time"`
+	Dropped   int          `json:"dropped_snapshots"` // The oldest snapshots dropped (over maxSnapshots)
+	Snapshots []KVSnapshot `json:"snapshots"`
+
+	maxSnapshots int // 0 means no limit
+	mutex        sync.Mutex
+}
+
+// newKVEnvironment returns an empty KV environment export for the given
+// Source, keeping at most maxSnapshots snapshots
+func newKVEnvironment(src *cdb.Source, maxSnapshots int) *KVEnvironment {
+	return &KVEnvironment{
+		SourceID:     src.ID,
+		SourceURL:    src.URL,
+		StartTime:    time.Now(),
+		Snapshots:    []KVSnapshot{},
+		maxSnapshots: maxSnapshots,
+	}
+}
+
+// snapshot records the KV store entries of the given context
+func (e *KVEnvironment) snapshot(ctxID, ruleset string, wd *vdi.WebDriver) {
+	if e == nil {
+		return
+	}
+
+	snap := KVSnapshot{
+		Time:    time.Now(),
+		Ruleset: ruleset,
+		Entries: make(map[string]KVEntry),
+	}
+	if wd != nil && *wd != nil {
+		snap.URL, _ = (*wd).CurrentURL()
+	}
+	for key, entry := range cmn.KVStore.Snapshot(ctxID) {
+		snap.Entries[key] = KVEntry{
+			Value:        entry.Value,
+			Type:         entry.Properties.Type,
+			Source:       entry.Properties.Source,
+			Persistent:   entry.Properties.Persistent,
+			Static:       entry.Properties.Static,
+			SessionValid: entry.Properties.SessionValid,
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	snap.Seq = e.Dropped + len(e.Snapshots) + 1
+	if e.maxSnapshots > 0 && len(e.Snapshots) >= e.maxSnapshots {
+		drop := len(e.Snapshots) - e.maxSnapshots + 1
+		e.Snapshots = append(e.Snapshots[:0], e.Snapshots[drop:]...)
+		e.Dropped += drop
+	}
+	e.Snapshots = append(e.Snapshots, snap)
+}
+
+// save writes the KV environment snapshots as a JSON file (one per Source) in
+// the given directory
+func (e *KVEnvironment) save(dir string) error {
+	if e == nil {
+		return nil
+	}
+
+	e.mutex.Lock()
+	data, err := json.MarshalIndent(e, "", "  ")
+	e.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshalling KV environment: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("creating KV environment directory: %v", err)
+	}
+	path := kvEnvironmentFile(dir, e.SourceID)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("saving KV environment to '%s': %v", path, err)
+	}
+	return nil
+}
+
+// kvEnvironmentFile returns the file used to save the KV environment of a Source
+func kvEnvironmentFile(dir string, sourceID uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("kvenv-%d.json", sourceID))
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestKVEnvironmentSnapshot(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	src := &cdb.Source{ID: 5, URL: testFQDN}
+	ctx := &ProcessContext{SelID: 1, source: src, Status: &Status{}}
+	var wd vdi.WebDriver = &mockWebDriver{pages: []string{"<div>price: 42</div>"}}
+
+	rs := rules.Ruleset{
+		Name: "Products",
+		RuleGroups: []rules.RuleGroup{
+			{
+				GroupName: "Products group",
+				IsEnabled: true,
+				Env: []rules.EnvSetting{
+					{Key: "currency", Values: "EUR"},
+					{Key: "region", Values: "eu", Properties: rules.EnvProperties{Persistent: true}},
+				},
+				ScrapingRules: []rules.ScrapingRule{
+					{
+						RuleName: "Price",
+						Elements: []rules.Element{
+							{Key: "price", Selectors: []rules.Selector{{SelectorType: "regex", Selector: `price: (\d+)`}}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// The export is disabled by default
+	if _, err := executeScrapingRulesInRuleset(ctx, &rs, &wd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ctx.kvEnv != nil {
+		t.Fatalf("Expected no KV environment when the export is disabled")
+	}
+
+	ctx.kvEnv = newKVEnvironment(src, 0)
+	if _, err := executeScrapingRulesInRuleset(ctx, &rs, &wd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The non-persistent values are gone from the store, but not from the snapshot
+	if _, _, err := cmn.KVStore.Get("currency", ctx.GetContextID()); err == nil {
+		t.Errorf("Expected the non-persistent environment to be reset")
+	}
+
+	dir := t.TempDir()
+	if err := ctx.kvEnv.save(dir); err != nil {
+		t.Fatalf("Failed to save the KV environment: %v", err)
+	}
+	data, err := os.ReadFile(kvEnvironmentFile(dir, src.ID))
+	if err != nil {
+		t.Fatalf("Failed to read the KV environment: %v", err)
+	}
+	var env KVEnvironment
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("Failed to parse the KV environment: %v", err)
+	}
+
+	if env.SourceID != src.ID || len(env.Snapshots) != 1 {
+		t.Fatalf("Expected 1 snapshot for source %d, got %d for source %d", src.ID, len(env.Snapshots), env.SourceID)
+	}
+	snap := env.Snapshots[0]
+	if snap.Seq != 1 || snap.Ruleset != "Products" || snap.URL != testFQDN {
+		t.Errorf("Unexpected snapshot details: %+v", snap)
+	}
+	if snap.Entries["currency"].Value != "EUR" || snap.Entries["currency"].Persistent {
+		t.Errorf("Expected currency to be a non-persistent EUR, got %+v", snap.Entries["currency"])
+	}
+	if snap.Entries["region"].Value != "eu" || !snap.Entries["region"].Persistent {
+		t.Errorf("Expected region to be a persistent eu, got %+v", snap.Entries["region"])
+	}
+}
+
+func TestKVEnvironmentMaxSnapshots(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	env := newKVEnvironment(&cdb.Source{ID: 5, URL: testFQDN}, 3)
+	for i := 0; i < 10; i++ {
+		env.snapshot("ctx", "Products", nil)
+	}
+
+	// Only the latest snapshots are kept
+	if len(env.Snapshots) != 3 || env.Dropped != 7 {
+		t.Fatalf("Expected 3 snapshots (7 dropped), got %d (%d dropped)", len(env.Snapshots), env.Dropped)
+	}
+	for i, snap := range env.Snapshots {
+		if snap.Seq != 8+i {
+			t.Errorf("Expected snapshot %d to be the #%d, got #%d", i, 8+i, snap.Seq)
+		}
+	}
+}
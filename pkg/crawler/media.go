@@ -0,0 +1,188 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// mediaEmbed is an embedded player pattern: the URL of its iframes (the first
+// submatch is the media ID) and the poster URL template of its media (if the
+// provider has one)
+type mediaEmbed struct {
+	provider string
+	mtype    string
+	pattern  *regexp.Regexp
+	poster   string
+}
+
+// Embedded players of the common providers
+var mediaEmbeds = []mediaEmbed{
+	{"youtube", "video", regexp.MustCompile(`^https?://(?:www\.)?youtube(?:-nocookie)?\.com/embed/([\w-]+)`), "https://i.ytimg.com/vi/%s/hqdefault.jpg"},
+	{"vimeo", "video", regexp.MustCompile(`^https?://player\.vimeo\.com/video/(\d+)`), ""},
+	{"dailymotion", "video", regexp.MustCompile(`^https?://(?:www\.)?dailymotion\.com/embed/video/(\w+)`), "https://www.dailymotion.com/thumbnail/video/%s"},
+	{"soundcloud", "audio", regexp.MustCompile(`^https?://w\.soundcloud\.com/player/\?(.+)`), ""},
+	{"spotify", "audio", regexp.MustCompile(`^https?://open\.spotify\.com/embed/(?:track|episode|album|playlist|show)/(\w+)`), ""},
+}
+
+// isoDuration matches the ISO 8601 durations of the schema.org media objects
+// (e.g. PT1H2M30S)
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// extractMedia returns the video and audio media of a page: the video and
+// audio elements (with their source elements) and the embedded players of
+// the common providers (e.g. YouTube and Vimeo iframes). The media sources
+// are resolved against the base URL of the page. The durations come from the
+// schema.org VideoObject and AudioObject of the media (JSON-LD or microdata).
+func extractMedia(doc *goquery.Document, base *url.URL) []MediaInfo {
+	var media []MediaInfo
+	seen := make(map[string]bool)
+	add := func(m MediaInfo) {
+		if m.Src == "" || seen[m.Src] {
+			return
+		}
+		seen[m.Src] = true
+		media = append(media, m)
+	}
+
+	durations := jsonLDMediaDurations(doc, base)
+	doc.Find("video, audio").Each(func(_ int, s *goquery.Selection) {
+		m := MediaInfo{
+			Type:     goquery.NodeName(s),
+			Src:      resolveMediaURL(base, s.AttrOr("src", "")),
+			MIMEType: strings.TrimSpace(s.AttrOr("type", "")),
+			Poster:   resolveMediaURL(base, s.AttrOr("poster", "")),
+		}
+		if m.Src == "" {
+			// The first playable source element
+			s.Find("source").EachWithBreak(func(_ int, source *goquery.Selection) bool {
+				m.Src = resolveMediaURL(base, source.AttrOr("src", ""))
+				m.MIMEType = strings.TrimSpace(source.AttrOr("type", ""))
+				return m.Src == ""
+			})
+		}
+		m.Duration = mediaDuration(s, durations[m.Src])
+		add(m)
+	})
+
+	doc.Find("iframe").Each(func(_ int, s *goquery.Selection) {
+		src := s.AttrOr("src", "")
+		if strings.TrimSpace(src) == "" {
+			src = s.AttrOr("data-src", "") // Lazy-loaded players
+		}
+		src = resolveMediaURL(base, src)
+		for _, embed := range mediaEmbeds {
+			match := embed.pattern.FindStringSubmatch(src)
+			if match == nil {
+				continue
+			}
+			m := MediaInfo{Type: embed.mtype, Src: src, Provider: embed.provider}
+			if embed.poster != "" {
+				m.Poster = fmt.Sprintf(embed.poster, match[1])
+			}
+			m.Duration = mediaDuration(s, durations[src])
+			add(m)
+			break
+		}
+	})
+	return media
+}
+
+// resolveMediaURL returns the absolute URL of a media source (empty for the
+// data: and blob: sources, which can't be retrieved)
+func resolveMediaURL(base *url.URL, src string) string {
+	src = strings.TrimSpace(src)
+	lower := strings.ToLower(src)
+	if src == "" || strings.HasPrefix(lower, "data:") || strings.HasPrefix(lower, "blob:") {
+		return ""
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		ref = base.ResolveReference(ref)
+	}
+	return ref.String()
+}
+
+// mediaDuration returns the duration (in seconds) of a media element: the
+// duration of the schema.org media object (microdata) it belongs to, or the
+// one found in the JSON-LD (jsonLD)
+func mediaDuration(s *goquery.Selection, jsonLD int) int {
+	scope := s.Closest("[itemscope]")
+	if scope.Length() > 0 {
+		duration := scope.Find("[itemprop='duration']").First()
+		if d := parseISODuration(duration.AttrOr("content", duration.Text())); d > 0 {
+			return d
+		}
+	}
+	return jsonLD
+}
+
+// jsonLDMediaDurations returns the durations (in seconds) of the JSON-LD
+// VideoObject and AudioObject, by their (resolved) contentUrl and embedUrl
+func jsonLDMediaDurations(doc *goquery.Document, base *url.URL) map[string]int {
+	durations := make(map[string]int)
+	doc.Find("script[type='application/ld+json']").Each(func(_ int, s *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &data); err != nil {
+			return
+		}
+		walkJSONLD(data, func(obj map[string]interface{}) {
+			if !jsonLDHasType(obj, "VideoObject") && !jsonLDHasType(obj, "AudioObject") {
+				return
+			}
+			value, _ := obj["duration"].(string)
+			duration := parseISODuration(value)
+			if duration == 0 {
+				return
+			}
+			for _, key := range []string{"contentUrl", "embedUrl"} {
+				if src, ok := obj[key].(string); ok {
+					if src = resolveMediaURL(base, src); src != "" {
+						durations[src] = duration
+					}
+				}
+			}
+		})
+	})
+	return durations
+}
+
+// parseISODuration returns the number of seconds of an ISO 8601 duration
+// (e.g. PT4M13S), 0 if it isn't valid
+func parseISODuration(value string) int {
+	match := isoDuration.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value)))
+	if match == nil {
+		return 0
+	}
+	seconds := 0.0
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if n, err := strconv.ParseFloat(match[i+1], 64); err == nil {
+			seconds += n * unit
+		}
+	}
+	return int(seconds + 0.5)
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractMedia(t *testing.T) {
+	html, err := os.ReadFile("./test_data/media.html")
+	if err != nil {
+		t.Fatalf("Failed to read the test fixture: %v", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse the test fixture: %v", err)
+	}
+
+	expected := []MediaInfo{
+		{Type: "video", Src: "https://www.example.com/videos/intro.webm", MIMEType: "video/webm", Poster: "https://www.example.com/images/intro.jpg", Duration: 90},
+		{Type: "audio", Src: "https://www.example.com/shows/podcast/episode-1.mp3"},
+		{Type: "video", Src: "https://www.youtube.com/embed/dQw4w9WgXcQ", Provider: "youtube", Poster: "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg", Duration: 213},
+		{Type: "video", Src: "https://player.vimeo.com/video/76979871", Provider: "vimeo"},
+	}
+
+	media := extractMedia(doc, (&ProcessContext{}).linksBaseURL(doc, "https://www.example.com/shows/media.html"))
+	if !reflect.DeepEqual(media, expected) {
+		t.Errorf("Expected media:\n%+v\ngot:\n%+v", expected, media)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]int{
+		"PT3M33S":   213,
+		"PT1H2M":    3720,
+		"P1DT1S":    86401,
+		"pt45.6s":   46,
+		"3 minutes": 0,
+		"":          0,
+	}
+	for value, expected := range tests {
+		if got := parseISODuration(value); got != expected {
+			t.Errorf("parseISODuration(%q) = %d, want %d", value, got, expected)
+		}
+	}
+}
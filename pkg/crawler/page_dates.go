@@ -0,0 +1,351 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const bylineDateMaxLength = 40 // Maximum length of the byline text following a date keyword
+
+// Meta tags carrying the publish (and modified) date of a page, in preference order
+var (
+	publishedMetaSelectors = []string{
+		"meta[property='article:published_time']",
+		"meta[itemprop='datePublished']",
+		"meta[name='date']",
+		"meta[name='pubdate']",
+		"meta[name='publish-date']",
+		"meta[name='DC.date.issued']",
+		"meta[name='dcterms.created']",
+	}
+	modifiedMetaSelectors = []string{
+		"meta[property='article:modified_time']",
+		"meta[property='og:updated_time']",
+		"meta[itemprop='dateModified']",
+		"meta[name='last-modified']",
+		"meta[name='dcterms.modified']",
+	}
+)
+
+var (
+	// "Published on March 5, 2024", "Updated: 05/03/2024"
+	bylineDateRe = regexp.MustCompile(`(?i)\b(published|posted|updated|modified|last updated|pubblicato|aggiornato|publié|mis à jour|veröffentlicht|aktualisiert|publicado|actualizado)`)
+	// 2024-03-05, 2024/03/05
+	isoDateRe = regexp.MustCompile(`\b(\d{4})[-/.](\d{1,2})[-/.](\d{1,2})\b`)
+	// 05/03/2024, 05.03.2024, 5-3-24
+	numericDateRe = regexp.MustCompile(`\b(\d{1,2})[-/.](\d{1,2})[-/.](\d{4}|\d{2})\b`)
+	// 5 March 2024, 5th of March, 2024, 5 de marzo de 2024, 5. März 2024
+	dayMonthYearRe = regexp.MustCompile(`\b(\d{1,2})(?:st|nd|rd|th|er|º)?\.?\s+(?:of\s+|de\s+)?(\pL+)\.?,?\s+(?:de\s+)?(\d{4})\b`)
+	// March 5, 2024, Mar 5th 2024
+	monthDayYearRe = regexp.MustCompile(`(\pL+)\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+)
+
+// pageDateLayouts are the machine readable date formats (the ones used in
+// JSON-LD, meta tags and <time> elements)
+var pageDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05.000Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC850,
+	time.RFC822Z,
+	time.RFC822,
+	time.ANSIC,
+	"20060102",
+}
+
+// pageDateMonths maps the (lowercase) month names, and their abbreviations, of
+// the most common languages to the month number
+var pageDateMonths = func() map[string]time.Month {
+	names := [][]string{
+		{"january", "jan", "januar", "janvier", "janv", "enero", "ene", "gennaio", "gen", "janeiro", "januari", "jänner"},
+		{"february", "feb", "februar", "février", "févr", "fevrier", "febrero", "febbraio", "fevereiro", "fev", "februari"},
+		{"march", "mar", "märz", "mär", "maerz", "mars", "marzo", "março", "marco", "maart", "mrt"},
+		{"april", "apr", "avril", "avr", "abril", "abr", "aprile"},
+		{"may", "mai", "mayo", "maggio", "mag", "maio", "mei"},
+		{"june", "jun", "juni", "juin", "junio", "giugno", "giu", "junho"},
+		{"july", "jul", "juli", "juillet", "juil", "julio", "luglio", "lug", "julho"},
+		{"august", "aug", "août", "aout", "agosto", "ago", "augustus"},
+		{"september", "sep", "sept", "septembre", "septiembre", "settembre", "set", "setembro"},
+		{"october", "oct", "oktober", "okt", "octobre", "octubre", "ottobre", "ott", "outubro", "out"},
+		{"november", "nov", "novembre", "noviembre", "novembro"},
+		{"december", "dec", "dezember", "dez", "décembre", "déc", "decembre", "diciembre", "dic", "dicembre", "dezembro"},
+	}
+	months := make(map[string]time.Month)
+	for i, list := range names {
+		for _, name := range list {
+			months[name] = time.Month(i + 1)
+		}
+	}
+	return months
+}()
+
+// extractPageDates returns the publish and modified dates of a page (zero if
+// not found). Each date is taken from the first source that has it, in this
+// preference order: JSON-LD (datePublished and dateModified), meta tags (e.g.
+// article:published_time), <time> elements and, at last, the visible bylines
+// (e.g. "Published on March 5, 2024").
+func extractPageDates(doc *goquery.Document) (published, modified time.Time) {
+	published, modified = jsonLDDates(doc)
+	if published.IsZero() {
+		published = metaDate(doc, publishedMetaSelectors)
+	}
+	if modified.IsZero() {
+		modified = metaDate(doc, modifiedMetaSelectors)
+	}
+	if published.IsZero() || modified.IsZero() {
+		p, m := timeElementDates(doc)
+		if published.IsZero() {
+			published = p
+		}
+		if modified.IsZero() {
+			modified = m
+		}
+	}
+	if published.IsZero() || modified.IsZero() {
+		p, m := bylineDates(doc)
+		if published.IsZero() {
+			published = p
+		}
+		if modified.IsZero() {
+			modified = m
+		}
+	}
+	return published, modified
+}
+
+// pageDatePtr returns a pointer to the given date (nil if the date is zero)
+func pageDatePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// jsonLDDates returns the datePublished and dateModified of the first JSON-LD
+// object (including the @graph ones) that has them
+func jsonLDDates(doc *goquery.Document) (published, modified time.Time) {
+	doc.Find("script[type='application/ld+json']").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(s.Text())), &data); err != nil {
+			return true
+		}
+		walkJSONLD(data, func(obj map[string]interface{}) {
+			if published.IsZero() {
+				if v, ok := obj["datePublished"].(string); ok {
+					published, _ = parsePageDate(v)
+				}
+			}
+			if modified.IsZero() {
+				if v, ok := obj["dateModified"].(string); ok {
+					modified, _ = parsePageDate(v)
+				}
+			}
+		})
+		return published.IsZero() || modified.IsZero()
+	})
+	return published, modified
+}
+
+// walkJSONLD calls fn for every object of a JSON-LD document
+func walkJSONLD(data interface{}, fn func(map[string]interface{})) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		fn(v)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys) // Walk the objects always in the same order
+		for _, key := range keys {
+			walkJSONLD(v[key], fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkJSONLD(child, fn)
+		}
+	}
+}
+
+// metaDate returns the first valid date found in the given meta tags
+func metaDate(doc *goquery.Document, selectors []string) time.Time {
+	for _, selector := range selectors {
+		if t, ok := parsePageDate(doc.Find(selector).First().AttrOr("content", "")); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// timeElementDates returns the dates of the <time> elements: the ones marked as
+// modified/updated are the modified date, the first other one is the publish date
+func timeElementDates(doc *goquery.Document) (published, modified time.Time) {
+	doc.Find("time").Each(func(_ int, s *goquery.Selection) {
+		value := s.AttrOr("datetime", "")
+		if value == "" {
+			value = s.Text()
+		}
+		t, ok := parsePageDate(value)
+		if !ok {
+			return
+		}
+		marker := strings.ToLower(s.AttrOr("itemprop", "") + " " + s.AttrOr("class", ""))
+		if strings.Contains(marker, "modified") || strings.Contains(marker, "updated") {
+			if modified.IsZero() {
+				modified = t
+			}
+		} else if published.IsZero() {
+			published = t
+		}
+	})
+	return published, modified
+}
+
+// bylineDates returns the dates found in the visible bylines of the page's
+// main content (e.g. "Published on March 5, 2024" or "Updated: 05/03/2024")
+func bylineDates(doc *goquery.Document) (published, modified time.Time) {
+	content := doc.Find("article, main, [role='main']").First()
+	if content.Length() == 0 {
+		content = doc.Find("body")
+	}
+	text := strings.Join(strings.Fields(content.Text()), " ")
+	for _, match := range bylineDateRe.FindAllStringIndex(text, -1) {
+		// The date follows the keyword (e.g. "on March 5, 2024")
+		t, ok := parsePageDate(strLeft(text[match[1]:], bylineDateMaxLength))
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(text[match[0]:match[1]]) {
+		case "updated", "modified", "last updated", "aggiornato", "mis à jour", "aktualisiert", "actualizado":
+			if modified.IsZero() {
+				modified = t
+			}
+		default:
+			if published.IsZero() {
+				published = t
+			}
+		}
+	}
+	return published, modified
+}
+
+// parsePageDate parses a date as found in a page: machine readable formats
+// (ISO 8601, RFC 1123 etc.), numeric dates (05/03/2024, 05.03.2024) and dates
+// with the month name in the most common languages (March 5, 2024, 5 mars 2024,
+// 5. März 2024). Dates without a time zone are considered UTC. Dates before
+// 1970 or in the future are rejected.
+func parsePageDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range pageDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return validPageDate(t)
+		}
+	}
+
+	// Otherwise, the first date found in the text
+	text := strings.ToLower(s)
+	found, foundAt := time.Time{}, -1
+	match := func(re *regexp.Regexp, date func(m []string) (time.Time, bool)) {
+		loc := re.FindStringSubmatchIndex(text)
+		if loc == nil || (foundAt >= 0 && loc[0] >= foundAt) {
+			return
+		}
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			m[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+		if t, ok := date(m); ok {
+			found, foundAt = t, loc[0]
+		}
+	}
+	match(isoDateRe, func(m []string) (time.Time, bool) {
+		return pageDate(pageDateNumber(m[1]), pageDateNumber(m[2]), pageDateNumber(m[3]))
+	})
+	match(dayMonthYearRe, func(m []string) (time.Time, bool) {
+		month, ok := pageDateMonths[m[2]]
+		if !ok {
+			return time.Time{}, false
+		}
+		return pageDate(pageDateNumber(m[3]), int(month), pageDateNumber(m[1]))
+	})
+	match(monthDayYearRe, func(m []string) (time.Time, bool) {
+		month, ok := pageDateMonths[m[1]]
+		if !ok {
+			return time.Time{}, false
+		}
+		return pageDate(pageDateNumber(m[3]), int(month), pageDateNumber(m[2]))
+	})
+	match(numericDateRe, func(m []string) (time.Time, bool) {
+		first, second, year := pageDateNumber(m[1]), pageDateNumber(m[2]), pageDateNumber(m[3])
+		if year < 100 {
+			year += 2000
+		}
+		// Day first (most locales), unless it can only be month first (US)
+		if first <= 12 && second > 12 {
+			return pageDate(year, first, second)
+		}
+		return pageDate(year, second, first)
+	})
+	return found, foundAt >= 0
+}
+
+// pageDate returns the given date (UTC), if valid
+func pageDate(year, month, day int) (time.Time, bool) {
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day { // e.g. 31 February
+		return time.Time{}, false
+	}
+	return validPageDate(t)
+}
+
+// validPageDate rejects the dates that can't be a publish date
+func validPageDate(t time.Time) (time.Time, bool) {
+	if t.Year() < 1970 || t.After(time.Now().Add(48*time.Hour)) {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// pageDateNumber parses a (validated) date component
+func pageDateNumber(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
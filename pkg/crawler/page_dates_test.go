@@ -0,0 +1,92 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractPageDates(t *testing.T) {
+	tests := []struct {
+		fixture   string
+		published string
+		modified  string
+	}{
+		{"jsonld.html", "2024-03-05T07:30:00Z", "2024-03-06T09:15:00Z"}, // JSON-LD first (even with a meta tag)
+		{"meta.html", "2024-02-10T12:00:00Z", "2024-02-12T09:30:00Z"},   // Meta tags before <time> elements
+		{"time.html", "2023-11-20T21:45:00Z", "2023-12-01T00:00:00Z"},   // <time> elements
+		{"byline.html", "2024-03-05T00:00:00Z", "2024-03-07T00:00:00Z"}, // Visible (italian) bylines
+		{"nodate.html", "", ""},
+	}
+	for _, tt := range tests {
+		html, err := os.ReadFile("./test_data/page_dates/" + tt.fixture)
+		if err != nil {
+			t.Fatalf("Failed to read the %s fixture: %v", tt.fixture, err)
+		}
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(html)))
+		if err != nil {
+			t.Fatalf("%s: parsing HTML: %v", tt.fixture, err)
+		}
+		published, modified := extractPageDates(doc)
+		for _, date := range []struct {
+			name     string
+			got      time.Time
+			expected string
+		}{{"published", published, tt.published}, {"modified", modified, tt.modified}} {
+			got := ""
+			if !date.got.IsZero() {
+				got = date.got.Format(time.RFC3339)
+			}
+			if got != date.expected {
+				t.Errorf("%s: expected %s date %q, got %q", tt.fixture, date.name, date.expected, got)
+			}
+		}
+	}
+}
+
+func TestParsePageDate(t *testing.T) {
+	tests := map[string]string{
+		"2024-03-05T08:30:00+01:00":     "2024-03-05T07:30:00Z",
+		"2024-03-05":                    "2024-03-05T00:00:00Z",
+		"Tue, 05 Mar 2024 08:30:00 GMT": "2024-03-05T08:30:00Z",
+		"March 5, 2024":                 "2024-03-05T00:00:00Z",
+		"Mar 5th 2024":                  "2024-03-05T00:00:00Z",
+		"5th of March, 2024":            "2024-03-05T00:00:00Z",
+		"5 mars 2024":                   "2024-03-05T00:00:00Z",
+		"5. März 2024":                  "2024-03-05T00:00:00Z",
+		"5 de marzo de 2024":            "2024-03-05T00:00:00Z",
+		"05.03.2024":                    "2024-03-05T00:00:00Z",
+		"05/03/2024":                    "2024-03-05T00:00:00Z", // Day first
+		"03/25/2024":                    "2024-03-25T00:00:00Z", // Can only be month first
+		"Mar 5, 2024 (upd. 7 Apr 2024)": "2024-03-05T00:00:00Z", // The first date
+		"31/02/2024":                    "",
+		"3024-01-01":                    "", // In the future
+		"not a date":                    "",
+	}
+	for in, expected := range tests {
+		got := ""
+		if date, ok := parsePageDate(in); ok {
+			got = date.Format(time.RFC3339)
+		}
+		if got != expected {
+			t.Errorf("parsePageDate(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
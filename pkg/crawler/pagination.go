@@ -0,0 +1,223 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	rs "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+const paginationDefaultKey = "pagination" // Default key of the pagination metadata
+
+var (
+	// "Showing 1-20 of 340 results"
+	paginationRangeRe = regexp.MustCompile(`(?i)(\d[\d,.]*)\s*[-–]\s*(\d[\d,.]*)\s*(?:of|out of|/)\s*(\d[\d,.]*)`)
+	// "Page 1 of 5", "1 / 5"
+	paginationPageRe = regexp.MustCompile(`(?i)(\d[\d,.]*)\s*(?:of|out of|/)\s*(\d[\d,.]*)`)
+	// "340 results"
+	paginationCountRe = regexp.MustCompile(`\d[\d,.]*`)
+	// "1340", "1,340", "1.340" or "1 340" (a single kind of thousands separator)
+	paginationNumberRe = regexp.MustCompile(`^(?:\d+|\d{1,3}(?:,\d{3})+|\d{1,3}(?:\.\d{3})+|\d{1,3}(?:[ \x{a0}\x{202f}']\d{3})+)$`)
+)
+
+// paginationState holds what has been collected of a paginated listing during
+// the crawl of a Source
+type paginationState struct {
+	unit  string         // What the total counts ("pages" or "items")
+	total int            // The last total detected
+	pages map[string]int // The items collected on each page (by page number or URL)
+}
+
+// paginationKey returns the key where the pagination metadata of a rule is stored
+func paginationKey(rule *rs.ScrapingRule) string {
+	key := strings.TrimSpace(rule.Pagination.Key)
+	if key == "" {
+		return paginationDefaultKey
+	}
+	return key
+}
+
+// paginationMetadata detects the total number of pages (or items) of the
+// paginated listing the current page belongs to and returns it with the
+// number of pages (or items) collected so far during the crawl of the Source.
+// The metadata is flagged as incomplete while collected < total.
+// It returns nil if the totals can't be found on the page.
+func paginationMetadata(ctx *ProcessContext, rule *rs.ScrapingRule, wd *vdi.WebDriver, extractedData map[string]interface{}) map[string]interface{} {
+	total, current, found := 0, 0, false
+	for _, selector := range rule.Pagination.Selectors {
+		selector = resolveSelectorVars(ctx, selector)
+		for _, extracted := range extractContent(ctx, wd, selector, true) {
+			text, ok := extracted.(string)
+			if !ok {
+				continue
+			}
+			if total, current, found = parsePaginationText(text, rule.Pagination.Pattern); found {
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "No pagination totals found by rule '%s'", rule.RuleName)
+		return nil
+	}
+
+	// Pages are identified by their number (when known) or their URL
+	page := ""
+	if current > 0 {
+		page = strconv.Itoa(current)
+	} else if url, err := (*wd).CurrentURL(); err == nil {
+		page = url
+	}
+
+	unit := rule.GetPaginationUnit()
+	count := 1
+	if unit == rs.PaginationItems {
+		count = paginationItemsCount(rule, extractedData)
+	}
+
+	ctx.paginationMutex.Lock()
+	if ctx.pagination == nil {
+		ctx.pagination = make(map[string]paginationState)
+	}
+	state := ctx.pagination[rule.RuleName]
+	if state.pages == nil {
+		state.pages = make(map[string]int)
+	}
+	state.unit = unit
+	state.total = total
+	state.pages[page] = count
+	ctx.pagination[rule.RuleName] = state
+	collected := state.collected()
+	ctx.paginationMutex.Unlock()
+
+	metadata := map[string]interface{}{
+		"unit":       unit,
+		"total":      total,
+		"collected":  collected,
+		"incomplete": collected < total,
+	}
+	if current > 0 {
+		metadata["current"] = current
+	}
+	return metadata
+}
+
+// collected returns the number of pages (or items) collected
+func (s paginationState) collected() int {
+	collected := 0
+	for _, count := range s.pages {
+		collected += count
+	}
+	return collected
+}
+
+// paginationItemsCount returns the number of items scraped on the current page
+// (the items_key value, or the detail pages items when items_key is not set)
+func paginationItemsCount(rule *rs.ScrapingRule, extractedData map[string]interface{}) int {
+	key := strings.TrimSpace(rule.Pagination.ItemsKey)
+	if key == "" && rule.HasDetailPages() {
+		key = detailPagesKey(rule)
+	}
+	switch v := extractedData[key].(type) {
+	case nil:
+		return 0
+	case []interface{}:
+		return len(v)
+	default:
+		return 1
+	}
+}
+
+// parsePaginationText returns the total (and the current page number, if
+// present) found in a pagination text. If pattern is set, it must have a
+// "total" named group (and optionally a "current" one), otherwise texts like
+// "Page 1 of 5", "1-20 of 340" and "340 results" are recognized.
+func parsePaginationText(text, pattern string) (total, current int, ok bool) {
+	text = strings.TrimSpace(text)
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "invalid pagination pattern '%s': %v", pattern, err)
+			return 0, 0, false
+		}
+		match := re.FindStringSubmatch(text)
+		if match == nil {
+			return 0, 0, false
+		}
+		for i, name := range re.SubexpNames() {
+			switch name {
+			case "total":
+				total, _ = parsePaginationNumber(match[i])
+			case "current":
+				current, _ = parsePaginationNumber(match[i])
+			}
+		}
+		return total, current, total > 0
+	}
+
+	if match := paginationRangeRe.FindStringSubmatch(text); match != nil {
+		total, err := parsePaginationNumber(match[3])
+		return total, 0, err == nil && total > 0
+	}
+	if match := paginationPageRe.FindStringSubmatch(text); match != nil {
+		current, _ := parsePaginationNumber(match[1])
+		total, err := parsePaginationNumber(match[2])
+		return total, current, err == nil && total > 0
+	}
+	if match := paginationCountRe.FindString(text); match != "" {
+		total, err := parsePaginationNumber(match)
+		return total, 0, err == nil && total > 0
+	}
+	return 0, 0, false
+}
+
+// parsePaginationNumber parses a count, ignoring its thousands separators (a
+// sentence ending right after the number is fine, e.g. "of 340."). Anything
+// else than an integer (e.g. "1.5" or "1,234.5") is an error.
+func parsePaginationNumber(s string) (int, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), ",.")
+	if !paginationNumberRe.MatchString(s) {
+		return 0, fmt.Errorf("invalid pagination number '%s'", s)
+	}
+	return strconv.Atoi(strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s))
+}
+
+// reportPagination logs the paginated listings that haven't been collected
+// completely during the crawl of the Source
+func (ctx *ProcessContext) reportPagination() {
+	ctx.paginationMutex.Lock()
+	defer ctx.paginationMutex.Unlock()
+	for ruleName, state := range ctx.pagination {
+		if collected := state.collected(); collected < state.total {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Source %d: rule '%s' collected %d of %d paginated %s", ctx.source.ID, ruleName, collected, state.total, state.unit)
+		}
+	}
+}
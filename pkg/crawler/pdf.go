@@ -0,0 +1,85 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+const (
+	pdfMaxPages    = 2000             // The text of the PDF documents is extracted up to 2000 pages
+	pdfMaxTextSize = 10 * 1024 * 1024 // The text of the PDF documents is extracted up to 10 MiB
+)
+
+// pdfExtractor extracts the text of the PDF documents (page by page) and
+// their title and subject (from the document information), with the
+// github.com/ledongthuc/pdf reader. The documents encrypted with a user
+// password aren't supported.
+type pdfExtractor struct{}
+
+func (pdfExtractor) Extract(content []byte, _ string) (info PageInfo, err error) {
+	// The PDF reader panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			info, err = PageInfo{}, fmt.Errorf("malformed PDF document: %v", r)
+		}
+	}()
+
+	content = bytes.TrimLeft(content, "\x00\t\r\n ")
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return PageInfo{}, errors.New("not a PDF document")
+	}
+	reader, err := pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return PageInfo{}, err
+	}
+
+	var text strings.Builder
+	pages := reader.NumPage()
+	if pages > pdfMaxPages {
+		cmn.DebugMsg(cmn.DbgLvlWarn, "PDF document of %d pages, the text is extracted from the first %d", pages, pdfMaxPages)
+		pages = pdfMaxPages
+	}
+	for num := 1; num <= pages && text.Len() < pdfMaxTextSize; num++ {
+		page := reader.Page(num)
+		if page.V.IsNull() {
+			continue
+		}
+		pageText, err := page.GetPlainText(nil)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "extracting the text of the PDF page %d: %v", num, err)
+			continue
+		}
+		if pageText = strings.TrimSpace(pageText); pageText != "" {
+			text.WriteString(pageText)
+			text.WriteString("\n")
+		}
+	}
+
+	documentInfo := reader.Trailer().Key("Info")
+	return PageInfo{
+		Title:    strings.TrimSpace(documentInfo.Key("Title").Text()),
+		Summary:  strings.TrimSpace(documentInfo.Key("Subject").Text()),
+		BodyText: strings.TrimSpace(text.String()),
+	}, nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+// testPDF returns a PDF document showing the given content stream (Flate
+// compressed), with the given title in its document information
+func testPDF(t testing.TB, title, content string) []byte {
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatalf("compressing the PDF content: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("compressing the PDF content: %v", err)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.String()),
+		fmt.Sprintf("<< /Title %s /Producer (test) >>", title),
+	}
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
+
+func TestPDFExtractor(t *testing.T) {
+	content := `BT /F1 12 Tf 14 TL 72 712 Td (Widget \(ABC-1234\) datasheet) Tj
+		T* [(Hello) -300 ( world)] TJ
+		T* <536B75> Tj ET`
+	info, err := pdfExtractor{}.Extract(testPDF(t, `(Widget datasheet)`, content), "application/pdf")
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if info.Title != "Widget datasheet" {
+		t.Errorf("Title = %q, want %q", info.Title, "Widget datasheet")
+	}
+	want := "Widget (ABC-1234) datasheet\nHello world\nSku"
+	if info.BodyText != want {
+		t.Errorf("BodyText = %q, want %q", info.BodyText, want)
+	}
+
+	// UTF-16 title
+	info, err = pdfExtractor{}.Extract(testPDF(t, `<FEFF00C9007400E9>`, "BT (x) Tj ET"), "application/pdf")
+	if err != nil || info.Title != "Été" {
+		t.Errorf("Extract() = %q, %v, want title %q", info.Title, err, "Été")
+	}
+
+	if _, err := (pdfExtractor{}).Extract([]byte("<html></html>"), "application/pdf"); err == nil {
+		t.Errorf("Expected an error extracting a document that isn't a PDF")
+	}
+	// The malformed documents are errors (the PDF reader panics on some)
+	if _, err := (pdfExtractor{}).Extract([]byte("%PDF-1.4\n"), "application/pdf"); err == nil {
+		t.Errorf("Expected an error extracting a malformed PDF document")
+	}
+}
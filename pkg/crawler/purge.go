@@ -0,0 +1,149 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// PurgeSource purges the crawled data of a source (all of it with a zero
+// olderThan, otherwise the data of the pages not updated since olderThan)
+// and removes its screenshots from the image storage. The files that can't be
+// removed are logged, they don't fail the purge (the data is already gone).
+func PurgeSource(db cdb.Handler, sourceID uint64, olderThan time.Time) (cdb.PurgedData, error) {
+	purged, err := cdb.PurgeSource(&db, sourceID, olderThan)
+	if err != nil {
+		return purged, err
+	}
+	for _, file := range purged.Files {
+		if err := removeStoredFile(file, config.ImageStorageAPI); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "removing the stored file '%s' of source %d: %v", file, sourceID, err)
+		}
+	}
+	cmn.DebugMsg(cmn.DbgLvlInfo, "Purged source %d: %d pages removed, %d shared pages unlinked, %d files removed", sourceID, purged.Pages, purged.Unlinked, len(purged.Files))
+	return purged, nil
+}
+
+// removeStoredFile removes a file saved with the given storage configuration
+// (the link is the location returned when the file was saved)
+func removeStoredFile(link string, storageCfg cfg.FileStorageAPI) error {
+	if storageCfg.Host == "" {
+		return removeLocalFile(link, storageCfg.Path)
+	}
+	switch storageCfg.Type {
+	case cmn.HTTPStr:
+		return removeFileViaHTTP(link, storageCfg)
+	case "s3":
+		return removeFileFromS3(link, storageCfg)
+	default:
+		return errors.New("unsupported storage type")
+	}
+}
+
+// removeLocalFile removes a file of the local storage (only if it's in the
+// storage path, the links come from the database). A missing file isn't an
+// error.
+func removeLocalFile(filename, storagePath string) error {
+	rel, err := filepath.Rel(filepath.Clean(storagePath), filepath.Clean(filename))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("file is outside of the storage path '%s'", storagePath)
+	}
+	if err := os.Remove(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// removeFileViaHTTP asks the remote storage API to delete a file (a DELETE
+// request to its location, resolved against the API endpoint)
+func removeFileViaHTTP(location string, storageCfg cfg.FileStorageAPI) error {
+	protocol := cmn.HTTPStr
+	if storageCfg.SSLMode == cmn.EnableStr {
+		protocol = cmn.HTTPSStr
+	}
+	apiURL, err := url.Parse(fmt.Sprintf(protocol+"://%s:%d/"+storageCfg.Path, storageCfg.Host, storageCfg.Port))
+	if err != nil {
+		return err
+	}
+	fileURL, err := apiURL.Parse(location)
+	if err != nil {
+		return err
+	}
+	if cmn.IsDisallowedIP(fileURL.Hostname(), 1) {
+		return fmt.Errorf("host %s is not allowed", fileURL.Hostname())
+	}
+
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(storageCfg.Timeout, storageCfg.SSLMode),
+	}
+	req, err := http.NewRequest("DELETE", fileURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+storageCfg.Token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to delete file, status code: %d", resp.StatusCode)
+	}
+}
+
+// removeFileFromS3 deletes a file (an s3://bucket/key link) from its S3
+// bucket
+func removeFileFromS3(link string, storageCfg cfg.FileStorageAPI) error {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(link, "s3://"), "/")
+	if !strings.HasPrefix(link, "s3://") || !ok || bucket == "" || key == "" {
+		return fmt.Errorf("invalid S3 link '%s'", link)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(storageCfg.Region),
+		Credentials: credentials.NewStaticCredentials(storageCfg.Token, storageCfg.Secret, ""),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s3.New(sess).DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+func TestRemoveStoredFile(t *testing.T) {
+	storagePath := t.TempDir()
+	storageCfg := cfg.FileStorageAPI{Path: storagePath}
+	shot := filepath.Join(storagePath, "42", "shot.png")
+	if err := os.MkdirAll(filepath.Dir(shot), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(shot, []byte("png"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "other.png")
+	if err := os.WriteFile(outside, []byte("png"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeStoredFile(shot, storageCfg); err != nil {
+		t.Errorf("removeStoredFile(%q) error = %v", shot, err)
+	}
+	if _, err := os.Stat(shot); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected %q to be removed, got %v", shot, err)
+	}
+	// Already removed
+	if err := removeStoredFile(shot, storageCfg); err != nil {
+		t.Errorf("removeStoredFile(%q) of a missing file error = %v", shot, err)
+	}
+	for _, link := range []string{outside, storagePath, filepath.Join(storagePath, "..", "other.png")} {
+		if err := removeStoredFile(link, storageCfg); err == nil {
+			t.Errorf("removeStoredFile(%q) didn't fail for a file outside of the storage path", link)
+		}
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("Expected %q to be kept, got %v", outside, err)
+	}
+
+	s3Cfg := cfg.FileStorageAPI{Host: "s3.example.com", Type: "s3"}
+	for _, link := range []string{"bucket/key.png", "s3://bucket", "s3:///key.png"} {
+		if err := removeStoredFile(link, s3Cfg); err == nil {
+			t.Errorf("removeStoredFile(%q) didn't fail for an invalid S3 link", link)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+const (
+	robotsMaxBodySize = 500 * 1024 // robots.txt files are parsed up to 500 KiB (RFC 9309)
+	robotsFetchAgent  = "Mozilla/5.0 (compatible; TheCROWler)"
+)
+
+// robotsUserAgents are the product tokens the CROWler robots.txt groups are matched with
+var robotsUserAgents = []string{"thecrowler", "crowler"}
+
+// robotsCache is the robots.txt cache shared by all the crawls
+var robotsCache = NewRobotsCache()
+
+// robotsRule is an Allow or Disallow rule of a robots.txt group
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+// RobotsRules are the robots.txt rules that apply to the CROWler on a host
+type RobotsRules struct {
+	rules      []robotsRule
+	crawlDelay float64 // Crawl-delay in seconds (0 if not set)
+	fetchedAt  time.Time
+}
+
+// RobotsCache caches the robots.txt rules of each host (scheme and host), so
+// robots.txt is fetched once per TTL and not for every crawled URL. The
+// failed fetches (errors and 5xx responses) are cached for a short time, so
+// an unavailable host isn't asked for robots.txt on every URL.
+type RobotsCache struct {
+	mutex    sync.Mutex
+	entries  map[string]*RobotsRules
+	failures map[string]robotsFailure // The hosts whose robots.txt couldn't be fetched
+	fetches  singleflight.Group       // The robots.txt fetches in progress (one per host)
+	fetch    func(robotsURL string, timeout int, headers map[string]string) (int, []byte, error)
+}
+
+// robotsFailure is a failed robots.txt fetch
+type robotsFailure struct {
+	err      error
+	failedAt time.Time
+}
+
+// robotsFailureTTL is how long a failed robots.txt fetch is cached
+var robotsFailureTTL = time.Minute
+
+// NewRobotsCache returns an empty RobotsCache
+func NewRobotsCache() *RobotsCache {
+	return &RobotsCache{
+		entries:  make(map[string]*RobotsRules),
+		failures: make(map[string]robotsFailure),
+		fetch:    fetchRobots,
+	}
+}
+
+// Get returns the robots.txt rules of the host of pageURL, fetching them (with
+// the given request headers) if they aren't cached or have been cached more
+// than ttl ago. The concurrent requests of the same host share the same
+// fetch, the requests of other hosts don't wait for it.
+func (c *RobotsCache) Get(pageURL string, ttl time.Duration, timeout int, headers map[string]string) (*RobotsRules, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL '%s'", pageURL)
+	}
+	host := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	c.mutex.Lock()
+	if rules, ok := c.entries[host]; ok && time.Since(rules.fetchedAt) < ttl {
+		c.mutex.Unlock()
+		return rules, nil
+	}
+	if failure, ok := c.failures[host]; ok && time.Since(failure.failedAt) < robotsFailureTTL {
+		c.mutex.Unlock()
+		return nil, failure.err
+	}
+	c.mutex.Unlock()
+
+	rules, err, _ := c.fetches.Do(host, func() (interface{}, error) {
+		rules, err := c.fetchRules(host, timeout, headers)
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if err != nil {
+			c.failures[host] = robotsFailure{err: err, failedAt: time.Now()}
+			return nil, err
+		}
+		delete(c.failures, host)
+		c.entries[host] = rules
+		return rules, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules.(*RobotsRules), nil
+}
+
+// fetchRules fetches and parses the robots.txt rules of a host
+func (c *RobotsCache) fetchRules(host string, timeout int, headers map[string]string) (*RobotsRules, error) {
+	status, body, err := c.fetch(host+"/robots.txt", timeout, headers)
+	if err != nil {
+		return nil, err
+	}
+	var rules *RobotsRules
+	switch {
+	case status >= 200 && status < 300:
+		rules = parseRobots(body)
+	case status >= 500:
+		// The site may be temporarily unavailable, robots.txt is fetched again after robotsFailureTTL
+		return nil, fmt.Errorf("retrieving '%s/robots.txt': unexpected status code %d", host, status)
+	default:
+		// No robots.txt, everything is allowed
+		rules = &RobotsRules{}
+	}
+	rules.fetchedAt = time.Now()
+	return rules, nil
+}
+
+// fetchRobots retrieves a robots.txt file (redirects are followed)
+func fetchRobots(robotsURL string, timeout int, headers map[string]string) (int, []byte, error) {
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(timeout, "ignore"),
+		Timeout:   time.Duration(timeout) * time.Second,
+	}
+	req, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("retrieving '%s': %v", robotsURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, robotsMaxBodySize))
+	if err != nil {
+		return 0, nil, fmt.Errorf("reading '%s': %v", robotsURL, err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// parseRobots returns the rules of a robots.txt file that apply to the CROWler:
+// the ones of the groups naming the CROWler, or of the "*" groups if none does.
+func parseRobots(body []byte) *RobotsRules {
+	var own, wildcard RobotsRules
+	ownFound := false
+
+	var agents []string
+	inRules := false // Whether the current group has started listing its rules
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+			continue
+		}
+
+		inRules = true
+		for _, agent := range agents {
+			var dst *RobotsRules
+			switch {
+			case isRobotsUserAgent(agent):
+				dst = &own
+				ownFound = true
+			case agent == "*":
+				dst = &wildcard
+			default:
+				continue
+			}
+			switch key {
+			case "allow", "disallow":
+				if value != "" {
+					dst.rules = append(dst.rules, robotsRule{allow: key == "allow", path: value})
+				}
+			case "crawl-delay":
+				if delay, err := strconv.ParseFloat(value, 64); err == nil && delay > 0 {
+					dst.crawlDelay = delay
+				}
+			}
+		}
+	}
+
+	if ownFound {
+		return &own
+	}
+	return &wildcard
+}
+
+// isRobotsUserAgent returns true if a robots.txt user-agent names the CROWler
+func isRobotsUserAgent(agent string) bool {
+	for _, token := range robotsUserAgents {
+		if agent == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns true if the rules allow crawling pageURL. The longest
+// matching rule wins, with Allow winning over Disallow on a tie.
+func (r *RobotsRules) Allowed(pageURL string) bool {
+	path := "/"
+	if u, err := url.Parse(pageURL); err == nil {
+		path = u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+	}
+
+	allowed, matched := true, -1
+	for _, rule := range r.rules {
+		if !robotsPathMatch(rule.path, path) {
+			continue
+		}
+		if len(rule.path) > matched || (len(rule.path) == matched && rule.allow) {
+			allowed, matched = rule.allow, len(rule.path)
+		}
+	}
+	return allowed
+}
+
+// CrawlDelay returns the robots.txt Crawl-delay (in seconds, 0 if not set)
+func (r *RobotsRules) CrawlDelay() float64 {
+	return r.crawlDelay
+}
+
+// robotsPathMatch returns true if path matches a robots.txt rule pattern
+// ("*" matches any sequence of characters and a trailing "$" the path end)
+func robotsPathMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	if len(parts) == 1 {
+		return !anchored || path == parts[0]
+	}
+
+	pos := len(parts[0])
+	last := len(parts) - 1
+	for _, part := range parts[1:last] {
+		i := strings.Index(path[pos:], part)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(part)
+	}
+	if anchored {
+		return len(path)-len(parts[last]) >= pos && strings.HasSuffix(path, parts[last])
+	}
+	return strings.Contains(path[pos:], parts[last])
+}
+
+// robotsRules returns the robots.txt rules of the host of pageURL (nil if the
+// crawl doesn't respect robots.txt or the rules can't be retrieved)
+func (ctx *ProcessContext) robotsRules(pageURL string) *RobotsRules {
+	if !ctx.config.Crawler.CheckForRobots {
+		return nil
+	}
+	ttl := time.Duration(ctx.config.Crawler.RobotsCacheTTL) * time.Minute
+	rules, err := robotsCache.Get(pageURL, ttl, ctx.config.Crawler.Timeout, requestHeaders(&ctx.config.Crawler, robotsFetchAgent))
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "retrieving robots.txt for '%s': %v", pageURL, err)
+		return nil
+	}
+	return rules
+}
+
+// robotsAllowed returns true if robots.txt allows crawling pageURL
+func (ctx *ProcessContext) robotsAllowed(pageURL string) bool {
+	rules := ctx.robotsRules(pageURL)
+	return rules == nil || rules.Allowed(pageURL)
+}
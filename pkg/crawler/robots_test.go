@@ -0,0 +1,171 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRobotsRules(t *testing.T) {
+	robots := []byte(`
+# Comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Crawl-delay: 2
+
+User-agent: Googlebot
+Disallow: /
+
+User-agent: TheCROWler
+User-agent: other
+Disallow: /tmp/
+Disallow: /*.pdf$
+Allow: /tmp/keep
+Crawl-delay: 7.5
+`)
+	rules := parseRobots(robots)
+	if rules.CrawlDelay() != 7.5 {
+		t.Errorf("CrawlDelay() = %v, want 7.5", rules.CrawlDelay())
+	}
+	tests := map[string]bool{
+		"https://example.com/":                true,
+		"https://example.com/private/x.html":  true, // Only disallowed for the other user-agents
+		"https://example.com/tmp/x.html":      false,
+		"https://example.com/tmp/keep/x.html": true,
+		"https://example.com/docs/file.pdf":   false,
+		"https://example.com/docs/file.pdf?x": true,
+	}
+	for pageURL, want := range tests {
+		if got := rules.Allowed(pageURL); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", pageURL, got, want)
+		}
+	}
+
+	// Without a CROWler group the "*" group applies
+	rules = parseRobots([]byte("User-agent: *\nDisallow: /private/\nAllow: /private/public.html\nCrawl-delay: 2\n"))
+	if rules.CrawlDelay() != 2 {
+		t.Errorf("CrawlDelay() = %v, want 2", rules.CrawlDelay())
+	}
+	if rules.Allowed("https://example.com/private/x.html") {
+		t.Errorf("Allowed(/private/x.html) = true, want false")
+	}
+	if !rules.Allowed("https://example.com/private/public.html") {
+		t.Errorf("Allowed(/private/public.html) = false, want true")
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	fetches := 0
+	status := http.StatusOK
+	cache := NewRobotsCache()
+	cache.fetch = func(robotsURL string, _ int, _ map[string]string) (int, []byte, error) {
+		fetches++
+		if robotsURL != "https://example.com/robots.txt" {
+			t.Errorf("fetched %q, want https://example.com/robots.txt", robotsURL)
+		}
+		return status, []byte("User-agent: *\nDisallow: /private/\n"), nil
+	}
+
+	for _, pageURL := range []string{"https://example.com/", "https://example.com/private/x"} {
+		if _, err := cache.Get(pageURL, time.Hour, 5, nil); err != nil {
+			t.Fatalf("Get(%q) error = %v", pageURL, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("robots.txt fetched %d times within the TTL, want 1", fetches)
+	}
+
+	// Expired entries are fetched again (a missing robots.txt allows everything)
+	status = http.StatusNotFound
+	rules, err := cache.Get("https://example.com/private/x", 0, 5, nil)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if fetches != 2 {
+		t.Errorf("robots.txt fetched %d times after the TTL, want 2", fetches)
+	}
+	if !rules.Allowed("https://example.com/private/x") {
+		t.Errorf("Allowed() = false without a robots.txt, want true")
+	}
+
+	// Server errors are cached for a short time only
+	status = http.StatusServiceUnavailable
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Get("https://example.com/", 0, 5, nil); err == nil {
+			t.Errorf("Get() error = nil on a server error")
+		}
+	}
+	if fetches != 3 {
+		t.Errorf("robots.txt fetched %d times after a server error, want 3", fetches)
+	}
+	savedTTL := robotsFailureTTL
+	robotsFailureTTL = 0
+	defer func() { robotsFailureTTL = savedTTL }()
+	status = http.StatusOK
+	if _, err := cache.Get("https://example.com/", 0, 5, nil); err != nil || fetches != 4 {
+		t.Errorf("Get() = %v after the failure expired, robots.txt fetched %d times, want 4", err, fetches)
+	}
+}
+
+func TestRobotsCacheConcurrentFetches(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	cache := NewRobotsCache()
+	cache.fetch = func(robotsURL string, _ int, _ map[string]string) (int, []byte, error) {
+		fetches.Add(1)
+		if robotsURL == "https://slow.example.com/robots.txt" {
+			<-release
+		}
+		return http.StatusOK, []byte("User-agent: *\nDisallow: /private/\n"), nil
+	}
+
+	// The requests of a host share its fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get("https://slow.example.com/", time.Hour, 5, nil); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+		}()
+	}
+
+	// The other hosts don't wait for it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cache.Get("https://fast.example.com/", time.Hour, 5, nil); err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected the robots.txt of a host not to wait for the fetch of another host")
+	}
+
+	time.Sleep(50 * time.Millisecond) // Let the requests of the slow host join its fetch
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2 (once per host)", n)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+const (
+	traceActionRule   = "action"
+	traceScrapingRule = "scraping"
+
+	traceResultOK      = "ok"
+	traceResultError   = "error"
+	traceResultSkipped = "skipped" // The rule conditions were not met
+
+	traceMaxDataLength = 1024 // Maximum length of the scraped data recorded per step
+)
+
+// TraceEvent represents a single step (a rule execution attempt) of a rules
+// execution trace.
+type TraceEvent struct {
+	Seq        int       `json:"seq"`                   // The position of the step in the trace.
+	Time       time.Time `json:"time"`                  // When the step started.
+	URL        string    `json:"url,omitempty"`         // The page the rule was executed on.
+	RuleType   string    `json:"rule_type"`             // "action" or "scraping".
+	RuleName   string    `json:"rule_name"`             // The name of the rule.
+	ActionType string    `json:"action_type,omitempty"` // The action type (action rules only).
+	Selectors  []string  `json:"selectors,omitempty"`   // The rule selectors.
+	Elements   []string  `json:"elements,omitempty"`    // The elements found (the selector used and the element tag).
+	Result     string    `json:"result"`                // "ok", "error" or "skipped".
+	Data       string    `json:"data,omitempty"`        // The scraped data (scraping rules only).
+	Error      string    `json:"error,omitempty"`       // The error returned by the rule (if any).
+	DurationMs float64   `json:"duration_ms"`           // How long the step took (in milliseconds).
+}
+
+// RulesTrace records the step-by-step execution of the action and scraping
+// rules on a Source, to debug misbehaving rulesets. All its methods are
+// no-ops on a nil *RulesTrace (tracing disabled).
+type RulesTrace struct {
+	SourceID  uint64       `json:"source_id"`
+	SourceURL string       `json:"source_url"`
+	StartTime time.Time    `json:"start_time"`
+	Events    []TraceEvent `json:"events"`
+
+	mutex   sync.Mutex
+	current int // The step in progress (-1 if none)
+}
+
+// newRulesTrace returns an empty rules execution trace for the given Source
+func newRulesTrace(src *cdb.Source) *RulesTrace {
+	return &RulesTrace{
+		SourceID:  src.ID,
+		SourceURL: src.URL,
+		StartTime: time.Now(),
+		Events:    []TraceEvent{},
+		current:   -1,
+	}
+}
+
+// begin records the start of a rule execution attempt and returns the step ID
+func (t *RulesTrace) begin(ruleType, ruleName, actionType string, selectors []rules.Selector, wd *vdi.WebDriver) int {
+	if t == nil {
+		return -1
+	}
+
+	ev := TraceEvent{
+		Time:       time.Now(),
+		RuleType:   ruleType,
+		RuleName:   ruleName,
+		ActionType: actionType,
+	}
+	if wd != nil && *wd != nil {
+		ev.URL, _ = (*wd).CurrentURL()
+	}
+	for _, s := range selectors {
+		ev.Selectors = append(ev.Selectors, s.SelectorType+":"+s.Selector)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ev.Seq = len(t.Events) + 1
+	t.Events = append(t.Events, ev)
+	t.current = len(t.Events) - 1
+	return t.current
+}
+
+// element records an element found while executing the current step
+func (t *RulesTrace) element(selector rules.Selector, e vdi.WebElement) {
+	if t == nil {
+		return
+	}
+
+	desc := selector.SelectorType + ":" + selector.Selector
+	if e != nil {
+		if tag, err := e.TagName(); err == nil && tag != "" {
+			desc += " <" + tag + ">"
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.current >= 0 {
+		t.Events[t.current].Elements = append(t.Events[t.current].Elements, desc)
+	}
+}
+
+// end records the outcome of a rule execution attempt
+func (t *RulesTrace) end(step int, result, data string, err error) {
+	if t == nil || step < 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if step >= len(t.Events) {
+		return
+	}
+	ev := &t.Events[step]
+	ev.DurationMs = float64(time.Since(ev.Time).Microseconds()) / 1000
+	ev.Result = result
+	ev.Data = strLeft(data, traceMaxDataLength)
+	if err != nil {
+		ev.Result = traceResultError
+		ev.Error = err.Error()
+	}
+	if t.current == step {
+		t.current = -1
+	}
+}
+
+// save writes the trace as a JSON file (one per Source) in the given directory
+func (t *RulesTrace) save(dir string) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	data, err := json.MarshalIndent(t, "", "  ")
+	t.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("marshalling rules trace: %v", err)
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("creating rules trace directory: %v", err)
+	}
+	path := rulesTraceFile(dir, t.SourceID)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("saving rules trace to '%s': %v", path, err)
+	}
+	return nil
+}
+
+// scrapingRuleSelectors returns the selectors of all the elements of a ScrapingRule
+func scrapingRuleSelectors(r *rules.ScrapingRule) []rules.Selector {
+	var selectors []rules.Selector
+	for _, e := range r.Elements {
+		selectors = append(selectors, e.Selectors...)
+	}
+	return selectors
+}
+
+// rulesTraceFile returns the file used to save the rules trace of a Source
+func rulesTraceFile(dir string, sourceID uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("trace-%d.json", sourceID))
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestRulesTrace(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	src := &cdb.Source{ID: 42, URL: testFQDN}
+	ctx := &ProcessContext{SelID: 1, source: src, Status: &Status{}}
+
+	username := &mockWebElement{tag: "input"}
+	var wd vdi.WebDriver = &mockWebDriver{
+		pages:    []string{"<div>price: 42</div>"},
+		elements: map[string][]vdi.WebElement{"#username": {username}},
+	}
+
+	actions := []rules.ActionRule{
+		{RuleName: "Open login", ActionType: "navigate_to_url", Value: testFQDN + "login"},
+		{RuleName: "Clear username", ActionType: "clear", Selectors: []rules.Selector{{SelectorType: "css", Selector: "#username"}}},
+		{RuleName: "Clear password", ActionType: "clear", Selectors: []rules.Selector{{SelectorType: "css", Selector: "#password"}}},
+		{RuleName: "Dance", ActionType: "dance"},
+	}
+	scraping := rules.ScrapingRule{
+		RuleName: "Price",
+		Elements: []rules.Element{
+			{Key: "price", Selectors: []rules.Selector{{SelectorType: "regex", Selector: `price: (\d+)`}}},
+		},
+	}
+
+	// Tracing is disabled by default
+	executeActionRules(ctx, actions[:1], &wd)
+	if ctx.trace != nil {
+		t.Fatalf("Expected no trace when tracing is disabled")
+	}
+
+	ctx.trace = newRulesTrace(src)
+	executeActionRules(ctx, actions, &wd)
+	if _, err := executeScrapingRule(ctx, &scraping, &wd); err != nil {
+		t.Fatalf("Unexpected scraping error: %v", err)
+	}
+	if len(username.calls) != 1 {
+		t.Errorf("Expected the username field to be cleared once, got %v", username.calls)
+	}
+
+	dir := t.TempDir()
+	if err := ctx.trace.save(dir); err != nil {
+		t.Fatalf("Failed to save the trace: %v", err)
+	}
+	data, err := os.ReadFile(rulesTraceFile(dir, src.ID))
+	if err != nil {
+		t.Fatalf("Failed to read the trace: %v", err)
+	}
+	var trace RulesTrace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("Failed to parse the trace: %v", err)
+	}
+
+	expected := []struct {
+		rule     string
+		result   string
+		elements []string
+		data     string
+	}{
+		{"Open login", traceResultOK, nil, ""},
+		{"Clear username", traceResultOK, []string{"css:#username <input>"}, ""},
+		{"Clear password", traceResultError, nil, ""},
+		{"Dance", traceResultError, nil, ""},
+		{"Price", traceResultOK, nil, `"price":42`},
+	}
+	if trace.SourceID != src.ID || len(trace.Events) != len(expected) {
+		t.Fatalf("Expected %d steps for source %d, got %d for source %d", len(expected), src.ID, len(trace.Events), trace.SourceID)
+	}
+	for i, want := range expected {
+		ev := trace.Events[i]
+		if ev.Seq != i+1 || ev.RuleName != want.rule || ev.Result != want.result || ev.Data != want.data {
+			t.Errorf("Step %d: expected %s (%s, data %q), got %+v", i+1, want.rule, want.result, want.data, ev)
+		}
+		if !reflect.DeepEqual(ev.Elements, want.elements) {
+			t.Errorf("Step %d: expected elements %v, got %v", i+1, want.elements, ev.Elements)
+		}
+		if ev.URL != testFQDN || ev.Time.IsZero() {
+			t.Errorf("Step %d: expected the page URL and start time to be recorded, got %+v", i+1, ev)
+		}
+		if want.result == traceResultError && ev.Error == "" {
+			t.Errorf("Step %d: expected the error to be recorded", i+1)
+		}
+	}
+	if trace.Events[1].RuleType != traceActionRule || trace.Events[1].ActionType != "clear" ||
+		!reflect.DeepEqual(trace.Events[1].Selectors, []string{"css:#username"}) {
+		t.Errorf("Expected the action details to be recorded, got %+v", trace.Events[1])
+	}
+	if trace.Events[4].RuleType != traceScrapingRule {
+		t.Errorf("Expected a scraping step, got %+v", trace.Events[4])
+	}
+}
@@ -57,8 +57,11 @@ func ApplyRule(ctx *ProcessContext, rule *rs.ScrapingRule, webPage *vdi.WebDrive
 		for i := 0; i < len(selectors); i++ {
 			getAllOccurrences := selectors[i].ExtractAllOccurrences
 
+			// Resolve references to values extracted by previous rules (if any)
+			selector := resolveSelectorVars(ctx, selectors[i])
+
 			// Try to find and extract the data from the web page
-			extracted := extractContent(ctx, webPage, selectors[i], getAllOccurrences)
+			extracted := extractContent(ctx, webPage, selector, getAllOccurrences)
 
 			// Check if there was data extracted and append it to the allExtracted slice
 			if len(extracted) > 0 {
@@ -118,6 +121,28 @@ func ApplyRule(ctx *ProcessContext, rule *rs.ScrapingRule, webPage *vdi.WebDrive
 			}
 		}
 
+		// Apply the rule's not-found policy if no selector matched
+		if len(allExtracted) == 0 {
+			switch rule.GetNotFoundPolicy() {
+			case rs.NotFoundNull:
+				extractedData[key] = nil
+			case rs.NotFoundOmit:
+				cmn.DebugMsg(cmn.DbgLvlDebug3, "element '%s' not found, omitting it", key)
+			case rs.NotFoundDefault:
+				extractedData[key] = rule.NotFound.Default
+			case rs.NotFoundError:
+				ErrorState = true
+				if ErrorMsg != "" {
+					ErrorMsg += "; "
+				}
+				ErrorMsg += "element '" + key + "' not found"
+				cmn.DebugMsg(cmn.DbgLvlError, "element '%s' not found, with not_found policy set to '%s'", key, rs.NotFoundError)
+			default:
+				extractedData[key] = []interface{}{}
+			}
+			continue
+		}
+
 		// Add the extracted data to the WebObject's map
 		if len(allExtracted) == 1 {
 			// If only one result, store it directly (as an object or string)
@@ -128,6 +153,28 @@ func ApplyRule(ctx *ProcessContext, rule *rs.ScrapingRule, webPage *vdi.WebDrive
 		}
 	}
 
+	// Follow the item links (if this is a listing page) and scrape the detail pages
+	if rule.HasDetailPages() {
+		items, err := scrapeDetailPages(ctx, rule, webPage)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "scraping detail pages of rule '%s': %v", rule.RuleName, err)
+			errContainer = append(errContainer, err)
+		}
+		if items != nil {
+			extractedData[detailPagesKey(rule)] = items
+		}
+	}
+
+	// Record the totals of the paginated listing (if any) and what has been collected
+	if rule.HasPagination() {
+		if metadata := paginationMetadata(ctx, rule, webPage, extractedData); metadata != nil {
+			extractedData[paginationKey(rule)] = metadata
+		}
+	}
+
+	// Make the named outputs available to the rules that follow
+	storeRuleOutputs(ctx, rule, extractedData)
+
 	// Optional: Extract JavaScript files if required
 	if rule.JsFiles {
 		jsFiles := extractJSFiles(webPage)
@@ -155,6 +202,55 @@ func ApplyRule(ctx *ProcessContext, rule *rs.ScrapingRule, webPage *vdi.WebDrive
 	return extractedData, nil
 }
 
+// resolveSelectorVars returns a copy of the selector where every ${name}
+// reference has been replaced with the value stored in the KV store for the
+// current context (usually a value extracted by a previous scraping rule).
+func resolveSelectorVars(ctx *ProcessContext, selector rs.Selector) rs.Selector {
+	ctxID := ctx.GetContextID()
+	selector.Selector = cmn.KVStore.Interpolate(selector.Selector, ctxID)
+	selector.Value = cmn.KVStore.Interpolate(selector.Value, ctxID)
+	selector.Attribute.Value = cmn.KVStore.Interpolate(selector.Attribute.Value, ctxID)
+	selector.Extract.Pattern = cmn.KVStore.Interpolate(selector.Extract.Pattern, ctxID)
+	selector.ResolvedValue = selector.Value
+	return selector
+}
+
+// storeRuleOutputs saves the values extracted for the elements that have an
+// output name in the KV store, so later rules can reference them as ${name}.
+func storeRuleOutputs(ctx *ProcessContext, rule *rs.ScrapingRule, extractedData map[string]interface{}) {
+	for _, element := range rule.Elements {
+		name := strings.TrimSpace(element.Output)
+		if name == "" {
+			continue
+		}
+
+		var value interface{}
+		switch v := extractedData[element.Key].(type) {
+		case string:
+			value = v
+		case []interface{}:
+			if len(v) == 0 {
+				continue
+			}
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				values = append(values, fmt.Sprintf("%v", item))
+			}
+			value = values
+		default:
+			continue
+		}
+
+		err := cmn.KVStore.Set(name, value, cmn.Properties{
+			Source: rule.RuleName,
+			CtxID:  ctx.GetContextID(),
+		})
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "storing output '%s' of rule '%s': %v", name, rule.RuleName, err)
+		}
+	}
+}
+
 // extractJSFiles extracts the JavaScript files from the current page.
 func extractJSFiles(wd *vdi.WebDriver) []CollectedScript {
 	var jsFiles []CollectedScript
@@ -699,6 +795,8 @@ func ApplyPostProcessingStep(ctx *ProcessContext, step *rs.PostProcessingStep, d
 		ppStepClean(data, step)
 	case "set_env":
 		ppStepSetEnv(ctx, step, data)
+	case "map":
+		ppStepMap(data, step)
 	case strPluginCall:
 		ppStepPluginCall(ctx, step, data)
 	default:
@@ -848,6 +946,229 @@ func ppStepClean(data *[]byte, step *rs.PostProcessingStep) {
 	}
 }
 
+// ppStepMap applies the "map" post-processing step to the provided data.
+// It projects the scraped JSON document into a flat record with the fields
+// listed in step.Details["fields"]; each field has a "source" (a dot separated
+// path in the document, array elements are selected by index), an optional
+// "name" (the last element of the source by default), a "type" (string,
+// integer, number, boolean or list) and an optional "default" value, used when
+// the source is missing or can't be converted. If step.Details["record"] is set
+// the record is returned under that key.
+func ppStepMap(data *[]byte, step *rs.PostProcessingStep) {
+	var doc interface{}
+	if err := json.Unmarshal(*data, &doc); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Error unmarshalling data: %v", err)
+		return
+	}
+	record, err := mapRecord(doc, step.Details)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Error mapping data: %v", err)
+		return
+	}
+
+	var output interface{} = record
+	if name, ok := step.Details["record"].(string); ok && strings.TrimSpace(name) != "" {
+		output = map[string]interface{}{strings.TrimSpace(name): record}
+	}
+	mapped, err := json.Marshal(output)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "Error marshalling mapped data: %v", err)
+		return
+	}
+	*data = mapped
+}
+
+// mapRecord returns the record described by the "fields" of a "map" step
+// details. Every field is present in the record (null if there is no value).
+func mapRecord(doc interface{}, details map[string]interface{}) (map[string]interface{}, error) {
+	fields, ok := details["fields"].([]interface{})
+	if !ok || len(fields) == 0 {
+		return nil, errors.New("the map step requires a list of fields")
+	}
+
+	record := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		field := toStringMap(f)
+		source, _ := field["source"].(string)
+		source = strings.TrimSpace(source)
+		if source == "" {
+			return nil, fmt.Errorf("map field without source: %v", f)
+		}
+		name, _ := field["name"].(string)
+		if strings.TrimSpace(name) == "" {
+			name = source[strings.LastIndex(source, ".")+1:]
+		}
+		fieldType, _ := field["type"].(string)
+
+		record[name] = field["default"]
+		value, found := lookupJSONPath(doc, source)
+		if !found {
+			continue
+		}
+		converted, err := convertMappedValue(value, fieldType)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "Field '%s' can't be mapped to '%s': %v", source, name, err)
+			continue
+		}
+		record[name] = converted
+	}
+	return record, nil
+}
+
+// toStringMap returns a map field of a step details (JSON and YAML rulesets
+// decode maps differently)
+func toStringMap(value interface{}) map[string]interface{} {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		return cmn.ConvertInfMapToStrMap(m)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// lookupJSONPath returns the value at a dot separated path of a JSON document
+func lookupJSONPath(doc interface{}, path string) (interface{}, bool) {
+	value := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			value = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			value = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+// convertMappedValue converts a scraped value to the type of a mapped field.
+// The scalar types use the first element of the (usually single element)
+// arrays returned by the selectors.
+func convertMappedValue(value interface{}, fieldType string) (interface{}, error) {
+	fieldType = strings.ToLower(strings.TrimSpace(fieldType))
+	if fieldType == "list" {
+		if list, ok := value.([]interface{}); ok {
+			return list, nil
+		}
+		return []interface{}{value}, nil
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		if len(list) == 0 {
+			return nil, errors.New("empty value")
+		}
+		value = list[0]
+	}
+	switch fieldType {
+	case "", "string":
+		switch v := value.(type) {
+		case string:
+			return strings.TrimSpace(v), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case map[string]interface{}:
+			text, err := json.Marshal(v)
+			return string(text), err
+		default:
+			return fmt.Sprint(v), nil
+		}
+	case "integer", "number":
+		var number float64
+		switch v := value.(type) {
+		case float64:
+			number = v
+		case bool:
+			if v {
+				number = 1
+			}
+		case string:
+			n, err := strconv.ParseFloat(cleanNumber(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a number", v)
+			}
+			number = n
+		default:
+			return nil, fmt.Errorf("%T is not a number", v)
+		}
+		if fieldType == "integer" {
+			return int64(number), nil
+		}
+		return number, nil
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			return v != 0, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "true", "yes", "y", "on", "1":
+				return true, nil
+			case "false", "no", "n", "off", "0", "":
+				return false, nil
+			}
+			return nil, fmt.Errorf("'%s' is not a boolean", v)
+		default:
+			return nil, fmt.Errorf("%T is not a boolean", v)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type '%s'", fieldType)
+	}
+}
+
+// cleanNumber removes the currency symbols, the thousands separators and the
+// other text around a number, in the English ("$ 1,299.00") or European
+// ("1.299,00 €") format, returning it with a dot as the decimal separator
+// ("1299.00"). The decimal separator is the last of the dot and the comma
+// when the number has both. Otherwise a repeated separator groups the
+// thousands ("1.234.567"), and so does a single comma followed by three
+// digits ("1,234" is 1234, while "1,5" is 1.5): a single dot is always the
+// decimal separator ("1.234" is 1.234).
+func cleanNumber(value string) string {
+	var number strings.Builder
+	for _, r := range value {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' || r == '-' {
+			number.WriteRune(r)
+		}
+	}
+	n := strings.TrimRight(number.String(), ".,")
+
+	decimal := ""
+	dot, comma := strings.LastIndex(n, "."), strings.LastIndex(n, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		decimal = n[max(dot, comma) : max(dot, comma)+1]
+	case dot >= 0:
+		if strings.Count(n, ".") == 1 {
+			decimal = "."
+		}
+	case comma >= 0:
+		if strings.Count(n, ",") == 1 && len(n)-comma-1 != 3 {
+			decimal = ","
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case string(r) == decimal:
+			return '.'
+		case r == '.' || r == ',':
+			return -1
+		}
+		return r
+	}, n)
+}
+
 func stripHTML(data string) string {
 	re := regexp.MustCompile(`<[^>]*>`)
 	return re.ReplaceAllString(data, "")
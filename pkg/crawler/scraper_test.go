@@ -17,12 +17,20 @@
 package crawler
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
 	rs "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
 )
 
 const (
@@ -155,3 +163,531 @@ func TestFindRulesForSite(t *testing.T) {
 		})
 	}
 }
+
+func TestChainScrapedValuesBetweenRules(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 7}}
+
+	// Rule A extracts a product ID and exports it as "product_id"
+	ruleA := rs.ScrapingRule{
+		RuleName: "RuleA",
+		Elements: []rs.Element{
+			{Key: "id", Output: "product_id"},
+			{Key: "title"},
+		},
+	}
+	storeRuleOutputs(ctx, &ruleA, map[string]interface{}{
+		"id":    "12345",
+		"title": "A product",
+	})
+
+	// Rule B uses the product ID in its selector
+	ruleB := rs.ScrapingRule{
+		RuleName: "RuleB",
+		Elements: []rs.Element{
+			{
+				Key: "reviews",
+				Selectors: []rs.Selector{
+					{SelectorType: "css", Selector: "#product-${product_id} .reviews", Value: "${product_id}"},
+				},
+			},
+		},
+	}
+	selector := resolveSelectorVars(ctx, ruleB.Elements[0].Selectors[0])
+	if selector.Selector != "#product-12345 .reviews" {
+		t.Errorf("Expected selector '#product-12345 .reviews', got '%s'", selector.Selector)
+	}
+	if selector.ResolvedValue != "12345" {
+		t.Errorf("Expected resolved value '12345', got '%s'", selector.ResolvedValue)
+	}
+	// The original rule must not be modified
+	if ruleB.Elements[0].Selectors[0].Selector != "#product-${product_id} .reviews" {
+		t.Errorf("Original selector was modified: '%s'", ruleB.Elements[0].Selectors[0].Selector)
+	}
+
+	// Elements without an output name must not be exported
+	if _, _, err := cmn.KVStore.Get("title", ctx.GetContextID()); err == nil {
+		t.Errorf("Expected 'title' not to be stored in the KV store")
+	}
+
+	// Values are scoped to the context that extracted them
+	other := &ProcessContext{SelID: 2, source: &cdb.Source{ID: 7}}
+	selector = resolveSelectorVars(other, ruleB.Elements[0].Selectors[0])
+	if selector.Selector != "#product-${product_id} .reviews" {
+		t.Errorf("Expected unresolved selector for a different context, got '%s'", selector.Selector)
+	}
+}
+
+func TestShouldExecuteScrapingRuleWithDataConditions(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 9}}
+
+	err := cmn.KVStore.Set("product_id", "12345", cmn.Properties{CtxID: ctx.GetContextID()})
+	if err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		conditions map[string]interface{}
+		expected   bool
+	}{
+		{"ExecuteIfPresent", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "product_id"},
+		}, true},
+		{"SkipIfAbsent", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "reviews_url"},
+		}, false},
+		{"ExecuteIfAbsent", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "reviews_url", "exists": false},
+		}, true},
+		{"SkipIfPresentButMustBeAbsent", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "product_id", "exists": false},
+		}, false},
+		{"Equals", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "product_id", "equals": "12345"},
+		}, true},
+		{"NotEquals", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "product_id", "equals": "54321"},
+		}, false},
+		{"Matches", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "product_id", "matches": "^[0-9]+$"},
+		}, true},
+		{"DoesNotMatch", map[string]interface{}{
+			"data": map[string]interface{}{"variable": "product_id", "matches": "^[a-z]+$"},
+		}, false},
+		{"MissingVariableName", map[string]interface{}{
+			"data": map[string]interface{}{"equals": "12345"},
+		}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := rs.ScrapingRule{RuleName: tc.name, Conditions: tc.conditions}
+			result := shouldExecuteScrapingRule(ctx, &r, nil)
+			if result != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestPrepareScrapedData(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		expected string
+		isError  bool
+	}{
+		{"Valid", `"title":"Hello", "price": 10`, `"price":10,"title":"Hello"`, false},
+		{"Invalid", `"title":"Hello", price: 10`, "", true},
+		{"Empty", "", "", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := prepareScrapedData("test", tc.doc)
+			if (err != nil) != tc.isError {
+				t.Fatalf("Unexpected error result: %v", err)
+			}
+			if result != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestExecuteScrapingRuleRetry(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 7}}
+
+	rule := rs.ScrapingRule{
+		RuleName: "Price",
+		Elements: []rs.Element{
+			{
+				Key:      "price",
+				Critical: true,
+				Selectors: []rs.Selector{
+					{SelectorType: "regex", Selector: `price: (\d+)`},
+				},
+			},
+		},
+	}
+
+	// Without retries the rule fails, as the element appears late
+	var wd vdi.WebDriver = &mockWebDriver{pages: []string{"<div>loading...</div>", "<div>price: 42</div>"}}
+	_, err := executeScrapingRule(ctx, &rule, &wd)
+	if err == nil {
+		t.Errorf("Expected an error without retries, got nil")
+	}
+
+	// With retries the rule succeeds on the second attempt
+	rule.ErrorHandling = rs.ErrorHandling{RetryCount: 2}
+	mock := &mockWebDriver{pages: []string{"<div>loading...</div>", "<div>price: 42</div>"}}
+	wd = mock
+	data, err := executeScrapingRule(ctx, &rule, &wd)
+	if err != nil {
+		t.Fatalf("Expected no error after retry, got %v", err)
+	}
+	if data != `"price":42` {
+		t.Errorf("Expected scraped price, got %q", data)
+	}
+	if len(mock.calls) != 2 {
+		t.Errorf("Expected 2 attempts, got %d (%v)", len(mock.calls), mock.calls)
+	}
+
+	// With ignore set the error is not returned
+	rule.ErrorHandling = rs.ErrorHandling{Ignore: true}
+	wd = &mockWebDriver{pages: []string{"<div>loading...</div>"}}
+	if _, err := executeScrapingRule(ctx, &rule, &wd); err != nil {
+		t.Errorf("Expected error to be ignored, got %v", err)
+	}
+}
+
+func TestApplyRuleNotFoundPolicy(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 7}}
+
+	tests := []struct {
+		policy   rs.NotFoundPolicy
+		expected string
+		wantErr  bool
+	}{
+		{rs.NotFoundPolicy{}, `"price":42,"stock":[]`, false},
+		{rs.NotFoundPolicy{Policy: rs.NotFoundEmpty}, `"price":42,"stock":[]`, false},
+		{rs.NotFoundPolicy{Policy: rs.NotFoundNull}, `"price":42,"stock":null`, false},
+		{rs.NotFoundPolicy{Policy: rs.NotFoundOmit}, `"price":42`, false},
+		{rs.NotFoundPolicy{Policy: rs.NotFoundDefault, Default: "unknown"}, `"price":42,"stock":"unknown"`, false},
+		{rs.NotFoundPolicy{Policy: rs.NotFoundError}, `"price":42`, true},
+	}
+
+	for _, test := range tests {
+		rule := rs.ScrapingRule{
+			RuleName: "Product",
+			Elements: []rs.Element{
+				{Key: "price", Selectors: []rs.Selector{{SelectorType: "regex", Selector: `price: (\d+)`}}},
+				{Key: "stock", Selectors: []rs.Selector{{SelectorType: "regex", Selector: `stock: (\d+)`}}},
+			},
+			NotFound: test.policy,
+		}
+		var wd vdi.WebDriver = &mockWebDriver{pages: []string{"<div>price: 42</div>"}}
+		data, err := executeScrapingRule(ctx, &rule, &wd)
+		if test.wantErr && err == nil {
+			t.Errorf("Policy %q: expected an error, got nil", test.policy.Policy)
+		}
+		if !test.wantErr && err != nil {
+			t.Errorf("Policy %q: unexpected error: %v", test.policy.Policy, err)
+		}
+		if data != test.expected {
+			t.Errorf("Policy %q: expected %q, got %q", test.policy.Policy, test.expected, data)
+		}
+	}
+}
+
+// detailSite is a VDI session on a site whose pages are served with the given
+// status codes (200 by default)
+type detailSite struct {
+	*mockWebDriver
+	status map[string]int
+}
+
+func (s *detailSite) ExecuteScript(script string, _ []interface{}) (interface{}, error) {
+	if strings.Contains(script, "responseStatus") {
+		if code, ok := s.status[s.url]; ok {
+			return float64(code), nil
+		}
+		return float64(200), nil
+	}
+	return nil, errors.New("script not supported")
+}
+
+func (s *detailSite) GetCookies() ([]vdi.Cookie, error) {
+	return nil, nil
+}
+
+func TestScrapeDetailPages(t *testing.T) {
+	savedSleep := vdiMinSleep
+	defer func() { vdiMinSleep = savedSleep }()
+	vdiMinSleep = 0
+
+	cmn.KVStore = cmn.NewKeyValueStore()
+	schema, err := rs.LoadSchema("../../schemas/ruleset-schema.json")
+	if err != nil {
+		t.Fatalf("Failed to load the ruleset schema: %v", err)
+	}
+	rulesets, err := rs.BulkLoadRules(schema, "./test_data/list-detail/ruleset.yaml")
+	if err != nil || len(rulesets) != 1 {
+		t.Fatalf("Failed to load the list-detail ruleset: %v", err)
+	}
+	re := &rs.RuleEngine{Rulesets: rulesets}
+
+	listingURL := "https://www.google.com/products"
+	site := make(map[string]string)
+	for url, file := range map[string]string{
+		listingURL:                          "listing.html",
+		"https://www.google.com/products/1": "product-1.html",
+		"https://www.google.com/products/2": "product-2.html",
+		"https://www.google.com/products/3": "product-3.html",
+	} {
+		page, err := os.ReadFile("./test_data/list-detail/" + file)
+		if err != nil {
+			t.Fatalf("Failed to read fixture %s: %v", file, err)
+		}
+		site[url] = string(page)
+	}
+	mock := &mockWebDriver{site: site, url: listingURL}
+	var wd vdi.WebDriver = &detailSite{mockWebDriver: mock}
+
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 7, URL: listingURL}, re: re, Status: &Status{}, wd: wd}
+	ctx.config.Crawler.Interval = "0.01" // The page load wait
+	ctx.config.Crawler.Delay = "0"
+	rule, err := re.GetScrapingRuleByName("Products listing")
+	if err != nil {
+		t.Fatalf("Failed to find the listing rule: %v", err)
+	}
+	data, err := executeScrapingRule(ctx, rule, &wd)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The detail pages are nested under their list items (duplicates and
+	// links outside the Source domain are skipped)
+	expected := `"products":[` +
+		`{"detail":{"name":"Widget","price":20},"url":"https://www.google.com/products/1"},` +
+		`{"detail":{"name":"Gadget","price":35},"url":"https://www.google.com/products/2"},` +
+		`{"detail":{"name":"Gizmo","price":12},"url":"https://www.google.com/products/3"}` +
+		`],"title":"Products"`
+	if data != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	// The browser is back on the listing page
+	if mock.url != listingURL {
+		t.Errorf("Expected to be back on the listing page, got %s", mock.url)
+	}
+
+	// The detail pages out of the crawl scope are skipped, the ones served
+	// with an error status are reported
+	ctx.scope = newPatternScope(nil, []string{"/products/3$"})
+	mock = &mockWebDriver{site: site, url: listingURL}
+	wd = &detailSite{mockWebDriver: mock, status: map[string]int{"https://www.google.com/products/2": 404}}
+	data, _ = executeScrapingRule(ctx, rule, &wd)
+	expected = `"products":[{"detail":{"name":"Widget","price":20},"url":"https://www.google.com/products/1"}],"title":"Products"`
+	if data != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+	ctx.scope = nil
+
+	// max_items limits the detail pages visited
+	rule.DetailPages.MaxItems = 1
+	mock = &mockWebDriver{site: site, url: listingURL}
+	wd = &detailSite{mockWebDriver: mock}
+	if _, err := executeScrapingRule(ctx, rule, &wd); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	visited := 0
+	for _, call := range mock.calls {
+		if strings.HasPrefix(call, "get:https://www.google.com/products/") {
+			visited++
+		}
+	}
+	if visited != 1 {
+		t.Errorf("Expected 1 detail page visited, got %d (%v)", visited, mock.calls)
+	}
+}
+
+func TestParsePaginationText(t *testing.T) {
+	tests := []struct {
+		text    string
+		pattern string
+		total   int
+		current int
+		ok      bool
+	}{
+		{"Page 1 of 5", "", 5, 1, true},
+		{"Page 3 / 12", "", 12, 3, true},
+		{"Showing 1-20 of 1,340 results", "", 1340, 0, true},
+		{"340 results", "", 340, 0, true},
+		{"Showing 1-20 of 340.", "", 340, 0, true},
+		{"Showing 1-20 of 1.340 results", "", 1340, 0, true},
+		{"Page 1.5 of 3", "", 3, 0, true},
+		{"2.5 results", "", 0, 0, false},
+		{"Results: 1 340 items", `(?P<total>[\d ]+) items`, 1340, 0, true},
+		{"No results", "", 0, 0, false},
+		{"Results: 2 pages, 45 items", `(?P<total>\d+) items`, 45, 0, true},
+		{"Page 2 of 5", `Page (?P<current>\d+) of (?P<total>\d+)`, 5, 2, true},
+		{"Page 2 of 5", `(?P<total>\d+ items`, 0, 0, false},
+	}
+	for _, tt := range tests {
+		total, current, ok := parsePaginationText(tt.text, tt.pattern)
+		if total != tt.total || current != tt.current || ok != tt.ok {
+			t.Errorf("parsePaginationText(%q, %q) = (%d, %d, %v), want (%d, %d, %v)", tt.text, tt.pattern, total, current, ok, tt.total, tt.current, tt.ok)
+		}
+	}
+}
+
+func TestParsePaginationNumber(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int
+		wantErr bool
+	}{
+		{"340", 340, false},
+		{"1,340", 1340, false},
+		{"1.340", 1340, false},
+		{"1.234.567", 1234567, false},
+		{"1\u00a0340", 1340, false},
+		{"340.", 340, false},
+		{"1.5", 0, true},
+		{"15.00", 0, true},
+		{"1,234.5", 0, true},
+		{"1,2345", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePaginationNumber(tt.s)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parsePaginationNumber(%q) = %d, %v, want %d (error %v)", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPaginationMetadata(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	schema, err := rs.LoadSchema("../../schemas/ruleset-schema.json")
+	if err != nil {
+		t.Fatalf("Failed to load the ruleset schema: %v", err)
+	}
+	rulesets, err := rs.BulkLoadRules(schema, "./test_data/pagination/ruleset.yaml")
+	if err != nil || len(rulesets) != 1 {
+		t.Fatalf("Failed to load the pagination ruleset: %v", err)
+	}
+	re := &rs.RuleEngine{Rulesets: rulesets}
+	rule, err := re.GetScrapingRuleByName("Articles listing")
+	if err != nil {
+		t.Fatalf("Failed to find the listing rule: %v", err)
+	}
+
+	site := make(map[string]string)
+	for url, file := range map[string]string{
+		"https://www.google.com/articles?page=1": "page-1.html",
+		"https://www.google.com/articles?page=2": "page-2.html",
+	} {
+		page, err := os.ReadFile("./test_data/pagination/" + file)
+		if err != nil {
+			t.Fatalf("Failed to read fixture %s: %v", file, err)
+		}
+		site[url] = string(page)
+	}
+	mock := &mockWebDriver{site: site, url: "https://www.google.com/articles?page=1"}
+	var wd vdi.WebDriver = mock
+	ctx := &ProcessContext{SelID: 1, source: &cdb.Source{ID: 7, URL: mock.url}, re: re, Status: &Status{}}
+
+	// "Page 1 of 5": the total is detected and the listing is incomplete
+	data, err := ApplyRule(ctx, rule, &wd)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"unit": "pages", "total": 5, "current": 1, "collected": 1, "incomplete": true}
+	if !reflect.DeepEqual(data[paginationDefaultKey], expected) {
+		t.Errorf("Expected pagination %v, got %v", expected, data[paginationDefaultKey])
+	}
+
+	// The collected pages are counted across the crawl of the Source
+	if err := wd.Get("https://www.google.com/articles?page=2"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, _ = ApplyRule(ctx, rule, &wd)
+	pagination, _ := data[paginationDefaultKey].(map[string]interface{})
+	if pagination["collected"] != 2 || pagination["current"] != 2 || pagination["incomplete"] != true {
+		t.Errorf("Expected 2 of 5 pages collected, got %v", pagination)
+	}
+
+	// Counting items instead (with a total of 5, as found in the pager text)
+	rule.Pagination.Unit = rs.PaginationItems
+	rule.Pagination.ItemsKey = "articles"
+	ctx.pagination = nil
+	data, _ = ApplyRule(ctx, rule, &wd)
+	pagination, _ = data[paginationDefaultKey].(map[string]interface{})
+	if pagination["collected"] != 3 {
+		t.Errorf("Expected 3 items collected, got %v", pagination)
+	}
+	if err := wd.Get("https://www.google.com/articles?page=1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data, _ = ApplyRule(ctx, rule, &wd)
+	pagination, _ = data[paginationDefaultKey].(map[string]interface{})
+	if pagination["collected"] != 6 || pagination["incomplete"] != false {
+		t.Errorf("Expected 6 items collected (complete), got %v", pagination)
+	}
+}
+
+func TestPostProcessingMap(t *testing.T) {
+	data := []byte(`{"title":["  Blue Widget "],"price":["$ 1,299.50"],"stock":{"available":["yes"],"count":"12 left"},"tags":["tools","home"]}`)
+	step := rs.PostProcessingStep{
+		Type: "map",
+		Details: map[string]interface{}{
+			"record": "product",
+			"fields": []interface{}{
+				map[string]interface{}{"source": "title", "name": "name", "type": "string"},
+				map[string]interface{}{"source": "price", "type": "number"},
+				map[interface{}]interface{}{"source": "stock.count", "name": "quantity", "type": "integer"},
+				map[string]interface{}{"source": "stock.available", "name": "in_stock", "type": "boolean"},
+				map[string]interface{}{"source": "tags.0", "name": "category"},
+				map[string]interface{}{"source": "tags", "type": "list"},
+				map[string]interface{}{"source": "rating", "type": "number", "default": 0.0},
+				map[string]interface{}{"source": "title", "name": "sku", "type": "integer"},
+			},
+		},
+	}
+	ApplyPostProcessingStep(&ProcessContext{}, &step, &data)
+
+	var got map[string]map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Mapped data is not a record: %v (%s)", err, data)
+	}
+	expected := map[string]interface{}{
+		"name":     "Blue Widget",
+		"price":    1299.5,
+		"quantity": 12.0,
+		"in_stock": true,
+		"category": "tools",
+		"tags":     []interface{}{"tools", "home"},
+		"rating":   0.0,
+		"sku":      nil,
+	}
+	if !reflect.DeepEqual(got["product"], expected) {
+		t.Errorf("Expected record %v, got %v", expected, got["product"])
+	}
+
+	// A step without fields leaves the data untouched
+	data = []byte(`{"title":"Blue Widget"}`)
+	step.Details = map[string]interface{}{"record": "product"}
+	ApplyPostProcessingStep(&ProcessContext{}, &step, &data)
+	if string(data) != `{"title":"Blue Widget"}` {
+		t.Errorf("Expected the data to be unchanged, got %s", data)
+	}
+}
+
+func TestCleanNumber(t *testing.T) {
+	tests := map[string]string{
+		"$ 1,299.00":   "1299.00",
+		"1.299,00 €":   "1299.00",
+		"1 299,50 EUR": "1299.50",
+		"CHF 1'299.50": "1299.50",
+		"1.234.567":    "1234567",
+		"1,234,567":    "1234567",
+		"1,234":        "1234",
+		"1,5":          "1.5",
+		"1.234":        "1.234",
+		".5":           ".5",
+		"12 left":      "12",
+		"Price: 12.":   "12",
+		"-3,75 %":      "-3.75",
+	}
+	for value, expected := range tests {
+		if got := cleanNumber(value); got != expected {
+			t.Errorf("cleanNumber(%q) = %q, expected %q", value, got, expected)
+		}
+	}
+}
@@ -23,6 +23,8 @@ package crawler
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -43,7 +45,9 @@ const (
 func processScrapingRules(wd *vdi.WebDriver, ctx *ProcessContext, url string) (string, error) {
 	cmn.DebugMsg(cmn.DbgLvlDebug2, "Starting to search and process CROWler Scraping rules...")
 
-	scrapedDataDoc := ""
+	// Scraped data from multiple rulesets is merged in the order the rulesets
+	// are executed (see mergeScrapedData)
+	scrapedData := make(map[string]interface{})
 
 	// Run Scraping Rules if any
 	if ctx.source.Config != nil {
@@ -51,10 +55,11 @@ func processScrapingRules(wd *vdi.WebDriver, ctx *ProcessContext, url string) (s
 		cmn.DebugMsg(cmn.DbgLvlDebug, "Executing CROWler configured Scraping rules...")
 		// Execute the rules
 		if strings.TrimSpace(string((*ctx.source.Config))) == "{\"config\":\"default\"}" {
-			addScrapedDataToDocument(&scrapedDataDoc, runDefaultScrapingRules(wd, ctx))
+			mergeScrapedData(scrapedData, runDefaultScrapingRules(wd, ctx), "default scraping rules")
 		} else {
 			configStr := string((*ctx.source.Config))
 			cmn.DebugMsg(cmn.DbgLvlDebug5, "Source custom configuration detected: %v", configStr)
+			mergeScrapedData(scrapedData, runSourceScrapingRules(wd, ctx, url), "source execution plan")
 		}
 	}
 
@@ -62,13 +67,12 @@ func processScrapingRules(wd *vdi.WebDriver, ctx *ProcessContext, url string) (s
 	cmn.DebugMsg(cmn.DbgLvlDebug, "Executing CROWler URL-based Scraping rules (if any)...")
 	// If the URL matches a rule, execute it
 	data, err := executeScrapingRulesByURL(wd, ctx, url)
-	addScrapedDataToDocument(&scrapedDataDoc, data)
+	mergeScrapedData(scrapedData, data, "URL-based scraping rules")
 
-	// Check if scrapedDataDOc already has "{" and "}" at the beginning and end
-	if strings.HasPrefix(scrapedDataDoc, "{") && strings.HasSuffix(scrapedDataDoc, "}") {
-		scrapedDataDoc = scrapedDataDoc[1:]
-		scrapedDataDoc = scrapedDataDoc[:len(scrapedDataDoc)-1]
-	}
+	// Enforce the scraped data size limits (if any)
+	ctx.limitScrapedData(url, scrapedData)
+
+	scrapedDataDoc := scrapedDataFragment(scrapedData)
 
 	// log scraped data for debugging purposes
 	cmn.DebugMsg(cmn.DbgLvlDebug5, "Scraped data (at processScrapingRules level): {%v}", scrapedDataDoc)
@@ -85,7 +89,7 @@ func addScrapedDataToDocument(scrapedDataDoc *string, newScrapedData string) {
 }
 
 func executeScrapingRulesByURL(wd *vdi.WebDriver, ctx *ProcessContext, url string) (string, error) {
-	scrapedDataDoc := ""
+	scrapedData := make(map[string]interface{})
 	var errList []error
 
 	// Retrieve the rule group by URL
@@ -103,7 +107,7 @@ func executeScrapingRulesByURL(wd *vdi.WebDriver, ctx *ProcessContext, url strin
 					data = data[1:]
 					data = data[:len(data)-1]
 				}
-				addScrapedDataToDocument(&scrapedDataDoc, data)
+				mergeScrapedData(scrapedData, data, "rules group "+rg.GroupName)
 			}
 		}
 	} else {
@@ -120,7 +124,7 @@ func executeScrapingRulesByURL(wd *vdi.WebDriver, ctx *ProcessContext, url strin
 			// Execute all the rules in the ruleset
 			var data string
 			data, err = executeScrapingRulesInRuleset(ctx, rs, wd)
-			addScrapedDataToDocument(&scrapedDataDoc, data)
+			mergeScrapedData(scrapedData, data, "ruleset "+rs.Name)
 		}
 	} else {
 		cmn.DebugMsg(cmn.DbgLvlDebug, "No ruleset found for URL: %v", url)
@@ -129,6 +133,8 @@ func executeScrapingRulesByURL(wd *vdi.WebDriver, ctx *ProcessContext, url strin
 		errList = append(errList, fmt.Errorf("%v", err))
 	}
 
+	scrapedDataDoc := scrapedDataFragment(scrapedData)
+
 	// log scraped data for debugging purposes
 	cmn.DebugMsg(cmn.DbgLvlDebug5, "Scraped data (at executeScrapingRulesByURL level): {%v}", scrapedDataDoc)
 
@@ -160,13 +166,44 @@ func executeScrapingRulesInRuleset(ctx *ProcessContext, rs *rules.Ruleset, wd *v
 			}
 			cmn.DebugMsg(cmn.DbgLvlError, errExecutingScraping, err)
 		}
-		addScrapedDataToDocument(&scrapedDataDoc, scrapedData)
+		if strings.TrimSpace(scrapedData) != "" {
+			addScrapedDataToDocument(&scrapedDataDoc, scrapedData)
+		}
 	}
 
-	// Reset the environment
+	// Export the environment (if requested) and reset it
+	ctx.kvEnv.snapshot(ctx.GetContextID(), rs.Name, wd)
 	cmn.KVStore.DeleteNonPersistentByCID(ctx.GetContextID())
 
-	return scrapedDataDoc, nil
+	// Prepare the scraped data for storage
+	return prepareScrapedData(rs.Name, scrapedDataDoc)
+}
+
+// prepareScrapedData prepares the scraped data document of a ruleset (a list
+// of JSON fields without the enclosing braces) for storage (in the jsonb
+// details of the page): the document is validated and normalized, invalid
+// JSON is rejected
+func prepareScrapedData(name, scrapedDataDoc string) (string, error) {
+	scrapedDataDoc = strings.TrimSpace(scrapedDataDoc)
+	if scrapedDataDoc == "" {
+		return "", nil
+	}
+
+	var data map[string]interface{}
+	err := json.Unmarshal([]byte("{"+scrapedDataDoc+"}"), &data)
+	if err != nil {
+		return "", fmt.Errorf("invalid JSON scraped data for ruleset '%s': %v", name, err)
+	}
+	doc, err := json.Marshal(cleanJSONDocument(data))
+	if err != nil {
+		return "", fmt.Errorf("marshalling scraped data for ruleset '%s': %v", name, err)
+	}
+
+	// Remove the leading and trailing {}
+	rval := strings.TrimSpace(string(doc))
+	rval = strings.TrimPrefix(rval, "{")
+	rval = strings.TrimSuffix(rval, "}")
+	return rval, nil
 }
 
 func executeScrapingRulesInRuleGroup(ctx *ProcessContext, rg *rules.RuleGroup, wd *vdi.WebDriver) (string, error) {
@@ -220,10 +257,40 @@ func executeScrapingRulesInRuleGroup(ctx *ProcessContext, rg *rules.RuleGroup, w
 	return scrapedDataDoc, err
 }
 
-// executeScrapingRule executes a single ScrapingRule
+// executeScrapingRule executes a single ScrapingRule, honoring the rule's
+// ErrorHandling configuration (retries and ignore)
 func executeScrapingRule(ctx *ProcessContext, r *rules.ScrapingRule,
 	wd *vdi.WebDriver) (string, error) {
-	var jsonDocument string
+	// Execute the rule
+	jsonDocument, err := applyScrapingRule(ctx, r, wd)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "scraping rule '%s' failed: %v", r.RuleName, err)
+		if r.ErrorHandling.Ignore {
+			return jsonDocument, nil
+		}
+		if r.ErrorHandling.RetryCount > 0 {
+			for i := 0; i < r.ErrorHandling.RetryCount; i++ {
+				if r.ErrorHandling.RetryDelay > 0 {
+					time.Sleep(time.Duration(r.ErrorHandling.RetryDelay) * time.Second)
+				}
+				cmn.DebugMsg(cmn.DbgLvlDebug3, "Retrying scraping rule '%s' (%d/%d)", r.RuleName, i+1, r.ErrorHandling.RetryCount)
+				jsonDocument, err = applyScrapingRule(ctx, r, wd)
+				if err == nil {
+					break
+				}
+			}
+		}
+	}
+	return jsonDocument, err
+}
+
+// applyScrapingRule runs a single attempt of a ScrapingRule (wait conditions
+// included, so each retry waits for the page again)
+func applyScrapingRule(ctx *ProcessContext, r *rules.ScrapingRule,
+	wd *vdi.WebDriver) (jsonDocument string, err error) {
+	step := ctx.trace.begin(traceScrapingRule, r.RuleName, "", scrapingRuleSelectors(r), wd)
+	result := traceResultSkipped
+	defer func() { ctx.trace.end(step, result, jsonDocument, err) }()
 
 	// Execute Wait condition first
 	if len(r.WaitConditions) != 0 {
@@ -238,7 +305,9 @@ func executeScrapingRule(ctx *ProcessContext, r *rules.ScrapingRule,
 	var errList []error
 
 	// Execute the scraping rule
-	if shouldExecuteScrapingRule(r, wd) {
+	if shouldExecuteScrapingRule(ctx, r, wd) {
+		result = traceResultOK
+
 		// Apply the rule
 		extractedData, err := ApplyRule(ctx, r, wd)
 		if err != nil {
@@ -287,8 +356,9 @@ func cleanJSONDocument(doc map[string]interface{}) map[string]interface{} {
 			cleaned[key] = cleanJSONDocument(v)
 
 		case []interface{}:
-			// Filter out unstructured or invalid values in arrays
-			var validArray []interface{}
+			// Filter out unstructured or invalid values in arrays (an empty
+			// array stays an empty array, not null)
+			validArray := make([]interface{}, 0, len(v))
 			for _, item := range v {
 				switch item := item.(type) {
 				case map[string]interface{}:
@@ -325,8 +395,8 @@ func executeWaitConditions(ctx *ProcessContext, conditions []rules.WaitCondition
 	return nil
 }
 
-func shouldExecuteScrapingRule(r *rules.ScrapingRule, wd *vdi.WebDriver) bool {
-	return len(r.Conditions) == 0 || checkScrapingConditions(r.Conditions, wd)
+func shouldExecuteScrapingRule(ctx *ProcessContext, r *rules.ScrapingRule, wd *vdi.WebDriver) bool {
+	return len(r.Conditions) == 0 || checkScrapingConditions(ctx, r.Conditions, wd)
 }
 
 func processExtractedData(extractedData map[string]interface{}) map[string]interface{} {
@@ -419,8 +489,12 @@ func processExtractedData(extractedData map[string]interface{}) map[string]inter
 				processedData[key] = processedArray
 			}
 
-		case bool:
-			// Handle boolean values and ensure they're keyed
+		case nil:
+			// An element that wasn't found (see the scraping rule not_found policy)
+			processedData[key] = nil
+
+		case bool, int, float64:
+			// Handle boolean and numeric values (e.g., from detail pages or pagination) and ensure they're keyed
 			// Check if the key is already in the map
 			if _, exists := processedData[key]; exists {
 				// Append the data to the existing key
@@ -516,21 +590,89 @@ func runDefaultScrapingRules(wd *vdi.WebDriver, ctx *ProcessContext) string {
 		url = ""
 	}
 	rs := DefaultCrawlingConfig(url)
-	// Execute all the rules in the ruleset
-	var scrapedDataDoc string
-	for _, r := range rs.ExecutionPlan {
+	return executeScrapingExecutionPlan(rs.ExecutionPlan, wd, ctx, url)
+}
+
+// sourceExecutionPlan is the part of a Source custom configuration that lists
+// the rulesets, rules groups and rules to apply to the Source pages
+type sourceExecutionPlan struct {
+	ExecutionPlan []cfg.ExecutionPlanItem `json:"execution_plan" yaml:"execution_plan"`
+}
+
+// runSourceScrapingRules executes the scraping rules listed in the Source
+// custom configuration execution plan (if any)
+func runSourceScrapingRules(wd *vdi.WebDriver, ctx *ProcessContext, url string) string {
+	var plan sourceExecutionPlan
+	if err := json.Unmarshal(*ctx.source.Config, &plan); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "parsing source execution plan: %v", err)
+		return ""
+	}
+	if len(plan.ExecutionPlan) == 0 {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "No execution plan found in the source configuration")
+		return ""
+	}
+
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Executing source execution plan scraping rules...")
+	return executeScrapingExecutionPlan(plan.ExecutionPlan, wd, ctx, url)
+}
+
+// executeScrapingExecutionPlan executes the scraping rules of all the
+// execution plan items whose conditions are met, in the order they are listed,
+// and returns their scraped data merged into a single document.
+func executeScrapingExecutionPlan(plan []cfg.ExecutionPlanItem, wd *vdi.WebDriver, ctx *ProcessContext, url string) string {
+	scrapedData := make(map[string]interface{})
+	for _, epi := range plan {
 		// Check the conditions
-		if !checkScrapingPreConditions(r.Conditions, url) {
+		if !checkScrapingPreConditions(epi.Conditions, url) {
+			continue
+		}
+		if !checkScrapingConditions(ctx, epi.AdditionalConditions, wd) {
 			continue
 		}
-		addScrapedDataToDocument(&scrapedDataDoc, executeRulesInExecutionPlan(r, wd, ctx))
+		mergeScrapedData(scrapedData, executeRulesInExecutionPlan(epi, wd, ctx), "execution plan "+epi.Label)
 	}
-	return scrapedDataDoc
+	return scrapedDataFragment(scrapedData)
 }
 
+// executeRulesInExecutionPlan executes the scraping rules of an execution plan
+// item: first its rulesets, then its rules groups and then its rules, each in
+// the order they are listed. The scraped data is merged in the same order, so
+// on a key collision the data of the rule executed last wins.
 func executeRulesInExecutionPlan(epi cfg.ExecutionPlanItem, wd *vdi.WebDriver, ctx *ProcessContext) string {
-	var scrapedDataDoc string
-	// Get the rule
+	scrapedData := make(map[string]interface{})
+
+	for _, rulesetName := range epi.Rulesets {
+		if strings.TrimSpace(rulesetName) == "" {
+			continue
+		}
+		rs, err := ctx.re.GetRulesetByName(rulesetName)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "getting ruleset '%s': %v", rulesetName, err)
+			continue
+		}
+		data, err := executeScrapingRulesInRuleset(ctx, rs, wd)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "executing ruleset '%s': %v", rulesetName, err)
+		}
+		mergeScrapedData(scrapedData, data, "ruleset "+rs.Name)
+	}
+
+	for _, ruleGroupName := range epi.RuleGroups {
+		if strings.TrimSpace(ruleGroupName) == "" {
+			continue
+		}
+		rg, err := ctx.re.GetRuleGroupByName(ruleGroupName)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "getting rule group '%s': %v", ruleGroupName, err)
+			continue
+		}
+		data, err := executeScrapingRulesInRuleGroup(ctx, rg, wd)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "executing rule group '%s': %v", ruleGroupName, err)
+		}
+		mergeScrapedData(scrapedData, data, "rules group "+rg.GroupName)
+	}
+
 	for _, ruleName := range epi.Rules {
 		if ruleName == "" {
 			continue
@@ -538,20 +680,159 @@ func executeRulesInExecutionPlan(epi cfg.ExecutionPlanItem, wd *vdi.WebDriver, c
 		rule, err := ctx.re.GetScrapingRuleByName(ruleName)
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "getting scraping rule: %v", err)
-		} else {
-			// Execute the rule
-			scrapedData, err := executeScrapingRule(ctx, rule, wd)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlError, errExecutingScraping, err)
-			} else {
-				scrapedDataDoc += scrapedData
-				cmn.DebugMsg(cmn.DbgLvlDebug3, "Scraped data: %v", scrapedDataDoc)
-			}
+			continue
 		}
+		// Execute the rule
+		data, err := executeScrapingRule(ctx, rule, wd)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, errExecutingScraping, err)
+			continue
+		}
+		mergeScrapedData(scrapedData, data, "rule "+rule.RuleName)
 	}
+
+	scrapedDataDoc := scrapedDataFragment(scrapedData)
+	cmn.DebugMsg(cmn.DbgLvlDebug3, "Scraped data: %v", scrapedDataDoc)
 	return scrapedDataDoc
 }
 
+// mergeScrapedData merges a scraped data fragment (a list of JSON fields, with
+// or without the enclosing braces) into the given document. Nested objects are
+// merged recursively, while on any other key collision the fragment value
+// replaces the existing one, so the result only depends on the merge order.
+// The origin is used to log collisions and invalid fragments.
+func mergeScrapedData(doc map[string]interface{}, fragment, origin string) {
+	fragment = strings.TrimSpace(fragment)
+	if fragment == "" || fragment == "{}" || fragment == strFalse || fragment == strTrue {
+		return
+	}
+
+	data, err := parseScrapedDataFragment(fragment)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "ignoring invalid scraped data from %s: %v", origin, err)
+		return
+	}
+	mergeScrapedDataMaps(doc, data, origin, "")
+}
+
+// parseScrapedDataFragment parses a scraped data fragment into a map
+func parseScrapedDataFragment(fragment string) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader("{" + fragment + "}"))
+	dec.UseNumber()
+	err := dec.Decode(&data)
+	if err != nil && strings.HasPrefix(fragment, "{") {
+		// The fragment may already be a complete JSON object
+		data = nil
+		dec = json.NewDecoder(strings.NewReader(fragment))
+		dec.UseNumber()
+		err = dec.Decode(&data)
+	}
+	return data, err
+}
+
+func mergeScrapedDataMaps(dst, src map[string]interface{}, origin, path string) {
+	for key, value := range src {
+		existing, ok := dst[key]
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		existingMap, ok1 := existing.(map[string]interface{})
+		valueMap, ok2 := value.(map[string]interface{})
+		if ok1 && ok2 {
+			mergeScrapedDataMaps(existingMap, valueMap, origin, path+key+".")
+			continue
+		}
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Scraped data key '%s%s' collision, using the value from %s", path, key, origin)
+		dst[key] = value
+	}
+}
+
+// scrapedDataFragment returns a scraped data document as a list of JSON fields
+// without the enclosing braces (the keys are sorted, so the output is stable)
+func scrapedDataFragment(doc map[string]interface{}) string {
+	if len(doc) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "marshalling scraped data: %v", err)
+		return ""
+	}
+	rval := strings.TrimSpace(string(data))
+	rval = strings.TrimPrefix(rval, "{")
+	rval = strings.TrimSuffix(rval, "}")
+	return rval
+}
+
+// limitScrapedData enforces the scraped data size limits (0 means unlimited)
+// on the data scraped from a page: the largest fields of the data exceeding
+// max_scraped_page_size are dropped (until it fits), and the data exceeding
+// what's left of max_scraped_source_size is dropped. The limits enforced are
+// recorded as warnings.
+func (ctx *ProcessContext) limitScrapedData(url string, scrapedData map[string]interface{}) {
+	pageMax := ctx.config.Crawler.MaxScrapedPageSize
+	sourceMax := ctx.config.Crawler.MaxScrapedSourceSize
+	if len(scrapedData) == 0 || (pageMax <= 0 && sourceMax <= 0) {
+		return
+	}
+
+	size := scrapedDataSize(scrapedData)
+	if pageMax > 0 && size > pageMax {
+		// Drop the largest fields first
+		fieldSizes := make(map[string]int, len(scrapedData))
+		keys := make([]string, 0, len(scrapedData))
+		for key, value := range scrapedData {
+			fieldSizes[key] = scrapedDataSize(map[string]interface{}{key: value})
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if fieldSizes[keys[i]] != fieldSizes[keys[j]] {
+				return fieldSizes[keys[i]] > fieldSizes[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		var dropped []string
+		for _, key := range keys {
+			if size <= pageMax {
+				break
+			}
+			delete(scrapedData, key)
+			dropped = append(dropped, key)
+			size = scrapedDataSize(scrapedData)
+		}
+		ctx.recordWarning("the data scraped from %s exceeds max_scraped_page_size (%d bytes), dropped the fields: %s",
+			url, pageMax, strings.Join(dropped, ", "))
+	}
+
+	if sourceMax > 0 && len(scrapedData) > 0 {
+		ctx.scrapedSizeMutex.Lock()
+		defer ctx.scrapedSizeMutex.Unlock()
+		if ctx.scrapedSize+size > sourceMax {
+			for key := range scrapedData {
+				delete(scrapedData, key)
+			}
+			ctx.recordWarning("the data scraped from the Source reached max_scraped_source_size (%d bytes), dropped the data scraped from %s (%d bytes)",
+				sourceMax, url, size)
+			return
+		}
+		ctx.scrapedSize += size
+	}
+}
+
+// scrapedDataSize returns the size (in bytes) of the scraped data as JSON
+func scrapedDataSize(scrapedData map[string]interface{}) int {
+	if len(scrapedData) == 0 {
+		return 0
+	}
+	data, err := json.Marshal(scrapedData)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
 // checkScrapingPreConditions checks if the pre conditions are met
 // for example if the page URL is listed in the list of URLs
 // for which this rule is valid.
@@ -572,8 +853,9 @@ func checkScrapingPreConditions(conditions cfg.Condition, url string) bool {
 
 // checkScrapingConditions checks all types of conditions: Scraping and Config Conditions
 // These are page related conditions, for instance check if an element is present
-// or if the page is in the desired language etc.
-func checkScrapingConditions(conditions map[string]interface{}, wd *vdi.WebDriver) bool {
+// or if the page is in the desired language etc., and data related conditions
+// (checked against the values stored in the KV store by previous rules).
+func checkScrapingConditions(ctx *ProcessContext, conditions map[string]interface{}, wd *vdi.WebDriver) bool {
 	canProceed := true
 	// Check the additional conditions
 	if len(conditions) > 0 {
@@ -597,10 +879,68 @@ func checkScrapingConditions(conditions map[string]interface{}, wd *vdi.WebDrive
 				canProceed = false
 			}
 		}
+		// If a data condition is present, check it against the KV store
+		if dc, ok := conditions["data"]; ok {
+			if !checkDataCondition(ctx, dc) {
+				canProceed = false
+			}
+		}
 	}
 	return canProceed
 }
 
+// checkDataCondition checks a data condition against the values stored in the
+// KV store for the current context. The condition is a map with the following
+// fields:
+// - variable: the name of the variable to check (required)
+// - exists: if false the condition is met only when the variable is absent (default true)
+// - equals: the value the variable must be equal to (optional)
+// - matches: a regular expression the variable must match (optional)
+func checkDataCondition(ctx *ProcessContext, condition interface{}) bool {
+	dc, ok := condition.(map[string]interface{})
+	if !ok {
+		cmn.DebugMsg(cmn.DbgLvlError, "invalid data condition: %v", condition)
+		return false
+	}
+	name, _ := dc["variable"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		cmn.DebugMsg(cmn.DbgLvlError, "data condition without variable name")
+		return false
+	}
+
+	mustExist := true
+	if exists, ok := dc["exists"].(bool); ok {
+		mustExist = exists
+	}
+
+	value, err := cmn.KVStore.GetString(name, ctx.GetContextID())
+	if err != nil {
+		// The variable does not exist
+		return !mustExist
+	}
+	if !mustExist {
+		return false
+	}
+
+	if equals, ok := dc["equals"]; ok {
+		if value != fmt.Sprintf("%v", equals) {
+			return false
+		}
+	}
+	if pattern, ok := dc["matches"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "invalid data condition regex '%s': %v", pattern, err)
+			return false
+		}
+		if !re.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
 func parseHTML(htmlData string) ([]map[string]interface{}, error) {
 	doc, err := html.Parse(strings.NewReader(htmlData))
 	if err != nil {
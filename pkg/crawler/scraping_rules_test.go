@@ -0,0 +1,165 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	rules "github.com/pzaino/thecrowler/pkg/ruleset"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestProcessScrapingRulesOrderedRulesets(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	regexElement := func(key, re string) rules.Element {
+		return rules.Element{Key: key, Selectors: []rules.Selector{{SelectorType: "regex", Selector: re}}}
+	}
+	ruleset := func(name string, elements ...rules.Element) rules.Ruleset {
+		return rules.Ruleset{
+			Name: name,
+			RuleGroups: []rules.RuleGroup{
+				{
+					GroupName:     name + " group",
+					IsEnabled:     true,
+					ScrapingRules: []rules.ScrapingRule{{RuleName: name + " rule", Elements: elements}},
+				},
+			},
+		}
+	}
+	re := &rules.RuleEngine{
+		Rulesets: []rules.Ruleset{
+			ruleset("Product", regexElement("name", `name: (\w+)`), regexElement("price", `list price: (\d+)`)),
+			ruleset("Offers", regexElement("price", `offer price: (\d+)`), regexElement("stock", `stock: (\d+)`)),
+		},
+	}
+
+	tests := []struct {
+		rulesets []string
+		expected string
+	}{
+		{[]string{"Product", "Offers"}, `{"name":"Widget","price":15,"stock":3}`},
+		{[]string{"Offers", "Product"}, `{"name":"Widget","price":20,"stock":3}`},
+	}
+	for _, test := range tests {
+		plan := map[string]interface{}{
+			"execution_plan": []map[string]interface{}{
+				{
+					"label":      "Product pages",
+					"conditions": map[string]interface{}{"url_patterns": []string{"google.com"}},
+					"rulesets":   test.rulesets,
+				},
+			},
+		}
+		config, _ := json.Marshal(plan)
+		srcConfig := json.RawMessage(config)
+		ctx := &ProcessContext{
+			SelID:  1,
+			source: &cdb.Source{ID: 1, URL: testFQDN, Config: &srcConfig},
+			re:     re,
+			Status: &Status{},
+		}
+		var wd vdi.WebDriver = &mockWebDriver{
+			pages: []string{"<div>name: Widget list price: 20 offer price: 15 stock: 3</div>"},
+		}
+
+		doc, err := processScrapingRules(&wd, ctx, testFQDN)
+		if err != nil {
+			t.Fatalf("Unexpected error for rulesets %v: %v", test.rulesets, err)
+		}
+		if doc != test.expected {
+			t.Errorf("Rulesets %v: expected %s, got %s", test.rulesets, test.expected, doc)
+		}
+	}
+}
+
+func TestProcessScrapingRulesSizeLimits(t *testing.T) {
+	cmn.KVStore = cmn.NewKeyValueStore()
+	element := func(key, re string) rules.Element {
+		return rules.Element{Key: key, Selectors: []rules.Selector{{SelectorType: "regex", Selector: re}}}
+	}
+	re := &rules.RuleEngine{
+		Rulesets: []rules.Ruleset{{
+			Name: "Product",
+			RuleGroups: []rules.RuleGroup{{
+				GroupName: "Product group",
+				IsEnabled: true,
+				ScrapingRules: []rules.ScrapingRule{{
+					RuleName: "Product rule",
+					Elements: []rules.Element{element("name", `name: (\w+)`), element("description", `description: (\w+)`)},
+				}},
+			}},
+		}},
+	}
+	plan, _ := json.Marshal(map[string]interface{}{
+		"execution_plan": []map[string]interface{}{{"label": "Products", "rulesets": []string{"Product"}}},
+	})
+	srcConfig := json.RawMessage(plan)
+	ctx := &ProcessContext{
+		SelID:  1,
+		source: &cdb.Source{ID: 1, URL: testFQDN, Config: &srcConfig},
+		re:     re,
+		Status: &Status{},
+	}
+	ctx.config.Crawler.MaxScrapedPageSize = 100
+	ctx.config.Crawler.MaxScrapedSourceSize = 40
+	page := "<div>name: Widget description: " + strings.Repeat("x", 200) + "</div>"
+
+	// The oversized description is dropped from the page data
+	var wd vdi.WebDriver = &mockWebDriver{pages: []string{page}}
+	doc, err := processScrapingRules(&wd, ctx, testFQDN)
+	if err != nil {
+		t.Fatalf("processScrapingRules() error = %v", err)
+	}
+	if doc != `{"name":"Widget"}` {
+		t.Errorf("Expected the description to be dropped, got %s", doc)
+	}
+	if ctx.Status.TotalWarnings != 1 || !strings.Contains(ctx.Status.LastWarning, "max_scraped_page_size") ||
+		!strings.Contains(ctx.Status.LastWarning, "description") {
+		t.Errorf("Expected a page size warning, got %d (%s)", ctx.Status.TotalWarnings, ctx.Status.LastWarning)
+	}
+
+	// The second page data doesn't fit in what's left of the Source limit
+	wd = &mockWebDriver{pages: []string{"<div>name: Gadget</div>"}}
+	if doc, err = processScrapingRules(&wd, ctx, testFQDN+"/gadget"); err != nil || doc != "{}" {
+		t.Errorf("processScrapingRules() = %s, %v, want the data to be dropped", doc, err)
+	}
+	if ctx.Status.TotalWarnings != 2 || !strings.Contains(ctx.Status.LastWarning, "max_scraped_source_size") {
+		t.Errorf("Expected a Source size warning, got %d (%s)", ctx.Status.TotalWarnings, ctx.Status.LastWarning)
+	}
+
+	// 0 means unlimited
+	ctx.config.Crawler.MaxScrapedPageSize, ctx.config.Crawler.MaxScrapedSourceSize = 0, 0
+	wd = &mockWebDriver{pages: []string{page}}
+	if doc, _ = processScrapingRules(&wd, ctx, testFQDN); !strings.Contains(doc, `"description"`) {
+		t.Errorf("Expected the data not to be limited, got %s", doc)
+	}
+}
+
+func TestMergeScrapedData(t *testing.T) {
+	doc := make(map[string]interface{})
+	mergeScrapedData(doc, `"title":"a","meta":{"lang":"en","tags":["x"]}`, "first")
+	mergeScrapedData(doc, `{"meta":{"tags":["y"],"author":"b"},"title":"c"}`, "second")
+	mergeScrapedData(doc, `not json`, "third")
+	mergeScrapedData(doc, strTrue, "fourth")
+
+	expected := `"meta":{"author":"b","lang":"en","tags":["y"]},"title":"c"`
+	if got := scrapedDataFragment(doc); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+const (
+	sitemapFetchTimeout = 30               // Timeout of a sitemap request (in seconds)
+	sitemapMaxSize      = 50 * 1024 * 1024 // Sitemaps are limited to 50 MiB (uncompressed) by the sitemaps protocol
+	sitemapMaxDepth     = 3                // Maximum nesting level of the sitemap index files
+)
+
+// sitemapDocument is a sitemap (urlset) or a sitemap index (sitemapindex)
+type sitemapDocument struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// fetchSitemapURLs returns the page URLs listed in the sitemap.xml of the site
+// of baseURL, following the nested sitemap indexes and decompressing the
+// gzipped sitemaps. The nested sitemaps are only followed on the host of
+// baseURL or inside the crawl scope (restricted) of the Source. At most
+// maxURLs URLs are returned.
+func fetchSitemapURLs(baseURL string, restricted uint, maxURLs int, headers map[string]string) ([]string, error) {
+	return fetchSitemapURLsWith(baseURL, restricted, maxURLs, func(sitemapURL string) ([]byte, error) {
+		return fetchSitemap(sitemapURL, headers)
+	})
+}
+
+// fetchSitemapURLsWith is fetchSitemapURLs with the sitemaps retrieved by get
+func fetchSitemapURLsWith(baseURL string, restricted uint, maxURLs int, get func(string) ([]byte, error)) ([]string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid URL '%s'", baseURL)
+	}
+	sitemapURL := base.Scheme + "://" + base.Host + "/sitemap.xml"
+
+	var urls []string
+	seen := make(map[string]bool)    // URLs already collected
+	fetched := make(map[string]bool) // Sitemaps already fetched (to avoid loops)
+
+	var walk func(sitemapURL string, depth int) error
+	walk = func(sitemapURL string, depth int) error {
+		fetched[sitemapURL] = true
+		data, err := get(sitemapURL)
+		if err != nil {
+			return err
+		}
+		doc, err := parseSitemap(data)
+		if err != nil {
+			return fmt.Errorf("parsing sitemap '%s': %v", sitemapURL, err)
+		}
+
+		for _, loc := range doc.URLs {
+			if len(urls) >= maxURLs {
+				return nil
+			}
+			link := strings.TrimSpace(loc.Loc)
+			if link != "" && !seen[link] {
+				seen[link] = true
+				urls = append(urls, link)
+			}
+		}
+		for _, loc := range doc.Sitemaps {
+			link := strings.TrimSpace(loc.Loc)
+			if len(urls) >= maxURLs || depth >= sitemapMaxDepth {
+				return nil
+			}
+			if link == "" || fetched[link] {
+				continue
+			}
+			if !sitemapInScope(baseURL, link, restricted) {
+				cmn.DebugMsg(cmn.DbgLvlDebug, "skipping nested sitemap '%s', it's out of the crawl scope", link)
+				continue
+			}
+			if err := walk(link, depth+1); err != nil {
+				// A broken nested sitemap doesn't invalidate the others
+				cmn.DebugMsg(cmn.DbgLvlDebug, "fetching nested sitemap: %v", err)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(sitemapURL, 0); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// sitemapInScope returns true if a nested sitemap is on the same host as the
+// Source URL or inside its crawl scope (so a sitemap index can't send the
+// crawler to fetch sitemaps from other sites)
+func sitemapInScope(sourceURL, sitemapURL string, restricted uint) bool {
+	sitemap, err := url.Parse(sitemapURL)
+	if err != nil || sitemap.Hostname() == "" {
+		return false
+	}
+	source, err := url.Parse(sourceURL)
+	if err == nil && strings.EqualFold(sitemap.Hostname(), source.Hostname()) {
+		return true
+	}
+	if restricted == 4 {
+		return false // No crawl scope to check against, only the same host is trusted
+	}
+	return !isExternalLink(sourceURL, sitemapURL, restricted)
+}
+
+// parseSitemap parses a (possibly gzipped) sitemap or sitemap index
+func parseSitemap(data []byte) (sitemapDocument, error) {
+	var doc sitemapDocument
+	var reader io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return doc, err
+		}
+		defer gz.Close() //nolint:errcheck // We can't check the error in a defer
+		reader = gz
+	}
+	err := xml.NewDecoder(io.LimitReader(reader, sitemapMaxSize)).Decode(&doc)
+	return doc, err
+}
+
+// fetchSitemap retrieves a sitemap (with the given request headers)
+func fetchSitemap(sitemapURL string, headers map[string]string) ([]byte, error) {
+	httpClient := &http.Client{
+		Transport: cmn.SafeTransport(sitemapFetchTimeout, "ignore"),
+		Timeout:   time.Duration(sitemapFetchTimeout) * time.Second,
+	}
+	req, err := http.NewRequest("GET", sitemapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving sitemap '%s': %v", sitemapURL, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("retrieving sitemap '%s': unexpected status code %d", sitemapURL, resp.StatusCode)
+	}
+	// Gzipped sitemaps are smaller than the uncompressed size limit
+	return io.ReadAll(io.LimitReader(resp.Body, sitemapMaxSize))
+}
+
+// sitemapLinks returns the links of the Source sitemaps that aren't in links
+func (ctx *ProcessContext) sitemapLinks(links []LinkItem) []LinkItem {
+	if !ctx.config.Crawler.UseSitemaps {
+		return nil
+	}
+	urls, err := fetchSitemapURLs(ctx.source.URL, ctx.source.Restricted, ctx.config.Crawler.SitemapMaxURLs, requestHeaders(&ctx.config.Crawler, robotsFetchAgent))
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "Source %d: no sitemap used: %v", ctx.source.ID, err)
+		return nil
+	}
+
+	known := make(map[string]bool, len(links))
+	for _, link := range links {
+		known[normalizeURL(link.Link, 0)] = true
+	}
+	var sitemapLinks []LinkItem
+	for _, u := range urls {
+		link := normalizeURL(u, 0)
+		if link == "" || known[link] || !IsValidURL(link) {
+			continue
+		}
+		known[link] = true
+		sitemapLinks = append(sitemapLinks, LinkItem{PageURL: ctx.source.URL, Link: link})
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Source %d: %d links seeded from the sitemaps", ctx.source.ID, len(sitemapLinks))
+	return sitemapLinks
+}
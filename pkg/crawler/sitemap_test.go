@@ -0,0 +1,100 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestFetchSitemapURLs(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/news/1</loc></url>
+  <url><loc>https://example.com/news/2</loc></url>
+</urlset>`))
+	_ = gz.Close()
+
+	sitemaps := map[string][]byte{
+		"https://example.com/sitemap.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-pages.xml</loc></sitemap>
+  <sitemap><loc>https://example.com/sitemap-news.xml.gz</loc></sitemap>
+  <sitemap><loc>https://example.com/sitemap-missing.xml</loc></sitemap>
+  <sitemap><loc>https://example.com/sitemap.xml</loc></sitemap>
+  <sitemap><loc>https://blog.example.com/sitemap.xml</loc></sitemap>
+  <sitemap><loc>https://attacker.test/sitemap.xml</loc></sitemap>
+</sitemapindex>`),
+		"https://example.com/sitemap-pages.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/</loc></url>
+  <url><loc> https://example.com/about </loc><lastmod>2026-01-01</lastmod></url>
+  <url><loc>https://example.com/</loc></url>
+</urlset>`),
+		"https://example.com/sitemap-news.xml.gz": gzipped.Bytes(),
+		"https://blog.example.com/sitemap.xml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://blog.example.com/post/1</loc></url>
+</urlset>`),
+	}
+	var requested []string
+	get := func(sitemapURL string) ([]byte, error) {
+		requested = append(requested, sitemapURL)
+		data, ok := sitemaps[sitemapURL]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", sitemapURL)
+		}
+		return data, nil
+	}
+
+	urls, err := fetchSitemapURLsWith("https://example.com/some/page", 1, 100, get)
+	if err != nil {
+		t.Fatalf("fetchSitemapURLsWith() error = %v", err)
+	}
+	want := []string{"https://example.com/", "https://example.com/about", "https://example.com/news/1", "https://example.com/news/2"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("fetchSitemapURLsWith() = %v, want %v", urls, want)
+	}
+	// The nested sitemaps of other hosts aren't fetched
+	for _, sitemapURL := range requested {
+		if sitemapURL == "https://blog.example.com/sitemap.xml" || sitemapURL == "https://attacker.test/sitemap.xml" {
+			t.Errorf("Expected the out of scope sitemap '%s' not to be fetched", sitemapURL)
+		}
+	}
+
+	// Unless they are inside the crawl scope (the subdomains of the Source)
+	requested = nil
+	urls, err = fetchSitemapURLsWith("https://example.com", 2, 100, get)
+	if err != nil || !slices.Contains(urls, "https://blog.example.com/post/1") || slices.Contains(requested, "https://attacker.test/sitemap.xml") {
+		t.Errorf("fetchSitemapURLsWith() = %v, %v (fetched %v), want the subdomain sitemap only", urls, err, requested)
+	}
+
+	// The number of URLs is capped
+	urls, err = fetchSitemapURLsWith("https://example.com", 1, 3, get)
+	if err != nil || len(urls) != 3 {
+		t.Errorf("fetchSitemapURLsWith() = %v, %v, want 3 URLs", urls, err)
+	}
+
+	// A site without sitemap.xml
+	if _, err := fetchSitemapURLsWith("https://other.example.com", 1, 100, get); err == nil {
+		t.Errorf("fetchSitemapURLsWith() error = nil without a sitemap")
+	}
+}
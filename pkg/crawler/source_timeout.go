@@ -0,0 +1,81 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+// sourceTimeoutGrace is how long a crawl can keep running after its timeout
+// (stuck in a WebDriver call that can't be interrupted) before its VDI is
+// returned to the pool anyway
+var sourceTimeoutGrace = 30 * time.Second
+
+// withSourceTimeout returns the context of the crawl of the Source, limited
+// by its source_timeout (if any)
+func (ctx *ProcessContext) withSourceTimeout(crawlCtx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.config.Crawler.SourceTimeout <= 0 {
+		return context.WithCancel(crawlCtx)
+	}
+	return context.WithTimeout(crawlCtx, time.Duration(ctx.config.Crawler.SourceTimeout)*time.Second)
+}
+
+// sourceTimedOut returns true if the crawl of the Source has timed out
+func (ctx *ProcessContext) sourceTimedOut() bool {
+	return ctx.crawlCtx != nil && errors.Is(ctx.crawlCtx.Err(), context.DeadlineExceeded)
+}
+
+// recordSourceTimeout records the crawl of the Source as failed if it has
+// timed out (so the Source state is updated with the timeout error)
+func (ctx *ProcessContext) recordSourceTimeout() {
+	if !ctx.sourceTimedOut() {
+		return
+	}
+	msg := fmt.Sprintf("crawl timed out after %d seconds", ctx.config.Crawler.SourceTimeout)
+	cmn.DebugMsg(cmn.DbgLvlError, "Source %d: %s", ctx.source.ID, msg)
+	ctx.Status.CrawlingRunning = 3
+	ctx.Status.PipelineRunning = 3
+	ctx.Status.TotalErrors++
+	ctx.Status.LastError = msg
+}
+
+// watchSourceTimeout returns the VDI of a crawl still running
+// sourceTimeoutGrace after its timeout (stuck in a WebDriver call that can't
+// be interrupted), so the VDI pool isn't starved. Quitting the VDI session
+// also makes the stuck call fail. It stops when done is closed.
+func (ctx *ProcessContext) watchSourceTimeout(args *Pars, sel *vdi.SeleniumInstance, releaseVDI chan<- vdi.SeleniumInstance, done <-chan struct{}) {
+	select {
+	case <-done:
+		return
+	case <-ctx.crawlCtx.Done():
+	}
+	if !ctx.sourceTimedOut() {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(sourceTimeoutGrace):
+		cmn.DebugMsg(cmn.DbgLvlWarn, "Source %d: crawl still running %v after its timeout, returning its VDI", ctx.source.ID, sourceTimeoutGrace)
+		vdi.ReturnVDIInstance(args.WG, ctx, sel, releaseVDI)
+	}
+}
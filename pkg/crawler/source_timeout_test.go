@@ -0,0 +1,63 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	vdi "github.com/pzaino/thecrowler/pkg/vdi"
+)
+
+func TestSourceTimeout(t *testing.T) {
+	conf := cfg.NewConfig()
+	conf.Crawler.SourceTimeout = 1
+	ctx := &ProcessContext{Status: &Status{}, config: *conf, source: &cdb.Source{ID: 1}}
+	crawlCtx, cancel := ctx.withSourceTimeout(context.Background())
+	defer cancel()
+	ctx.crawlCtx = crawlCtx
+
+	// A crawl still running isn't recorded as timed out
+	ctx.recordSourceTimeout()
+	if ctx.Status.LastError != "" || ctx.Status.PipelineRunning != 0 {
+		t.Errorf("Expected no timeout error, got %+v", ctx.Status)
+	}
+
+	// The timed out crawl is recorded as failed (and its VDI returned, here
+	// with its session already closed)
+	ctx.SelClosed = true
+	savedGrace := sourceTimeoutGrace
+	sourceTimeoutGrace = 10 * time.Millisecond
+	defer func() { sourceTimeoutGrace = savedGrace }()
+	releaseVDI := make(chan vdi.SeleniumInstance, 1)
+	sel := vdi.SeleniumInstance{}
+	done := make(chan struct{})
+	ctx.watchSourceTimeout(&Pars{WG: &sync.WaitGroup{}}, &sel, releaseVDI, done)
+	if !ctx.sourceTimedOut() {
+		t.Fatalf("Expected the crawl to time out")
+	}
+	if len(releaseVDI) != 1 || !ctx.VDIReturned {
+		t.Errorf("Expected the VDI to be returned after the timeout")
+	}
+	ctx.recordSourceTimeout()
+	if ctx.Status.PipelineRunning != 3 || ctx.Status.TotalErrors != 1 || !strings.Contains(ctx.Status.LastError, "timed out") {
+		t.Errorf("Expected the timeout to be recorded as an error, got %+v", ctx.Status)
+	}
+}
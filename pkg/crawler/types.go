@@ -45,23 +45,29 @@ type Pars struct {
 
 // Status holds the status of the crawler
 type Status struct {
-	PipelineID      uint64
-	SourceID        uint64
-	Source          string
-	TotalPages      int
-	TotalLinks      int
-	TotalSkipped    int
-	TotalDuplicates int
-	TotalErrors     int
-	TotalScraped    int
-	TotalActions    int
-	TotalFuzzing    int
-	StartTime       time.Time
-	EndTime         time.Time
-	CurrentDepth    int
-	LastWait        float64
-	LastDelay       float64
-	LastError       string
+	PipelineID        uint64
+	SourceID          uint64
+	Source            string
+	TotalPages        int
+	TotalLinks        int
+	TotalSkipped      int
+	TotalDuplicates   int
+	TotalErrors       int
+	ConsecutiveErrors int // Number of consecutive page errors
+	TotalWarnings     int // Number of non-fatal page problems (e.g., unparsable HTML)
+	TotalScraped      int
+	TotalActions      int
+	TotalFuzzing      int
+	StartTime         time.Time
+	EndTime           time.Time
+	CurrentDepth      int
+	LastWait          float64
+	LastDelay         float64
+	LastError         string
+	LastWarning       string
+	TargetFound       bool   // The stop condition matched, so the crawl was stopped early
+	TargetURL         string // The page on which the stop condition matched
+	ActionPlanStep    string // The action rule an action plan was on when it timed out
 	// Flags values: 0 - Not started yet, 1 - Running, 2 - Completed, 3 - Error
 	NetInfoRunning  int // Flag to check if network info is already gathered
 	HTTPInfoRunning int // Flag to check if HTTP info is already gathered
@@ -79,18 +85,36 @@ type MetaTag struct {
 type PageInfo struct {
 	URL                     string                           `json:"URL"` // The URL of the web page.
 	sourceID                uint64                           // The ID of the source.
+	sourceURL               string                           // The URL of the source (the crawl scope, with restricted).
+	restricted              uint                             // The restriction level of the source (the crawl scope, with sourceURL).
+	contentUnchanged        bool                             // The content is unchanged since the page was last indexed (set by indexPage).
 	Title                   string                           `json:"title"`                      // The title of the web page.
 	Summary                 string                           `json:"summary"`                    // A summary of the web page content.
 	BodyText                string                           `json:"body_text"`                  // The main body text of the web page.
 	HTML                    string                           `json:"html"`                       // The HTML content of the web page.
 	MetaTags                []MetaTag                        `json:"meta_tags"`                  // The meta tags of the web page.
 	Keywords                []string                         `json:"keywords"`                   // The keywords of the web page.
+	KeywordTags             map[string]string                `json:"keyword_tags,omitempty"`     // The name of the keyword rule that captured each keyword (if any).
 	DetectedType            string                           `json:"detected_type"`              // The detected document type of the web page.
 	DetectedLang            string                           `json:"detected_lang"`              // The detected language of the web page.
+	StatusCode              int                              `json:"status_code"`                // The HTTP status code of the web page (0 if unknown).
+	PublishedAt             *time.Time                       `json:"published_at,omitempty"`     // The publish date of the web page (if found).
+	ModifiedAt              *time.Time                       `json:"modified_at,omitempty"`      // The last modified date of the web page (if found).
 	NetInfo                 *neti.NetInfo                    `json:"net_info"`                   // The network information of the web page.
 	HTTPInfo                *httpi.HTTPDetails               `json:"http_info"`                  // The HTTP header information of the web page.
 	ScrapedData             []ScrapedItem                    `json:"scraped_data"`               // The scraped data from the web page.
+	Extracted               map[string]interface{}           `json:"extracted,omitempty"`        // The fields of the custom content extractors.
 	Links                   []LinkItem                       `json:"links"`                      // The links found in the web page.
+	Forms                   []PageForm                       `json:"forms"`                      // The forms found in the web page.
+	Media                   []MediaInfo                      `json:"media,omitempty"`            // The video and audio media found in the web page.
+	Enrichment              *PageEnrichment                  `json:"enrichment,omitempty"`       // The NLP enrichment (sentiment, entities and topics) of the body text.
+	Breadcrumbs             []string                         `json:"breadcrumbs,omitempty"`      // The breadcrumb trail of the web page (from the site root to the page).
+	CanonicalURL            string                           `json:"canonical_url,omitempty"`    // The canonical URL of the web page (if it declares one).
+	AMPURL                  string                           `json:"amp_url,omitempty"`          // The URL of the AMP version of the web page (if it declares one).
+	AMPContent              bool                             `json:"amp_content,omitempty"`      // Whether the body text of the web page has been extracted from its AMP version.
+	Truncated               bool                             `json:"truncated,omitempty"`        // Whether the body text of the web page has been truncated (max_body_text_bytes).
+	Security                PageSecurity                     `json:"security"`                   // The security flags of the web page.
+	Errors                  []string                         `json:"errors,omitempty"`           // Non-fatal errors found while processing the web page.
 	PerfInfo                PerformanceLog                   `json:"performance"`                // The performance information of the web page.
 	DetectedTech            map[string]detect.DetectedEntity `json:"detected_tech"`              // The detected technologies of the web page.
 	ExtDetectionResults     []map[string]interface{}         `json:"external_detection_results"` // The results of the external detection tools.
@@ -98,6 +122,62 @@ type PageInfo struct {
 	Config                  *cfg.Config                      `json:"config"`                     // The configuration of the web page.
 }
 
+// PageSecurity represents the security flags of a web page, as detected from
+// the captured network data.
+type PageSecurity struct {
+	Insecure          bool     `json:"insecure"`                     // Whether the page was served over an insecure connection.
+	MixedContent      bool     `json:"mixed_content"`                // Whether an HTTPS page loaded resources over HTTP.
+	InsecureResources []string `json:"insecure_resources,omitempty"` // The resources loaded over HTTP (if any).
+}
+
+// PageForm represents a single form found in a web page.
+type PageForm struct {
+	ID     string      `json:"id,omitempty"`   // The form's id attribute (if any).
+	Name   string      `json:"name,omitempty"` // The form's name attribute (if any).
+	Action string      `json:"action"`         // The URL the form is submitted to.
+	Method string      `json:"method"`         // The HTTP method used to submit the form.
+	Fields []FormField `json:"fields"`         // The fields of the form.
+}
+
+// FormField represents a single field of a form.
+type FormField struct {
+	Name     string `json:"name,omitempty"`  // The field's name attribute (empty for fields without a name).
+	ID       string `json:"id,omitempty"`    // The field's id attribute (if any).
+	Type     string `json:"type"`            // The field type (e.g., text, password, email, select, textarea).
+	Label    string `json:"label,omitempty"` // The field's label (label element, aria-label or placeholder).
+	Required bool   `json:"required"`        // Whether the field is required or not.
+}
+
+// MediaInfo represents a single video or audio media found in a web page (a
+// video or audio element or an embedded player).
+type MediaInfo struct {
+	Type     string `json:"type"`                // The media type (video or audio).
+	Src      string `json:"src"`                 // The URL of the media (or of its embedded player).
+	MIMEType string `json:"mime_type,omitempty"` // The MIME type of the media source (if declared).
+	Provider string `json:"provider,omitempty"`  // The provider of the embedded player (e.g., youtube, vimeo).
+	Poster   string `json:"poster,omitempty"`    // The URL of the poster image of the media (if any).
+	Duration int    `json:"duration,omitempty"`  // The duration of the media in seconds (if available).
+}
+
+// PageEnrichment represents the NLP enrichment of the body text of a web page.
+type PageEnrichment struct {
+	Sentiment *Sentiment `json:"sentiment,omitempty"` // The sentiment of the text (if detected).
+	Entities  []Entity   `json:"entities,omitempty"`  // The named entities found in the text.
+	Topics    []string   `json:"topics,omitempty"`    // The topics of the text.
+}
+
+// Sentiment represents the sentiment of a text.
+type Sentiment struct {
+	Label string  `json:"label"` // The sentiment label (e.g., positive, neutral or negative).
+	Score float64 `json:"score"` // The sentiment score (e.g., from -1, negative, to 1, positive).
+}
+
+// Entity represents a named entity found in a text.
+type Entity struct {
+	Text string `json:"text"`           // The entity as found in the text.
+	Type string `json:"type,omitempty"` // The entity type (e.g., person, organization or location).
+}
+
 // CollectedScript represents a single collected script.
 type CollectedScript struct {
 	ID           uint64   `json:"id"`
@@ -155,7 +235,7 @@ type LogResponseInfo struct {
 	Headers                map[string]string  `json:"headers,omitempty"`                // The headers of the response.
 	RequestID              string             `json:"requestId"`                        // The ID of the request.
 	ResourceIPAddressSpace string             `json:"resourceIPAddressSpace,omitempty"` // The IP address space of the resource.
-	StatusCode             int                `json:"statusCode"`                       // The status code of the response.
+	StatusCode             int                `json:"status"`                           // The status code of the response.
 	StatusText             string             `json:"statusText"`                       // The status text of the response.
 	MimeType               string             `json:"mimeType,omitempty"`               // The MIME type of the response.
 	Protocol               string             `json:"protocol,omitempty"`               // The protocol of the response.
@@ -277,10 +357,11 @@ type ScraperRuleEngine struct {
 
 // LinkItem represents a link item collected on a web page
 type LinkItem struct {
-	PageURL   string `json:"url"`
-	PageLevel int    `json:"level"`
-	Link      string `json:"link"`
-	ElementID string `json:"element_id"`
+	PageURL    string `json:"url"`
+	PageLevel  int    `json:"level"`
+	Link       string `json:"link"`
+	ElementID  string `json:"element_id"`
+	AnchorText string `json:"anchor_text"`
 }
 
 const (
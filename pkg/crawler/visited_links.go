@@ -0,0 +1,118 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crawler implements the crawling logic of the application.
+// It's responsible for crawling a website and extracting information from it.
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const (
+	visitedLinksBloom = "bloom"
+)
+
+// VisitedLinks keeps track of the links visited while crawling a Source
+type VisitedLinks interface {
+	Add(url string)
+	Has(url string) bool
+}
+
+// visitedLinksMap is the exact implementation of VisitedLinks (default)
+type visitedLinksMap struct {
+	links map[string]bool
+	mutex sync.RWMutex
+}
+
+func (v *visitedLinksMap) Add(url string) {
+	v.mutex.Lock()
+	v.links[url] = true
+	v.mutex.Unlock()
+}
+
+func (v *visitedLinksMap) Has(url string) bool {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	return v.links[url]
+}
+
+// visitedLinksBloomFilter is the bounded memory implementation of VisitedLinks,
+// for very large crawls. It may report a few links as visited when they are not
+// (at the configured false-positive rate).
+type visitedLinksBloomFilter struct {
+	bf *cmn.BloomFilter
+}
+
+func (v *visitedLinksBloomFilter) Add(url string) {
+	v.bf.Add(url)
+}
+
+func (v *visitedLinksBloomFilter) Has(url string) bool {
+	return v.bf.Test(url)
+}
+
+// newVisitedLinks returns the VisitedLinks set configured for the given Source.
+// When using a bloom filter with a state path, the filter of a previously
+// interrupted crawl of the same Source is restored (if any).
+func newVisitedLinks(conf cfg.VisitedLinks, sourceID uint64) VisitedLinks {
+	if conf.Type != visitedLinksBloom {
+		return &visitedLinksMap{links: make(map[string]bool)}
+	}
+
+	if conf.StatePath != "" {
+		path := visitedLinksStateFile(conf, sourceID)
+		if _, err := os.Stat(path); err == nil {
+			bf, err := cmn.LoadBloomFilterFromFile(path)
+			if err == nil {
+				cmn.DebugMsg(cmn.DbgLvlInfo, "Resuming visited links of source %d from '%s' (%d links)", sourceID, path, bf.Count())
+				return &visitedLinksBloomFilter{bf: bf}
+			}
+			cmn.DebugMsg(cmn.DbgLvlError, "restoring visited links: %v", err)
+		}
+	}
+	return &visitedLinksBloomFilter{bf: cmn.NewBloomFilter(conf.Capacity, conf.FalsePositiveRate)}
+}
+
+// visitedLinksStateFile returns the file used to persist the visited links of a Source
+func visitedLinksStateFile(conf cfg.VisitedLinks, sourceID uint64) string {
+	return filepath.Join(conf.StatePath, fmt.Sprintf("visited-%d.bloom", sourceID))
+}
+
+// persistVisitedLinks saves the visited links of an interrupted crawl, so it can be
+// resumed, or removes the saved state when the crawl has completed successfully.
+// It's a no-op for the exact (map) implementation or when no state path is configured.
+func persistVisitedLinks(conf cfg.VisitedLinks, sourceID uint64, visited VisitedLinks, completed bool) error {
+	v, ok := visited.(*visitedLinksBloomFilter)
+	if !ok || conf.StatePath == "" {
+		return nil
+	}
+
+	path := visitedLinksStateFile(conf, sourceID)
+	if completed {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing visited links state: %v", err)
+		}
+		return nil
+	}
+	return v.bf.SaveToFile(path)
+}
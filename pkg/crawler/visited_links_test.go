@@ -0,0 +1,62 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crawler
+
+import (
+	"testing"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+func TestVisitedLinks(t *testing.T) {
+	url := "https://www.example.com/page"
+
+	// Exact set (default)
+	visited := newVisitedLinks(cfg.VisitedLinks{Type: "map"}, 1)
+	if _, ok := visited.(*visitedLinksMap); !ok {
+		t.Fatalf("Expected a map based set, got %T", visited)
+	}
+	visited.Add(url)
+	if !visited.Has(url) || visited.Has(url+"/other") {
+		t.Errorf("Unexpected result from the map based set")
+	}
+
+	// Bloom filter, persisted on interrupted crawls and restored on resume
+	conf := cfg.VisitedLinks{Type: "bloom", Capacity: 1000, FalsePositiveRate: 0.001, StatePath: t.TempDir()}
+	visited = newVisitedLinks(conf, 1)
+	if _, ok := visited.(*visitedLinksBloomFilter); !ok {
+		t.Fatalf("Expected a bloom filter based set, got %T", visited)
+	}
+	visited.Add(url)
+	if err := persistVisitedLinks(conf, 1, visited, false); err != nil {
+		t.Fatalf("persistVisitedLinks returned an error: %v", err)
+	}
+
+	resumed := newVisitedLinks(conf, 1)
+	if !resumed.Has(url) {
+		t.Errorf("Expected resumed set to contain %s", url)
+	}
+	if newVisitedLinks(conf, 2).Has(url) {
+		t.Errorf("Expected a different source to start with an empty set")
+	}
+
+	// Once the crawl completes the saved state is removed
+	if err := persistVisitedLinks(conf, 1, resumed, true); err != nil {
+		t.Fatalf("persistVisitedLinks returned an error: %v", err)
+	}
+	if newVisitedLinks(conf, 1).Has(url) {
+		t.Errorf("Expected a fresh set after the crawl completed")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database setup, configuration and abstraction.
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// The status of the CrawlQueue entries
+const (
+	CrawlQueuePending    = "pending"
+	CrawlQueueProcessing = "processing"
+	CrawlQueueDone       = "done"
+	CrawlQueueError      = "error"
+)
+
+const (
+	enqueueCrawlURLQuery  = `INSERT INTO CrawlQueue (source_id, url, page_url, anchor_text, element_id, depth) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (source_id, url) DO NOTHING`
+	dequeueCrawlURLsQuery = `
+	UPDATE CrawlQueue SET status = 'processing', last_updated_at = NOW()
+	WHERE queue_id IN (
+		SELECT queue_id FROM CrawlQueue
+		WHERE source_id = $1 AND depth = $2 AND status = 'pending'
+		ORDER BY queue_id
+		FOR UPDATE SKIP LOCKED)
+	RETURNING queue_id, source_id, url, COALESCE(page_url, ''), COALESCE(anchor_text, ''), COALESCE(element_id, ''), depth, status`
+	setCrawlURLStatusQuery   = `UPDATE CrawlQueue SET status = $3, last_updated_at = NOW() WHERE source_id = $1 AND url = $2`
+	resetCrawlQueueQuery     = `UPDATE CrawlQueue SET status = 'pending', last_updated_at = NOW() WHERE source_id = $1 AND status = 'processing'`
+	pendingCrawlDepthQuery   = `SELECT MIN(depth) FROM CrawlQueue WHERE source_id = $1 AND status = 'pending'`
+	crawledURLsQuery         = `SELECT url FROM CrawlQueue WHERE source_id = $1 AND status IN ('done', 'error')`
+	clearCrawlQueueQuery     = `DELETE FROM CrawlQueue WHERE source_id = $1`
+	resumeQueuedSourcesQuery = `
+	UPDATE Sources SET status = 'pending', last_updated_at = NOW()
+	WHERE LOWER(TRIM(status)) = 'processing' AND engine LIKE $1
+	  AND source_id IN (SELECT source_id FROM CrawlQueue WHERE status IN ('pending', 'processing'))`
+)
+
+// EnqueueCrawlURLs adds the URLs found at depth to the crawl queue of a
+// Source. The URLs already in the queue (at any depth and in any status) are
+// not added again.
+func EnqueueCrawlURLs(db *Handler, sourceID uint64, items []CrawlQueueItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	tx, err := (*db).Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	for _, item := range items {
+		if _, err = tx.Exec(enqueueCrawlURLQuery, sourceID, item.URL, item.PageURL, item.AnchorText, item.ElementID, item.Depth); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to rollback transaction: %w (original error: %v)", rollbackErr, err)
+		}
+		return fmt.Errorf("failed to enqueue the URLs of source with ID %d: %w", sourceID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DequeueCrawlURLs returns the pending URLs at depth of the crawl queue of a
+// Source, marking them as processing.
+func DequeueCrawlURLs(db *Handler, sourceID uint64, depth int) ([]CrawlQueueItem, error) {
+	rows, err := (*db).ExecuteQuery(dequeueCrawlURLsQuery, sourceID, depth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue the URLs of source with ID %d: %v", sourceID, err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check return value on defer
+
+	var items []CrawlQueueItem
+	for rows.Next() {
+		var item CrawlQueueItem
+		if err := rows.Scan(&item.ID, &item.SourceID, &item.URL, &item.PageURL, &item.AnchorText, &item.ElementID, &item.Depth, &item.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan crawl queue item: %v", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// SetCrawlURLStatus sets the status (done or error) of a URL of the crawl
+// queue of a Source.
+func SetCrawlURLStatus(db *Handler, sourceID uint64, url string, status string) error {
+	if _, err := (*db).Exec(setCrawlURLStatusQuery, sourceID, url, status); err != nil {
+		return fmt.Errorf("failed to set the status of '%s' of source with ID %d: %v", url, sourceID, err)
+	}
+	return nil
+}
+
+// ResumeCrawlQueue prepares the crawl queue of a Source left unfinished by an
+// interrupted crawl: the URLs being processed are set back to pending. It
+// returns the lowest depth with pending URLs (false if there are none).
+func ResumeCrawlQueue(db *Handler, sourceID uint64) (int, bool, error) {
+	if _, err := (*db).Exec(resetCrawlQueueQuery, sourceID); err != nil {
+		return 0, false, fmt.Errorf("failed to reset the crawl queue of source with ID %d: %v", sourceID, err)
+	}
+	var depth sql.NullInt64
+	if err := (*db).QueryRow(pendingCrawlDepthQuery, sourceID).Scan(&depth); err != nil {
+		return 0, false, fmt.Errorf("failed to read the crawl queue of source with ID %d: %v", sourceID, err)
+	}
+	return int(depth.Int64), depth.Valid, nil
+}
+
+// GetCrawledURLs returns the URLs of the crawl queue of a Source that have
+// already been crawled (successfully or not).
+func GetCrawledURLs(db *Handler, sourceID uint64) ([]string, error) {
+	rows, err := (*db).ExecuteQuery(crawledURLsQuery, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the crawled URLs of source with ID %d: %v", sourceID, err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check return value on defer
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("failed to scan crawled URL: %v", err)
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// ClearCrawlQueue removes the crawl queue of a Source (once it has been
+// crawled completely).
+func ClearCrawlQueue(db *Handler, sourceID uint64) error {
+	if _, err := (*db).Exec(clearCrawlQueueQuery, sourceID); err != nil {
+		return fmt.Errorf("failed to clear the crawl queue of source with ID %d: %v", sourceID, err)
+	}
+	return nil
+}
+
+// ResumeQueuedSources sets back to pending the Sources left processing, with
+// an unfinished crawl queue, by a previous instance of the engine running on
+// host (the engine IDs are "<hostname>:<pid>:<ppid>"), so they are picked up
+// again without waiting for the processing timeout. It returns the number of
+// Sources resumed.
+func ResumeQueuedSources(db *Handler, host string) (int64, error) {
+	result, err := (*db).Exec(resumeQueuedSourcesQuery, host+":%")
+	if err != nil {
+		return 0, fmt.Errorf("failed to resume the queued sources: %v", err)
+	}
+	resumed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count the resumed sources: %v", err)
+	}
+	return resumed, nil
+}
@@ -1,8 +1,18 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 )
@@ -35,6 +45,34 @@ func TestBuildConnectionString(t *testing.T) {
 			},
 			expected: "host=example.com port=5433 user=customuser password=custompassword dbname=customdb sslmode=require",
 		},
+		{
+			name: "Test case 3: SSL enabled",
+			config: cfg.Config{
+				Database: cfg.Database{SSLMode: "enable"},
+			},
+			expected: "host=localhost port=5432 user=crowler password= dbname=SitesIndex sslmode=require",
+		},
+		{
+			name: "Test case 4: Invalid SSL mode",
+			config: cfg.Config{
+				Database: cfg.Database{SSLMode: "sometimes"},
+			},
+			expected: "host=localhost port=5432 user=crowler password= dbname=SitesIndex sslmode=disable",
+		},
+		{
+			name: "Test case 5: Server certificate verification",
+			config: cfg.Config{
+				Database: cfg.Database{SSLMode: "verify-full", SSLRootCert: "/etc/crowler/certs/rds ca.pem"},
+			},
+			expected: "host=localhost port=5432 user=crowler password= dbname=SitesIndex sslmode=verify-full sslrootcert='/etc/crowler/certs/rds ca.pem'",
+		},
+		{
+			name: "Test case 6: CA certificate without SSL",
+			config: cfg.Config{
+				Database: cfg.Database{SSLRootCert: "/etc/crowler/certs/ca.pem"},
+			},
+			expected: "host=localhost port=5432 user=crowler password= dbname=SitesIndex sslmode=disable",
+		},
 	}
 
 	// Run tests
@@ -48,6 +86,40 @@ func TestBuildConnectionString(t *testing.T) {
 	}
 }
 
+func TestDetermineConnectionLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		database cfg.Database
+		maxConns int
+		maxIdle  int
+	}{
+		{"Defaults", cfg.Database{}, 25, 25},
+		{"Default configuration", cfg.NewConfig().Database, 25, 25},
+		{"Optimized for writes", cfg.Database{OptimizeFor: "write"}, 100, 100},
+		{"Configured limits", cfg.Database{OptimizeFor: "query", MaxConns: 200, MaxIdleConns: 50}, 200, 50},
+		{"Idle connections capped", cfg.Database{MaxConns: 10, MaxIdleConns: 50}, 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxConns, maxIdle := ConnectionLimits(cfg.Config{Database: tt.database})
+			if maxConns != tt.maxConns || maxIdle != tt.maxIdle {
+				t.Errorf("ConnectionLimits() = %d, %d, want %d, %d", maxConns, maxIdle, tt.maxConns, tt.maxIdle)
+			}
+		})
+	}
+
+	// The pool of the connections follows the configuration
+	db, err := sql.Open(sqliteDriverName, "file:"+filepath.Join(t.TempDir(), "pool.db"))
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	defer db.Close() //nolint:errcheck // We can't check the error in a defer
+	SetConnectionPool(db, cfg.Config{Database: cfg.Database{MaxConns: 7, MaxIdleConns: 3, ConnMaxLifetime: 60}})
+	if stats := db.Stats(); stats.MaxOpenConnections != 7 {
+		t.Errorf("Expected 7 max open connections, got %d", stats.MaxOpenConnections)
+	}
+}
+
 func TestNewHandler(t *testing.T) {
 	// Test cases
 	tests := []struct {
@@ -80,17 +152,31 @@ func TestNewHandler(t *testing.T) {
 			name: "Test case 3: Unsupported database type",
 			config: cfg.Config{
 				Database: cfg.Database{
-					Type: "mysql",
+					Type: "oracle",
 				},
 			},
 			expectedType: nil,
-			expectedErr:  fmt.Errorf("unsupported database type: 'mysql'"),
+			expectedErr:  fmt.Errorf("unsupported database type: 'oracle'"),
+		},
+		{
+			name: "Test case 4: The driver overrides the type",
+			config: cfg.Config{
+				Database: cfg.Database{
+					Driver: "SQLite",
+					Type:   DBPostgresStr,
+				},
+			},
+			expectedType: &SQLiteHandler{},
+			expectedErr:  nil,
 		},
 	}
 
 	// Run tests
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
+			if _, ok := test.expectedType.(*SQLiteHandler); ok && !sqliteBuiltIn {
+				t.Skip("SQLite isn't available without cgo")
+			}
 			handler, err := NewHandler(test.config)
 
 			if (err != nil && test.expectedErr == nil) || (err == nil && test.expectedErr != nil) || (err != nil && err.Error() != test.expectedErr.Error()) {
@@ -114,3 +200,810 @@ func TestNewHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestSourceRestricted(t *testing.T) {
+	tests := []struct {
+		name         string
+		restricted   sql.NullInt64
+		defaultLevel int
+		expected     uint
+		wantErr      bool
+	}{
+		{"NULL uses the default level", sql.NullInt64{}, 2, 2, false},
+		{"Source level is kept", sql.NullInt64{Int64: 3, Valid: true}, 2, 3, false},
+		{"Fully restricted source", sql.NullInt64{Int64: 0, Valid: true}, 2, 0, false},
+		{"Unrestricted source", sql.NullInt64{Int64: 4, Valid: true}, 0, 4, false},
+		{"Negative level is rejected", sql.NullInt64{Int64: -1, Valid: true}, 1, 1, true},
+		{"Level above 4 is rejected", sql.NullInt64{Int64: 5, Valid: true}, 1, 1, true},
+		{"Invalid default level", sql.NullInt64{}, 7, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SourceRestricted(tt.restricted, tt.defaultLevel)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SourceRestricted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("SourceRestricted() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeSourceURL(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/":             "https://example.com",
+		" HTTP://Example.COM:80/Path/ ":    "http://example.com/Path",
+		"https://example.com:443/?q=1#top": "https://example.com?q=1",
+		"https://example.com:8443/a//":     "https://example.com:8443/a",
+		"example.com/":                     "example.com",
+	}
+	for in, expected := range tests {
+		if got := NormalizeSourceURL(in); got != expected {
+			t.Errorf("NormalizeSourceURL(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+// fakeSourcesConn is a minimal database/sql driver connection that keeps the
+// Sources table URLs (and statuses and tags) in memory (enough for
+// CreateSource and RecrawlSources)
+type fakeSourcesConn struct {
+	urls    map[uint64]string
+	status  map[uint64]string
+	tags    map[uint64][]string
+	updates int
+}
+
+func (c *fakeSourcesConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeSourcesConn) Driver() driver.Driver                        { return nil }
+func (c *fakeSourcesConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeSourcesConn) Close() error              { return nil }
+func (c *fakeSourcesConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeSourcesConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.HasPrefix(strings.TrimSpace(query), "UPDATE Sources SET status = 'pending'") {
+		return c.recrawl(query, args), nil
+	}
+	if !strings.HasPrefix(strings.TrimSpace(query), "UPDATE Sources") {
+		return nil, fmt.Errorf("unexpected statement: %s", query)
+	}
+	c.urls[uint64(args[len(args)-1].Value.(int64))] = args[0].Value.(string)
+	c.updates++
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeSourcesConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query = strings.TrimSpace(query)
+	switch {
+	case strings.HasPrefix(query, "SELECT source_id FROM Sources WHERE url IN"):
+		for id := uint64(1); id <= uint64(len(c.urls)); id++ {
+			for _, arg := range args {
+				if c.urls[id] == arg.Value.(string) {
+					return &fakeSourcesRows{id: id}, nil
+				}
+			}
+		}
+		return &fakeSourcesRows{}, nil
+	case strings.HasPrefix(query, "INSERT INTO Sources"):
+		id := uint64(len(c.urls) + 1)
+		c.urls[id] = args[0].Value.(string)
+		return &fakeSourcesRows{id: id}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", query)
+}
+
+// recrawl sets the (optionally tagged) sources back to pending
+func (c *fakeSourcesConn) recrawl(query string, args []driver.NamedValue) driver.Result {
+	var scheduled int64
+	for id := range c.urls {
+		if strings.Contains(query, "SourceTagIndex WHERE tag = $1") {
+			tagged := false
+			for _, tag := range c.tags[id] {
+				tagged = tagged || tag == args[0].Value.(string)
+			}
+			if !tagged {
+				continue
+			}
+		}
+		c.status[id] = "pending"
+		scheduled++
+	}
+	return driver.RowsAffected(scheduled)
+}
+
+type fakeSourcesRows struct{ id uint64 }
+
+func (r *fakeSourcesRows) Columns() []string { return []string{"source_id"} }
+func (r *fakeSourcesRows) Close() error      { return nil }
+func (r *fakeSourcesRows) Next(dest []driver.Value) error {
+	if r.id == 0 {
+		return io.EOF
+	}
+	dest[0], r.id = int64(r.id), 0
+	return nil
+}
+
+// fakeSourcesHandler is a database handler backed by a fakeSourcesConn
+type fakeSourcesHandler struct {
+	Handler
+	db *sql.DB
+}
+
+func (h *fakeSourcesHandler) QueryRow(query string, args ...interface{}) *sql.Row {
+	return h.db.QueryRow(query, args...)
+}
+
+func (h *fakeSourcesHandler) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return h.db.Exec(query, args...)
+}
+
+func TestCreateSourceDeduplicatesEquivalentURLs(t *testing.T) {
+	conn := &fakeSourcesConn{urls: make(map[uint64]string)}
+	var db Handler = &fakeSourcesHandler{db: sql.OpenDB(conn)}
+
+	newConfig := func(site string) cfg.SourceConfig {
+		return cfg.SourceConfig{
+			Version:        "1.0",
+			FormatVersion:  "1.0",
+			SourceName:     "Example",
+			CrawlingConfig: cfg.CrawlingConfig{Site: site},
+		}
+	}
+
+	first, err := CreateSource(&db, &Source{URL: "http://example.com"}, newConfig("http://example.com"))
+	if err != nil {
+		t.Fatalf("Failed to create the first source: %v", err)
+	}
+	second, err := CreateSource(&db, &Source{URL: "https://Example.com/"}, newConfig("https://example.com/"))
+	if err != nil {
+		t.Fatalf("Failed to create the second source: %v", err)
+	}
+
+	if first != second {
+		t.Errorf("Expected both URLs to resolve to the same source, got IDs %d and %d", first, second)
+	}
+	if len(conn.urls) != 1 || conn.updates != 1 {
+		t.Errorf("Expected a single (updated) source, got %d sources and %d updates", len(conn.urls), conn.updates)
+	}
+	if conn.urls[first] != "https://example.com" {
+		t.Errorf("Expected the source URL to be normalized, got %q", conn.urls[first])
+	}
+
+	// A different site is a different source
+	other, err := CreateSource(&db, &Source{URL: "https://example.org"}, newConfig("https://example.org"))
+	if err != nil || other == first {
+		t.Errorf("Expected a new source for a different site, got ID %d (%v)", other, err)
+	}
+
+	// The paths are case-sensitive
+	lower, err := CreateSource(&db, &Source{URL: "https://EXAMPLE.org/docs"}, newConfig("https://example.org/docs"))
+	if err != nil {
+		t.Fatalf("Failed to create the source of a path: %v", err)
+	}
+	upper, err := CreateSource(&db, &Source{URL: "http://example.org/Docs/"}, newConfig("http://example.org/Docs/"))
+	if err != nil || upper == lower {
+		t.Errorf("Expected a new source for a path differing in case, got ID %d (%v)", upper, err)
+	}
+	again, err := CreateSource(&db, &Source{URL: "HTTP://Example.ORG/docs/"}, newConfig("http://example.org/docs/"))
+	if err != nil || again != lower {
+		t.Errorf("Expected the same source for the same path, got ID %d (%v), expected %d", again, err, lower)
+	}
+}
+
+func TestRecrawlSourcesByTag(t *testing.T) {
+	conn := &fakeSourcesConn{
+		urls: map[uint64]string{
+			1: "https://news.example.com",
+			2: "https://blog.example.com",
+			3: "https://press.example.org",
+		},
+		status: map[uint64]string{1: "completed", 2: "completed", 3: "completed"},
+		tags: map[uint64][]string{
+			1: NormalizeSourceTags([]string{"News", "en"}),
+			2: NormalizeSourceTags([]string{"blog"}),
+			3: NormalizeSourceTags([]string{" news ", "news"}),
+		},
+	}
+	var db Handler = &fakeSourcesHandler{db: sql.OpenDB(conn)}
+
+	scheduled, err := RecrawlSources(&db, " NEWS")
+	if err != nil {
+		t.Fatalf("RecrawlSources() error = %v", err)
+	}
+	if scheduled != 2 {
+		t.Errorf("Expected 2 sources scheduled for recrawl, got %d", scheduled)
+	}
+	expected := map[uint64]string{1: "pending", 2: "completed", 3: "pending"}
+	for id, status := range expected {
+		if conn.status[id] != status {
+			t.Errorf("Expected source %d to be %q, got %q", id, status, conn.status[id])
+		}
+	}
+
+	// Without a tag all the sources are scheduled
+	if scheduled, err := RecrawlSources(&db, ""); err != nil || scheduled != 3 {
+		t.Errorf("Expected all the 3 sources scheduled for recrawl, got %d (%v)", scheduled, err)
+	}
+}
+
+func TestNormalizeSourceTags(t *testing.T) {
+	got := NormalizeSourceTags([]string{" News", "news", "", "Tech ", strings.Repeat("x", maxSourceTagLength+1)})
+	expected := []string{"news", "tech"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("NormalizeSourceTags() = %v, expected %v", got, expected)
+	}
+}
+
+// fakeQueueConn is a minimal database/sql driver connection that keeps the
+// CrawlQueue table of a source in memory
+type fakeQueueConn struct {
+	queue []CrawlQueueItem
+}
+
+func (c *fakeQueueConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeQueueConn) Driver() driver.Driver                        { return nil }
+func (c *fakeQueueConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeQueueConn) Close() error              { return nil }
+func (c *fakeQueueConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeQueueConn) Commit() error             { return nil }
+func (c *fakeQueueConn) Rollback() error           { return nil }
+
+func (c *fakeQueueConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var affected int64
+	switch query {
+	case enqueueCrawlURLQuery:
+		for _, item := range c.queue {
+			if item.URL == args[1].Value.(string) {
+				return driver.RowsAffected(0), nil
+			}
+		}
+		c.queue = append(c.queue, CrawlQueueItem{
+			ID:         uint64(len(c.queue) + 1),
+			SourceID:   uint64(args[0].Value.(int64)),
+			URL:        args[1].Value.(string),
+			PageURL:    args[2].Value.(string),
+			AnchorText: args[3].Value.(string),
+			ElementID:  args[4].Value.(string),
+			Depth:      int(args[5].Value.(int64)),
+			Status:     CrawlQueuePending,
+		})
+		affected = 1
+	case setCrawlURLStatusQuery:
+		for i := range c.queue {
+			if c.queue[i].URL == args[1].Value.(string) {
+				c.queue[i].Status = args[2].Value.(string)
+				affected++
+			}
+		}
+	case resetCrawlQueueQuery:
+		for i := range c.queue {
+			if c.queue[i].Status == CrawlQueueProcessing {
+				c.queue[i].Status = CrawlQueuePending
+				affected++
+			}
+		}
+	case clearCrawlQueueQuery:
+		affected, c.queue = int64(len(c.queue)), nil
+	default:
+		return nil, fmt.Errorf("unexpected statement: %s", query)
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (c *fakeQueueConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows := &fakeQueueRows{}
+	switch query {
+	case dequeueCrawlURLsQuery:
+		rows.columns = []string{"queue_id", "source_id", "url", "page_url", "anchor_text", "element_id", "depth", "status"}
+		for i, item := range c.queue {
+			if item.Depth == int(args[1].Value.(int64)) && item.Status == CrawlQueuePending {
+				c.queue[i].Status = CrawlQueueProcessing
+				rows.values = append(rows.values, []driver.Value{int64(item.ID), int64(item.SourceID), item.URL, item.PageURL, item.AnchorText, item.ElementID, int64(item.Depth), CrawlQueueProcessing})
+			}
+		}
+	case pendingCrawlDepthQuery:
+		rows.columns = []string{"min"}
+		var depth driver.Value
+		for _, item := range c.queue {
+			if item.Status == CrawlQueuePending && (depth == nil || int64(item.Depth) < depth.(int64)) {
+				depth = int64(item.Depth)
+			}
+		}
+		rows.values = [][]driver.Value{{depth}}
+	case crawledURLsQuery:
+		rows.columns = []string{"url"}
+		for _, item := range c.queue {
+			if item.Status == CrawlQueueDone || item.Status == CrawlQueueError {
+				rows.values = append(rows.values, []driver.Value{item.URL})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	return rows, nil
+}
+
+type fakeQueueRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeQueueRows) Columns() []string { return r.columns }
+func (r *fakeQueueRows) Close() error      { return nil }
+func (r *fakeQueueRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeQueueHandler is a database handler backed by a fakeQueueConn
+type fakeQueueHandler struct {
+	Handler
+	db *sql.DB
+}
+
+func (h *fakeQueueHandler) Begin() (*sql.Tx, error) { return h.db.Begin() }
+
+func (h *fakeQueueHandler) QueryRow(query string, args ...interface{}) *sql.Row {
+	return h.db.QueryRow(query, args...)
+}
+
+func (h *fakeQueueHandler) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return h.db.Exec(query, args...)
+}
+
+func (h *fakeQueueHandler) ExecuteQuery(query string, args ...interface{}) (*sql.Rows, error) {
+	return h.db.Query(query, args...)
+}
+
+func TestCrawlQueue(t *testing.T) {
+	conn := &fakeQueueConn{}
+	var db Handler = &fakeQueueHandler{db: sql.OpenDB(conn)}
+
+	err := EnqueueCrawlURLs(&db, 1, []CrawlQueueItem{
+		{URL: "https://example.com/a", PageURL: "https://example.com"},
+		{URL: "https://example.com/b", PageURL: "https://example.com", AnchorText: "Products", ElementID: "nav-products"},
+	})
+	if err != nil {
+		t.Fatalf("EnqueueCrawlURLs() error = %v", err)
+	}
+	// A URL already queued isn't queued again at a deeper level
+	err = EnqueueCrawlURLs(&db, 1, []CrawlQueueItem{
+		{URL: "https://example.com/a", PageURL: "https://example.com/b", Depth: 1},
+		{URL: "https://example.com/c", PageURL: "https://example.com/b", Depth: 1},
+	})
+	if err != nil {
+		t.Fatalf("EnqueueCrawlURLs() error = %v", err)
+	}
+	if len(conn.queue) != 3 {
+		t.Fatalf("Expected 3 queued URLs, got %d", len(conn.queue))
+	}
+
+	items, err := DequeueCrawlURLs(&db, 1, 0)
+	if err != nil || len(items) != 2 || items[1].URL != "https://example.com/b" || items[1].Status != CrawlQueueProcessing {
+		t.Fatalf("DequeueCrawlURLs() = %+v (%v), want the 2 URLs at depth 0 processing", items, err)
+	}
+	if items[1].AnchorText != "Products" || items[1].ElementID != "nav-products" {
+		t.Errorf("DequeueCrawlURLs() = %+v, want the anchor text and the element ID of the link", items[1])
+	}
+	if err := SetCrawlURLStatus(&db, 1, "https://example.com/a", CrawlQueueDone); err != nil {
+		t.Fatalf("SetCrawlURLStatus() error = %v", err)
+	}
+
+	// The crawl is interrupted while processing https://example.com/b
+	depth, pending, err := ResumeCrawlQueue(&db, 1)
+	if err != nil || !pending || depth != 0 {
+		t.Fatalf("ResumeCrawlQueue() = %d, %v (%v), want depth 0 pending", depth, pending, err)
+	}
+	crawled, err := GetCrawledURLs(&db, 1)
+	if err != nil || !reflect.DeepEqual(crawled, []string{"https://example.com/a"}) {
+		t.Errorf("GetCrawledURLs() = %v (%v), want [https://example.com/a]", crawled, err)
+	}
+	if items, _ := DequeueCrawlURLs(&db, 1, 0); len(items) != 1 || items[0].URL != "https://example.com/b" {
+		t.Errorf("DequeueCrawlURLs() = %+v, want the interrupted URL", items)
+	}
+
+	if err := ClearCrawlQueue(&db, 1); err != nil {
+		t.Fatalf("ClearCrawlQueue() error = %v", err)
+	}
+	if _, pending, err := ResumeCrawlQueue(&db, 1); err != nil || pending {
+		t.Errorf("ResumeCrawlQueue() = %v (%v), want nothing pending after clearing the queue", pending, err)
+	}
+}
+
+func TestRewriteQuery(t *testing.T) {
+	tests := []struct {
+		dbms      string
+		query     string
+		expected  string
+		argOrder  []int
+		returning string
+	}{
+		{
+			dbms:     DBSQLiteStr,
+			query:    `INSERT INTO SearchIndex (page_url, title, last_updated_at) VALUES ($1, $2, NOW()) ON CONFLICT (page_url) DO UPDATE SET title = EXCLUDED.title RETURNING index_id`,
+			expected: `INSERT INTO SearchIndex (page_url, title, last_updated_at) VALUES (?1, ?2, CURRENT_TIMESTAMP) ON CONFLICT (page_url) DO UPDATE SET title = EXCLUDED.title RETURNING index_id`,
+		},
+		{
+			dbms:     DBSQLiteStr,
+			query:    `SELECT id FROM CrawlQueue WHERE url ILIKE $2 AND status = 'NOW()::text $1' AND depth = $1::int FOR UPDATE SKIP LOCKED`,
+			expected: `SELECT id FROM CrawlQueue WHERE url LIKE ?2 AND status = 'NOW()::text $1' AND depth = ?1`,
+		},
+		{
+			dbms:      DBMySQLStr,
+			query:     `INSERT INTO WebObjects (object_hash, details) VALUES ($1, $2::jsonb) ON CONFLICT (object_hash) DO UPDATE SET details = EXCLUDED.details RETURNING object_id;`,
+			expected:  `INSERT INTO WebObjects (object_hash, details) VALUES (?, ?) ON DUPLICATE KEY UPDATE details = VALUES(details), object_id = LAST_INSERT_ID(object_id)`,
+			argOrder:  []int{0, 1},
+			returning: "object_id",
+		},
+		{
+			dbms:      DBMySQLStr,
+			query:     `INSERT INTO Sources (url, name) VALUES ($2, $1) RETURNING source_id`,
+			expected:  `INSERT INTO Sources (url, name) VALUES (?, ?)`,
+			argOrder:  []int{1, 0},
+			returning: "source_id",
+		},
+		{
+			dbms:     DBMySQLStr,
+			query:    `INSERT INTO SourceTagIndex (source_id, tag) VALUES ($1, $2) ON CONFLICT (source_id, tag) DO NOTHING`,
+			expected: `INSERT IGNORE INTO SourceTagIndex (source_id, tag) VALUES (?, ?)`,
+			argOrder: []int{0, 1},
+		},
+		{
+			dbms:     DBMySQLStr,
+			query:    `UPDATE CrawlQueue SET status = $3 WHERE source_id = $1 AND url = $2 AND page_url <> $2`,
+			expected: `UPDATE CrawlQueue SET status = ? WHERE source_id = ? AND url = ? AND page_url <> ?`,
+			argOrder: []int{2, 0, 1, 1},
+		},
+	}
+
+	for _, test := range tests {
+		q := rewriteQuery(test.dbms, test.query)
+		if q.err != nil {
+			t.Errorf("rewriteQuery(%s, %q) error = %v", test.dbms, test.query, q.err)
+			continue
+		}
+		if q.query != test.expected {
+			t.Errorf("rewriteQuery(%s, %q) = %q, expected %q", test.dbms, test.query, q.query, test.expected)
+		}
+		if !reflect.DeepEqual(q.argOrder, test.argOrder) || q.returning != test.returning {
+			t.Errorf("rewriteQuery(%s, %q) arguments %v returning %q, expected %v returning %q",
+				test.dbms, test.query, q.argOrder, q.returning, test.argOrder, test.returning)
+		}
+	}
+
+	// The JSON arguments are bound as text
+	q := rewriteQuery(DBMySQLStr, `INSERT INTO NetInfo (details_hash, details) VALUES ($1, $2::jsonb)`)
+	args, err := q.bind([]driver.NamedValue{{Ordinal: 1, Value: "hash"}, {Ordinal: 2, Value: []byte(`{"a":1}`)}})
+	if err != nil || args[1].Value != `{"a":1}` {
+		t.Errorf("bind() = %v, %v, expected the JSON argument as a string", args, err)
+	}
+	if _, err := q.bind([]driver.NamedValue{{Ordinal: 1, Value: "hash"}}); err == nil {
+		t.Errorf("bind() with a missing argument didn't fail")
+	}
+
+	// Multiple columns can't be returned by MySQL
+	if q := rewriteQuery(DBMySQLStr, `UPDATE CrawlQueue SET status = 'processing' RETURNING queue_id, url`); q.err == nil {
+		t.Errorf("Expected RETURNING multiple columns to be unsupported by MySQL")
+	}
+
+	// The cache of the rewritten queries is bounded
+	for i := 0; i < maxRewrittenQueries+10; i++ {
+		q := rewriteQuery(DBSQLiteStr, fmt.Sprintf("SELECT source_id FROM Sources WHERE source_id IN (%d)", i))
+		if q.err != nil {
+			t.Fatalf("rewriteQuery() error = %v", q.err)
+		}
+	}
+	if n := rewrittenCount.Load(); n > maxRewrittenQueries {
+		t.Errorf("Expected at most %d cached queries, got %d", maxRewrittenQueries, n)
+	}
+}
+
+// newSQLiteHandler returns a handler connected to a new SQLite database
+func newSQLiteHandler(t *testing.T) Handler {
+	t.Helper()
+	conf := cfg.NewConfig()
+	conf.Database.Driver = cfg.DBDriverSQLite
+	conf.Database.DBName = filepath.Join(t.TempDir(), "crowler.db")
+	if !sqliteBuiltIn {
+		t.Skip("SQLite isn't available without cgo")
+	}
+	db, err := NewHandler(*conf)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	if err := db.Connect(*conf); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestSQLiteSources(t *testing.T) {
+	db := newSQLiteHandler(t)
+	if db.DBMS() != DBSQLiteStr {
+		t.Errorf("DBMS() = %q, expected %q", db.DBMS(), DBSQLiteStr)
+	}
+
+	newConfig := func(site string) cfg.SourceConfig {
+		return cfg.SourceConfig{
+			Version:        "1.0",
+			FormatVersion:  "1.0",
+			SourceName:     "Example",
+			CrawlingConfig: cfg.CrawlingConfig{Site: site},
+		}
+	}
+	first, err := CreateSource(&db, &Source{URL: "http://example.com", Name: "Example"}, newConfig("http://example.com"))
+	if err != nil {
+		t.Fatalf("Failed to create the first source: %v", err)
+	}
+	second, err := CreateSource(&db, &Source{URL: "https://Example.com/"}, newConfig("https://example.com/"))
+	if err != nil || second != first {
+		t.Fatalf("Expected the equivalent source %d to be updated, got %d (%v)", first, second, err)
+	}
+	other, err := CreateSource(&db, &Source{URL: "https://example.org"}, newConfig("https://example.org"))
+	if err != nil || other == first {
+		t.Fatalf("Expected a new source for a different site, got %d (%v)", other, err)
+	}
+
+	source, err := GetSourceByID(&db, first)
+	if err != nil {
+		t.Fatalf("GetSourceByID() error = %v", err)
+	}
+	if source.URL != "https://example.com" || source.Config == nil || !strings.Contains(string(*source.Config), `"source_name":"Example"`) {
+		t.Errorf("GetSourceByID() = %+v, expected the updated source", source)
+	}
+
+	if err := SetSourceTags(&db, first, []string{"News", "news", "en"}); err != nil {
+		t.Fatalf("SetSourceTags() error = %v", err)
+	}
+	if tags, err := GetSourceTags(&db, first); err != nil || !reflect.DeepEqual(tags, []string{"en", "news"}) {
+		t.Errorf("GetSourceTags() = %v, %v, expected [en news]", tags, err)
+	}
+	if scheduled, err := RecrawlSources(&db, "news"); err != nil || scheduled != 1 {
+		t.Errorf("RecrawlSources() = %d, %v, expected 1 source scheduled", scheduled, err)
+	}
+	if sources, err := GetSourcesByStatus(&db, "pending"); err != nil || len(sources) != 1 || sources[0].ID != first {
+		t.Errorf("GetSourcesByStatus() = %v, %v, expected source %d", sources, err, first)
+	}
+
+	if err := DeleteSource(&db, other); err != nil {
+		t.Fatalf("DeleteSource() error = %v", err)
+	}
+	if sources, err := ListSources(&db, nil, nil); err != nil || len(sources) != 1 {
+		t.Errorf("ListSources() = %v, %v, expected 1 source", sources, err)
+	}
+}
+
+func TestPurgeSource(t *testing.T) {
+	db := newSQLiteHandler(t)
+	newConfig := func(site string) cfg.SourceConfig {
+		return cfg.SourceConfig{Version: "1.0", FormatVersion: "1.0", SourceName: site, CrawlingConfig: cfg.CrawlingConfig{Site: site}}
+	}
+	sourceA, err := CreateSource(&db, &Source{URL: "https://a.example.com"}, newConfig("https://a.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to create source A: %v", err)
+	}
+	sourceB, err := CreateSource(&db, &Source{URL: "https://b.example.com"}, newConfig("https://b.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to create source B: %v", err)
+	}
+
+	// Page 1 is old, page 2 is recent and page 3 (old) is shared with source B
+	fixtures := []string{
+		`INSERT INTO SearchIndex (index_id, page_url, summary, last_updated_at) VALUES
+			(1, 'https://a.example.com/old', '', '2020-01-01 00:00:00'),
+			(2, 'https://a.example.com/new', '', CURRENT_TIMESTAMP),
+			(3, 'https://shared.example.com/', '', '2020-01-01 00:00:00')`,
+		fmt.Sprintf(`INSERT INTO SourceSearchIndex (source_id, index_id) VALUES (%d, 1), (%d, 2), (%d, 3), (%d, 3)`, sourceA, sourceA, sourceA, sourceB),
+		`INSERT INTO Screenshots (index_id, screenshot_link, thumbnail_link) VALUES (1, 'shots/old.png', 'shots/old-thumb.png'), (3, 'shots/shared.png', '')`,
+		`INSERT INTO Keywords (keyword_id, keyword) VALUES (1, 'old'), (2, 'common'), (3, 'shared')`,
+		`INSERT INTO KeywordIndex (keyword_id, index_id, occurrences) VALUES (1, 1, 1), (2, 1, 1), (2, 2, 1), (3, 3, 1)`,
+		`INSERT INTO MetaTags (metatag_id, name, content) VALUES (1, 'author', 'A')`,
+		`INSERT INTO MetaTagsIndex (index_id, metatag_id) VALUES (1, 1)`,
+		`INSERT INTO WebObjects (object_id, object_hash, details) VALUES (1, 'hash-1', '{"scraped_data":[]}')`,
+		`INSERT INTO WebObjectsIndex (index_id, object_id) VALUES (1, 1)`,
+		`INSERT INTO HTTPInfo (httpinfo_id, details_hash, details) VALUES (1, 'hash-1', '{}')`,
+		`INSERT INTO HTTPInfoIndex (httpinfo_id, index_id) VALUES (1, 1)`,
+		`INSERT INTO NetInfo (netinfo_id, details_hash, details) VALUES (1, 'hash-1', '{}')`,
+		`INSERT INTO NetInfoIndex (netinfo_id, index_id) VALUES (1, 2)`,
+		`INSERT INTO PageForms (index_id, details) VALUES (1, '[]')`,
+		`INSERT INTO PageHTML (index_id, html_hash, html_gzip) VALUES (2, 'hash-2', x'00')`,
+		fmt.Sprintf(`INSERT INTO ServiceScoutScans (source_id, scanned_at) VALUES (%d, '2020-01-01 00:00:00'), (%d, CURRENT_TIMESTAMP)`, sourceA, sourceA),
+		fmt.Sprintf(`INSERT INTO CrawlQueue (source_id, url) VALUES (%d, 'https://a.example.com/next')`, sourceA),
+	}
+	for _, fixture := range fixtures {
+		if _, err := db.Exec(fixture); err != nil {
+			t.Fatalf("Failed to insert the fixture %q: %v", fixture, err)
+		}
+	}
+	checkCounts := func(step string, expected map[string]int) {
+		t.Helper()
+		for table, want := range expected {
+			var got int
+			if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&got); err != nil {
+				t.Fatalf("%s: counting %s: %v", step, table, err)
+			}
+			if got != want {
+				t.Errorf("%s: %s has %d rows, expected %d", step, table, got, want)
+			}
+		}
+	}
+
+	// The data older than the retention period
+	purged, err := PurgeSource(&db, sourceA, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("PurgeSource() error = %v", err)
+	}
+	if purged.Pages != 1 || purged.Unlinked != 1 || !reflect.DeepEqual(purged.Files, []string{"shots/old.png", "shots/old-thumb.png"}) {
+		t.Errorf("PurgeSource() = %+v, expected 1 page removed, 1 unlinked and its 2 files", purged)
+	}
+	checkCounts("retention", map[string]int{
+		"SearchIndex": 2, "SourceSearchIndex": 2, "Screenshots": 1, "Keywords": 2, "KeywordIndex": 2,
+		"MetaTags": 0, "MetaTagsIndex": 0, "WebObjects": 0, "WebObjectsIndex": 0, "HTTPInfo": 0, "HTTPInfoIndex": 0,
+		"NetInfo": 1, "PageForms": 0, "PageHTML": 1, "ServiceScoutScans": 1, "CrawlQueue": 1,
+	})
+
+	// All the data of the source (source B keeps the shared page)
+	purged, err = PurgeSource(&db, sourceA, time.Time{})
+	if err != nil {
+		t.Fatalf("PurgeSource() error = %v", err)
+	}
+	if purged.Pages != 1 || purged.Unlinked != 0 || len(purged.Files) != 0 {
+		t.Errorf("PurgeSource() = %+v, expected 1 page removed", purged)
+	}
+	checkCounts("all", map[string]int{
+		"SearchIndex": 1, "SourceSearchIndex": 1, "Screenshots": 1, "Keywords": 1, "KeywordIndex": 1,
+		"NetInfo": 0, "NetInfoIndex": 0, "PageHTML": 0, "ServiceScoutScans": 0, "CrawlQueue": 0, "Sources": 2,
+	})
+	var sharedSource uint64
+	if err := db.QueryRow("SELECT source_id FROM SourceSearchIndex WHERE index_id = 3").Scan(&sharedSource); err != nil || sharedSource != sourceB {
+		t.Errorf("Expected the shared page to be kept for source %d, got %d (%v)", sourceB, sharedSource, err)
+	}
+
+	if _, err := PurgeSource(&db, 0, time.Time{}); err == nil {
+		t.Errorf("PurgeSource() without a source didn't fail")
+	}
+}
+
+func TestUpdateSourcesSkipLocked(t *testing.T) {
+	content, err := os.ReadFile("postgresql-setup-v1.5.pgsql")
+	if err != nil {
+		t.Fatalf("reading the PostgreSQL setup: %v", err)
+	}
+	setup := string(content)
+	start := strings.Index(setup, "CREATE OR REPLACE FUNCTION update_sources(")
+	if start < 0 {
+		t.Fatalf("update_sources not found in the PostgreSQL setup")
+	}
+	end := strings.Index(setup[start:], "LANGUAGE plpgsql;")
+	if end < 0 {
+		t.Fatalf("end of update_sources not found in the PostgreSQL setup")
+	}
+	fn := setup[start : start+end]
+
+	// The sources locked by a concurrent call are skipped (so two engines
+	// never get the same source), and the locking clause follows the LIMIT
+	limit := strings.Index(fn, "LIMIT limit_val")
+	lock := strings.Index(fn, "FOR UPDATE SKIP LOCKED")
+	if lock < 0 {
+		t.Fatalf("update_sources doesn't skip the locked sources")
+	}
+	if limit < 0 || lock < limit {
+		t.Errorf("update_sources locks the sources before its LIMIT")
+	}
+	if strings.Count(fn, "FOR UPDATE") != 1 {
+		t.Errorf("update_sources has %d locking clauses, expected 1", strings.Count(fn, "FOR UPDATE"))
+	}
+
+	// The regular re-crawling includes the crawls stopped by their stop condition
+	if !strings.Contains(fn, "IN ('completed', 'completed-with-found')") {
+		t.Errorf("update_sources doesn't re-crawl the sources completed with their target found")
+	}
+}
+
+func TestSQLiteSourcesToCrawl(t *testing.T) {
+	db := newSQLiteHandler(t)
+	newConfig := func(site string) cfg.SourceConfig {
+		return cfg.SourceConfig{
+			Version:        "1.0",
+			FormatVersion:  "1.0",
+			SourceName:     "Example",
+			CrawlingConfig: cfg.CrawlingConfig{Site: site},
+		}
+	}
+	var ids []uint64
+	for _, site := range []string{"https://example.com", "https://example.org", "https://example.net"} {
+		id, err := CreateSource(&db, &Source{URL: site}, newConfig(site))
+		if err != nil {
+			t.Fatalf("Failed to create source %s: %v", site, err)
+		}
+		ids = append(ids, id)
+	}
+	conf := cfg.NewConfig()
+	crawler := conf.Crawler
+	crawler.DefaultRestricted = 1
+
+	// The new sources are fetched (at most limit) and marked as processing
+	first, err := SourcesToCrawl(&db, 2, "engine-1", crawler)
+	if err != nil || len(first) != 2 {
+		t.Fatalf("SourcesToCrawl() = %v, %v, expected 2 sources", first, err)
+	}
+	if first[0].Config == nil || first[0].URL == "" {
+		t.Errorf("SourcesToCrawl() = %+v, expected the source URL and configuration", first[0])
+	}
+	second, err := SourcesToCrawl(&db, 2, "engine-2", crawler)
+	if err != nil || len(second) != 1 || second[0].ID == first[0].ID || second[0].ID == first[1].ID {
+		t.Fatalf("SourcesToCrawl() = %v, %v, expected the source not fetched yet", second, err)
+	}
+	if none, err := SourcesToCrawl(&db, 2, "engine-1", crawler); err != nil || len(none) != 0 {
+		t.Errorf("SourcesToCrawl() = %v, %v, expected no sources (all processing)", none, err)
+	}
+	var engine string
+	if err := db.QueryRow(`SELECT engine FROM Sources WHERE source_id = $1`, second[0].ID).Scan(&engine); err != nil || engine != "engine-2" {
+		t.Errorf("engine = %q, %v, expected engine-2", engine, err)
+	}
+
+	// The completed sources are re-crawled after the crawling interval, the
+	// ones in error after the crawling_if_error interval
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	if _, err := db.Exec(`UPDATE Sources SET status = 'completed', last_updated_at = $2 WHERE source_id = $1`, ids[0], old); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE Sources SET status = 'error', last_updated_at = $2 WHERE source_id = $1`, ids[1], old); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+	crawler.CrawlingInterval = "3 hours"
+	crawler.CrawlingIfError = "1 hour"
+	if sources, err := SourcesToCrawl(&db, 10, "engine-1", crawler); err != nil || len(sources) != 1 || sources[0].ID != ids[1] {
+		t.Errorf("SourcesToCrawl() = %v, %v, expected source %d (in error)", sources, err, ids[1])
+	}
+	crawler.CrawlingInterval = "1 hour"
+	if sources, err := SourcesToCrawl(&db, 10, "engine-1", crawler); err != nil || len(sources) != 1 || sources[0].ID != ids[0] {
+		t.Errorf("SourcesToCrawl() = %v, %v, expected source %d (completed)", sources, err, ids[0])
+	}
+	if _, err := db.Exec(`UPDATE Sources SET status = 'completed-with-found', last_updated_at = $2 WHERE source_id = $1`, ids[2], old); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+	if sources, err := SourcesToCrawl(&db, 10, "engine-1", crawler); err != nil || len(sources) != 1 || sources[0].ID != ids[2] {
+		t.Errorf("SourcesToCrawl() = %v, %v, expected source %d (completed with the target found)", sources, err, ids[2])
+	}
+
+	crawler.CrawlingInterval = "1 fortnight"
+	if _, err := SourcesToCrawl(&db, 10, "engine-1", crawler); err == nil {
+		t.Errorf("SourcesToCrawl() expected an error for an invalid interval")
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"15 minutes", 15 * time.Minute, false},
+		{"1 day", 24 * time.Hour, false},
+		{"1 day 12 hours", 36 * time.Hour, false},
+		{"2 Weeks", 14 * 24 * time.Hour, false},
+		{"30 sec", 30 * time.Second, false},
+		{"1.5 hours", 90 * time.Minute, false},
+		{"day", 0, true},
+		{"1 fortnight", 0, true},
+		{"-1 day", 0, true},
+	}
+	for _, tt := range tests {
+		d, err := parseInterval(tt.interval)
+		if (err != nil) != tt.wantErr || d != tt.expected {
+			t.Errorf("parseInterval(%q) = %v, %v, expected %v (error: %v)", tt.interval, d, err, tt.expected, tt.wantErr)
+		}
+	}
+}
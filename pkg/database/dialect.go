@@ -0,0 +1,465 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package database is responsible for handling the database
+// setup, configuration and abstraction.
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// maxRewrittenQueries is the maximum number of rewritten queries kept in the
+// cache (the queries built with IN lists are different for every list length,
+// the ones past the limit are rewritten every time)
+const maxRewrittenQueries = 4096
+
+// The CROWler queries are written in the PostgreSQL dialect. The handlers of
+// the other DBMS open their databases through a dialectDriver, which rewrites
+// the queries in the dialect of the DBMS, so the same queries (and the
+// transactions using them) work on every backend.
+
+var (
+	reCast         = regexp.MustCompile(`::[A-Za-z_][A-Za-z0-9_]*(\(\d+(,\s*\d+)?\))?(\[\])?`)
+	reJSONArg      = regexp.MustCompile(`(?i)\$(\d+)::jsonb?\b`)
+	rePlaceholder  = regexp.MustCompile(`\$(\d+)`)
+	reNow          = regexp.MustCompile(`(?i)\bNOW\(\)`)
+	reILike        = regexp.MustCompile(`(?i)\bILIKE\b`)
+	reRowLocks     = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE(\s+SKIP\s+LOCKED)?\b`)
+	reUpsert       = regexp.MustCompile(`(?i)\bON\s+CONFLICT\s*(\([^)]*\))?\s*DO\s+UPDATE\s+SET\b`)
+	reDoNothing    = regexp.MustCompile(`(?i)\s*\bON\s+CONFLICT\s*(\([^)]*\))?\s*DO\s+NOTHING\b`)
+	reInsert       = regexp.MustCompile(`(?i)^(\s*)INSERT\s+INTO\b`)
+	reExcluded     = regexp.MustCompile(`(?i)\bEXCLUDED\.([A-Za-z_][A-Za-z0-9_]*)`)
+	reReturning    = regexp.MustCompile(`(?is)\s+RETURNING\s+(.+?)\s*;?\s*$`)
+	reColumn       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	rewrittenCache sync.Map     // The rewritten queries (by DBMS and query)
+	rewrittenCount atomic.Int64 // The number of queries in rewrittenCache
+)
+
+// dialectQuery is a query rewritten in the dialect of a DBMS
+type dialectQuery struct {
+	query     string
+	argOrder  []int        // The index of the argument of each placeholder (nil if the arguments are passed as they are).
+	jsonArgs  map[int]bool // The indexes of the arguments cast to JSON (passed as strings, not as blobs).
+	returning string       // The RETURNING column emulated after running the statement (MySQL only).
+	upsert    bool         // If the (emulated) RETURNING statement is an upsert.
+	err       error        // The reason the query can't be rewritten (if any).
+}
+
+// rewriteQuery rewrites a query from the PostgreSQL dialect to the dialect of
+// the DBMS. The string literals of the query are never rewritten.
+func rewriteQuery(dbms, query string) *dialectQuery {
+	key := dbms + "\x00" + query
+	if q, ok := rewrittenCache.Load(key); ok {
+		return q.(*dialectQuery)
+	}
+
+	masked, literals := maskLiterals(query)
+	q := &dialectQuery{jsonArgs: map[int]bool{}}
+	for _, m := range reJSONArg.FindAllStringSubmatch(masked, -1) {
+		n, _ := strconv.Atoi(m[1])
+		q.jsonArgs[n-1] = true
+	}
+	masked = reCast.ReplaceAllString(masked, "")
+	masked = reILike.ReplaceAllString(masked, "LIKE")
+
+	switch dbms {
+	case DBSQLiteStr:
+		// SQLite supports upserts and RETURNING, the transactions are
+		// serialized (so the row locks are not needed)
+		masked = rePlaceholder.ReplaceAllString(masked, "?$1")
+		masked = reNow.ReplaceAllString(masked, "CURRENT_TIMESTAMP")
+		masked = reRowLocks.ReplaceAllString(masked, "")
+	case DBMySQLStr:
+		masked = q.rewriteMySQL(masked)
+	}
+	q.query = unmaskLiterals(masked, literals)
+
+	if rewrittenCount.Load() < maxRewrittenQueries {
+		if _, loaded := rewrittenCache.LoadOrStore(key, q); !loaded {
+			rewrittenCount.Add(1)
+		}
+	}
+	return q
+}
+
+// rewriteMySQL rewrites the MySQL specific parts of a (masked) query
+func (q *dialectQuery) rewriteMySQL(query string) string {
+	// RETURNING is emulated with LAST_INSERT_ID(), so it works only for a
+	// single column of an INSERT
+	if m := reReturning.FindStringSubmatchIndex(query); m != nil {
+		column := strings.TrimSpace(query[m[2]:m[3]])
+		if !reInsert.MatchString(query) || !reColumn.MatchString(column) {
+			q.err = fmt.Errorf("MySQL doesn't support RETURNING %s in this statement", column)
+			return query
+		}
+		q.returning = column
+		query = query[:m[0]]
+	}
+
+	if reDoNothing.MatchString(query) {
+		query = reDoNothing.ReplaceAllString(query, "")
+		query = reInsert.ReplaceAllString(query, "${1}INSERT IGNORE INTO")
+	}
+	if reUpsert.MatchString(query) {
+		q.upsert = true
+		query = reUpsert.ReplaceAllString(query, "ON DUPLICATE KEY UPDATE")
+		query = reExcluded.ReplaceAllString(query, "VALUES($1)")
+		if q.returning != "" {
+			// Return the ID of the updated row too
+			query += fmt.Sprintf(", %s = LAST_INSERT_ID(%s)", q.returning, q.returning)
+		}
+	}
+
+	// MySQL placeholders are positional, so the arguments are reordered
+	// (and repeated) as the placeholders appear in the query
+	q.argOrder = []int{}
+	query = rePlaceholder.ReplaceAllStringFunc(query, func(p string) string {
+		n, _ := strconv.Atoi(p[1:])
+		q.argOrder = append(q.argOrder, n-1)
+		return "?"
+	})
+	return query
+}
+
+// maskLiterals replaces the string literals and quoted identifiers of a query
+// with placeholders (so they are not rewritten)
+func maskLiterals(query string) (string, []string) {
+	var masked strings.Builder
+	var literals []string
+	for i := 0; i < len(query); i++ {
+		quote := query[i]
+		if quote != '\'' && quote != '"' {
+			masked.WriteByte(quote)
+			continue
+		}
+		end := i + 1
+		for end < len(query) {
+			if query[end] == quote {
+				if end+1 < len(query) && query[end+1] == quote {
+					end += 2 // Escaped quote
+					continue
+				}
+				break
+			}
+			end++
+		}
+		if end >= len(query) {
+			end = len(query) - 1
+		}
+		literals = append(literals, query[i:end+1])
+		fmt.Fprintf(&masked, "\x00%d\x00", len(literals)-1)
+		i = end
+	}
+	return masked.String(), literals
+}
+
+// unmaskLiterals restores the string literals masked by maskLiterals
+func unmaskLiterals(query string, literals []string) string {
+	for i, literal := range literals {
+		query = strings.Replace(query, fmt.Sprintf("\x00%d\x00", i), literal, 1)
+	}
+	return query
+}
+
+// bind returns the arguments of the rewritten query
+func (q *dialectQuery) bind(args []driver.NamedValue) ([]driver.NamedValue, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	bound := args
+	if q.argOrder != nil {
+		bound = make([]driver.NamedValue, len(q.argOrder))
+		for i, n := range q.argOrder {
+			if n < 0 || n >= len(args) {
+				return nil, fmt.Errorf("missing argument $%d of the query", n+1)
+			}
+			bound[i] = driver.NamedValue{Ordinal: i + 1, Value: args[n].Value}
+		}
+	}
+	if len(q.jsonArgs) > 0 {
+		bound = append([]driver.NamedValue(nil), bound...)
+		for i, arg := range bound {
+			n := i
+			if q.argOrder != nil {
+				n = q.argOrder[i]
+			}
+			if b, ok := arg.Value.([]byte); ok && q.jsonArgs[n] {
+				// JSON documents must be stored as text
+				bound[i].Value = string(b)
+			}
+		}
+	}
+	return bound, nil
+}
+
+// ---------------------------------------------------------------
+// Dialect driver
+// ---------------------------------------------------------------
+
+// dialectDriver wraps the driver of a DBMS, rewriting the queries in its
+// dialect
+type dialectDriver struct {
+	driver driver.Driver
+	dbms   string
+}
+
+// Open opens a connection to the database
+func (d *dialectDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &dialectConn{conn: conn, dbms: d.dbms}, nil
+}
+
+// dialectConn is a connection of a dialectDriver
+type dialectConn struct {
+	conn driver.Conn
+	dbms string
+}
+
+func (c *dialectConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *dialectConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	q := rewriteQuery(c.dbms, query)
+	if q.err != nil {
+		return nil, q.err
+	}
+	stmt, err := c.prepare(ctx, q.query)
+	if err != nil {
+		return nil, err
+	}
+	return &dialectStmt{stmt: stmt, query: q}, nil
+}
+
+// prepare prepares a (rewritten) query on the wrapped connection
+func (c *dialectConn) prepare(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.conn.Prepare(query)
+}
+
+func (c *dialectConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *dialectConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *dialectConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin() //nolint:staticcheck // Drivers without BeginTx
+}
+
+func (c *dialectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	q := rewriteQuery(c.dbms, query)
+	bound, err := q.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if execer, ok := c.conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, q.query, bound)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *dialectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q := rewriteQuery(c.dbms, query)
+	bound, err := q.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if q.returning != "" {
+		return c.execReturning(ctx, q, bound)
+	}
+	if queryer, ok := c.conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, q.query, bound)
+	}
+	return nil, driver.ErrSkip
+}
+
+// execReturning runs a statement with an emulated RETURNING clause
+func (c *dialectConn) execReturning(ctx context.Context, q *dialectQuery, args []driver.NamedValue) (driver.Rows, error) {
+	if execer, ok := c.conn.(driver.ExecerContext); ok {
+		result, err := execer.ExecContext(ctx, q.query, args)
+		if err != driver.ErrSkip {
+			if err != nil {
+				return nil, err
+			}
+			return q.returningRows(result)
+		}
+	}
+	stmt, err := c.prepare(ctx, q.query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close() //nolint:errcheck // We can't check the error in a defer
+	return (&dialectStmt{stmt: stmt, query: q}).execReturning(ctx, args)
+}
+
+func (c *dialectConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *dialectConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *dialectConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *dialectConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// dialectStmt is a prepared statement of a dialectConn
+type dialectStmt struct {
+	stmt  driver.Stmt
+	query *dialectQuery
+}
+
+func (s *dialectStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *dialectStmt) NumInput() int {
+	// The arguments are checked by bind (they may be reordered)
+	return -1
+}
+
+func (s *dialectStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *dialectStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *dialectStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	bound, err := s.query.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.exec(ctx, bound)
+}
+
+func (s *dialectStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	bound, err := s.query.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if s.query.returning != "" {
+		return s.execReturning(ctx, bound)
+	}
+	if queryer, ok := s.stmt.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, bound)
+	}
+	return s.stmt.Query(values(bound)) //nolint:staticcheck // Drivers without QueryContext
+}
+
+// exec runs the statement with the (bound) arguments
+func (s *dialectStmt) exec(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := s.stmt.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+	return s.stmt.Exec(values(args)) //nolint:staticcheck // Drivers without ExecContext
+}
+
+// execReturning runs the statement with an emulated RETURNING clause
+func (s *dialectStmt) execReturning(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := s.exec(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return s.query.returningRows(result)
+}
+
+// returningRows returns the rows of an emulated RETURNING clause: the ID of
+// the inserted (or updated) row, no rows if the row was ignored
+func (q *dialectQuery) returningRows(result driver.Result) (driver.Rows, error) {
+	rows := &returningRows{column: q.returning}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected > 0 || q.upsert {
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		rows.ids = []int64{id}
+	}
+	return rows, nil
+}
+
+// returningRows are the rows of an emulated RETURNING clause
+type returningRows struct {
+	column string
+	ids    []int64
+}
+
+func (r *returningRows) Columns() []string { return []string{r.column} }
+func (r *returningRows) Close() error      { return nil }
+func (r *returningRows) Next(dest []driver.Value) error {
+	if len(r.ids) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.ids[0]
+	r.ids = r.ids[1:]
+	return nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		vals[i] = arg.Value
+	}
+	return vals
+}
@@ -12,11 +12,15 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build mysql
+
 // Package database is responsible for handling the database
 // setup, configuration and abstraction.
 package database
 
-/* Commented out to avoid issues with the Licensing, you need to uncomment it to use it.
+// The MySQL driver is MPL-2.0 licensed, so the MySQL support is built only
+// with the mysql build tag (go build -tags mysql).
+
 import (
 	"database/sql"
 	"fmt"
@@ -26,9 +30,22 @@ import (
 	cmn "github.com/pzaino/thecrowler/pkg/common"
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 
-	_ "github.com/go-sql-driver/mysql" // MySQL driver
+	"github.com/go-sql-driver/mysql" // MySQL driver
 )
 
+// mysqlDriverName is the name of the MySQL driver rewriting the queries in
+// the MySQL dialect
+const mysqlDriverName = "crowler-mysql"
+
+func init() {
+	sql.Register(mysqlDriverName, &dialectDriver{driver: &mysql.MySQLDriver{}, dbms: DBMySQLStr})
+}
+
+// newMySQLHandler returns a new MySQL Handler
+func newMySQLHandler() (Handler, error) {
+	return &MySQLHandler{dbms: DBMySQLStr}, nil
+}
+
 // ---------------------------------------------------------------
 // MySQL handlers
 // ---------------------------------------------------------------
@@ -46,7 +63,7 @@ func (handler *MySQLHandler) Connect(c cfg.Config) error {
 	var err error
 	for {
 		// Connect to the database
-		handler.db, err = sql.Open("mysql", connectionString)
+		handler.db, err = sql.Open(mysqlDriverName, connectionString)
 		if err != nil {
 			cmn.DebugMsg(cmn.DbgLvlError, "connecting to the database: %v", err)
 			time.Sleep(time.Duration(c.Database.RetryTime) * time.Second)
@@ -68,23 +85,13 @@ func (handler *MySQLHandler) Connect(c cfg.Config) error {
 
 	// Set the database management system
 	optFor := strings.ToLower(strings.TrimSpace(c.Database.OptimizeFor))
-	if optFor == "" || optFor == "none" {
-		handler.db.SetConnMaxLifetime(time.Minute * 5)
-		handler.db.SetMaxOpenConns(25)
-		handler.db.SetMaxIdleConns(25)
-	}
 	if optFor == "write" {
 		handler.ConfigForWrite()
-		handler.db.SetConnMaxLifetime(time.Minute * 5)
-		handler.db.SetMaxOpenConns(100)
-		handler.db.SetMaxIdleConns(100)
 	}
 	if optFor == "query" {
 		handler.ConfigForQuery()
-		handler.db.SetConnMaxLifetime(time.Minute * 5)
-		handler.db.SetMaxOpenConns(100)
-		handler.db.SetMaxIdleConns(100)
 	}
+	SetConnectionPool(handler.db, c)
 
 	return err
 }
@@ -116,7 +123,7 @@ func buildMySQLConnectionString(c cfg.Config) string {
 		dbName = strings.TrimSpace(c.Database.DBName)
 	}
 
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
 		dbUser, dbPassword, dbHost, dbPort, dbName)
 
 	return connectionString
@@ -178,12 +185,19 @@ func (handler *MySQLHandler) CheckConnection(c cfg.Config) error {
 	return err
 }
 
+// NewListener returns a new Listener for the database (MySQL has no
+// notifications, so it's always nil)
+func (handler *MySQLHandler) NewListener() Listener {
+	return nil
+}
+
 // ---------------------------------------------------------------
 // Server Configuration
 
 // Note: MySQL doesn't support ALTER SYSTEM for dynamic reconfiguration like PostgreSQL.
 // You might need to adjust these configurations at the server level or use a tool like `my.cnf`.
 
+// ConfigForWrite tunes the MySQL server for write intensive workloads
 func (handler *MySQLHandler) ConfigForWrite() {
 	params := map[string]string{
 		"max_connections":                "1000",
@@ -209,6 +223,7 @@ func (handler *MySQLHandler) ConfigForWrite() {
 	}
 }
 
+// ConfigForQuery tunes the MySQL server for query intensive workloads
 func (handler *MySQLHandler) ConfigForQuery() {
 	params := map[string]string{
 		"max_connections":                "100",
@@ -233,5 +248,3 @@ func (handler *MySQLHandler) ConfigForQuery() {
 		}
 	}
 }
-
-*/
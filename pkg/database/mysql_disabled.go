@@ -0,0 +1,27 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !mysql
+
+// Package database is responsible for handling the database
+// setup, configuration and abstraction.
+package database
+
+import "fmt"
+
+// newMySQLHandler returns an error, the engine has been built without the
+// MySQL support (see mysql_db.go)
+func newMySQLHandler() (Handler, error) {
+	return nil, fmt.Errorf("unsupported database type: 'mysql' (the CROWler must be built with -tags mysql)")
+}
@@ -86,16 +86,29 @@ func (handler *PostgresHandler) Connect(c cfg.Config) error {
 	}
 
 	// Set connection parameters (open and idle connections)
-	mxConns, mxIdleConns := determineConnectionLimits(c)
-	handler.db.SetConnMaxLifetime(time.Minute * 5)
-	handler.db.SetMaxOpenConns(mxConns)
-	handler.db.SetMaxIdleConns(mxIdleConns)
+	SetConnectionPool(handler.db, c)
 
 	return err
 }
 
-// determineConnectionLimits calculates connection limits based on config
-func determineConnectionLimits(c cfg.Config) (int, int) {
+// SetConnectionPool sets the connection pool of a database connection from
+// the configuration: the maximum number of open and idle connections and the
+// maximum lifetime of the connections
+func SetConnectionPool(db *sql.DB, c cfg.Config) {
+	mxConns, mxIdleConns := ConnectionLimits(c)
+	lifetime := c.Database.ConnMaxLifetime
+	if lifetime < 1 {
+		lifetime = cfg.DefaultDBConnLifetime
+	}
+	db.SetConnMaxLifetime(time.Duration(lifetime) * time.Second)
+	db.SetMaxOpenConns(mxConns)
+	db.SetMaxIdleConns(mxIdleConns)
+}
+
+// ConnectionLimits returns the maximum number of open and idle connections
+// of the database connection pool: the built-in limits (of optimize_for),
+// unless the configuration sets them (0 keeps the built-in ones)
+func ConnectionLimits(c cfg.Config) (int, int) {
 	mxConns, mxIdleConns := 25, 25
 
 	optFor := strings.ToLower(strings.TrimSpace(c.Database.OptimizeFor))
@@ -105,17 +118,26 @@ func determineConnectionLimits(c cfg.Config) (int, int) {
 		mxIdleConns = 100
 	}
 
-	// Use config-defined max connections if smaller
-	if c.Database.MaxConns > 0 && c.Database.MaxConns < mxConns {
+	// The config-defined max connections override the defaults
+	if c.Database.MaxConns > 0 {
 		mxConns = c.Database.MaxConns
 	}
-	if c.Database.MaxIdleConns > 0 && c.Database.MaxIdleConns < mxIdleConns {
+	if c.Database.MaxIdleConns > 0 {
 		mxIdleConns = c.Database.MaxIdleConns
 	}
+	if mxIdleConns > mxConns {
+		mxIdleConns = mxConns
+	}
 
 	return mxConns, mxIdleConns
 }
 
+// ConnectionString returns the PostgreSQL connection string of the database
+// configuration
+func ConnectionString(c cfg.Config) string {
+	return buildConnectionString(c)
+}
+
 func buildConnectionString(c cfg.Config) string {
 	var dbPort int
 	if c.Database.Port == 0 {
@@ -148,17 +170,33 @@ func buildConnectionString(c cfg.Config) string {
 	} else {
 		sslmode := strings.ToLower(strings.TrimSpace(c.Database.SSLMode))
 		// Validate the SSL mode
-		if sslmode != optDisable && sslmode != "require" && sslmode != "verify-ca" && sslmode != "verify-full" {
+		switch sslmode {
+		case "enable":
+			sslmode = "require"
+		case optDisable, "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
 			sslmode = optDisable
 		}
 		dbSSLMode = sslmode
 	}
 	connectionString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		dbHost, dbPort, dbUser, dbPassword, dbName, dbSSLMode)
+	if sslRootCert := strings.TrimSpace(c.Database.SSLRootCert); sslRootCert != "" && dbSSLMode != optDisable {
+		connectionString += " sslrootcert=" + connectionStringValue(sslRootCert)
+	}
 
 	return connectionString
 }
 
+// connectionStringValue quotes a value of a connection string, if needed
+// (values with spaces, quotes or backslashes)
+func connectionStringValue(value string) string {
+	if !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(value) + "'"
+}
+
 // Close closes the database connection
 func (handler *PostgresHandler) Close() error {
 	return handler.db.Close()
@@ -18,6 +18,12 @@ type UpdateSourceRequest struct {
 	Flags      int             `json:"flags,omitempty"`      // Bitwise flags for the source
 	Config     json.RawMessage `json:"config,omitempty"`     // JSON configuration for the source
 	Details    json.RawMessage `json:"details,omitempty"`    // JSON details about the source's internal state
+	Tags       []string        `json:"tags,omitempty"`       // The tags of the source (replace the existing ones)
+}
+
+// RecrawlRequest represents the structure of the on-demand recrawl request
+type RecrawlRequest struct {
+	Tag string `json:"tag,omitempty"` // Only the sources with this tag are recrawled
 }
 
 // OwnerRequest represents the structure of the owner request
@@ -16,11 +16,16 @@
 package database
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	cmn "github.com/pzaino/thecrowler/pkg/common"
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 )
 
@@ -37,12 +42,120 @@ func GetSourceByID(db *Handler, sourceID uint64) (*Source, error) {
 	return source, nil
 }
 
+// SourceRestricted returns the restriction level (0-4) of a Source, as read from
+// the database. Sources without a restriction level (NULL) use defaultLevel.
+// Out of range levels are rejected, in which case defaultLevel is returned
+// together with an error.
+func SourceRestricted(restricted sql.NullInt64, defaultLevel int) (uint, error) {
+	if defaultLevel < 0 || defaultLevel > 4 {
+		defaultLevel = 0
+	}
+	if !restricted.Valid {
+		return uint(defaultLevel), nil
+	}
+	if restricted.Int64 < 0 || restricted.Int64 > 4 {
+		return uint(defaultLevel), fmt.Errorf("invalid restricted level %d (must be between 0 and 4)", restricted.Int64)
+	}
+	return uint(restricted.Int64), nil
+}
+
+// NormalizeSourceURL normalizes a Source URL, so equivalent URLs are stored the
+// same way: the scheme and the host are lowercased, default ports, fragments and
+// trailing slashes are removed (the path and the query are kept as they are).
+func NormalizeSourceURL(sourceURL string) string {
+	sourceURL = strings.TrimSpace(sourceURL)
+	u, err := url.Parse(sourceURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return strings.TrimRight(sourceURL, "/")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// EquivalentSourceURLs returns the URLs a Source URL is equivalent to: the same
+// normalized URL, with or without a trailing slash, and over both http and
+// https. Only the scheme and the host are case-insensitive (the Sources URLs are
+// stored normalized), the path and the query are compared as they are.
+func EquivalentSourceURLs(sourceURL string) []string {
+	normalized := NormalizeSourceURL(sourceURL)
+	if normalized == "" {
+		return nil
+	}
+
+	bases := []string{normalized}
+	for _, scheme := range []string{"http://", "https://"} {
+		if rest, ok := strings.CutPrefix(normalized, scheme); ok {
+			bases = []string{"http://" + rest, "https://" + rest}
+			break
+		}
+	}
+
+	var variants []string
+	for _, base := range bases {
+		variants = append(variants, base, base+"/")
+	}
+	return variants
+}
+
+// EquivalentSourceQuery returns the query (and its arguments) to find the ID of
+// the oldest Source equivalent to the given URL (see EquivalentSourceURLs).
+func EquivalentSourceQuery(sourceURL string) (string, []interface{}) {
+	variants := EquivalentSourceURLs(sourceURL)
+	placeholders := make([]string, len(variants))
+	args := make([]interface{}, len(variants))
+	for i, v := range variants {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = v
+	}
+	query := `SELECT source_id FROM Sources WHERE url IN (` + strings.Join(placeholders, ", ") + `) ORDER BY source_id LIMIT 1`
+	return query, args
+}
+
+// FindEquivalentSource returns the ID of the Source equivalent to the given URL
+// (0 if there is none), so the same site isn't added (and crawled) twice.
+func FindEquivalentSource(db *Handler, sourceURL string) (uint64, error) {
+	query, args := EquivalentSourceQuery(sourceURL)
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	var sourceID uint64
+	err := (*db).QueryRow(query, args...).Scan(&sourceID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look for an equivalent source: %v", err)
+	}
+	return sourceID, nil
+}
+
+// ErrInvalidSourceConfig is the error of the sources with an invalid
+// configuration
+var ErrInvalidSourceConfig = errors.New("invalid source configuration")
+
 // CreateSource inserts a new source into the database with detailed configuration validation and marshaling.
+// The source URL is normalized first and, if an equivalent source already exists,
+// that source is updated instead (and its ID returned).
 func CreateSource(db *Handler, source *Source, config cfg.SourceConfig) (uint64, error) {
 	// Validate the SourceConfig
 	err := validateSourceConfig(config)
 	if err != nil {
-		return 0, fmt.Errorf("invalid source configuration: %v", err)
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSourceConfig, err)
 	}
 
 	// Marshal the SourceConfig into JSONB format
@@ -51,7 +164,25 @@ func CreateSource(db *Handler, source *Source, config cfg.SourceConfig) (uint64,
 		return 0, fmt.Errorf("failed to marshal source configuration: %v", err)
 	}
 
-	var sourceID uint64
+	// Update the equivalent source (if any) rather than adding a duplicate
+	source.URL = NormalizeSourceURL(source.URL)
+	sourceID, err := FindEquivalentSource(db, source.URL)
+	if err != nil {
+		return 0, err
+	}
+	if sourceID != 0 {
+		query := `
+        UPDATE Sources
+        SET url = $1, name = $2, category_id = $3, usr_id = $4, restricted = $5, flags = $6, config = $7, last_updated_at = NOW()
+        WHERE source_id = $8
+    `
+		_, err = (*db).Exec(query, source.URL, source.Name, source.CategoryID, source.UsrID, source.Restricted, source.Flags, details, sourceID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update equivalent source with ID %d: %v", sourceID, err)
+		}
+		return sourceID, nil
+	}
+
 	query := `
         INSERT INTO Sources (url, name, category_id, usr_id, restricted, flags, config)
         VALUES ($1, $2, $3, $4, $5, $6, $7)
@@ -159,6 +290,129 @@ func VacuumSource(db *Handler, sourceID uint64) error {
 	return nil
 }
 
+// purgedPagesCondition returns the condition selecting the pages (the
+// SearchIndex rows of the given alias) purged for the Source $1: the pages of
+// the Source not linked to other Sources, last updated before $2 (if
+// olderThan is set)
+func purgedPagesCondition(alias string, olderThan time.Time) string {
+	condition := alias + `.index_id IN (SELECT index_id FROM SourceSearchIndex WHERE source_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM SourceSearchIndex other WHERE other.index_id = ` + alias + `.index_id AND other.source_id <> $1)`
+	if !olderThan.IsZero() {
+		condition += ` AND ` + alias + `.last_updated_at < $2`
+	}
+	return condition
+}
+
+// PurgeSource removes the crawled data of a Source (its pages with their
+// keywords, meta tags, web objects, screenshots, forms, media, raw HTML,
+// network and HTTP information, and its ServiceScout scans). If olderThan is
+// set, only the data last updated before it is removed (a retention period),
+// otherwise all of it is (with the Source crawl queue). The pages shared with
+// other Sources are only unlinked from the Source. The data is removed in a
+// single transaction; the stored files of the removed pages are returned, so
+// they can be removed from the storage.
+func PurgeSource(db *Handler, sourceID uint64, olderThan time.Time) (PurgedData, error) {
+	var purged PurgedData
+	if sourceID == 0 {
+		return purged, fmt.Errorf("sourceID must be provided")
+	}
+	args := []interface{}{sourceID}
+	if !olderThan.IsZero() {
+		olderThan = olderThan.UTC()
+		args = append(args, olderThan)
+	}
+	purgedPages := `SELECT si.index_id FROM SearchIndex si WHERE ` + purgedPagesCondition("si", olderThan)
+
+	tx, err := (*db).Begin()
+	if err != nil {
+		return purged, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	rollback := func(err error) (PurgedData, error) {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return PurgedData{}, fmt.Errorf("failed to rollback transaction: %w (original error: %v)", rollbackErr, err)
+		}
+		return PurgedData{}, err
+	}
+
+	// The stored files of the pages (before their screenshots are removed)
+	rows, err := tx.Query(`SELECT screenshot_link, thumbnail_link FROM Screenshots WHERE index_id IN (`+purgedPages+`)`, args...)
+	if err != nil {
+		return rollback(fmt.Errorf("failed to query the screenshots of source %d: %w", sourceID, err))
+	}
+	for rows.Next() {
+		var screenshot, thumbnail sql.NullString
+		if err := rows.Scan(&screenshot, &thumbnail); err != nil {
+			_ = rows.Close()
+			return rollback(fmt.Errorf("failed to scan the screenshots of source %d: %w", sourceID, err))
+		}
+		for _, link := range []sql.NullString{screenshot, thumbnail} {
+			if link.Valid && strings.TrimSpace(link.String) != "" {
+				purged.Files = append(purged.Files, link.String)
+			}
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return rollback(fmt.Errorf("failed to query the screenshots of source %d: %w", sourceID, err))
+	}
+
+	// The data of the pages is removed before the pages (not every DBMS
+	// cascades the deletes)
+	for _, table := range []string{"Screenshots", "PageForms", "PageMedia", "PageEnrichment", "PageHTML",
+		"KeywordIndex", "MetaTagsIndex", "WebObjectsIndex", "NetInfoIndex", "HTTPInfoIndex"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE index_id IN (`+purgedPages+`)`, args...); err != nil {
+			return rollback(fmt.Errorf("failed to purge %s of source %d: %w", table, sourceID, err))
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM SearchIndex WHERE `+purgedPagesCondition("SearchIndex", olderThan), args...)
+	if err != nil {
+		return rollback(fmt.Errorf("failed to purge the pages of source %d: %w", sourceID, err))
+	}
+	purged.Pages, _ = result.RowsAffected()
+
+	// The pages shared with other Sources are only unlinked
+	unlink := `DELETE FROM SourceSearchIndex WHERE source_id = $1`
+	scans := `DELETE FROM ServiceScoutScans WHERE source_id = $1`
+	if !olderThan.IsZero() {
+		unlink += ` AND index_id IN (SELECT index_id FROM SearchIndex WHERE last_updated_at < $2)`
+		scans += ` AND scanned_at < $2`
+	}
+	result, err = tx.Exec(unlink, args...)
+	if err != nil {
+		return rollback(fmt.Errorf("failed to unlink the pages of source %d: %w", sourceID, err))
+	}
+	purged.Unlinked, _ = result.RowsAffected()
+	if _, err := tx.Exec(scans, args...); err != nil {
+		return rollback(fmt.Errorf("failed to purge the ServiceScout scans of source %d: %w", sourceID, err))
+	}
+	if olderThan.IsZero() {
+		if _, err := tx.Exec(`DELETE FROM CrawlQueue WHERE source_id = $1`, sourceID); err != nil {
+			return rollback(fmt.Errorf("failed to purge the crawl queue of source %d: %w", sourceID, err))
+		}
+	}
+
+	// The shared entities no longer linked to any page (PostgreSQL removes
+	// them with its triggers)
+	if (*db).DBMS() != DBPostgresStr {
+		orphans := []string{
+			"DELETE FROM Keywords WHERE NOT EXISTS (SELECT 1 FROM KeywordIndex WHERE KeywordIndex.keyword_id = Keywords.keyword_id)",
+			"DELETE FROM MetaTags WHERE NOT EXISTS (SELECT 1 FROM MetaTagsIndex WHERE MetaTagsIndex.metatag_id = MetaTags.metatag_id)",
+			"DELETE FROM WebObjects WHERE NOT EXISTS (SELECT 1 FROM WebObjectsIndex WHERE WebObjectsIndex.object_id = WebObjects.object_id)",
+			"DELETE FROM NetInfo WHERE NOT EXISTS (SELECT 1 FROM NetInfoIndex WHERE NetInfoIndex.netinfo_id = NetInfo.netinfo_id)",
+			"DELETE FROM HTTPInfo WHERE NOT EXISTS (SELECT 1 FROM HTTPInfoIndex WHERE HTTPInfoIndex.httpinfo_id = HTTPInfo.httpinfo_id)",
+		}
+		for _, query := range orphans {
+			if _, err := tx.Exec(query); err != nil {
+				return rollback(fmt.Errorf("failed to purge the orphaned data of source %d: %w", sourceID, err))
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PurgedData{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return purged, nil
+}
+
 // ListSources retrieves all sources from the database with optional filters.
 func ListSources(db *Handler, categoryID *uint64, userID *uint64) ([]Source, error) {
 	sources := []Source{}
@@ -218,3 +472,279 @@ func GetSourcesByStatus(db *Handler, status string) ([]Source, error) {
 	}
 	return sources, nil
 }
+
+const (
+	// The Sources to crawl, selected and marked as processing by the
+	// update_sources function (PostgreSQL only)
+	updateSourcesQuery = `
+	SELECT
+		l.source_id,
+		l.url,
+		l.restricted,
+		l.flags,
+		l.config
+	FROM
+		update_sources($1,$2,$3,$4,$5,$6) AS l
+	ORDER BY l.last_updated_at ASC;`
+
+	// The Sources to crawl (the same selection of update_sources), for the
+	// DBMS without it. $1/$3 enable the re-crawling of the Sources updated
+	// before $2 and of the completed ones (including the ones stopped by
+	// their stop condition) updated before $4.
+	sourcesToCrawlQuery = `
+	SELECT source_id, url, restricted, flags, config
+	FROM Sources
+	WHERE disabled = FALSE
+	  AND (
+		($1 AND (last_updated_at IS NULL OR last_updated_at < $2))
+		OR ($3 AND LOWER(TRIM(status)) IN ('completed', 'completed-with-found') AND last_updated_at < $4)
+		OR (LOWER(TRIM(status)) = 'error' AND last_updated_at < $5)
+		OR LOWER(TRIM(status)) = 'pending'
+		OR LOWER(TRIM(status)) = 'new'
+		OR (LOWER(TRIM(status)) = 'processing' AND last_updated_at < $6)
+		OR status IS NULL
+	  )
+	ORDER BY last_updated_at ASC
+	LIMIT $7
+	FOR UPDATE SKIP LOCKED`
+	markSourceProcessingQuery = `UPDATE Sources SET status = 'processing', engine = $2, last_updated_at = NOW() WHERE source_id = $1`
+
+	defaultLastErrorInterval         = "15 minutes"
+	defaultProcessingTimeoutInterval = "1 day"
+)
+
+// SourcesToCrawl selects (at most limit) Sources to crawl and marks them as
+// processing by engineID, in a single transaction, so multiple engines never
+// get the same Source. The Sources are selected with the re-crawling
+// intervals of the crawler configuration; the Sources without a valid
+// restriction level get the crawler default one and the Sources without a
+// configuration get the default one.
+func SourcesToCrawl(db *Handler, limit int, engineID string, crawler cfg.Crawler) ([]Source, error) {
+	var query string
+	var args []interface{}
+	if (*db).DBMS() == DBPostgresStr {
+		query = updateSourcesQuery
+		args = []interface{}{limit, engineID, crawler.CrawlingIfOk, crawler.CrawlingIfError, crawler.CrawlingInterval, crawler.ProcessingTimeout}
+	} else {
+		var err error
+		query = sourcesToCrawlQuery
+		args, err = sourcesToCrawlArgs(limit, crawler, time.Now().UTC())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := (*db).Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	rollback := func(err error) ([]Source, error) {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return nil, fmt.Errorf("failed to rollback transaction: %w (original error: %v)", rollbackErr, err)
+		}
+		return nil, err
+	}
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return rollback(fmt.Errorf("failed to select the sources to crawl: %w", err))
+	}
+	var sources []Source
+	for rows.Next() {
+		var src Source
+		var restricted sql.NullInt64
+		if err := rows.Scan(&src.ID, &src.URL, &restricted, &src.Flags, &src.Config); err != nil {
+			_ = rows.Close()
+			return rollback(fmt.Errorf("failed to scan source: %w", err))
+		}
+		// Use the default restriction level if the source doesn't have a valid one
+		src.Restricted, err = SourceRestricted(restricted, crawler.DefaultRestricted)
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "source %d: %v, using the default restricted level %d", src.ID, err, src.Restricted)
+		}
+		if src.Config == nil {
+			src.Config = new(json.RawMessage)
+			*src.Config = DefaultSourceCfgJSON
+		}
+		sources = append(sources, src)
+	}
+	if err := rows.Close(); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "closing rows iterator: %v", err)
+	}
+
+	// update_sources marks the Sources itself
+	if query == sourcesToCrawlQuery {
+		for _, src := range sources {
+			if _, err := tx.Exec(markSourceProcessingQuery, src.ID, engineID); err != nil {
+				return rollback(fmt.Errorf("failed to mark source %d as processing: %w", src.ID, err))
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return sources, nil
+}
+
+// sourcesToCrawlArgs returns the arguments of sourcesToCrawlQuery: the
+// re-crawling intervals of the crawler configuration as the times before now
+// (the empty intervals disable their re-crawling, except the ones of the
+// Sources in error and processing, which have a default)
+func sourcesToCrawlArgs(limit int, crawler cfg.Crawler, now time.Time) ([]interface{}, error) {
+	var errs []error
+	before := func(interval, def string) (bool, time.Time) {
+		interval = strings.TrimSpace(interval)
+		if interval == "" {
+			interval = def
+		}
+		if interval == "" {
+			return false, now
+		}
+		d, err := parseInterval(interval)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return true, now.Add(-d)
+	}
+	lastOk, lastOkBefore := before(crawler.CrawlingIfOk, "")
+	regular, regularBefore := before(crawler.CrawlingInterval, "")
+	_, lastErrorBefore := before(crawler.CrawlingIfError, defaultLastErrorInterval)
+	_, processingBefore := before(crawler.ProcessingTimeout, defaultProcessingTimeoutInterval)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return []interface{}{lastOk, lastOkBefore, regular, regularBefore, lastErrorBefore, processingBefore, limit}, nil
+}
+
+// intervalUnits are the units of the (PostgreSQL) intervals of the crawler
+// configuration
+var intervalUnits = map[string]time.Duration{
+	"second": time.Second,
+	"sec":    time.Second,
+	"minute": time.Minute,
+	"min":    time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+	"month":  30 * 24 * time.Hour,
+	"year":   365 * 24 * time.Hour,
+}
+
+// parseInterval parses an interval in the PostgreSQL format used by the
+// crawler configuration (e.g. "15 minutes", "1 day 12 hours")
+func parseInterval(interval string) (time.Duration, error) {
+	fields := strings.Fields(strings.ToLower(interval))
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return 0, fmt.Errorf("invalid interval '%s'", interval)
+	}
+	var d time.Duration
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid interval '%s'", interval)
+		}
+		unit, ok := intervalUnits[strings.TrimSuffix(fields[i+1], "s")]
+		if !ok {
+			return 0, fmt.Errorf("invalid interval '%s': unknown unit '%s'", interval, fields[i+1])
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	return d, nil
+}
+
+// maxSourceTagLength is the maximum length of a Source tag (see SourceTagIndex)
+const maxSourceTagLength = 64
+
+// NormalizeSourceTags returns the given tags trimmed, lowercased and without
+// duplicates. Empty tags and tags longer than 64 characters are dropped.
+func NormalizeSourceTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxSourceTagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// SetSourceTags replaces the tags of a Source with the given ones.
+func SetSourceTags(db *Handler, sourceID uint64, tags []string) error {
+	tx, err := (*db).Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM SourceTagIndex WHERE source_id = $1`, sourceID)
+	if err == nil {
+		for _, tag := range NormalizeSourceTags(tags) {
+			_, err = tx.Exec(`INSERT INTO SourceTagIndex (source_id, tag) VALUES ($1, $2) ON CONFLICT (source_id, tag) DO NOTHING`, sourceID, tag)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to rollback transaction: %w (original error: %v)", rollbackErr, err)
+		}
+		return fmt.Errorf("failed to set the tags of source with ID %d: %w", sourceID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetSourceTags retrieves the tags of a Source (sorted alphabetically).
+func GetSourceTags(db *Handler, sourceID uint64) ([]string, error) {
+	rows, err := (*db).ExecuteQuery(`SELECT tag FROM SourceTagIndex WHERE source_id = $1 ORDER BY tag`, sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve the tags of source with ID %d: %v", sourceID, err)
+	}
+	defer rows.Close() //nolint:errcheck // We can't check return value on defer
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// RecrawlSourcesQuery returns the query (and its arguments) to schedule an
+// on-demand recrawl of the enabled Sources that aren't being crawled right
+// now. If tag is not empty, only the Sources tagged with it are scheduled.
+func RecrawlSourcesQuery(tag string) (string, []interface{}) {
+	query := `UPDATE Sources SET status = 'pending', last_updated_at = NOW() WHERE disabled = FALSE AND status <> 'processing'`
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return query, nil
+	}
+	return query + ` AND source_id IN (SELECT source_id FROM SourceTagIndex WHERE tag = $1)`, []interface{}{tag}
+}
+
+// RecrawlSources schedules an on-demand recrawl of the Sources (optionally
+// only of the ones tagged with tag), setting them back to 'pending' so the
+// scheduler picks them up in its next cycle. It returns the number of Sources
+// scheduled.
+func RecrawlSources(db *Handler, tag string) (int64, error) {
+	query, args := RecrawlSourcesQuery(tag)
+	result, err := (*db).Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to schedule the recrawl of the sources: %v", err)
+	}
+	scheduled, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count the sources scheduled for recrawl: %v", err)
+	}
+	return scheduled, nil
+}
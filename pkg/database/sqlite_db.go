@@ -18,14 +18,40 @@ package database
 
 import (
 	"database/sql"
+	_ "embed" // SQLite schema
 	"fmt"
 	"strings"
 
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
+	sqlite3 "github.com/mattn/go-sqlite3"
 )
 
+const (
+	// sqliteDriverName is the name of the SQLite driver rewriting the queries
+	// in the SQLite dialect
+	sqliteDriverName = "crowler-sqlite3"
+	// sqliteBusyTimeout is how long (in milliseconds) a connection waits for
+	// the database to be unlocked by another writer
+	sqliteBusyTimeout = 10000
+)
+
+// sqliteBuiltIn is false if the engine has been built without cgo: the SQLite
+// driver (go-sqlite3) needs it, without it every connection fails (see
+// sqlite_disabled.go)
+var sqliteBuiltIn = true
+
+// sqliteSchema is the SQLite setup script (all its statements are
+// idempotent, so it's applied every time the database is opened)
+//
+//go:embed sqlite-setup-v1.4.sqlite3
+var sqliteSchema string
+
+func init() {
+	sql.Register(sqliteDriverName, &dialectDriver{driver: &sqlite3.SQLiteDriver{}, dbms: DBSQLiteStr})
+}
+
 // ---------------------------------------------------------------
 // SQLite handlers
 // ---------------------------------------------------------------
@@ -36,23 +62,30 @@ type SQLiteHandler struct {
 	dbms string
 }
 
-// Connect connects to an SQLite database
+// Connect connects to an SQLite database (the DBName is the path of the
+// database file), creating it if it doesn't exist.
 func (handler *SQLiteHandler) Connect(c cfg.Config) error {
-	// Construct the connection string from the Config struct
-	connectionString := fmt.Sprintf("file:%s?cache=shared&mode=rwc", c.Database.DBName)
-
-	var err error
-	handler.db, err = sql.Open("sqlite3", connectionString)
+	// The transactions take the write lock when they start (SQLite has a
+	// single writer), so concurrent transactions wait for each other rather
+	// than failing to upgrade their locks
+	connectionString := fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=1&_busy_timeout=%d&_txlock=immediate",
+		c.Database.DBName, sqliteBusyTimeout)
+
+	db, err := sql.Open(sqliteDriverName, connectionString)
+	if err != nil {
+		return err
+	}
+	SetConnectionPool(db, c)
 
-	// Optimize the database connection
-	if err == nil {
-		_, err = handler.db.Exec("PRAGMA journal_mode=WAL;")
-		if err == nil {
-			_, err = handler.db.Exec("PRAGMA synchronous=1;")
-		}
+	// Create the CROWler tables (if needed)
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return fmt.Errorf("setting up the SQLite database: %v", err)
 	}
+	handler.db = db
+	handler.dbms = DBSQLiteStr
 
-	return err
+	return nil
 }
 
 // Close closes the database connection
@@ -62,6 +95,9 @@ func (handler *SQLiteHandler) Close() error {
 
 // Ping checks if the database connection is still alive
 func (handler *SQLiteHandler) Ping() error {
+	if handler.db == nil {
+		return fmt.Errorf("not connected to the database")
+	}
 	return handler.db.Ping()
 }
 
@@ -120,21 +156,29 @@ func (handler *SQLiteHandler) NewListener() Listener {
 // Database abstraction layer
 // ---------------------------------------------------------------
 
-// NewHandler returns a new Handler based on the
-// database type specified in the Config struct.
+// NewHandler returns a new Handler based on the database driver specified
+// in the Config struct (or on its type, if the driver isn't set).
 func NewHandler(c cfg.Config) (Handler, error) {
-	dbms := strings.ToLower(strings.TrimSpace(c.Database.Type))
-	switch dbms {
+	dbms := c.Database.Driver
+	if strings.TrimSpace(dbms) == "" {
+		dbms = c.Database.Type
+	}
+	switch cfg.NormalizeDBDriver(dbms) {
 	case DBPostgresStr:
 		handler := &PostgresHandler{}
-		handler.dbms = dbms
+		handler.dbms = DBPostgresStr
 		return handler, nil
 	case DBSQLiteStr:
+		if !sqliteBuiltIn {
+			return nil, fmt.Errorf("unsupported database type: 'sqlite3' (the CROWler must be built with cgo, CGO_ENABLED=1)")
+		}
 		handler := &SQLiteHandler{}
-		handler.dbms = dbms
+		handler.dbms = DBSQLiteStr
 		return handler, nil
-	// Add cases for MySQL, Snowflake, etc.
+	case DBMySQLStr:
+		return newMySQLHandler()
+	// Add cases for Snowflake, etc.
 	default:
-		return nil, fmt.Errorf("unsupported database type: '%s'", c.Database.Type)
+		return nil, fmt.Errorf("unsupported database type: '%s'", dbms)
 	}
 }
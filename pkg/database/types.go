@@ -63,6 +63,40 @@ type Source struct {
 	Status int
 }
 
+// CrawlQueueItem represents an entry of the CrawlQueue table (a URL to crawl
+// of a Source being crawled)
+type CrawlQueueItem struct {
+	// ID is the unique identifier of the entry.
+	ID uint64
+	// SourceID is the ID of the Source the URL is crawled for.
+	SourceID uint64
+	// URL is the URL to crawl.
+	URL string
+	// PageURL is the URL of the page the link was found on.
+	PageURL string
+	// AnchorText is the anchor text of the link.
+	AnchorText string
+	// ElementID is the ID of the link element.
+	ElementID string
+	// Depth is the crawling depth of the URL.
+	Depth int
+	// Status is the status of the entry (pending, processing, done or error).
+	Status string
+}
+
+// PurgedData reports the crawled data of a Source removed by PurgeSource
+type PurgedData struct {
+	// Pages is the number of the pages (SearchIndex rows) removed, with all
+	// their data (keywords, meta tags, web objects, screenshots etc.).
+	Pages int64
+	// Unlinked is the number of the pages shared with other Sources, which are
+	// only unlinked from the Source (the other Sources keep them).
+	Unlinked int64
+	// Files are the links of the stored files (screenshots and thumbnails) of
+	// the removed pages, to remove from the storage.
+	Files []string
+}
+
 // Event represents the structure of the Events table
 type Event struct {
 	// ID is the unique identifier of the event.
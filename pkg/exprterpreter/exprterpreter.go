@@ -19,6 +19,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"math/big"
+	mrand "math/rand"
 	"strconv"
 	"strings"
 	"time"
@@ -138,11 +139,18 @@ func handleParentheses(char rune, inQuotes bool, parenthesisLevel int) int {
 
 // InterpretCmd processes an EncodedCmd recursively and returns the calculated value as a string.
 func InterpretCmd(encodedCmd EncodedCmd) (string, error) {
+	return InterpretCmdWithRand(encodedCmd, nil)
+}
+
+// InterpretCmdWithRand is InterpretCmd with the random values picked by rng
+// (so a seeded generator reproduces them, see cmn.NewRand). If rng is nil the
+// random values are picked with crypto/rand.
+func InterpretCmdWithRand(encodedCmd EncodedCmd, rng *mrand.Rand) (string, error) {
 	switch encodedCmd.Token {
 	case -1: // Non-command parameter
 		return encodedCmd.ArgValue, nil
 	case TokenRandom: // Token representing the 'random' command
-		return handleRandomCommand(encodedCmd.Args)
+		return handleRandomCommand(encodedCmd.Args, rng)
 	case TokenTime: // Token representing the 'time' command
 		return handleTimeCommand(encodedCmd.Args)
 	case TokenURL: // Token representing the 'url' command
@@ -153,17 +161,17 @@ func InterpretCmd(encodedCmd EncodedCmd) (string, error) {
 }
 
 // handleRandomCommand processes the 'random' command given its arguments.
-func handleRandomCommand(args []EncodedCmd) (string, error) {
+func handleRandomCommand(args []EncodedCmd, rng *mrand.Rand) (string, error) {
 	if len(args) != 2 {
 		return "", fmt.Errorf("random command expects 2 arguments, got %d", len(args))
 	}
 
 	// Process arguments recursively
-	minArg, err := InterpretCmd(args[0])
+	minArg, err := InterpretCmdWithRand(args[0], rng)
 	if err != nil {
 		return "", err
 	}
-	maxArg, err := InterpretCmd(args[1])
+	maxArg, err := InterpretCmdWithRand(args[1], rng)
 	if err != nil {
 		return "", err
 	}
@@ -183,17 +191,21 @@ func handleRandomCommand(args []EncodedCmd) (string, error) {
 		return "", fmt.Errorf("min argument must be less than max argument for random")
 	}
 
-	// Generate and return random value using crypto/rand for better randomness
-	// Compute the range (max - min + 1)
-	rangeInt := big.NewInt(int64(maxVal - minVal + 1))
-	// Generate a random number in [0, rangeInt)
-	n, err := rand.Int(rand.Reader, rangeInt)
-	if err != nil {
-		return "", err
+	// Generate a random number in [0, max - min]
+	var n int
+	if rng != nil {
+		n = rng.Intn(maxVal - minVal + 1)
+	} else {
+		// Generate the random value using crypto/rand for better randomness
+		nBig, err := rand.Int(rand.Reader, big.NewInt(int64(maxVal-minVal+1)))
+		if err != nil {
+			return "", err
+		}
+		n = int(nBig.Int64())
 	}
 
 	// Shift the number to [min, max]
-	result := int(n.Int64()) + minVal
+	result := n + minVal
 	return strconv.Itoa(result), nil
 }
 
@@ -240,6 +252,12 @@ func IsNumber(str string) bool {
 
 // GetFloat returns the float value of the given expression.
 func GetFloat(iExpr string) float64 {
+	return GetFloatWithRand(iExpr, nil)
+}
+
+// GetFloatWithRand returns the float value of the given expression, with its
+// random values picked by rng (see InterpretCmdWithRand).
+func GetFloatWithRand(iExpr string, rng *mrand.Rand) float64 {
 	if IsNumber(iExpr) {
 		rval, err := strconv.ParseFloat(iExpr, 64)
 		if err != nil {
@@ -249,7 +267,7 @@ func GetFloat(iExpr string) float64 {
 	}
 
 	cmd, _ := ParseCmd(iExpr, 0)
-	rvalStr, _ := InterpretCmd(cmd)
+	rvalStr, _ := InterpretCmdWithRand(cmd, rng)
 	rval, err := strconv.ParseFloat(rvalStr, 64)
 	if err != nil {
 		rval = 1
@@ -85,7 +85,7 @@ func ExtractHTTPInfo(config Config, re *ruleset.RuleEngine, htmlContent string)
 
 	// Send HTTP request
 	cmn.DebugMsg(cmn.DbgLvlDebug1, "Collecting HTTP Header information for URL: %s", config.URL)
-	resp, err := sendHTTPRequest(httpClient, config)
+	resp, method, err := sendHTTPRequest(httpClient, config)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +106,7 @@ func ExtractHTTPInfo(config Config, re *ruleset.RuleEngine, htmlContent string)
 	info.URL = config.URL
 	info.CustomHeaders = config.CustomHeader
 	info.FollowRedirects = config.FollowRedirects
+	info.Method = method
 	info.SSLInfo, err = ConvertSSLInfoToDetails(*sslInfo)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlDebug1, "Error converting SSL info to details: %v", err)
@@ -218,22 +219,75 @@ func basicAuth(username, password string) string {
 	return "Basic " + cmn.Base64Encode(auth)
 }
 
-func sendHTTPRequest(httpClient *http.Client, config Config) (*http.Response, error) {
-	req, err := http.NewRequest("GET", config.URL, nil)
+// sendHTTPRequest requests the headers of config.URL with the config.Methods
+// (HEAD, GET or OPTIONS, GET if none) in order, falling back to the next one
+// if the server rejects a method (405 or 501). A GET after another method is
+// a ranged GET (of the first byte only), as only the headers are missing. It
+// returns the response and the method it was requested with. The body of the
+// response is empty unless it's a full GET (so the detection uses the page
+// content instead).
+func sendHTTPRequest(httpClient *http.Client, config Config) (*http.Response, string, error) {
+	methods, err := requestMethods(config.Methods)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	// Add custom headers if specified
-	for key, value := range config.CustomHeader {
-		req.Header.Add(key, value)
+	for i, method := range methods {
+		req, err := http.NewRequest(method, config.URL, nil)
+		if err != nil {
+			return nil, "", err
+		}
+
+		// Add custom headers if specified
+		for key, value := range config.CustomHeader {
+			req.Header.Add(key, value)
+		}
+		ranged := method == http.MethodGet && i > 0
+		if ranged {
+			req.Header.Set("Range", "bytes=0-0")
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, "", err
+		}
+		if methodRejected(resp.StatusCode) && i < len(methods)-1 {
+			cmn.DebugMsg(cmn.DbgLvlDebug3, "HTTP %s of %s rejected (%d), trying %s", method, config.URL, resp.StatusCode, methods[i+1])
+			resp.Body.Close() //nolint:errcheck // The body is not needed
+			continue
+		}
+		if method != http.MethodGet || ranged {
+			resp.Body.Close() //nolint:errcheck // The body is not needed
+			resp.Body = http.NoBody
+		}
+		return resp, method, nil
 	}
+	return nil, "", fmt.Errorf("no HTTP methods to request %s with", config.URL)
+}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// requestMethods returns the (normalized) methods the headers are requested
+// with, GET if none are given
+func requestMethods(methods []string) ([]string, error) {
+	if len(methods) == 0 {
+		return []string{http.MethodGet}, nil
+	}
+	normalized := make([]string, 0, len(methods))
+	for _, method := range methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		switch method {
+		case http.MethodHead, http.MethodGet, http.MethodOptions:
+			normalized = append(normalized, method)
+		default:
+			return nil, fmt.Errorf("unsupported HTTP method: '%s'", method)
+		}
 	}
-	return resp, nil
+	return normalized, nil
+}
+
+// methodRejected returns true if the status code means the server doesn't
+// accept the method of the request
+func methodRejected(statusCode int) bool {
+	return statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusNotImplemented
 }
 
 func shouldFollowRedirects(config Config, resp *http.Response) bool {
@@ -246,7 +300,9 @@ func handleRedirects(config Config, re *ruleset.RuleEngine, resp *http.Response)
 
 	newConfig := config
 	newConfig.URL = newLocation
-	newConfig.CustomHeader = map[string]string{"User-Agent": cmn.UsrAgentStrMap["desktop01"]}
+	if len(newConfig.CustomHeader) == 0 {
+		newConfig.CustomHeader = map[string]string{"User-Agent": cmn.UsrAgentStrMap["desktop01"]}
+	}
 	newConfig.FollowRedirects = true
 
 	return ExtractHTTPInfo(newConfig, re, "")
@@ -18,6 +18,9 @@ package httpinfo
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
@@ -120,3 +123,63 @@ func TestExtractHTTPInfo(t *testing.T) {
 		}
 	*/
 }
+
+func TestSendHTTPRequest(t *testing.T) {
+	// A server that rejects the HEAD requests
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case http.MethodGet:
+			w.Header().Set("X-Range", r.Header.Get("Range"))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("<html>page</html>"))
+		case http.MethodOptions:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		methods  []string
+		want     string
+		tried    int
+		rangeHdr string
+		body     string
+		wantErr  bool
+	}{
+		{"default GET", nil, http.MethodGet, 1, "", "<html>page</html>", false},
+		{"HEAD rejected, falls back to ranged GET", []string{"HEAD", "GET"}, http.MethodGet, 2, "bytes=0-0", "", false},
+		{"OPTIONS", []string{" options "}, http.MethodOptions, 1, "", "", false},
+		{"HEAD only", []string{"HEAD"}, http.MethodHead, 1, "", "", false},
+		{"unsupported method", []string{"DELETE"}, "", 0, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			methods = nil
+			resp, method, err := sendHTTPRequest(server.Client(), Config{URL: server.URL, Methods: tt.methods})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sendHTTPRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(methods) != tt.tried {
+				t.Errorf("Expected %d request(s), got %v", tt.tried, methods)
+			}
+			if err != nil {
+				return
+			}
+			defer resp.Body.Close() //nolint:errcheck // test
+			if method != tt.want {
+				t.Errorf("sendHTTPRequest() method = %s, want %s", method, tt.want)
+			}
+			if got := resp.Header.Get("X-Range"); got != tt.rangeHdr {
+				t.Errorf("Expected Range %q, got %q", tt.rangeHdr, got)
+			}
+			if body, _ := io.ReadAll(resp.Body); string(body) != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, body)
+			}
+		})
+	}
+}
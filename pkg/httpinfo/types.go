@@ -40,6 +40,7 @@ type Config struct {
 	SSLDiscovery    cfg.SSLScoutConfig
 	SSHDiscovery    bool
 	Proxies         []cfg.SOCKSProxy // SOCKS proxies
+	Methods         []string         // The methods the headers are requested with, in order (GET if none)
 }
 
 // HTTPDetails is a struct to store the collected HTTP header information
@@ -47,6 +48,7 @@ type HTTPDetails struct {
 	URL              string                           `json:"url"`
 	CustomHeaders    map[string]string                `json:"custom_headers"`
 	FollowRedirects  bool                             `json:"follow_redirects"`
+	Method           string                           `json:"method"` // The method the headers were collected with
 	ResponseHeaders  http.Header                      `json:"response_headers"`
 	SSLInfo          SSLDetails                       `json:"ssl_info"`
 	DetectedEntities map[string]detect.DetectedEntity `json:"detected_assets"`
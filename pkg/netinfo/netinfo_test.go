@@ -19,7 +19,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	cfg "github.com/pzaino/thecrowler/pkg/config"
 )
@@ -58,3 +63,192 @@ func TestGetNetInfo(t *testing.T) {
 
 	// Add more validation as needed for Hosts, IPs, and WHOIS data
 }
+
+func TestScanHostsCache(t *testing.T) {
+	scanCfg := cfg.NewConfig().NetworkInfo.ServiceScout
+	scanCfg.CacheTTL = 60
+	scanCfg.CachePath = filepath.Join(t.TempDir(), "servicescout.json")
+
+	// Results left by a previous (interrupted) run: a recent one and an expired one
+	now := time.Now()
+	previous := &serviceScoutCache{
+		path: scanCfg.CachePath,
+		entries: map[string]serviceScoutCacheEntry{
+			serviceScoutCacheKey(&scanCfg, "192.0.2.1"): {ScannedAt: now.Add(-10 * time.Minute), Hosts: []HostInfo{{Hostname: []HostNameDetails{{Name: "cached"}}}}},
+			serviceScoutCacheKey(&scanCfg, "192.0.2.2"): {ScannedAt: now.Add(-2 * time.Hour), Hosts: []HostInfo{{Hostname: []HostNameDetails{{Name: "expired"}}}}},
+		},
+	}
+	previous.save()
+
+	var mu sync.Mutex
+	var scanned []string
+	scan := func(_ *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
+		mu.Lock()
+		scanned = append(scanned, ip)
+		mu.Unlock()
+		return []HostInfo{{Hostname: []HostNameDetails{{Name: "scanned"}}}}, nil
+	}
+
+	ni := &NetInfo{IPs: IPData{IP: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}}}
+	hosts, err := ni.scanHostsWith(&scanCfg, scan)
+	if err != nil {
+		t.Fatalf("scanHostsWith() error = %v", err)
+	}
+	sort.Strings(scanned)
+	if fmt.Sprint(scanned) != "[192.0.2.2 192.0.2.3]" {
+		t.Errorf("scanned hosts = %v, want [192.0.2.2 192.0.2.3]", scanned)
+	}
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		names = append(names, host.Hostname[0].Name)
+	}
+	sort.Strings(names)
+	if fmt.Sprint(names) != "[cached scanned scanned]" {
+		t.Errorf("host names = %v, want [cached scanned scanned]", names)
+	}
+
+	// A different scan configuration doesn't use the cached results
+	otherCfg := scanCfg
+	otherCfg.AggressiveScan = !scanCfg.AggressiveScan
+	if serviceScoutCacheKey(&otherCfg, "192.0.2.1") == serviceScoutCacheKey(&scanCfg, "192.0.2.1") {
+		t.Errorf("cache key doesn't depend on the scan configuration")
+	}
+
+	// The new results have been saved for the next run
+	saved := &serviceScoutCache{path: scanCfg.CachePath, entries: make(map[string]serviceScoutCacheEntry)}
+	saved.load()
+	if _, ok := saved.get(serviceScoutCacheKey(&scanCfg, "192.0.2.3"), time.Hour, time.Now()); !ok {
+		t.Errorf("scan results of 192.0.2.3 not saved in the cache file")
+	}
+}
+
+func TestScanHostsMaxParallelHosts(t *testing.T) {
+	scanCfg := cfg.NewConfig().NetworkInfo.ServiceScout
+	scanCfg.MaxParallelHosts = 2
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	scan := func(_ *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return []HostInfo{{Hostname: []HostNameDetails{{Name: ip}}}}, nil
+	}
+
+	ips := []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4", "192.0.2.5", "192.0.2.6"}
+	ni := &NetInfo{IPs: IPData{IP: ips}}
+	hosts, err := ni.scanHostsWith(&scanCfg, scan)
+	if err != nil {
+		t.Fatalf("scanHostsWith() error = %v", err)
+	}
+	if maxActive != scanCfg.MaxParallelHosts {
+		t.Errorf("hosts scanned at the same time = %d, want %d", maxActive, scanCfg.MaxParallelHosts)
+	}
+	if len(hosts) != len(ips) {
+		t.Errorf("scanHostsWith() returned %d hosts, want %d", len(hosts), len(ips))
+	}
+}
+
+func TestScanHostGlobalMaxProcesses(t *testing.T) {
+	savedScan := runNmapScan
+	defer func() { runNmapScan = savedScan }()
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	runNmapScan = func(_ *NetInfo, _ *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return []HostInfo{{Hostname: []HostNameDetails{{Name: ip}}}}, nil
+	}
+
+	// Several sources scan their hosts at the same time, each of them within
+	// its own max_parallel_hosts, but the engine runs 3 Nmap processes at most
+	scanCfg := cfg.NewConfig().NetworkInfo.ServiceScout
+	scanCfg.MaxParallelHosts = 2
+	scanCfg.GlobalMaxProcesses = 3
+
+	var wg sync.WaitGroup
+	for src := 0; src < 4; src++ {
+		wg.Add(1)
+		go func(src int) {
+			defer wg.Done()
+			var ips []string
+			for i := 1; i <= 4; i++ {
+				ips = append(ips, fmt.Sprintf("192.0.%d.%d", src, i))
+			}
+			ni := &NetInfo{IPs: IPData{IP: ips}}
+			hosts, err := ni.scanHosts(&scanCfg)
+			if err != nil {
+				t.Errorf("source %d: scanHosts() error = %v", src, err)
+			}
+			if len(hosts) != len(ips) {
+				t.Errorf("source %d: scanHosts() returned %d hosts, want %d", src, len(hosts), len(ips))
+			}
+		}(src)
+	}
+	wg.Wait()
+
+	if maxActive != scanCfg.GlobalMaxProcesses {
+		t.Errorf("Nmap processes running at the same time = %d, want %d", maxActive, scanCfg.GlobalMaxProcesses)
+	}
+}
+
+func TestExpandTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+	}{
+		{"IPv4 /30", []string{"10.0.0.0/30"}, []string{"10.0.0.1", "10.0.0.2"}},
+		{"IPv4 /31", []string{"10.0.0.4/31"}, []string{"10.0.0.4", "10.0.0.5"}},
+		{"IPv4 /32", []string{"10.0.0.9/32"}, []string{"10.0.0.9"}},
+		{"IPv6 /126", []string{"2001:db8::/126"}, []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{"IP range", []string{"10.0.0.250-10.0.1.1"}, []string{"10.0.0.250", "10.0.0.251", "10.0.0.252", "10.0.0.253", "10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{"hosts and duplicates", []string{"10.0.0.2", "10.0.0.0/30", "my-host.example.com", "10.0.0.1"}, []string{"10.0.0.2", "10.0.0.1", "my-host.example.com"}},
+		{"too large", []string{"10.0.0.0/16", "2001:db8::/64", "10.0.0.1-10.0.1.0", "10.0.0.7"}, []string{"10.0.0.7"}},
+		{"invalid", []string{"10.0.0.0/33", "10.0.0.5-10.0.0.1", "10.0.0.1-2001:db8::1"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandTargets(tt.targets, 16); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandTargets(%v) = %v, want %v", tt.targets, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanHostsExpandsCIDR(t *testing.T) {
+	scanCfg := cfg.NewConfig().NetworkInfo.ServiceScout
+	var mu sync.Mutex
+	var scanned []string
+	scan := func(_ *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
+		mu.Lock()
+		scanned = append(scanned, ip)
+		mu.Unlock()
+		return []HostInfo{{Hostname: []HostNameDetails{{Name: ip}}}}, nil
+	}
+
+	ni := &NetInfo{IPs: IPData{IP: []string{"192.0.2.0/29"}}}
+	if _, err := ni.scanHostsWith(&scanCfg, scan); err != nil {
+		t.Fatalf("scanHostsWith() error = %v", err)
+	}
+	if len(scanned) != 6 {
+		t.Errorf("scanHostsWith() scanned %v, want the 6 hosts of 192.0.2.0/29", scanned)
+	}
+}
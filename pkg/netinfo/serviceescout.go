@@ -51,13 +51,72 @@ func (ni *NetInfo) GetServiceScoutInfo(scanCfg *cfg.ServiceScoutConfig) error {
 	return nil
 }
 
-func (ni *NetInfo) scanHost(cfg *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
+// processLimiter bounds the number of processes running at the same time.
+// The limit is given on each acquire, so a configuration reload applies to
+// the next processes started.
+type processLimiter struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	running int
+}
+
+func newProcessLimiter() *processLimiter {
+	l := &processLimiter{}
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// acquire waits until fewer than limit processes are running and takes a
+// slot. It returns true if it had to wait for it.
+func (l *processLimiter) acquire(limit int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	waited := false
+	for l.running >= limit {
+		waited = true
+		l.cond.Wait()
+	}
+	l.running++
+	return waited
+}
+
+// release frees the slot of a process that has completed
+func (l *processLimiter) release() {
+	l.mutex.Lock()
+	l.running--
+	l.mutex.Unlock()
+	l.cond.Broadcast()
+}
+
+// nmapProcesses bounds the Nmap processes running at the same time in the
+// whole engine, whichever source (and scan run) started them
+var nmapProcesses = newProcessLimiter()
+
+// runNmapScan runs the Nmap scan of a single host (replaced in tests)
+var runNmapScan = (*NetInfo).runNmap
+
+// scanHost scans a single host with its own Nmap process, once fewer than
+// global_max_processes Nmap processes are running in the engine
+func (ni *NetInfo) scanHost(scanCfg *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
 	// Check the IP address
 	ip = strings.TrimSpace(ip)
 	if ip == "" {
 		return []HostInfo{}, fmt.Errorf("empty IP address")
 	}
 
+	limit := scanCfg.GlobalMaxProcesses
+	if limit < 1 {
+		limit = cfg.SSDefaultGlobalMaxProcesses
+	}
+	if nmapProcesses.acquire(limit) {
+		cmn.DebugMsg(cmn.DbgLvlDebug, "ServiceScout: host %s waited for one of the %d Nmap processes of the engine to complete", ip, limit)
+	}
+	defer nmapProcesses.release()
+
+	return runNmapScan(ni, scanCfg, ip)
+}
+
+func (ni *NetInfo) runNmap(cfg *cfg.ServiceScoutConfig, ip string) ([]HostInfo, error) {
 	// Create a context with a timeout per host
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeout)*time.Second)
 	defer cancel()
@@ -511,22 +570,74 @@ func collectVulnerabilityData(script *nmap.Script) VulnerabilityInfo {
 
 // scanHosts scans the hosts using Nmap
 func (ni *NetInfo) scanHosts(scanCfg *cfg.ServiceScoutConfig) ([]HostInfo, error) {
+	return ni.scanHostsWith(scanCfg, ni.scanHost)
+}
+
+// scanHostsWith scans the hosts using scan, up to max_parallel_hosts at the
+// same time. The CIDR blocks and IP ranges are expanded to their host
+// addresses (up to max_range_hosts each). When the results cache is enabled (cache_ttl), the hosts scanned
+// (with the same configuration) within the cache TTL are not scanned again.
+func (ni *NetInfo) scanHostsWith(scanCfg *cfg.ServiceScoutConfig, scan func(*cfg.ServiceScoutConfig, string) ([]HostInfo, error)) ([]HostInfo, error) {
 	// Get the IP addresses
-	ips := ni.IPs.IP
+	maxRangeHosts := scanCfg.MaxRangeHosts
+	if maxRangeHosts < 1 {
+		maxRangeHosts = cfg.SSDefaultMaxRangeHosts
+	}
+	ips := expandTargets(ni.IPs.IP, maxRangeHosts)
+
+	var cache *serviceScoutCache
+	ttl := time.Duration(scanCfg.CacheTTL) * time.Minute
+	if ttl > 0 {
+		cache = getServiceScoutCache(scanCfg.CachePath)
+		cache.purge(ttl, time.Now())
+	}
 
 	var fHosts []HostInfo // This will hold all the host info structs we create (fHosts = final hosts)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
+	// Each host scan is an Nmap process, so only maxParallel hosts are
+	// scanned at the same time
+	maxParallel := scanCfg.MaxParallelHosts
+	if maxParallel < 1 {
+		maxParallel = cfg.SSDefaultMaxParallelHosts
+	}
+	sem := make(chan struct{}, maxParallel)
+	saturated := false
+
 	for _, ip := range ips {
+		select {
+		case sem <- struct{}{}:
+		default:
+			if !saturated {
+				cmn.DebugMsg(cmn.DbgLvlDebug, "ServiceScout: %d hosts being scanned, the other hosts wait for a free slot", maxParallel)
+				saturated = true
+			}
+			sem <- struct{}{}
+		}
 		wg.Add(1)
 		go func(ip string) {
 			defer wg.Done()
-
-			// Scan the host
-			hosts, err := ni.scanHost(scanCfg, ip)
-			if err != nil {
-				cmn.DebugMsg(cmn.DbgLvlDebug, "error scanning host %s: %v", ip, err)
+			defer func() { <-sem }()
+
+			// Scan the host (unless it has been scanned recently)
+			var hosts []HostInfo
+			var err error
+			cached := false
+			key := ""
+			if cache != nil {
+				key = serviceScoutCacheKey(scanCfg, ip)
+				hosts, cached = cache.get(key, ttl, time.Now())
+			}
+			if cached {
+				cmn.DebugMsg(cmn.DbgLvlDebug, "ServiceScout results for host %s served from cache", ip)
+			} else {
+				hosts, err = scan(scanCfg, ip)
+				if err != nil {
+					cmn.DebugMsg(cmn.DbgLvlDebug, "error scanning host %s: %v", ip, err)
+				} else if cache != nil {
+					cache.put(key, hosts, time.Now())
+				}
 			}
 
 			// check if hosts is empty, and if it is add an empty HostInfo struct to it
@@ -549,18 +660,18 @@ func (ni *NetInfo) scanHosts(scanCfg *cfg.ServiceScoutConfig) ([]HostInfo, error
 			mu.Lock()
 			fHosts = append(fHosts, hosts...)
 			mu.Unlock()
-
-			// Log the raw results if we are in debug mode:
-			jsonData, err := json.MarshalIndent(fHosts, "", "  ")
-			if err == nil {
-				cmn.DebugMsg(cmn.DbgLvlDebug3, "ServiceScout results: %s", string(jsonData))
-			}
 		}(ip)
 	}
 
 	wg.Wait()
 	cmn.DebugMsg(cmn.DbgLvlDebug, "ServiceScout scan completed")
 
+	// Log the raw results if we are in debug mode:
+	jsonData, err := json.MarshalIndent(fHosts, "", "  ")
+	if err == nil {
+		cmn.DebugMsg(cmn.DbgLvlDebug3, "ServiceScout results: %s", string(jsonData))
+	}
+
 	return fHosts, nil
 }
 
@@ -0,0 +1,170 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netinfo provides functionality to extract network information
+package netinfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+var (
+	// serviceScoutCaches holds the ServiceScout results caches (by cache file)
+	serviceScoutCaches      = make(map[string]*serviceScoutCache)
+	serviceScoutCachesMutex sync.Mutex
+)
+
+// serviceScoutCacheEntry is the cached scan result of a host
+type serviceScoutCacheEntry struct {
+	ScannedAt time.Time  `json:"scanned_at"`
+	Hosts     []HostInfo `json:"hosts"`
+}
+
+// serviceScoutCache caches the ServiceScout scan results of each host (by host
+// and scan configuration). When it has a path, every result is saved as soon as
+// it's available, so a multi-host scan interrupted by a crash or a restart
+// resumes from the hosts not scanned yet.
+type serviceScoutCache struct {
+	mutex   sync.Mutex
+	path    string
+	entries map[string]serviceScoutCacheEntry
+}
+
+// getServiceScoutCache returns the cache saved in path (loading it the first
+// time it's used). An empty path returns the in memory only cache.
+func getServiceScoutCache(path string) *serviceScoutCache {
+	serviceScoutCachesMutex.Lock()
+	defer serviceScoutCachesMutex.Unlock()
+
+	if cache, ok := serviceScoutCaches[path]; ok {
+		return cache
+	}
+	cache := &serviceScoutCache{
+		path:    path,
+		entries: make(map[string]serviceScoutCacheEntry),
+	}
+	cache.load()
+	serviceScoutCaches[path] = cache
+	return cache
+}
+
+// serviceScoutCacheKey returns the cache key of a host scanned with scanCfg.
+// The cache settings (and the limits on the hosts scanned) are not part of
+// the key, so changing them doesn't invalidate the results
+// already cached.
+func serviceScoutCacheKey(scanCfg *cfg.ServiceScoutConfig, ip string) string {
+	keyCfg := *scanCfg
+	keyCfg.CacheTTL = 0
+	keyCfg.CachePath = ""
+	keyCfg.MaxParallelHosts = 0
+	keyCfg.MaxRangeHosts = 0
+	data, err := json.Marshal(keyCfg)
+	if err != nil {
+		return ip
+	}
+	hash := sha256.Sum256(data)
+	return ip + "|" + hex.EncodeToString(hash[:])
+}
+
+// get returns the hosts cached for key if they were scanned less than ttl ago
+func (c *serviceScoutCache) get(key string, ttl time.Duration, now time.Time) ([]HostInfo, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || now.Sub(entry.ScannedAt) >= ttl {
+		return nil, false
+	}
+	return entry.Hosts, true
+}
+
+// put caches the hosts scanned for key and saves the cache (if it has a path)
+func (c *serviceScoutCache) put(key string, hosts []HostInfo, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[key] = serviceScoutCacheEntry{
+		ScannedAt: now,
+		Hosts:     hosts,
+	}
+	c.save()
+}
+
+// purge removes the entries older than ttl
+func (c *serviceScoutCache) purge(ttl time.Duration, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, entry := range c.entries {
+		if now.Sub(entry.ScannedAt) >= ttl {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// load reads the cache file (if any)
+func (c *serviceScoutCache) load() {
+	if c.path == "" {
+		return
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			cmn.DebugMsg(cmn.DbgLvlError, "reading ServiceScout cache '%s': %v", c.path, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "parsing ServiceScout cache '%s': %v", c.path, err)
+		c.entries = make(map[string]serviceScoutCacheEntry)
+	}
+}
+
+// save writes the cache file (if any). The file is replaced atomically, so a
+// crash while saving doesn't corrupt it. The caller must hold the mutex.
+func (c *serviceScoutCache) save() {
+	if c.path == "" {
+		return
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "encoding ServiceScout cache: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "saving ServiceScout cache '%s': %v", c.path, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck // We are already reporting an error
+		cmn.DebugMsg(cmn.DbgLvlError, "saving ServiceScout cache '%s': %v", c.path, err)
+	}
+}
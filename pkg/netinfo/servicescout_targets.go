@@ -0,0 +1,135 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netinfo provides functionality to extract network information
+package netinfo
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+)
+
+// expandTargets returns the host addresses of the ServiceScout targets: the
+// CIDR blocks (e.g. 10.0.0.0/24) and the IP ranges (e.g. 10.0.0.1-10.0.0.20)
+// are expanded to their host addresses, the other targets are kept as they
+// are. The addresses are deduplicated (in order). The ranges with more than
+// maxHosts addresses are skipped.
+func expandTargets(targets []string, maxHosts int) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+
+		expanded := []string{target}
+		var err error
+		switch {
+		case strings.Contains(target, "/"):
+			expanded, err = expandCIDR(target, maxHosts)
+		case isIPRange(target):
+			expanded, err = expandIPRange(target, maxHosts)
+		}
+		if err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "ServiceScout: skipping target %s: %v", target, err)
+			continue
+		}
+
+		for _, host := range expanded {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// expandCIDR returns the host addresses of a CIDR block (IPv4 or IPv6). The
+// network and broadcast addresses of the IPv4 blocks larger than a /31 are
+// not host addresses. Blocks with more than maxHosts addresses are rejected.
+func expandCIDR(cidr string, maxHosts int) ([]string, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR block: %v", err)
+	}
+	prefix = prefix.Masked()
+
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits >= 63 || (1<<hostBits) > maxHosts+2 {
+		return nil, fmt.Errorf("CIDR block %s has more than %d addresses", prefix, maxHosts)
+	}
+	first, last := prefix.Addr(), lastAddr(prefix)
+	if prefix.Addr().Is4() && hostBits > 1 {
+		// Skip the network and broadcast addresses
+		first, last = first.Next(), last.Prev()
+	}
+	return addrRange(first, last, maxHosts)
+}
+
+// isIPRange returns true if the target is an IP range (and not a hostname
+// with a dash)
+func isIPRange(target string) bool {
+	start, _, found := strings.Cut(target, "-")
+	if !found {
+		return false
+	}
+	_, err := netip.ParseAddr(strings.TrimSpace(start))
+	return err == nil
+}
+
+// expandIPRange returns the addresses of an IP range (start-end, both
+// included). Ranges with more than maxHosts addresses are rejected.
+func expandIPRange(ipRange string, maxHosts int) ([]string, error) {
+	start, end, _ := strings.Cut(ipRange, "-")
+	first, err := netip.ParseAddr(strings.TrimSpace(start))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP range: %v", err)
+	}
+	last, err := netip.ParseAddr(strings.TrimSpace(end))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP range: %v", err)
+	}
+	if first.Is4() != last.Is4() || last.Less(first) {
+		return nil, fmt.Errorf("invalid IP range: %s is not after %s", last, first)
+	}
+	return addrRange(first, last, maxHosts)
+}
+
+// addrRange returns the addresses from first to last (both included), or an
+// error if they are more than maxHosts
+func addrRange(first, last netip.Addr, maxHosts int) ([]string, error) {
+	var addrs []string
+	for addr := first; addr.IsValid() && !last.Less(addr); addr = addr.Next() {
+		if len(addrs) == maxHosts {
+			return nil, fmt.Errorf("range %s-%s has more than %d addresses", first, last, maxHosts)
+		}
+		addrs = append(addrs, addr.String())
+	}
+	return addrs, nil
+}
+
+// lastAddr returns the last address of a (masked) prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
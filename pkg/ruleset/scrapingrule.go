@@ -76,6 +76,39 @@ func (r *ScrapingRule) GetPostProcessing() []PostProcessingStep {
 	return r.PostProcessing
 }
 
+// GetNotFoundPolicy returns the policy to apply to the elements that can't be
+// found on a page ("null" if the policy is missing or unknown).
+func (r *ScrapingRule) GetNotFoundPolicy() string {
+	policy := strings.ToLower(strings.TrimSpace(r.NotFound.Policy))
+	switch policy {
+	case NotFoundNull, NotFoundOmit, NotFoundDefault, NotFoundError:
+		return policy
+	default:
+		return NotFoundEmpty
+	}
+}
+
+// HasDetailPages returns true if the scraping rule follows the item links of a
+// listing page to scrape their detail pages.
+func (r *ScrapingRule) HasDetailPages() bool {
+	return len(r.DetailPages.Links) > 0 && strings.TrimSpace(r.DetailPages.Rule) != ""
+}
+
+// HasPagination returns true if the scraping rule detects the totals of a
+// paginated listing.
+func (r *ScrapingRule) HasPagination() bool {
+	return len(r.Pagination.Selectors) > 0
+}
+
+// GetPaginationUnit returns what the pagination total of the scraping rule
+// counts ("pages" if the unit is missing or unknown).
+func (r *ScrapingRule) GetPaginationUnit() string {
+	if strings.ToLower(strings.TrimSpace(r.Pagination.Unit)) == PaginationItems {
+		return PaginationItems
+	}
+	return PaginationPages
+}
+
 // GetConditionType returns the condition type for the specified wait condition.
 func (w *WaitCondition) GetConditionType() string {
 	return strings.ToLower(strings.TrimSpace(w.ConditionType))
@@ -144,6 +144,25 @@ func TestScrapingRuleGetPostProcessing(t *testing.T) {
 	}
 }
 
+// TestScrapingRule_GetNotFoundPolicy tests the GetNotFoundPolicy method of ScrapingRule
+func TestScrapingRuleGetNotFoundPolicy(t *testing.T) {
+	tests := map[string]string{
+		"":          NotFoundEmpty,
+		"empty":     NotFoundEmpty,
+		"null":      NotFoundNull,
+		" Omit ":    NotFoundOmit,
+		"default":   NotFoundDefault,
+		"ERROR":     NotFoundError,
+		"something": NotFoundEmpty,
+	}
+	for policy, expected := range tests {
+		r := ScrapingRule{NotFound: NotFoundPolicy{Policy: policy}}
+		if got := r.GetNotFoundPolicy(); got != expected {
+			t.Errorf("GetNotFoundPolicy(%q) = %v, want %v", policy, got, expected)
+		}
+	}
+}
+
 // TestWaitCondition_GetConditionType tests the GetConditionType method of WaitCondition
 func TestWaitConditionGetConditionType(t *testing.T) {
 	conditionType := "TestConditionType"
@@ -38,6 +38,22 @@ const (
 	arrTypeBool    = "[]bool"
 	arrTypeFloat64 = "[]float64"
 	arrTypeUnknown = "[]unknown"
+
+	// NotFoundEmpty stores an empty list for an element that can't be found (default)
+	NotFoundEmpty = "empty"
+	// NotFoundNull stores null for an element that can't be found
+	NotFoundNull = "null"
+	// NotFoundOmit leaves out the key of an element that can't be found
+	NotFoundOmit = "omit"
+	// NotFoundDefault stores a default value for an element that can't be found
+	NotFoundDefault = "default"
+	// NotFoundError makes the scraping rule fail when an element can't be found
+	NotFoundError = "error"
+
+	// PaginationPages counts the pages of a paginated listing (default)
+	PaginationPages = "pages"
+	// PaginationItems counts the items of a paginated listing
+	PaginationItems = "items"
 )
 
 // RuleEngine represents the top-level structure for the rule engine
@@ -227,6 +243,36 @@ type ScrapingRule struct {
 	JsFiles           bool                   `json:"js_files" yaml:"js_files"`
 	JSONFieldMappings map[string]string      `json:"json_field_mappings" yaml:"json_field_mappings"`
 	PostProcessing    []PostProcessingStep   `json:"post_processing" yaml:"post_processing"`
+	ErrorHandling     ErrorHandling          `json:"error_handling" yaml:"error_handling"`
+	NotFound          NotFoundPolicy         `json:"not_found,omitempty" yaml:"not_found,omitempty"`
+	DetailPages       DetailPages            `json:"detail_pages,omitempty" yaml:"detail_pages,omitempty"`
+	Pagination        Pagination             `json:"pagination,omitempty" yaml:"pagination,omitempty"`
+}
+
+// Pagination defines how a scraping rule detects the total number of pages (or
+// items) of a paginated listing, so the crawl can tell if it captured everything
+type Pagination struct {
+	Key       string     `json:"key,omitempty" yaml:"key,omitempty"`             // The key where the pagination metadata is stored (default "pagination")
+	Selectors []Selector `json:"selectors" yaml:"selectors"`                     // The selectors of the element with the totals (e.g., "Page 1 of 5" or "340 results")
+	Pattern   string     `json:"pattern,omitempty" yaml:"pattern,omitempty"`     // A regular expression with a "total" (and optionally a "current") named group
+	Unit      string     `json:"unit,omitempty" yaml:"unit,omitempty"`           // What the total counts: "pages" (default) or "items"
+	ItemsKey  string     `json:"items_key,omitempty" yaml:"items_key,omitempty"` // The key of the items scraped on each page (unit "items")
+}
+
+// DetailPages defines how a scraping rule follows the item links of a listing
+// page to scrape the detail page of each item (list-detail pattern)
+type DetailPages struct {
+	Key      string     `json:"key,omitempty" yaml:"key,omitempty"`             // The key where the list items are stored (default "items")
+	Links    []Selector `json:"links" yaml:"links"`                             // The selectors of the item links (the href attribute is used unless extract is set)
+	Rule     string     `json:"rule" yaml:"rule"`                               // The name of the scraping rule to apply to each detail page
+	MaxItems int        `json:"max_items,omitempty" yaml:"max_items,omitempty"` // The maximum number of detail pages to visit (0 means no limit)
+}
+
+// NotFoundPolicy defines what a scraping rule does with the elements whose
+// selectors match nothing on the page
+type NotFoundPolicy struct {
+	Policy  string `json:"policy" yaml:"policy"`                       // "empty" (default), "null", "omit", "default" or "error"
+	Default string `json:"default,omitempty" yaml:"default,omitempty"` // The value to use with the "default" policy
 }
 
 // ActionRule represents an action rule
@@ -247,6 +293,7 @@ type Element struct {
 	Key       string     `json:"key" yaml:"key"`
 	Selectors []Selector `json:"selectors" yaml:"selectors"`
 	Critical  bool       `json:"critical" yaml:"critical"`
+	Output    string     `json:"output,omitempty" yaml:"output,omitempty"` // Name of the KV store variable to save the extracted value to (usable as ${name} by later rules)
 }
 
 // Selector represents a single selector
@@ -283,6 +330,7 @@ type WaitCondition struct {
 	Selector      Selector `json:"selector,omitempty" yaml:"selector,omitempty"`
 	CustomJS      string   `json:"custom_js,omitempty" yaml:"custom_js,omitempty"`
 	Value         string   `json:"value,omitempty" yaml:"value,omitempty"`
+	Timeout       int      `json:"timeout,omitempty" yaml:"timeout,omitempty"` // Maximum time (in seconds) to wait for a plugin_call or element condition to be ready
 }
 
 // PostProcessingStep represents a single post-processing step
@@ -502,11 +550,11 @@ type LoggingConfiguration struct {
 	LogFile  string `yaml:"log_file,omitempty"`
 }
 
-// ErrorHandling represents the error handling configuration for the action rule
+// ErrorHandling represents the error handling configuration for action and scraping rules
 type ErrorHandling struct {
-	Ignore     bool `yaml:"ignore"`
-	RetryCount int  `yaml:"retry_count"`
-	RetryDelay int  `yaml:"retry_delay"`
+	Ignore     bool `json:"ignore" yaml:"ignore"`
+	RetryCount int  `json:"retry_count" yaml:"retry_count"`
+	RetryDelay int  `json:"retry_delay" yaml:"retry_delay"`
 }
 
 // RuleParser defines an interface for parsing rules.
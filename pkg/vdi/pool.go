@@ -0,0 +1,276 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vdi is an abstraction layer for the Virtual Desktop Infrastructure (VDI) used by the Crowler.
+package vdi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
+)
+
+const poolHealthCheckTimeout = 10 // Timeout (in seconds) of the health check of a VDI
+
+// Pool holds the Selenium instances (VDIs) available to the engine: each
+// configured VDI has as many instances as the sessions it can run
+// concurrently (its instances setting). The idle instances are handed out
+// through the pool channel and health-checked periodically (one at a time):
+// the ones whose Selenium server doesn't respond are kept out of the pool
+// until they are reconnected.
+type Pool struct {
+	instances   chan SeleniumInstance
+	size        int
+	mutex       sync.Mutex
+	dead        []SeleniumInstance                   // Instances taken out of the pool by the health checks
+	services    map[*Service]int                     // Number of instances using each Selenium service
+	check       func(SeleniumInstance) error         // Health check of an instance
+	connect     func(cfg.Selenium) (*Service, error) // (Re)connects the Selenium service of a VDI
+	stopService func(*Service) error                 // Stops a Selenium service
+	stop        context.CancelFunc                   // Stops the health checks
+}
+
+// NewPool creates the pool of the Selenium instances of the configured VDIs
+func NewPool(config []cfg.Selenium) (*Pool, error) {
+	size := 0
+	for _, c := range config {
+		size += vdiInstances(c)
+	}
+	p := &Pool{
+		instances:   make(chan SeleniumInstance, size),
+		size:        size,
+		services:    make(map[*Service]int),
+		check:       checkVDIStatus,
+		connect:     NewVDIService,
+		stopService: StopSelenium,
+	}
+	for i, c := range config {
+		service, err := p.connect(c)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		for n := 0; n < vdiInstances(c); n++ {
+			p.instances <- SeleniumInstance{Service: service, Config: c, Index: i}
+		}
+		if service != nil {
+			p.services[service] = vdiInstances(c)
+		}
+	}
+	return p, nil
+}
+
+// vdiInstances returns the number of instances of a VDI (at least 1)
+func vdiInstances(c cfg.Selenium) int {
+	if c.Instances < 1 {
+		return 1
+	}
+	return c.Instances
+}
+
+// Channel returns the channel the idle instances are handed out (and
+// returned) through
+func (p *Pool) Channel() *chan SeleniumInstance {
+	return &p.instances
+}
+
+// Size returns the number of instances of the pool (in use, idle and out of
+// the pool)
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// StartHealthChecks health-checks the pool every interval, until ctx is
+// cancelled or the pool is closed (a non-positive interval disables the
+// health checks)
+func (p *Pool) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p.mutex.Lock()
+	if p.stop != nil {
+		p.stop()
+	}
+	p.stop = cancel
+	p.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if dead := p.CheckHealth(); dead > 0 {
+					cmn.DebugMsg(cmn.DbgLvlWarn, "VDI instances out of the pool: %d of %d", dead, p.size)
+				}
+			}
+		}
+	}()
+}
+
+// CheckHealth health-checks the idle instances of the pool (the ones in use
+// are checked by their crawls), one at a time so the pool is never short of
+// more than one of them while it waits for a check: the ones that don't
+// respond are taken out of the pool, the ones taken out by the previous
+// checks are reconnected and put back if they respond again. It returns the
+// number of instances out of the pool.
+func (p *Pool) CheckHealth() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	retry := p.dead
+	p.dead = nil
+
+	// The pool channel is a FIFO, so each idle instance is checked once
+checks:
+	for n := len(p.instances); n > 0; n-- {
+		var sel SeleniumInstance
+		select {
+		case sel = <-p.instances:
+		default:
+			break checks // The remaining idle instances are in use now
+		}
+		if err := p.check(sel); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "VDI instance %s (%s:%d) failed its health check, taking it out of the pool: %v", sel.Config.Name, sel.Config.Host, sel.Config.Port, err)
+			p.dead = append(p.dead, sel)
+			continue
+		}
+		p.instances <- sel
+	}
+
+	for _, sel := range retry {
+		if err := p.reconnect(&sel); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "VDI instance %s (%s:%d) is still unavailable: %v", sel.Config.Name, sel.Config.Host, sel.Config.Port, err)
+			p.dead = append(p.dead, sel)
+			continue
+		}
+		cmn.DebugMsg(cmn.DbgLvlInfo, "VDI instance %s (%s:%d) reconnected, putting it back in the pool", sel.Config.Name, sel.Config.Host, sel.Config.Port)
+		p.instances <- sel
+	}
+	return len(p.dead)
+}
+
+// idleInstances takes the idle instances out of the pool
+func (p *Pool) idleInstances() []SeleniumInstance {
+	var idle []SeleniumInstance
+	for {
+		select {
+		case sel := <-p.instances:
+			idle = append(idle, sel)
+		default:
+			return idle
+		}
+	}
+}
+
+// reconnect reconnects an instance taken out of the pool (with a Selenium
+// service of its own) and health-checks it. The service it was using is
+// stopped only if no other instance (in use or not) still uses it.
+func (p *Pool) reconnect(sel *SeleniumInstance) error {
+	if sel.Service != nil {
+		p.releaseService(sel.Service)
+		sel.Service = nil
+	}
+	service, err := p.connect(sel.Config)
+	if err != nil {
+		return err
+	}
+	sel.Service = service
+	if service != nil {
+		p.services[service]++
+	}
+	return p.check(*sel)
+}
+
+// releaseService releases the Selenium service of an instance, stopping it if
+// no other instance uses it
+func (p *Pool) releaseService(service *Service) {
+	p.services[service]--
+	if p.services[service] > 0 {
+		return
+	}
+	delete(p.services, service)
+	_ = p.stopService(service) // It logs its errors
+}
+
+// Close stops the health checks and the Selenium services of the idle
+// instances of the pool (the instances in use aren't waited for, they can
+// still be returned to the pool)
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.stop != nil {
+		p.stop()
+		p.stop = nil
+	}
+
+	instances := append(p.dead, p.idleInstances()...)
+	p.dead = nil
+
+	// The instances of a VDI share its service
+	stopped := make(map[*Service]bool)
+	for _, sel := range instances {
+		if sel.Service == nil || stopped[sel.Service] {
+			continue
+		}
+		stopped[sel.Service] = true
+		_ = p.stopService(sel.Service) // It logs its errors
+	}
+}
+
+// checkVDIStatus checks that the Selenium server of an instance responds to
+// its status requests (the W3C WebDriver status endpoint)
+func checkVDIStatus(sel SeleniumInstance) error {
+	protocol := cmn.HTTPStr
+	if sel.Config.SSLMode == cmn.EnableStr {
+		protocol = cmn.HTTPSStr
+	}
+	host := strings.TrimSpace(sel.Config.Host)
+	if host == "" {
+		host = "selenium"
+	}
+	statusURL := fmt.Sprintf("%s://%s:%d/wd/hub/status", protocol, host, sel.Config.Port)
+
+	httpClient := &http.Client{Timeout: time.Duration(poolHealthCheckTimeout) * time.Second}
+	resp, err := httpClient.Get(statusURL) //nolint:gosec // The URL is the configured VDI one
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // We can't check the error in a defer
+
+	// A busy server still responds (with its ready flag unset)
+	var status struct {
+		Value json.RawMessage `json:"value"`
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &status); err != nil || len(status.Value) == 0 {
+		return errors.New("unexpected status response (HTTP " + resp.Status + ")")
+	}
+	return nil
+}
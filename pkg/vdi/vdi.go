@@ -2,10 +2,17 @@
 package vdi
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	selenium "github.com/go-auxiliaries/selenium"
@@ -156,6 +163,7 @@ type SeleniumInstance struct {
 	Service *Service
 	Config  cfg.Selenium
 	Mutex   *sync.Mutex
+	Index   int // Index of the VDI configuration (in the configuration Selenium list)
 }
 
 // ProcessContextInterface abstracts the necessary methods required by ConnectVDI.
@@ -168,6 +176,7 @@ type ProcessContextInterface interface {
 	GetVDIReturnedFlag() *bool
 	SetVDIReturnedFlag(bool)
 	GetVDIInstance() *SeleniumInstance
+	GetRand() *rand.Rand // The random choices generator (nil if they aren't reproducible)
 }
 
 // WebDriverToSeleniumWebDriver converts a VDI WebDriver to a Selenium WebDriver
@@ -252,6 +261,171 @@ func StopSelenium(sel *selenium.Service) error {
 	return err
 }
 
+// addIgnoreCertErrors configures the session to accept invalid (e.g., self-signed)
+// TLS certificates when ignore is true. It returns the updated browser args.
+func addIgnoreCertErrors(caps selenium.Capabilities, args []string, browser string, ignore bool) []string {
+	if !ignore {
+		return args
+	}
+	cmn.DebugMsg(cmn.DbgLvlWarn, "ignore_cert_errors is enabled: TLS certificate errors will be ignored for this Source, this is insecure and should be used only for trusted (e.g., internal) Sources")
+	caps["acceptInsecureCerts"] = true
+	if browser == BrowserChrome || browser == BrowserChromium {
+		args = append(args, "--ignore-certificate-errors")
+	}
+	return args
+}
+
+// vdiProxy returns the proxy the browser of the VDI sel connects through: the
+// one of the same VDI in the process configuration (that the Source
+// configuration may have overridden), or the one of sel.
+func vdiProxy(sel cfg.Selenium, pConfig *cfg.Config) cfg.Proxy {
+	for i := range pConfig.Selenium {
+		if pConfig.Selenium[i].Name == sel.Name {
+			return pConfig.Selenium[i].GetProxy()
+		}
+	}
+	return sel.GetProxy()
+}
+
+// proxyAddress returns the "host:port" address of the proxy (the format of
+// the W3C proxy capability, which takes no scheme)
+func proxyAddress(proxy cfg.Proxy) string {
+	if proxy.Port == 0 {
+		return proxy.Host
+	}
+	return net.JoinHostPort(proxy.Host, strconv.Itoa(proxy.Port))
+}
+
+// addProxy configures the session to connect through the proxy (if any). It
+// returns the updated browser args.
+//
+// Chrome and Chromium get the --proxy-server=<scheme>://<host>:<port> arg
+// (the W3C proxy capability is translated to it by chromedriver anyway),
+// while Firefox gets the W3C proxy capability: {"proxyType": "manual",
+// "httpProxy": "<host>:<port>", "sslProxy": "<host>:<port>"} for HTTP(S)
+// proxies, and {"proxyType": "manual", "socksProxy": "<host>:<port>",
+// "socksVersion": 5} for SOCKS proxies. The local networks bypass the proxy,
+// so the browser can still reach the VDI services.
+func addProxy(caps selenium.Capabilities, args []string, browser string, proxy cfg.Proxy) []string {
+	if proxy.IsEmpty() {
+		return args
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug2, "Setting up Proxy...")
+
+	noProxy := []string{cmn.LoalhostStr}
+	if localNet, err := cmn.DetectLocalNetwork(); err == nil {
+		noProxy = append(noProxy, localNet)
+	}
+	socks := strings.HasPrefix(proxy.Scheme, "socks")
+
+	if browser == BrowserChrome || browser == BrowserChromium {
+		args = append(args, "--proxy-server="+proxy.Scheme+"://"+proxyAddress(proxy))
+		args = append(args, "--proxy-bypass-list="+strings.Join(noProxy, ","))
+		if socks && proxy.Username != "" {
+			cmn.DebugMsg(cmn.DbgLvlWarn, "Chrome doesn't support authenticated SOCKS proxies, the proxy credentials are ignored")
+		}
+	} else {
+		selProxy := selenium.Proxy{Type: selenium.Manual, NoProxy: noProxy}
+		if socks {
+			selProxy.SOCKS = proxyAddress(proxy)
+			selProxy.SOCKSVersion = 5
+			if proxy.Scheme == "socks4" {
+				selProxy.SOCKSVersion = 4
+			}
+			selProxy.SOCKSUsername = proxy.Username
+			selProxy.SOCKSPassword = proxy.Password
+		} else {
+			selProxy.HTTP = proxyAddress(proxy)
+			selProxy.SSL = proxyAddress(proxy)
+		}
+		caps.AddProxy(selProxy)
+	}
+
+	cmn.DebugMsg(cmn.DbgLvlDebug2, "Proxy settings: '%s://%s', Exclusions: '%s'", proxy.Scheme, proxyAddress(proxy), strings.Join(noProxy, ","))
+	return args
+}
+
+// proxyAuthManifest and proxyAuthScript are the Chrome extension answering
+// the authentication requests of the HTTP(S) proxy with its credentials
+// (Chrome can't take them in the --proxy-server arg)
+const (
+	proxyAuthManifest = `{
+	"manifest_version": 3,
+	"name": "CROWler Proxy Authentication",
+	"version": "1.0",
+	"permissions": ["webRequest", "webRequestAuthProvider"],
+	"host_permissions": ["<all_urls>"],
+	"background": {"service_worker": "background.js"}
+}`
+	proxyAuthScript = `const credentials = %s;
+chrome.webRequest.onAuthRequired.addListener(
+	(details, callback) => callback(details.isProxy ? {authCredentials: credentials} : {}),
+	{urls: ["<all_urls>"]},
+	["asyncBlocking"]
+);`
+)
+
+// addProxyAuth adds to the Chrome capabilities the extension authenticating
+// with the HTTP(S) proxy (if it has credentials)
+func addProxyAuth(chromeCaps *chrome.Capabilities, proxy cfg.Proxy) error {
+	if proxy.IsEmpty() || proxy.Username == "" || strings.HasPrefix(proxy.Scheme, "socks") {
+		return nil
+	}
+	credentials, err := json.Marshal(map[string]string{"username": proxy.Username, "password": proxy.Password})
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "crowler-proxy-auth-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir) //nolint:errcheck // We can't check the error in a defer
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(proxyAuthManifest), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "background.js"), []byte(fmt.Sprintf(proxyAuthScript, credentials)), 0600); err != nil {
+		return err
+	}
+	return chromeCaps.AddUnpackedExtension(dir)
+}
+
+// userAgentTurn is the turn of the next session in the round-robin of the
+// User-Agents pool
+var userAgentTurn atomic.Uint64
+
+// PickUserAgent returns the User-Agent of a new session (or of a session
+// changing it, with the always reset cookies policy): the one picked from
+// the configured pool according to the User-Agent mode, or (if there is no
+// pool) one from the User-Agents database matching the platform and browser.
+// Random picks use rng (so they can be reproduced with the same seed).
+func PickUserAgent(crawler *cfg.Crawler, rng *rand.Rand, browser string, browseType int) string {
+	if len(crawler.UserAgents) > 0 {
+		switch strings.ToLower(strings.TrimSpace(crawler.UserAgentMode)) {
+		case cfg.UserAgentModeRandom:
+			return crawler.UserAgents[cmn.RandomIndex(rng, len(crawler.UserAgents))]
+		case cfg.UserAgentModeRoundRobin:
+			turn := userAgentTurn.Add(1) - 1
+			return crawler.UserAgents[turn%uint64(len(crawler.UserAgents))]
+		default:
+			return crawler.UserAgents[0]
+		}
+	}
+
+	// Get the user agent string from the UserAgentsDB
+	userAgent := cmn.UADB.GetAgentByTypeAndOSAndBRG(rng, crawler.Platform, crawler.BrowserPlatform, browser)
+
+	// Fallback in case the user agent is not found in the UserAgentsDB
+	if userAgent == "" {
+		if browseType == 0 {
+			userAgent = cmn.UsrAgentStrMap[browser+"-desktop01"]
+		} else if browseType == 1 {
+			userAgent = cmn.UsrAgentStrMap[browser+"-mobile01"]
+		}
+	}
+	return userAgent
+}
+
 // ConnectVDI is responsible for connecting to the Selenium server instance
 func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType int) (WebDriver, error) {
 	// Get the required browser
@@ -274,20 +448,9 @@ func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType in
 	// Get process configuration
 	pConfig := ctx.GetConfig()
 
-	// Define the user agent string for a desktop Google Chrome browser
-	var userAgent string
-
-	// Get the user agent string from the UserAgentsDB
-	userAgent = cmn.UADB.GetAgentByTypeAndOSAndBRG(pConfig.Crawler.Platform, pConfig.Crawler.BrowserPlatform, browser)
-
-	// Fallback in case the user agent is not found in the UserAgentsDB
-	if userAgent == "" {
-		if browseType == 0 {
-			userAgent = cmn.UsrAgentStrMap[browser+"-desktop01"]
-		} else if browseType == 1 {
-			userAgent = cmn.UsrAgentStrMap[browser+"-mobile01"]
-		}
-	}
+	// Define the user agent string of the session
+	userAgent := pConfig.Crawler.ContactUserAgent(PickUserAgent(&pConfig.Crawler, ctx.GetRand(), browser, browseType))
+	cmn.DebugMsg(cmn.DbgLvlDebug, "Using User-Agent '%s' (mode: %s)", userAgent, pConfig.Crawler.UserAgentMode)
 
 	var args []string
 
@@ -316,61 +479,8 @@ func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType in
 	}
 
 	// Append proxy settings if available
-	if sel.Config.ProxyURL != "" {
-		cmn.DebugMsg(cmn.DbgLvlDebug2, "Setting up Proxy...")
-		args = append(args, "--proxy-server="+sel.Config.ProxyURL)
-		args = append(args, "--force-proxy-for-all")
-		// Get local network:
-		localNet, err := cmn.DetectLocalNetwork()
-		if err == nil {
-			args = append(args, "--proxy-bypass-list=localhost,"+localNet)
-		} else {
-			args = append(args, "--proxy-bypass-list=localhost")
-		}
-
-		cmn.DebugMsg(cmn.DbgLvlDebug2, "Proxy settings: URL '%s', Exclusions: '%s'", sel.Config.ProxyURL, "localhost,"+localNet)
-
-		/*
-			proxyURL, err := url.Parse(sel.Config.ProxyURL)
-			if err != nil {
-				return nil, err
-			}
-
-			// extract port number if available
-			if sel.Config.ProxyPort == 0 {
-				proxyPort, _ := strconv.Atoi(proxyURL.Port())
-				sel.Config.ProxyPort = proxyPort
-			}
-			proxyFQDN := proxyURL.Hostname()
-			// add port if any available in the original proxy URL
-			if proxyURL.Port() != "" {
-				proxyFQDN = fmt.Sprintf("%s:%s", proxyFQDN, proxyURL.Port())
-			}
-
-			// convert proxy URL to socks5h:// format
-			proxyURL.Scheme = "socks5h"
-			ProxySocksURL := "socks5h://" + proxyURL.Hostname()
-
-			// Set NoProxy []string to local host and networks
-			NoProxy := []string{cmn.LoalhostStr}
-			NoProxy = append(NoProxy, getLocalNetworks()...)
-
-			// Proxy settings
-			selProxy := selenium.Proxy{
-				Type:          "manual",
-				HTTP:          "http://" + proxyFQDN,
-				SSL:           "https://" + proxyFQDN,
-				SOCKS:         ProxySocksURL,
-				SOCKSVersion:  5,
-				SOCKSUsername: sel.Config.ProxyUser,
-				SOCKSPassword: sel.Config.ProxyPass,
-				SocksPort:     sel.Config.ProxyPort,
-				NoProxy:       NoProxy,
-			}
-			caps.AddProxy(selProxy)
-			cmn.DebugMsg(cmn.DbgLvlDebug, "Proxy settings: %v\n", selProxy)
-		*/
-	}
+	proxy := vdiProxy(sel.Config, pConfig)
+	args = addProxy(caps, args, browser, proxy)
 
 	// General settings
 	if browser == BrowserChrome || browser == BrowserChromium {
@@ -473,6 +583,9 @@ func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType in
 		//args = append(args, "--autoplay-policy=user-required") // this option does't work and cause chrome/chromium to crash
 	}
 
+	// Ignore TLS certificate errors (only for Sources that asked for it)
+	args = addIgnoreCertErrors(caps, args, browser, pConfig.Crawler.IgnoreCertErrors)
+
 	// Append logging settings if available
 	args = append(args, "--enable-logging")
 	args = append(args, "--v=1")
@@ -529,11 +642,15 @@ func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType in
 		}
 
 		// Finalize the capabilities
-		caps.AddChrome(chrome.Capabilities{
+		chromeCaps := chrome.Capabilities{
 			Args:  args,
 			W3C:   true,
 			Prefs: chromePrefs,
-		})
+		}
+		if err := addProxyAuth(&chromeCaps, proxy); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "adding the proxy authentication to the VDI session: %v", err)
+		}
+		caps.AddChrome(chromeCaps)
 		cmn.DebugMsg(cmn.DbgLvlDebug5, "Chrome capabilities: %v\n", caps)
 	} else if browser == "firefox" {
 		firefoxCaps := map[string]interface{}{
@@ -635,6 +752,15 @@ func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType in
 		cmn.DebugMsg(cmn.DbgLvlError, "adding Load Listener to the VDI session: %v", err)
 	}
 
+	// Send the crawler identity headers (e.g., From) with all the requests
+	if headers := pConfig.Crawler.IdentityHeaders(); len(headers) > 0 {
+		if !cdpActive {
+			cmn.DebugMsg(cmn.DbgLvlDebug, "The %s VDI sessions don't support extra headers, the identity headers won't be sent", browser)
+		} else if err2 := SetExtraHeaders(wd, headers); err2 != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "setting the identity headers of the VDI session: %v", err2)
+		}
+	}
+
 	// Configure CDP
 	if cdpActive {
 		blockVideo := `chrome.debugger.attach({tabId: chrome.devtools.inspectedWindow.tabId}, "1.0", () => {
@@ -658,6 +784,19 @@ func ConnectVDI(ctx ProcessContextInterface, sel SeleniumInstance, browseType in
 	return wd, err
 }
 
+// SetExtraHeaders sets the extra headers sent with all the requests of a VDI
+// session, replacing the previous ones (through CDP, so only Chrome/Chromium
+// sessions support them)
+func SetExtraHeaders(wd WebDriver, headers map[string]string) error {
+	if _, err := wd.ExecuteChromeDPCommand("Network.enable", map[string]interface{}{}); err != nil {
+		return err
+	}
+	_, err := wd.ExecuteChromeDPCommand("Network.setExtraHTTPHeaders", map[string]interface{}{
+		"headers": headers,
+	})
+	return err
+}
+
 func addLoadListener(wd *WebDriver) error {
 	script := `
         window.addEventListener('load', () => {
@@ -42,14 +42,14 @@ func performAddSource(query string, qType int, db *cdb.Handler) (ConsoleResponse
 	var sqlQuery string
 	var sqlParams addSourceRequest
 	if qType == getQuery {
-		sqlParams.URL = cmn.NormalizeURL(query)
+		sqlParams.URL = cdb.NormalizeSourceURL(query)
 		//sqlQuery = "INSERT INTO Sources (url, last_crawled_at, status) VALUES ($1, NULL, 'pending')"
 		sqlQuery = "INSERT INTO Sources (url, last_crawled_at, category_id, usr_id, status, restricted, disabled, flags, config) VALUES ($1, NULL, 0, 0, 'pending', 2, false, 0, '{}')"
 	} else {
 		// extract the parameters from the query
 		extractAddSourceParams(query, &sqlParams)
 		// Normalize the URL
-		sqlParams.URL = cmn.NormalizeURL(sqlParams.URL)
+		sqlParams.URL = cdb.NormalizeSourceURL(sqlParams.URL)
 		// Prepare the SQL query
 		sqlQuery = "INSERT INTO Sources (url, last_crawled_at, status, restricted, disabled, flags, config, category_id, usr_id) VALUES ($1, NULL, $2, $3, $4, $5, $6, $7, $8) RETURNING source_id;"
 	}
@@ -58,12 +58,30 @@ func performAddSource(query string, qType int, db *cdb.Handler) (ConsoleResponse
 		return ConsoleResponse{Message: "Invalid URL"}, fmt.Errorf("invalid URL")
 	}
 
+	// Check if an equivalent source already exists (e.g., http vs https or a trailing slash)
+	sourceID, err := cdb.FindEquivalentSource(db, sqlParams.URL)
+	if err != nil {
+		cmn.DebugMsg(cmn.DbgLvlError, "adding the source: %v", err)
+		return ConsoleResponse{Message: "Failed to add the source"}, err
+	}
+	if sourceID != 0 {
+		if qType == getQuery {
+			// Nothing to update, the source is already there
+			return ConsoleResponse{Message: fmt.Sprintf("Website already present with ID: %d", sourceID)}, nil
+		}
+		// Update the existing source rather than adding a duplicate
+		sqlQuery = fmt.Sprintf("UPDATE Sources SET url = $1, status = $2, restricted = $3, disabled = $4, flags = $5, config = $6, category_id = $7, usr_id = $8, last_updated_at = NOW() WHERE source_id = %d RETURNING source_id;", sourceID)
+	}
+
 	// Perform the addSource operation
 	results, err := addSource(sqlQuery, sqlParams, db)
 	if err != nil {
 		cmn.DebugMsg(cmn.DbgLvlError, "adding the source: %v", err)
 		return results, err
 	}
+	if sourceID != 0 {
+		results.Message = fmt.Sprintf("Website already present, updated source with ID: %d", sourceID)
+	}
 
 	cmn.DebugMsg(cmn.DbgLvlInfo, results.Message)
 	cmn.DebugMsg(cmn.DbgLvlDebug3, "Website inserted with: %s", query)
@@ -148,6 +166,14 @@ func addSource(sqlQuery string, params addSourceRequest, db *cdb.Handler) (Conso
 		}
 	}
 
+	// Attach the tags (if any were provided) to the source
+	if params.Tags != nil {
+		if err := cdb.SetSourceTags(db, id, params.Tags); err != nil {
+			results.Message = "Failed to set the tags of the inserted website"
+			return results, err
+		}
+	}
+
 	// Create the response message adding the id of the inserted source
 	msg := fmt.Sprintf("Website inserted successfully with ID: %d", id)
 
@@ -319,7 +345,8 @@ func getURLStatus(tx *sql.Tx, sourceURL string) (StatusResponse, error) {
 			   restricted,
 			   disabled,
 			   flags,
-			   config
+			   config,
+			   COALESCE((SELECT string_agg(tag, ',' ORDER BY tag) FROM SourceTagIndex t WHERE t.source_id = Sources.source_id), '')
 		FROM Sources
 		WHERE url LIKE $1`
 
@@ -334,10 +361,14 @@ func getURLStatus(tx *sql.Tx, sourceURL string) (StatusResponse, error) {
 	for rows.Next() {
 		var row StatusResponseRow
 		var configJSON []byte
-		err = rows.Scan(&row.SourceID, &row.URL, &row.Status, &row.Engine, &row.CreatedAt, &row.LastUpdatedAt, &row.LastCrawledAt, &row.LastError, &row.LastErrorAt, &row.Restricted, &row.Disabled, &row.Flags, &configJSON)
+		var tags string
+		err = rows.Scan(&row.SourceID, &row.URL, &row.Status, &row.Engine, &row.CreatedAt, &row.LastUpdatedAt, &row.LastCrawledAt, &row.LastError, &row.LastErrorAt, &row.Restricted, &row.Disabled, &row.Flags, &configJSON, &tags)
 		if err != nil {
 			return results, err
 		}
+		if tags != "" {
+			row.Tags = strings.Split(tags, ",")
+		}
 		if configJSON != nil {
 			if err := json.Unmarshal(configJSON, &row.Config); err != nil {
 				return results, err
@@ -381,7 +412,7 @@ func getAllURLStatus(tx *sql.Tx) (StatusResponse, error) {
 	results.Message = "Failed to get all statuses"
 
 	// Proceed with getting all statuses
-	rows, err := tx.Query("SELECT source_id, url, status, engine, created_at, last_updated_at, last_crawled_at, last_error, last_error_at, restricted, disabled, flags, config FROM Sources")
+	rows, err := tx.Query("SELECT source_id, url, status, engine, created_at, last_updated_at, last_crawled_at, last_error, last_error_at, restricted, disabled, flags, config, COALESCE((SELECT string_agg(tag, ',' ORDER BY tag) FROM SourceTagIndex t WHERE t.source_id = Sources.source_id), '') FROM Sources")
 	if err != nil {
 		return results, err
 	}
@@ -391,10 +422,14 @@ func getAllURLStatus(tx *sql.Tx) (StatusResponse, error) {
 	for rows.Next() {
 		var row StatusResponseRow
 		var configJSON []byte
-		err = rows.Scan(&row.SourceID, &row.URL, &row.Status, &row.Engine, &row.CreatedAt, &row.LastUpdatedAt, &row.LastCrawledAt, &row.LastError, &row.LastErrorAt, &row.Restricted, &row.Disabled, &row.Flags, &configJSON)
+		var tags string
+		err = rows.Scan(&row.SourceID, &row.URL, &row.Status, &row.Engine, &row.CreatedAt, &row.LastUpdatedAt, &row.LastCrawledAt, &row.LastError, &row.LastErrorAt, &row.Restricted, &row.Disabled, &row.Flags, &configJSON, &tags)
 		if err != nil {
 			return results, err
 		}
+		if tags != "" {
+			row.Tags = strings.Split(tags, ",")
+		}
 		if configJSON != nil {
 			if err := json.Unmarshal(configJSON, &row.Config); err != nil {
 				return results, err
@@ -491,7 +526,7 @@ func performUpdateSource(query string, qType int, db *cdb.Handler) (ConsoleRespo
         WHERE source_id = $8
     `
 	_, err = (*db).Exec(updateQuery,
-		cmn.NormalizeURL(mergedData.URL),
+		cdb.NormalizeSourceURL(mergedData.URL),
 		mergedData.Status,
 		mergedData.Restricted,
 		mergedData.Disabled,
@@ -503,6 +538,12 @@ func performUpdateSource(query string, qType int, db *cdb.Handler) (ConsoleRespo
 	if err != nil {
 		return ConsoleResponse{Message: "Failed to update source"}, err
 	}
+	if sqlParams.Tags != nil {
+		sourceID := uint64(mergedData.SourceID) //nolint:gosec // This is a controlled value
+		if err := cdb.SetSourceTags(db, sourceID, sqlParams.Tags); err != nil {
+			return ConsoleResponse{Message: "Failed to update source tags"}, err
+		}
+	}
 
 	return ConsoleResponse{Message: "Source updated successfully"}, nil
 }
@@ -596,6 +637,31 @@ func performVacuumSource(query string, qType int, db *cdb.Handler) (ConsoleRespo
 	return ConsoleResponse{Message: "Source vacuumed successfully"}, nil
 }
 
+func performRecrawlSources(query string, qType int, db *cdb.Handler) (ConsoleResponse, error) {
+	var request cdb.RecrawlRequest
+
+	if qType == getQuery {
+		// Parse the query as a GET request (the tag)
+		request.Tag = query
+	} else {
+		// Parse the query as a POST request (JSON payload)
+		err := json.Unmarshal([]byte(query), &request)
+		if err != nil {
+			return ConsoleResponse{Message: "Invalid recrawl request"}, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	if strings.TrimSpace(request.Tag) == "" {
+		return ConsoleResponse{Message: "A tag must be provided"}, fmt.Errorf("missing tag")
+	}
+
+	scheduled, err := cdb.RecrawlSources(db, request.Tag)
+	if err != nil {
+		return ConsoleResponse{Message: "Failed to schedule the recrawl"}, err
+	}
+
+	return ConsoleResponse{Message: fmt.Sprintf("%d sources scheduled for recrawl", scheduled)}, nil
+}
+
 func performAddOwner(query string, qType int, db *cdb.Handler) (ConsoleResponse, error) {
 	var owner cdb.OwnerRequest // Define a struct for owner if not already present
 
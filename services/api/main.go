@@ -91,7 +91,8 @@ func initAll(configFile *string, config *cfg.Config, lmt **rate.Limiter) error {
 	*lmt = rate.NewLimiter(rate.Limit(rl), bl)
 
 	// Set the database semaphore
-	dbSemaphore = make(chan struct{}, config.Database.MaxConns-3)
+	maxConns, _ := cdb.ConnectionLimits(*config)
+	dbSemaphore = make(chan struct{}, max(maxConns-3, 1))
 
 	// Initialize the database
 	cmn.DebugMsg(cmn.DbgLvlInfo, "Initializing database connection...")
@@ -233,6 +234,7 @@ func initAPIv1() {
 	webObjectHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(webObjectHandler)))
 	webCorrelatedSitesHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(webCorrelatedSitesHandler)))
 	webScrapedDataHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(webScrapedDataHandler)))
+	keywordsSearchHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(keywordsSearchHandler)))
 
 	http.Handle("/v1/search/general", searchHandlerWithMiddlewares)
 	http.Handle("/v1/search/netinfo", netInfoHandlerWithMiddlewares)
@@ -241,6 +243,7 @@ func initAPIv1() {
 	http.Handle("/v1/search/webobject", webObjectHandlerWithMiddlewares)
 	http.Handle("/v1/search/correlated_sites", webCorrelatedSitesHandlerWithMiddlewares)
 	http.Handle("/v1/search/collected_data", webScrapedDataHandlerWithMiddlewares)
+	http.Handle("/v1/search/keywords", keywordsSearchHandlerWithMiddlewares)
 
 	if config.API.EnableConsole {
 		addSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(addSourceHandler)))
@@ -249,6 +252,8 @@ func initAPIv1() {
 		vacuumSourceHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(vacuumSourceHandler)))
 		singleURLstatusHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(singleURLstatusHandler)))
 		allURLstatusHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(allURLstatusHandler)))
+		recrawlSourcesHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(recrawlSourcesHandler)))
+		sourceReportHandlerWithMiddlewares := SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(sourceReportHandler)))
 
 		http.Handle("/v1/source/add", addSourceHandlerWithMiddlewares)
 		http.Handle("/v1/source/remove", removeSourceHandlerWithMiddlewares)
@@ -256,6 +261,8 @@ func initAPIv1() {
 		http.Handle("/v1/source/vacuum", vacuumSourceHandlerWithMiddlewares)
 		http.Handle("/v1/source/status", singleURLstatusHandlerWithMiddlewares)
 		http.Handle("/v1/source/statuses", allURLstatusHandlerWithMiddlewares)
+		http.Handle("/v1/source/recrawl", recrawlSourcesHandlerWithMiddlewares)
+		http.Handle("/v1/source/report", sourceReportHandlerWithMiddlewares)
 
 		// Owner endpoints
 		http.Handle("/v1/owner/add", SecurityHeadersMiddleware(RateLimitMiddleware(http.HandlerFunc(addOwnerHandler))))
@@ -496,6 +503,36 @@ func webScrapedDataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// keywordsSearchHandler handles the keywords search requests
+func keywordsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	select {
+	case dbSemaphore <- struct{}{}:
+		defer func() { <-dbSemaphore }()
+
+		successCode := http.StatusOK
+		if _, _, _, err := parseKeywordsQuery(r.URL.Query()); err != nil {
+			handleErrorAndRespond(w, err, nil, "Invalid keywords search request: %v", http.StatusBadRequest, successCode)
+			return
+		}
+
+		results, err := performKeywordsSearch(r.URL.Query(), &dbHandler)
+		if err == nil && len(results.Items) == 0 && config.API.Return404 {
+			successCode = http.StatusNotFound
+		}
+		handleErrorAndRespond(w, err, results, "Error performing keywords search: %v", http.StatusInternalServerError, successCode)
+	case <-time.After(5 * time.Second): // Wait for a connection with timeout
+		healthStatus := HealthCheck{
+			Status: "DB is overloaded, please try again later",
+		}
+		handleErrorAndRespond(w, nil, healthStatus, "", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	}
+}
+
 // scrImgSrchHandler handles the search requests for screenshot images
 func scrImgSrchHandler(w http.ResponseWriter, r *http.Request) {
 	select {
@@ -764,6 +801,61 @@ func allURLstatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// recrawlSourcesHandler handles the on-demand recrawl of the sources with a tag
+func recrawlSourcesHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case dbSemaphore <- struct{}{}:
+		defer func() { <-dbSemaphore }()
+
+		successCode := http.StatusOK
+		query, err := extractQueryOrBody(r)
+		if err != nil {
+			handleErrorAndRespond(w, err, nil, "Missing parameter 'q' in recrawl request", http.StatusBadRequest, successCode)
+			return
+		}
+
+		results, err := performRecrawlSources(query, getQTypeFromName(r.Method), &dbHandler)
+		handleErrorAndRespond(w, err, results, "Error performing recrawl: %v", http.StatusInternalServerError, successCode)
+	case <-time.After(5 * time.Second): // Wait for a connection with timeout
+		healthStatus := HealthCheck{
+			Status: "DB is overloaded, please try again later",
+		}
+		handleErrorAndRespond(w, nil, healthStatus, "", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	}
+}
+
+// sourceReportHandler handles the consolidated source report requests
+// (JSON by default, HTML with format=html)
+func sourceReportHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case dbSemaphore <- struct{}{}:
+		defer func() { <-dbSemaphore }()
+
+		successCode := http.StatusOK
+		query, err := extractQueryOrBody(r)
+		if err != nil {
+			handleErrorAndRespond(w, err, nil, "Missing parameter 'q' in source report request", http.StatusBadRequest, successCode)
+			return
+		}
+
+		results, err := performSourceReport(query, getQTypeFromName(r.Method), &dbHandler)
+		if err != nil || !strings.EqualFold(r.URL.Query().Get("format"), reportHTML) {
+			handleErrorAndRespond(w, err, results, "Error performing source report: %v", http.StatusInternalServerError, successCode)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(successCode)
+		if err := writeSourceReportHTML(w, results); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "writing source report: %v", err)
+		}
+	case <-time.After(5 * time.Second): // Wait for a connection with timeout
+		healthStatus := HealthCheck{
+			Status: "DB is overloaded, please try again later",
+		}
+		handleErrorAndRespond(w, nil, healthStatus, "", http.StatusTooManyRequests, http.StatusTooManyRequests)
+	}
+}
+
 func addOwnerHandler(w http.ResponseWriter, r *http.Request) {
 	handleRequestWithDB(w, r, http.StatusCreated, func(query string, qType int, db *cdb.Handler) (interface{}, error) {
 		return performAddOwner(query, qType, db)
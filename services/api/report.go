@@ -0,0 +1,305 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package main (API) implements the API server for the Crowler search engine.
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+	httpi "github.com/pzaino/thecrowler/pkg/httpinfo"
+	neti "github.com/pzaino/thecrowler/pkg/netinfo"
+)
+
+const (
+	reportMaxPages = 1000 // Maximum number of indexed pages listed in a Source report
+	reportHTML     = "html"
+)
+
+const (
+	reportSourceQuery = `
+	SELECT source_id, url, status, last_crawled_at, last_error
+	FROM Sources
+	WHERE url = $1`
+	reportPagesQuery = `
+	SELECT si.page_url, COALESCE(si.title, ''), si.summary, COALESCE(si.detected_type, ''),
+		COALESCE(si.detected_lang, ''), si.last_updated_at, COUNT(*) OVER()
+	FROM SearchIndex si
+	JOIN SourceSearchIndex ssi ON si.index_id = ssi.index_id
+	WHERE ssi.source_id = $1
+	ORDER BY si.page_url
+	LIMIT $2`
+	reportNetInfoQuery = `
+	SELECT DISTINCT ni.netinfo_id, ni.details
+	FROM NetInfo ni
+	JOIN NetInfoIndex nii ON ni.netinfo_id = nii.netinfo_id
+	JOIN SourceSearchIndex ssi ON nii.index_id = ssi.index_id
+	WHERE ssi.source_id = $1
+	ORDER BY ni.netinfo_id`
+	reportHTTPInfoQuery = `
+	SELECT DISTINCT hi.httpinfo_id, hi.details
+	FROM HTTPInfo hi
+	JOIN HTTPInfoIndex hii ON hi.httpinfo_id = hii.httpinfo_id
+	JOIN SourceSearchIndex ssi ON hii.index_id = ssi.index_id
+	WHERE ssi.source_id = $1
+	ORDER BY hi.httpinfo_id`
+)
+
+// performSourceReport builds the consolidated report of the Source with the
+// URL in the query (a plain URL for GET requests, a SourceReportRequest for
+// POST requests)
+func performSourceReport(query string, qType int, db *cdb.Handler) (SourceReport, error) {
+	sourceURL := PrepareInput(query)
+	if qType != getQuery {
+		var req SourceReportRequest
+		if err := json.Unmarshal([]byte(query), &req); err != nil {
+			return SourceReport{}, err
+		}
+		sourceURL = strings.TrimSpace(req.URL)
+	}
+	if sourceURL == "" {
+		return SourceReport{}, errors.New("the source URL is required")
+	}
+	return buildSourceReport(db, sourceURL)
+}
+
+// buildSourceReport queries the indexed pages, network information and HTTP
+// information of a Source and assembles them in a SourceReport
+func buildSourceReport(db *cdb.Handler, sourceURL string) (SourceReport, error) {
+	report := SourceReport{GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
+
+	var status, lastCrawledAt, lastError sql.NullString
+	err := (*db).QueryRow(reportSourceQuery, sourceURL).Scan(&report.Source.SourceID, &report.Source.URL, &status, &lastCrawledAt, &lastError)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return SourceReport{}, fmt.Errorf("source '%s' not found", sourceURL)
+		}
+		return SourceReport{}, err
+	}
+	report.Source.Status = status.String
+	report.Source.LastCrawledAt = lastCrawledAt.String
+	report.Source.LastError = lastError.String
+
+	if err := addReportPages(db, &report); err != nil {
+		return SourceReport{}, err
+	}
+	if err := addReportNetInfo(db, &report); err != nil {
+		return SourceReport{}, err
+	}
+	if err := addReportHTTPInfo(db, &report); err != nil {
+		return SourceReport{}, err
+	}
+	return report, nil
+}
+
+// addReportPages adds the indexed pages summary to a report
+func addReportPages(db *cdb.Handler, report *SourceReport) error {
+	rows, err := (*db).ExecuteQuery(reportPagesQuery, report.Source.SourceID, reportMaxPages)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	for rows.Next() {
+		var page SourceReportPage
+		var lastUpdatedAt sql.NullString
+		if err := rows.Scan(&page.URL, &page.Title, &page.Summary, &page.DetectedType, &page.DetectedLang, &lastUpdatedAt, &report.Pages.Total); err != nil {
+			return err
+		}
+		page.LastUpdatedAt = lastUpdatedAt.String
+		report.Pages.Items = append(report.Pages.Items, page)
+	}
+	return rows.Err()
+}
+
+// addReportNetInfo adds the IPs, DNS, WHOIS and ServiceScout information
+// collected on the pages of the Source to a report (without duplicates)
+func addReportNetInfo(db *cdb.Handler, report *SourceReport) error {
+	rows, err := (*db).ExecuteQuery(reportNetInfoQuery, report.Source.SourceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var id uint64
+		var detailsJSON []byte
+		if err := rows.Scan(&id, &detailsJSON); err != nil {
+			return err
+		}
+		var details neti.NetInfo
+		if err := json.Unmarshal(detailsJSON, &details); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "decoding netinfo %d: %v", id, err)
+			continue
+		}
+
+		for _, ip := range details.IPs.IP {
+			if isNewReportItem(seen, "ip", ip) {
+				report.IPs = append(report.IPs, ip)
+			}
+		}
+		for _, dns := range details.DNS {
+			if isNewReportItem(seen, "dns", dns) {
+				report.DNS = append(report.DNS, dns)
+			}
+		}
+		for _, whois := range details.WHOIS {
+			if isNewReportItem(seen, "whois", whois) {
+				report.WHOIS = append(report.WHOIS, whois)
+			}
+		}
+		for _, host := range details.ServiceScout.Hosts {
+			if isNewReportItem(seen, "host", host) {
+				report.ServiceScout = append(report.ServiceScout, host)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// addReportHTTPInfo adds the TLS certificates and the technologies detected
+// on the pages of the Source to a report
+func addReportHTTPInfo(db *cdb.Handler, report *SourceReport) error {
+	rows, err := (*db).ExecuteQuery(reportHTTPInfoQuery, report.Source.SourceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	seen := make(map[string]bool)
+	techs := make(map[string]*SourceReportTechRow)
+	for rows.Next() {
+		var id uint64
+		var detailsJSON []byte
+		if err := rows.Scan(&id, &detailsJSON); err != nil {
+			return err
+		}
+		var details httpi.HTTPDetails
+		if err := json.Unmarshal(detailsJSON, &details); err != nil {
+			cmn.DebugMsg(cmn.DbgLvlError, "decoding httpinfo %d: %v", id, err)
+			continue
+		}
+
+		if len(details.SSLInfo.FQDNs) > 0 || len(details.SSLInfo.Issuers) > 0 {
+			ssl := details.SSLInfo
+			ssl.CertChains = nil // The certificates are available in the httpinfo details
+			if isNewReportItem(seen, "tls", ssl) {
+				report.TLS = append(report.TLS, ssl)
+			}
+		}
+		for name, entity := range details.DetectedEntities {
+			tech, ok := techs[name]
+			if !ok {
+				tech = &SourceReportTechRow{Name: name, Type: entity.EntityType}
+				techs[name] = tech
+			}
+			if entity.Confidence > tech.Confidence {
+				tech.Confidence = entity.Confidence
+			}
+			if details.URL != "" && isNewReportItem(seen, "tech:"+name, details.URL) {
+				tech.Pages = append(tech.Pages, details.URL)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(techs))
+	for name := range techs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report.Technologies = append(report.Technologies, *techs[name])
+	}
+	return nil
+}
+
+// isNewReportItem returns true the first time an item (of a kind) is seen
+func isNewReportItem(seen map[string]bool, kind string, item interface{}) bool {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return true
+	}
+	key := kind + "\x00" + string(data)
+	if seen[key] {
+		return false
+	}
+	seen[key] = true
+	return true
+}
+
+// sourceReportTemplate is the HTML version of a SourceReport
+var sourceReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CROWler report: {{.Source.URL}}</title>
+</head>
+<body>
+<h1>{{.Source.URL}}</h1>
+<p>Source {{.Source.SourceID}}, status: {{.Source.Status}}{{if .Source.LastCrawledAt}}, last crawled at: {{.Source.LastCrawledAt}}{{end}}{{if .Source.LastError}}, last error: {{.Source.LastError}}{{end}}</p>
+<p>Report generated at: {{.GeneratedAt}}</p>
+
+<h2>Indexed pages ({{.Pages.Total}})</h2>
+<table>
+<tr><th>URL</th><th>Title</th><th>Type</th><th>Language</th><th>Last updated</th></tr>
+{{range .Pages.Items}}<tr><td>{{.URL}}</td><td>{{.Title}}</td><td>{{.DetectedType}}</td><td>{{.DetectedLang}}</td><td>{{.LastUpdatedAt}}</td></tr>
+{{end}}</table>
+
+<h2>Network</h2>
+<p>IPs: {{range $i, $ip := .IPs}}{{if $i}}, {{end}}{{$ip}}{{end}}</p>
+{{range .DNS}}<h3>DNS: {{.Domain}}</h3>
+<table>
+<tr><th>Name</th><th>Type</th><th>Response</th></tr>
+{{range .Records}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Response}}</td></tr>
+{{end}}</table>
+{{end}}{{range .WHOIS}}<h3>WHOIS: {{.Entity}}</h3>
+<p>Registrar: {{.Registrar}}, registrant: {{.RegistrantOrganization}} {{.RegistrantCountry}}, expiry: {{.RegistryExpiryDate}}</p>
+{{end}}
+<h2>ServiceScout</h2>
+{{range .ServiceScout}}<h3>{{range .IP}}{{.Address}} {{end}}{{range .Hostname}}{{.Name}} {{end}}</h3>
+<table>
+<tr><th>Port</th><th>Protocol</th><th>State</th><th>Service</th></tr>
+{{range .Ports}}<tr><td>{{.Port}}</td><td>{{.Protocol}}</td><td>{{.State}}</td><td>{{.Service}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>TLS</h2>
+{{range .TLS}}<p>{{range .FQDNs}}{{.}} {{end}}issued by {{range .Issuers}}{{.}} {{end}}(expires: {{.CertExpiration}}, valid: {{.IsCertValid}})</p>
+{{end}}
+<h2>Technologies</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>Confidence</th><th>Pages</th></tr>
+{{range .Technologies}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Confidence}}</td><td>{{len .Pages}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writeSourceReportHTML writes the HTML version of a report
+func writeSourceReportHTML(w io.Writer, report SourceReport) error {
+	return sourceReportTemplate.Execute(w, report)
+}
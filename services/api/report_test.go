@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	cdb "github.com/pzaino/thecrowler/pkg/database"
+)
+
+// fakeReportConn is a minimal database/sql driver connection answering the
+// source report queries with seeded rows
+type fakeReportConn struct {
+	rows map[string][][]driver.Value // Seeded rows (by table)
+}
+
+func (c *fakeReportConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *fakeReportConn) Driver() driver.Driver                        { return nil }
+func (c *fakeReportConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeReportConn) Close() error              { return nil }
+func (c *fakeReportConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeReportConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var table string
+	switch query {
+	case reportSourceQuery:
+		if args[0].Value.(string) != "https://example.com" {
+			return &fakeReportRows{}, nil
+		}
+		table = "Sources"
+	case reportPagesQuery:
+		table = "SearchIndex"
+	case reportNetInfoQuery:
+		table = "NetInfo"
+	case reportHTTPInfoQuery:
+		table = "HTTPInfo"
+	default:
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	return &fakeReportRows{values: c.rows[table]}, nil
+}
+
+type fakeReportRows struct{ values [][]driver.Value }
+
+func (r *fakeReportRows) Columns() []string {
+	if len(r.values) == 0 {
+		return []string{"source_id", "url", "status", "last_crawled_at", "last_error"}
+	}
+	return make([]string, len(r.values[0]))
+}
+func (r *fakeReportRows) Close() error { return nil }
+func (r *fakeReportRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// fakeReportHandler is a database handler backed by a fakeReportConn
+type fakeReportHandler struct {
+	cdb.Handler
+	db *sql.DB
+}
+
+func (h *fakeReportHandler) QueryRow(query string, args ...interface{}) *sql.Row {
+	return h.db.QueryRow(query, args...)
+}
+
+func (h *fakeReportHandler) ExecuteQuery(query string, args ...interface{}) (*sql.Rows, error) {
+	return h.db.Query(query, args...)
+}
+
+func TestBuildSourceReport(t *testing.T) {
+	netInfo := `{"ips":{"ip":["192.0.2.10"]},
+		"dns":[{"domain":"example.com","records":[{"name":"example.com","type":"A","response":"192.0.2.10"}]}],
+		"whois":[{"entity":"example.com","registrar":"Example Registrar"}],
+		"service_scout":{"hosts":[{"ip":[{"address":"192.0.2.10"}],"ports":[{"port":443,"protocol":"tcp","state":"open","service":"https"}]}]}}`
+	conn := &fakeReportConn{rows: map[string][][]driver.Value{
+		"Sources": {{int64(7), "https://example.com", "completed", "2026-10-01T10:00:00Z", nil}},
+		"SearchIndex": {
+			{"https://example.com", "Home", "Welcome", "html", "en", "2026-10-01T10:00:00Z", int64(2)},
+			{"https://example.com/about", "About", "About us", "html", "en", nil, int64(2)},
+		},
+		"NetInfo": {
+			{int64(1), []byte(netInfo)},
+			{int64(2), []byte(netInfo)}, // Same information collected on another page
+		},
+		"HTTPInfo": {
+			{int64(1), []byte(`{"url":"https://example.com","ssl_info":{"fqdns":["example.com"],"issuers":["Example CA"],"is_cert_valid":true},
+				"detected_assets":{"nginx":{"entity_type":"server","confidence":80},"jQuery":{"entity_type":"library","confidence":60}}}`)},
+			{int64(2), []byte(`{"url":"https://example.com/about","ssl_info":{"fqdns":["example.com"],"issuers":["Example CA"],"is_cert_valid":true},
+				"detected_assets":{"nginx":{"entity_type":"server","confidence":95}}}`)},
+		},
+	}}
+	var db cdb.Handler = &fakeReportHandler{db: sql.OpenDB(conn)}
+
+	report, err := performSourceReport("https://example.com", getQuery, &db)
+	if err != nil {
+		t.Fatalf("performSourceReport() error = %v", err)
+	}
+
+	if report.Source.SourceID != 7 || report.Source.Status != "completed" {
+		t.Errorf("Source = %+v, want source 7 completed", report.Source)
+	}
+	if report.Pages.Total != 2 || len(report.Pages.Items) != 2 || report.Pages.Items[1].Title != "About" {
+		t.Errorf("Pages = %+v, want the 2 indexed pages", report.Pages)
+	}
+	if fmt.Sprint(report.IPs) != "[192.0.2.10]" || len(report.DNS) != 1 || len(report.WHOIS) != 1 {
+		t.Errorf("IPs = %v, DNS = %d, WHOIS = %d entries, want 1 each (without duplicates)", report.IPs, len(report.DNS), len(report.WHOIS))
+	}
+	if len(report.ServiceScout) != 1 || report.ServiceScout[0].Ports[0].Port != 443 {
+		t.Errorf("ServiceScout = %+v, want host with port 443", report.ServiceScout)
+	}
+	if len(report.TLS) != 1 || report.TLS[0].Issuers[0] != "Example CA" {
+		t.Errorf("TLS = %+v, want the Example CA certificate", report.TLS)
+	}
+	if len(report.Technologies) != 2 {
+		t.Fatalf("Technologies = %+v, want jQuery and nginx", report.Technologies)
+	}
+	nginx := report.Technologies[1]
+	if nginx.Name != "nginx" || nginx.Confidence != 95 || len(nginx.Pages) != 2 {
+		t.Errorf("Technologies[1] = %+v, want nginx detected on 2 pages with confidence 95", nginx)
+	}
+
+	var html bytes.Buffer
+	if err := writeSourceReportHTML(&html, report); err != nil {
+		t.Fatalf("writeSourceReportHTML() error = %v", err)
+	}
+	for _, want := range []string{"Indexed pages (2)", "Example Registrar", "<td>443</td>", "Example CA", "<td>nginx</td>"} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("HTML report doesn't contain %q", want)
+		}
+	}
+
+	if _, err := performSourceReport(`{"url":"https://unknown.example.com"}`, postQuery, &db); err == nil {
+		t.Errorf("performSourceReport() error = nil for an unknown source")
+	}
+}
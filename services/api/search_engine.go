@@ -16,15 +16,20 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 	"unicode"
 
 	cmn "github.com/pzaino/thecrowler/pkg/common"
+	cfg "github.com/pzaino/thecrowler/pkg/config"
 	cdb "github.com/pzaino/thecrowler/pkg/database"
 
 	_ "github.com/lib/pq"
@@ -38,6 +43,9 @@ const (
 	noQueryProvided     = "no query provided"
 	queryExecTime       = "Query execution time: %v"
 	dataEncapTime       = "Data encapsulation execution time: %v"
+
+	maxSearchKeywords = 32  // Maximum number of keywords of a keywords search
+	maxSearchLimit    = 100 // Maximum number of results of a keywords search page
 )
 
 // SearchQuery represents the result of a processed search query.
@@ -518,6 +526,13 @@ func isLogicalOperator(op string) bool {
 func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
 	cmn.DebugMsg(cmn.DbgLvlDebug, searchLabel, query)
 
+	// Exclude the pages with duplicate title and summary in all the Sources
+	// reaching them (if requested)
+	searchIndex := "SearchIndex"
+	if config.API.ExcludeDuplicates {
+		searchIndex = "(SELECT * FROM SearchIndex WHERE index_id IN (SELECT index_id FROM SourceSearchIndex WHERE NOT low_distinctiveness))"
+	}
+
 	// Prepare the query body
 	var queryBody string
 	if config.API.ReturnContent {
@@ -525,7 +540,7 @@ func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
 		SELECT DISTINCT
 			si.title, si.page_url, si.summary, wo.object_content AS content
 		FROM
-			SearchIndex si
+			` + searchIndex + ` si
 		LEFT JOIN
 			WebObjectsIndex woi ON si.index_id = woi.index_id
 		LEFT JOIN
@@ -541,7 +556,7 @@ func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
 		SELECT DISTINCT
 			si.title, si.page_url, si.summary, '' as content
 		FROM
-			SearchIndex si
+			` + searchIndex + ` si
 		LEFT JOIN
 			KeywordIndex ki ON si.index_id = ki.index_id
 		LEFT JOIN
@@ -612,6 +627,158 @@ func performSearch(query string, db *cdb.Handler) (SearchResult, error) {
 	return results, nil
 }
 
+// parseKeywordsQuery returns the keywords of a keywords search (lowercase and
+// without duplicates) with its limit (capped to maxSearchLimit) and offset
+func parseKeywordsQuery(values url.Values) ([]string, int, int, error) {
+	var keywords []string
+	for _, keyword := range strings.Fields(strings.ToLower(values.Get("q"))) {
+		if runes := []rune(keyword); len(runes) > 256 {
+			// Keywords are indexed truncated to 256 characters
+			keyword = string(runes[:256])
+		}
+		if !cmn.SliceContains(keywords, keyword) {
+			keywords = append(keywords, keyword)
+		}
+	}
+	if len(keywords) == 0 {
+		return nil, 0, 0, errors.New(noQueryProvided)
+	}
+	if len(keywords) > maxSearchKeywords {
+		return nil, 0, 0, fmt.Errorf("too many keywords (max %d)", maxSearchKeywords)
+	}
+
+	limit, offset := 10, 0
+	var err error
+	if val := values.Get("limit"); val != "" {
+		if limit, err = strconv.Atoi(val); err != nil || limit < 1 {
+			return nil, 0, 0, errors.New("invalid limit value")
+		}
+		limit = min(limit, maxSearchLimit)
+	}
+	if val := values.Get("offset"); val != "" {
+		if offset, err = strconv.Atoi(val); err != nil || offset < 0 {
+			return nil, 0, 0, errors.New("invalid offset value")
+		}
+	}
+	return keywords, limit, offset, nil
+}
+
+// buildKeywordsQuery returns the SQL query (and its parameters) of a keywords
+// search: the pages are ranked by the number of keywords they match (and then
+// by the keywords occurrences), with the link of their latest screenshot
+func buildKeywordsQuery(keywords []string, limit, offset int, excludeDuplicates bool) (string, []interface{}) {
+	searchIndex := "SearchIndex"
+	if excludeDuplicates {
+		searchIndex = "(SELECT * FROM SearchIndex WHERE index_id IN (SELECT index_id FROM SourceSearchIndex WHERE NOT low_distinctiveness))"
+	}
+
+	placeholders := make([]string, 0, len(keywords))
+	params := make([]interface{}, 0, len(keywords)+2)
+	for i, keyword := range keywords {
+		placeholders = append(placeholders, "$"+strconv.Itoa(i+1))
+		params = append(params, keyword)
+	}
+	params = append(params, limit, offset)
+
+	sqlQuery := `
+		SELECT
+			si.page_url, COALESCE(si.title, ''), si.summary,
+			COALESCE((SELECT s.screenshot_link FROM Screenshots s
+			          WHERE s.index_id = si.index_id
+			          ORDER BY s.created_at DESC LIMIT 1), '') AS snapshot_url,
+			COUNT(DISTINCT k.keyword_id) AS matches, si.last_updated_at
+		FROM
+			` + searchIndex + ` si
+		JOIN
+			KeywordIndex ki ON si.index_id = ki.index_id
+		JOIN
+			Keywords k ON ki.keyword_id = k.keyword_id
+		WHERE
+			k.keyword IN (` + strings.Join(placeholders, ", ") + `)
+		GROUP BY
+			si.index_id, si.page_url, si.title, si.summary, si.last_updated_at
+		ORDER BY
+			matches DESC, COALESCE(SUM(ki.occurrences), 0) DESC, si.page_url
+		LIMIT $` + strconv.Itoa(len(keywords)+1) + ` OFFSET $` + strconv.Itoa(len(keywords)+2) + `;`
+	return sqlQuery, params
+}
+
+// performKeywordsSearch searches the indexed pages matching the keywords of
+// the query
+func performKeywordsSearch(values url.Values, db *cdb.Handler) (KeywordsSearchResponse, error) {
+	keywords, limit, offset, err := parseKeywordsQuery(values)
+	if err != nil {
+		return KeywordsSearchResponse{}, err
+	}
+	cmn.DebugMsg(cmn.DbgLvlDebug, searchLabel, strings.Join(keywords, " "))
+
+	// With the freshness ranking, the best matching pages are ranked by score
+	// (and then paginated)
+	ranked := config.API.FreshnessWeight > 0
+	sqlLimit, sqlOffset := limit, offset
+	if ranked {
+		sqlLimit, sqlOffset = max(config.API.RankingCandidates, offset+limit), 0
+	}
+	sqlQuery, sqlParams := buildKeywordsQuery(keywords, sqlLimit, sqlOffset, config.API.ExcludeDuplicates)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryLabel, sqlQuery)
+	cmn.DebugMsg(cmn.DbgLvlDebug1, sqlQueryParamsLabel, sqlParams)
+
+	// Take the current timer (to monitor query performance)
+	start := time.Now()
+
+	rows, err := (*db).ExecuteQuery(sqlQuery, sqlParams...)
+	if err != nil {
+		return KeywordsSearchResponse{}, err
+	}
+	defer rows.Close() //nolint:errcheck // Don't lint for error not checked, this is a defer statement
+
+	cmn.DebugMsg(cmn.DbgLvlDebug1, queryExecTime, time.Since(start))
+
+	results := KeywordsSearchResponse{Items: []KeywordsSearchResult{}, Limit: limit, Offset: offset}
+	now := time.Now()
+	for rows.Next() {
+		var item KeywordsSearchResult
+		var lastUpdatedAt sql.NullTime
+		if err := rows.Scan(&item.PageURL, &item.Title, &item.Summary, &item.SnapshotURL, &item.Matches, &lastUpdatedAt); err != nil {
+			return KeywordsSearchResponse{}, err
+		}
+		if ranked {
+			item.Score = keywordsScore(item.Matches, lastUpdatedAt, now, config.API)
+		}
+		results.Items = append(results.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return KeywordsSearchResponse{}, err
+	}
+	if ranked {
+		results.Items = rankKeywordsResults(results.Items, limit, offset)
+	}
+	return results, nil
+}
+
+// keywordsScore returns the ranking score of a keywords search result: the
+// weighted number of keywords the page matches plus the weighted freshness of
+// the page (1 when it has just been updated, halved every freshness_half_life
+// days and 0 if its update time is unknown)
+func keywordsScore(matches int, lastUpdatedAt sql.NullTime, now time.Time, api cfg.API) float64 {
+	score := api.KeywordWeight * float64(matches)
+	if !lastUpdatedAt.Valid || api.FreshnessHalfLife < 1 {
+		return score
+	}
+	age := max(now.Sub(lastUpdatedAt.Time).Hours()/24, 0)
+	return score + api.FreshnessWeight*math.Pow(0.5, age/float64(api.FreshnessHalfLife))
+}
+
+// rankKeywordsResults sorts the keywords search results by score (the results
+// with the same score keep their order) and returns the requested page of them
+func rankKeywordsResults(items []KeywordsSearchResult, limit, offset int) []KeywordsSearchResult {
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Score > items[j].Score })
+	if offset >= len(items) {
+		return []KeywordsSearchResult{}
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
 func performScreenshotSearch(query string, qType int, db *cdb.Handler) (ScreenshotResponse, error) {
 	var err error
 
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	cfg "github.com/pzaino/thecrowler/pkg/config"
 )
 
 func TestTokenize(t *testing.T) {
@@ -254,3 +260,97 @@ func TestParseAdvancedQuery(t *testing.T) {
 		}
 	}
 }
+
+func TestKeywordsQuery(t *testing.T) {
+	var tooMany []string
+	for i := 0; i <= maxSearchKeywords; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("k%d", i))
+	}
+	tests := []struct {
+		query    string
+		keywords []string
+		limit    int
+		offset   int
+		wantErr  bool
+	}{
+		{"q=Golang+crawler+golang", []string{"golang", "crawler"}, 10, 0, false},
+		{"q=news&limit=5&offset=20", []string{"news"}, 5, 20, false},
+		{"q=+", nil, 0, 0, true},
+		{"q=news&limit=100000", []string{"news"}, maxSearchLimit, 0, false},
+		{"q=" + strings.Repeat("é", 300), []string{strings.Repeat("é", 256)}, 10, 0, false},
+		{"q=news&limit=0", nil, 0, 0, true},
+		{"q=news&offset=-1", nil, 0, 0, true},
+		{"q=" + strings.Join(tooMany, "+"), nil, 0, 0, true},
+	}
+	for _, test := range tests {
+		values, _ := url.ParseQuery(test.query)
+		keywords, limit, offset, err := parseKeywordsQuery(values)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseKeywordsQuery(%q) error = %v, wantErr %v", test.query, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(keywords, test.keywords) || limit != test.limit || offset != test.offset {
+			t.Errorf("parseKeywordsQuery(%q) = %v, %d, %d; want %v, %d, %d", test.query, keywords, limit, offset, test.keywords, test.limit, test.offset)
+		}
+	}
+
+	// The pages are ranked by the number of matched keywords, paginated
+	sqlQuery, params := buildKeywordsQuery([]string{"golang", "crawler"}, 5, 20, true)
+	if !reflect.DeepEqual(params, []interface{}{"golang", "crawler", 5, 20}) {
+		t.Errorf("buildKeywordsQuery() params = %v", params)
+	}
+	for _, want := range []string{"k.keyword IN ($1, $2)", "ORDER BY\n\t\t\tmatches DESC", "LIMIT $3 OFFSET $4", "NOT low_distinctiveness", "snapshot_url", "si.last_updated_at"} {
+		if !strings.Contains(sqlQuery, want) {
+			t.Errorf("buildKeywordsQuery() query doesn't contain %q:\n%s", want, sqlQuery)
+		}
+	}
+}
+
+func TestKeywordsRanking(t *testing.T) {
+	api := cfg.NewConfig().API
+	api.FreshnessWeight = 0.5
+	now := time.Now()
+	updated := func(days int) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-time.Duration(days) * 24 * time.Hour), Valid: true}
+	}
+
+	// The freshness halves every freshness_half_life days
+	if score := keywordsScore(2, updated(0), now, api); score != 2.5 {
+		t.Errorf("keywordsScore() of a page updated now = %v, want 2.5", score)
+	}
+	if score := keywordsScore(2, updated(api.FreshnessHalfLife), now, api); score != 2.25 {
+		t.Errorf("keywordsScore() of a page updated a half-life ago = %v, want 2.25", score)
+	}
+	if score := keywordsScore(2, sql.NullTime{}, now, api); score != 2 {
+		t.Errorf("keywordsScore() of a page never updated = %v, want 2", score)
+	}
+
+	// A recently updated page outranks an older equally matching one, but not
+	// a page matching more keywords
+	item := func(url string, matches, days int) KeywordsSearchResult {
+		return KeywordsSearchResult{PageURL: url, Matches: matches, Score: keywordsScore(matches, updated(days), now, api)}
+	}
+	items := []KeywordsSearchResult{
+		item("https://example.com/best", 3, 1000),
+		item("https://example.com/old", 2, 365),
+		item("https://example.com/recent", 2, 1),
+		item("https://example.com/fresh", 1, 0),
+	}
+	ranked := rankKeywordsResults(items, 10, 0)
+	var urls []string
+	for _, result := range ranked {
+		urls = append(urls, result.PageURL)
+	}
+	want := []string{"https://example.com/best", "https://example.com/recent", "https://example.com/old", "https://example.com/fresh"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("rankKeywordsResults() = %v, want %v", urls, want)
+	}
+
+	// The ranked results are paginated
+	if page := rankKeywordsResults(ranked, 2, 1); len(page) != 2 || page[0].PageURL != want[1] {
+		t.Errorf("rankKeywordsResults() page = %v, want %v", page, want[1:3])
+	}
+	if page := rankKeywordsResults(ranked, 2, 10); len(page) != 0 {
+		t.Errorf("rankKeywordsResults() past the results = %v, want none", page)
+	}
+}
@@ -58,6 +58,60 @@ type StatusResponseRow struct {
 	Disabled      bool             `json:"disabled"`
 	Flags         int              `json:"flags"`
 	Config        cfg.SourceConfig `json:"config,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+// SourceReportRequest represents the structure of the source report request POST
+type SourceReportRequest struct {
+	URL string `json:"url"`
+}
+
+// SourceReport is the consolidated report of a Source: its indexed pages and
+// the network (DNS, WHOIS, ServiceScout), TLS and technologies information
+// collected while crawling it
+type SourceReport struct {
+	GeneratedAt  string                `json:"generated_at"`
+	Source       SourceReportInfo      `json:"source"`
+	Pages        SourceReportPages     `json:"pages"`
+	IPs          []string              `json:"ips,omitempty"`
+	DNS          []neti.DNSInfo        `json:"dns,omitempty"`
+	WHOIS        []neti.WHOISData      `json:"whois,omitempty"`
+	ServiceScout []neti.HostInfo       `json:"service_scout,omitempty"`
+	TLS          []httpi.SSLDetails    `json:"tls,omitempty"`
+	Technologies []SourceReportTechRow `json:"technologies,omitempty"`
+}
+
+// SourceReportInfo is the Source section of a SourceReport
+type SourceReportInfo struct {
+	SourceID      uint64 `json:"source_id"`
+	URL           string `json:"url"`
+	Status        string `json:"status"`
+	LastCrawledAt string `json:"last_crawled_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// SourceReportPages is the indexed pages summary of a SourceReport
+type SourceReportPages struct {
+	Total int                `json:"total"`
+	Items []SourceReportPage `json:"items,omitempty"`
+}
+
+// SourceReportPage is an indexed page of a SourceReport
+type SourceReportPage struct {
+	URL           string `json:"url"`
+	Title         string `json:"title"`
+	Summary       string `json:"summary"`
+	DetectedType  string `json:"detected_type,omitempty"`
+	DetectedLang  string `json:"detected_lang,omitempty"`
+	LastUpdatedAt string `json:"last_updated_at,omitempty"`
+}
+
+// SourceReportTechRow is a technology detected on the pages of a Source
+type SourceReportTechRow struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type,omitempty"`
+	Confidence float32  `json:"confidence"`
+	Pages      []string `json:"pages"` // The pages the technology has been detected on
 }
 
 // addSourceRequest represents the structure of the add source request
@@ -70,6 +124,7 @@ type addSourceRequest struct {
 	Disabled   bool             `json:"disabled,omitempty"`
 	Flags      int              `json:"flags,omitempty"`
 	Config     cfg.SourceConfig `json:"config,omitempty"`
+	Tags       []string         `json:"tags,omitempty"`
 }
 
 // SearchResult represents the structure of the search result
@@ -158,6 +213,23 @@ type ScreenshotRequest struct {
 	} `json:"auth,omitempty"`
 }
 
+// KeywordsSearchResponse represents the structure of the keywords search response
+type KeywordsSearchResponse struct {
+	Items  []KeywordsSearchResult `json:"items"`
+	Limit  int                    `json:"limit"`  // Limit of results
+	Offset int                    `json:"offset"` // Offset of results
+}
+
+// KeywordsSearchResult represents an indexed page matching a keywords search
+type KeywordsSearchResult struct {
+	PageURL     string  `json:"page_url"`
+	Title       string  `json:"title"`
+	Summary     string  `json:"summary"`
+	SnapshotURL string  `json:"snapshot_url"`    // The link of the latest screenshot of the page (if any)
+	Matches     int     `json:"matches"`         // The number of the search keywords the page matches
+	Score       float64 `json:"score,omitempty"` // The ranking score of the page (with the freshness ranking)
+}
+
 // ScreenshotResponse represents the structure of the screenshot response
 type ScreenshotResponse struct {
 	Link          string `json:"screenshot_link"`